@@ -0,0 +1,137 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdaptiveCache - кеш у пам'яті, що підбирає час життя запису для кожного ключа за тим,
+// як часто змінюється його значення. Зміну кеш помічає, коли значення, прочитане з
+// сервісу БД, приходить з іншим ETag, ніж попереднє. Час життя - частка adaptiveTTLShare
+// від середнього інтервалу між змінами (або від часу, що минув без змін), обмежена
+// MinTTL і MaxTTL: ключ, що майже не змінюється (дата команди), кешується надовго,
+// а часто змінюваний лишається свіжим.
+type AdaptiveCache struct {
+	*MemoryCache
+	minTTL, maxTTL time.Duration
+
+	mu    sync.Mutex
+	churn map[string]*keyChurn
+	// nextSweep - кількість відстежуваних ключів, після якої забуваються давно не читані.
+	nextSweep int
+}
+
+const (
+	// adaptiveTTLShare - частка інтервалу між змінами, на яку кешується значення: за такої
+	// частки застаріле значення віддається приблизно в чверті читань після зміни.
+	adaptiveTTLShare = 0.25
+	// churnSmoothing - вага нового інтервалу в ковзному середньому інтервалів між змінами.
+	churnSmoothing = 0.25
+	// churnForgetAfter - скільки максимальних часів життя ключ має не читатися, щоб кеш
+	// забув його статистику.
+	churnForgetAfter = 10
+)
+
+// keyChurn - спостереження за змінами значення ключа.
+type keyChurn struct {
+	etag string
+	// since - час останньої помиченої зміни або першого читання ключа.
+	since time.Time
+	// interval - ковзне середнє інтервалу між змінами; 0, поки змін не було.
+	interval time.Duration
+	changes  int
+	lastSeen time.Time
+}
+
+// NewAdaptiveCache створює кеш, час життя записів якого підбирається між minTTL і maxTTL.
+// Якщо clock nil, використовується системний годинник.
+func NewAdaptiveCache(minTTL, maxTTL time.Duration, clock Clock) *AdaptiveCache {
+	return &AdaptiveCache{
+		MemoryCache: NewMemoryCache(minTTL, clock),
+		minTTL:      minTTL,
+		maxTTL:      maxTTL,
+		churn:       make(map[string]*keyChurn),
+		nextSweep:   minCacheSweep,
+	}
+}
+
+// Set зберігає запис із часом життя, підібраним для ключа.
+func (c *AdaptiveCache) Set(key string, entry CacheEntry) {
+	c.setWithTTL(key, entry, c.observe(key, entry.ETag))
+}
+
+// observe враховує прочитане значення ключа й повертає його час життя в кеші.
+func (c *AdaptiveCache) observe(key, etag string) time.Duration {
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.churn) >= c.nextSweep {
+		for k, ch := range c.churn {
+			if now.Sub(ch.lastSeen) > churnForgetAfter*c.maxTTL {
+				delete(c.churn, k)
+			}
+		}
+		c.nextSweep = max(2*len(c.churn), minCacheSweep)
+	}
+	ch, ok := c.churn[key]
+	if !ok {
+		ch = &keyChurn{etag: etag, since: now}
+		c.churn[key] = ch
+	} else if etag != ch.etag {
+		sample := now.Sub(ch.since)
+		if ch.interval == 0 {
+			ch.interval = sample
+		} else {
+			ch.interval = time.Duration(churnSmoothing*float64(sample) + (1-churnSmoothing)*float64(ch.interval))
+		}
+		ch.etag, ch.since = etag, now
+		ch.changes++
+	}
+	ch.lastSeen = now
+	return c.ttlLocked(ch, now)
+}
+
+// ttlLocked обчислює час життя запису ключа. Поки змін не було, основою слугує час від
+// першого читання, тож стабільні ключі поступово кешуються довше.
+func (c *AdaptiveCache) ttlLocked(ch *keyChurn, now time.Time) time.Duration {
+	// Пауза без змін, довша за середній інтервал, означає, що ключ став стабільнішим.
+	base := max(ch.interval, now.Sub(ch.since))
+	return min(max(time.Duration(adaptiveTTLShare*float64(base)), c.minTTL), c.maxTTL)
+}
+
+// LearnedTTL - підібраний час життя запису ключа, див. AdaptiveCache.TTLs.
+type LearnedTTL struct {
+	Key string `json:"key"`
+	// TTL - час життя, з яким ключ кешується зараз.
+	TTL time.Duration `json:"ttl_ns"`
+	// ChangeInterval - середній інтервал між зміненими значеннями; 0, поки змін не було.
+	ChangeInterval time.Duration `json:"change_interval_ns"`
+	Changes        int           `json:"changes"`
+	LastChange     time.Time     `json:"last_change"`
+}
+
+// TTLs повертає підібрані часи життя всіх відстежуваних ключів у порядку ключів.
+func (c *AdaptiveCache) TTLs() []LearnedTTL {
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ttls := make([]LearnedTTL, 0, len(c.churn))
+	for key, ch := range c.churn {
+		ttls = append(ttls, LearnedTTL{Key: key, TTL: c.ttlLocked(ch, now), ChangeInterval: ch.interval, Changes: ch.changes, LastChange: ch.since})
+	}
+	sort.Slice(ttls, func(i, j int) bool { return ttls[i].Key < ttls[j].Key })
+	return ttls
+}
+
+// ServeHTTP віддає підібрані часи життя ключів у JSON.
+func (c *AdaptiveCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		MinTTL time.Duration `json:"min_ttl_ns"`
+		MaxTTL time.Duration `json:"max_ttl_ns"`
+		Keys   []LearnedTTL  `json:"keys"`
+	}{c.minTTL, c.maxTTL, c.TTLs()})
+}
@@ -0,0 +1,69 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveCache_LearnsTTLPerKey(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	cache := NewAdaptiveCache(time.Second, time.Hour, clock)
+	read := func(key, etag string) {
+		cache.Set(key, CacheEntry{ETag: etag})
+	}
+	ttlOf := func(key string) time.Duration {
+		for _, learned := range cache.TTLs() {
+			if learned.Key == key {
+				return learned.TTL
+			}
+		}
+		t.Fatalf("key %s is not tracked", key)
+		return 0
+	}
+
+	// volatile змінюється щосекунди, team - ніколи.
+	read("team", `"date"`)
+	for i := 0; i < 20; i++ {
+		read("volatile", string(rune('a'+i)))
+		clock.now = clock.now.Add(time.Second)
+	}
+	read("team", `"date"`)
+	if ttl := ttlOf("volatile"); ttl != time.Second {
+		t.Errorf("volatile key TTL = %v, want the minimum", ttl)
+	}
+	if ttl := ttlOf("team"); ttl != 5*time.Second {
+		t.Errorf("stable key TTL after 20s = %v, want 5s", ttl)
+	}
+
+	// Запис живе в кеші підібраний час.
+	read("volatile", "z")
+	clock.now = clock.now.Add(2 * time.Second)
+	if _, ok := cache.Get("volatile"); ok {
+		t.Error("volatile key outlived the minimum TTL")
+	}
+	clock.now = clock.now.Add(10 * time.Hour)
+	if ttl := ttlOf("team"); ttl != time.Hour {
+		t.Errorf("stable key TTL after 10h = %v, want the maximum", ttl)
+	}
+	read("team", `"date"`)
+	clock.now = clock.now.Add(59 * time.Minute)
+	if _, ok := cache.Get("team"); !ok {
+		t.Error("stable key expired before its learned TTL")
+	}
+
+	rec := httptest.NewRecorder()
+	New(Options{DB: &fakeDB{}, Cache: cache, Clock: clock, Debug: true, Logger: discardLogger{}}).Handler().
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache-ttls", nil))
+	var resp struct {
+		Keys []LearnedTTL `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || len(resp.Keys) != 2 {
+		t.Fatalf("debug endpoint returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Keys[1].Key != "volatile" || resp.Keys[1].Changes != 20 {
+		t.Errorf("volatile key stats = %+v", resp.Keys[1])
+	}
+}
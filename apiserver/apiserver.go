@@ -0,0 +1,414 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/keyrename"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+)
+
+// Clock повертає поточний час; у тестах його підміняють фіксованим.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Logger - журнал сервера; *log.Logger задовольняє цей інтерфейс.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// Options - залежності API-сервера. Обов'язковий лише DB, решта мають значення за замовчуванням.
+type Options struct {
+	DB DBClient
+	// Cache кешує прочитані значення; nil вимикає кешування.
+	Cache Cache
+	Clock Clock
+	// Logger за замовчуванням - стандартний журнал пакета log.
+	Logger Logger
+	// TeamName - ключ, під яким StoreInitialDate зберігає дату запуску.
+	TeamName string
+	// SlowLog - журнал повільних запитів, доступний через /admin/slowlog.
+	SlowLog *httptools.SlowLog
+	// Debug вмикає налагоджувальні можливості, зокрема ?pretty=1.
+	Debug bool
+	// Encryptor шифрує значення перед записом у сервіс БД; nil вимикає шифрування.
+	Encryptor *Encryptor
+	// Renames - перейменування ключів, див. пакет keyrename. Ключ, якого немає в БД,
+	// до RenamesUntil читається під старою назвою; нульовий RenamesUntil - без обмеження.
+	Renames      *keyrename.Mapping
+	RenamesUntil time.Time
+	// LogPolicy визначає, як значення потрапляють у журнал; nil - logpolicy.DefaultPolicy.
+	LogPolicy *logpolicy.Redactor
+	// AdminToken захищає /admin/log-policy (Authorization: Bearer <токен>); порожній
+	// токен вимикає ендпоінт.
+	AdminToken string
+	// Adaptation - пристосування до навантаження пулу, див. pressure.go; нульове - вимкнене.
+	Adaptation LoadAdaptation
+}
+
+// Server - обробники API сервера, які звертаються до сервісу БД через DBClient.
+type Server struct {
+	db       DBClient
+	cache    Cache
+	clock    Clock
+	log      Logger
+	teamName string
+	slowLog  *httptools.SlowLog
+	debug    bool
+	enc      *Encryptor
+	redact   *logpolicy.Redactor
+	admin    string
+	adapt    LoadAdaptation
+	inFlight atomic.Int64
+	// generation - останнє покоління бази, повідомлене сервісом БД, див. generation.go.
+	generation atomic.Pointer[string]
+
+	renames      *keyrename.Mapping
+	renamesUntil time.Time
+}
+
+// New створює API-сервер із заданими залежностями.
+func New(opts Options) *Server {
+	s := &Server{
+		db:       opts.DB,
+		cache:    opts.Cache,
+		clock:    opts.Clock,
+		log:      opts.Logger,
+		teamName: opts.TeamName,
+		slowLog:  opts.SlowLog,
+		debug:    opts.Debug,
+		enc:      opts.Encryptor,
+		redact:   opts.LogPolicy,
+		admin:    opts.AdminToken,
+		adapt:    opts.Adaptation,
+
+		renames:      opts.Renames,
+		renamesUntil: opts.RenamesUntil,
+	}
+	if s.cache == nil {
+		s.cache = noCache{}
+	}
+	if s.clock == nil {
+		s.clock = systemClock{}
+	}
+	if s.log == nil {
+		s.log = log.Default()
+	}
+	if s.slowLog == nil {
+		s.slowLog = httptools.NewSlowLog(httptools.DefaultSlowThreshold, httptools.DefaultSlowLogSize)
+	}
+	if s.redact == nil {
+		s.redact = logpolicy.New(logpolicy.DefaultPolicy())
+	}
+	return s
+}
+
+// Handler повертає обробник усіх маршрутів сервера разом з middleware.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/some-data", s.someDataHandler)
+	mux.HandleFunc("POST /api/v1/some-data", s.putSomeDataHandler)
+	mux.HandleFunc("PUT /api/v1/some-data", s.putSomeDataHandler)
+	mux.HandleFunc("GET /health", s.healthHandler)
+	mux.HandleFunc("GET /load", s.loadHandler)
+	mux.Handle("GET /admin/slowlog", s.slowLog)
+	mux.Handle("GET /admin/log-policy", s.adminAuth(s.redact))
+	if adaptive, ok := s.cache.(*AdaptiveCache); ok && s.debug {
+		mux.Handle("GET /debug/cache-ttls", adaptive)
+	}
+	return httptools.Chain(mux, s.countInFlight, s.slowLog.Middleware("SERVER_MAIN"), httptools.Recoverer("SERVER_MAIN"), s.adaptToLoad, httptools.PrettyJSON(s.debug))
+}
+
+// adminAuth пропускає лише запити з заголовком Authorization: Bearer <AdminToken>, так само
+// як адміністративні ендпоінти сервера БД.
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.admin == "" {
+			http.Error(w, "admin API is disabled: SERVER_ADMIN_TOKEN is not set", http.StatusForbidden)
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.admin)) != 1 {
+			s.log.Printf("SERVER_HANDLER: Rejected admin request %s %s", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// StoreInitialDate зберігає поточну дату під ключем команди, повторюючи спробу, поки БД стартує.
+func (s *Server) StoreInitialDate(ctx context.Context) error {
+	currentDate := s.clock.Now().Format("2006-01-02")
+	requestBody, err := json.Marshal(map[string]string{"value": currentDate})
+	if err != nil {
+		return fmt.Errorf("failed to marshal date for DB: %w", err)
+	}
+
+	s.log.Printf("SERVER_MAIN_INIT: Attempting to POST initial date '%s' for team '%s' to DB", currentDate, s.teamName)
+
+	maxRetries := 5
+	var resp DBResponse
+	for i := 0; i < maxRetries; i++ {
+		resp, err = s.put(ctx, s.teamName, requestBody, "")
+		if err == nil {
+			break
+		}
+		s.log.Printf("SERVER_MAIN_INIT: Failed to POST initial date (attempt %d/%d): %v. Retrying in 2 seconds...", i+1, maxRetries, err)
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to POST initial date to DB service after %d retries: %w", maxRetries, err)
+	}
+	if resp.Status != http.StatusCreated && resp.Status != http.StatusOK {
+		return fmt.Errorf("DB service returned non-OK status for initial POST: %s, Error: %s", statusText(resp.Status), resp.Body.Error)
+	}
+	s.cache.Delete(s.teamName)
+	s.log.Printf("SERVER_MAIN_INIT: Successfully saved current date for team '%s' to DB.", s.teamName)
+	return nil
+}
+
+// statusText повертає статус у вигляді "404 Not Found", як http.Response.Status.
+func statusText(status int) string {
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+func (s *Server) someDataHandler(w http.ResponseWriter, r *http.Request) {
+	queryKey := r.URL.Query().Get("key")
+	if queryKey == "" {
+		http.Error(w, "Query parameter 'key' is required", http.StatusBadRequest)
+		return
+	}
+	s.log.Printf("SERVER_HANDLER: GET /api/v1/some-data for key: %s", queryKey)
+
+	if cached, ok := s.cachedValue(r.Context(), queryKey); ok {
+		if cached.Generation == s.dbGeneration() {
+			s.log.Printf("SERVER_HANDLER: Serving key '%s' from cache", queryKey)
+			setGeneration(w, cached.Generation)
+			writeValue(w, http.StatusOK, cached.ETag, cached.Value)
+			return
+		}
+		s.log.Printf("SERVER_HANDLER: Cached value of key '%s' is from DB generation %s, dropping it", queryKey, cached.Generation)
+		s.cache.Delete(queryKey)
+	}
+
+	s.log.Printf("SERVER_HANDLER: Forwarding GET request for key '%s' to DB service", queryKey)
+	dbResp, err := s.getWithFallback(r.Context(), queryKey)
+	if s.clientGone(r, queryKey, err) {
+		return
+	}
+	if errors.Is(err, ErrBadResponse) {
+		s.log.Printf("SERVER_HANDLER: Error decoding response from DB service for key '%s': %v", queryKey, err)
+		http.Error(w, "Internal server error (bad DB response format)", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		s.log.Printf("SERVER_HANDLER: Error requesting data from DB service for key '%s': %v", queryKey, err)
+		http.Error(w, "Internal server error (DB unreachable)", http.StatusInternalServerError)
+		return
+	}
+	s.observeGeneration(dbResp.Generation)
+	setGeneration(w, dbResp.Generation)
+
+	if dbResp.Status == http.StatusNotFound {
+		s.log.Printf("SERVER_HANDLER: Key '%s' not found in DB service.", queryKey)
+		s.cache.Delete(queryKey)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if dbResp.Status != http.StatusOK {
+		s.log.Printf("SERVER_HANDLER: DB service returned non-OK status for key '%s': %s, Error: %s", queryKey, statusText(dbResp.Status), dbResp.Body.Error)
+		if dbResp.Retryable != "" {
+			w.Header().Set(retryableHeader, dbResp.Retryable)
+		}
+		http.Error(w, fmt.Sprintf("Error retrieving data from DB: status %s", statusText(dbResp.Status)), http.StatusInternalServerError)
+		return
+	}
+
+	if dbResp.Body.Error != "" {
+		s.log.Printf("SERVER_HANDLER: DB service returned an error for key '%s': %s", queryKey, dbResp.Body.Error)
+		http.Error(w, dbResp.Body.Error, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.decryptValue(queryKey, &dbResp.Body); err != nil {
+		s.log.Printf("SERVER_HANDLER: Failed to decrypt value of key '%s': %v", queryKey, err)
+		http.Error(w, "Internal server error (cannot decrypt value)", http.StatusInternalServerError)
+		return
+	}
+	s.log.Printf("SERVER_HANDLER: Successfully retrieved value for key '%s' from DB, value: %s", queryKey, s.redact.Value(queryKey, dbResp.Body.Value))
+	s.cache.Set(queryKey, CacheEntry{Value: dbResp.Body, ETag: dbResp.ETag, Generation: dbResp.Generation})
+	writeValue(w, http.StatusOK, dbResp.ETag, dbResp.Body)
+}
+
+// putSomeDataHandler записує значення ключа через сервіс БД.
+//
+// Заголовок If-Match робить запис умовним: якщо значення змінилося після того, як клієнт
+// отримав його ETag (з GET або попереднього запису), повертається 412 Precondition Failed.
+// Щоб не перезаписати чужі зміни, клієнт повторює цикл: GET -> зміна значення ->
+// POST з If-Match: <ETag з GET>, і при 412 починає цикл знову з GET.
+func (s *Server) putSomeDataHandler(w http.ResponseWriter, r *http.Request) {
+	queryKey := r.URL.Query().Get("key")
+	if queryKey == "" {
+		http.Error(w, "Query parameter 'key' is required", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	s.log.Printf("SERVER_HANDLER: %s /api/v1/some-data for key: %s, If-Match: %q", r.Method, queryKey, ifMatch)
+	if ifMatch != "" && s.staleGeneration(r) {
+		s.log.Printf("SERVER_HANDLER: If-Match for key '%s' is from DB generation %s, current is %s", queryKey, r.Header.Get(generationHeader), s.dbGeneration())
+		setGeneration(w, s.dbGeneration())
+		http.Error(w, "Database was restored since the value was read; re-read it and retry", http.StatusPreconditionFailed)
+		return
+	}
+
+	dbResp, err := s.put(r.Context(), queryKey, body, ifMatch)
+	if s.clientGone(r, queryKey, err) {
+		return
+	}
+	if errors.Is(err, errBadRequestBody) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.log.Printf("SERVER_HANDLER: Error writing data to DB service for key '%s': %v", queryKey, err)
+		http.Error(w, "Internal server error (DB unreachable)", http.StatusInternalServerError)
+		return
+	}
+	// Запис, навіть відхилений, означає, що кешоване значення могло застаріти.
+	s.cache.Delete(queryKey)
+	s.observeGeneration(dbResp.Generation)
+	setGeneration(w, dbResp.Generation)
+
+	switch dbResp.Status {
+	case http.StatusOK, http.StatusCreated:
+		if err := s.decryptValue(queryKey, &dbResp.Body); err != nil {
+			s.log.Printf("SERVER_HANDLER: Failed to decrypt stored value of key '%s': %v", queryKey, err)
+		}
+		s.log.Printf("SERVER_HANDLER: Successfully stored value for key '%s', value: %s", queryKey, s.redact.Value(queryKey, dbResp.Body.Value))
+		writeValue(w, dbResp.Status, dbResp.ETag, dbResp.Body)
+	case http.StatusPreconditionFailed:
+		s.log.Printf("SERVER_HANDLER: Stale If-Match for key '%s'", queryKey)
+		http.Error(w, "Value was modified by another client; re-read it and retry", http.StatusPreconditionFailed)
+	case http.StatusBadRequest:
+		http.Error(w, dbResp.Body.Error, http.StatusBadRequest)
+	default:
+		s.log.Printf("SERVER_HANDLER: DB service returned non-OK status for key '%s': %s, Error: %s", queryKey, statusText(dbResp.Status), dbResp.Body.Error)
+		if dbResp.Retryable != "" {
+			w.Header().Set(retryableHeader, dbResp.Retryable)
+		}
+		http.Error(w, fmt.Sprintf("Error storing data in DB: status %s", statusText(dbResp.Status)), http.StatusInternalServerError)
+	}
+}
+
+// clientGone повідомляє, що звернення до сервісу БД обірвалося, бо клієнт від'єднався:
+// контекст запиту скасовується разом із з'єднанням, і сервіс БД покидає невиконаний запис.
+// Відповідати вже нікому, тож обробник лише журналює це.
+func (s *Server) clientGone(r *http.Request, key string, err error) bool {
+	if err == nil || r.Context().Err() == nil {
+		return false
+	}
+	s.log.Printf("SERVER_HANDLER: Client cancelled request for key '%s', abandoned DB call: %v", key, err)
+	return true
+}
+
+// errBadRequestBody - тіло запиту запису не вдалося розібрати для шифрування.
+var errBadRequestBody = errors.New("invalid request body")
+
+// put записує ключ у сервіс БД, попередньо шифруючи значення, якщо шифрування ввімкнено.
+func (s *Server) put(ctx context.Context, key string, body []byte, ifMatch string) (DBResponse, error) {
+	if s.enc != nil {
+		encrypted, err := s.enc.encryptBody(key, body)
+		if err != nil {
+			return DBResponse{}, fmt.Errorf("%w: %v", errBadRequestBody, err)
+		}
+		body = encrypted
+	}
+	return s.db.Put(ctx, key, body, ifMatch)
+}
+
+// getWithFallback читає ключ, а якщо його немає і триває перехідний період перейменування,
+// читає його під старою назвою. Відповідь для старої назви повертається з ключем key.
+func (s *Server) getWithFallback(ctx context.Context, key string) (DBResponse, error) {
+	resp, err := s.db.Get(ctx, key)
+	if err != nil || resp.Status != http.StatusNotFound {
+		return resp, err
+	}
+	oldKey, ok := s.renames.OldKey(key)
+	if !ok || !s.renamesUntil.IsZero() && !s.clock.Now().Before(s.renamesUntil) {
+		return resp, nil
+	}
+	oldResp, err := s.db.Get(ctx, oldKey)
+	if err != nil {
+		return oldResp, err
+	}
+	if oldResp.Status == http.StatusNotFound {
+		return resp, nil
+	}
+	s.log.Printf("SERVER_HANDLER: Key '%s' not found, read it under its old name '%s'", key, oldKey)
+	if oldResp.Body.Key == oldKey {
+		oldResp.Body.Key = key
+	}
+	return oldResp, nil
+}
+
+// decryptValue розшифровує значення відповіді сервісу БД, якщо шифрування ввімкнено.
+// Шифротекст прив'язаний до назви ключа, тож значення, перенесене з перейменованого ключа,
+// розшифровується під старою назвою.
+func (s *Server) decryptValue(key string, body *DbValueResponse) error {
+	if s.enc == nil || body.Value == nil {
+		return nil
+	}
+	value, err := s.enc.Decrypt(key, body.Value)
+	if oldKey, ok := s.renames.OldKey(key); err != nil && ok {
+		if oldValue, oldErr := s.enc.Decrypt(oldKey, body.Value); oldErr == nil {
+			value, err = oldValue, nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	body.Value = value
+	return nil
+}
+
+func writeValue(w http.ResponseWriter, status int, etag string, value DbValueResponse) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// healthHandler обробляє запити /health
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	s.log.Printf("SERVER_HANDLER: GET /health -> 200 OK")
+}
@@ -0,0 +1,458 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/keyrename"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+)
+
+func TestPutSomeData_ForwardsIfMatch(t *testing.T) {
+	const currentETag = `"abc"`
+	fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != currentETag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", `"def"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"key":"k","value":"v"}`))
+	}))
+	defer fakeDb.Close()
+
+	router := New(Options{DB: NewHTTPDBClient(fakeDb.URL + "/db")}).Handler()
+	send := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/some-data?key=k", strings.NewReader(`{"value":"v"}`))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(`"stale"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match returned %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	rec := send(currentETag)
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") != `"def"` {
+		t.Errorf("current If-Match returned %d with ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestSlowLog_RecordsDbTimingsWithRequestID(t *testing.T) {
+	var seenID string
+	fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = r.Header.Get(httptools.RequestIDHeader)
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"key":"k","value":"v"}`))
+	}))
+	defer fakeDb.Close()
+
+	router := New(Options{
+		DB:      NewHTTPDBClient(fakeDb.URL + "/db"),
+		SlowLog: httptools.NewSlowLog(10*time.Millisecond, 10),
+	}).Handler()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil)
+	req.Header.Set(httptools.RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get(httptools.RequestIDHeader) != "req-42" {
+		t.Fatalf("GET returned %d with request id %q", rec.Code, rec.Header().Get(httptools.RequestIDHeader))
+	}
+	if seenID != "req-42" {
+		t.Errorf("DB service received request id %q, want req-42", seenID)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/slowlog", nil))
+	var entries []httptools.SlowEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil || len(entries) != 1 {
+		t.Fatalf("slowlog returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if entries[0].RequestID != "req-42" || entries[0].Timings["db"] < 30*time.Millisecond {
+		t.Errorf("unexpected slow log entry %+v", entries[0])
+	}
+}
+
+// fakeDB - DBClient, який повертає заздалегідь задані відповіді.
+type fakeDB struct {
+	get     DBResponse
+	getErr  error
+	put     DBResponse
+	gets    int
+	putKeys []string
+	putBody []string
+}
+
+func (f *fakeDB) Get(_ context.Context, key string) (DBResponse, error) {
+	f.gets++
+	return f.get, f.getErr
+}
+
+func (f *fakeDB) Put(_ context.Context, key string, body []byte, _ string) (DBResponse, error) {
+	f.putKeys = append(f.putKeys, key)
+	f.putBody = append(f.putBody, string(body))
+	return f.put, nil
+}
+
+// fakeClock - годинник, час якого змінюється лише тестом.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// discardLogger не записує нічого.
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
+
+// bufferLogger збирає повідомлення журналу.
+type bufferLogger struct{ lines []string }
+
+func (l *bufferLogger) Printf(format string, v ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestSomeDataHandler_MapsDBResponses(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		resp          DBResponse
+		err           error
+		wantStatus    int
+		wantRetryable string
+		wantBody      string
+	}{
+		{"value", DBResponse{Status: http.StatusOK, ETag: `"e1"`, Body: DbValueResponse{Key: "k", Value: "v"}}, nil, http.StatusOK, "", `{"key":"k","value":"v"}`},
+		{"missing key", DBResponse{Status: http.StatusNotFound}, nil, http.StatusNotFound, "", ""},
+		{"retryable failure", DBResponse{Status: http.StatusServiceUnavailable, Retryable: "true"}, nil, http.StatusInternalServerError, "true", "Error retrieving data from DB: status 503 Service Unavailable"},
+		{"unreachable", DBResponse{}, errors.New("connection refused"), http.StatusInternalServerError, "", "Internal server error (DB unreachable)"},
+		{"bad format", DBResponse{Status: http.StatusOK}, ErrBadResponse, http.StatusInternalServerError, "", "Internal server error (bad DB response format)"},
+	} {
+		db := &fakeDB{get: tc.resp, getErr: tc.err}
+		router := New(Options{DB: db, Logger: discardLogger{}}).Handler()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil))
+		if rec.Code != tc.wantStatus || rec.Header().Get(retryableHeader) != tc.wantRetryable {
+			t.Errorf("%s: got %d with X-Retryable %q, want %d with %q", tc.name, rec.Code, rec.Header().Get(retryableHeader), tc.wantStatus, tc.wantRetryable)
+		}
+		if body := strings.TrimSpace(rec.Body.String()); body != tc.wantBody {
+			t.Errorf("%s: body %q, want %q", tc.name, body, tc.wantBody)
+		}
+		if tc.resp.ETag != "" && rec.Header().Get("ETag") != tc.resp.ETag {
+			t.Errorf("%s: ETag %q, want %q", tc.name, rec.Header().Get("ETag"), tc.resp.ETag)
+		}
+	}
+}
+
+func TestSomeDataHandler_Cache(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	db := &fakeDB{
+		get: DBResponse{Status: http.StatusOK, ETag: `"e1"`, Body: DbValueResponse{Key: "k", Value: "v"}},
+		put: DBResponse{Status: http.StatusCreated},
+	}
+	router := New(Options{DB: db, Cache: NewMemoryCache(time.Second, clock), Clock: clock, Logger: discardLogger{}}).Handler()
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil))
+		return rec
+	}
+
+	get()
+	if rec := get(); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"e1"` || db.gets != 1 {
+		t.Fatalf("cached read returned %d with ETag %q after %d DB reads", rec.Code, rec.Header().Get("ETag"), db.gets)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if get(); db.gets != 2 {
+		t.Errorf("expired entry was served from cache")
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/v1/some-data?key=k", strings.NewReader(`{"value":"w"}`)))
+	if get(); db.gets != 3 {
+		t.Errorf("write did not invalidate the cached value")
+	}
+}
+
+func TestSomeDataHandler_DBGenerationChange(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	db := &fakeDB{
+		get: DBResponse{Status: http.StatusOK, ETag: `"e1"`, Generation: "gen-1", Body: DbValueResponse{Key: "k", Value: "v"}},
+		put: DBResponse{Status: http.StatusCreated, Generation: "gen-2"},
+	}
+	router := New(Options{DB: db, Cache: NewMemoryCache(time.Minute, clock), Clock: clock, Logger: discardLogger{}}).Handler()
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil))
+		return rec
+	}
+
+	get()
+	if rec := get(); db.gets != 1 || rec.Header().Get(generationHeader) != "gen-1" {
+		t.Fatalf("cached read returned generation %q after %d DB reads", rec.Header().Get(generationHeader), db.gets)
+	}
+	// Запис іншого ключа повідомляє нове покоління: базу відновлено.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/v1/some-data?key=other", strings.NewReader(`{"value":"w"}`)))
+	db.get.Generation = "gen-2"
+	if rec := get(); db.gets != 2 || rec.Header().Get(generationHeader) != "gen-2" {
+		t.Errorf("value cached in an old DB generation was served")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/some-data?key=k", strings.NewReader(`{"value":"x"}`))
+	req.Header.Set("If-Match", `"e1"`)
+	req.Header.Set(generationHeader, "gen-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed || len(db.putKeys) != 1 {
+		t.Errorf("If-Match from an old generation returned %d after %d DB writes", rec.Code, len(db.putKeys))
+	}
+}
+
+func TestStoreInitialDate_UsesClock(t *testing.T) {
+	db := &fakeDB{put: DBResponse{Status: http.StatusCreated}}
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 23, 0, 0, 0, time.UTC)}
+	srv := New(Options{DB: db, Clock: clock, Logger: discardLogger{}, TeamName: "duo"})
+	if err := srv.StoreInitialDate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.putKeys) != 1 || db.putKeys[0] != "duo" || db.putBody[0] != `{"value":"2025-05-01"}` {
+		t.Errorf("unexpected writes %v %v", db.putKeys, db.putBody)
+	}
+
+	db.put = DBResponse{Status: http.StatusInternalServerError, Body: DbValueResponse{Error: "disk full"}}
+	if err := srv.StoreInitialDate(context.Background()); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("expected the DB error to be reported, got %v", err)
+	}
+}
+
+func TestLoadHandler_ReportsInFlightAndDBQueue(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer fakeDb.Close()
+
+	router := New(Options{DB: NewHTTPDBClient(fakeDb.URL + "/db")}).Handler()
+	load := func() LoadReport {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/load", nil))
+		var report LoadReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+	if report := load(); report != (LoadReport{}) {
+		t.Errorf("idle server reported %+v", report)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil))
+	}()
+	<-entered
+	if report := load(); report != (LoadReport{InFlight: 1, DBQueueDepth: 1}) {
+		t.Errorf("busy server reported %+v, want 1 request waiting on the DB", report)
+	}
+	close(release)
+	<-done
+	if report := load(); report != (LoadReport{}) {
+		t.Errorf("server reported %+v after the request finished", report)
+	}
+}
+
+func TestSomeDataHandler_RenameFallback(t *testing.T) {
+	renames, err := keyrename.Parse(strings.NewReader("user-1 account-1\nsecret-old secret-new\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &storingDB{values: map[string]interface{}{"user-1": "alice"}}
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	enc := testKeys(t, key1, "")
+	srv := New(Options{DB: db, Clock: clock, Logger: discardLogger{}, Encryptor: enc, Renames: renames, RenamesUntil: clock.now.Add(time.Hour)})
+	router := srv.Handler()
+	get := func(key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key="+key, nil))
+		return rec
+	}
+
+	if rec := get("account-1"); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"key":"account-1","value":"alice"}` {
+		t.Errorf("GET of a key not migrated yet returned %d: %s", rec.Code, rec.Body.String())
+	}
+	// Значення, записане під новою назвою, має перевагу над старим.
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/some-data?key=account-1", strings.NewReader(`{"value":"bob"}`)))
+	if rec := get("account-1"); !strings.Contains(rec.Body.String(), "bob") {
+		t.Errorf("GET after a write under the new name returned %s", rec.Body.String())
+	}
+
+	// Зашифроване значення, перенесене під нову назву, розшифровується під старою.
+	ciphertext, err := enc.Encrypt("secret-old", "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.values["secret-new"] = ciphertext
+	if rec := get("secret-new"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"pin"`) {
+		t.Errorf("GET of a migrated encrypted value returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	delete(db.values, "account-1")
+	clock.now = clock.now.Add(time.Hour)
+	if rec := get("account-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after the transition window returned %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := get("user-1"); rec.Code != http.StatusOK {
+		t.Errorf("GET of a key that is not renamed returned %d", rec.Code)
+	}
+}
+
+func TestSomeDataHandlers_RedactLoggedValues(t *testing.T) {
+	policy, err := logpolicy.Parse([]byte(`{"default": {"action": "omit"}, "rules": [{"prefix": "public:", "action": "full"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := &bufferLogger{}
+	db := &fakeDB{
+		get: DBResponse{Status: http.StatusOK, Body: DbValueResponse{Key: "public:name", Value: "Alice"}},
+		put: DBResponse{Status: http.StatusCreated, Body: DbValueResponse{Key: "card", Value: "4111-1111"}},
+	}
+	router := New(Options{DB: db, Logger: logger, LogPolicy: logpolicy.New(policy)}).Handler()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=public:name", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/api/v1/some-data?key=card", strings.NewReader(`{"value":"4111-1111"}`)))
+
+	logged := strings.Join(logger.lines, "\n")
+	if strings.Contains(logged, "4111-1111") {
+		t.Errorf("redacted value leaked into the log:\n%s", logged)
+	}
+	if !strings.Contains(logged, "value: Alice") || !strings.Contains(logged, "value: <omitted>") {
+		t.Errorf("log does not follow the policy:\n%s", logged)
+	}
+}
+
+func TestSomeDataHandler_AdaptsToPoolLoad(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)}
+	db := &fakeDB{get: DBResponse{Status: http.StatusOK, Body: DbValueResponse{Key: "k", Value: "v"}}}
+	router := New(Options{
+		DB: db, Cache: NewMemoryCache(time.Second, clock), Clock: clock, Logger: discardLogger{},
+		Adaptation: LoadAdaptation{HighLoad: 4, StaleGrace: 5 * time.Second},
+	}).Handler()
+	get := func(inFlight, priority string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=k", nil)
+		if inFlight != "" {
+			req.Header.Set(lbInFlightHeader, inFlight)
+			req.Header.Set(lbBackendsHeader, "2")
+		}
+		if priority != "" {
+			req.Header.Set(priorityHeader, priority)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("4", "low"); rec.Code != http.StatusOK {
+		t.Errorf("low-priority request under normal load returned %d", rec.Code)
+	}
+	rec := get("8", "low")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || db.gets != 1 {
+		t.Errorf("low-priority request under high load returned %d (Retry-After %q) after %d DB reads",
+			rec.Code, rec.Header().Get("Retry-After"), db.gets)
+	}
+
+	// Під високим навантаженням застарілий запис ще віддається з кешу, під звичайним - ні.
+	clock.now = clock.now.Add(3 * time.Second)
+	if rec := get("10", ""); rec.Code != http.StatusOK || db.gets != 1 {
+		t.Errorf("stale entry under high load returned %d after %d DB reads", rec.Code, db.gets)
+	}
+	if get("", ""); db.gets != 2 {
+		t.Errorf("stale entry was served without load headers")
+	}
+	clock.now = clock.now.Add(7 * time.Second)
+	if get("10", ""); db.gets != 3 {
+		t.Errorf("entry older than the stale grace was served")
+	}
+}
+
+func TestSomeDataHandlers_CancelDbCallWithClient(t *testing.T) {
+	started := make(chan struct{}, 4)
+	cancelled := make(chan struct{}, 4)
+	fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Сервер помічає розрив з'єднання лише після того, як тіло запиту прочитано.
+		_, _ = io.Copy(io.Discard, r.Body)
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer fakeDb.Close()
+	dbClient := NewHTTPDBClient(fakeDb.URL + "/db")
+	router := New(Options{DB: dbClient}).Handler()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(method, "/api/v1/some-data?key=slow", strings.NewReader(`{"value":"v"}`)).WithContext(ctx)
+		done := make(chan struct{})
+		go func() {
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			close(done)
+		}()
+		<-started
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s handler kept waiting for the DB after the client disconnected", method)
+		}
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s request to the DB was not cancelled", method)
+		}
+		select {
+		case <-started:
+			t.Errorf("cancelled %s was retried against the DB", method)
+		case <-time.After(3 * dbRetryBackoff):
+		}
+		if pending := dbClient.Pending(); pending != 0 {
+			t.Errorf("%d DB requests still pending after %s was cancelled", pending, method)
+		}
+	}
+}
+
+func TestLogPolicy_RequiresAdminToken(t *testing.T) {
+	get := func(token, admin string) int {
+		router := New(Options{DB: &fakeDB{}, Logger: discardLogger{}, AdminToken: admin}).Handler()
+		req := httptest.NewRequest(http.MethodGet, "/admin/log-policy", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := get("", ""); code != http.StatusForbidden {
+		t.Errorf("log policy without a configured token returned %d, want %d", code, http.StatusForbidden)
+	}
+	if code := get("", "admin-secret"); code != http.StatusUnauthorized {
+		t.Errorf("log policy without a token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get("wrong", "admin-secret"); code != http.StatusUnauthorized {
+		t.Errorf("log policy with a wrong token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get("admin-secret", "admin-secret"); code != http.StatusOK {
+		t.Errorf("log policy with the admin token returned %d, want %d", code, http.StatusOK)
+	}
+}
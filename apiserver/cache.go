@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"sync"
+	"time"
+)
+
+// CacheEntry - значення ключа, прочитане з сервісу БД, разом з його ETag і поколінням бази.
+type CacheEntry struct {
+	Value      DbValueResponse
+	ETag       string
+	Generation string
+}
+
+// Cache зберігає прочитані значення, щоб повторні читання не зверталися до сервісу БД.
+type Cache interface {
+	Get(key string) (CacheEntry, bool)
+	Set(key string, entry CacheEntry)
+	Delete(key string)
+}
+
+// noCache - кеш, який нічого не зберігає.
+type noCache struct{}
+
+func (noCache) Get(string) (CacheEntry, bool) { return CacheEntry{}, false }
+func (noCache) Set(string, CacheEntry)        {}
+func (noCache) Delete(string)                 {}
+
+// MemoryCache - кеш у пам'яті процесу, записи якого застарівають через ttl.
+// Записи, змінені через інші сервери, можуть повертатися застарілими до ttl.
+type MemoryCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu    sync.Mutex
+	items map[string]memoryCacheItem
+	// nextSweep - розмір кешу, після якого з нього видаляються застарілі записи.
+	nextSweep int
+}
+
+// minCacheSweep - найменший розмір кешу, з якого починається видалення застарілих записів.
+const minCacheSweep = 1024
+
+type memoryCacheItem struct {
+	entry   CacheEntry
+	expires time.Time
+}
+
+// NewMemoryCache створює кеш з часом життя записів ttl. Якщо clock nil, використовується системний годинник.
+func NewMemoryCache(ttl time.Duration, clock Clock) *MemoryCache {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &MemoryCache{ttl: ttl, clock: clock, items: make(map[string]memoryCacheItem), nextSweep: minCacheSweep}
+}
+
+func (c *MemoryCache) Get(key string) (CacheEntry, bool) {
+	return c.GetStale(key, 0)
+}
+
+// GetStale повертає запис, навіть якщо він застарів, але не більше ніж на maxStale.
+// Записи, застарілі довше, видаляються; періодичне очищення в Set на maxStale не зважає.
+func (c *MemoryCache) GetStale(key string, maxStale time.Duration) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	if !c.clock.Now().Before(item.expires.Add(maxStale)) {
+		delete(c.items, key)
+		return CacheEntry{}, false
+	}
+	return item.entry, true
+}
+
+func (c *MemoryCache) Set(key string, entry CacheEntry) {
+	c.setWithTTL(key, entry, c.ttl)
+}
+
+// setWithTTL зберігає запис, що застаріє через ttl замість спільного часу життя кешу.
+func (c *MemoryCache) setWithTTL(key string, entry CacheEntry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if len(c.items) >= c.nextSweep {
+		for k, item := range c.items {
+			if !now.Before(item.expires) {
+				delete(c.items, k)
+			}
+		}
+		c.nextSweep = max(2*len(c.items), minCacheSweep)
+	}
+	c.items[key] = memoryCacheItem{entry: entry, expires: now.Add(ttl)}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
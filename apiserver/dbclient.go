@@ -0,0 +1,196 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/httptools"
+)
+
+// DbValueResponse - структура для десеріалізації відповіді від сервісу БД
+type DbValueResponse struct {
+	Key       string      `json:"key,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Retryable *bool       `json:"retryable,omitempty"`
+}
+
+// DBResponse - відповідь сервісу БД на читання або запис ключа.
+type DBResponse struct {
+	// Status - HTTP-статус відповіді сервісу БД.
+	Status int
+	// ETag - версія значення, якщо сервіс БД її повідомив.
+	ETag string
+	// Retryable - значення заголовка X-Retryable, порожнє, якщо його немає.
+	Retryable string
+	// Generation - покоління бази з заголовка X-DB-Generation, див. generation.go.
+	Generation string
+	Body       DbValueResponse
+}
+
+// DBClient - доступ до сервісу БД. Помилка повертається лише тоді, коли сервіс
+// недосяжний або відповів у незрозумілому форматі; статуси помилок передаються в DBResponse.
+type DBClient interface {
+	Get(ctx context.Context, key string) (DBResponse, error)
+	// Put записує тіло запиту body; непорожній ifMatch робить запис умовним.
+	Put(ctx context.Context, key string, body []byte, ifMatch string) (DBResponse, error)
+}
+
+// ErrBadResponse - сервіс БД повернув відповідь, яку не вдалося розібрати.
+var ErrBadResponse = errors.New("bad DB response format")
+
+const (
+	// retryableHeader - заголовок, яким сервіс БД позначає, чи має сенс повторювати запит.
+	retryableHeader = "X-Retryable"
+	// generationHeader - заголовок з поколінням бази, яке змінюється після її відновлення.
+	generationHeader = "X-DB-Generation"
+	dbMaxAttempts    = 3
+	dbRetryBackoff   = 100 * time.Millisecond
+)
+
+// HTTPDBClient звертається до HTTP API сервісу БД за адресою BaseURL (напр. http://db:8081/db).
+type HTTPDBClient struct {
+	BaseURL string
+	Client  *http.Client
+	Logger  Logger
+
+	pending atomic.Int64
+}
+
+// NewHTTPDBClient створює клієнт сервісу БД з http.DefaultClient та стандартним журналом.
+func NewHTTPDBClient(baseURL string) *HTTPDBClient {
+	return &HTTPDBClient{BaseURL: baseURL, Client: http.DefaultClient, Logger: log.Default()}
+}
+
+// isRetryableDbResponse повідомляє, чи варто повторити запит до БД після такої відповіді.
+// Повторюються лише помилки сервера, які сервіс БД не позначив як неповторювані.
+func isRetryableDbResponse(resp *http.Response) bool {
+	return resp.StatusCode >= http.StatusInternalServerError && resp.Header.Get(retryableHeader) != "false"
+}
+
+// Get читає ключ, повторюючи запит при мережевих та повторюваних помилках.
+func (c *HTTPDBClient) Get(ctx context.Context, key string) (DBResponse, error) {
+	resp, err := c.getFromDb(ctx, c.keyURL(key))
+	if err != nil {
+		return DBResponse{}, err
+	}
+	defer resp.Body.Close()
+	result := newDBResponse(resp)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&result.Body); err != nil {
+			return result, fmt.Errorf("%w: %v", ErrBadResponse, err)
+		}
+	default:
+		result.Body = decodeErrorBody(resp.Body)
+	}
+	return result, nil
+}
+
+// Put записує ключ. Запис не повторюється, бо він не обов'язково ідемпотентний.
+func (c *HTTPDBClient) Put(ctx context.Context, key string, body []byte, ifMatch string) (DBResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.keyURL(key), bytes.NewReader(body))
+	if err != nil {
+		return DBResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := c.doDbRequest(req)
+	if err != nil {
+		return DBResponse{}, err
+	}
+	defer resp.Body.Close()
+	result := newDBResponse(resp)
+	_ = json.NewDecoder(resp.Body).Decode(&result.Body)
+	return result, nil
+}
+
+func (c *HTTPDBClient) keyURL(key string) string {
+	return fmt.Sprintf("%s/%s", c.BaseURL, key)
+}
+
+func newDBResponse(resp *http.Response) DBResponse {
+	return DBResponse{
+		Status:     resp.StatusCode,
+		ETag:       resp.Header.Get("ETag"),
+		Retryable:  resp.Header.Get(retryableHeader),
+		Generation: resp.Header.Get(generationHeader),
+	}
+}
+
+// decodeErrorBody розбирає тіло відповіді з помилкою. Якщо тіло не JSON,
+// воно повертається як текст помилки.
+func decodeErrorBody(body io.Reader) DbValueResponse {
+	raw, _ := io.ReadAll(body)
+	var result DbValueResponse
+	if err := json.Unmarshal(raw, &result); err != nil || result.Error == "" {
+		result.Error = strings.TrimSpace(string(raw))
+	}
+	return result
+}
+
+// getFromDb виконує GET до сервісу БД, повторюючи запит при мережевих та повторюваних помилках.
+func (c *HTTPDBClient) getFromDb(ctx context.Context, targetURL string) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; attempt <= dbMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(time.Duration(attempt-1) * dbRetryBackoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.doDbRequest(req)
+		if err != nil && ctx.Err() != nil {
+			// Клієнт від'єднався: повтор нікому не потрібен.
+			return nil, err
+		}
+		if err != nil {
+			lastErr = err
+			c.Logger.Printf("SERVER_HANDLER: DB request %s failed (attempt %d/%d): %v", targetURL, attempt, dbMaxAttempts, err)
+			continue
+		}
+		if attempt == dbMaxAttempts || !isRetryableDbResponse(resp) {
+			return resp, nil
+		}
+		c.Logger.Printf("SERVER_HANDLER: DB returned retryable status %s for %s (attempt %d/%d)", resp.Status, targetURL, attempt, dbMaxAttempts)
+		resp.Body.Close()
+	}
+	return nil, lastErr
+}
+
+// Pending повертає кількість запитів до сервісу БД, що очікують на відповідь.
+func (c *HTTPDBClient) Pending() int64 {
+	return c.pending.Load()
+}
+
+// doDbRequest виконує запит до сервісу БД, передаючи ідентифікатор запиту
+// та враховуючи час звернення в журналі повільних запитів.
+func (c *HTTPDBClient) doDbRequest(req *http.Request) (*http.Response, error) {
+	c.pending.Add(1)
+	defer c.pending.Add(-1)
+	if id := httptools.RequestID(req.Context()); id != "" {
+		req.Header.Set(httptools.RequestIDHeader, id)
+	}
+	start := time.Now()
+	resp, err := c.Client.Do(req)
+	httptools.AddTiming(req.Context(), "db", time.Since(start))
+	return resp, err
+}
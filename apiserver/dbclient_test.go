@@ -0,0 +1,70 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetFromDb_RespectsRetryableFlag(t *testing.T) {
+	for _, tc := range []struct {
+		retryable    string
+		wantAttempts int
+	}{
+		{"true", dbMaxAttempts},
+		{"false", 1},
+	} {
+		attempts := 0
+		fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.Header().Set(retryableHeader, tc.retryable)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		resp, err := NewHTTPDBClient(fakeDb.URL).getFromDb(context.Background(), fakeDb.URL)
+		fakeDb.Close()
+		if err != nil {
+			t.Fatalf("retryable=%s: unexpected error %v", tc.retryable, err)
+		}
+		resp.Body.Close()
+		if attempts != tc.wantAttempts {
+			t.Errorf("retryable=%s: got %d attempts, want %d", tc.retryable, attempts, tc.wantAttempts)
+		}
+	}
+}
+
+func TestHTTPDBClient_Get(t *testing.T) {
+	fakeDb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/ok":
+			w.Header().Set("ETag", `"e1"`)
+			w.Write([]byte(`{"key":"ok","value":"v"}`))
+		case "/db/bad":
+			w.Write([]byte(`not json`))
+		case "/db/invalid":
+			w.Header().Set(retryableHeader, "false")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid key","code":"INVALID_KEY"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer fakeDb.Close()
+	client := NewHTTPDBClient(fakeDb.URL + "/db")
+
+	resp, err := client.Get(context.Background(), "ok")
+	if err != nil || resp.Status != http.StatusOK || resp.ETag != `"e1"` || resp.Body.Value != "v" {
+		t.Errorf("Get(ok) = %+v, %v", resp, err)
+	}
+	if _, err := client.Get(context.Background(), "bad"); !errors.Is(err, ErrBadResponse) {
+		t.Errorf("Get(bad) error = %v, want ErrBadResponse", err)
+	}
+	resp, err = client.Get(context.Background(), "invalid")
+	if err != nil || resp.Status != http.StatusBadRequest || resp.Retryable != "false" || resp.Body.Code != "INVALID_KEY" {
+		t.Errorf("Get(invalid) = %+v, %v", resp, err)
+	}
+	if resp, err := client.Get(context.Background(), "missing"); err != nil || resp.Status != http.StatusNotFound {
+		t.Errorf("Get(missing) = %+v, %v", resp, err)
+	}
+}
@@ -0,0 +1,208 @@
+package apiserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Запис і відтворення звернень до сервісу БД. RecordingTransport, підставлений у
+// HTTPDBClient.Client, дописує кожну пару запит-відповідь у файл (по JSON-об'єкту на рядок).
+// ReplayTransport віддає записані відповіді без сервісу БД, тож тести обробників працюють
+// ізольовано, але з реальною поведінкою сервісу, зокрема з його помилками.
+
+// recordedHeaders - заголовки відповіді сервісу БД, які зберігаються в записі.
+var recordedHeaders = []string{"Content-Type", "ETag", retryableHeader, generationHeader}
+
+// DBInteraction - записаний запит до сервісу БД і відповідь на нього.
+type DBInteraction struct {
+	Method string `json:"method"`
+	// Path - шлях запиту разом з параметрами, без адреси сервісу.
+	Path         string            `json:"path"`
+	IfMatch      string            `json:"ifMatch,omitempty"`
+	RequestBody  string            `json:"requestBody,omitempty"`
+	Status       int               `json:"status"`
+	Header       map[string]string `json:"header,omitempty"`
+	ResponseBody string            `json:"responseBody,omitempty"`
+}
+
+// matches повідомляє, чи є запит req повтором записаного з тілом body.
+func (in DBInteraction) matches(req *http.Request, body string) bool {
+	return in.Method == req.Method && in.Path == req.URL.RequestURI() &&
+		in.IfMatch == req.Header.Get("If-Match") && in.RequestBody == body
+}
+
+// readRequestBody читає тіло запиту і повертає його на місце для наступного транспорту.
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	raw, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(raw))
+	return string(raw), nil
+}
+
+// RecordingTransport передає запити транспорту next і дописує кожну пару запит-відповідь у файл.
+type RecordingTransport struct {
+	next http.RoundTripper
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecordingTransport створює (або перезаписує) файл path і записує в нього звернення,
+// передані транспорту next; nil означає http.DefaultTransport.
+func NewRecordingTransport(path string, next http.RoundTripper) (*RecordingTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DB recording %s: %w", path, err)
+	}
+	return &RecordingTransport{next: next, file: file}, nil
+}
+
+// RoundTrip виконує запит і записує його разом з відповіддю. Мережеві помилки не записуються.
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := DBInteraction{
+		Method:       req.Method,
+		Path:         req.URL.RequestURI(),
+		IfMatch:      req.Header.Get("If-Match"),
+		RequestBody:  reqBody,
+		Status:       resp.StatusCode,
+		ResponseBody: string(respBody),
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if in.Header == nil {
+				in.Header = make(map[string]string)
+			}
+			in.Header[name] = value
+		}
+	}
+	line, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write DB recording: %w", err)
+	}
+	return resp, nil
+}
+
+// Close закриває файл запису.
+func (t *RecordingTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
+
+// ReplayTransport відповідає на запити записаними відповідями замість сервісу БД.
+// Кожна записана відповідь віддається один раз, у порядку запису, тож повторені запити
+// (наприклад, після повторюваної помилки) отримують наступні записані відповіді.
+type ReplayTransport struct {
+	mu           sync.Mutex
+	interactions []DBInteraction
+	used         []bool
+}
+
+// NewReplayTransport читає звернення, записані RecordingTransport у файл path.
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DB recording %s: %w", path, err)
+	}
+	defer file.Close()
+	t := &ReplayTransport{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var in DBInteraction
+		if err := json.Unmarshal(scanner.Bytes(), &in); err != nil {
+			return nil, fmt.Errorf("DB recording %s, line %d: %w", path, line, err)
+		}
+		t.interactions = append(t.interactions, in)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read DB recording %s: %w", path, err)
+	}
+	t.used = make([]bool, len(t.interactions))
+	return t, nil
+}
+
+// RoundTrip повертає першу ще не використану відповідь на такий самий запит.
+// Якщо її немає, повертає помилку, як недосяжний сервіс БД.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, in := range t.interactions {
+		if t.used[i] || !in.matches(req, body) {
+			continue
+		}
+		t.used[i] = true
+		resp := &http.Response{
+			Status:        statusText(in.Status),
+			StatusCode:    in.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        make(http.Header),
+			Body:          io.NopCloser(strings.NewReader(in.ResponseBody)),
+			ContentLength: int64(len(in.ResponseBody)),
+			Request:       req,
+		}
+		for name, value := range in.Header {
+			resp.Header.Set(name, value)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no recorded DB response for %s %s", req.Method, req.URL.RequestURI())
+}
+
+// Unused повертає записані звернення, на які ще не було запиту.
+func (t *ReplayTransport) Unused() []DBInteraction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var unused []DBInteraction
+	for i, in := range t.interactions {
+		if !t.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,83 @@
+package apiserver
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordDB перезаписує записи звернень до сервісу БД, виконуючи тести з реальним сервісом:
+//
+//	go test ./apiserver -run Recorded -record-db=http://localhost:8081/db
+//
+// Сервіс має бути запущений з порожньою базою.
+var recordDB = flag.String("record-db", "", "DB service URL to record testdata/*.jsonl against instead of replaying them")
+
+// recordedDBClient повертає клієнт сервісу БД, який відтворює запис testdata/name,
+// або, з -record-db, записує його заново.
+func recordedDBClient(t *testing.T, name string) *HTTPDBClient {
+	t.Helper()
+	path := "testdata/" + name
+	if *recordDB != "" {
+		recorder, err := NewRecordingTransport(path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { recorder.Close() })
+		client := NewHTTPDBClient(*recordDB)
+		client.Client = &http.Client{Transport: recorder}
+		client.Logger = discardLogger{}
+		return client
+	}
+	replay, err := NewReplayTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if unused := replay.Unused(); len(unused) != 0 {
+			t.Errorf("%d recorded DB interactions were not replayed, the first is %s %s", len(unused), unused[0].Method, unused[0].Path)
+		}
+	})
+	client := NewHTTPDBClient("http://db.invalid/db")
+	client.Client = &http.Client{Transport: replay}
+	client.Logger = discardLogger{}
+	return client
+}
+
+func TestSomeDataHandlers_RecordedDB(t *testing.T) {
+	router := New(Options{DB: recordedDBClient(t, "some_data.jsonl"), Logger: discardLogger{}}).Handler()
+	send := func(method, key, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/some-data?key="+key, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(http.MethodGet, "recorded-missing", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing key returned %d", rec.Code)
+	}
+	rec := send(http.MethodPost, "recorded", "", `{"value":"v1"}`)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusCreated || etag == "" {
+		t.Fatalf("POST returned %d with ETag %q: %s", rec.Code, etag, rec.Body.String())
+	}
+	rec = send(http.MethodGet, "recorded", "", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag || strings.TrimSpace(rec.Body.String()) != `{"key":"recorded","value":"v1"}` {
+		t.Errorf("GET returned %d with ETag %q: %s", rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+	}
+	if rec = send(http.MethodPost, "recorded", `"stale"`, `{"value":"v2"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("POST with a stale If-Match returned %d", rec.Code)
+	}
+	if rec = send(http.MethodPost, "recorded", "", `{"value":true}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Invalid value type") {
+		t.Errorf("POST of an unsupported value returned %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = send(http.MethodPost, "recorded", etag, `{"value":"v2"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") == etag {
+		t.Errorf("POST with the current If-Match returned %d with ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,155 @@
+package apiserver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix позначає зашифроване значення: enc:v1:<ідентифікатор ключа>:<base64(nonce|шифротекст)>.
+const encryptedPrefix = "enc:v1:"
+
+// ErrUnknownKey - значення зашифроване ключем, якого немає серед ключів Encryptor.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider повертає ключі шифрування за їх ідентифікаторами та ідентифікатор
+// поточного ключа, яким шифруються нові записи. Це точка підключення KMS.
+type KeyProvider interface {
+	EncryptionKeys() (current string, keys map[string][]byte, err error)
+}
+
+// StaticKeys - KeyProvider з ключами, заданими в конфігурації.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) EncryptionKeys() (string, map[string][]byte, error) {
+	return k.Current, k.Keys, nil
+}
+
+// ParseStaticKeys розбирає ключі у форматі "id1:base64,id2:base64". Якщо current порожній,
+// поточним стає останній ключ у списку, тож для ротації достатньо дописати новий ключ у кінець.
+func ParseStaticKeys(spec, current string) (StaticKeys, error) {
+	keys := StaticKeys{Current: current, Keys: make(map[string][]byte)}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || id == "" {
+			return StaticKeys{}, fmt.Errorf("encryption key %q must be in the form id:base64", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return StaticKeys{}, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		keys.Keys[id] = key
+		if current == "" {
+			keys.Current = id
+		}
+	}
+	return keys, nil
+}
+
+// Encryptor шифрує значення AES-GCM перед записом у сервіс БД і розшифровує їх при читанні,
+// тож оператори сервера БД бачать лише шифротекст. Ідентифікатор ключа зберігається разом
+// із шифротекстом: після ротації старі значення читаються, доки їх ключ є серед ключів.
+type Encryptor struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewEncryptor створює Encryptor з ключами провайдера. Ключі мають бути довжиною 16, 24 або 32 байти.
+func NewEncryptor(provider KeyProvider) (*Encryptor, error) {
+	current, keys, err := provider.EncryptionKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	e := &Encryptor{current: current, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		if e.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+	}
+	if _, ok := e.aeads[current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not configured", current)
+	}
+	return e, nil
+}
+
+// Encrypt шифрує JSON-представлення value поточним ключем. Шифротекст прив'язаний до ключа
+// запису dbKey, тож його не можна непомітно перенести під інший ключ.
+func (e *Encryptor) Encrypt(dbKey string, value interface{}) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	aead := e.aeads[e.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(dbKey))
+	return encryptedPrefix + e.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt розшифровує значення, записане Encrypt. Незашифровані значення повертаються без змін.
+func (e *Encryptor) Decrypt(dbKey string, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, encryptedPrefix) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(s, encryptedPrefix), ":")
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	aead, ok := e.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(dbKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value with key %s: %w", id, err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(plaintext, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// encryptBody замінює значення в тілі запиту запису {"value": ...} на зашифроване.
+func (e *Encryptor) encryptBody(dbKey string, body []byte) ([]byte, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+	value, ok := request["value"]
+	if !ok {
+		return body, nil
+	}
+	encrypted, err := e.Encrypt(dbKey, value)
+	if err != nil {
+		return nil, err
+	}
+	request["value"] = encrypted
+	return json.Marshal(request)
+}
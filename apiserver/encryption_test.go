@@ -0,0 +1,130 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// storingDB - DBClient, що зберігає записані значення в пам'яті.
+type storingDB struct {
+	values map[string]interface{}
+}
+
+func (d *storingDB) Get(_ context.Context, key string) (DBResponse, error) {
+	value, ok := d.values[key]
+	if !ok {
+		return DBResponse{Status: http.StatusNotFound}, nil
+	}
+	return DBResponse{Status: http.StatusOK, Body: DbValueResponse{Key: key, Value: value}}, nil
+}
+
+func (d *storingDB) Put(_ context.Context, key string, body []byte, _ string) (DBResponse, error) {
+	var request struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return DBResponse{Status: http.StatusBadRequest}, nil
+	}
+	d.values[key] = request.Value
+	return DBResponse{Status: http.StatusCreated, Body: DbValueResponse{Key: key, Value: request.Value}}, nil
+}
+
+func testKeys(t *testing.T, spec, current string) *Encryptor {
+	t.Helper()
+	keys, err := ParseStaticKeys(spec, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := NewEncryptor(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+var (
+	key1 = "k1:" + base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	key2 = "k2:" + base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func TestEncryption_RoundTripThroughHandlers(t *testing.T) {
+	db := &storingDB{values: make(map[string]interface{})}
+	router := New(Options{DB: db, Logger: discardLogger{}, Encryptor: testKeys(t, key1, "")}).Handler()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/some-data?key=secret", strings.NewReader(`{"value":{"pin":1234}}`)))
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"pin":1234`) {
+		t.Fatalf("POST returned %d: %s", rec.Code, rec.Body.String())
+	}
+	stored, ok := db.values["secret"].(string)
+	if !ok || !strings.HasPrefix(stored, "enc:v1:k1:") || strings.Contains(stored, "1234") {
+		t.Fatalf("DB service received %v, want a value encrypted with k1", db.values["secret"])
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=secret", nil))
+	var resp DbValueResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if want := map[string]interface{}{"pin": float64(1234)}; !reflect.DeepEqual(resp.Value, want) {
+		t.Errorf("GET returned value %v, want %v", resp.Value, want)
+	}
+
+	// Шифротекст прив'язаний до ключа запису.
+	db.values["other"] = stored
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/some-data?key=other", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET of a value moved to another key returned %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/some-data?key=secret", strings.NewReader(`not json`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("POST of invalid body returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestEncryption_KeyRotation(t *testing.T) {
+	old := testKeys(t, key1, "")
+	ciphertext, err := old.Encrypt("k", "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testKeys(t, key1+","+key2, "")
+	if value, err := rotated.Decrypt("k", ciphertext); err != nil || value != "v" {
+		t.Errorf("Decrypt with the old key after rotation = %v, %v", value, err)
+	}
+	if fresh, _ := rotated.Encrypt("k", "v"); !strings.HasPrefix(fresh, "enc:v1:k2:") {
+		t.Errorf("new values are encrypted as %q, want key k2", fresh)
+	}
+	if _, err := testKeys(t, key2, "").Decrypt("k", ciphertext); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt without the old key returned %v, want ErrUnknownKey", err)
+	}
+	if value, err := rotated.Decrypt("k", "plain"); err != nil || value != "plain" {
+		t.Errorf("unencrypted value = %v, %v; want it unchanged", value, err)
+	}
+}
+
+func TestNewEncryptor_RejectsInvalidKeys(t *testing.T) {
+	for _, keys := range []StaticKeys{
+		{Current: "k", Keys: map[string][]byte{"k": []byte("short")}},
+		{Current: "missing", Keys: map[string][]byte{"k": make([]byte, 32)}},
+	} {
+		if _, err := NewEncryptor(keys); err == nil {
+			t.Errorf("NewEncryptor(%+v) succeeded", keys)
+		}
+	}
+	if _, err := ParseStaticKeys("k1", ""); err == nil {
+		t.Error("ParseStaticKeys accepted a key without id")
+	}
+}
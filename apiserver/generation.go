@@ -0,0 +1,39 @@
+package apiserver
+
+import "net/http"
+
+// Сервіс БД повідомляє покоління бази в заголовку X-DB-Generation. Нове покоління означає,
+// що базу відновлено зі знімка: кешовані значення й ETag, отримані раніше, могли
+// застаріти, навіть якщо ETag збігаються. Сервер запам'ятовує останнє побачене покоління,
+// не віддає з кешу значення інших поколінь і передає покоління клієнтам у тому ж заголовку.
+
+// observeGeneration запам'ятовує покоління з відповіді сервісу БД.
+func (s *Server) observeGeneration(generation string) {
+	if generation == "" {
+		return
+	}
+	previous := s.generation.Swap(&generation)
+	if previous != nil && *previous != generation {
+		s.log.Printf("SERVER_HANDLER: DB generation changed from %s to %s; cached values of the old generation are dropped", *previous, generation)
+	}
+}
+
+// dbGeneration повертає останнє побачене покоління бази або "", якщо його ще не було.
+func (s *Server) dbGeneration() string {
+	if generation := s.generation.Load(); generation != nil {
+		return *generation
+	}
+	return ""
+}
+
+// staleGeneration повідомляє, чи отримав клієнт If-Match в іншому поколінні бази.
+func (s *Server) staleGeneration(r *http.Request) bool {
+	seen, current := r.Header.Get(generationHeader), s.dbGeneration()
+	return seen != "" && current != "" && seen != current
+}
+
+func setGeneration(w http.ResponseWriter, generation string) {
+	if generation != "" {
+		w.Header().Set(generationHeader, generation)
+	}
+}
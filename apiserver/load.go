@@ -0,0 +1,45 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LoadReport - поточне навантаження API-сервера, яке він повідомляє балансувальнику через GET /load.
+// Кожна репліка балансувальника бачить лише свої з'єднання, а сервер - усі запити.
+type LoadReport struct {
+	// InFlight - кількість запитів, що зараз обробляються, без самого запиту /load.
+	InFlight int64 `json:"inFlight"`
+	// DBQueueDepth - кількість запитів до сервісу БД, що очікують на відповідь.
+	DBQueueDepth int64 `json:"dbQueueDepth"`
+}
+
+// pendingCounter - DBClient, що рахує незавершені запити до сервісу БД.
+type pendingCounter interface {
+	Pending() int64
+}
+
+// countInFlight рахує запити, що обробляються сервером.
+func (s *Server) countInFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Load повертає поточне навантаження сервера.
+func (s *Server) Load() LoadReport {
+	report := LoadReport{InFlight: s.inFlight.Load()}
+	if c, ok := s.db.(pendingCounter); ok {
+		report.DBQueueDepth = c.Pending()
+	}
+	return report
+}
+
+func (s *Server) loadHandler(w http.ResponseWriter, r *http.Request) {
+	report := s.Load()
+	report.InFlight = max(report.InFlight-1, 0)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
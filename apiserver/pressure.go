@@ -0,0 +1,91 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Балансувальник передає навантаження пулу бекендів у заголовках X-LB-Inflight (запити, які
+// обробляють бекенди пулу) і X-LB-Backends (кількість здорових бекендів), див. пакет balancer.
+// Якщо задано Options.Adaptation, сервер пристосовується до високого навантаження пулу.
+// Запити з низьким пріоритетом (заголовок X-Priority: low) відхиляються з 503 і Retry-After,
+// щоб не забирати ресурси в основних запитів. Кешовані значення, що застаріли не більше
+// ніж на StaleGrace, віддаються з кешу без звернення до сервісу БД.
+
+const (
+	lbInFlightHeader = "X-LB-Inflight"
+	lbBackendsHeader = "X-LB-Backends"
+	// priorityHeader - заголовок, яким клієнт позначає пріоритет запиту; "low" - низький.
+	priorityHeader = "X-Priority"
+	// shedRetryAfter - через скільки секунд клієнту варто повторити відхилений запит.
+	shedRetryAfter = "1"
+)
+
+// LoadAdaptation - пристосування сервера до навантаження пулу, яке повідомляє балансувальник.
+type LoadAdaptation struct {
+	// HighLoad - середня кількість запитів на здоровий бекенд пулу, з якої пул вважається
+	// перевантаженим. 0 вимикає пристосування.
+	HighLoad float64
+	// StaleGrace - наскільки довше за час життя запису кеш віддає значення під високим
+	// навантаженням. Діє лише для кешу з GetStale, наприклад MemoryCache.
+	StaleGrace time.Duration
+}
+
+// staleCache - кеш, що може віддати запис, який застарів не більше ніж на maxStale.
+type staleCache interface {
+	GetStale(key string, maxStale time.Duration) (CacheEntry, bool)
+}
+
+// highLoadKey позначає в контексті запит, отриманий під високим навантаженням пулу.
+type highLoadKey struct{}
+
+// underHighLoad повідомляє, чи отримано запит під високим навантаженням пулу.
+func underHighLoad(ctx context.Context) bool {
+	high, _ := ctx.Value(highLoadKey{}).(bool)
+	return high
+}
+
+// poolLoad повертає середню кількість запитів на бекенд пулу із заголовків балансувальника.
+func poolLoad(r *http.Request) (float64, bool) {
+	inFlight, err := strconv.ParseInt(r.Header.Get(lbInFlightHeader), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	backends, err := strconv.ParseInt(r.Header.Get(lbBackendsHeader), 10, 64)
+	if err != nil || backends <= 0 {
+		return 0, false
+	}
+	return float64(inFlight) / float64(backends), true
+}
+
+// adaptToLoad відхиляє запити з низьким пріоритетом під високим навантаженням пулу,
+// а решту позначає, щоб обробники могли ширше користуватися кешем.
+func (s *Server) adaptToLoad(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		load, ok := poolLoad(r)
+		if !ok || s.adapt.HighLoad <= 0 || load < s.adapt.HighLoad {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get(priorityHeader) == "low" {
+			s.log.Printf("SERVER_HANDLER: Shedding low-priority %s %s, pool load %.1f per backend", r.Method, r.URL.Path, load)
+			w.Header().Set("Retry-After", shedRetryAfter)
+			// Перевантажений увесь пул, тож повтор на іншому бекенді не допоможе.
+			w.Header().Set(retryableHeader, "false")
+			http.Error(w, "Service is under high load; low-priority request rejected, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), highLoadKey{}, true)))
+	})
+}
+
+// cachedValue повертає кешоване значення ключа. Під високим навантаженням пулу віддаються
+// й записи, що застаріли не більше ніж на StaleGrace.
+func (s *Server) cachedValue(ctx context.Context, key string) (CacheEntry, bool) {
+	if stale, ok := s.cache.(staleCache); ok && s.adapt.StaleGrace > 0 && underHighLoad(ctx) {
+		return stale.GetStale(key, s.adapt.StaleGrace)
+	}
+	return s.cache.Get(key)
+}
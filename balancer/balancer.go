@@ -0,0 +1,219 @@
+package balancer
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/httptools"
+)
+
+// defaultTimeout - тайм-аут запиту до бекенду за замовчуванням.
+const defaultTimeout = 3 * time.Second
+
+// Options - налаштування балансувальника. Нульові значення замінюються значеннями за замовчуванням.
+type Options struct {
+	// HTTPS - бекенди приймають запити по HTTPS.
+	HTTPS bool
+	// Timeout обмежує тривалість запиту до бекенду та перевірки здоров'я.
+	Timeout time.Duration
+	// HealthInterval - період перевірок здоров'я бекендів.
+	HealthInterval time.Duration
+	// Trace додає до відповідей заголовок lb-from з адресою бекенду.
+	Trace bool
+	// OnChange викликається, коли змінюється склад реєстру або стан здоров'я бекенду.
+	OnChange func()
+	// Strategy - міра навантаження, за якою обирається бекенд.
+	Strategy Strategy
+	// Peers - адреси (host:port) інших реплік балансувальника, з якими репліка обмінюється
+	// станом бекендів, див. PeerStateHandler.
+	Peers []string
+	// PeerInterval - період опитування інших реплік; за замовчуванням HealthInterval.
+	PeerInterval time.Duration
+	// Canary - наскрізний запит, який разом з /health визначає здоров'я бекенду.
+	Canary Canary
+}
+
+// Balancer передає запити найменш завантаженому здоровому бекенду зі свого реєстру.
+type Balancer struct {
+	opts Options
+
+	mu      sync.RWMutex
+	servers []*Server
+	// retired - бекенди, видалені з реєстру, які ще обслуговують розпочаті запити.
+	retired map[string]*Server
+	// started - перевірки здоров'я запущені, тож нові бекенди перевіряються одразу.
+	started bool
+	// peers - останній стан бекендів, отриманий від кожної з інших реплік.
+	peers map[string]peerState
+	// stopPeers зупиняє опитування реплік; nil, якщо воно не запущене.
+	stopPeers chan struct{}
+}
+
+// New створює балансувальник з порожнім реєстром.
+func New(opts Options) *Balancer {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = defaultHealthInterval
+	}
+	if opts.PeerInterval <= 0 {
+		opts.PeerInterval = opts.HealthInterval
+	}
+	return &Balancer{opts: opts, retired: make(map[string]*Server), peers: make(map[string]peerState)}
+}
+
+func (b *Balancer) scheme() string {
+	if b.opts.HTTPS {
+		return "https"
+	}
+	return "http"
+}
+
+// changed повідомляє власника балансувальника про зміну реєстру.
+func (b *Balancer) changed() {
+	if b.opts.OnChange != nil {
+		b.opts.OnChange()
+	}
+}
+
+// AddBackend додає бекенд host до реєстру і повертає його. Бекенд, що вже є в реєстрі,
+// повертається без змін. Новий бекенд вважається нездоровим до першої перевірки.
+func (b *Balancer) AddBackend(host string) (*Server, error) {
+	b.mu.Lock()
+	for _, s := range b.servers {
+		if s.URL.Host == host {
+			b.mu.Unlock()
+			return s, nil
+		}
+	}
+	s, ok := b.retired[host]
+	if ok {
+		s.setDraining(false)
+		delete(b.retired, host)
+	} else {
+		var err error
+		if s, err = b.newServer(host); err != nil {
+			b.mu.Unlock()
+			return nil, err
+		}
+	}
+	b.servers = append(b.servers, s)
+	started := b.started
+	b.mu.Unlock()
+
+	if started {
+		b.startHealthCheck(s, nil)
+	}
+	b.changed()
+	return s, nil
+}
+
+// Backends повертає бекенди реєстру в порядку додавання.
+func (b *Balancer) Backends() []*Server {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]*Server, len(b.servers))
+	copy(result, b.servers)
+	return result
+}
+
+// Handler повертає обробник, який передає кожен запит найменш завантаженому здоровому бекенду.
+func (b *Balancer) Handler() http.Handler {
+	return http.HandlerFunc(b.serveHTTP)
+}
+
+func (b *Balancer) forward(dst *Server, rw http.ResponseWriter, r *http.Request) {
+	dst.IncrementActiveConns()
+	log.Printf("Balancer: Forwarding to %s, active connections now: %d, for request: %s", dst.URL.Host, dst.GetActiveConns(), r.URL.Path)
+
+	defer func() {
+		dst.DecrementActiveConns()
+		log.Printf("Balancer: Finished request for %s, active connections now: %d, for request: %s", dst.URL.Host, dst.GetActiveConns(), r.URL.Path)
+	}()
+
+	if b.opts.Trace {
+		rw.Header().Set("lb-from", dst.URL.Host)
+	}
+	httptools.SetBackend(r.Context(), dst.URL.Host)
+	b.setPressureHeaders(r)
+
+	log.Printf("Balancer: About to call ReverseProxy.ServeHTTP for %s on %s", r.URL.Path, dst.URL.Host)
+	dst.ReverseProxy.ServeHTTP(rw, r)
+	log.Printf("Balancer: Returned from ReverseProxy.ServeHTTP for %s on %s", r.URL.Path, dst.URL.Host)
+}
+
+func (b *Balancer) selectLeastLoadedServer() *Server {
+	return b.selectLeastLoadedServerExcept(nil)
+}
+
+// selectLeastLoadedServerExcept вибирає найменш завантажений здоровий сервер, крім exclude.
+// Сервери, які вважає нездоровими інша репліка, обираються, лише якщо інших немає.
+func (b *Balancer) selectLeastLoadedServerExcept(exclude *Server) *Server {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var selected, fallback *Server
+	minLoad, fallbackLoad := int64(-1), int64(-1)
+	now := time.Now()
+
+	for _, server := range b.servers {
+		if server != exclude && server.GetHealth() {
+			serverLoad := server.load(b.opts.Strategy)
+			peer := b.peerViewLocked(server.URL.Host, now)
+			// Повідомлене бекендом навантаження вже враховує запити всіх реплік.
+			if b.opts.Strategy != ReportedLoad {
+				serverLoad += peer.conns
+			}
+			if peer.unhealthy {
+				if fallback == nil || serverLoad < fallbackLoad {
+					fallback = server
+					fallbackLoad = serverLoad
+				}
+				continue
+			}
+			if selected == nil || serverLoad < minLoad {
+				selected = server
+				minLoad = serverLoad
+			}
+		}
+	}
+	if selected == nil {
+		return fallback
+	}
+	return selected
+}
+
+func (b *Balancer) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			log.Printf("PANIC in balancer handler: %v\n%s", rcv, string(debug.Stack()))
+			if rw.Header().Get("X-Balancer-Response-Sent") == "" {
+				http.Error(rw, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}
+	}()
+
+	log.Printf("Balancer HTTP Handler: Received request for %s from %s", r.URL.String(), r.RemoteAddr)
+
+	selectedServer := b.selectLeastLoadedServer()
+	if selectedServer == nil {
+		log.Printf("Balancer HTTP Handler: No healthy servers available for %s", r.URL.String())
+		if rw.Header().Get("X-Balancer-Response-Sent") == "" {
+			rw.Header().Set("X-Balancer-Response-Sent", "true")
+			http.Error(rw, "Service unavailable: No healthy backend servers", http.StatusServiceUnavailable)
+		}
+		return
+	}
+
+	log.Printf("Balancer HTTP Handler: Selected server %s for request %s", selectedServer.URL.Host, r.URL.String())
+	ctx, cancel := context.WithTimeout(r.Context(), b.opts.Timeout)
+	defer cancel()
+
+	b.forward(selectedServer, rw, r.WithContext(ctx))
+	log.Printf("Balancer HTTP Handler: Finished processing request for %s", r.URL.String())
+}
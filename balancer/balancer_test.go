@@ -0,0 +1,453 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	// "sync" // Не потрібен для цих тестів, якщо не тестуємо паралельні зміни
+)
+
+// newTestServer створює екземпляр Server для тестів.
+// ReverseProxy тут nil, бо він не потрібен для тестування логіки вибору.
+func newTestServer(rawURL string, isHealthy bool, connections int64) *Server {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		// У тестах краще панікувати, якщо базові налаштування неправильні,
+		// це вказує на помилку в самому тесті.
+		panic(fmt.Sprintf("Failed to parse URL for test server %s: %v", rawURL, err))
+	}
+	return &Server{
+		URL:          parsedURL,
+		ActiveConns:  connections,
+		IsHealthy:    isHealthy,
+		ReverseProxy: nil, // Не потрібен для тестування логіки вибору selectLeastLoadedServer
+		// mutex не потрібно ініціалізувати явно, нульове значення sync.RWMutex готове до використання
+	}
+}
+
+func TestSelectLeastLoadedServer(t *testing.T) {
+	testCases := []struct {
+		name              string
+		setupServers      func() []*Server // Функція для налаштування `servers` для конкретного тесту
+		expectedServerURL string           // Порожній рядок, якщо очікується nil (немає здорових серверів)
+	}{
+		{
+			name: "single healthy server with zero connections",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", true, 0),
+				}
+			},
+			expectedServerURL: "http://server1:8080",
+		},
+		{
+			name: "multiple healthy servers, select one with least connections",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", true, 5),
+					newTestServer("http://server2:8080", true, 2), // Очікується цей
+					newTestServer("http://server3:8080", true, 3),
+				}
+			},
+			expectedServerURL: "http://server2:8080",
+		},
+		{
+			name: "all servers unhealthy",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", false, 0),
+					newTestServer("http://server2:8080", false, 0),
+				}
+			},
+			expectedServerURL: "", // Очікуємо nil
+		},
+		{
+			name: "one healthy server among unhealthy ones",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", false, 10),
+					newTestServer("http://server2:8080", true, 5), // Очікується цей
+					newTestServer("http://server3:8080", false, 0),
+				}
+			},
+			expectedServerURL: "http://server2:8080",
+		},
+		{
+			name: "tie in connections, should pick the first one encountered in the list",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", true, 2), // Очікується цей (перший з найменшими)
+					newTestServer("http://server2:8080", true, 5),
+					newTestServer("http://server3:8080", true, 2),
+				}
+			},
+			expectedServerURL: "http://server1:8080",
+		},
+		{
+			name: "no servers configured (empty list)",
+			setupServers: func() []*Server {
+				return []*Server{}
+			},
+			expectedServerURL: "", // Очікуємо nil
+		},
+		{
+			name: "all healthy, all zero connections, pick first",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", true, 0), // Очікується цей
+					newTestServer("http://server2:8080", true, 0),
+					newTestServer("http://server3:8080", true, 0),
+				}
+			},
+			expectedServerURL: "http://server1:8080",
+		},
+		{
+			name: "last server has least connections",
+			setupServers: func() []*Server {
+				return []*Server{
+					newTestServer("http://server1:8080", true, 3),
+					newTestServer("http://server2:8080", true, 4),
+					newTestServer("http://server3:8080", true, 1), // Очікується цей
+				}
+			},
+			expectedServerURL: "http://server3:8080",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Кожен тестовий випадок отримує власний балансувальник з реєстром setupServers.
+			b := New(Options{})
+			b.servers = tc.setupServers()
+
+			selected := b.selectLeastLoadedServer()
+
+			if tc.expectedServerURL == "" {
+				if selected != nil {
+					t.Errorf("test case '%s': expected no server (nil), but got %s", tc.name, selected.URL.String())
+				}
+			} else {
+				if selected == nil {
+					t.Errorf("test case '%s': expected server %s, but got nil", tc.name, tc.expectedServerURL)
+				} else if selected.URL.String() != tc.expectedServerURL {
+					// Надаємо більше інформації при помилці
+					var actualConns int64
+					var actualHealth bool
+					// Оскільки selected може бути nil, перевіряємо це перед доступом до полів
+					if selected != nil {
+						actualConns = selected.GetActiveConns() // Використовуємо геттер для безпеки
+						actualHealth = selected.GetHealth()     // Використовуємо геттер
+					}
+					t.Errorf("test case '%s': expected server %s, but got %s (ActiveConns: %d, IsHealthy: %t)",
+						tc.name, tc.expectedServerURL, selected.URL.String(), actualConns, actualHealth)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	newResp := func(method string, status int, retryable string, retried bool) *http.Response {
+		req := httptest.NewRequest(method, "/api/v1/some-data", nil)
+		if retried {
+			req = req.WithContext(context.WithValue(req.Context(), retriedKey{}, true))
+		}
+		resp := &http.Response{StatusCode: status, Header: make(http.Header), Request: req}
+		if retryable != "" {
+			resp.Header.Set(retryableHeader, retryable)
+		}
+		return resp
+	}
+
+	testCases := []struct {
+		name string
+		resp *http.Response
+		want bool
+	}{
+		{"retryable server error", newResp(http.MethodGet, http.StatusInternalServerError, "true", false), true},
+		{"server error without flag", newResp(http.MethodGet, http.StatusBadGateway, "", false), true},
+		{"non-retryable server error", newResp(http.MethodGet, http.StatusInternalServerError, "false", false), false},
+		{"client error", newResp(http.MethodGet, http.StatusBadRequest, "true", false), false},
+		{"non-idempotent method", newResp(http.MethodPost, http.StatusInternalServerError, "true", false), false},
+		{"already retried", newResp(http.MethodGet, http.StatusInternalServerError, "true", true), false},
+	}
+	for _, tc := range testCases {
+		if got := shouldRetry(tc.resp); got != tc.want {
+			t.Errorf("%s: shouldRetry = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBalancer_Handler(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Backend", name)
+			w.Header().Set("X-Seen-Pressure", r.Header.Get(InFlightHeader)+"/"+r.Header.Get(BackendsHeader))
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+	backend1, backend2 := newBackend("one"), newBackend("two")
+	defer backend1.Close()
+	defer backend2.Close()
+
+	changes := 0
+	b := New(Options{Trace: true, OnChange: func() { changes++ }})
+	defer b.Close()
+	rec := httptest.NewRecorder()
+	b.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("empty balancer returned %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	for _, backend := range []*httptest.Server{backend1, backend2} {
+		u, _ := url.Parse(backend.URL)
+		if _, err := b.AddBackend(u.Host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := b.AddBackend(b.Backends()[0].URL.Host); err != nil || len(b.Backends()) != 2 {
+		t.Fatalf("re-adding a backend changed the registry: %v", err)
+	}
+	<-b.StartHealthChecks()
+	if changes != 2 {
+		t.Errorf("OnChange called %d times, want 2", changes)
+	}
+
+	busy := b.Backends()[0]
+	busy.IncrementActiveConns()
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/some-data", nil)
+	req.Header.Set(InFlightHeader, "999")
+	b.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Backend") != "two" {
+		t.Errorf("request went to %q with status %d, want the least loaded backend", rec.Header().Get("X-Backend"), rec.Code)
+	}
+	// Запит busy та сам переданий запит на двох здорових бекендах.
+	if seen := rec.Header().Get("X-Seen-Pressure"); seen != "2/2" {
+		t.Errorf("backend saw pool pressure %q, want 2/2", seen)
+	}
+	if from := rec.Header().Get("lb-from"); from != b.Backends()[1].URL.Host {
+		t.Errorf("lb-from = %q", from)
+	}
+	if busy.GetActiveConns() != 1 || b.Backends()[1].GetActiveConns() != 0 {
+		t.Errorf("active connections were not released")
+	}
+}
+
+func TestBalancer_ReportedLoadStrategy(t *testing.T) {
+	newBackend := func(name string, inFlight int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/load":
+				fmt.Fprintf(w, `{"inFlight":%d,"dbQueueDepth":1}`, inFlight)
+			default:
+				w.Header().Set("X-Backend", name)
+			}
+		}))
+	}
+	// Інші репліки балансувальника завантажили перший бекенд, хоча цей балансувальник
+	// не має до нього з'єднань.
+	backend1, backend2 := newBackend("one", 5), newBackend("two", 1)
+	defer backend1.Close()
+	defer backend2.Close()
+
+	b := New(Options{Strategy: ReportedLoad})
+	defer b.Close()
+	for _, backend := range []*httptest.Server{backend1, backend2} {
+		u, _ := url.Parse(backend.URL)
+		if _, err := b.AddBackend(u.Host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-b.StartHealthChecks()
+	if load, ok := b.Backends()[0].ReportedLoad(); !ok || load != 6 {
+		t.Errorf("reported load of the first backend = %d, %t; want 6", load, ok)
+	}
+
+	rec := httptest.NewRecorder()
+	b.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("X-Backend") != "two" {
+		t.Errorf("request went to %q, want the backend with the least reported load", rec.Header().Get("X-Backend"))
+	}
+	// Власні з'єднання, відкриті після опитування, додаються до повідомленого навантаження.
+	for i := 0; i < 5; i++ {
+		b.Backends()[1].IncrementActiveConns()
+	}
+	if s := b.selectLeastLoadedServer(); s != b.Backends()[0] {
+		t.Errorf("selected %s, want the first backend once the second has more connections", s.URL.Host)
+	}
+
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Error("ParseStrategy accepted an unknown strategy")
+	}
+}
+
+func TestBalancer_PeerState(t *testing.T) {
+	var peerBackends []BackendState
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PeerStatePath {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(peerBackends)
+	}))
+	peerURL, _ := url.Parse(peer.URL)
+
+	b := New(Options{Peers: []string{peerURL.Host}, PeerInterval: time.Minute})
+	one, _ := b.AddBackend("one:8080")
+	two, _ := b.AddBackend("two:8080")
+	one.SetHealth(true)
+	two.SetHealth(true)
+	two.IncrementActiveConns()
+
+	// Інша репліка вважає перший бекенд нездоровим - обидві репліки його не обирають.
+	peerBackends = []BackendState{{Host: "one:8080", Healthy: false}, {Host: "two:8080", Healthy: true}}
+	b.syncPeers()
+	if s := b.selectLeastLoadedServer(); s != two {
+		t.Errorf("selected %s, want the backend every replica considers healthy", s.URL.Host)
+	}
+	// З'єднання іншої репліки додаються до власних.
+	peerBackends = []BackendState{{Host: "one:8080", Healthy: true, ActiveConns: 3}, {Host: "two:8080", Healthy: true}}
+	b.syncPeers()
+	if s := b.selectLeastLoadedServer(); s != two {
+		t.Errorf("selected %s, want the backend with fewer connections across replicas", s.URL.Host)
+	}
+	// Якщо інша репліка відкидає всі бекенди, використовується власний погляд.
+	peerBackends = []BackendState{{Host: "one:8080"}, {Host: "two:8080"}}
+	b.syncPeers()
+	if s := b.selectLeastLoadedServer(); s != one {
+		t.Errorf("selected %v, want the least loaded backend when peers reject all of them", s)
+	}
+
+	rec := httptest.NewRecorder()
+	b.PeerStateHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PeerStatePath, nil))
+	var state []BackendState
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil || len(state) != 2 || state[1].ActiveConns != 1 {
+		t.Errorf("peer state = %s, %v", rec.Body.String(), err)
+	}
+
+	// Стан репліки, що перестала відповідати, застаріває і не враховується.
+	peer.Close()
+	b.mu.Lock()
+	for host, state := range b.peers {
+		state.receivedAt = time.Now().Add(-peerStaleIntervals * b.opts.PeerInterval * 2)
+		b.peers[host] = state
+	}
+	b.mu.Unlock()
+	b.syncPeers()
+	b.mu.RLock()
+	view := b.peerViewLocked("one:8080", time.Now())
+	b.mu.RUnlock()
+	if view.unhealthy || view.conns != 0 {
+		t.Errorf("stale peer state is still used: %+v", view)
+	}
+}
+
+func TestBalancer_PropagatesClientCancellation(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer backend.Close()
+
+	b := New(Options{})
+	defer b.Close()
+	u, _ := url.Parse(backend.URL)
+	if _, err := b.AddBackend(u.Host); err != nil {
+		t.Fatal(err)
+	}
+	<-b.StartHealthChecks()
+	front := httptest.NewServer(b.Handler())
+	defer front.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, front.URL+"/api/v1/some-data?key=slow", nil)
+	errCh := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		errCh <- err
+	}()
+	<-started
+	cancel()
+	if err := <-errCh; err == nil {
+		t.Fatal("cancelled client request succeeded")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend request was not cancelled after the client disconnected")
+	}
+	deadline := time.Now().Add(time.Second)
+	for b.Backends()[0].GetActiveConns() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if conns := b.Backends()[0].GetActiveConns(); conns != 0 {
+		t.Errorf("backend still has %d active connections", conns)
+	}
+	select {
+	case <-started:
+		t.Error("cancelled request was retried on the backend")
+	default:
+	}
+}
+
+func TestBalancer_CanaryMarksBrokenBackendUnhealthy(t *testing.T) {
+	newBackend := func(canaryStatus int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/health":
+				w.WriteHeader(http.StatusOK)
+			case "/api/v1/some-data":
+				if r.URL.Query().Get("key") != "_canary" {
+					t.Errorf("canary request for %s", r.URL)
+				}
+				w.WriteHeader(canaryStatus)
+			}
+		}))
+	}
+	// Другий бекенд відповідає на /health, але не обслуговує запити.
+	working, broken := newBackend(http.StatusOK), newBackend(http.StatusInternalServerError)
+	defer working.Close()
+	defer broken.Close()
+
+	b := New(Options{Canary: Canary{Path: "/api/v1/some-data?key=_canary"}})
+	defer b.Close()
+	for _, backend := range []*httptest.Server{working, broken} {
+		u, _ := url.Parse(backend.URL)
+		if _, err := b.AddBackend(u.Host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-b.StartHealthChecks()
+	if !b.Backends()[0].GetHealth() || b.Backends()[1].GetHealth() {
+		t.Errorf("health = %t, %t; want only the backend passing the canary healthy", b.Backends()[0].GetHealth(), b.Backends()[1].GetHealth())
+	}
+
+	u, _ := url.Parse(working.URL)
+	validated := false
+	strict := New(Options{Canary: Canary{Path: "/api/v1/some-data?key=_canary", Validate: func(status int, body []byte) error {
+		validated = true
+		return fmt.Errorf("unexpected body %q", body)
+	}}})
+	if err := strict.Probe(u.Host); err == nil || !validated {
+		t.Errorf("Probe with a rejecting validator returned %v, validator called: %t", err, validated)
+	}
+}
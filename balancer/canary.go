@@ -0,0 +1,54 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxCanaryBody обмежує обсяг відповіді canary-запиту, який читає балансувальник.
+const maxCanaryBody = 1 << 20
+
+// Canary - наскрізний запит, яким балансувальник перевіряє бекенд після успішного /health.
+// На відміну від /health, він проходить увесь шлях обробки запиту (бекенд, сервіс БД),
+// тож бекенд, що відповідає на /health, але не обслуговує запити, вважається нездоровим.
+type Canary struct {
+	// Path - шлях із параметрами запиту, наприклад "/api/v1/some-data?key=_canary".
+	// Порожній шлях вимикає перевірку.
+	Path string
+	// Validate перевіряє статус і тіло відповіді. Якщо nil, приймається лише 200 OK.
+	Validate func(status int, body []byte) error
+}
+
+func (c Canary) enabled() bool {
+	return c.Path != ""
+}
+
+// probeCanary виконує canary-запит до бекенду і повертає причину, з якої відповідь не прийнято.
+func (b *Balancer) probeCanary(s *Server) error {
+	canaryURL := fmt.Sprintf("%s://%s%s", s.URL.Scheme, s.URL.Host, b.opts.Canary.Path)
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, canaryURL, nil)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: b.opts.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCanaryBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if b.opts.Canary.Validate != nil {
+		return b.opts.Canary.Validate(resp.StatusCode, body)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	return nil
+}
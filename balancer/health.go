@@ -0,0 +1,156 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultHealthInterval - період перевірок здоров'я за замовчуванням.
+const defaultHealthInterval = 10 * time.Second
+
+func (b *Balancer) checkServerHealth(s *Server) bool {
+	healthURL := fmt.Sprintf("%s://%s/health", s.URL.Scheme, s.URL.Host)
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
+	if err != nil {
+		log.Printf("Error creating health check request for %s (%s): %v", s.URL.Host, healthURL, err)
+		return false
+	}
+
+	healthCheckClient := http.Client{Timeout: b.opts.Timeout}
+	resp, err := healthCheckClient.Do(req)
+
+	if err != nil {
+		log.Printf("Health check failed for %s (%s): %v", s.URL.Host, healthURL, err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Health check for %s (%s) returned status %d, expected %d", s.URL.Host, healthURL, resp.StatusCode, http.StatusOK)
+		return false
+	}
+	if b.opts.Canary.enabled() {
+		if err := b.probeCanary(s); err != nil {
+			log.Printf("Canary request to %s (%s) failed: %v", s.URL.Host, b.opts.Canary.Path, err)
+			return false
+		}
+	}
+	return true
+}
+
+// Probe перевіряє адресу бекенду host та його здоров'я, не додаючи його до реєстру.
+func (b *Balancer) Probe(host string) error {
+	s, err := b.newServer(host)
+	if err != nil {
+		return err
+	}
+	if !b.checkServerHealth(s) {
+		return fmt.Errorf("health check of %s failed", host)
+	}
+	return nil
+}
+
+// StartHealthChecks запускає перевірки здоров'я всіх бекендів реєстру; бекенди, додані пізніше,
+// перевіряються одразу після додавання. Запускає й опитування інших реплік (Options.Peers).
+// Повернений канал закривається, коли завершаться
+// перші перевірки бекендів, що вже були в реєстрі.
+func (b *Balancer) StartHealthChecks() <-chan struct{} {
+	b.mu.Lock()
+	b.started = true
+	b.startPeerSyncLocked()
+	serversToMonitor := make([]*Server, len(b.servers))
+	copy(serversToMonitor, b.servers)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, server := range serversToMonitor {
+		wg.Add(1)
+		b.startHealthCheck(server, &wg)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// Close зупиняє перевірки здоров'я всіх бекендів і опитування реплік.
+func (b *Balancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.started = false
+	b.stopPeerSyncLocked()
+	for _, s := range b.servers {
+		s.stopHealthChecks()
+	}
+	for _, s := range b.retired {
+		s.stopHealthChecks()
+	}
+}
+
+// startHealthCheck запускає періодичні перевірки здоров'я бекенду, якщо вони ще не запущені.
+// Після першої перевірки викликає wg.Done(), якщо wg не nil.
+func (b *Balancer) startHealthCheck(s *Server, wg *sync.WaitGroup) {
+	s.mutex.Lock()
+	if s.stopHealth != nil {
+		s.mutex.Unlock()
+		if wg != nil {
+			wg.Done()
+		}
+		return
+	}
+	stop := make(chan struct{})
+	s.stopHealth = stop
+	s.mutex.Unlock()
+
+	go func() {
+		initialStatus := b.checkServerHealth(s)
+		s.SetHealth(initialStatus)
+		if initialStatus && b.opts.Strategy == ReportedLoad {
+			b.pollLoad(s)
+		}
+		log.Printf("Initial health check: %s healthy: %t, active connections: %d", s.URL.Host, s.GetHealth(), s.GetActiveConns())
+		if wg != nil {
+			wg.Done()
+		}
+
+		ticker := time.NewTicker(b.opts.HealthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				currentStatus := s.GetHealth()
+				newStatus := b.checkServerHealth(s)
+				s.SetHealth(newStatus)
+				if newStatus && b.opts.Strategy == ReportedLoad {
+					b.pollLoad(s)
+				}
+				if newStatus != currentStatus {
+					log.Printf("Health status change: %s from %t to %t", s.URL.Host, currentStatus, newStatus)
+					b.changed()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopHealthChecks зупиняє перевірки здоров'я бекенду.
+func (s *Server) stopHealthChecks() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stopHealth != nil {
+		close(s.stopHealth)
+		s.stopHealth = nil
+	}
+}
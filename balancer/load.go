@@ -0,0 +1,119 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Strategy - міра навантаження, за якою балансувальник обирає бекенд.
+type Strategy int
+
+const (
+	// LeastConnections обирає бекенд з найменшою кількістю з'єднань цього балансувальника.
+	LeastConnections Strategy = iota
+	// ReportedLoad обирає бекенд з найменшим навантаженням, яке той повідомляє через GET /load.
+	// Навантаження опитується разом з перевірками здоров'я і враховує запити всіх реплік
+	// балансувальника. Поки бекенд не повідомив навантаження, рахуються власні з'єднання.
+	ReportedLoad
+)
+
+// ParseStrategy розбирає назву стратегії: "least-conn" або "reported-load".
+func ParseStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", "least-conn":
+		return LeastConnections, nil
+	case "reported-load":
+		return ReportedLoad, nil
+	}
+	return 0, fmt.Errorf("unknown balancing strategy %q, expected least-conn or reported-load", name)
+}
+
+func (st Strategy) String() string {
+	if st == ReportedLoad {
+		return "reported-load"
+	}
+	return "least-conn"
+}
+
+// reportedLoad - навантаження, яке бекенд повідомив через GET /load.
+type reportedLoad struct {
+	InFlight     int64 `json:"inFlight"`
+	DBQueueDepth int64 `json:"dbQueueDepth"`
+}
+
+// serverLoad - останнє повідомлене навантаження разом з кількістю власних з'єднань на той момент.
+type serverLoad struct {
+	load          int64
+	connsAtReport int64
+}
+
+// load повертає навантаження бекенду за стратегією st. Для ReportedLoad до повідомленого
+// значення додаються з'єднання, відкриті цим балансувальником після опитування.
+func (s *Server) load(st Strategy) int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if st != ReportedLoad || s.reported == nil {
+		return s.ActiveConns
+	}
+	return s.reported.load + max(s.ActiveConns-s.reported.connsAtReport, 0)
+}
+
+// ReportedLoad повертає останнє навантаження, повідомлене бекендом; ok == false,
+// якщо бекенд його не повідомляв.
+func (s *Server) ReportedLoad() (load int64, ok bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.reported == nil {
+		return 0, false
+	}
+	return s.reported.load, true
+}
+
+func (s *Server) setReportedLoad(load *int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if load == nil {
+		s.reported = nil
+		return
+	}
+	s.reported = &serverLoad{load: *load, connsAtReport: s.ActiveConns}
+}
+
+// pollLoad запитує навантаження бекенду. Якщо бекенд не відповів, стратегія ReportedLoad
+// для нього повертається до підрахунку власних з'єднань.
+func (b *Balancer) pollLoad(s *Server) {
+	loadURL := fmt.Sprintf("%s://%s/load", s.URL.Scheme, s.URL.Host)
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	defer cancel()
+	report, err := fetchLoad(ctx, loadURL)
+	if err != nil {
+		log.Printf("Load poll failed for %s (%s): %v", s.URL.Host, loadURL, err)
+		s.setReportedLoad(nil)
+		return
+	}
+	load := report.InFlight + report.DBQueueDepth
+	s.setReportedLoad(&load)
+}
+
+func fetchLoad(ctx context.Context, loadURL string) (reportedLoad, error) {
+	var report reportedLoad
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loadURL, nil)
+	if err != nil {
+		return report, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return report, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, fmt.Errorf("bad load report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,134 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Кілька реплік балансувальника перед тими самими бекендами обмінюються станом: кожна
+// періодично запитує в інших реплік (Options.Peers) їхній погляд на бекенди через
+// PeerStateHandler. Бекенд, який хоч одна репліка вважає нездоровим, не обирає жодна з них,
+// а з'єднання інших реплік додаються до навантаження бекенду. Тож репліки приймають однакові
+// рішення, і клієнт може перемикатися між ними (VIP або кілька адрес в DNS) без простою.
+
+// PeerStatePath - шлях, за яким репліка віддає стан бекендів іншим реплікам.
+const PeerStatePath = "/lb/state"
+
+// peerStaleIntervals - через скільки періодів опитування без відповіді стан репліки ігнорується.
+const peerStaleIntervals = 3
+
+// peerState - останній стан бекендів, отриманий від іншої репліки.
+type peerState struct {
+	receivedAt time.Time
+	backends   map[string]BackendState
+}
+
+// PeerStateHandler повертає обробник, який віддає стан бекендів цієї репліки (State) у JSON.
+func (b *Balancer) PeerStateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(b.State()); err != nil {
+			log.Printf("Balancer: Failed to write peer state: %v", err)
+		}
+	})
+}
+
+// startPeerSyncLocked запускає періодичне опитування інших реплік, якщо їх задано.
+// Викликається під b.mu.
+func (b *Balancer) startPeerSyncLocked() {
+	if len(b.opts.Peers) == 0 || b.stopPeers != nil {
+		return
+	}
+	stop := make(chan struct{})
+	b.stopPeers = stop
+	go func() {
+		b.syncPeers()
+		ticker := time.NewTicker(b.opts.PeerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.syncPeers()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopPeerSyncLocked зупиняє опитування реплік. Викликається під b.mu.
+func (b *Balancer) stopPeerSyncLocked() {
+	if b.stopPeers != nil {
+		close(b.stopPeers)
+		b.stopPeers = nil
+	}
+}
+
+// syncPeers опитує всі репліки. Стан репліки, що не відповіла, залишається, доки не застаріє.
+func (b *Balancer) syncPeers() {
+	for _, peer := range b.opts.Peers {
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+		backends, err := fetchPeerState(ctx, fmt.Sprintf("http://%s%s", peer, PeerStatePath))
+		cancel()
+		if err != nil {
+			log.Printf("Balancer: Peer %s state poll failed: %v", peer, err)
+			continue
+		}
+		state := peerState{receivedAt: time.Now(), backends: make(map[string]BackendState, len(backends))}
+		for _, backend := range backends {
+			state.backends[backend.Host] = backend
+		}
+		b.mu.Lock()
+		b.peers[peer] = state
+		b.mu.Unlock()
+	}
+}
+
+func fetchPeerState(ctx context.Context, stateURL string) ([]BackendState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, stateURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var backends []BackendState
+	if err := json.NewDecoder(resp.Body).Decode(&backends); err != nil {
+		return nil, fmt.Errorf("bad peer state: %w", err)
+	}
+	return backends, nil
+}
+
+// peerView - стан бекенду за свіжими даними інших реплік.
+type peerView struct {
+	// unhealthy - хоч одна репліка вважає бекенд нездоровим.
+	unhealthy bool
+	// conns - сума з'єднань інших реплік до бекенду.
+	conns int64
+}
+
+// peerViewLocked зводить свіжі стани інших реплік для бекенду host. Викликається під b.mu.
+func (b *Balancer) peerViewLocked(host string, now time.Time) peerView {
+	var view peerView
+	for _, state := range b.peers {
+		if now.Sub(state.receivedAt) > peerStaleIntervals*b.opts.PeerInterval {
+			continue
+		}
+		backend, ok := state.backends[host]
+		if !ok {
+			continue
+		}
+		view.unhealthy = view.unhealthy || !backend.Healthy
+		view.conns += backend.ActiveConns
+	}
+	return view
+}
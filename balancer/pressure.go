@@ -0,0 +1,48 @@
+package balancer
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Балансувальник повідомляє бекендам навантаження пулу в заголовках кожного переданого
+// запиту, щоб вони могли пристосуватися до нього (див. apiserver.LoadAdaptation).
+// Запити не чекають у черзі балансувальника, тож навантаження - це запити, що вже
+// обробляються бекендами пулу. Заголовки з такими назвами від клієнта відкидаються.
+const (
+	// InFlightHeader - кількість запитів, які обробляють здорові бекенди пулу, включно з
+	// переданим, за даними цієї репліки та інших реплік (див. Options.Peers).
+	InFlightHeader = "X-LB-Inflight"
+	// BackendsHeader - кількість здорових бекендів пулу.
+	BackendsHeader = "X-LB-Backends"
+)
+
+// PoolPressure - навантаження пулу бекендів.
+type PoolPressure struct {
+	InFlight int64
+	Backends int
+}
+
+// Pressure повертає поточне навантаження пулу.
+func (b *Balancer) Pressure() PoolPressure {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var p PoolPressure
+	now := time.Now()
+	for _, server := range b.servers {
+		if !server.GetHealth() {
+			continue
+		}
+		p.Backends++
+		p.InFlight += server.GetActiveConns() + b.peerViewLocked(server.URL.Host, now).conns
+	}
+	return p
+}
+
+// setPressureHeaders замінює заголовки навантаження пулу в запиті до бекенду.
+func (b *Balancer) setPressureHeaders(r *http.Request) {
+	p := b.Pressure()
+	r.Header.Set(InFlightHeader, strconv.FormatInt(p.InFlight, 10))
+	r.Header.Set(BackendsHeader, strconv.Itoa(p.Backends))
+}
@@ -0,0 +1,152 @@
+package balancer
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// drainPollInterval - як часто перевіряється, чи завершилися запити до видаленого бекенду.
+const drainPollInterval = 100 * time.Millisecond
+
+// BackendState - збережений стан бекенду реєстру.
+type BackendState struct {
+	Host    string `json:"host"`
+	Healthy bool   `json:"healthy"`
+	// ActiveConns - з'єднання цієї репліки до бекенду; Restore його не відновлює.
+	ActiveConns int64 `json:"activeConns,omitempty"`
+}
+
+// Reload замінює реєстр бекендів списком hosts. Для доданих бекендів запускаються перевірки
+// здоров'я (якщо їх уже запущено), а видалені звільняються, щойно завершать розпочаті запити.
+// Повертає додані та видалені бекенди.
+func (b *Balancer) Reload(hosts []string) (added, removed []*Server, err error) {
+	added, removed, err = b.reload(hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.mu.RLock()
+	started := b.started
+	b.mu.RUnlock()
+	for _, s := range added {
+		log.Printf("Balancer: Backend %s added to the registry", s.URL.Host)
+		if started {
+			b.startHealthCheck(s, nil)
+		}
+	}
+	for _, s := range removed {
+		log.Printf("Balancer: Backend %s removed from the registry, draining %d active connections", s.URL.Host, s.GetActiveConns())
+		go b.drainServer(s)
+	}
+	b.changed()
+	return added, removed, nil
+}
+
+// reload замінює реєстр бекендів списком hosts. Бекенди, що залишаються, зберігають
+// свій *Server разом з лічильником з'єднань і станом здоров'я, тож запити, розпочаті до
+// перезавантаження, зменшують той самий лічильник. Бекенд, видалений раніше, але ще не
+// звільнений, повертається зі своїм лічильником. Нові бекенди починають з нуля і вважаються
+// нездоровими до першої перевірки. Повертає додані та видалені бекенди.
+func (b *Balancer) reload(hosts []string) (added, removed []*Server, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]*Server, len(b.servers))
+	for _, s := range b.servers {
+		current[s.URL.Host] = s
+	}
+	next := make([]*Server, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+		if s, ok := current[host]; ok {
+			next = append(next, s)
+			delete(current, host)
+			continue
+		}
+		s, ok := b.retired[host]
+		if !ok {
+			if s, err = b.newServer(host); err != nil {
+				return nil, nil, err
+			}
+		}
+		next = append(next, s)
+		added = append(added, s)
+	}
+	// Реєстр змінюється лише після того, як усі бекенди створено успішно.
+	for _, s := range added {
+		if b.retired[s.URL.Host] == s {
+			s.setDraining(false)
+			delete(b.retired, s.URL.Host)
+		}
+	}
+	for host, s := range current {
+		s.setDraining(true)
+		b.retired[host] = s
+		removed = append(removed, s)
+	}
+	b.servers = next
+	return added, removed, nil
+}
+
+// drainServer чекає, доки видалений бекенд завершить розпочаті запити, і звільняє його.
+// Якщо бекенд повернули до реєстру раніше, нічого не робить.
+func (b *Balancer) drainServer(s *Server) {
+	for s.isDraining() && s.GetActiveConns() > 0 {
+		time.Sleep(drainPollInterval)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !s.isDraining() || b.retired[s.URL.Host] != s {
+		return
+	}
+	delete(b.retired, s.URL.Host)
+	s.stopHealthChecks()
+	if s.ReverseProxy != nil {
+		if transport, ok := s.ReverseProxy.Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+	}
+	log.Printf("Balancer: Backend %s drained", s.URL.Host)
+}
+
+// State повертає стан здоров'я бекендів реєстру та кількість з'єднань до них.
+func (b *Balancer) State() []BackendState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	state := make([]BackendState, 0, len(b.servers))
+	for _, s := range b.servers {
+		state = append(state, BackendState{Host: s.URL.Host, Healthy: s.GetHealth(), ActiveConns: s.GetActiveConns()})
+	}
+	return state
+}
+
+// Restore відновлює стан здоров'я бекендів, збережений State. Бекенди, яких немає
+// в реєстрі, додаються до нього. Викликається до StartHealthChecks.
+// Повертає false, якщо відновлювати нічого.
+func (b *Balancer) Restore(state []BackendState) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known := make(map[string]*Server, len(b.servers))
+	for _, s := range b.servers {
+		known[s.URL.Host] = s
+	}
+	for _, backend := range state {
+		s, ok := known[backend.Host]
+		if !ok {
+			newSrv, err := b.newServer(backend.Host)
+			if err != nil {
+				log.Printf("Balancer state: skipping backend %s: %v", backend.Host, err)
+				continue
+			}
+			b.servers = append(b.servers, newSrv)
+			known[backend.Host] = newSrv
+			s = newSrv
+		}
+		s.SetHealth(backend.Healthy)
+		log.Printf("Balancer state: restored %s healthy: %t", backend.Host, backend.Healthy)
+	}
+	return len(state) > 0
+}
@@ -0,0 +1,131 @@
+package balancer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestBalancer створює балансувальник з реєстром initial.
+func newTestBalancer(initial []*Server) *Balancer {
+	b := New(Options{})
+	b.servers = initial
+	return b
+}
+
+func TestReloadBackends_CarriesOverCounters(t *testing.T) {
+	server1 := newTestServer("http://server1:8080", true, 2)
+	server2 := newTestServer("http://server2:8080", true, 5)
+	b := newTestBalancer([]*Server{server1, server2})
+
+	added, removed, err := b.reload([]string{"server2:8080", "server3:8080", "server3:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.servers) != 2 || b.servers[0] != server2 {
+		t.Fatalf("surviving backend was replaced: %v", b.servers)
+	}
+	if server2.GetActiveConns() != 5 || !server2.GetHealth() {
+		t.Errorf("surviving backend lost its state: %d conns, healthy %t", server2.GetActiveConns(), server2.GetHealth())
+	}
+	if len(added) != 1 || added[0] != b.servers[1] || added[0].GetActiveConns() != 0 || added[0].GetHealth() {
+		t.Errorf("new backend should start with zero connections and unhealthy: %+v", added)
+	}
+	if len(removed) != 1 || removed[0] != server1 || !server1.isDraining() || b.retired["server1:8080"] != server1 {
+		t.Errorf("removed backend should be draining: %+v", removed)
+	}
+
+	// Запити, розпочаті до видалення, зменшують лічильник того самого бекенду.
+	server1.DecrementActiveConns()
+	server1.DecrementActiveConns()
+	b.drainServer(server1)
+	if _, ok := b.retired["server1:8080"]; ok {
+		t.Errorf("drained backend is still retired")
+	}
+
+	// Бекенд, повернутий до завершення запитів, зберігає свій лічильник.
+	if _, _, err := b.reload([]string{"server3:8080"}); err != nil {
+		t.Fatal(err)
+	}
+	added, _, err = b.reload([]string{"server2:8080", "server3:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0] != server2 || server2.isDraining() || server2.GetActiveConns() != 5 {
+		t.Errorf("re-added backend should keep its counter: %+v", added)
+	}
+}
+
+func TestReloadBackends_ConcurrentTraffic(t *testing.T) {
+	b := newTestBalancer([]*Server{
+		newTestServer("http://server1:8080", true, 0),
+		newTestServer("http://server2:8080", true, 0),
+	})
+
+	var (
+		seenMu sync.Mutex
+		seen   = make(map[*Server]bool)
+		wg     sync.WaitGroup
+		done   = make(chan struct{})
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := b.selectLeastLoadedServer()
+				if s == nil {
+					continue
+				}
+				seenMu.Lock()
+				seen[s] = true
+				seenMu.Unlock()
+				s.IncrementActiveConns()
+				time.Sleep(time.Millisecond)
+				s.DecrementActiveConns()
+			}
+		}()
+	}
+
+	configs := [][]string{
+		{"server2:8080", "server3:8080"},
+		{"server1:8080", "server2:8080", "server3:8080"},
+		{"server3:8080"},
+		{"server1:8080", "server2:8080"},
+	}
+	for round := 0; round < 20; round++ {
+		added, _, err := b.reload(configs[round%len(configs)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range added {
+			s.SetHealth(true)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	close(done)
+	wg.Wait()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range seen {
+		if conns := s.GetActiveConns(); conns != 0 {
+			t.Errorf("backend %s has %d active connections after all requests finished", s.URL.Host, conns)
+		}
+	}
+	hosts := make(map[string]bool)
+	for _, s := range b.servers {
+		if hosts[s.URL.Host] {
+			t.Errorf("backend %s registered twice", s.URL.Host)
+		}
+		hosts[s.URL.Host] = true
+		if b.retired[s.URL.Host] != nil {
+			t.Errorf("registered backend %s is also retired", s.URL.Host)
+		}
+	}
+}
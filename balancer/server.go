@@ -0,0 +1,165 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Server - бекенд балансувальника разом з лічильником активних з'єднань і станом здоров'я.
+type Server struct {
+	URL          *url.URL
+	ActiveConns  int64
+	IsHealthy    bool
+	mutex        sync.RWMutex
+	ReverseProxy *httputil.ReverseProxy
+
+	// draining - бекенд видалено з реєстру, але він ще завершує розпочаті запити.
+	draining bool
+	// stopHealth зупиняє перевірки здоров'я бекенду; nil, якщо перевірки не запущені.
+	stopHealth chan struct{}
+	// reported - навантаження, повідомлене бекендом для стратегії ReportedLoad.
+	reported *serverLoad
+}
+
+func (s *Server) IncrementActiveConns() {
+	s.mutex.Lock()
+	s.ActiveConns++
+	s.mutex.Unlock()
+}
+
+func (s *Server) DecrementActiveConns() {
+	s.mutex.Lock()
+	if s.ActiveConns > 0 {
+		s.ActiveConns--
+	}
+	s.mutex.Unlock()
+}
+
+func (s *Server) GetActiveConns() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.ActiveConns
+}
+
+func (s *Server) SetHealth(status bool) {
+	s.mutex.Lock()
+	s.IsHealthy = status
+	s.mutex.Unlock()
+}
+
+func (s *Server) GetHealth() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.IsHealthy
+}
+
+func (s *Server) setDraining(draining bool) {
+	s.mutex.Lock()
+	s.draining = draining
+	s.mutex.Unlock()
+}
+
+func (s *Server) isDraining() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.draining
+}
+
+// newServer створює бекенд host разом з ReverseProxy, який повторює ідемпотентні запити
+// на іншому бекенді реєстру b. Бекенд не додається до реєстру.
+func (b *Balancer) newServer(host string) (*Server, error) {
+	fullServerURL := fmt.Sprintf("%s://%s", b.scheme(), host)
+	parsedURL, err := url.Parse(fullServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing server URL %s: %w", fullServerURL, err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(parsedURL)
+	originalDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		originalDirector(req)
+		req.Host = parsedURL.Host
+	}
+
+	proxy.Transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     false,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	srv := &Server{
+		URL:          parsedURL,
+		ActiveConns:  0,
+		IsHealthy:    false,
+		ReverseProxy: proxy,
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if shouldRetry(resp) {
+			return errRetryableBackend
+		}
+		return nil
+	}
+
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		// Клієнт, що від'єднався, не чекає на відповідь: повтор лише навантажив би інший бекенд.
+		if errors.Is(err, errRetryableBackend) && req.Context().Err() == nil {
+			if other := b.selectLeastLoadedServerExcept(srv); other != nil {
+				log.Printf("Balancer: Retrying %s %s on %s after retryable error from %s", req.Method, req.URL.Path, other.URL.Host, parsedURL.Host)
+				b.forward(other, rw, req.WithContext(context.WithValue(req.Context(), retriedKey{}, true)))
+				return
+			}
+		}
+		log.Printf("[PROXY ERROR] Target: %s, Request: %s %s, Error: %v", parsedURL.Host, req.Method, req.URL.Path, err)
+		if rw.Header().Get("X-Balancer-Response-Sent") == "" {
+			rw.Header().Set("X-Balancer-Response-Sent", "true")
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || err == http.ErrAbortHandler {
+				log.Printf("ReverseProxy error likely client abort/cancel or request timeout for host %s: %v", parsedURL.Host, err)
+			} else {
+				log.Printf("Sending 502 Bad Gateway to client due to ReverseProxy error to host %s: %v", parsedURL.Host, err)
+				http.Error(rw, fmt.Sprintf("Bad Gateway: Error connecting to backend server %s", parsedURL.Host), http.StatusBadGateway)
+			}
+		} else {
+			log.Printf("Headers already sent, cannot send error response for host %s: %v", parsedURL.Host, err)
+		}
+	}
+
+	return srv, nil
+}
+
+// retryableHeader - заголовок, яким бекенд позначає, чи має сенс повторювати запит.
+const retryableHeader = "X-Retryable"
+
+var errRetryableBackend = errors.New("backend returned a retryable error")
+
+// retriedKey позначає в контексті запит, який уже повторювався на іншому бекенді.
+type retriedKey struct{}
+
+// shouldRetry вирішує, чи повторити запит на іншому бекенді. Повторюються лише ідемпотентні
+// запити, один раз, і лише якщо бекенд не позначив помилку як неповторювану.
+func shouldRetry(resp *http.Response) bool {
+	req := resp.Request
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if retried, _ := req.Context().Value(retriedKey{}).(bool); retried {
+		return false
+	}
+	return resp.StatusCode >= http.StatusInternalServerError && resp.Header.Get(retryableHeader) != "false"
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+const codeUnauthorized = "unauthorized"
+
+// adminToken - токен адміністратора з DB_ADMIN_TOKEN. Порожній токен вимикає захищені ендпоінти.
+var adminToken = config.Getenv("DB_ADMIN_TOKEN")
+
+// adminAuth пропускає лише запити з заголовком Authorization: Bearer <DB_ADMIN_TOKEN>.
+func adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			writeJSON(w, http.StatusForbidden, DbResponse{ErrorInfo: newErrorInfo(codeUnauthorized, false, "admin API is disabled: DB_ADMIN_TOKEN is not set")})
+			return
+		}
+		token := requestToken(r)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			log.Printf("DB_SERVER: Rejected admin request %s %s with token %s", r.Method, r.URL.Path, maskToken(token))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, DbResponse{ErrorInfo: newErrorInfo(codeUnauthorized, false, "admin token required")})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listSegmentsHandler обробляє GET /admin/segments.
+func listSegmentsHandler(w http.ResponseWriter, _ *http.Request) {
+	segments, err := db.Segments()
+	if err != nil {
+		log.Printf("DB_SERVER: Failed to list segments: %v", err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(segments)
+}
+
+// downloadSegmentHandler обробляє GET /admin/segments/{id}, віддаючи сирий файл сегмента.
+func downloadSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	segID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || segID < 0 {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Segment id must be a non-negative integer")})
+		return
+	}
+	segment, size, err := db.OpenSegment(segID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, DbResponse{ErrorInfo: errorInfo(err)})
+			return
+		}
+		log.Printf("DB_SERVER: Failed to open segment %d: %v", segID, err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	defer segment.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"segment-%d\"", segID))
+	written, err := io.Copy(w, segment)
+	if err != nil {
+		log.Printf("DB_SERVER: Segment %d download aborted after %d of %d bytes: %v", segID, written, size, err)
+		return
+	}
+	log.Printf("DB_SERVER: Streamed segment %d (%d bytes)", segID, written)
+}
+
+// RotateResponse - відповідь POST /admin/rotate.
+type RotateResponse struct {
+	Sealed []int `json:"sealed"`
+}
+
+// rotateHandler обробляє POST /admin/rotate: запечатує активні сегменти, щоб інструменти
+// резервного копіювання й реплікації могли забрати їх через /admin/segments/{id}.
+func rotateHandler(w http.ResponseWriter, _ *http.Request) {
+	sealed, err := db.Rotate()
+	if err != nil {
+		log.Printf("DB_SERVER: Segment rotation failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	if sealed == nil {
+		sealed = []int{}
+	}
+	log.Printf("DB_SERVER: Sealed segments %v on request", sealed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RotateResponse{Sealed: sealed})
+}
+
+// compactHandler обробляє POST /admin/compact: синхронно зливає сегменти й повертає звіт.
+// Якщо клієнт розриває з'єднання, злиття скасовується.
+func compactHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := db.Compact(r.Context())
+	if err != nil {
+		log.Printf("DB_SERVER: Manual compaction failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Manual compaction merged %d segments into %d, reclaimed %d bytes in %s",
+		report.SegmentsMerged, report.SegmentsWritten, report.BytesReclaimed, report.Duration)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// verifyHandler обробляє GET /admin/verify: перевіряє сегменти та індекс і повертає звіт
+// з усіма знайденими проблемами. Знайдені проблеми не є помилкою запиту: відповідь 200.
+func verifyHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := db.Verify(r.Context())
+	if err != nil {
+		log.Printf("DB_SERVER: Verify failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	if report.OK() {
+		log.Printf("DB_SERVER: Verified %d segments (%d entries, %d index entries) in %s, no problems found",
+			report.Segments, report.Entries, report.IndexEntries, report.Duration)
+	} else {
+		log.Printf("DB_SERVER: Verified %d segments in %s, found %d problems, first: %s in segment %d at offset %d: %s",
+			report.Segments, report.Duration, len(report.Problems), report.Problems[0].Kind, report.Problems[0].Segment, report.Problems[0].Offset, report.Problems[0].Detail)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// migrationsHandler обробляє GET /admin/migrations: кроки міграції бази та час їх виконання.
+func migrationsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(db.Migrations())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// AggregateResponse - відповідь GET /db/_aggregate. Value відсутнє, якщо немає жодного значення int64
+// (крім op=count).
+type AggregateResponse struct {
+	Prefix string      `json:"prefix"`
+	Op     string      `json:"op"`
+	Value  interface{} `json:"value,omitempty"`
+	Count  int64       `json:"count"`
+	ErrorInfo
+}
+
+func writeAggregateJSON(w http.ResponseWriter, status int, resp AggregateResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// aggregateHandler обробляє GET /db/_aggregate?prefix=scores_&op=sum|min|max|avg|count
+// над значеннями int64 ключів з префіксом.
+func aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	op := query.Get("op")
+	resp := AggregateResponse{Prefix: prefix, Op: op}
+	switch op {
+	case "sum", "min", "max", "avg", "count":
+	default:
+		resp.ErrorInfo = requestError("Query parameter 'op' must be one of: sum, min, max, avg, count")
+		writeAggregateJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	stats, err := db.AggregateInt64(prefix)
+	if err != nil {
+		log.Printf("DB_SERVER: Aggregate %s over prefix '%s' failed: %v", op, prefix, err)
+		resp.ErrorInfo = errorInfo(err)
+		writeAggregateJSON(w, http.StatusInternalServerError, resp)
+		return
+	}
+	resp.Count = stats.Count
+	switch {
+	case op == "count":
+		resp.Value = stats.Count
+	case stats.Count == 0:
+	case op == "sum":
+		resp.Value = stats.Sum
+	case op == "min":
+		resp.Value = stats.Min
+	case op == "max":
+		resp.Value = stats.Max
+	case op == "avg":
+		resp.Value = stats.Avg()
+	}
+	log.Printf("DB_SERVER: Aggregate %s over prefix '%s': %s (%d values)", op, prefix, logPolicy.Value(prefix, resp.Value), stats.Count)
+	writeAggregateJSON(w, http.StatusOK, resp)
+}
+
+// Int64RangeItem - ключ і його значення у відповіді GET /db/_int64_range.
+type Int64RangeItem struct {
+	Key   string `json:"key"`
+	Value int64  `json:"value"`
+}
+
+// Int64RangeResponse - відповідь GET /db/_int64_range.
+type Int64RangeResponse struct {
+	Min   int64            `json:"min"`
+	Max   int64            `json:"max"`
+	Items []Int64RangeItem `json:"items"`
+	ErrorInfo
+}
+
+func writeInt64RangeJSON(w http.ResponseWriter, status int, resp Int64RangeResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// int64RangeHandler обробляє GET /db/_int64_range?min=X&max=Y: ключі зі значеннями int64
+// від X до Y включно за вторинним індексом (DB_INDEX_INT64=true).
+func int64RangeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var resp Int64RangeResponse
+	var errMin, errMax error
+	resp.Min, errMin = strconv.ParseInt(query.Get("min"), 10, 64)
+	resp.Max, errMax = strconv.ParseInt(query.Get("max"), 10, 64)
+	if errMin != nil || errMax != nil || resp.Min > resp.Max {
+		resp.ErrorInfo = requestError("Query parameters 'min' and 'max' must be int64 values with min <= max")
+		writeInt64RangeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	kvs, err := db.QueryInt64Range(resp.Min, resp.Max)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, datastore.ErrInt64IndexDisabled) {
+			status = http.StatusNotImplemented
+		}
+		log.Printf("DB_SERVER: Int64 range query [%d, %d] failed: %v", resp.Min, resp.Max, err)
+		resp.ErrorInfo = errorInfo(err)
+		writeInt64RangeJSON(w, status, resp)
+		return
+	}
+	resp.Items = make([]Int64RangeItem, 0, len(kvs))
+	for _, kv := range kvs {
+		resp.Items = append(resp.Items, Int64RangeItem{Key: kv.Key, Value: kv.Value.(int64)})
+	}
+	log.Printf("DB_SERVER: Int64 range query [%d, %d]: %d keys", resp.Min, resp.Max, len(resp.Items))
+	writeInt64RangeJSON(w, http.StatusOK, resp)
+}
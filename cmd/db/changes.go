@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// lastSeqTrailer - трейлер відповіді /admin/changes з номером, до якого включно передано зміни.
+const lastSeqTrailer = "X-Last-Seq"
+
+// changesHandler обробляє GET /admin/changes?since=N: передає записи після номера N
+// по одному JSON-об'єкту datastore.Change на рядок. Номер для наступного запиту
+// повертається в трейлері X-Last-Seq.
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Query parameter 'since' must be a non-negative integer")})
+		return
+	}
+	w.Header().Set("Trailer", lastSeqTrailer)
+	started := false
+	enc := json.NewEncoder(w)
+	count := 0
+	lastSeq, err := db.ChangesSince(since, func(c datastore.Change) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			started = true
+		}
+		count++
+		return enc.Encode(c)
+	})
+	if err != nil {
+		if started {
+			log.Printf("DB_SERVER: Changes since %d aborted after %d changes: %v", since, count, err)
+			return
+		}
+		w.Header().Del("Trailer")
+		switch {
+		case errors.Is(err, datastore.ErrChangesCompacted):
+			writeJSON(w, http.StatusGone, DbResponse{ErrorInfo: errorInfo(err)})
+		case errors.Is(err, datastore.ErrUnknownSeq):
+			writeJSON(w, http.StatusConflict, DbResponse{ErrorInfo: errorInfo(err)})
+		default:
+			log.Printf("DB_SERVER: Failed to read changes since %d: %v", since, err)
+			writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		}
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set(lastSeqTrailer, strconv.FormatUint(lastSeq, 10))
+	log.Printf("DB_SERVER: Streamed %d changes since %d up to %d", count, since, lastSeq)
+}
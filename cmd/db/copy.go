@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// CopyResponse - відповідь POST /db/{key}/copy
+type CopyResponse struct {
+	Key       string     `json:"key"`
+	To        string     `json:"to,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	ErrorInfo
+}
+
+func writeCopyJSON(w http.ResponseWriter, status int, resp CopyResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// copyHandler обробляє POST /db/{key}/copy з тілом {"to": "...", "overwrite": false, "ttl": "24h"}.
+// Без overwrite існуючий цільовий ключ дає 409. "keepTtl": true без ttl переносить на копію
+// термін дії джерела.
+func copyHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	var requestBody struct {
+		To        string `json:"to"`
+		Overwrite bool   `json:"overwrite"`
+		TTL       string `json:"ttl"`
+		KeepTTL   bool   `json:"keepTtl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeCopyJSON(w, http.StatusBadRequest, CopyResponse{Key: key, ErrorInfo: requestError("Failed to decode request body: " + err.Error())})
+		return
+	}
+	resp := CopyResponse{Key: key, To: requestBody.To}
+	if requestBody.To == "" || requestBody.To == key {
+		resp.ErrorInfo = requestError("Field 'to' must name a key different from the source")
+		writeCopyJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	opts := datastore.CopyOptions{Overwrite: requestBody.Overwrite, KeepTTL: requestBody.KeepTTL}
+	if requestBody.TTL != "" {
+		ttl, err := time.ParseDuration(requestBody.TTL)
+		if err != nil || ttl <= 0 {
+			resp.ErrorInfo = requestError("Field 'ttl' must be a positive duration, e.g. \"24h\"")
+			writeCopyJSON(w, http.StatusBadRequest, resp)
+			return
+		}
+		opts.TTL = ttl
+	}
+
+	if err := db.Copy(key, requestBody.To, opts); err != nil {
+		resp.ErrorInfo = errorInfo(err)
+		switch {
+		case errors.Is(err, datastore.ErrNotFound):
+			writeCopyJSON(w, http.StatusNotFound, resp)
+		case errors.Is(err, datastore.ErrKeyExists):
+			writeCopyJSON(w, http.StatusConflict, resp)
+		case errors.Is(err, datastore.ErrWrongType):
+			writeCopyJSON(w, http.StatusBadRequest, resp)
+		default:
+			log.Printf("DB_SERVER: Failed to copy key %s to %s: %v", key, requestBody.To, err)
+			writeCopyJSON(w, writeErrorStatus(err), resp)
+		}
+		return
+	}
+	if expiresAt, ok := db.ExpiresAt(requestBody.To); ok {
+		resp.ExpiresAt = &expiresAt
+	}
+	log.Printf("DB_SERVER: Copied key '%s' to '%s' (ttl: %s)", key, requestBody.To, opts.TTL)
+	writeCopyJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	base := time.Date(2024, time.March, 15, 10, 30, 20, 0, time.UTC) // п'ятниця
+	testCases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.March, 15, 10, 31, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.March, 16, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, time.March, 15, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1", time.Date(2024, time.March, 18, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 1,7 *", time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tc := range testCases {
+		schedule, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) failed: %v", tc.expr, err)
+			continue
+		}
+		if got := schedule.Next(base); !got.Equal(tc.want) {
+			t.Errorf("Next(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q) must fail", bad)
+		}
+	}
+}
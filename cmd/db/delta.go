@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+const (
+	// versionHeader - номер запису поточного значення (EntryMeta.Seq), який клієнт
+	// передає в since_seq наступного запиту.
+	versionHeader = "X-Version"
+	// deltaHeader позначає відповідь, що містить JSON Merge Patch (RFC 7386) відносно
+	// версії since_seq замість повного значення.
+	deltaHeader = "X-Delta-Since"
+)
+
+// getDelta відповідає на GET /db/{key}?since_seq=N. Якщо значення не змінилося з версії N,
+// повертається 304. Якщо версія N JSON-документа ще зберігається (DB_KEY_VERSIONS),
+// повертається merge patch від неї до поточного документа, інакше - повне значення.
+// since_seq=0 повертає повне значення з номером версії.
+func getDelta(w http.ResponseWriter, key string, wantType byte, rawSince string) {
+	since, err := strconv.ParseUint(rawSince, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Invalid since_seq parameter, expected a non-negative integer")})
+		return
+	}
+	kv, meta, err := db.GetWithMeta(key)
+	if err == nil && kv.DataType != wantType {
+		err = datastore.ErrWrongType
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, datastore.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, datastore.ErrWrongType):
+			status = http.StatusBadRequest
+		default:
+			log.Printf("DB_SERVER: Failed to get value for key %s: %v", key, err)
+		}
+		writeJSON(w, status, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	w.Header().Set(versionHeader, strconv.FormatUint(meta.Seq, 10))
+	if since != 0 && since == meta.Seq {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if since != 0 && kv.DataType == datastore.DataTypeJSON {
+		base, err := db.VersionAt(key, since)
+		if err == nil {
+			if patch, ok := jsonMergePatch(base.Value.(json.RawMessage), kv.Value.(json.RawMessage)); ok {
+				log.Printf("DB_SERVER: Returning delta for key '%s' since seq %d (%d of %d bytes)", key, since, len(patch), meta.Size)
+				w.Header().Set(deltaHeader, strconv.FormatUint(since, 10))
+				writeJSON(w, http.StatusOK, DbResponse{Key: key, Value: patch})
+				return
+			}
+		} else if !errors.Is(err, datastore.ErrVersionUnavailable) {
+			log.Printf("DB_SERVER: Failed to read version %d of key %s: %v", since, key, err)
+		}
+	}
+	log.Printf("DB_SERVER: Successfully retrieved key '%s', value: %s", key, logPolicy.Value(key, kv.Value))
+	writeJSON(w, http.StatusOK, DbResponse{Key: key, Value: kv.Value})
+}
+
+// jsonMergePatch будує JSON Merge Patch, що перетворює документ from на to. Повертає false,
+// якщо документи не є об'єктами або патч не може виразити зміну (null-поля в to).
+func jsonMergePatch(from, to json.RawMessage) (json.RawMessage, bool) {
+	var oldDoc, newDoc any
+	if decodeJSONNumbers(from, &oldDoc) != nil || decodeJSONNumbers(to, &newDoc) != nil {
+		return nil, false
+	}
+	oldObj, okOld := oldDoc.(map[string]any)
+	newObj, okNew := newDoc.(map[string]any)
+	if !okOld || !okNew {
+		return nil, false
+	}
+	patch, ok := mergeDiff(oldObj, newObj)
+	if !ok {
+		return nil, false
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func decodeJSONNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// mergeDiff повертає поля, якими newObj відрізняється від oldObj; видалені поля стають null.
+func mergeDiff(oldObj, newObj map[string]any) (map[string]any, bool) {
+	patch := make(map[string]any)
+	for name, newVal := range newObj {
+		oldVal, existed := oldObj[name]
+		if existed && reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		oldSub, okOld := oldVal.(map[string]any)
+		newSub, okNew := newVal.(map[string]any)
+		if existed && okOld && okNew {
+			sub, ok := mergeDiff(oldSub, newSub)
+			if !ok {
+				return nil, false
+			}
+			patch[name] = sub
+			continue
+		}
+		// Значення замінюється цілком, тож null у ньому патч сприйняв би як видалення.
+		if hasNullMember(newVal) {
+			return nil, false
+		}
+		patch[name] = newVal
+	}
+	for name := range oldObj {
+		if _, ok := newObj[name]; !ok {
+			patch[name] = nil
+		}
+	}
+	return patch, true
+}
+
+// hasNullMember повідомляє, чи є v null або містить null-поле в об'єкті на будь-якій
+// глибині. Масиви merge patch не обходить, тож null усередині них допустимий.
+func hasNullMember(v any) bool {
+	if v == nil {
+		return true
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	for _, member := range obj {
+		if hasNullMember(member) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/config"
+)
+
+// drainTracker рахує запити, що виконуються, і стан завершення роботи сервера.
+type drainTracker struct {
+	active atomic.Int64
+
+	mu      sync.Mutex
+	started time.Time
+	done    time.Duration
+}
+
+// DrainStatus - стан завершення роботи сервера в GET /health.
+type DrainStatus struct {
+	ActiveRequests int64 `json:"activeRequests"`
+	QueuedPuts     int   `json:"queuedPuts"`
+	// ElapsedMs - скільки триває завершення; після його закінчення - загальна тривалість.
+	ElapsedMs int64 `json:"elapsedMs"`
+	Done      bool  `json:"done"`
+}
+
+var drain = &drainTracker{}
+
+// Middleware враховує запит серед активних, доки він виконується.
+func (d *drainTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.active.Add(1)
+		defer d.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// begin позначає початок завершення роботи. /health з цього моменту відповідає 503.
+func (d *drainTracker) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started.IsZero() {
+		d.started = time.Now()
+	}
+}
+
+// finish фіксує тривалість завершення роботи й повертає її.
+func (d *drainTracker) finish() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.done = time.Since(d.started)
+	return d.done
+}
+
+// status повертає стан завершення роботи або nil, якщо сервер працює у звичайному режимі.
+func (d *drainTracker) status() *DrainStatus {
+	d.mu.Lock()
+	started, done := d.started, d.done
+	d.mu.Unlock()
+	if started.IsZero() {
+		return nil
+	}
+	status := &DrainStatus{ActiveRequests: d.active.Load(), Done: done > 0}
+	if db != nil {
+		status.QueuedPuts = db.QueuedPuts()
+	}
+	elapsed := time.Since(started)
+	if status.Done {
+		elapsed = done
+	}
+	status.ElapsedMs = elapsed.Milliseconds()
+	return status
+}
+
+// durationFromEnv читає тривалість зі змінної оточення name, повертаючи def, якщо її не задано.
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	raw := config.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+	return time.ParseDuration(raw)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/signal"
+)
+
+const (
+	engineFile   = "file"
+	engineMemory = "memory"
+)
+
+// engine обирає сховище: файлове в DB_DIR або в пам'яті, для інтеграційних тестів
+// і тимчасових розгортань без директорії з даними.
+var engine = flag.String("engine", engineFile, "storage engine: file or memory")
+
+// newStorageRouter обслуговує спільний для всіх сховищ набір запитів: рядкові значення
+// ключів /db/{key}, /ready та /health. Решта можливостей сервера потребує файлового Db.
+func newStorageRouter(s datastore.Storage) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /db/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		storageGetHandler(w, r, s)
+	})
+	mux.HandleFunc("POST /db/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		storagePutHandler(w, r, s)
+	})
+	mux.HandleFunc("PUT /db/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		storagePutHandler(w, r, s)
+	})
+	mux.HandleFunc("DELETE /db/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		storageDeleteHandler(w, r, s)
+	})
+	mux.HandleFunc("/db/{key...}", methodNotAllowedHandler)
+	mux.HandleFunc("GET /ready", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(HealthResponse{Status: "ok"})
+	})
+	return httptools.Chain(mux, httptools.Recoverer("DB_SERVER"), httptools.PrettyJSON(debugMode))
+}
+
+func storageGetHandler(w http.ResponseWriter, r *http.Request, s datastore.Storage) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Key is missing in URL path for GET request")})
+		return
+	}
+	if dataType := r.URL.Query().Get("type"); dataType != "" && dataType != "string" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("The " + *engine + " engine supports only type=string")})
+		return
+	}
+	value, err := s.Get(key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	if err != nil {
+		log.Printf("DB_SERVER: Failed to get key %s: %v", key, err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	setETag(w, datastore.ETag(value))
+	writeJSON(w, http.StatusOK, DbResponse{Key: key, Value: value})
+}
+
+func storagePutHandler(w http.ResponseWriter, r *http.Request, s datastore.Storage) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Key is missing in URL path for POST request")})
+		return
+	}
+	if r.Header.Get("If-Match") != "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("The " + *engine + " engine does not support If-Match")})
+		return
+	}
+	var requestBody struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Failed to decode request body: " + err.Error())})
+		return
+	}
+	value, ok := requestBody.Value.(string)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError(fmt.Sprintf("Invalid value type in request body: %T. The %s engine supports only strings", requestBody.Value, *engine))})
+		return
+	}
+	if err := s.Put(key, value); err != nil {
+		log.Printf("DB_SERVER: Failed to put value for key %s: %v", key, err)
+		writeJSON(w, writeErrorStatus(err), DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Successfully stored key '%s', value: %s", key, logPolicy.Value(key, value))
+	setETag(w, datastore.ETag(value))
+	writeJSON(w, http.StatusCreated, DbResponse{Key: key, Value: value})
+}
+
+func storageDeleteHandler(w http.ResponseWriter, r *http.Request, s datastore.Storage) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Bulk delete is not supported by the " + *engine + " engine")})
+		return
+	}
+	if err := s.Delete(key); err != nil {
+		status := writeErrorStatus(err)
+		if errors.Is(err, datastore.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Successfully deleted key '%s'", key)
+	writeJSON(w, http.StatusOK, DbResponse{Key: key})
+}
+
+// serveMemory запускає сервер зі сховищем у пам'яті; дані втрачаються при зупинці.
+func serveMemory(port string) {
+	store := datastore.NewMemoryStorage()
+	log.Printf("DB_SERVER: Starting database server with in-memory storage on port %s...", port)
+	server := &http.Server{Addr: ":" + port, Handler: newStorageRouter(store)}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("DB_SERVER: Failed to start DB server: %v", err)
+		}
+	}()
+
+	signal.WaitForTerminationSignal()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("DB_SERVER: HTTP server shutdown error: %v", err)
+	}
+	store.Close()
+}
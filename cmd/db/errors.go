@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// retryableHeader дублює поле retryable для клієнтів, що не розбирають тіло відповіді (балансувальник).
+const retryableHeader = "X-Retryable"
+
+// Коди помилок сервера, що не походять з datastore.
+const (
+	codeBadRequest    = "bad_request"
+	codeQuotaExceeded = "quota_exceeded"
+	codeNeedsConfirm  = "confirmation_required"
+	codeNotAllowed    = "method_not_allowed"
+	codeNotReady      = "not_ready"
+)
+
+// ErrorInfo - поля помилки, спільні для всіх відповідей сервера БД.
+type ErrorInfo struct {
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Retryable *bool  `json:"retryable,omitempty"`
+}
+
+func newErrorInfo(code string, retryable bool, message string) ErrorInfo {
+	return ErrorInfo{Error: message, Code: code, Retryable: &retryable}
+}
+
+// errorInfo описує помилку datastore за її таксономією.
+func errorInfo(err error) ErrorInfo {
+	message := err.Error()
+	if code := datastore.ErrorCode(err); code == datastore.CodeNotFound {
+		message = "not found"
+	}
+	return newErrorInfo(datastore.ErrorCode(err), datastore.IsRetryable(err), message)
+}
+
+// statusClientClosedRequest - нестандартний статус (як у nginx) для запиту, клієнт якого
+// від'єднався до завершення запису. Клієнт його вже не отримає, але він потрапляє в журнали.
+const statusClientClosedRequest = 499
+
+// writeErrorStatus повертає HTTP-статус невдалого запису: 507, якщо вичерпано ліміти
+// сховища, 499 або 504, якщо запит скасовано чи вичерпано його час, інакше 500.
+func writeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, datastore.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// requestError описує помилку в параметрах запиту. Такий запит повторювати без змін немає сенсу.
+func requestError(message string) ErrorInfo {
+	return newErrorInfo(codeBadRequest, false, message)
+}
+
+func setRetryableHeader(w http.ResponseWriter, info ErrorInfo) {
+	if info.Retryable != nil {
+		w.Header().Set(retryableHeader, strconv.FormatBool(*info.Retryable))
+	}
+}
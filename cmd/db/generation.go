@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// generationHeader - заголовок з поколінням бази (datastore.Db.Generation). Покоління
+// змінюється, коли базу відновлено зі знімка, тож кеші та ETag, отримані раніше, застаріли.
+const generationHeader = "X-DB-Generation"
+
+// generationMiddleware додає покоління бази до кожної відповіді.
+func generationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if db != nil {
+			w.Header().Set(generationHeader, db.Generation())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkGeneration відхиляє умовний запис з 412, якщо клієнт передав покоління, у якому
+// отримав ETag, і воно відрізняється від поточного: збіг ETag у відновленій базі не означає,
+// що клієнт бачив поточну історію значення. Повертає false, якщо відповідь уже записано.
+func checkGeneration(w http.ResponseWriter, r *http.Request, key string) bool {
+	seen := r.Header.Get(generationHeader)
+	if seen == "" || seen == db.Generation() {
+		return true
+	}
+	log.Printf("DB_SERVER: If-Match for key %s was read from generation %s, current is %s", key, seen, db.Generation())
+	writeJSON(w, http.StatusPreconditionFailed, DbResponse{Key: key, ErrorInfo: newErrorInfo(datastore.CodePreconditionFailed, false, "database was restored since the value was read, re-read it and retry")})
+	return false
+}
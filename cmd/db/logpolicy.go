@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+)
+
+// auditLogPolicy - операція журналу обслуговування для заміни політики журналювання.
+const auditLogPolicy = "log-policy"
+
+// logPolicyFromEnv читає політику журналювання значень з файлу DB_LOG_POLICY.
+// Без DB_LOG_POLICY значення замінюються хешем (logpolicy.DefaultPolicy).
+func logPolicyFromEnv() (logpolicy.Policy, error) {
+	path := config.Getenv("DB_LOG_POLICY")
+	if path == "" {
+		return logpolicy.DefaultPolicy(), nil
+	}
+	return logpolicy.Load(path)
+}
+
+// putLogPolicyHandler обробляє PUT /admin/log-policy: замінює політику журналювання значень
+// без перезапуску сервера. Зміна записується в журнал обслуговування бази.
+func putLogPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Failed to read request body")})
+		return
+	}
+	policy, err := logpolicy.Parse(body)
+	entry := datastore.AuditEntry{Op: auditLogPolicy, Source: r.RemoteAddr}
+	if err == nil {
+		logPolicy.Set(policy)
+		entry.Details = fmt.Sprintf("default %s, %d rules", policy.Default.Action, len(policy.Rules))
+	}
+	db.Audit(entry, err)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError(err.Error())})
+		return
+	}
+	log.Printf("DB_SERVER: Log policy replaced: %s", entry.Details)
+	logPolicy.ServeHTTP(w, r)
+}
@@ -1,160 +1,608 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Wandestes/software-architecture_4/config"
 	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+	"github.com/Wandestes/software-architecture_4/signal"
 )
 
-var db *datastore.Db
+// bulkDeleteConfirmThreshold - кількість ключів, починаючи з якої масове видалення
+// потребує заголовка підтвердження.
+const bulkDeleteConfirmThreshold = 100
+
+const confirmBulkDeleteHeader = "X-Confirm-Bulk-Delete"
+
+// seqHeader містить порядковий номер останньої зміни ключа для довгого опитування.
+const seqHeader = "X-Seq"
+
+// maxLongPollWait обмежує параметр wait у довгому опитуванні.
+const maxLongPollWait = 60 * time.Second
+
+// shutdownTimeout - час на завершення запитів і записів у черзі за замовчуванням (DB_SHUTDOWN_TIMEOUT).
+// Після нього записи, що ще в черзі, відхиляються.
+const shutdownTimeout = 10 * time.Second
+
+var selfTest = flag.Bool("selftest", false, "run a self-test against a temporary datastore and exit")
+
+// noMigrate вимикає міграції при старті, напр. щоб відкрити копію бази старою версією сервера.
+var noMigrate = flag.Bool("no-migrate", false, "do not run pending datastore migrations on startup")
+
+var (
+	db    *datastore.Db
+	usage = newUsageTracker(QuotaLimits{})
+	// debugMode вмикає налагоджувальні можливості, зокрема ?pretty=1.
+	debugMode = httptools.DebugEnabled()
+	// snapshots - планувальник знімків, nil якщо знімки не налаштовано.
+	snapshots *snapshotScheduler
+	// slowLog - журнал повільних запитів, доступний через /admin/slowlog.
+	slowLog = httptools.NewSlowLog(httptools.DefaultSlowThreshold, httptools.DefaultSlowLogSize)
+	// logPolicy визначає, як значення ключів потрапляють у журнал (DB_LOG_POLICY, /admin/log-policy).
+	logPolicy = logpolicy.New(logpolicy.DefaultPolicy())
+)
 
 type DbResponse struct {
 	Key   string      `json:"key,omitempty"`
 	Value interface{} `json:"value,omitempty"`
-	Error string      `json:"error,omitempty"`
+	ErrorInfo
+}
+
+// BulkDeleteResponse - відповідь на масове видалення ключів за префіксом
+type BulkDeleteResponse struct {
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count"`
+	DryRun bool   `json:"dryRun,omitempty"`
+	ErrorInfo
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp DbResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
 }
 
-func dbHandler(w http.ResponseWriter, r *http.Request) {
+// coerceValue перетворює значення на запитаний тип для GET з ?coerce=true.
+func coerceValue(kv datastore.KeyValue, wantType byte) (interface{}, error) {
+	switch wantType {
+	case datastore.DataTypeInt64:
+		return kv.AsInt64()
+	case datastore.DataTypeString:
+		return kv.AsString()
+	}
+	return nil, datastore.ErrWrongType
+}
 
-	key := strings.TrimPrefix(r.URL.Path, "/db/")
-	if key == "" && r.Method != http.MethodPost {
-		http.Error(w, "Key is missing in URL path", http.StatusBadRequest)
+func getValueHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Key is missing in URL path for GET request")})
 		return
 	}
+	dataType := r.URL.Query().Get("type")
+	if dataType == "" {
+		dataType = "string"
+	}
 
-	w.Header().Set("Content-Type", "application/json")
+	log.Printf("DB_SERVER: GET request for key='%s', type='%s'", key, dataType)
 
-	switch r.Method {
-	case http.MethodGet:
-		if key == "" {
-			http.Error(w, "Key is missing in URL path for GET request", http.StatusBadRequest)
+	var wantType byte
+	switch dataType {
+	case "string":
+		wantType = datastore.DataTypeString
+	case "int64":
+		wantType = datastore.DataTypeInt64
+	case "json":
+		wantType = datastore.DataTypeJSON
+	default:
+		log.Printf("DB_SERVER: Invalid type parameter: %s", dataType)
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Invalid type parameter. Supported types: string, int64, json")})
+		return
+	}
+	if r.URL.Query().Has("field") {
+		if wantType != datastore.DataTypeJSON {
+			writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("The field parameter requires type=json")})
 			return
 		}
-		dataType := r.URL.Query().Get("type")
-		if dataType == "" {
-			dataType = "string"
-		}
+		getJSONField(w, key, r.URL.Query().Get("field"))
+		return
+	}
 
-		var value interface{}
-		var err error
+	coerce, err := strconv.ParseBool(r.URL.Query().Get("coerce"))
+	if err != nil && r.URL.Query().Has("coerce") {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Invalid coerce parameter, expected true or false")})
+		return
+	}
 
-		log.Printf("DB_SERVER: GET request for key='%s', type='%s'", key, dataType)
+	if r.URL.Query().Has("wait") && !waitForChange(w, r, key) {
+		return
+	}
+	if r.URL.Query().Has("since_seq") {
+		getDelta(w, key, wantType, r.URL.Query().Get("since_seq"))
+		return
+	}
 
-		if dataType == "string" {
-			value, err = db.Get(key)
-		} else if dataType == "int64" {
-			value, err = db.GetInt64(key)
+	kv, etag, err := db.GetWithETag(key)
+	w.Header().Set(seqHeader, strconv.FormatUint(db.KeySeq(key), 10))
+	value := kv.Value
+	if err == nil && kv.DataType != wantType {
+		if coerce {
+			value, err = coerceValue(kv, wantType)
 		} else {
-			log.Printf("DB_SERVER: Invalid type parameter: %s", dataType)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(DbResponse{Key: key, Error: "Invalid type parameter. Supported types: string, int64"})
-			return
+			err = datastore.ErrWrongType
 		}
+	}
 
-		if err != nil {
-			if errors.Is(err, datastore.ErrNotFound) {
-				log.Printf("DB_SERVER: Key not found: %s", key)
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(DbResponse{Key: key, Error: "not found"})
-			} else if errors.Is(err, datastore.ErrWrongType) {
-				log.Printf("DB_SERVER: Wrong type for key: %s, requested type: %s", key, dataType)
-				w.WriteHeader(http.StatusBadRequest) // Або інший відповідний код
-				json.NewEncoder(w).Encode(DbResponse{Key: key, Error: err.Error()})
-			} else {
-				log.Printf("DB_SERVER: Failed to get value for key %s: %v", key, err)
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(DbResponse{Key: key, Error: err.Error()})
-			}
-			return
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			log.Printf("DB_SERVER: Key not found: %s", key)
+			writeJSON(w, http.StatusNotFound, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		} else if errors.Is(err, datastore.ErrWrongType) {
+			log.Printf("DB_SERVER: Wrong type for key: %s, requested type: %s", key, dataType)
+			writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		} else {
+			log.Printf("DB_SERVER: Failed to get value for key %s: %v", key, err)
+			writeJSON(w, http.StatusInternalServerError, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
 		}
-		log.Printf("DB_SERVER: Successfully retrieved key '%s', value: %v", key, value)
-		json.NewEncoder(w).Encode(DbResponse{Key: key, Value: value})
+		return
+	}
+	log.Printf("DB_SERVER: Successfully retrieved key '%s', value: %s", key, logPolicy.Value(key, value))
+	setETag(w, etag)
+	writeJSON(w, http.StatusOK, DbResponse{Key: key, Value: value})
+}
 
-	case http.MethodPost:
-		if key == "" {
-			http.Error(w, "Key is missing in URL path for POST request", http.StatusBadRequest)
-			return
+// getJSONField відповідає на GET /db/{key}?type=json&field=a.b лише вказаним полем документа.
+func getJSONField(w http.ResponseWriter, key, path string) {
+	field, err := db.GetJSONField(key, path)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, datastore.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, datastore.ErrWrongType):
+			status = http.StatusBadRequest
 		}
-		var requestBody struct {
-			Value interface{} `json:"value"`
+		log.Printf("DB_SERVER: Failed to get field '%s' of key %s: %v", path, key, err)
+		writeJSON(w, status, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Successfully retrieved field '%s' of key '%s'", path, key)
+	writeJSON(w, http.StatusOK, DbResponse{Key: key, Value: field})
+}
+
+// waitForChange реалізує довге опитування GET /db/{key}?wait=30s&last_seq=N: чекає, доки ключ
+// зміниться після last_seq (або з'явиться, якщо last_seq не задано). Якщо час очікування вичерпано,
+// відповідає 304 і повертає false, так само як і при помилці в параметрах.
+func waitForChange(w http.ResponseWriter, r *http.Request, key string) bool {
+	query := r.URL.Query()
+	wait, err := time.ParseDuration(query.Get("wait"))
+	if err != nil || wait <= 0 {
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Invalid wait parameter, expected a positive duration like 30s")})
+		return false
+	}
+	if wait > maxLongPollWait {
+		wait = maxLongPollWait
+	}
+	var lastSeq uint64
+	if raw := query.Get("last_seq"); raw != "" {
+		if lastSeq, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Invalid last_seq parameter")})
+			return false
+		}
+	} else {
+		if db.Exists(key) {
+			return true
 		}
+		lastSeq = db.KeySeq(key)
+	}
 
-		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			log.Printf("DB_SERVER: Failed to decode POST request body for key %s: %v", key, err)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(DbResponse{Key: key, Error: "Failed to decode request body: " + err.Error()})
-			return
+	log.Printf("DB_SERVER: Long-poll for key='%s', last_seq=%d, wait=%s", key, lastSeq, wait)
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	seq, err := db.WaitForChange(ctx, key, lastSeq)
+	if err != nil {
+		w.Header().Set(seqHeader, strconv.FormatUint(seq, 10))
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	return true
+}
+
+func putValueHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, DbResponse{ErrorInfo: requestError("Key is missing in URL path for POST request")})
+		return
+	}
+	var requestBody struct {
+		Value interface{} `json:"value"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		log.Printf("DB_SERVER: Failed to decode POST request body for key %s: %v", key, err)
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError("Failed to decode request body: " + err.Error())})
+		return
+	}
+	log.Printf("DB_SERVER: POST request for key='%s', value: %s (type: %T)", key, logPolicy.Value(key, requestBody.Value), requestBody.Value)
+
+	ifMatch := parseIfMatch(r.Header.Get("If-Match"))
+	if ifMatch != "" && !checkGeneration(w, r, key) {
+		return
+	}
+	var etag string
+	var putErr error
+	switch v := requestBody.Value.(type) {
+	case string:
+		if ifMatch != "" {
+			etag, putErr = db.PutIfMatch(key, v, ifMatch)
+		} else {
+			putErr = db.PutContext(r.Context(), key, v)
+			etag = datastore.ETag(v)
 		}
-		log.Printf("DB_SERVER: POST request for key='%s', value: %v (type: %T)", key, requestBody.Value, requestBody.Value)
-
-		var putErr error
-		switch v := requestBody.Value.(type) {
-		case string:
-			putErr = db.Put(key, v)
-		case float64:
-			putErr = db.PutInt64(key, int64(v))
-		case int:
-			putErr = db.PutInt64(key, int64(v))
-		case int64:
-			putErr = db.PutInt64(key, v)
-		default:
-			log.Printf("DB_SERVER: Invalid value type in POST request body for key %s: %T", key, requestBody.Value)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(DbResponse{Key: key, Error: fmt.Sprintf("Invalid value type in request body: %T. Supported: string, number (for int64)", requestBody.Value)})
+	case float64:
+		etag, putErr = putInt64(r.Context(), key, int64(v), ifMatch)
+	case map[string]interface{}, []interface{}:
+		etag, putErr = putJSON(r.Context(), key, v, ifMatch)
+	default:
+		log.Printf("DB_SERVER: Invalid value type in POST request body for key %s: %T", key, requestBody.Value)
+		writeJSON(w, http.StatusBadRequest, DbResponse{Key: key, ErrorInfo: requestError(fmt.Sprintf("Invalid value type in request body: %T. Supported: string, number (for int64), object or array (for json)", requestBody.Value))})
+		return
+	}
+
+	if errors.Is(putErr, datastore.ErrPreconditionFailed) {
+		log.Printf("DB_SERVER: If-Match %s does not match current version of key %s", ifMatch, key)
+		writeJSON(w, http.StatusPreconditionFailed, DbResponse{Key: key, ErrorInfo: newErrorInfo(datastore.CodePreconditionFailed, false, "value was modified, re-read it and retry")})
+		return
+	}
+	if putErr != nil {
+		log.Printf("DB_SERVER: Failed to put value for key %s: %v", key, putErr)
+		writeJSON(w, writeErrorStatus(putErr), DbResponse{Key: key, ErrorInfo: errorInfo(putErr)})
+		return
+	}
+	// durable=true - відповідати лише після скидання запису на диск.
+	if r.URL.Query().Get("durable") == "true" {
+		if err := db.Flush(); err != nil {
+			log.Printf("DB_SERVER: Failed to flush value for key %s: %v", key, err)
+			writeJSON(w, writeErrorStatus(err), DbResponse{Key: key, ErrorInfo: errorInfo(err)})
 			return
 		}
+	}
+	log.Printf("DB_SERVER: Successfully stored key '%s', value: %s", key, logPolicy.Value(key, requestBody.Value))
+	setETag(w, etag)
+	writeJSON(w, http.StatusCreated, DbResponse{Key: key, Value: requestBody.Value})
+}
+
+// putJSON записує об'єкт або масив як JSON-документ.
+func putJSON(ctx context.Context, key string, value interface{}, ifMatch string) (string, error) {
+	if ifMatch != "" {
+		return db.PutJSONIfMatch(key, value, ifMatch)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return datastore.ETag(json.RawMessage(data)), db.PutJSONContext(ctx, key, value)
+}
+
+func putInt64(ctx context.Context, key string, value int64, ifMatch string) (string, error) {
+	if ifMatch != "" {
+		return db.PutInt64IfMatch(key, value, ifMatch)
+	}
+	return datastore.ETag(value), db.PutInt64Context(ctx, key, value)
+}
+
+// parseIfMatch повертає ETag з заголовка If-Match без лапок та префікса слабкого ETag.
+func parseIfMatch(header string) string {
+	header = strings.TrimSpace(header)
+	if header == "" || header == datastore.AnyETag {
+		return header
+	}
+	header = strings.TrimPrefix(header, "W/")
+	return strings.Trim(header, `"`)
+}
+
+func setETag(w http.ResponseWriter, etag string) {
+	if etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+}
 
-		if putErr != nil {
-			log.Printf("DB_SERVER: Failed to put value for key %s: %v", key, putErr)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(DbResponse{Key: key, Error: putErr.Error()})
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		bulkDeleteHandler(w, r)
+		return
+	}
+	log.Printf("DB_SERVER: DELETE request for key='%s'", key)
+	if err := db.DeleteContext(r.Context(), key); err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, DbResponse{Key: key, ErrorInfo: errorInfo(err)})
 			return
 		}
-		log.Printf("DB_SERVER: Successfully stored key '%s', value: %v", key, requestBody.Value)
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(DbResponse{Key: key, Value: requestBody.Value})
+		log.Printf("DB_SERVER: Failed to delete key %s: %v", key, err)
+		writeJSON(w, writeErrorStatus(err), DbResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Successfully deleted key '%s'", key)
+	writeJSON(w, http.StatusOK, DbResponse{Key: key})
+}
 
-	default:
-		log.Printf("DB_SERVER: Method not allowed: %s", r.Method)
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(DbResponse{Error: "Method not allowed"})
+func bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	if prefix == "" {
+		writeBulkDeleteJSON(w, http.StatusBadRequest, BulkDeleteResponse{ErrorInfo: requestError("Query parameter 'prefix' is required for bulk delete")})
+		return
+	}
+	dryRun := query.Get("dry_run") == "true"
+
+	if dryRun {
+		keys := db.KeysWithPrefix(prefix)
+		log.Printf("DB_SERVER: Bulk DELETE dry run for prefix='%s' matched %d keys", prefix, len(keys))
+		writeBulkDeleteJSON(w, http.StatusOK, BulkDeleteResponse{Prefix: prefix, Count: len(keys), DryRun: true})
+		return
+	}
+	log.Printf("DB_SERVER: Bulk DELETE request for prefix='%s'", prefix)
+
+	// Без підтвердження ліміт перевіряє сама база під блокуванням запису, тож ключі,
+	// додані після підрахунку, не проходять повз поріг. Один запис видалення префікса
+	// замість надгробка на кожен ключ.
+	limit := 0
+	if r.Header.Get(confirmBulkDeleteHeader) != "true" {
+		limit = bulkDeleteConfirmThreshold - 1
+	}
+	deleted, err := db.DeletePrefixLimit(prefix, limit)
+	if errors.Is(err, datastore.ErrTooManyKeys) {
+		writeBulkDeleteJSON(w, http.StatusPreconditionRequired, BulkDeleteResponse{
+			Prefix: prefix,
+			Count:  deleted,
+			ErrorInfo: newErrorInfo(codeNeedsConfirm, false,
+				fmt.Sprintf("Deleting %d keys requires header %s: true", deleted, confirmBulkDeleteHeader)),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("DB_SERVER: Bulk delete for prefix '%s' failed: %v", prefix, err)
+		writeBulkDeleteJSON(w, http.StatusInternalServerError, BulkDeleteResponse{Prefix: prefix, Count: deleted, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Bulk delete for prefix '%s' removed %d keys", prefix, deleted)
+	writeBulkDeleteJSON(w, http.StatusOK, BulkDeleteResponse{Prefix: prefix, Count: deleted})
+}
+
+func writeBulkDeleteJSON(w http.ResponseWriter, status int, resp BulkDeleteResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readyHandler повідомляє, що база відкрита, її фонові горутини працюють, запис не завис
+// і сервер готовий приймати запити.
+func readyHandler(w http.ResponseWriter, _ *http.Request) {
+	if db == nil {
+		writeJSON(w, http.StatusServiceUnavailable, DbResponse{ErrorInfo: newErrorInfo(codeNotReady, true, "database is not initialized")})
+		return
+	}
+	if err := db.Err(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, DbResponse{ErrorInfo: newErrorInfo(datastore.CodeInternal, true, err.Error())})
+		return
+	}
+	if !db.Healthy() {
+		writeJSON(w, http.StatusServiceUnavailable, DbResponse{ErrorInfo: newErrorInfo(datastore.CodeWriteTimeout, true, "database writer is stuck")})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HealthResponse - відповідь GET /health
+type HealthResponse struct {
+	Status   string          `json:"status"`
+	Snapshot *SnapshotStatus `json:"snapshot,omitempty"`
+	// Drain - стан завершення роботи; є лише після сигналу зупинки.
+	Drain *DrainStatus `json:"drain,omitempty"`
+}
+
+// healthHandler повідомляє стан бази та останнього знімка.
+func healthHandler(w http.ResponseWriter, _ *http.Request) {
+	resp := HealthResponse{Status: "ok"}
+	status := http.StatusOK
+	if db == nil || !db.Healthy() {
+		resp.Status = "unhealthy"
+		status = http.StatusServiceUnavailable
 	}
+	if resp.Drain = drain.status(); resp.Drain != nil {
+		resp.Status = "draining"
+		status = http.StatusServiceUnavailable
+	}
+	if snapshots != nil {
+		snapshotStatus := snapshots.currentStatus()
+		resp.Snapshot = &snapshotStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// statsHandler повертає статистику сховища для планування ємності.
+func statsHandler(w http.ResponseWriter, _ *http.Request) {
+	stats, err := db.Stats()
+	if err != nil {
+		log.Printf("DB_SERVER: Failed to collect stats: %v", err)
+		writeJSON(w, http.StatusInternalServerError, DbResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DB_SERVER: Method not allowed: %s", r.Method)
+	writeJSON(w, http.StatusMethodNotAllowed, DbResponse{ErrorInfo: newErrorInfo(codeNotAllowed, false, "Method not allowed")})
+}
+
+func newRouter() http.Handler {
+	dbMux := http.NewServeMux()
+	dbMux.HandleFunc("GET /db/{key...}", getValueHandler)
+	dbMux.HandleFunc("GET /db/_aggregate", aggregateHandler)
+	dbMux.HandleFunc("GET /db/_int64_range", int64RangeHandler)
+	dbMux.HandleFunc("GET /db/_scan", scanHandler)
+	dbMux.HandleFunc("GET /db/{key}/series", getSeriesHandler)
+	dbMux.HandleFunc("POST /db/{key}/series", appendSeriesHandler)
+	dbMux.HandleFunc("POST /db/{key}/copy", copyHandler)
+	dbMux.HandleFunc("POST /db/_read_snapshot", readSnapshotHandler)
+	dbMux.HandleFunc("POST /db/{key...}", putValueHandler)
+	dbMux.HandleFunc("PUT /db/{key...}", putValueHandler)
+	dbMux.HandleFunc("DELETE /db/{key...}", deleteHandler)
+	dbMux.HandleFunc("/db/{key...}", methodNotAllowedHandler)
+
+	mux := http.NewServeMux()
+	mux.Handle("/db/", usage.Middleware(dbMux))
+	mux.Handle("GET /admin/usage", adminAuth(usage))
+	mux.HandleFunc("GET /ready", readyHandler)
+	mux.HandleFunc("GET /health", healthHandler)
+	mux.Handle("GET /admin/stats", adminAuth(http.HandlerFunc(statsHandler)))
+	mux.Handle("GET /admin/slowlog", adminAuth(slowLog))
+	mux.Handle("GET /admin/log-policy", adminAuth(logPolicy))
+	mux.Handle("PUT /admin/log-policy", adminAuth(http.HandlerFunc(putLogPolicyHandler)))
+	mux.Handle("GET /admin/segments", adminAuth(http.HandlerFunc(listSegmentsHandler)))
+	mux.Handle("GET /admin/segments/{id}", adminAuth(http.HandlerFunc(downloadSegmentHandler)))
+	mux.Handle("POST /admin/compact", adminAuth(http.HandlerFunc(compactHandler)))
+	mux.Handle("POST /admin/rotate", adminAuth(http.HandlerFunc(rotateHandler)))
+	mux.Handle("GET /admin/migrations", adminAuth(http.HandlerFunc(migrationsHandler)))
+	mux.Handle("GET /admin/verify", adminAuth(http.HandlerFunc(verifyHandler)))
+	mux.Handle("GET /admin/changes", adminAuth(http.HandlerFunc(changesHandler)))
+	return httptools.Chain(mux, generationMiddleware, drain.Middleware, slowLog.Middleware("DB_SERVER"), httptools.Recoverer("DB_SERVER"), httptools.PrettyJSON(debugMode))
 }
 
 func main() {
-	dbDir := os.Getenv("DB_DIR")
+	flag.Parse()
+	if *selfTest {
+		os.Exit(runSelfTest())
+	}
+
+	dbDir := config.Getenv("DB_DIR")
 	if dbDir == "" {
 		dbDir = "./database_data"
 	}
+	port := config.Getenv("DB_PORT")
+	if port == "" {
+		port = "8081"
+	}
+	switch *engine {
+	case engineFile:
+	case engineMemory:
+		serveMemory(port)
+		return
+	default:
+		log.Fatalf("DB_SERVER: Unknown storage engine %q, expected %s or %s", *engine, engineFile, engineMemory)
+	}
+	opts, err := checkStartup(dbDir, port)
+	if err != nil {
+		log.Fatalf("DB_SERVER: Refusing to start: %v", err)
+	}
 	log.Printf("DB_SERVER: Initializing database in directory: %s", dbDir)
 
-	var err error
-	db, err = datastore.NewDb(dbDir)
+	usage = newUsageTracker(quotaLimitsFromEnv())
+	if slowLog, err = httptools.NewSlowLogFromEnv(); err != nil {
+		log.Fatalf("DB_SERVER: Failed to configure slow request log: %v", err)
+	}
+	policy, err := logPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("DB_SERVER: Failed to configure log policy: %v", err)
+	}
+	logPolicy.Set(policy)
+	if path := config.Getenv("DB_LOG_POLICY"); path != "" {
+		logPolicy.ReloadOnSignal(path, "DB_SERVER")
+	}
+
+	if restoreFrom := config.Getenv("DB_RESTORE_FROM"); restoreFrom != "" {
+		restored, err := restoreIfEmpty(context.Background(), dbDir, restoreFrom)
+		if err != nil {
+			log.Fatalf("DB_SERVER: Failed to restore from snapshot %s: %v", redactURL(restoreFrom), err)
+		}
+		if restored {
+			log.Printf("DB_SERVER: Restored database from snapshot %s", redactURL(restoreFrom))
+		}
+	}
+
+	db, err = datastore.NewDbWithOptions(dbDir, opts)
 	if err != nil {
 		log.Fatalf("DB_SERVER: Failed to initialize database: %v", err)
 	}
-	defer func() {
-		log.Println("DB_SERVER: Closing database...")
-		if errClose := db.Close(); errClose != nil {
-			log.Printf("DB_SERVER: Error closing database: %v", errClose)
+	for _, m := range db.Migrations() {
+		if m.AppliedAt == nil {
+			log.Printf("DB_SERVER: Migration %s is pending (-no-migrate)", m.Name)
 		}
-		log.Println("DB_SERVER: Database closed.")
-	}()
+	}
 
-	http.HandleFunc("/db/", dbHandler)
+	snapshots, err = newSnapshotScheduler(snapshotConfigFromEnv())
+	if err != nil {
+		log.Fatalf("DB_SERVER: Failed to configure snapshots: %v", err)
+	}
+	snapshotCtx, stopSnapshots := context.WithCancel(context.Background())
+	defer stopSnapshots()
+	if snapshots != nil {
+		log.Printf("DB_SERVER: Taking snapshots on schedule %q", snapshots.cfg.Schedule)
+		go snapshots.run(snapshotCtx)
+	}
 
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "8081"
+	drainDelay, err := durationFromEnv("DB_DRAIN_DELAY", 0)
+	if err != nil {
+		log.Fatalf("DB_SERVER: Invalid DB_DRAIN_DELAY: %v", err)
+	}
+	drainTimeout, err := durationFromEnv("DB_SHUTDOWN_TIMEOUT", shutdownTimeout)
+	if err != nil {
+		log.Fatalf("DB_SERVER: Invalid DB_SHUTDOWN_TIMEOUT: %v", err)
 	}
+
 	log.Printf("DB_SERVER: Starting database server on port %s...", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("DB_SERVER: Failed to start DB server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: newRouter()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("DB_SERVER: Failed to start DB server: %v", err)
+		}
+	}()
+
+	signal.WaitForTerminationSignal()
+	shutdown(server, drainDelay, drainTimeout)
+}
+
+// shutdown завершує роботу сервера: протягом delay /health вже відповідає "draining",
+// але нові запити ще приймаються, щоб балансувальник встиг вивести сервер з ротації.
+// Далі сервер чекає на запити, що виконуються, і записи в черзі не довше timeout;
+// записи, що не встигли виконатися, відхиляються з кодом shutting_down.
+func shutdown(server *http.Server, delay, timeout time.Duration) {
+	drain.begin()
+	log.Printf("DB_SERVER: Shutting down: draining %d active requests and %d queued puts (deadline %s)",
+		drain.active.Load(), db.QueuedPuts(), delay+timeout)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("DB_SERVER: HTTP server shutdown stopped with %d active requests: %v", drain.active.Load(), err)
+	}
+	report, err := db.Shutdown(ctx)
+	if err != nil {
+		log.Printf("DB_SERVER: Error closing database: %v", err)
+	}
+	if report.FailedPuts > 0 {
+		log.Printf("DB_SERVER: Shutdown deadline reached, failed %d of %d queued puts", report.FailedPuts, report.QueuedPuts)
 	}
+	log.Printf("DB_SERVER: Drain finished in %s: %d active requests left, %d queued puts written, %d failed",
+		drain.finish().Round(time.Millisecond), drain.active.Load(), report.QueuedPuts-report.FailedPuts, report.FailedPuts)
 }
@@ -0,0 +1,1051 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "db-server-test")
+	if err != nil {
+		panic(err)
+	}
+	db, err = datastore.NewDb(dir)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = db.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func doRequest(t *testing.T, handler http.Handler, method, target string, body interface{}) (*httptest.ResponseRecorder, DbResponse) {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &reqBody)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp DbResponse
+	if rec.Header().Get("Content-Type") == "application/json" {
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	}
+	return rec, resp
+}
+
+func TestRouter_PutAndGet(t *testing.T) {
+	router := newRouter()
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/router-key", map[string]interface{}{"value": "router-value"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST returned %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	rec, resp := doRequest(t, router, http.MethodGet, "/db/router-key", nil)
+	if rec.Code != http.StatusOK || resp.Value != "router-value" {
+		t.Errorf("GET returned %d with %+v", rec.Code, resp)
+	}
+
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/router-int", map[string]interface{}{"value": 42})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST int returned %d, want %d", rec.Code, http.StatusCreated)
+	}
+	rec, resp = doRequest(t, router, http.MethodGet, "/db/router-int?type=int64", nil)
+	if rec.Code != http.StatusOK || resp.Value != float64(42) {
+		t.Errorf("GET int returned %d with %+v", rec.Code, resp)
+	}
+}
+
+func TestRouter_DurablePut(t *testing.T) {
+	router := newRouter()
+	rec, _ := doRequest(t, router, http.MethodPut, "/db/durable-key?durable=true", map[string]interface{}{"value": "durable-value"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("durable PUT returned %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if value, err := db.Get("durable-key"); err != nil || value != "durable-value" {
+		t.Errorf("Get after durable PUT = %q, %v", value, err)
+	}
+}
+
+func TestRouter_Errors(t *testing.T) {
+	router := newRouter()
+
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/missing-key", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing key returned %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET without key returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/some-key?type=float", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET with bad type returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec, resp := doRequest(t, router, http.MethodPatch, "/db/some-key", nil); rec.Code != http.StatusMethodNotAllowed || resp.Error == "" {
+		t.Errorf("PATCH returned %d with %+v, want %d", rec.Code, resp, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRouter_DeleteByPrefix(t *testing.T) {
+	router := newRouter()
+	for _, key := range []string{"tmp_a", "tmp_b", "keep_c"} {
+		if rec, _ := doRequest(t, router, http.MethodPost, "/db/"+key, map[string]interface{}{"value": "v"}); rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s returned %d", key, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/db/?prefix=tmp_&dry_run=true", nil))
+	var bulkResp BulkDeleteResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &bulkResp)
+	if rec.Code != http.StatusOK || bulkResp.Count != 2 || !bulkResp.DryRun {
+		t.Fatalf("dry run returned %d with %+v", rec.Code, bulkResp)
+	}
+	if _, err := db.Get("tmp_a"); err != nil {
+		t.Fatal("dry run must not delete keys")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/db/?prefix=tmp_", nil))
+	bulkResp = BulkDeleteResponse{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &bulkResp)
+	if rec.Code != http.StatusOK || bulkResp.Count != 2 {
+		t.Fatalf("bulk delete returned %d with %+v", rec.Code, bulkResp)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/tmp_a", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted key is still readable: %d", rec.Code)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/keep_c", nil); rec.Code != http.StatusOK {
+		t.Errorf("key outside prefix was affected: %d", rec.Code)
+	}
+
+	if rec, _ := doRequest(t, router, http.MethodDelete, "/db/keep_c", nil); rec.Code != http.StatusOK {
+		t.Errorf("single DELETE returned %d", rec.Code)
+	}
+	if rec, _ := doRequest(t, router, http.MethodDelete, "/db/keep_c", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("repeated DELETE returned %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRouter_DeleteByPrefixRequiresConfirmation(t *testing.T) {
+	router := newRouter()
+	for i := 0; i < bulkDeleteConfirmThreshold; i++ {
+		if err := db.Put(fmt.Sprintf("bulk_%03d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/db/?prefix=bulk_", nil))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("large bulk delete without confirmation returned %d, want %d", rec.Code, http.StatusPreconditionRequired)
+	}
+	var resp BulkDeleteResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Count != bulkDeleteConfirmThreshold {
+		t.Errorf("unconfirmed bulk delete reported count %d (%v), want %d", resp.Count, err, bulkDeleteConfirmThreshold)
+	}
+	if keys := db.KeysWithPrefix("bulk_"); len(keys) != bulkDeleteConfirmThreshold {
+		t.Fatalf("unconfirmed bulk delete removed keys, %d remain", len(keys))
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/db/?prefix=bulk_", nil)
+	req.Header.Set(confirmBulkDeleteHeader, "true")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirmed bulk delete returned %d", rec.Code)
+	}
+	if keys := db.KeysWithPrefix("bulk_"); len(keys) != 0 {
+		t.Errorf("expected all bulk_ keys to be deleted, %d remain", len(keys))
+	}
+}
+
+func TestRouter_IfMatch(t *testing.T) {
+	router := newRouter()
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/etag-key", map[string]interface{}{"value": "first"})
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusCreated || etag == "" {
+		t.Fatalf("POST returned %d with ETag %q", rec.Code, etag)
+	}
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/etag-key", nil)
+	if got := rec.Header().Get("ETag"); got != etag {
+		t.Errorf("GET ETag %q differs from POST ETag %q", got, etag)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"value": "second"})
+	req := httptest.NewRequest(http.MethodPut, "/db/etag-key", bytes.NewReader(body))
+	req.Header.Set("If-Match", etag)
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, req)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("PUT with current ETag returned %d", first.Code)
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{"value": "third"})
+	req = httptest.NewRequest(http.MethodPost, "/db/etag-key", bytes.NewReader(body))
+	req.Header.Set("If-Match", etag)
+	stale := httptest.NewRecorder()
+	router.ServeHTTP(stale, req)
+	if stale.Code != http.StatusPreconditionFailed {
+		t.Errorf("POST with stale ETag returned %d, want %d", stale.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestRouter_Generation(t *testing.T) {
+	router := newRouter()
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/generation-key", map[string]interface{}{"value": "first"})
+	generation := rec.Header().Get(generationHeader)
+	if generation == "" || generation != db.Generation() {
+		t.Fatalf("POST returned generation %q, want %q", generation, db.Generation())
+	}
+	etag := rec.Header().Get("ETag")
+
+	put := func(seen string) int {
+		body, _ := json.Marshal(map[string]interface{}{"value": "second"})
+		req := httptest.NewRequest(http.MethodPut, "/db/generation-key", bytes.NewReader(body))
+		req.Header.Set("If-Match", etag)
+		req.Header.Set(generationHeader, seen)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := put("restored-from-elsewhere"); code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match from another generation returned %d, want %d", code, http.StatusPreconditionFailed)
+	}
+	if code := put(generation); code != http.StatusCreated {
+		t.Errorf("If-Match from the current generation returned %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestRouter_PrettyJSON(t *testing.T) {
+	if err := db.Put("pretty-key", "v"); err != nil {
+		t.Fatal(err)
+	}
+	prevDebug := debugMode
+	defer func() { debugMode = prevDebug }()
+
+	for _, debug := range []bool{false, true} {
+		debugMode = debug
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/pretty-key?pretty=1", nil))
+		indented := bytes.Contains(rec.Body.Bytes(), []byte("\n  \"key\""))
+		if indented != debug {
+			t.Errorf("debug=%t: unexpected body %q", debug, rec.Body.String())
+		}
+	}
+}
+
+func TestRunSelfTest(t *testing.T) {
+	if code := runSelfTest(); code != 0 {
+		t.Errorf("self-test exited with %d", code)
+	}
+}
+
+func TestRouter_LongPoll(t *testing.T) {
+	router := newRouter()
+
+	rec, _ := doRequest(t, router, http.MethodGet, "/db/poll-key?wait=50ms", nil)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("long-poll on missing key returned %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = db.Put("poll-key", "ready")
+	}()
+	rec, resp := doRequest(t, router, http.MethodGet, "/db/poll-key?wait=2s", nil)
+	if rec.Code != http.StatusOK || resp.Value != "ready" {
+		t.Fatalf("long-poll returned %d with %+v", rec.Code, resp)
+	}
+	seq := rec.Header().Get(seqHeader)
+
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/poll-key?wait=50ms&last_seq="+seq, nil)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("long-poll with current last_seq returned %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/poll-key?wait=bogus", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid wait returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRouter_Series(t *testing.T) {
+	router := newRouter()
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/metric/series", map[string]interface{}{"ts": 1000, "value": 5})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("append returned %d: %s", rec.Code, rec.Body.String())
+	}
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/metric/series", map[string]interface{}{
+		"points": []map[string]int64{{"ts": 2000, "value": 6}, {"ts": 3000, "value": 7}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("batch append returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/metric/series?from=1500&to=3000", nil)
+	var resp SeriesResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Points) != 2 || resp.Points[0].Value != 6 {
+		t.Errorf("range query returned %d with %+v", rec.Code, resp)
+	}
+
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/missing-metric/series", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing series returned %d", rec.Code)
+	}
+}
+
+func TestRouter_Aggregate(t *testing.T) {
+	router := newRouter()
+	for i, v := range []int64{3, 9, 6} {
+		if err := db.PutInt64(fmt.Sprintf("agg_%d", i), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for op, want := range map[string]float64{"sum": 18, "min": 3, "max": 9, "avg": 6, "count": 3} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_aggregate?prefix=agg_&op="+op, nil))
+		var resp AggregateResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if rec.Code != http.StatusOK || resp.Value != want {
+			t.Errorf("op=%s returned %d with %+v, want value %v", op, rec.Code, resp, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_aggregate?prefix=agg_&op=median", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown op returned %d", rec.Code)
+	}
+}
+
+func TestRouter_Int64Range(t *testing.T) {
+	router := newRouter()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_int64_range?min=0&max=10", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("range query without the index returned %d, want 501", rec.Code)
+	}
+
+	opts := datastore.DefaultOptions()
+	opts.IndexInt64Values = true
+	indexed, err := datastore.NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = indexed
+	t.Cleanup(func() {
+		db = prev
+		_ = indexed.Close()
+	})
+	for key, v := range map[string]int64{"low": 1, "mid": 5, "high": 50} {
+		if err := db.PutInt64(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_int64_range?min=0&max=10", nil))
+	var resp Int64RangeResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	want := []Int64RangeItem{{Key: "low", Value: 1}, {Key: "mid", Value: 5}}
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(resp.Items, want) {
+		t.Errorf("range query returned %d with %+v, want %v", rec.Code, resp.Items, want)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_int64_range?min=10&max=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("range query with min > max returned %d", rec.Code)
+	}
+}
+
+func TestRouter_Scan(t *testing.T) {
+	router := newRouter()
+	for i := 0; i < 5; i++ {
+		if err := db.PutInt64(fmt.Sprintf("~scan%d", i), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ключі з "~" сортуються після ключів інших тестів, тож зворотний обхід починається з них.
+	var keys []string
+	cursor := ""
+	for {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db/_scan?reverse=true&limit=2&cursor="+cursor, nil))
+		var resp ScanResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("scan returned %d: %s", rec.Code, rec.Body.String())
+		}
+		for _, e := range resp.Entries {
+			if strings.HasPrefix(e.Key, "~scan") && e.Type != "int64" {
+				t.Errorf("entry %s has type %q", e.Key, e.Type)
+			}
+			keys = append(keys, e.Key)
+		}
+		if resp.NextCursor == "" || len(keys) >= 5 {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	if got := strings.Join(keys[:5], ","); got != "~scan4,~scan3,~scan2,~scan1,~scan0" {
+		t.Errorf("reverse scan = %s", got)
+	}
+
+	for _, target := range []string{"/db/_scan?limit=0", "/db/_scan?cursor=forged"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s returned %d, want 400", target, rec.Code)
+		}
+	}
+}
+
+func TestRouter_ErrorTaxonomy(t *testing.T) {
+	router := newRouter()
+	if err := db.PutInt64("taxonomy-int", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		target        string
+		wantStatus    int
+		wantCode      string
+		wantRetryable bool
+	}{
+		{"/db/taxonomy-missing", http.StatusNotFound, datastore.CodeNotFound, false},
+		{"/db/taxonomy-int", http.StatusBadRequest, datastore.CodeWrongType, false},
+		{"/db/taxonomy-int?type=float", http.StatusBadRequest, codeBadRequest, false},
+	}
+	for _, tc := range testCases {
+		rec, resp := doRequest(t, router, http.MethodGet, tc.target, nil)
+		if rec.Code != tc.wantStatus || resp.Code != tc.wantCode || resp.Retryable == nil || *resp.Retryable != tc.wantRetryable {
+			t.Errorf("%s: got %d %+v", tc.target, rec.Code, resp)
+		}
+		if rec.Header().Get(retryableHeader) != "false" {
+			t.Errorf("%s: expected %s: false header", tc.target, retryableHeader)
+		}
+	}
+}
+
+func TestRouter_Stats(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+
+	for _, target := range []string{"/admin/stats", "/admin/slowlog"} {
+		if rec, _ := doRequest(t, router, http.MethodGet, target, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s without token returned %d, want %d", target, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/slowlog", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /admin/slowlog returned %d: %s", rec.Code, rec.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var stats datastore.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/stats returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if stats.SegmentCount == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestRouter_Copy(t *testing.T) {
+	router := newRouter()
+	if err := db.Put("copy-src", "payload"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/copy-src/copy", map[string]interface{}{"to": "copy-dst", "ttl": "1h"})
+	var resp CopyResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusCreated || resp.ExpiresAt == nil {
+		t.Fatalf("copy returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec, got := doRequest(t, router, http.MethodGet, "/db/copy-dst", nil); rec.Code != http.StatusOK || got.Value != "payload" {
+		t.Errorf("GET copy returned %d with %+v", rec.Code, got)
+	}
+
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/copy-src/copy", map[string]interface{}{"to": "copy-dst"})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("copy onto existing key returned %d, want %d", rec.Code, http.StatusConflict)
+	}
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/copy-src/copy", map[string]interface{}{"to": "copy-dst", "overwrite": true})
+	if rec.Code != http.StatusCreated {
+		t.Errorf("copy with overwrite returned %d", rec.Code)
+	}
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/copy-src/copy", map[string]interface{}{"to": "other", "ttl": "soon"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("copy with invalid ttl returned %d", rec.Code)
+	}
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/copy-missing/copy", map[string]interface{}{"to": "other"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("copy of missing key returned %d", rec.Code)
+	}
+}
+
+func TestRouter_GetCoerce(t *testing.T) {
+	router := newRouter()
+	if err := db.PutInt64("coerce-int", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("coerce-str", "12"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("coerce-text", "twelve"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/coerce-int", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET int64 as string without coerce returned %d", rec.Code)
+	}
+	if rec, resp := doRequest(t, router, http.MethodGet, "/db/coerce-int?coerce=true", nil); rec.Code != http.StatusOK || resp.Value != "7" {
+		t.Errorf("GET int64 with coerce returned %d with %+v", rec.Code, resp)
+	}
+	if rec, resp := doRequest(t, router, http.MethodGet, "/db/coerce-str?type=int64&coerce=true", nil); rec.Code != http.StatusOK || resp.Value != float64(12) {
+		t.Errorf("GET numeric string as int64 with coerce returned %d with %+v", rec.Code, resp)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/coerce-text?type=int64&coerce=true", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET non-numeric string as int64 with coerce returned %d", rec.Code)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/coerce-int?coerce=maybe", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET with invalid coerce returned %d", rec.Code)
+	}
+}
+
+func TestRouter_ReadSnapshot(t *testing.T) {
+	router := newRouter()
+	if err := db.Put("snap-a", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("snap-b", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/_read_snapshot", map[string]interface{}{"keys": []string{"snap-a", "snap-b", "snap-missing"}})
+	var resp ReadSnapshotResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("read snapshot returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Seq == 0 || resp.Values["snap-a"] != "first" || resp.Values["snap-b"] != float64(2) {
+		t.Errorf("unexpected snapshot %+v", resp)
+	}
+	if value, ok := resp.Values["snap-missing"]; !ok || value != nil {
+		t.Errorf("missing key should be present as null, got %v (%v)", value, ok)
+	}
+	if _, err := db.Get("_read_snapshot"); err == nil {
+		t.Errorf("snapshot read must not be routed as a put")
+	}
+
+	rec, _ = doRequest(t, router, http.MethodPost, "/db/_read_snapshot", map[string]interface{}{"keys": []string{}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("snapshot read without keys returned %d", rec.Code)
+	}
+}
+
+func TestRouter_AdminSegments(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+
+	adminToken = ""
+	if rec, _ := doRequest(t, router, http.MethodGet, "/admin/segments", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("segments without configured token returned %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	adminToken = "admin-secret"
+	if rec, _ := doRequest(t, router, http.MethodGet, "/admin/segments", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("segments without token returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	adminRequest := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := adminRequest("/admin/segments")
+	var segments []datastore.SegmentInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &segments); err != nil || rec.Code != http.StatusOK || len(segments) == 0 {
+		t.Fatalf("segments returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = adminRequest(fmt.Sprintf("/admin/segments/%d", segments[0].ID))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("download returned %d (%s)", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get("Content-Length") != fmt.Sprint(rec.Body.Len()) {
+		t.Errorf("Content-Length %s does not match body of %d bytes", rec.Header().Get("Content-Length"), rec.Body.Len())
+	}
+	if rec := adminRequest("/admin/segments/9999"); rec.Code != http.StatusNotFound {
+		t.Errorf("download of missing segment returned %d", rec.Code)
+	}
+	if rec := adminRequest("/admin/segments/abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("download with bad id returned %d", rec.Code)
+	}
+}
+
+func TestRouter_AdminCompact(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+
+	if rec, _ := doRequest(t, router, http.MethodPost, "/admin/compact", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("compact without token returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/admin/compact", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var report datastore.CompactionReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("compact returned %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_AdminRotate(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+
+	if rec, _ := doRequest(t, router, http.MethodPost, "/admin/rotate", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("rotate without token returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	doRequest(t, router, http.MethodPost, "/db/rotate-key", map[string]interface{}{"value": "v"})
+	req := httptest.NewRequest(http.MethodPost, "/admin/rotate", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var resp RotateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || len(resp.Sealed) != 1 {
+		t.Fatalf("rotate returned %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_AdminVerify(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+
+	if rec, _ := doRequest(t, router, http.MethodGet, "/admin/verify", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify without token returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	doRequest(t, router, http.MethodPost, "/db/verify-key", map[string]interface{}{"value": "v"})
+	req := httptest.NewRequest(http.MethodGet, "/admin/verify", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var report datastore.VerifyReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("verify returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if !report.OK() || report.IndexEntries == 0 {
+		t.Errorf("verify of a healthy database returned %+v", report)
+	}
+}
+
+func TestRouter_JSONDocument(t *testing.T) {
+	router := newRouter()
+	doc := map[string]interface{}{"name": "duo", "members": []interface{}{"a", "b"}}
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/json-doc", map[string]interface{}{"value": doc})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST object returned %d: %s", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+
+	rec, resp := doRequest(t, router, http.MethodGet, "/db/json-doc?type=json", nil)
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(resp.Value, doc) || rec.Header().Get("ETag") != etag {
+		t.Errorf("GET document returned %d with %+v and ETag %q, want %q", rec.Code, resp, rec.Header().Get("ETag"), etag)
+	}
+	if rec, resp := doRequest(t, router, http.MethodGet, "/db/json-doc?type=json&field=members.1", nil); rec.Code != http.StatusOK || resp.Value != "b" {
+		t.Errorf("GET field returned %d with %+v", rec.Code, resp)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/json-doc?type=json&field=age", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing field returned %d", rec.Code)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/json-doc?field=name", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET field without type=json returned %d", rec.Code)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/json-doc", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET document as string returned %d", rec.Code)
+	}
+}
+
+func TestHealth_Draining(t *testing.T) {
+	defer func(d *drainTracker) { drain = d }(drain)
+	drain = &drainTracker{}
+	router := newRouter()
+
+	if rec, _ := doRequest(t, router, http.MethodGet, "/health", nil); rec.Code != http.StatusOK {
+		t.Fatalf("health before shutdown returned %d", rec.Code)
+	}
+	drain.begin()
+	rec, _ := doRequest(t, router, http.MethodGet, "/health", nil)
+	var health HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || health.Status != "draining" || health.Drain == nil {
+		t.Fatalf("health while draining returned %d: %s", rec.Code, rec.Body.String())
+	}
+	// Сам запит /health теж враховується серед активних.
+	if health.Drain.ActiveRequests != 1 || health.Drain.Done {
+		t.Errorf("drain status = %+v, want 1 active request", *health.Drain)
+	}
+	drain.finish()
+	rec, _ = doRequest(t, router, http.MethodGet, "/health", nil)
+	health = HealthResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil || health.Drain == nil || !health.Drain.Done {
+		t.Errorf("health after drain returned %s", rec.Body.String())
+	}
+}
+
+func TestRouter_AdminChanges(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+	adminRequest := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	since := db.LastSeq()
+	for _, key := range []string{"changes-a", "changes-b"} {
+		if rec, _ := doRequest(t, router, http.MethodPost, "/db/"+key, map[string]interface{}{"value": key}); rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s returned %d", key, rec.Code)
+		}
+	}
+	rec := adminRequest(fmt.Sprintf("/admin/changes?since=%d", since))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("changes returned %d (%s): %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	dec := json.NewDecoder(rec.Body)
+	var keys []string
+	for dec.More() {
+		var c datastore.Change
+		if err := dec.Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, c.Value.Key)
+	}
+	if fmt.Sprint(keys) != "[changes-a changes-b]" {
+		t.Errorf("changes returned keys %v", keys)
+	}
+	if got := rec.Result().Trailer.Get(lastSeqTrailer); got != fmt.Sprint(db.LastSeq()) {
+		t.Errorf("%s trailer = %q, want %d", lastSeqTrailer, got, db.LastSeq())
+	}
+
+	if rec := adminRequest(fmt.Sprintf("/admin/changes?since=%d", db.LastSeq()+1)); rec.Code != http.StatusConflict {
+		t.Errorf("changes ahead of the database returned %d", rec.Code)
+	}
+	if rec := adminRequest("/admin/changes"); rec.Code != http.StatusBadRequest {
+		t.Errorf("changes without since returned %d", rec.Code)
+	}
+}
+
+func TestRouter_AdminLogPolicy(t *testing.T) {
+	router := newRouter()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+	defer func(policy logpolicy.Policy) { logPolicy.Set(policy) }(logPolicy.Policy())
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/log-policy", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put(`{"default": {"action": "show"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid policy returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec := put(`{"default": {"action": "omit"}, "rules": [{"prefix": "public:", "action": "full"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := logPolicy.Value("secret", "v"); got != "<omitted>" {
+		t.Errorf("secret value logged as %q", got)
+	}
+	if got := logPolicy.Value("public:name", "v"); got != "v" {
+		t.Errorf("public value logged as %q", got)
+	}
+
+	entries, err := db.AuditLog(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outcomes []string
+	for _, entry := range entries {
+		if entry.Op == auditLogPolicy {
+			outcomes = append(outcomes, entry.Outcome)
+		}
+	}
+	if !reflect.DeepEqual(outcomes, []string{"error", "ok"}) {
+		t.Errorf("audit outcomes %v", outcomes)
+	}
+}
+
+func TestDatastoreOptionsFromEnv_Profile(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	opts, err := datastoreOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxFileSize != 65536 || opts.SyncPolicy != datastore.SyncNever {
+		t.Errorf("dev profile gave MaxFileSize %d, SyncPolicy %d", opts.MaxFileSize, opts.SyncPolicy)
+	}
+
+	t.Setenv("APP_ENV", "prod")
+	t.Setenv("DB_MAX_FILE_SIZE", "1024")
+	if opts, err = datastoreOptionsFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxFileSize != 1024 || opts.SyncPolicy != datastore.SyncEveryInterval || opts.SyncInterval != time.Second {
+		t.Errorf("prod profile with DB_MAX_FILE_SIZE gave %d, %d, %v", opts.MaxFileSize, opts.SyncPolicy, opts.SyncInterval)
+	}
+
+	t.Setenv("DB_SYNC_POLICY", "sometimes")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("invalid DB_SYNC_POLICY was accepted")
+	}
+	t.Setenv("DB_SYNC_POLICY", "")
+	t.Setenv("DB_OPEN_MODE", "repair")
+	if opts, err = datastoreOptionsFromEnv(); err != nil || opts.OpenMode != datastore.OpenRepair {
+		t.Errorf("DB_OPEN_MODE=repair gave %d, %v", opts.OpenMode, err)
+	}
+	t.Setenv("DB_OPEN_MODE", "lenient")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("invalid DB_OPEN_MODE was accepted")
+	}
+}
+
+func TestDatastoreOptionsFromEnv_Quotas(t *testing.T) {
+	t.Setenv("DB_MAX_KEYS", "1000")
+	t.Setenv("DB_MAX_DISK_BYTES", "1048576")
+	t.Setenv("DB_CACHE_BUDGET_BYTES", "65536")
+	opts, err := datastoreOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MaxKeys != 1000 || opts.MaxDiskBytes != 1<<20 || opts.CacheBudgetBytes != 1<<16 {
+		t.Errorf("limits from env = %d keys, %d bytes, cache budget %d", opts.MaxKeys, opts.MaxDiskBytes, opts.CacheBudgetBytes)
+	}
+	if writeErrorStatus(fmt.Errorf("put: %w", datastore.ErrQuotaExceeded)) != http.StatusInsufficientStorage {
+		t.Error("quota error is not reported as 507")
+	}
+
+	t.Setenv("DB_MAX_KEYS", "-1")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("negative DB_MAX_KEYS was accepted")
+	}
+}
+
+func TestDatastoreOptionsFromEnv_SlowOpThreshold(t *testing.T) {
+	opts, err := datastoreOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.SlowOpThreshold != 0 || opts.OnSlowOp != nil {
+		t.Error("slow operation logging is enabled by default")
+	}
+	t.Setenv("DB_SLOW_OP_THRESHOLD", "250ms")
+	if opts, err = datastoreOptionsFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.SlowOpThreshold != 250*time.Millisecond || opts.OnSlowOp == nil {
+		t.Errorf("DB_SLOW_OP_THRESHOLD=250ms gave threshold %s", opts.SlowOpThreshold)
+	}
+	t.Setenv("DB_SLOW_OP_THRESHOLD", "soon")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("invalid DB_SLOW_OP_THRESHOLD was accepted")
+	}
+}
+
+func TestDatastoreOptionsFromEnv_WriteShards(t *testing.T) {
+	t.Setenv("DB_WRITE_SHARDS", "4")
+	opts, err := datastoreOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.WriteShards != 4 {
+		t.Errorf("DB_WRITE_SHARDS=4 gave %d write shards", opts.WriteShards)
+	}
+	t.Setenv("DB_WRITE_SHARDS", "0")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("DB_WRITE_SHARDS=0 was accepted")
+	}
+}
+
+func TestDatastoreOptionsFromEnv_ColdStorage(t *testing.T) {
+	t.Setenv("DB_COLD_ENDPOINT", "http://minio:9000")
+	t.Setenv("DB_COLD_BUCKET", "segments")
+	t.Setenv("DB_COLD_AFTER", "72h")
+	t.Setenv("DB_COLD_CACHE", "true")
+	opts, err := datastoreOptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold := opts.ColdStorage
+	if cold.Endpoint != "http://minio:9000" || cold.Bucket != "segments" || cold.After != 72*time.Hour || !cold.Cache {
+		t.Errorf("cold storage options = %+v", cold)
+	}
+	t.Setenv("DB_COLD_BUCKET", "")
+	if _, err := datastoreOptionsFromEnv(); err == nil {
+		t.Error("DB_COLD_ENDPOINT without DB_COLD_BUCKET was accepted")
+	}
+}
+
+func TestRouter_DeltaSinceSeq(t *testing.T) {
+	opts := datastore.DefaultOptions()
+	opts.KeyVersions = 2
+	versioned, err := datastore.NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = versioned
+	t.Cleanup(func() {
+		db = prev
+		_ = versioned.Close()
+	})
+	router := newRouter()
+
+	padding := strings.Repeat("x", 200)
+	doc := map[string]any{"status": "ok", "padding": padding, "stats": map[string]any{"cpu": 10, "mem": 20}, "old": true}
+	if err := db.PutJSON("dashboard", doc); err != nil {
+		t.Fatal(err)
+	}
+	rec, resp := doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq=0", nil)
+	version := rec.Header().Get(versionHeader)
+	if rec.Code != http.StatusOK || version == "" || resp.Value == nil {
+		t.Fatalf("initial GET returned %d, version %q, value %v", rec.Code, version, resp.Value)
+	}
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq="+version, nil)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("GET of an unchanged value returned %d with %q", rec.Code, rec.Body.String())
+	}
+
+	doc = map[string]any{"status": "ok", "padding": padding, "stats": map[string]any{"cpu": 15, "mem": 20}, "new": []any{1, nil}}
+	if err := db.PutJSON("dashboard", doc); err != nil {
+		t.Fatal(err)
+	}
+	rec, resp = doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq="+version, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(deltaHeader) != version {
+		t.Fatalf("GET of a changed value returned %d, delta header %q", rec.Code, rec.Header().Get(deltaHeader))
+	}
+	want := map[string]any{"stats": map[string]any{"cpu": 15.0}, "old": nil, "new": []any{1.0, nil}}
+	if !reflect.DeepEqual(resp.Value, want) {
+		t.Errorf("delta = %v, want %v", resp.Value, want)
+	}
+	if next := rec.Header().Get(versionHeader); next == version || next == "" {
+		t.Errorf("version after change = %q, previous %q", next, version)
+	}
+
+	// Значення з null-полем патч не виражає, тож повертається повний документ.
+	version = rec.Header().Get(versionHeader)
+	if err := db.PutJSON("dashboard", map[string]any{"status": map[string]any{"error": nil}}); err != nil {
+		t.Fatal(err)
+	}
+	rec, resp = doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq="+version, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(deltaHeader) != "" {
+		t.Fatalf("GET with an inexpressible change returned %d, delta header %q", rec.Code, rec.Header().Get(deltaHeader))
+	}
+	if full, _ := resp.Value.(map[string]any); full == nil || full["status"] == nil {
+		t.Errorf("full value = %v", resp.Value)
+	}
+
+	// Версія, якої база вже не пам'ятає, також дає повне значення.
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq=999999", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(deltaHeader) != "" {
+		t.Errorf("GET since an unknown version returned %d, delta header %q", rec.Code, rec.Header().Get(deltaHeader))
+	}
+	rec, _ = doRequest(t, router, http.MethodGet, "/db/dashboard?type=json&since_seq=abc", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid since_seq returned %d, want 400", rec.Code)
+	}
+}
+
+func TestRouter_CancelledWriteIsAbandoned(t *testing.T) {
+	router := newRouter()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		if method == http.MethodDelete {
+			if err := db.Put("cancelled-write", "kept"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := httptest.NewRequest(method, "/db/cancelled-write", strings.NewReader(`{"value":"new"}`)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != statusClientClosedRequest {
+			t.Errorf("%s with a cancelled context returned %d, want %d", method, rec.Code, statusClientClosedRequest)
+		}
+	}
+	if v, err := db.Get("cancelled-write"); err != nil || v != "kept" {
+		t.Errorf("value after cancelled writes = %q, %v; want the value written before", v, err)
+	}
+	if status := writeErrorStatus(context.DeadlineExceeded); status != http.StatusGatewayTimeout {
+		t.Errorf("deadline exceeded maps to %d", status)
+	}
+}
+
+func TestStorageRouter_Memory(t *testing.T) {
+	router := newStorageRouter(datastore.NewMemoryStorage())
+
+	rec, _ := doRequest(t, router, http.MethodPost, "/db/mem-key", map[string]interface{}{"value": "mem-value"})
+	if rec.Code != http.StatusCreated || rec.Header().Get("ETag") == "" {
+		t.Fatalf("POST returned %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	rec, resp := doRequest(t, router, http.MethodGet, "/db/mem-key", nil)
+	if rec.Code != http.StatusOK || resp.Value != "mem-value" {
+		t.Errorf("GET returned %d with %+v", rec.Code, resp)
+	}
+	if rec, _ := doRequest(t, router, http.MethodPost, "/db/mem-int", map[string]interface{}{"value": 42}); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST of a number returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/db/mem-key?type=int64", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET with type=int64 returned %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec, _ := doRequest(t, router, http.MethodDelete, "/db/mem-key", nil); rec.Code != http.StatusOK {
+		t.Errorf("DELETE returned %d", rec.Code)
+	}
+	if rec, resp := doRequest(t, router, http.MethodGet, "/db/mem-key", nil); rec.Code != http.StatusNotFound || resp.Code != datastore.CodeNotFound {
+		t.Errorf("GET after DELETE returned %d with %+v", rec.Code, resp)
+	}
+	if rec, _ := doRequest(t, router, http.MethodGet, "/ready", nil); rec.Code != http.StatusOK {
+		t.Errorf("/ready returned %d", rec.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// maxSnapshotKeys обмежує кількість ключів в одному узгодженому читанні.
+const maxSnapshotKeys = 1000
+
+// ReadSnapshotResponse - відповідь POST /db/_read_snapshot. Values містить кожен запитаний ключ,
+// відсутні ключі мають значення null.
+type ReadSnapshotResponse struct {
+	Seq    uint64                 `json:"seq"`
+	Values map[string]interface{} `json:"values,omitempty"`
+	ErrorInfo
+}
+
+func writeReadSnapshotJSON(w http.ResponseWriter, status int, resp ReadSnapshotResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readSnapshotHandler обробляє POST /db/_read_snapshot з тілом {"keys": ["a", "b"]}.
+// Усі ключі читаються з одного стану бази, номер якого повертається в seq.
+func readSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeReadSnapshotJSON(w, http.StatusBadRequest, ReadSnapshotResponse{ErrorInfo: requestError("Failed to decode request body: " + err.Error())})
+		return
+	}
+	if len(requestBody.Keys) == 0 || len(requestBody.Keys) > maxSnapshotKeys {
+		writeReadSnapshotJSON(w, http.StatusBadRequest, ReadSnapshotResponse{ErrorInfo: requestError("Field 'keys' must contain from 1 to 1000 keys")})
+		return
+	}
+
+	snap, err := db.ReadSnapshot(requestBody.Keys)
+	if err != nil {
+		log.Printf("DB_SERVER: Snapshot read of %d keys failed: %v", len(requestBody.Keys), err)
+		writeReadSnapshotJSON(w, http.StatusInternalServerError, ReadSnapshotResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Snapshot read of %d keys at seq %d", len(requestBody.Keys), snap.Seq)
+	writeReadSnapshotJSON(w, http.StatusOK, ReadSnapshotResponse{Seq: snap.Seq, Values: snap.Values})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// restoreTimeout обмежує завантаження знімка з віддаленого сховища.
+const restoreTimeout = 30 * time.Minute
+
+// dirIsEmpty повідомляє, чи директорія відсутня або не містить жодного файлу, крім журналу
+// обслуговування, тож невдале відновлення буде повторено при наступному запуску.
+func dirIsEmpty(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.Name() != datastore.AuditLogFileName {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// restoreIfEmpty розпаковує знімок із source (шлях до файлу або http(s) URL) у dbDir,
+// якщо директорія бази порожня. Повертає true, якщо відновлення виконано.
+func restoreIfEmpty(ctx context.Context, dbDir, source string) (bool, error) {
+	if source == "" {
+		return false, nil
+	}
+	empty, err := dirIsEmpty(dbDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect db directory %s: %w", dbDir, err)
+	}
+	if !empty {
+		log.Printf("DB_SERVER: DB_RESTORE_FROM is set, but %s is not empty; skipping restore", dbDir)
+		return false, nil
+	}
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create db directory %s: %w", dbDir, err)
+	}
+
+	started := time.Now()
+	files, err := restoreSnapshot(ctx, dbDir, source)
+	entry := datastore.AuditEntry{Op: datastore.AuditRestore, Source: redactURL(source)}
+	if err == nil {
+		entry.Details = fmt.Sprintf("%d segments in %s", len(files), time.Since(started).Round(time.Millisecond))
+	}
+	if auditErr := datastore.AppendAudit(dbDir, entry, err); auditErr != nil {
+		log.Printf("DB_SERVER: %v", auditErr)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// restoreSnapshot завантажує та розпаковує знімок. При помилці вже розпаковані файли видаляються,
+// щоб директорія знову стала порожньою.
+func restoreSnapshot(ctx context.Context, dbDir, source string) ([]string, error) {
+	r, err := openSnapshotSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	files, err := datastore.UnpackSnapshot(r, dbDir)
+	if err != nil {
+		for _, path := range files {
+			_ = os.Remove(path)
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+func openSnapshotSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open snapshot %s: %w", source, err)
+		}
+		return f, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, restoreTimeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create snapshot download request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("snapshot download returned status %s", resp.Status)
+	}
+	return &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// redactURL прибирає параметри запиту (напр. підпис presigned URL) перед записом у журнал.
+func redactURL(source string) string {
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		return source[:i]
+	}
+	return source
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+func TestRestoreIfEmpty(t *testing.T) {
+	if err := db.Put("restore-key", "restored"); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := db.Snapshot(&archive); err != nil {
+		t.Fatal(err)
+	}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	}))
+	defer source.Close()
+
+	dbDir := filepath.Join(t.TempDir(), "data")
+	restored, err := restoreIfEmpty(context.Background(), dbDir, source.URL+"/snapshot.tar?signature=secret")
+	if err != nil || !restored {
+		t.Fatalf("restoreIfEmpty: restored=%v, err=%v", restored, err)
+	}
+	restoredDb, err := datastore.NewDb(dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := restoredDb.Get("restore-key")
+	// Відновлення записано в журнал обслуговування відкритої бази.
+	entries, auditErr := restoredDb.AuditLog(0)
+	restoredDb.Close()
+	if err != nil || value != "restored" {
+		t.Errorf("Get after restore: got %q, %v", value, err)
+	}
+	if auditErr != nil || len(entries) == 0 {
+		t.Fatalf("AuditLog after restore: %v, %v", entries, auditErr)
+	}
+	if entry := entries[0]; entry.Op != datastore.AuditRestore || entry.Outcome != "ok" || entry.Source != source.URL+"/snapshot.tar" {
+		t.Errorf("unexpected audit record %+v", entry)
+	}
+
+	restored, err = restoreIfEmpty(context.Background(), dbDir, source.URL)
+	if err != nil || restored {
+		t.Errorf("restore into non-empty dir: restored=%v, err=%v", restored, err)
+	}
+}
+
+func TestRestoreIfEmpty_RejectsUnexpectedEntries(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "segment-0", Mode: 0644, Size: 0, Typeflag: tar.TypeReg})
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 0, Typeflag: tar.TypeReg})
+	tw.Close()
+	path := filepath.Join(t.TempDir(), "bad.tar")
+	if err := os.WriteFile(path, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbDir := t.TempDir()
+	if _, err := restoreIfEmpty(context.Background(), dbDir, path); err == nil {
+		t.Fatal("expected restore of malicious archive to fail")
+	}
+	if empty, _ := dirIsEmpty(dbDir); !empty {
+		t.Errorf("db dir should be left empty after a failed restore")
+	}
+}
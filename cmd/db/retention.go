@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// retentionPolicyFromEnv читає DB_RETENTION_MAX_AGE (напр. "720h") та
+// DB_RETENTION_BUCKETS - перевизначення для префіксів ключів у вигляді "logs_=24h,audit_=0".
+func retentionPolicyFromEnv() (datastore.RetentionPolicy, error) {
+	var policy datastore.RetentionPolicy
+	if raw := config.Getenv("DB_RETENTION_MAX_AGE"); raw != "" {
+		age, err := time.ParseDuration(raw)
+		if err != nil || age < 0 {
+			return policy, fmt.Errorf("invalid DB_RETENTION_MAX_AGE %q", raw)
+		}
+		policy.MaxAge = age
+	}
+	raw := config.Getenv("DB_RETENTION_BUCKETS")
+	if raw == "" {
+		return policy, nil
+	}
+	policy.Buckets = make(map[string]time.Duration)
+	for _, item := range strings.Split(raw, ",") {
+		prefix, rawAge, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || prefix == "" {
+			return policy, fmt.Errorf("invalid DB_RETENTION_BUCKETS item %q, expected prefix=duration", item)
+		}
+		age, err := time.ParseDuration(rawAge)
+		if err != nil || age < 0 {
+			return policy, fmt.Errorf("invalid retention age %q for prefix %q", rawAge, prefix)
+		}
+		policy.Buckets[prefix] = age
+	}
+	return policy, nil
+}
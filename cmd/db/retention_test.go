@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyFromEnv(t *testing.T) {
+	t.Setenv("DB_RETENTION_MAX_AGE", "720h")
+	t.Setenv("DB_RETENTION_BUCKETS", "logs_=24h, audit_=0")
+	policy, err := retentionPolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxAge != 720*time.Hour || policy.Buckets["logs_"] != 24*time.Hour {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+	if age, ok := policy.Buckets["audit_"]; !ok || age != 0 {
+		t.Errorf("audit_ bucket: got %s, %v", age, ok)
+	}
+
+	t.Setenv("DB_RETENTION_BUCKETS", "logs_")
+	if _, err := retentionPolicyFromEnv(); err == nil {
+		t.Errorf("expected an error for a bucket without an age")
+	}
+}
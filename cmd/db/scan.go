@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// maxScanLimit - найбільша сторінка GET /db/_scan.
+const maxScanLimit = 1000
+
+// ScanEntry - ключ зі значенням у відповіді GET /db/_scan.
+type ScanEntry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	Type  string      `json:"type"`
+}
+
+// ScanResponse - відповідь GET /db/_scan. NextCursor порожній на останній сторінці.
+type ScanResponse struct {
+	Entries    []ScanEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	ErrorInfo
+}
+
+func writeScanJSON(w http.ResponseWriter, status int, resp ScanResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// scanHandler обробляє GET /db/_scan?cursor=...&reverse=true&limit=N: сторінку ключів зі
+// значеннями в порядку ключів. Наступна сторінка запитується з next_cursor відповіді.
+func scanHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := datastore.DefaultPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxScanLimit {
+			writeScanJSON(w, http.StatusBadRequest, ScanResponse{ErrorInfo: requestError("Query parameter 'limit' must be an integer from 1 to " + strconv.Itoa(maxScanLimit))})
+			return
+		}
+		limit = n
+	}
+	reverse := query.Get("reverse") == "true"
+
+	page, next, err := db.IterateFrom(query.Get("cursor"), reverse, limit)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		writeScanJSON(w, http.StatusBadRequest, ScanResponse{ErrorInfo: requestError("Invalid cursor, use next_cursor from a previous response")})
+		return
+	}
+	if err != nil {
+		log.Printf("DB_SERVER: Scan failed: %v", err)
+		writeScanJSON(w, http.StatusInternalServerError, ScanResponse{ErrorInfo: errorInfo(err)})
+		return
+	}
+	resp := ScanResponse{Entries: make([]ScanEntry, 0, len(page)), NextCursor: next}
+	for _, kv := range page {
+		resp.Entries = append(resp.Entries, ScanEntry{Key: kv.Key, Value: kv.Value, Type: datastore.DataTypeName(kv.DataType)})
+	}
+	log.Printf("DB_SERVER: Scan returned %d entries (reverse=%t, more=%t)", len(resp.Entries), reverse, next != "")
+	writeScanJSON(w, http.StatusOK, resp)
+}
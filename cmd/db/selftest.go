@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/selftest"
+)
+
+const selfTestKeys = 50
+
+// runSelfTest перевіряє сховище на тимчасовій директорії: запис, читання, злиття та закриття.
+func runSelfTest() int {
+	report := selftest.New("db")
+	dir, err := os.MkdirTemp("", "db-selftest")
+	if !report.Check("create temp directory", func() error { return err }) {
+		return report.Print(os.Stdout)
+	}
+	defer os.RemoveAll(dir)
+
+	var testDb *datastore.Db
+	opts := datastore.Options{MaxFileSize: 512, MergeInterval: -1, SyncPolicy: datastore.SyncAlways}
+	if !report.Check("open datastore", func() error {
+		testDb, err = datastore.NewDbWithOptions(dir, opts)
+		return err
+	}) {
+		return report.Print(os.Stdout)
+	}
+
+	report.Check(fmt.Sprintf("write %d keys", selfTestKeys), func() error {
+		for i := 0; i < selfTestKeys; i++ {
+			if err := testDb.Put(fmt.Sprintf("selftest-%d", i), fmt.Sprintf("value-%d", i)); err != nil {
+				return err
+			}
+		}
+		return testDb.PutInt64("selftest-int", 42)
+	})
+	verify := func() error {
+		for i := 0; i < selfTestKeys; i++ {
+			key := fmt.Sprintf("selftest-%d", i)
+			if v, err := testDb.Get(key); err != nil || v != fmt.Sprintf("value-%d", i) {
+				return fmt.Errorf("key %s: got %q, %v", key, v, err)
+			}
+		}
+		if v, err := testDb.GetInt64("selftest-int"); err != nil || v != 42 {
+			return fmt.Errorf("key selftest-int: got %d, %v", v, err)
+		}
+		return nil
+	}
+	report.Check("read keys back", verify)
+	report.Check("merge segments", testDb.Merge)
+	report.Check("read keys after merge", verify)
+	report.Check("close datastore", testDb.Close)
+	return report.Print(os.Stdout)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+)
+
+// SeriesResponse - відповідь ендпоінтів часових рядів
+type SeriesResponse struct {
+	Key    string                  `json:"key"`
+	Points []datastore.SeriesPoint `json:"points,omitempty"`
+	ErrorInfo
+}
+
+func writeSeriesJSON(w http.ResponseWriter, status int, resp SeriesResponse) {
+	setRetryableHeader(w, resp.ErrorInfo)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// appendSeriesHandler обробляє POST /db/{key}/series. Тіло - одна точка {"ts": ..., "value": ...}
+// (ts за замовчуванням - поточний час у мс) або {"points": [...]}.
+func appendSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	var requestBody struct {
+		Timestamp *int64                  `json:"ts"`
+		Value     *int64                  `json:"value"`
+		Points    []datastore.SeriesPoint `json:"points"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeSeriesJSON(w, http.StatusBadRequest, SeriesResponse{Key: key, ErrorInfo: requestError("Failed to decode request body: " + err.Error())})
+		return
+	}
+	points := requestBody.Points
+	if requestBody.Value != nil {
+		ts := time.Now().UnixMilli()
+		if requestBody.Timestamp != nil {
+			ts = *requestBody.Timestamp
+		}
+		points = append(points, datastore.SeriesPoint{Timestamp: ts, Value: *requestBody.Value})
+	}
+	if len(points) == 0 {
+		writeSeriesJSON(w, http.StatusBadRequest, SeriesResponse{Key: key, ErrorInfo: requestError("Request body must contain 'value' or non-empty 'points'")})
+		return
+	}
+
+	if err := db.AppendSeries(key, points...); err != nil {
+		log.Printf("DB_SERVER: Failed to append %d points to series %s: %v", len(points), key, err)
+		writeSeriesJSON(w, writeErrorStatus(err), SeriesResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	log.Printf("DB_SERVER: Appended %d points to series '%s'", len(points), key)
+	writeSeriesJSON(w, http.StatusCreated, SeriesResponse{Key: key, Points: points})
+}
+
+// getSeriesHandler обробляє GET /db/{key}/series?from=&to= (мітки часу в мс, межі включно).
+func getSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	from, errFrom := parseTimestampParam(r, "from", math.MinInt64)
+	to, errTo := parseTimestampParam(r, "to", math.MaxInt64)
+	if errFrom != nil || errTo != nil {
+		writeSeriesJSON(w, http.StatusBadRequest, SeriesResponse{Key: key, ErrorInfo: requestError("Parameters 'from' and 'to' must be Unix timestamps in milliseconds")})
+		return
+	}
+
+	points, err := db.GetSeries(key, from, to)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			writeSeriesJSON(w, http.StatusNotFound, SeriesResponse{Key: key, ErrorInfo: errorInfo(err)})
+			return
+		}
+		log.Printf("DB_SERVER: Failed to read series %s: %v", key, err)
+		writeSeriesJSON(w, http.StatusInternalServerError, SeriesResponse{Key: key, ErrorInfo: errorInfo(err)})
+		return
+	}
+	writeSeriesJSON(w, http.StatusOK, SeriesResponse{Key: key, Points: points})
+}
+
+func parseTimestampParam(r *http.Request, name string, fallback int64) (int64, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.ParseInt(raw, 10, 64)
+}
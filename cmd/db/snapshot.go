@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+const (
+	snapshotFilePrefix  = "snapshot-"
+	snapshotFileSuffix  = ".tar"
+	defaultSnapshotKeep = 7
+)
+
+// SnapshotConfig налаштовує планувальник знімків.
+type SnapshotConfig struct {
+	// Schedule - вираз cron (напр. "0 3 * * *" або "@daily"). Порожній вимикає знімки.
+	Schedule string
+	// Dir - директорія для файлів знімків.
+	Dir string
+	// URL - адреса, на яку знімок завантажується запитом PUT (напр. presigned URL S3).
+	URL string
+	// Keep - скільки останніх знімків зберігати в Dir. На URL не впливає: presigned URL
+	// вказує на один об'єкт, який кожне завантаження перезаписує, тож зберігання копій
+	// у сховищі налаштовується його власними правилами (версіонування, lifecycle).
+	Keep int
+}
+
+func snapshotConfigFromEnv() SnapshotConfig {
+	cfg := SnapshotConfig{
+		Schedule: config.Getenv("DB_SNAPSHOT_SCHEDULE"),
+		Dir:      config.Getenv("DB_SNAPSHOT_DIR"),
+		URL:      config.Getenv("DB_SNAPSHOT_URL"),
+		Keep:     int(envInt64("DB_SNAPSHOT_KEEP")),
+	}
+	if cfg.Keep == 0 {
+		cfg.Keep = defaultSnapshotKeep
+	}
+	return cfg
+}
+
+// SnapshotStatus - стан планувальника для /health.
+type SnapshotStatus struct {
+	Schedule     string     `json:"schedule"`
+	LastAttempt  *time.Time `json:"lastAttempt,omitempty"`
+	LastSuccess  *time.Time `json:"lastSuccess,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastLocation string     `json:"lastLocation,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+type snapshotScheduler struct {
+	cfg      SnapshotConfig
+	schedule *cronSchedule
+	client   *http.Client
+	mu       sync.Mutex
+	status   SnapshotStatus
+}
+
+// newSnapshotScheduler повертає nil, якщо розклад не задано.
+func newSnapshotScheduler(cfg SnapshotConfig) (*snapshotScheduler, error) {
+	if cfg.Schedule == "" {
+		return nil, nil
+	}
+	if cfg.Dir == "" && cfg.URL == "" {
+		return nil, fmt.Errorf("snapshot schedule is set, but neither DB_SNAPSHOT_DIR nor DB_SNAPSHOT_URL is")
+	}
+	schedule, err := parseCron(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DB_SNAPSHOT_SCHEDULE: %w", err)
+	}
+	return &snapshotScheduler{
+		cfg:      cfg,
+		schedule: schedule,
+		client:   &http.Client{Timeout: 30 * time.Minute},
+		status:   SnapshotStatus{Schedule: cfg.Schedule},
+	}, nil
+}
+
+// run робить знімки за розкладом, доки ctx не скасовано.
+func (s *snapshotScheduler) run(ctx context.Context) {
+	for {
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("DB_SERVER: Snapshot schedule %q never fires, scheduler stopped", s.cfg.Schedule)
+			return
+		}
+		s.mu.Lock()
+		s.status.NextRun = &next
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := s.takeSnapshot(ctx); err != nil {
+			log.Printf("DB_SERVER: Scheduled snapshot failed: %v", err)
+		}
+	}
+}
+
+// takeSnapshot робить один знімок і оновлює стан планувальника.
+func (s *snapshotScheduler) takeSnapshot(ctx context.Context) error {
+	started := time.Now().UTC()
+	var locations []string
+	var path string
+	var err error
+	if s.cfg.Dir != "" {
+		if path, err = s.snapshotToDir(started); err == nil {
+			locations = append(locations, path)
+			err = s.prune()
+		}
+	}
+	if err == nil && s.cfg.URL != "" {
+		if err = s.upload(ctx, path); err == nil {
+			locations = append(locations, s.cfg.URL)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastAttempt = &started
+	if err != nil {
+		s.status.LastError = err.Error()
+		return err
+	}
+	finished := time.Now().UTC()
+	s.status.LastSuccess = &finished
+	s.status.LastError = ""
+	s.status.LastLocation = strings.Join(locations, ", ")
+	log.Printf("DB_SERVER: Snapshot stored to %s in %s", s.status.LastLocation, finished.Sub(started))
+	return nil
+}
+
+func (s *snapshotScheduler) snapshotToDir(at time.Time) (string, error) {
+	if err := os.MkdirAll(s.cfg.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory %s: %w", s.cfg.Dir, err)
+	}
+	path := filepath.Join(s.cfg.Dir, snapshotFilePrefix+at.Format("20060102T150405.000000000Z")+snapshotFileSuffix)
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file %s: %w", tmpPath, err)
+	}
+	err = db.Snapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fsutil.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write snapshot %s: %w", path, err)
+	}
+	if err := fsutil.SyncDir(s.cfg.Dir); err != nil {
+		log.Printf("DB_SERVER: %v", err)
+	}
+	return path, nil
+}
+
+// prune видаляє найстаріші знімки, залишаючи cfg.Keep останніх.
+func (s *snapshotScheduler) prune() error {
+	matches, err := filepath.Glob(filepath.Join(s.cfg.Dir, snapshotFilePrefix+"*"+snapshotFileSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for len(matches) > s.cfg.Keep {
+		if err := os.Remove(matches[0]); err != nil {
+			return fmt.Errorf("failed to remove old snapshot %s: %w", matches[0], err)
+		}
+		log.Printf("DB_SERVER: Removed old snapshot %s", matches[0])
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// upload завантажує знімок із файлу path, а якщо його немає (Dir не задано) - спершу
+// записує знімок у тимчасовий файл. Presigned PUT S3 не приймає chunked-тіло
+// (411 Length Required), тож розмір знімка має бути відомий до початку запиту.
+func (s *snapshotScheduler) upload(ctx context.Context, path string) error {
+	if path == "" {
+		tmp, err := os.CreateTemp("", snapshotFilePrefix+"*"+snapshotFileSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to create temporary snapshot file: %w", err)
+		}
+		path = tmp.Name()
+		defer os.Remove(path)
+		err = db.Snapshot(tmp)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write temporary snapshot %s: %w", path, err)
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat snapshot %s: %w", path, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.cfg.URL, f)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot upload request: %w", err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("snapshot upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("snapshot upload returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *snapshotScheduler) currentStatus() SnapshotStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotScheduler_DirRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newSnapshotScheduler(SnapshotConfig{Schedule: "@daily", Dir: dir, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.takeSnapshot(context.Background()); err != nil {
+			t.Fatalf("snapshot %d failed: %v", i, err)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, snapshotFilePrefix+"*"))
+	if len(files) != 2 {
+		t.Errorf("expected 2 snapshots after retention, got %v", files)
+	}
+	status := s.currentStatus()
+	if status.LastSuccess == nil || status.LastError != "" || status.LastLocation != files[len(files)-1] {
+		t.Errorf("unexpected status %+v (files %v)", status, files)
+	}
+}
+
+func TestSnapshotScheduler_Upload(t *testing.T) {
+	if err := db.Put("snapshot-upload-key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		// Як і presigned PUT S3, ціль не приймає chunked-тіло без Content-Length.
+		if r.ContentLength <= 0 || len(r.TransferEncoding) > 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, header.Name)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer target.Close()
+
+	s, err := newSnapshotScheduler(SnapshotConfig{Schedule: "@hourly", URL: target.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.takeSnapshot(context.Background()); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if len(received) == 0 {
+		t.Errorf("upload target received no segments")
+	}
+
+	snapshots = s
+	defer func() { snapshots = nil }()
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var resp HealthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /health returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Status != "ok" || resp.Snapshot == nil || resp.Snapshot.LastSuccess == nil {
+		t.Errorf("unexpected health response %+v", resp)
+	}
+}
+
+func TestSnapshotScheduler_UploadFromDir(t *testing.T) {
+	var uploaded int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded = r.ContentLength
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	dir := t.TempDir()
+	s, err := newSnapshotScheduler(SnapshotConfig{Schedule: "@daily", Dir: dir, URL: target.URL, Keep: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.takeSnapshot(context.Background()); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, snapshotFilePrefix+"*"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 local snapshot, got %v", files)
+	}
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Завантажується той самий файл, що збережено в Dir.
+	if uploaded != info.Size() {
+		t.Errorf("uploaded Content-Length %d, local snapshot has %d bytes", uploaded, info.Size())
+	}
+}
+
+func TestSnapshotScheduler_Config(t *testing.T) {
+	if s, err := newSnapshotScheduler(SnapshotConfig{}); s != nil || err != nil {
+		t.Errorf("empty schedule must disable snapshots, got %v, %v", s, err)
+	}
+	if _, err := newSnapshotScheduler(SnapshotConfig{Schedule: "@daily"}); err == nil {
+		t.Errorf("schedule without destination must be rejected")
+	}
+	if _, err := newSnapshotScheduler(SnapshotConfig{Schedule: "bad", Dir: "x"}); err == nil {
+		t.Errorf("invalid schedule must be rejected")
+	}
+}
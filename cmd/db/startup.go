@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/selftest"
+)
+
+// checkStartup виводить конфігурацію сервера БД і перевіряє оточення до відкриття бази.
+// Повертає налаштування сховища, зібрані зі змінних середовища.
+func checkStartup(dbDir, port string) (datastore.Options, error) {
+	startup := selftest.NewStartup("db")
+	startup.Config(config.EnvVar, os.Getenv(config.EnvVar))
+	startup.Config("DB_DIR", dbDir)
+	startup.Config("DB_PORT", port)
+	for _, name := range []string{"DB_MAX_FILE_SIZE", "DB_SYNC_POLICY", "DB_SYNC_INTERVAL", "DB_OPEN_MODE", "DB_MAX_KEYS", "DB_MAX_DISK_BYTES", "DB_CACHE_BUDGET_BYTES", "DB_MMAP", "DB_DISK_INDEX", "DB_COMPRESSION", "DB_DEDUP", "DB_ARCHIVE", "DB_RETENTION_MAX_AGE", "DB_SNAPSHOT_SCHEDULE", "DB_SNAPSHOT_DIR", "DB_SLOW_OP_THRESHOLD", "DB_WRITE_SHARDS", "DB_COLD_ENDPOINT", "DB_COLD_BUCKET", "DB_COLD_PREFIX", "DB_COLD_AFTER", "DB_COLD_CACHE"} {
+		startup.Config(name, config.Getenv(name))
+	}
+	startup.Config("DB_RESTORE_FROM", redactURL(config.Getenv("DB_RESTORE_FROM")))
+	startup.Config("DB_SNAPSHOT_URL", redactURL(config.Getenv("DB_SNAPSHOT_URL")))
+	startup.Config("DB_LOG_POLICY", config.Getenv("DB_LOG_POLICY"))
+	startup.Secret("DB_ADMIN_TOKEN", adminToken)
+	startup.Secret("DB_ENCRYPTION_KEYS", config.Getenv("DB_ENCRYPTION_KEYS"))
+	startup.Config("DB_ENCRYPTION_KEYS_FILE", config.Getenv("DB_ENCRYPTION_KEYS_FILE"))
+	startup.Secret("DB_COLD_SECRET_ACCESS_KEY", config.Getenv("DB_COLD_SECRET_ACCESS_KEY"))
+	startup.Config("-no-migrate", *noMigrate)
+
+	profile, profileErr := config.Current()
+	startup.Check(config.EnvVar+" is valid", func() error { return profileErr })
+	if profile.RequireAuth {
+		startup.Check("DB_ADMIN_TOKEN is set (required by "+config.EnvVar+"="+profile.Name+")", func() error {
+			if adminToken == "" {
+				return fmt.Errorf("admin endpoints must be protected in %s", profile.Name)
+			}
+			return nil
+		})
+	}
+	startup.Check("DB_PORT is available", func() error { return selftest.CheckPort(port) })
+	startup.Check("DB_DIR is writable", func() error { return selftest.CheckWritableDir(dbDir) })
+	startup.Check("log policy is valid", func() error {
+		_, err := logPolicyFromEnv()
+		return err
+	})
+	var opts datastore.Options
+	startup.Check("datastore options are valid", func() error {
+		var err error
+		opts, err = datastoreOptionsFromEnv()
+		return err
+	})
+	if source := config.Getenv("DB_RESTORE_FROM"); strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		startup.Check("DB_RESTORE_FROM is valid", func() error { return selftest.CheckURL(source) })
+	}
+	cfg := snapshotConfigFromEnv()
+	startup.Check("snapshot configuration is valid", func() error {
+		_, err := newSnapshotScheduler(cfg)
+		return err
+	})
+	if cfg.Dir != "" {
+		startup.Check("DB_SNAPSHOT_DIR is writable", func() error { return selftest.CheckWritableDir(cfg.Dir) })
+	}
+	if cfg.URL != "" {
+		startup.Check("DB_SNAPSHOT_URL is valid", func() error { return selftest.CheckURL(cfg.URL) })
+	}
+	if err := startup.Run(os.Stderr); err != nil {
+		return datastore.Options{}, err
+	}
+	return opts, nil
+}
+
+// datastoreOptionsFromEnv збирає налаштування сховища зі змінних середовища DB_*.
+func datastoreOptionsFromEnv() (datastore.Options, error) {
+	var err error
+	opts := datastore.DefaultOptions()
+	if raw := config.Getenv("DB_MAX_FILE_SIZE"); raw != "" {
+		if opts.MaxFileSize, err = strconv.ParseInt(raw, 10, 64); err != nil || opts.MaxFileSize == 0 {
+			return opts, fmt.Errorf("invalid DB_MAX_FILE_SIZE %q", raw)
+		}
+	}
+	if opts.SyncPolicy, err = datastore.ParseSyncPolicy(config.Getenv("DB_SYNC_POLICY")); err != nil {
+		return opts, fmt.Errorf("invalid DB_SYNC_POLICY: %w", err)
+	}
+	if opts.SyncInterval, err = durationFromEnv("DB_SYNC_INTERVAL", 0); err != nil || opts.SyncInterval < 0 {
+		return opts, fmt.Errorf("invalid DB_SYNC_INTERVAL %q", config.Getenv("DB_SYNC_INTERVAL"))
+	}
+	if opts.OpenMode, err = datastore.ParseOpenMode(config.Getenv("DB_OPEN_MODE")); err != nil {
+		return opts, fmt.Errorf("invalid DB_OPEN_MODE: %w", err)
+	}
+	if raw := config.Getenv("DB_MAX_KEYS"); raw != "" {
+		if opts.MaxKeys, err = strconv.Atoi(raw); err != nil || opts.MaxKeys <= 0 {
+			return opts, fmt.Errorf("invalid DB_MAX_KEYS %q", raw)
+		}
+	}
+	if raw := config.Getenv("DB_MAX_DISK_BYTES"); raw != "" {
+		if opts.MaxDiskBytes, err = strconv.ParseInt(raw, 10, 64); err != nil || opts.MaxDiskBytes <= 0 {
+			return opts, fmt.Errorf("invalid DB_MAX_DISK_BYTES %q", raw)
+		}
+	}
+	if raw := config.Getenv("DB_CACHE_BUDGET_BYTES"); raw != "" {
+		if opts.CacheBudgetBytes, err = strconv.ParseInt(raw, 10, 64); err != nil || opts.CacheBudgetBytes <= 0 {
+			return opts, fmt.Errorf("invalid DB_CACHE_BUDGET_BYTES %q", raw)
+		}
+	}
+	if raw := config.Getenv("DB_KEY_VERSIONS"); raw != "" {
+		if opts.KeyVersions, err = strconv.Atoi(raw); err != nil || opts.KeyVersions <= 0 {
+			return opts, fmt.Errorf("invalid DB_KEY_VERSIONS %q", raw)
+		}
+	}
+	if raw := config.Getenv("DB_WRITE_SHARDS"); raw != "" {
+		if opts.WriteShards, err = strconv.Atoi(raw); err != nil || opts.WriteShards <= 0 {
+			return opts, fmt.Errorf("invalid DB_WRITE_SHARDS %q", raw)
+		}
+	}
+	opts.MmapSealedSegments = config.Getenv("DB_MMAP") == "true"
+	opts.IndexInt64Values = config.Getenv("DB_INDEX_INT64") == "true"
+	opts.DiskIndex = config.Getenv("DB_DISK_INDEX") == "true"
+	if opts.Retention, err = retentionPolicyFromEnv(); err != nil {
+		return opts, fmt.Errorf("failed to configure retention: %w", err)
+	}
+	if opts.Compression, err = datastore.ParseCompression(config.Getenv("DB_COMPRESSION")); err != nil {
+		return opts, fmt.Errorf("invalid DB_COMPRESSION: %w", err)
+	}
+	if raw := config.Getenv("DB_COMPRESSION_THRESHOLD"); raw != "" {
+		if opts.CompressionThreshold, err = strconv.Atoi(raw); err != nil || opts.CompressionThreshold <= 0 {
+			return opts, fmt.Errorf("invalid DB_COMPRESSION_THRESHOLD %q", raw)
+		}
+	}
+	opts.Dedup = config.Getenv("DB_DEDUP") == "true"
+	if raw := config.Getenv("DB_DEDUP_THRESHOLD"); raw != "" {
+		if opts.DedupThreshold, err = strconv.Atoi(raw); err != nil || opts.DedupThreshold <= 0 {
+			return opts, fmt.Errorf("invalid DB_DEDUP_THRESHOLD %q", raw)
+		}
+	}
+	opts.Archive = config.Getenv("DB_ARCHIVE") == "true"
+	if opts.ArchiveMaxAge, err = durationFromEnv("DB_ARCHIVE_MAX_AGE", 0); err != nil {
+		return opts, fmt.Errorf("invalid DB_ARCHIVE_MAX_AGE: %w", err)
+	}
+	if raw := config.Getenv("DB_ARCHIVE_MAX_BYTES"); raw != "" {
+		if opts.ArchiveMaxBytes, err = strconv.ParseInt(raw, 10, 64); err != nil || opts.ArchiveMaxBytes <= 0 {
+			return opts, fmt.Errorf("invalid DB_ARCHIVE_MAX_BYTES %q", raw)
+		}
+	}
+	if opts.KeyProvider, err = keyProviderFromEnv(); err != nil {
+		return opts, err
+	}
+	if opts.ColdStorage, err = coldStorageFromEnv(); err != nil {
+		return opts, err
+	}
+	if opts.SlowOpThreshold, err = durationFromEnv("DB_SLOW_OP_THRESHOLD", 0); err != nil || opts.SlowOpThreshold < 0 {
+		return opts, fmt.Errorf("invalid DB_SLOW_OP_THRESHOLD %q", config.Getenv("DB_SLOW_OP_THRESHOLD"))
+	}
+	if opts.SlowOpThreshold > 0 {
+		opts.OnSlowOp = logSlowOp
+	}
+	opts.NoMigrate = *noMigrate
+	return opts, nil
+}
+
+// coldStorageFromEnv налаштовує холодне сховище сегментів зі змінних DB_COLD_*.
+// Без DB_COLD_ENDPOINT холодний рівень вимкнено.
+func coldStorageFromEnv() (datastore.ColdStorage, error) {
+	cold := datastore.ColdStorage{
+		Endpoint:        config.Getenv("DB_COLD_ENDPOINT"),
+		Bucket:          config.Getenv("DB_COLD_BUCKET"),
+		Region:          config.Getenv("DB_COLD_REGION"),
+		AccessKeyID:     config.Getenv("DB_COLD_ACCESS_KEY_ID"),
+		SecretAccessKey: config.Getenv("DB_COLD_SECRET_ACCESS_KEY"),
+		Prefix:          config.Getenv("DB_COLD_PREFIX"),
+		Cache:           config.Getenv("DB_COLD_CACHE") == "true",
+	}
+	if cold.Endpoint == "" {
+		return datastore.ColdStorage{}, nil
+	}
+	if cold.Bucket == "" {
+		return cold, fmt.Errorf("DB_COLD_BUCKET is required with DB_COLD_ENDPOINT")
+	}
+	var err error
+	if cold.After, err = durationFromEnv("DB_COLD_AFTER", 0); err != nil || cold.After < 0 {
+		return cold, fmt.Errorf("invalid DB_COLD_AFTER %q", config.Getenv("DB_COLD_AFTER"))
+	}
+	return cold, nil
+}
+
+// keyProviderFromEnv повертає джерело ключів шифрування з DB_ENCRYPTION_KEYS або
+// DB_ENCRYPTION_KEYS_FILE, або nil, якщо шифрування не налаштоване. Ключі перевіряються
+// одразу, щоб помилка конфігурації була видна до відкриття бази.
+func keyProviderFromEnv() (datastore.KeyProvider, error) {
+	var provider datastore.KeyProvider
+	switch env, file := config.Getenv("DB_ENCRYPTION_KEYS"), config.Getenv("DB_ENCRYPTION_KEYS_FILE"); {
+	case env != "" && file != "":
+		return nil, fmt.Errorf("DB_ENCRYPTION_KEYS and DB_ENCRYPTION_KEYS_FILE are mutually exclusive")
+	case env != "":
+		provider = datastore.KeysFromEnv("DB_ENCRYPTION_KEYS")
+	case file != "":
+		provider = datastore.KeysFromFile(file)
+	default:
+		return nil, nil
+	}
+	if _, _, err := provider.EncryptionKeys(); err != nil {
+		return nil, fmt.Errorf("invalid encryption keys: %w", err)
+	}
+	return provider, nil
+}
+
+// logSlowOp записує в журнал операцію сховища, що перевищила DB_SLOW_OP_THRESHOLD.
+func logSlowOp(op datastore.SlowOp) {
+	if op.Key != "" {
+		log.Printf("DB_SERVER: Slow %s of key '%s' took %s (segments %v)", op.Op, op.Key, op.Elapsed, op.Segments)
+		return
+	}
+	log.Printf("DB_SERVER: Slow %s took %s (segments %v)", op.Op, op.Elapsed, op.Segments)
+}
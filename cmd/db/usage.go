@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Wandestes/software-architecture_4/config"
+)
+
+const (
+	anonymousToken     = "anonymous"
+	quotaWarningHeader = "X-Quota-Warning"
+)
+
+// QuotaLimits - ліміти на токен. Нульове значення означає відсутність ліміту.
+type QuotaLimits struct {
+	SoftBytes int64 `json:"softBytes,omitempty"`
+	HardBytes int64 `json:"hardBytes,omitempty"`
+	SoftOps   int64 `json:"softOps,omitempty"`
+	HardOps   int64 `json:"hardOps,omitempty"`
+}
+
+// TokenUsage - накопичене споживання одного токена. Token - це tokenID, а не сам токен.
+type TokenUsage struct {
+	Token        string `json:"token"`
+	BytesWritten int64  `json:"bytesWritten"`
+	Reads        int64  `json:"reads"`
+	Writes       int64  `json:"writes"`
+	Deletes      int64  `json:"deletes"`
+	Rejected     int64  `json:"rejected"`
+	SoftExceeded bool   `json:"softExceeded"`
+}
+
+func (u *TokenUsage) ops() int64 {
+	return u.Reads + u.Writes + u.Deletes
+}
+
+type usageTracker struct {
+	mu     sync.Mutex
+	limits QuotaLimits
+	usage  map[string]*TokenUsage
+}
+
+func newUsageTracker(limits QuotaLimits) *usageTracker {
+	return &usageTracker{limits: limits, usage: make(map[string]*TokenUsage)}
+}
+
+func quotaLimitsFromEnv() QuotaLimits {
+	return QuotaLimits{
+		SoftBytes: envInt64("DB_QUOTA_SOFT_BYTES"),
+		HardBytes: envInt64("DB_QUOTA_HARD_BYTES"),
+		SoftOps:   envInt64("DB_QUOTA_SOFT_OPS"),
+		HardOps:   envInt64("DB_QUOTA_HARD_OPS"),
+	}
+}
+
+func envInt64(name string) int64 {
+	raw := config.Getenv(name)
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v < 0 {
+		log.Printf("DB_SERVER: Warning: ignoring invalid %s=%q", name, raw)
+		return 0
+	}
+	return v
+}
+
+// requestToken повертає токен з заголовка Authorization: Bearer <token>.
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok && strings.TrimSpace(token) != "" {
+		return strings.TrimSpace(token)
+	}
+	return anonymousToken
+}
+
+// maskToken приховує більшу частину токена у звітах та логах.
+func maskToken(token string) string {
+	if token == anonymousToken || len(token) <= 4 {
+		return token
+	}
+	return token[:4] + "***"
+}
+
+// tokenID - ідентифікатор токена у звіті споживання: hex SHA-256. На відміну від
+// префікса з maskToken, різні токени не зливаються в один рядок звіту.
+func tokenID(token string) string {
+	if token == anonymousToken {
+		return token
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *usageTracker) get(token string) *TokenUsage {
+	u, ok := t.usage[token]
+	if !ok {
+		u = &TokenUsage{Token: tokenID(token)}
+		t.usage[token] = u
+	}
+	return u
+}
+
+// checkHard повертає опис перевищеного жорсткого ліміту або порожній рядок.
+func (t *usageTracker) checkHard(token string, isWrite bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.get(token)
+	if t.limits.HardOps > 0 && u.ops() >= t.limits.HardOps {
+		u.Rejected++
+		return fmt.Sprintf("operation quota exceeded (%d of %d)", u.ops(), t.limits.HardOps)
+	}
+	if isWrite && t.limits.HardBytes > 0 && u.BytesWritten >= t.limits.HardBytes {
+		u.Rejected++
+		return fmt.Sprintf("write quota exceeded (%d of %d bytes)", u.BytesWritten, t.limits.HardBytes)
+	}
+	return ""
+}
+
+// record враховує виконану операцію та повертає попередження, якщо м'який ліміт перевищено.
+func (t *usageTracker) record(token, method string, bytesWritten int64) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.get(token)
+	switch method {
+	case http.MethodPost, http.MethodPut:
+		u.Writes++
+		u.BytesWritten += bytesWritten
+	case http.MethodDelete:
+		u.Deletes++
+	default:
+		u.Reads++
+	}
+	var warnings []string
+	if t.limits.SoftBytes > 0 && u.BytesWritten > t.limits.SoftBytes {
+		warnings = append(warnings, fmt.Sprintf("bytes written %d exceed soft limit %d", u.BytesWritten, t.limits.SoftBytes))
+	}
+	if t.limits.SoftOps > 0 && u.ops() > t.limits.SoftOps {
+		warnings = append(warnings, fmt.Sprintf("operations %d exceed soft limit %d", u.ops(), t.limits.SoftOps))
+	}
+	u.SoftExceeded = len(warnings) > 0
+	return strings.Join(warnings, "; ")
+}
+
+func (t *usageTracker) snapshot() []TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]TokenUsage, 0, len(t.usage))
+	for _, u := range t.usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Token < result[j].Token })
+	return result
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// quotaWriter додає заголовок попередження перед тим, як обробник запише статус.
+type quotaWriter struct {
+	http.ResponseWriter
+	warn        func() string
+	wroteHeader bool
+}
+
+func (w *quotaWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if warning := w.warn(); warning != "" {
+			w.Header().Set(quotaWarningHeader, warning)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *quotaWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware відхиляє запити понад жорсткі ліміти та веде облік споживання за токенами.
+func (t *usageTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		isWrite := r.Method == http.MethodPost || r.Method == http.MethodPut
+		if reason := t.checkHard(token, isWrite); reason != "" {
+			log.Printf("DB_SERVER: Rejecting %s %s for token %s: %s", r.Method, r.URL.Path, maskToken(token), reason)
+			writeJSON(w, http.StatusTooManyRequests, DbResponse{ErrorInfo: newErrorInfo(codeQuotaExceeded, false, reason)})
+			return
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		qw := &quotaWriter{ResponseWriter: w}
+		qw.warn = func() string {
+			warning := t.record(token, r.Method, body.n)
+			if warning != "" {
+				log.Printf("DB_SERVER: Soft quota warning for token %s: %s", maskToken(token), warning)
+			}
+			return warning
+		}
+		next.ServeHTTP(qw, r)
+		if !qw.wroteHeader {
+			qw.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+// UsageReport - відповідь GET /admin/usage (потребує токена адміністратора)
+type UsageReport struct {
+	Limits QuotaLimits  `json:"limits"`
+	Tokens []TokenUsage `json:"tokens"`
+}
+
+func (t *usageTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UsageReport{Limits: t.limits, Tokens: t.snapshot()})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUsageTracker_SoftAndHardLimits(t *testing.T) {
+	originalUsage := usage
+	defer func() { usage = originalUsage }()
+	defer func(token string) { adminToken = token }(adminToken)
+	adminToken = "admin-secret"
+	usage = newUsageTracker(QuotaLimits{SoftOps: 1, HardOps: 3})
+	router := newRouter()
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer team-alpha-token")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/db/usage-key", `{"value":"v"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get(quotaWarningHeader) != "" {
+		t.Fatalf("first request returned %d, warning %q", rec.Code, rec.Header().Get(quotaWarningHeader))
+	}
+	rec = send(http.MethodGet, "/db/usage-key", "")
+	if rec.Code != http.StatusOK || rec.Header().Get(quotaWarningHeader) == "" {
+		t.Fatalf("request over soft limit returned %d without warning header", rec.Code)
+	}
+	send(http.MethodGet, "/db/usage-key", "")
+	rec = send(http.MethodGet, "/db/usage-key", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over hard limit returned %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	rec = send(http.MethodGet, "/admin/usage", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("usage report with a non-admin token returned %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var report UsageReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode usage report: %v", err)
+	}
+	if len(report.Tokens) != 1 {
+		t.Fatalf("expected usage for one token, got %+v", report.Tokens)
+	}
+	u := report.Tokens[0]
+	if u.Token != tokenID("team-alpha-token") || u.Writes != 1 || u.Reads != 2 || u.Rejected != 1 || u.BytesWritten == 0 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestTokenID_DistinguishesSharedPrefix(t *testing.T) {
+	tracker := newUsageTracker(QuotaLimits{})
+	tracker.record("team-alpha", http.MethodGet, 0)
+	tracker.record("team-beta", http.MethodGet, 0)
+	tracker.record(anonymousToken, http.MethodGet, 0)
+	report := tracker.snapshot()
+	if len(report) != 3 {
+		t.Fatalf("expected three usage rows, got %+v", report)
+	}
+	for _, u := range report {
+		if strings.HasPrefix(u.Token, "team") {
+			t.Errorf("usage report exposes a token prefix: %q", u.Token)
+		}
+	}
+	if tokenID("team-alpha") == tokenID("team-beta") {
+		t.Error("tokens with a shared prefix got the same id")
+	}
+}
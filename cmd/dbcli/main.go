@@ -0,0 +1,251 @@
+// dbcli - інструменти для роботи з базою: з файлами напряму, без сервера БД (archive, db),
+// або через HTTP API працюючого сервера БД (keys).
+//
+//	dbcli archive list -dir ./out
+//	dbcli archive extract -dir ./out -key mykey [-merge merge-1700000000000000000] [-keys-file keys.txt]
+//	dbcli db verify -dir ./out [-keys-file keys.txt]
+//	dbcli db export -dir ./out [-keys-file keys.txt] > data.jsonl
+//	dbcli db import -dir ./out -in data.jsonl [-keys-file keys.txt]
+//	dbcli keys rename -db-url http://db:8081/db -mapping renames.txt [-dry-run]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Wandestes/software-architecture_4/datastore"
+	"github.com/Wandestes/software-architecture_4/keyrename"
+)
+
+const usage = `usage:
+  dbcli archive list -dir <db dir>
+  dbcli archive extract -dir <db dir> -key <key> [-merge <merge>] [-keys-file <file>]
+  dbcli db verify -dir <db dir> [-keys-file <file>]
+  dbcli db export -dir <db dir> [-keys-file <file>]
+  dbcli db import -dir <db dir> -in <file or -> [-keys-file <file>]
+  dbcli keys rename -db-url <DB service URL> -mapping <file> [-dry-run]`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	switch args[0] + " " + args[1] {
+	case "archive list":
+		return archiveList(args[2:], out)
+	case "archive extract":
+		return archiveExtract(args[2:], out)
+	case "db verify":
+		return dbVerify(args[2:], out)
+	case "db export":
+		return dbExport(args[2:], out)
+	case "db import":
+		return dbImport(args[2:], out)
+	case "keys rename":
+		return keysRename(args[2:], out)
+	}
+	return errUsage
+}
+
+// archiveList виводить сегменти архіву бази.
+func archiveList(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("archive list", flag.ContinueOnError)
+	dir := fs.String("dir", "", "database directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errUsage
+	}
+	segments, err := datastore.ListArchive(*dir)
+	if err != nil {
+		return fmt.Errorf("failed to list archive: %w", err)
+	}
+	if segments == nil {
+		segments = []datastore.ArchivedSegment{}
+	}
+	return writeJSON(out, segments)
+}
+
+// archiveExtract виводить версії ключа з архіву, за потреби лише з одного злиття.
+func archiveExtract(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("archive extract", flag.ContinueOnError)
+	dir := fs.String("dir", "", "database directory")
+	key := fs.String("key", "", "key to extract")
+	merge := fs.String("merge", "", "only versions archived by this merge")
+	keysFile := fs.String("keys-file", "", "encryption keys of the database (id:base64 per line)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || *key == "" {
+		return errUsage
+	}
+	var keys datastore.KeyProvider
+	if *keysFile != "" {
+		keys = datastore.KeysFromFile(*keysFile)
+	}
+	versions, err := datastore.ArchivedVersionsWithKeys(*dir, *key, keys)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	result := []datastore.ArchivedValue{}
+	for _, v := range versions {
+		if *merge == "" || v.Merge == *merge {
+			result = append(result, v)
+		}
+	}
+	return writeJSON(out, result)
+}
+
+// dbVerify відкриває зупинену базу, перевіряє її сегменти та індекс (datastore.Db.Verify)
+// і виводить звіт. Повертає помилку, якщо знайдено хоч одну проблему.
+func dbVerify(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("db verify", flag.ContinueOnError)
+	dir := fs.String("dir", "", "database directory; the DB server must be stopped")
+	keysFile := fs.String("keys-file", "", "encryption keys of the database (id:base64 per line)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errUsage
+	}
+	db, err := openStopped(*dir, *keysFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	report, err := db.Verify(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to verify database: %w", err)
+	}
+	if err := writeJSON(out, report); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("found %d problems in %d segments", len(report.Problems), report.Segments)
+	}
+	return nil
+}
+
+// dbExport відкриває зупинену базу та виводить усі її ключі у форматі JSON Lines
+// (datastore.Db.Export).
+func dbExport(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("db export", flag.ContinueOnError)
+	dir := fs.String("dir", "", "database directory; the DB server must be stopped")
+	keysFile := fs.String("keys-file", "", "encryption keys of the database (id:base64 per line)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errUsage
+	}
+	db, err := openStopped(*dir, *keysFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Export(out); err != nil {
+		return fmt.Errorf("failed to export database: %w", err)
+	}
+	return nil
+}
+
+// dbImport відкриває зупинену базу (за потреби створює її) і записує в неї ключі,
+// експортовані dbExport (datastore.Db.Import).
+func dbImport(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("db import", flag.ContinueOnError)
+	dir := fs.String("dir", "", "database directory; the DB server must be stopped")
+	in := fs.String("in", "", `file written by "db export"; - reads standard input`)
+	keysFile := fs.String("keys-file", "", "encryption keys of the database (id:base64 per line)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || *in == "" {
+		return errUsage
+	}
+	input := io.Reader(os.Stdin)
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	db, err := openStopped(*dir, *keysFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	imported, err := db.Import(input)
+	fmt.Fprintf(out, "imported %d records\n", imported)
+	if err != nil {
+		return fmt.Errorf("failed to import: %w", err)
+	}
+	return nil
+}
+
+// openStopped відкриває базу, з якою не працює сервер БД, без фонових злиттів і міграцій.
+func openStopped(dir, keysFile string) (*datastore.Db, error) {
+	opts := datastore.DefaultOptions()
+	opts.MergeInterval = -1
+	opts.NoMigrate = true
+	if keysFile != "" {
+		opts.KeyProvider = datastore.KeysFromFile(keysFile)
+	}
+	db, err := datastore.NewDbWithOptions(dir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// keysRename перейменовує ключі в працюючому сервісі БД за файлом відповідностей
+// і виводить звіт. Повертає помилку, якщо хоч один ключ не перенесено.
+func keysRename(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keys rename", flag.ContinueOnError)
+	dbURL := fs.String("db-url", "", "DB service URL, e.g. http://db:8081/db")
+	mappingPath := fs.String("mapping", "", `file with "old-key new-key" per line`)
+	dryRun := fs.Bool("dry-run", false, "only report which keys would be renamed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dbURL == "" || *mappingPath == "" {
+		return errUsage
+	}
+	mapping, err := keyrename.Load(*mappingPath)
+	if err != nil {
+		return err
+	}
+	migrator := &keyrename.Migrator{BaseURL: *dbURL, DryRun: *dryRun}
+	report, err := migrator.Migrate(context.Background(), mapping)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(out, report); err != nil {
+		return err
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d of %d keys were not renamed; run the command again to retry them", len(report.Failed), len(mapping.Renames()))
+	}
+	return nil
+}
+
+func writeJSON(out io.Writer, v any) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
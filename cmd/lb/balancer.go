@@ -1,19 +1,19 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"runtime/debug"
-	"sync"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/roman-mazur/architecture-practice-4-template/httptools"
+	"github.com/Wandestes/software-architecture_4/balancer"
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/selftest"
 	"github.com/roman-mazur/architecture-practice-4-template/signal"
 )
 
@@ -22,262 +22,159 @@ var (
 	timeoutSec = flag.Int("timeout-sec", 3, "request timeout time in seconds")
 	https      = flag.Bool("https", false, "whether backends support HTTPs")
 
-	traceEnabled = flag.Bool("trace", false, "whether to include tracing information into responses")
-)
+	traceEnabled = flag.Bool("trace", config.Getenv("LB_TRACE") == "true", "whether to include tracing information into responses (default from LB_TRACE)")
+	stateFile    = flag.String("state-file", "", "path to a file used to persist backend registry and health state across restarts")
+	selfTest     = flag.Bool("selftest", false, "validate configuration, probe backends and exit")
+	backendsFile = flag.String("backends-file", "", "file listing backends (host:port per line); re-read on SIGHUP")
 
-type Server struct {
-	URL          *url.URL
-	ActiveConns  int64
-	IsHealthy    bool
-	mutex        sync.RWMutex
-	ReverseProxy *httputil.ReverseProxy
-}
+	slowThreshold = flag.Duration("slow-threshold", httptools.DefaultSlowThreshold, "requests slower than this are recorded in /admin/slowlog (0 disables)")
+	slowLogSize   = flag.Int("slowlog-size", httptools.DefaultSlowLogSize, "number of slow requests kept in /admin/slowlog")
 
-func (s *Server) IncrementActiveConns() {
-	s.mutex.Lock()
-	s.ActiveConns++
-	s.mutex.Unlock()
-}
+	peerList     = flag.String("peers", "", "comma-separated host:port of other balancer replicas to share backend health and load with")
+	strategyName = flag.String("strategy", "least-conn", "how to pick a backend: least-conn (own connection count) or reported-load (load reported by backends on GET /load)")
+	canaryPath   = flag.String("canary-path", config.Getenv("LB_CANARY_PATH"), "end-to-end request (e.g. /api/v1/some-data?key=_canary) sent to each backend after /health; failures mark the backend unhealthy (default from LB_CANARY_PATH)")
+)
 
-func (s *Server) DecrementActiveConns() {
-	s.mutex.Lock()
-	if s.ActiveConns > 0 {
-		s.ActiveConns--
-	}
-	s.mutex.Unlock()
+var serverDefaultURLs = []string{
+	"server1:8080",
+	"server2:8080",
+	"server3:8080",
 }
 
-func (s *Server) GetActiveConns() int64 {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.ActiveConns
+// newBalancer створює балансувальник за прапорцями командного рядка.
+// Кожна зміна реєстру зберігається у -state-file.
+func newBalancer() *balancer.Balancer {
+	// Назву стратегії перевіряє checkStartup.
+	strategy, _ := balancer.ParseStrategy(*strategyName)
+	var lb *balancer.Balancer
+	lb = balancer.New(balancer.Options{
+		HTTPS:    *https,
+		Timeout:  time.Duration(*timeoutSec) * time.Second,
+		Trace:    *traceEnabled,
+		OnChange: func() { persistState(lb) },
+		Strategy: strategy,
+		Peers:    peerHosts(),
+		Canary:   canary(),
+	})
+	return lb
 }
 
-func (s *Server) SetHealth(status bool) {
-	s.mutex.Lock()
-	s.IsHealthy = status
-	s.mutex.Unlock()
+// peerHosts повертає адреси інших реплік балансувальника з -peers.
+func peerHosts() []string {
+	var peers []string
+	for _, peer := range strings.Split(*peerList, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
 }
 
-func (s *Server) GetHealth() bool {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.IsHealthy
+// newFrontend повертає обробник балансувальника. Журнал повільних запитів slowLog і стан
+// бекендів для інших реплік обслуговуються самим балансувальником і не передаються бекендам.
+func newFrontend(lb *balancer.Balancer, slowLog *httptools.SlowLog) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/slowlog", slowLog)
+	mux.Handle("GET "+balancer.PeerStatePath, lb.PeerStateHandler())
+	mux.Handle("/", slowLog.Middleware("Balancer")(lb.Handler()))
+	return mux
 }
 
-var (
-	timeout           time.Duration
-	serverDefaultURLs = []string{
-		"server1:8080",
-		"server2:8080",
-		"server3:8080",
+// checkStartup виводить конфігурацію балансувальника, перевіряє оточення та повертає список бекендів.
+func checkStartup() ([]string, error) {
+	startup := selftest.NewStartup("lb")
+	startup.Config(config.EnvVar, os.Getenv(config.EnvVar))
+	startup.Config("-port", *port)
+	startup.Config("-timeout-sec", *timeoutSec)
+	startup.Config("-https", *https)
+	startup.Config("-trace", *traceEnabled)
+	startup.Config("-state-file", *stateFile)
+	startup.Config("-backends-file", *backendsFile)
+	startup.Config("-slow-threshold", *slowThreshold)
+	startup.Config("-strategy", *strategyName)
+	startup.Config("-peers", *peerList)
+	startup.Config("-canary-path", *canaryPath)
+	startup.Check(config.EnvVar+" is valid", func() error {
+		_, err := config.Current()
+		return err
+	})
+	startup.Check("port is available", func() error { return selftest.CheckPort(strconv.Itoa(*port)) })
+	startup.Check("timeout is positive", func() error {
+		if *timeoutSec <= 0 {
+			return fmt.Errorf("invalid -timeout-sec %d: must be at least 1 second", *timeoutSec)
+		}
+		return nil
+	})
+	startup.Check("strategy is known", func() error {
+		_, err := balancer.ParseStrategy(*strategyName)
+		return err
+	})
+	startup.Check("canary path is valid", func() error { return checkCanaryPath(*canaryPath) })
+	if *stateFile != "" {
+		startup.Check("state file directory is writable", func() error { return selftest.CheckWritableFile(*stateFile) })
 	}
-	servers     []*Server
-	globalMutex sync.RWMutex
-)
-
-func scheme() string {
-	if *https {
-		return "https"
+	hosts, err := backendHosts()
+	startup.Check("backends are configured", func() error { return err })
+	for _, host := range hosts {
+		startup.Check("backend "+host+" is host:port", func() error { return selftest.CheckHostPort(host) })
+	}
+	for _, peer := range peerHosts() {
+		startup.Check("peer "+peer+" is host:port", func() error { return selftest.CheckHostPort(peer) })
 	}
-	return "http"
+	if err := startup.Run(os.Stderr); err != nil {
+		return nil, err
+	}
+	return hosts, nil
 }
 
-func checkServerHealth(s *Server) bool {
-	healthURL := fmt.Sprintf("%s://%s/health", s.URL.Scheme, s.URL.Host)
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
-	if err != nil {
-		log.Printf("Error creating health check request for %s (%s): %v", s.URL.Host, healthURL, err)
-		return false
+func main() {
+	flag.Parse()
+	if *selfTest {
+		os.Exit(runSelfTest())
 	}
 
-	healthCheckClient := http.Client{Timeout: timeout}
-	resp, err := healthCheckClient.Do(req)
-
+	hosts, err := checkStartup()
 	if err != nil {
-		log.Printf("Health check failed for %s (%s): %v", s.URL.Host, healthURL, err)
-		return false
+		log.Fatalf("Balancer: Refusing to start: %v", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Health check for %s (%s) returned status %d, expected %d", s.URL.Host, healthURL, resp.StatusCode, http.StatusOK)
-		return false
-	}
-	return true
-}
-
-func forward(dst *Server, rw http.ResponseWriter, r *http.Request) error {
-	dst.IncrementActiveConns()
-	log.Printf("Balancer: Forwarding to %s, active connections now: %d, for request: %s", dst.URL.Host, dst.GetActiveConns(), r.URL.Path)
-
-	defer func() {
-		dst.DecrementActiveConns()
-		log.Printf("Balancer: Finished request for %s, active connections now: %d, for request: %s", dst.URL.Host, dst.GetActiveConns(), r.URL.Path)
-	}()
-
-	if *traceEnabled {
-		rw.Header().Set("lb-from", dst.URL.Host)
+	// Стан читається до створення реєстру, бо кожна зміна реєстру перезаписує файл стану.
+	var state *balancerState
+	if *stateFile != "" {
+		if state, err = loadState(*stateFile); err != nil {
+			log.Printf("Balancer state: failed to restore state from %s: %v", *stateFile, err)
+		}
 	}
-
-	log.Printf("Balancer: About to call ReverseProxy.ServeHTTP for %s on %s", r.URL.Path, dst.URL.Host)
-	dst.ReverseProxy.ServeHTTP(rw, r)
-	log.Printf("Balancer: Returned from ReverseProxy.ServeHTTP for %s on %s", r.URL.Path, dst.URL.Host)
-	return nil
-}
-
-func selectLeastLoadedServer() *Server {
-	globalMutex.RLock()
-	defer globalMutex.RUnlock()
-
-	var selected *Server
-	minConns := int64(-1)
-
-	for _, server := range servers {
-		if server.GetHealth() {
-			serverConns := server.GetActiveConns()
-			if selected == nil || serverConns < minConns {
-				selected = server
-				minConns = serverConns
-			}
+	lb := newBalancer()
+	for _, host := range hosts {
+		if _, err := lb.AddBackend(host); err != nil {
+			log.Fatalf("Error creating backend %s: %v", host, err)
 		}
 	}
-	return selected
-}
-
-func startHealthChecks(wg *sync.WaitGroup) {
-	globalMutex.RLock()
-	serversToMonitor := make([]*Server, len(servers))
-	copy(serversToMonitor, servers)
-	globalMutex.RUnlock()
-
-	for _, server := range serversToMonitor {
-		wg.Add(1)
-		go func(s *Server) {
-			initialStatus := checkServerHealth(s)
-			s.SetHealth(initialStatus)
-			log.Printf("Initial health check: %s healthy: %t, active connections: %d", s.URL.Host, s.GetHealth(), s.GetActiveConns())
-			wg.Done()
-
-			ticker := time.NewTicker(10 * time.Second)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					currentStatus := s.GetHealth()
-					newStatus := checkServerHealth(s)
-					if newStatus != currentStatus {
-						log.Printf("Health status change: %s from %t to %t", s.URL.Host, currentStatus, newStatus)
-					}
-					s.SetHealth(newStatus)
-				}
-			}
-		}(server)
+	restored := state != nil && lb.Restore(state.Backends)
+
+	initialChecks := lb.StartHealthChecks()
+	if restored {
+		log.Println("Balancer state restored, initial health checks continue in background.")
+	} else {
+		log.Println("Waiting for initial health checks to complete...")
+		<-initialChecks
+		log.Println("Initial health checks completed.")
 	}
-}
-
-func main() {
-	flag.Parse()
-	timeout = time.Duration(*timeoutSec) * time.Second
-
-	servers = make([]*Server, 0, len(serverDefaultURLs))
-	for _, serverURLStr := range serverDefaultURLs {
-		fullServerURL := fmt.Sprintf("%s://%s", scheme(), serverURLStr)
-		parsedURL, err := url.Parse(fullServerURL)
-		if err != nil {
-			log.Fatalf("Error parsing server URL %s: %v", fullServerURL, err)
-		}
-
-		proxy := httputil.NewSingleHostReverseProxy(parsedURL)
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-			req.Host = parsedURL.Host
-		}
-
-		proxy.Transport = &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			ForceAttemptHTTP2:     false,
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		}
-
-		proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-			log.Printf("[PROXY ERROR] Target: %s, Request: %s %s, Error: %v", parsedURL.Host, req.Method, req.URL.Path, err)
-			if rw.Header().Get("X-Balancer-Response-Sent") == "" {
-				rw.Header().Set("X-Balancer-Response-Sent", "true")
-				if err == context.Canceled || err == context.DeadlineExceeded || err == http.ErrAbortHandler {
-					log.Printf("ReverseProxy error likely client abort/cancel or request timeout for host %s: %v", parsedURL.Host, err)
-				} else {
-					log.Printf("Sending 502 Bad Gateway to client due to ReverseProxy error to host %s: %v", parsedURL.Host, err)
-					http.Error(rw, fmt.Sprintf("Bad Gateway: Error connecting to backend server %s", parsedURL.Host), http.StatusBadGateway)
-				}
-			} else {
-				log.Printf("Headers already sent, cannot send error response for host %s: %v", parsedURL.Host, err)
-			}
-		}
+	go func() {
+		<-initialChecks
+		persistState(lb)
+	}()
 
-		servers = append(servers, &Server{
-			URL:          parsedURL,
-			ActiveConns:  0,
-			IsHealthy:    false,
-			ReverseProxy: proxy,
-		})
+	if *backendsFile != "" {
+		go watchReloadSignal(lb, *backendsFile)
 	}
 
-	var initialHealthCheckWg sync.WaitGroup
-	startHealthChecks(&initialHealthCheckWg)
-
-	log.Println("Waiting for initial health checks to complete...")
-	initialHealthCheckWg.Wait()
-	log.Println("Initial health checks completed.")
-
-	frontend := httptools.CreateServer(*port, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if rcv := recover(); rcv != nil {
-				log.Printf("PANIC in balancer handler: %v\n%s", rcv, string(debug.Stack()))
-				if rw.Header().Get("X-Balancer-Response-Sent") == "" {
-					http.Error(rw, "Internal Server Error", http.StatusInternalServerError)
-				}
-			}
-		}()
-
-		log.Printf("Balancer HTTP Handler: Received request for %s from %s", r.URL.String(), r.RemoteAddr)
-
-		selectedServer := selectLeastLoadedServer()
-		if selectedServer == nil {
-			log.Printf("Balancer HTTP Handler: No healthy servers available for %s", r.URL.String())
-			if rw.Header().Get("X-Balancer-Response-Sent") == "" {
-				rw.Header().Set("X-Balancer-Response-Sent", "true")
-				http.Error(rw, "Service unavailable: No healthy backend servers", http.StatusServiceUnavailable)
-			}
-			return
-		}
-
-		log.Printf("Balancer HTTP Handler: Selected server %s for request %s", selectedServer.URL.Host, r.URL.String())
-		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(*timeoutSec)*time.Second)
-		defer cancel()
-
-		err := forward(selectedServer, rw, r.WithContext(ctx))
-		if err != nil {
-			log.Printf("Balancer HTTP Handler: Forwarding function returned an error: %v for %s", err, r.URL.String())
-		}
-		log.Printf("Balancer HTTP Handler: Finished processing request for %s", r.URL.String())
-	}))
+	frontend := httptools.CreateServer(*port, newFrontend(lb, httptools.NewSlowLog(*slowThreshold, *slowLogSize)))
 
 	log.Printf("Load balancer starting on port %d...", *port)
 	frontend.Start()
 	signal.WaitForTerminationSignal()
 	log.Println("Load balancer shutting down...")
+	lb.Close()
+	persistState(lb)
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Wandestes/software-architecture_4/balancer"
+)
+
+// canary повертає наскрізну перевірку бекендів за -canary-path; порожній шлях її вимикає.
+// Для шляхів /api/v1/some-data відповідь перевіряється за схемою API, для інших
+// приймається лише 200 OK.
+func canary() balancer.Canary {
+	if *canaryPath == "" {
+		return balancer.Canary{}
+	}
+	c := balancer.Canary{Path: *canaryPath}
+	if u, err := url.Parse(*canaryPath); err == nil && u.Path == "/api/v1/some-data" {
+		c.Validate = someDataValidator(u.Query().Get("key"))
+	}
+	return c
+}
+
+// checkCanaryPath перевіряє, що -canary-path - шлях із необов'язковими параметрами запиту.
+func checkCanaryPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	u, err := url.Parse(path)
+	if err != nil || !strings.HasPrefix(path, "/") || u.Host != "" {
+		return fmt.Errorf("invalid -canary-path %q: expected a path such as /api/v1/some-data?key=_canary", path)
+	}
+	return nil
+}
+
+// someDataValidator перевіряє відповідь GET /api/v1/some-data?key=key. 404 означає, що
+// запит пройшов до сервісу БД і ключа там немає, тож canary-ключ не обов'язково записувати.
+// 200 має містити JSON-об'єкт з тим самим ключем і значенням.
+func someDataValidator(key string) func(status int, body []byte) error {
+	return func(status int, body []byte) error {
+		switch status {
+		case http.StatusNotFound:
+			return nil
+		case http.StatusOK:
+		default:
+			return fmt.Errorf("status %d, expected %d or %d", status, http.StatusOK, http.StatusNotFound)
+		}
+		var resp struct {
+			Key   string          `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("response is not a JSON object: %w", err)
+		}
+		if resp.Key != key {
+			return fmt.Errorf("response is for key %q, expected %q", resp.Key, key)
+		}
+		if len(resp.Value) == 0 {
+			return fmt.Errorf("response for key %q has no value", key)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSomeDataValidator(t *testing.T) {
+	validate := someDataValidator("_canary")
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		ok     bool
+	}{
+		{"value", http.StatusOK, `{"key":"_canary","value":"2024-01-01"}`, true},
+		{"missing key", http.StatusNotFound, "", true},
+		{"server error", http.StatusInternalServerError, "Internal server error (DB unreachable)", false},
+		{"not json", http.StatusOK, "<html>", false},
+		{"other key", http.StatusOK, `{"key":"other","value":1}`, false},
+		{"no value", http.StatusOK, `{"key":"_canary"}`, false},
+	} {
+		if err := validate(tc.status, []byte(tc.body)); (err == nil) != tc.ok {
+			t.Errorf("%s: validate returned %v, want ok %t", tc.name, err, tc.ok)
+		}
+	}
+}
+
+func TestCheckCanaryPath(t *testing.T) {
+	for path, ok := range map[string]bool{
+		"":                                true,
+		"/api/v1/some-data?key=_canary":   true,
+		"api/v1/some-data":                false,
+		"http://server1:8080/api/v1/data": false,
+	} {
+		if err := checkCanaryPath(path); (err == nil) != ok {
+			t.Errorf("checkCanaryPath(%q) = %v, want ok %t", path, err, ok)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/balancer"
+	"github.com/Wandestes/software-architecture_4/httptools"
+)
+
+// failoverClient імітує клієнта, для якого ім'я балансувальника має кілька адрес у DNS:
+// кожне з'єднання встановлюється з першою адресою, що відповідає.
+func failoverClient(addrs ...string) *http.Client {
+	dialer := &net.Dialer{Timeout: time.Second}
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var lastErr error
+				for _, addr := range addrs {
+					conn, err := dialer.DialContext(ctx, network, addr)
+					if err == nil {
+						return conn, nil
+					}
+					lastErr = err
+				}
+				return nil, lastErr
+			},
+		},
+	}
+}
+
+func TestBalancerReplicas_FailoverWithoutDowntime(t *testing.T) {
+	backend := func(name string, healthy *atomic.Bool) *httptest.Server {
+		healthy.Store(true)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" && !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, name)
+		}))
+	}
+	var healthy1, healthy2 atomic.Bool
+	backend1, backend2 := backend("one", &healthy1), backend("two", &healthy2)
+	defer backend1.Close()
+	defer backend2.Close()
+
+	// Репліки знають адреси одна одної ще до запуску. Друга репліка після першої перевірки
+	// дізнається про здоров'я бекендів лише від першої.
+	healthIntervals := []time.Duration{20 * time.Millisecond, time.Hour}
+	frontends := []*httptest.Server{httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)}
+	replicas := make([]*balancer.Balancer, len(frontends))
+	for i, frontend := range frontends {
+		peer := frontends[1-i].Listener.Addr().String()
+		replicas[i] = balancer.New(balancer.Options{
+			HealthInterval: healthIntervals[i],
+			PeerInterval:   20 * time.Millisecond,
+			Peers:          []string{peer},
+		})
+		// За рівного навантаження обирається бекенд, доданий першим.
+		for _, backend := range []*httptest.Server{backend2, backend1} {
+			u, _ := url.Parse(backend.URL)
+			if _, err := replicas[i].AddBackend(u.Host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		frontend.Config.Handler = newFrontend(replicas[i], httptools.NewSlowLog(0, 1))
+		frontend.Start()
+		defer replicas[i].Close()
+		defer frontend.Close()
+	}
+	for _, lb := range replicas {
+		<-lb.StartHealthChecks()
+	}
+
+	client := failoverClient(frontends[0].Listener.Addr().String(), frontends[1].Listener.Addr().String())
+	get := func(client *http.Client) (string, error) {
+		resp, err := client.Get("http://lb/api/v1/some-data")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("status %d: %s", resp.StatusCode, body)
+		}
+		return string(body), nil
+	}
+
+	// Друга репліка перестає використовувати бекенд, щойно перша побачить його нездоровим.
+	healthy2.Store(false)
+	second := failoverClient(frontends[1].Listener.Addr().String())
+	deadline := time.Now().Add(2 * time.Second)
+	for routed := 0; routed < 10; {
+		if name, err := get(second); err == nil && name == "one" {
+			routed++
+		} else {
+			routed = 0
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the second replica kept routing to the backend the first one found unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	healthy2.Store(true)
+
+	// Перша репліка зупиняється посеред потоку запитів; клієнт переходить на другу без помилок.
+	failed := 0
+	for i := 0; i < 200; i++ {
+		if i == 50 {
+			frontends[0].Close()
+			replicas[0].Close()
+		}
+		if _, err := get(client); err != nil {
+			failed++
+			t.Logf("request %d failed: %v", i, err)
+		}
+	}
+	if failed != 0 {
+		t.Errorf("%d of 200 requests failed while a replica was stopped", failed)
+	}
+}
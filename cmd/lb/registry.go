@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Wandestes/software-architecture_4/balancer"
+)
+
+// backendHosts повертає початковий список бекендів: з -backends-file, якщо його задано,
+// інакше список за замовчуванням.
+func backendHosts() ([]string, error) {
+	if *backendsFile == "" {
+		return serverDefaultURLs, nil
+	}
+	return readBackendsFile(*backendsFile)
+}
+
+// readBackendsFile читає список бекендів: по одному host:port у рядку,
+// порожні рядки та рядки, що починаються з #, пропускаються.
+func readBackendsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backends file %s: %w", path, err)
+	}
+	defer f.Close()
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read backends file %s: %w", path, err)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("backends file %s lists no backends", path)
+	}
+	return hosts, nil
+}
+
+// watchReloadSignal перечитує список бекендів з path щоразу, коли процес отримує SIGHUP.
+func watchReloadSignal(lb *balancer.Balancer, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		hosts, err := readBackendsFile(path)
+		if err == nil {
+			_, _, err = lb.Reload(hosts)
+		}
+		if err != nil {
+			log.Printf("Balancer: Failed to reload backends: %v", err)
+			continue
+		}
+		log.Printf("Balancer: Backends reloaded from %s", path)
+	}
+}
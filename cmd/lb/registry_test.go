@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadBackendsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backends")
+	if err := os.WriteFile(path, []byte("# pool\nserver1:8080\n\n  server2:8080  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := readBackendsFile(path)
+	if err != nil || len(hosts) != 2 || hosts[0] != "server1:8080" || hosts[1] != "server2:8080" {
+		t.Errorf("readBackendsFile = %v, %v", hosts, err)
+	}
+	if err := os.WriteFile(path, []byte("# empty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBackendsFile(path); err == nil {
+		t.Errorf("expected an error for a file without backends")
+	}
+}
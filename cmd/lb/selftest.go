@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Wandestes/software-architecture_4/balancer"
+	"github.com/Wandestes/software-architecture_4/selftest"
+)
+
+// runSelfTest перевіряє прапорці балансувальника та доступність кожного бекенду.
+func runSelfTest() int {
+	report := selftest.New("lb")
+	report.Check("port is valid", func() error {
+		if *port <= 0 || *port > 65535 {
+			return fmt.Errorf("invalid port %d", *port)
+		}
+		return nil
+	})
+	report.Check("timeout is positive", func() error {
+		if *timeoutSec <= 0 {
+			return fmt.Errorf("invalid timeout %d seconds", *timeoutSec)
+		}
+		return nil
+	})
+	report.Check("strategy is known", func() error {
+		_, err := balancer.ParseStrategy(*strategyName)
+		return err
+	})
+	report.Check("canary path is valid", func() error { return checkCanaryPath(*canaryPath) })
+	if *stateFile != "" {
+		report.Check("state file is readable", func() error {
+			_, err := loadState(*stateFile)
+			return err
+		})
+	}
+	hosts, err := backendHosts()
+	report.Check("backends are configured", func() error { return err })
+	lb := newBalancer()
+	for _, host := range hosts {
+		report.Check("backend "+host+" is healthy", func() error { return lb.Probe(host) })
+	}
+	return report.Print(os.Stdout)
+}
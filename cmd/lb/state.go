@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/balancer"
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// stateMaxAge обмежує вік збереженого стану: старіші дані вважаються неактуальними.
+const stateMaxAge = 5 * time.Minute
+
+type balancerState struct {
+	SavedAt  time.Time               `json:"savedAt"`
+	Backends []balancer.BackendState `json:"backends"`
+}
+
+var stateMutex sync.Mutex
+
+func snapshotState(lb *balancer.Balancer) balancerState {
+	return balancerState{SavedAt: time.Now(), Backends: lb.State()}
+}
+
+func saveState(path string, state balancerState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal balancer state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save balancer state: %w", err)
+	}
+	return nil
+}
+
+// loadState читає збережений стан. Повертає nil без помилки, якщо файлу немає
+// або стан застарів.
+func loadState(path string) (*balancerState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read state file %s: %w", path, err)
+	}
+	var state balancerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if time.Since(state.SavedAt) > stateMaxAge {
+		log.Printf("Balancer state: ignoring stale state saved at %s", state.SavedAt.Format(time.RFC3339))
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func persistState(lb *balancer.Balancer) {
+	if *stateFile == "" {
+		return
+	}
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	if err := saveState(*stateFile, snapshotState(lb)); err != nil {
+		log.Printf("Balancer state: %v", err)
+	}
+}
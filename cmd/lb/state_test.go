@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBalancerState_SaveLoadApply(t *testing.T) {
+	lb := newBalancer()
+	for _, host := range []string{"server1:8080", "server2:8080"} {
+		if _, err := lb.AddBackend(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lb.Backends()[0].SetHealth(true)
+	path := filepath.Join(t.TempDir(), "lb-state.json")
+	if err := saveState(path, snapshotState(lb)); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+
+	lb = newBalancer()
+	if _, err := lb.AddBackend("server1:8080"); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadState(path)
+	if err != nil || state == nil {
+		t.Fatalf("loadState returned state %v, err %v", state, err)
+	}
+	if !lb.Restore(state.Backends) {
+		t.Fatal("Restore reported nothing restored")
+	}
+
+	servers := lb.Backends()
+	if len(servers) != 2 {
+		t.Fatalf("expected registry to contain 2 backends after restore, got %d", len(servers))
+	}
+	if !servers[0].GetHealth() {
+		t.Errorf("expected server1 health to be restored as healthy")
+	}
+	if servers[1].URL.Host != "server2:8080" || servers[1].GetHealth() {
+		t.Errorf("expected server2 to be restored as unhealthy, got %s healthy: %t", servers[1].URL.Host, servers[1].GetHealth())
+	}
+}
+
+func TestBalancerState_IgnoresStaleAndMissing(t *testing.T) {
+	dir := t.TempDir()
+	state, err := loadState(filepath.Join(dir, "missing.json"))
+	if err != nil || state != nil {
+		t.Errorf("expected nil state for missing file, got %v, err %v", state, err)
+	}
+
+	path := filepath.Join(dir, "stale.json")
+	if err := saveState(path, balancerState{SavedAt: time.Now().Add(-2 * stateMaxAge)}); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+	state, err = loadState(path)
+	if err != nil || state != nil {
+		t.Errorf("expected stale state to be ignored, got %v, err %v", state, err)
+	}
+}
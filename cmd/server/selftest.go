@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/selftest"
+)
+
+// dbReadyURL будує адресу перевірки готовності сервісу БД з DB_SERVICE_URL.
+func dbReadyURL() (string, error) {
+	if err := selftest.CheckURL(dbServiceURL); err != nil {
+		return "", err
+	}
+	u, _ := url.Parse(dbServiceURL)
+	u.Path = "/ready"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// runSelfTest перевіряє конфігурацію сервера та доступність сервісу БД.
+func runSelfTest(serverPort string) int {
+	report := selftest.New("server")
+	report.Check("SERVER_PORT is a valid port", func() error {
+		p, err := strconv.Atoi(serverPort)
+		if err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid port %q", serverPort)
+		}
+		return nil
+	})
+	report.Check("TEAM_NAME is set", func() error {
+		if teamName == "" {
+			return fmt.Errorf("team name is empty")
+		}
+		return nil
+	})
+	readyURL, err := dbReadyURL()
+	report.Check("DB_SERVICE_URL is valid", func() error { return err })
+	if err == nil {
+		report.Check("DB service is ready", func() error {
+			client := http.Client{Timeout: 3 * time.Second}
+			resp, err := client.Get(readyURL)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("%s returned %s", readyURL, resp.Status)
+			}
+			return nil
+		})
+	}
+	return report.Print(os.Stdout)
+}
@@ -1,154 +1,207 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
+
+	"github.com/Wandestes/software-architecture_4/apiserver"
+	"github.com/Wandestes/software-architecture_4/config"
+	"github.com/Wandestes/software-architecture_4/httptools"
+	"github.com/Wandestes/software-architecture_4/keyrename"
+	"github.com/Wandestes/software-architecture_4/logpolicy"
+	"github.com/Wandestes/software-architecture_4/selftest"
 )
 
+var selfTest = flag.Bool("selftest", false, "validate configuration, check that the DB service is ready and exit")
+
 var (
 	dbServiceURL string
 	teamName     string
 )
 
-// DbValueResponse - структура для десеріалізації відповіді від сервісу БД
-type DbValueResponse struct {
-	Key   string      `json:"key,omitempty"`
-	Value interface{} `json:"value,omitempty"`
-	Error string      `json:"error,omitempty"`
-}
-
 func init() {
-	dbServiceURL = os.Getenv("DB_SERVICE_URL")
+	dbServiceURL = config.Getenv("DB_SERVICE_URL")
 	if dbServiceURL == "" {
 		log.Println("SERVER_MAIN: Warning: DB_SERVICE_URL environment variable not set. Using default http://localhost:8081/db")
 		dbServiceURL = "http://localhost:8081/db"
 	}
 
-	teamName = os.Getenv("TEAM_NAME")
+	teamName = config.Getenv("TEAM_NAME")
 	if teamName == "" {
 		log.Println("SERVER_MAIN: Warning: TEAM_NAME environment variable not set. Using default 'duo'")
 		teamName = "duo"
 	}
+}
 
-	currentDate := time.Now().Format("2006-01-02")
-	postURL := fmt.Sprintf("%s/%s", dbServiceURL, teamName)
-	requestBody, err := json.Marshal(map[string]string{"value": currentDate})
+// newAPIServer збирає API-сервер із залежностей, налаштованих змінними середовища.
+// SERVER_CACHE_TTL (напр. "2s") вмикає кешування прочитаних значень. Якщо задано ще й
+// SERVER_CACHE_TTL_MAX (напр. "1h"), час життя підбирається для кожного ключа між ними за
+// частотою змін значення (див. apiserver.AdaptiveCache); з DEBUG=true підібрані значення
+// віддає /debug/cache-ttls.
+// SERVER_ENCRYPTION_KEYS ("id:base64,...") вмикає шифрування значень; SERVER_ENCRYPTION_KEY_ID
+// обирає ключ для нових записів (за замовчуванням - останній у списку). SERVER_KEY_RENAMES -
+// файл перейменувань ключів (див. пакет keyrename): до SERVER_KEY_RENAMES_UNTIL (RFC 3339)
+// відсутній ключ читається під старою назвою. SERVER_LOG_POLICY - файл політики журналювання
+// значень (див. пакет logpolicy), який перечитується за SIGHUP; чинну політику віддає
+// /admin/log-policy з токеном SERVER_ADMIN_TOKEN. SERVER_HIGH_LOAD - кількість
+// запитів на бекенд пулу за даними балансувальника, з якої сервер відхиляє запити з
+// X-Priority: low і, якщо задано SERVER_STALE_GRACE (напр. "5s"), віддає із кешу значення,
+// застарілі не більше ніж на цей час (див. apiserver.LoadAdaptation). DB_RECORD_FILE
+// вмикає запис звернень до сервісу БД у файл для тестів, див. apiserver.ReplayTransport.
+func newAPIServer() (*apiserver.Server, error) {
+	slowLog, err := httptools.NewSlowLogFromEnv()
 	if err != nil {
-		log.Printf("SERVER_MAIN_INIT: Failed to marshal date for DB: %v", err)
-		return
+		return nil, err
 	}
-
-	log.Printf("SERVER_MAIN_INIT: Attempting to POST initial date '%s' for team '%s' to DB at %s", currentDate, teamName, postURL)
-
-	maxRetries := 5
-	var resp *http.Response
-	for i := 0; i < maxRetries; i++ {
-		resp, err = http.Post(postURL, "application/json", bytes.NewBuffer(requestBody))
-		if err == nil {
-			break
+	var cache apiserver.Cache
+	if raw := config.Getenv("SERVER_CACHE_TTL"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SERVER_CACHE_TTL %q: %w", raw, err)
+		}
+		if ttl > 0 {
+			cache = apiserver.NewMemoryCache(ttl, nil)
+		}
+		if rawMax := config.Getenv("SERVER_CACHE_TTL_MAX"); rawMax != "" && ttl > 0 {
+			maxTTL, err := time.ParseDuration(rawMax)
+			if err != nil || maxTTL < ttl {
+				return nil, fmt.Errorf("invalid SERVER_CACHE_TTL_MAX %q: want a duration not below SERVER_CACHE_TTL", rawMax)
+			}
+			cache = apiserver.NewAdaptiveCache(ttl, maxTTL, nil)
+			log.Printf("SERVER_MAIN: Adapting cache TTLs per key between %v and %v", ttl, maxTTL)
 		}
-		log.Printf("SERVER_MAIN_INIT: Failed to POST initial date (attempt %d/%d): %v. Retrying in 2 seconds...", i+1, maxRetries, err)
-		time.Sleep(2 * time.Second)
-	}
-
-	if err != nil {
-		log.Printf("SERVER_MAIN_INIT: Failed to POST initial date to DB service after %d retries: %v", maxRetries, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("SERVER_MAIN_INIT: DB service returned non-OK status for initial POST: %s, Body: %s", resp.Status, string(bodyBytes))
-	} else {
-		log.Printf("SERVER_MAIN_INIT: Successfully saved current date for team '%s' to DB.", teamName)
 	}
-}
-
-func someDataHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	var encryptor *apiserver.Encryptor
+	if spec := config.Getenv("SERVER_ENCRYPTION_KEYS"); spec != "" {
+		keys, err := apiserver.ParseStaticKeys(spec, config.Getenv("SERVER_ENCRYPTION_KEY_ID"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SERVER_ENCRYPTION_KEYS: %w", err)
+		}
+		if encryptor, err = apiserver.NewEncryptor(keys); err != nil {
+			return nil, err
+		}
+		log.Printf("SERVER_MAIN: Encrypting values with key %q (%d keys configured)", keys.Current, len(keys.Keys))
 	}
-
-	queryKey := r.URL.Query().Get("key")
-	if queryKey == "" {
-		http.Error(w, "Query parameter 'key' is required", http.StatusBadRequest)
-		return
+	var renames *keyrename.Mapping
+	var renamesUntil time.Time
+	if path := config.Getenv("SERVER_KEY_RENAMES"); path != "" {
+		if renames, err = keyrename.Load(path); err != nil {
+			return nil, err
+		}
+		if raw := config.Getenv("SERVER_KEY_RENAMES_UNTIL"); raw != "" {
+			if renamesUntil, err = time.Parse(time.RFC3339, raw); err != nil {
+				return nil, fmt.Errorf("invalid SERVER_KEY_RENAMES_UNTIL %q: %w", raw, err)
+			}
+		}
+		until := "SERVER_KEY_RENAMES is removed"
+		if !renamesUntil.IsZero() {
+			until = renamesUntil.Format(time.RFC3339)
+		}
+		log.Printf("SERVER_MAIN: Reading %d renamed keys under their old names until %s", len(renames.Renames()), until)
 	}
-	log.Printf("SERVER_HANDLER: GET /api/v1/some-data for key: %s", queryKey)
-
-	targetURL := fmt.Sprintf("%s/%s", dbServiceURL, queryKey)
-
-	log.Printf("SERVER_HANDLER: Forwarding GET request to DB service: %s", targetURL)
-	dbResp, err := http.Get(targetURL)
-	if err != nil {
-		log.Printf("SERVER_HANDLER: Error requesting data from DB service for key '%s': %v", queryKey, err)
-		http.Error(w, "Internal server error (DB unreachable)", http.StatusInternalServerError)
-		return
+	logPolicy := logpolicy.New(logpolicy.DefaultPolicy())
+	if path := config.Getenv("SERVER_LOG_POLICY"); path != "" {
+		policy, err := logpolicy.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		logPolicy.Set(policy)
+		logPolicy.ReloadOnSignal(path, "SERVER_MAIN")
 	}
-	defer dbResp.Body.Close()
-
-	if dbResp.StatusCode == http.StatusNotFound {
-		log.Printf("SERVER_HANDLER: Key '%s' not found in DB service.", queryKey)
-		w.WriteHeader(http.StatusNotFound)
-		return
+	var adaptation apiserver.LoadAdaptation
+	if raw := config.Getenv("SERVER_HIGH_LOAD"); raw != "" {
+		if adaptation.HighLoad, err = strconv.ParseFloat(raw, 64); err != nil || adaptation.HighLoad < 0 {
+			return nil, fmt.Errorf("invalid SERVER_HIGH_LOAD %q: want a non-negative number", raw)
+		}
 	}
-
-	if dbResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(dbResp.Body)
-		log.Printf("SERVER_HANDLER: DB service returned non-OK status for key '%s': %s, Body: %s", queryKey, dbResp.Status, string(bodyBytes))
-		http.Error(w, fmt.Sprintf("Error retrieving data from DB: status %s", dbResp.Status), http.StatusInternalServerError)
-		return
+	if raw := config.Getenv("SERVER_STALE_GRACE"); raw != "" {
+		if adaptation.StaleGrace, err = time.ParseDuration(raw); err != nil {
+			return nil, fmt.Errorf("invalid SERVER_STALE_GRACE %q: %w", raw, err)
+		}
 	}
-
-	var dataFromDb DbValueResponse
-	if err := json.NewDecoder(dbResp.Body).Decode(&dataFromDb); err != nil {
-		log.Printf("SERVER_HANDLER: Error decoding response from DB service for key '%s': %v", queryKey, err)
-		http.Error(w, "Internal server error (bad DB response format)", http.StatusInternalServerError)
-		return
+	if adaptation.HighLoad > 0 {
+		log.Printf("SERVER_MAIN: Adapting to pool load above %g requests per backend (stale cache grace %v)", adaptation.HighLoad, adaptation.StaleGrace)
 	}
-
-	if dataFromDb.Error != "" {
-		log.Printf("SERVER_HANDLER: DB service returned an error for key '%s': %s", queryKey, dataFromDb.Error)
-		if dbResp.StatusCode == http.StatusBadRequest {
-			http.Error(w, dataFromDb.Error, http.StatusBadRequest)
-		} else {
-			http.Error(w, dataFromDb.Error, http.StatusInternalServerError)
+	dbClient := apiserver.NewHTTPDBClient(dbServiceURL)
+	if path := config.Getenv("DB_RECORD_FILE"); path != "" {
+		recorder, err := apiserver.NewRecordingTransport(path, nil)
+		if err != nil {
+			return nil, err
 		}
-		return
+		dbClient.Client = &http.Client{Transport: recorder}
+		log.Printf("SERVER_MAIN: Recording DB service interactions to %s", path)
 	}
-
-	log.Printf("SERVER_HANDLER: Successfully retrieved value for key '%s' from DB: %v", queryKey, dataFromDb.Value)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dataFromDb)
-}
-
-// healthHandler обробляє запити /health
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	// Можна додати тіло відповіді, якщо балансувальник його очікує, наприклад:
-	// w.Header().Set("Content-Type", "application/json")
-	// json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
-	log.Printf("SERVER_HANDLER: GET /health -> 200 OK")
+	return apiserver.New(apiserver.Options{
+		DB:        dbClient,
+		Cache:     cache,
+		TeamName:  teamName,
+		SlowLog:   slowLog,
+		Debug:     httptools.DebugEnabled(),
+		Encryptor: encryptor,
+
+		Renames:      renames,
+		RenamesUntil: renamesUntil,
+		LogPolicy:    logPolicy,
+		AdminToken:   config.Getenv("SERVER_ADMIN_TOKEN"),
+		Adaptation:   adaptation,
+	}), nil
 }
 
 func main() {
-	http.HandleFunc("/api/v1/some-data", someDataHandler)
-	http.HandleFunc("/health", healthHandler) // <--- ДОДАНО МАРШРУТ ДЛЯ HEALTH CHECK
-
-	serverPort := os.Getenv("SERVER_PORT")
+	flag.Parse()
+	serverPort := config.Getenv("SERVER_PORT")
 	if serverPort == "" {
 		serverPort = "8080"
 	}
+	if *selfTest {
+		os.Exit(runSelfTest(serverPort))
+	}
+	var api *apiserver.Server
+	startup := selftest.NewStartup("server")
+	startup.Config(config.EnvVar, os.Getenv(config.EnvVar))
+	startup.Config("SERVER_PORT", serverPort)
+	startup.Config("DB_SERVICE_URL", dbServiceURL)
+	startup.Config("TEAM_NAME", teamName)
+	startup.Config("SERVER_CACHE_TTL", config.Getenv("SERVER_CACHE_TTL"))
+	startup.Config("SERVER_CACHE_TTL_MAX", config.Getenv("SERVER_CACHE_TTL_MAX"))
+	startup.Secret("SERVER_ENCRYPTION_KEYS", config.Getenv("SERVER_ENCRYPTION_KEYS"))
+	startup.Config("DEBUG", httptools.DebugEnabled())
+	startup.Config("SERVER_KEY_RENAMES", config.Getenv("SERVER_KEY_RENAMES"))
+	startup.Config("SERVER_KEY_RENAMES_UNTIL", config.Getenv("SERVER_KEY_RENAMES_UNTIL"))
+	startup.Config("SERVER_LOG_POLICY", config.Getenv("SERVER_LOG_POLICY"))
+	startup.Secret("SERVER_ADMIN_TOKEN", config.Getenv("SERVER_ADMIN_TOKEN"))
+	startup.Config("SERVER_HIGH_LOAD", config.Getenv("SERVER_HIGH_LOAD"))
+	startup.Config("SERVER_STALE_GRACE", config.Getenv("SERVER_STALE_GRACE"))
+	startup.Config("DB_RECORD_FILE", config.Getenv("DB_RECORD_FILE"))
+	startup.Check(config.EnvVar+" is valid", func() error {
+		_, err := config.Current()
+		return err
+	})
+	startup.Check("SERVER_PORT is available", func() error { return selftest.CheckPort(serverPort) })
+	startup.Check("DB_SERVICE_URL is valid", func() error { return selftest.CheckURL(dbServiceURL) })
+	if path := config.Getenv("DB_RECORD_FILE"); path != "" {
+		startup.Check("DB_RECORD_FILE directory is writable", func() error { return selftest.CheckWritableFile(path) })
+	}
+	startup.Check("server configuration is valid", func() error {
+		var err error
+		api, err = newAPIServer()
+		return err
+	})
+	if err := startup.Run(os.Stderr); err != nil {
+		log.Fatalf("SERVER_MAIN: Refusing to start: %v", err)
+	}
+
+	if err := api.StoreInitialDate(context.Background()); err != nil {
+		log.Printf("SERVER_MAIN_INIT: %v", err)
+	}
 	log.Printf("SERVER_MAIN: Main server starting on port %s...", serverPort)
-	if err := http.ListenAndServe(":"+serverPort, nil); err != nil {
+	if err := http.ListenAndServe(":"+serverPort, api.Handler()); err != nil {
 		log.Fatalf("SERVER_MAIN: Failed to start main server: %v", err)
 	}
 }
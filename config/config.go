@@ -0,0 +1,99 @@
+// Package config задає профілі конфігурації сервісів для різних середовищ.
+//
+// Профіль, обраний змінною APP_ENV (dev, test або prod), містить значення за замовчуванням
+// для змінних середовища сервісів, тож для типового середовища не треба налаштовувати
+// кожну змінну окремо. Явно задана змінна середовища завжди має пріоритет над профілем.
+// Без APP_ENV профіль не застосовується, і кожен сервіс використовує власні значення
+// за замовчуванням.
+//
+//	dev:  DEBUG=true, SLOW_REQUEST_THRESHOLD=50ms, DB_MAX_FILE_SIZE=65536,
+//	      DB_SYNC_POLICY=never, LB_TRACE=true
+//	test: DB_MAX_FILE_SIZE=4096, DB_SYNC_POLICY=never
+//	prod: DB_SYNC_POLICY=interval, DB_SYNC_INTERVAL=1s; сервер БД не стартує без DB_ADMIN_TOKEN
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvVar - змінна середовища, що обирає профіль.
+const EnvVar = "APP_ENV"
+
+// Profile - значення за замовчуванням для одного середовища.
+type Profile struct {
+	Name string
+	// RequireAuth вимагає від сервісів із захищеними ендпоінтами налаштованих токенів доступу.
+	RequireAuth bool
+	// Defaults - значення змінних середовища, які діють, якщо змінна не задана.
+	Defaults map[string]string
+}
+
+var profiles = map[string]Profile{
+	"dev": {
+		Name: "dev",
+		Defaults: map[string]string{
+			"DEBUG":                  "true",
+			"SLOW_REQUEST_THRESHOLD": "50ms",
+			"DB_MAX_FILE_SIZE":       "65536",
+			"DB_SYNC_POLICY":         "never",
+			"LB_TRACE":               "true",
+		},
+	},
+	"test": {
+		Name: "test",
+		Defaults: map[string]string{
+			"DB_MAX_FILE_SIZE": "4096",
+			"DB_SYNC_POLICY":   "never",
+		},
+	},
+	"prod": {
+		Name:        "prod",
+		RequireAuth: true,
+		Defaults: map[string]string{
+			"DB_SYNC_POLICY":   "interval",
+			"DB_SYNC_INTERVAL": "1s",
+		},
+	},
+}
+
+// Names повертає відсортовані назви профілів.
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup повертає профіль з назвою name.
+func Lookup(name string) (Profile, error) {
+	profile, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown %s %q, expected one of %s", EnvVar, name, strings.Join(Names(), ", "))
+	}
+	return profile, nil
+}
+
+// Current повертає профіль, обраний APP_ENV, або порожній профіль, якщо APP_ENV не задано.
+func Current() (Profile, error) {
+	name := os.Getenv(EnvVar)
+	if name == "" {
+		return Profile{}, nil
+	}
+	return Lookup(name)
+}
+
+// Getenv повертає значення змінної середовища name, а якщо вона не задана або порожня -
+// значення з поточного профілю. Якщо APP_ENV задано неправильно, профіль не застосовується:
+// сервіси повідомляють про це під час запуску (див. Current).
+func Getenv(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	profile, _ := Current()
+	return profile.Defaults[name]
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestGetenv(t *testing.T) {
+	t.Setenv(EnvVar, "")
+	t.Setenv("DEBUG", "")
+	if v := Getenv("DB_SYNC_POLICY"); v != "" {
+		t.Errorf("Getenv without a profile = %q", v)
+	}
+
+	t.Setenv(EnvVar, "Prod")
+	if v := Getenv("DB_SYNC_POLICY"); v != "interval" {
+		t.Errorf("Getenv(DB_SYNC_POLICY) in prod = %q, want interval", v)
+	}
+	if profile, err := Current(); err != nil || !profile.RequireAuth {
+		t.Errorf("Current() in prod = %+v, %v", profile, err)
+	}
+	t.Setenv("DB_SYNC_POLICY", "always")
+	if v := Getenv("DB_SYNC_POLICY"); v != "always" {
+		t.Errorf("explicit variable was overridden by the profile: %q", v)
+	}
+	// Порожня змінна вважається незаданою, як і в сервісах.
+	t.Setenv(EnvVar, "dev")
+	if v := Getenv("DEBUG"); v != "true" {
+		t.Errorf("Getenv(DEBUG) set to empty in dev = %q, want true", v)
+	}
+
+	t.Setenv(EnvVar, "staging")
+	if _, err := Current(); err == nil {
+		t.Error("Current accepted an unknown profile")
+	}
+	if v := Getenv("DB_SYNC_POLICY"); v != "always" {
+		t.Errorf("Getenv with an unknown profile = %q", v)
+	}
+}
@@ -0,0 +1,58 @@
+package datastore
+
+import "strings"
+
+// Int64Stats - агрегати значень int64 за префіксом ключа.
+type Int64Stats struct {
+	Count int64
+	Sum   int64
+	Min   int64
+	Max   int64
+}
+
+// Avg повертає середнє значення або 0, якщо значень немає.
+func (s Int64Stats) Avg() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+// AggregateInt64 обчислює кількість, суму, мінімум та максимум значень int64 для ключів
+// з префіксом prefix. Рядкові значення пропускаються. Усі значення читаються з одного знімку індексу.
+func (db *Db) AggregateInt64(prefix string) (Int64Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var stats Int64Stats
+	var readErr error
+	err := db.ascendKeysLocked(prefix, func(key string, idxVal indexValue, isValue bool) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		if !isValue || idxVal.dataType != DataTypeInt64 {
+			return true
+		}
+		record, err := db.readRecordLocked(key, idxVal)
+		if err != nil {
+			readErr = err
+			return false
+		}
+		v := record.valueInt
+		if stats.Count == 0 || v < stats.Min {
+			stats.Min = v
+		}
+		if stats.Count == 0 || v > stats.Max {
+			stats.Max = v
+		}
+		stats.Sum += v
+		stats.Count++
+		return true
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return Int64Stats{}, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,34 @@
+package datastore
+
+import "testing"
+
+func TestDb_AggregateInt64(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	for key, v := range map[string]int64{"scores_a": 10, "scores_b": -4, "scores_c": 30, "other": 1000} {
+		if err := db.PutInt64(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("scores_name", "not a number"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.AggregateInt64("scores_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Int64Stats{Count: 3, Sum: 36, Min: -4, Max: 30}
+	if stats != want {
+		t.Errorf("AggregateInt64 = %+v, want %+v", stats, want)
+	}
+	if stats.Avg() != 12 {
+		t.Errorf("Avg = %v, want 12", stats.Avg())
+	}
+
+	empty, err := db.AggregateInt64("missing_")
+	if err != nil || empty.Count != 0 || empty.Avg() != 0 {
+		t.Errorf("empty aggregate = %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,335 @@
+package datastore
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// Якщо Options.Archive увімкнено, злиття переносить замінені сегменти в archive/merge-<час злиття, нс>/
+// замість видалення, тож перезаписані або видалені значення можна знайти й після злиття.
+// Архів не читається базою; його переглядають ListArchive та ArchivedVersions (див. cmd/dbcli).
+
+// archiveDirName - піддиректорія бази з архівом сегментів.
+const archiveDirName = "archive"
+
+// archiveGenerationPrefix - префікс директорії сегментів, замінених одним злиттям.
+const archiveGenerationPrefix = "merge-"
+
+// segmentArchive переносить сегменти, замінені одним злиттям, в окрему директорію архіву.
+// nil означає, що архів вимкнено і сегменти видаляються.
+type segmentArchive struct {
+	dir string
+}
+
+// newSegmentArchiveLocked повертає архів для чергового злиття або nil, якщо архів вимкнено.
+// Викликається під db.mu.
+func (db *Db) newSegmentArchiveLocked(mergedAt time.Time) *segmentArchive {
+	if !db.opts.Archive {
+		return nil
+	}
+	name := archiveGenerationPrefix + strconv.FormatInt(mergedAt.UnixNano(), 10)
+	return &segmentArchive{dir: filepath.Join(db.dir, archiveDirName, name)}
+}
+
+// retire переносить файл сегмента в архів або видаляє його, якщо архів вимкнено.
+// Відсутній файл не є помилкою.
+func (a *segmentArchive) retire(path string) error {
+	return a.retireAs(path, filepath.Base(path))
+}
+
+// retireAs - retire для файлу, який в архіві має називатися name.
+func (a *segmentArchive) retireAs(path, name string) error {
+	var err error
+	if a == nil {
+		err = os.Remove(path)
+	} else if err = os.MkdirAll(a.dir, 0755); err == nil {
+		err = fsutil.Rename(path, filepath.Join(a.dir, name))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ArchivedSegment - сегмент, перенесений в архів злиттям.
+type ArchivedSegment struct {
+	// Merge - назва директорії злиття в архіві.
+	Merge     string    `json:"merge"`
+	MergedAt  time.Time `json:"mergedAt"`
+	SegmentID int       `json:"segmentId"`
+	Size      int64     `json:"size"`
+	Path      string    `json:"path"`
+}
+
+// ListArchive повертає сегменти з архіву бази в директорії dir, від старіших злиттів до новіших.
+// Відсутній архів дає порожній список.
+func ListArchive(dir string) ([]ArchivedSegment, error) {
+	root := filepath.Join(dir, archiveDirName)
+	generations, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []ArchivedSegment
+	for _, gen := range generations {
+		mergedAt, ok := parseArchiveGeneration(gen.Name())
+		if !ok || !gen.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(root, gen.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			segID, err := strconv.Atoi(strings.TrimPrefix(f.Name(), outFileNamePrefix))
+			if err != nil || !strings.HasPrefix(f.Name(), outFileNamePrefix) {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, ArchivedSegment{
+				Merge:     gen.Name(),
+				MergedAt:  mergedAt,
+				SegmentID: segID,
+				Size:      info.Size(),
+				Path:      filepath.Join(root, gen.Name(), f.Name()),
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].MergedAt.Equal(result[j].MergedAt) {
+			return result[i].MergedAt.Before(result[j].MergedAt)
+		}
+		return result[i].SegmentID < result[j].SegmentID
+	})
+	return result, nil
+}
+
+func parseArchiveGeneration(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, archiveGenerationPrefix) {
+		return time.Time{}, false
+	}
+	ns, err := strconv.ParseInt(strings.TrimPrefix(name, archiveGenerationPrefix), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ns), true
+}
+
+// ArchivedValue - версія ключа, знайдена в архівному сегменті.
+type ArchivedValue struct {
+	Merge     string `json:"merge"`
+	SegmentID int    `json:"segmentId"`
+	Offset    int64  `json:"offset"`
+	// WrittenAt - час запису; нульовий для записів старих форматів.
+	WrittenAt time.Time `json:"writtenAt"`
+	// Deleted - версія є записом про видалення ключа і не має значення.
+	Deleted bool     `json:"deleted,omitempty"`
+	Value   KeyValue `json:"value"`
+}
+
+// ArchivedVersions повертає всі версії ключа key з архіву бази в директорії dir
+// у порядку запису. Значення, збережені посиланнями або частинами, збираються зі
+// спільних значень в архіві або в поточних сегментах бази.
+func ArchivedVersions(dir, key string) ([]ArchivedValue, error) {
+	return ArchivedVersionsWithKeys(dir, key, nil)
+}
+
+// ArchivedVersionsWithKeys - ArchivedVersions для бази із зашифрованими значеннями:
+// значення розшифровуються ключами провайдера keys (nil - без ключів).
+func ArchivedVersionsWithKeys(dir, key string, provider KeyProvider) ([]ArchivedValue, error) {
+	keys, err := newKeyring(Options{KeyProvider: provider})
+	if err != nil {
+		return nil, err
+	}
+	segments, err := ListArchive(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Спільні значення адресуються хешем вмісту, тож підходить будь-яка їх копія.
+	blobs := make(map[string]string)
+	var found []ArchivedValue
+	var records []entry
+	var blobErr error
+	for _, seg := range segments {
+		err := scanSegmentFile(seg.Path, func(e entry, offset int64) {
+			switch {
+			case e.dataType == dataTypeBlob:
+				if err := keys.unseal(&e); err != nil {
+					blobErr = cmp.Or(blobErr, err)
+					return
+				}
+				blobs[e.key] = e.value
+			case e.key == key && e.dataType != dataTypeExpiry:
+				found = append(found, ArchivedValue{Merge: seg.Merge, SegmentID: seg.SegmentID, Offset: offset})
+				records = append(records, e)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s%d: %w", seg.Merge, outFileNamePrefix, seg.SegmentID, err)
+		}
+	}
+	if blobErr != nil {
+		return nil, blobErr
+	}
+	if missingBlobs(records, blobs) {
+		if err := collectLiveBlobs(dir, blobs, keys); err != nil {
+			return nil, err
+		}
+	}
+	for i, e := range records {
+		if err := keys.unseal(&e); err != nil {
+			return nil, fmt.Errorf("%s: %w", found[i].Merge, err)
+		}
+		if e.timestamp != 0 {
+			found[i].WrittenAt = time.Unix(0, e.timestamp)
+		}
+		if hashes, valueType := e.blobRefs(); hashes != nil {
+			var value strings.Builder
+			for _, h := range hashes {
+				part, ok := blobs[h.String()]
+				if !ok {
+					return nil, fmt.Errorf("shared value %s of key '%s' in %s is no longer stored", h, key, found[i].Merge)
+				}
+				value.WriteString(part)
+			}
+			e = entry{key: e.key, value: value.String(), dataType: valueType, timestamp: e.timestamp}
+		}
+		switch e.dataType {
+		case dataTypeTombstone, dataTypeRangeTombstone:
+			found[i].Deleted = true
+			found[i].Value = KeyValue{Key: e.key}
+		case DataTypeSeries:
+			found[i].Value = KeyValue{Key: e.key, Value: e.points, DataType: DataTypeSeries}
+		default:
+			found[i].Value = e.keyValue()
+		}
+	}
+	return found, nil
+}
+
+func missingBlobs(records []entry, blobs map[string]string) bool {
+	for _, e := range records {
+		hashes, _ := e.blobRefs()
+		for _, h := range hashes {
+			if _, ok := blobs[h.String()]; !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectLiveBlobs додає в blobs спільні значення з поточних сегментів бази.
+func collectLiveBlobs(dir string, blobs map[string]string, keys *keyring) error {
+	files, err := filepath.Glob(filepath.Join(dir, outFileNamePrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if _, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), outFileNamePrefix)); err != nil {
+			continue
+		}
+		var blobErr error
+		err := scanSegmentFile(path, func(e entry, _ int64) {
+			if e.dataType != dataTypeBlob {
+				return
+			}
+			if err := keys.unseal(&e); err != nil {
+				blobErr = cmp.Or(blobErr, err)
+				return
+			}
+			blobs[e.key] = e.value
+		})
+		if err == nil {
+			err = blobErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// scanSegmentFile викликає fn для кожного запису файлу сегмента. Обірваний кінець файлу пропускається.
+func scanSegmentFile(path string, fn func(e entry, offset int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanRecords(f, func(e entry, offset, _ int64) { fn(e, offset) })
+}
+
+// scanRecords декодує записи з r по черзі й передає fn кожен запис, його зміщення та розмір.
+// Обірваний запис у кінці вважається кінцем даних.
+func scanRecords(r io.Reader, fn func(e entry, offset, size int64)) error {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for {
+		var e entry
+		n, err := e.DecodeFromReader(reader)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("entry at offset %d: %w", offset, err)
+		}
+		fn(e, offset, int64(n))
+		offset += int64(n)
+	}
+}
+
+// pruneArchive видаляє зі старих злиттів ті, що старші за ArchiveMaxAge, а потім
+// найстаріші, доки розмір архіву перевищує ArchiveMaxBytes.
+func (db *Db) pruneArchive(now time.Time) {
+	if db.opts.ArchiveMaxAge <= 0 && db.opts.ArchiveMaxBytes <= 0 {
+		return
+	}
+	segments, err := ListArchive(db.dir)
+	if err != nil {
+		db.opts.Logger.Warnf("archive: %v", err)
+		return
+	}
+	type generation struct {
+		name     string
+		mergedAt time.Time
+		size     int64
+	}
+	var generations []generation
+	var total int64
+	for _, seg := range segments {
+		if n := len(generations); n == 0 || generations[n-1].name != seg.Merge {
+			generations = append(generations, generation{name: seg.Merge, mergedAt: seg.MergedAt})
+		}
+		generations[len(generations)-1].size += seg.Size
+		total += seg.Size
+	}
+	for _, gen := range generations {
+		expired := db.opts.ArchiveMaxAge > 0 && now.Sub(gen.mergedAt) > db.opts.ArchiveMaxAge
+		oversized := db.opts.ArchiveMaxBytes > 0 && total > db.opts.ArchiveMaxBytes
+		if !expired && !oversized {
+			break
+		}
+		if err := os.RemoveAll(filepath.Join(db.dir, archiveDirName, gen.name)); err != nil {
+			db.opts.Logger.Warnf("archive: failed to remove %s: %v", gen.name, err)
+			continue
+		}
+		total -= gen.size
+	}
+}
@@ -0,0 +1,133 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDb_ArchiveMergedSegments(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.Archive = true
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	shared := strings.Repeat("shared value ", 4)
+	for i := 0; i < 3; i++ {
+		if err := db.Put("key", fmt.Sprintf("version %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(fmt.Sprintf("dedup/%d", i), shared); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			if err := db.Put(fmt.Sprintf("filler/%d", j), strings.Repeat("x", 40)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Delete("dedup/0"); err != nil {
+		t.Fatal(err)
+	}
+	// Запис після видалення переводить надгробок у запечатаний сегмент.
+	for j := 0; j < 2; j++ {
+		if err := db.Put("filler/0", strings.Repeat("x", 600)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ListArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) == 0 {
+		t.Fatal("merge did not archive any segments")
+	}
+	for _, seg := range segments {
+		if seg.Merge != segments[0].Merge || seg.Size == 0 {
+			t.Errorf("unexpected archived segment %+v", seg)
+		}
+	}
+
+	versions, err := ArchivedVersions(dir, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []interface{}
+	for _, v := range versions {
+		values = append(values, v.Value.Value)
+		if v.WrittenAt.IsZero() {
+			t.Errorf("version %+v has no write time", v)
+		}
+	}
+	// Останнє значення могло лишитися в активному сегменті, але старі версії мають бути в архіві.
+	if len(values) < 2 || values[0] != "version 0" || values[1] != "version 1" {
+		t.Errorf("archived versions of key = %v", values)
+	}
+
+	versions, err = ArchivedVersions(dir, "dedup/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) == 0 || versions[0].Value.Value != shared {
+		t.Fatalf("archived versions of dedup/0 = %+v", versions)
+	}
+	if last := versions[len(versions)-1]; !last.Deleted {
+		t.Errorf("last archived version of dedup/0 is not a deletion: %+v", last)
+	}
+
+	if v, err := db.Get("key"); err != nil || v != "version 2" {
+		t.Errorf("Get(key) after merge = %q, %v", v, err)
+	}
+}
+
+func TestDb_ArchivePrune(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.Archive = true
+	opts.ArchiveMaxAge = time.Hour
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	root := filepath.Join(dir, archiveDirName)
+	old := filepath.Join(root, archiveGenerationPrefix+fmt.Sprint(time.Now().Add(-2*time.Hour).UnixNano()))
+	recent := filepath.Join(root, archiveGenerationPrefix+fmt.Sprint(time.Now().Add(-time.Minute).UnixNano()))
+	for _, gen := range []string{old, recent} {
+		if err := os.MkdirAll(gen, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(gen, outFileNamePrefix+"1"), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db.pruneArchive(time.Now())
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("generation older than ArchiveMaxAge was kept: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("recent generation was pruned: %v", err)
+	}
+
+	db.opts.ArchiveMaxAge = 0
+	db.opts.ArchiveMaxBytes = 50
+	db.pruneArchive(time.Now())
+	if segments, _ := ListArchive(dir); len(segments) != 0 {
+		t.Errorf("archive over ArchiveMaxBytes still has %v", segments)
+	}
+}
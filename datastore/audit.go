@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Журнал обслуговування: злиття, обрізання обірваних записів, міграції та ручні злиття,
+// виконані базою, дописуються у файл engine-audit.log у директорії бази, по одному
+// JSON-запису на рядок. Адміністративні дії сервера над базою (відновлення зі знімка,
+// зміна налаштувань) пишуться в той самий журнал через Audit та AppendAudit. Журнал
+// лише доповнюється, база його не скорочує.
+
+// AuditLogFileName - ім'я файлу журналу обслуговування в директорії бази.
+const AuditLogFileName = "engine-audit.log"
+
+// Операції журналу обслуговування.
+const (
+	// AuditMerge - фонове злиття або злиття режиму кешу; записується, лише якщо щось злито.
+	AuditMerge = "merge"
+	// AuditCompact - злиття, запитане через Compact або Merge.
+	AuditCompact = "compact"
+	// AuditMigrateFormat та AuditMigrateEncryption - злиття MigrateFormat та MigrateEncryption.
+	AuditMigrateFormat     = "migrate-format"
+	AuditMigrateEncryption = "migrate-encryption"
+	// AuditMigration - крок міграції бази, див. Migrate.
+	AuditMigration = "migration"
+	// AuditTruncate - обрізання обірваного запису в кінці сегмента при відкритті, а з
+	// OpenRepair - й обрізання сегмента від першого пошкодженого запису.
+	AuditTruncate = "truncate"
+	// AuditSkipCorrupt - пропуск пошкодженого запису при відкритті з OpenPermissive.
+	AuditSkipCorrupt = "skip-corrupt"
+	// AuditRestore - відновлення директорії бази зі знімка до відкриття, див. AppendAudit.
+	AuditRestore = "restore"
+)
+
+// AuditEntry - запис журналу обслуговування.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// Outcome - "ok" або "error".
+	Outcome  string `json:"outcome"`
+	Error    string `json:"error,omitempty"`
+	Segments []int  `json:"segments,omitempty"`
+	Details  string `json:"details,omitempty"`
+	// Source - звідки запитано дію, напр. адреса клієнта або джерело знімка.
+	Source string `json:"source,omitempty"`
+}
+
+func (db *Db) auditLogPath() string {
+	return filepath.Join(db.dir, AuditLogFileName)
+}
+
+// Audit дописує запис у журнал обслуговування з результатом за err. Помилка запису
+// лише журналюється: дію вже виконано.
+func (db *Db) Audit(entry AuditEntry, err error) {
+	db.auditMu.Lock()
+	defer db.auditMu.Unlock()
+	if writeErr := AppendAudit(db.dir, entry, err); writeErr != nil {
+		db.opts.Logger.Warnf("%v", writeErr)
+	}
+}
+
+// AppendAudit дописує запис у журнал обслуговування бази в директорії dir, коли базу
+// ще не відкрито, напр. після відновлення зі знімка. Відкрита база пише через Audit.
+func AppendAudit(dir string, entry AuditEntry, err error) error {
+	entry.Time = time.Now().UTC()
+	entry.Outcome = "ok"
+	if err != nil {
+		entry.Outcome = "error"
+		entry.Error = err.Error()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	path := filepath.Join(dir, AuditLogFileName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("audit log: failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// AuditLog повертає до limit останніх записів журналу обслуговування від давніших до
+// новіших; limit <= 0 - усі записи.
+func (db *Db) AuditLog(limit int) ([]AuditEntry, error) {
+	db.auditMu.Lock()
+	defer db.auditMu.Unlock()
+	f, err := os.Open(db.auditLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Напр. рядок, обірваний падінням процесу посеред запису.
+			db.opts.Logger.Warnf("audit log: skipping invalid record on line %d: %v", line, err)
+			continue
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	return entries, nil
+}
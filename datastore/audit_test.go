@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// auditOps повертає операції журналу обслуговування, пропускаючи міграції при створенні бази.
+func auditOps(t *testing.T, db *Db) []AuditEntry {
+	t.Helper()
+	entries, err := db.AuditLog(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []AuditEntry
+	for _, e := range entries {
+		if e.Op != AuditMigration && e.Op != AuditMigrateFormat {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func TestDb_AuditLog(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := db.AuditLog(0); len(entries) != 4 || entries[0].Op != AuditMigration || entries[0].Outcome != "ok" {
+		t.Errorf("migrations on open recorded %+v", entries)
+	}
+
+	// Фонове злиття без роботи не журналюється, ручне - журналюється завжди.
+	if err := db.tryMergeSegments(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	padding := strings.Repeat("a", 200)
+	for i := 0; i < 12; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%3), padding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.tryMergeSegments(); err != nil {
+		t.Fatal(err)
+	}
+	ops := auditOps(t, db)
+	if len(ops) != 2 {
+		t.Fatalf("audit log has %+v", ops)
+	}
+	if ops[0].Op != AuditCompact || ops[0].Outcome != "ok" || ops[0].Details != "nothing to merge" {
+		t.Errorf("empty compaction recorded as %+v", ops[0])
+	}
+	if ops[1].Op != AuditMerge || ops[1].Outcome != "ok" || !strings.HasPrefix(ops[1].Details, "merged ") || ops[1].Time.IsZero() {
+		t.Errorf("background merge recorded as %+v", ops[1])
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, outFileNamePrefix+"100"), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := (&entry{key: "torn", value: "value", dataType: DataTypeString}).Encode()
+	if _, err := f.Write(torn[:len(torn)-2]); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	last, err := db.AuditLog(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops = auditOps(t, db)
+	if len(last) != 1 || len(ops) != 3 || ops[2].Op != AuditTruncate || len(ops[2].Segments) != 1 || ops[2].Segments[0] != 100 {
+		t.Errorf("torn tail recovery recorded as %+v, last entry %+v", ops, last)
+	}
+}
+
+func TestDb_AuditSharesLogWithAppendAudit(t *testing.T) {
+	dir := t.TempDir()
+	if err := AppendAudit(dir, AuditEntry{Op: AuditRestore, Source: "snapshot.tar"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Audit(AuditEntry{Op: "log-policy", Source: "127.0.0.1"}, fmt.Errorf("invalid policy"))
+
+	ops := auditOps(t, db)
+	if len(ops) != 2 || ops[0].Op != AuditRestore || ops[0].Source != "snapshot.tar" || ops[0].Outcome != "ok" {
+		t.Fatalf("audit log has %+v", ops)
+	}
+	if ops[1].Op != "log-policy" || ops[1].Outcome != "error" || ops[1].Error != "invalid policy" {
+		t.Errorf("server action recorded as %+v", ops[1])
+	}
+}
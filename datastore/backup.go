@@ -0,0 +1,193 @@
+package datastore
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// backupEntryName - імена файлів, з яких складається резервна копія та знімок.
+// Архівовані сегменти представлені заглушками, див. coldtier.go.
+var backupEntryName = regexp.MustCompile(`^` + outFileNamePrefix + `[0-9]+(` + regexp.QuoteMeta(coldStubSuffix) + `)?$`)
+
+// BackupReport - результат Backup.
+type BackupReport struct {
+	Segments int           `json:"segments"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Backup копіює всі сегменти бази в директорію dest, не зупиняючи записи. Активний сегмент
+// копіюється до розміру на момент виклику, як у Snapshot. dest має бути відсутньою або
+// порожньою; при помилці або скасуванні ctx уже скопійовані файли видаляються.
+func (db *Db) Backup(ctx context.Context, dest string) (BackupReport, error) {
+	start := time.Now()
+	if err := ensureEmptyDir(dest); err != nil {
+		return BackupReport{}, fmt.Errorf("backup: %w", err)
+	}
+	segments, err := db.openSnapshotSegments()
+	if err != nil {
+		return BackupReport{}, err
+	}
+	defer func() {
+		for _, seg := range segments {
+			_ = seg.file.Close()
+		}
+	}()
+	report := BackupReport{}
+	var written []string
+	for _, seg := range segments {
+		path := filepath.Join(dest, seg.name)
+		if err := copyToFile(ctx, path, io.NewSectionReader(seg.file, 0, seg.size)); err != nil {
+			for _, p := range written {
+				_ = os.Remove(p)
+			}
+			return BackupReport{}, fmt.Errorf("backup: failed to copy %s: %w", seg.name, err)
+		}
+		written = append(written, path)
+		report.Segments++
+		report.Bytes += seg.size
+	}
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// RestoreBackup відтворює файли бази в директорії dir з резервної копії backup: директорії,
+// створеної Backup, або tar-архіву, записаного Snapshot. dir має бути відсутньою або порожньою.
+// Після відновлення базу відкривають NewDb або NewDbWithOptions.
+func RestoreBackup(dir, backup string) error {
+	if err := ensureEmptyDir(dir); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	stat, err := os.Stat(backup)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if !stat.IsDir() {
+		f, err := os.Open(backup)
+		if err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		defer f.Close()
+		files, err := UnpackSnapshot(f, dir)
+		if err != nil {
+			for _, path := range files {
+				_ = os.Remove(path)
+			}
+			return fmt.Errorf("restore: %w", err)
+		}
+		return nil
+	}
+	entries, err := os.ReadDir(backup)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	var written []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !backupEntryName.MatchString(e.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		err := func() error {
+			src, err := os.Open(filepath.Join(backup, e.Name()))
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			return copyToFile(context.Background(), path, src)
+		}()
+		if err != nil {
+			for _, p := range written {
+				_ = os.Remove(p)
+			}
+			return fmt.Errorf("restore: failed to copy %s: %w", e.Name(), err)
+		}
+		written = append(written, path)
+	}
+	if len(written) == 0 {
+		return fmt.Errorf("restore: backup %s contains no segments", backup)
+	}
+	return nil
+}
+
+// UnpackSnapshot розпаковує сегменти з tar-архіву, записаного Snapshot, у dir. Записи з
+// іншими іменами (зокрема зі шляхами) відхиляються. Повертає шляхи створених файлів,
+// зокрема й при помилці, щоб їх можна було прибрати.
+func UnpackSnapshot(r io.Reader, dir string) ([]string, error) {
+	tr := tar.NewReader(r)
+	var files []string
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read snapshot archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !backupEntryName.MatchString(header.Name) {
+			return files, fmt.Errorf("unexpected entry %q in snapshot archive", header.Name)
+		}
+		path := filepath.Join(dir, header.Name)
+		if err := copyToFile(context.Background(), path, tr); err != nil {
+			return files, fmt.Errorf("failed to unpack %s: %w", header.Name, err)
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("snapshot archive contains no segments")
+	}
+	return files, nil
+}
+
+// ensureEmptyDir створює директорію dir або перевіряє, що вона порожня.
+func ensureEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty", dir)
+	}
+	return nil
+}
+
+// copyToFile створює файл path (він не має існувати) з вмісту src і скидає його на диск.
+// Копіювання перевіряє ctx між блоками. При помилці створений файл видаляється.
+func copyToFile(ctx context.Context, path string, src io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 256*1024)
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = src.Read(buf)
+		if n > 0 {
+			if _, werr := f.Write(buf[:n]); werr != nil {
+				err = werr
+			}
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
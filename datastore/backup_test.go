@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDb_BackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Записи під час копіювання не мають ламати резервну копію.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = db.Put(fmt.Sprintf("during%d", i), "x")
+		}
+	}()
+	backupDir := filepath.Join(t.TempDir(), "backup")
+	report, err := db.Backup(context.Background(), backupDir)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Segments == 0 || report.Bytes == 0 {
+		t.Errorf("Backup report = %+v", report)
+	}
+	if _, err := db.Backup(context.Background(), backupDir); err == nil {
+		t.Error("Backup into a non-empty directory succeeded")
+	}
+
+	var archive bytes.Buffer
+	if err := db.Snapshot(&archive); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "snapshot.tar")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, backup := range map[string]string{"directory": backupDir, "tar": archivePath} {
+		restored := filepath.Join(t.TempDir(), "db")
+		if err := RestoreBackup(restored, backup); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		rdb, err := NewDbWithOptions(restored, testOptions(true))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i := 0; i < 100; i++ {
+			if v, err := rdb.Get(fmt.Sprintf("key%d", i)); err != nil || v != fmt.Sprintf("value%d", i) {
+				t.Errorf("%s: Get(key%d) = %q, %v", name, i, v, err)
+			}
+		}
+		if gen := rdb.Generation(); gen == "" || gen == db.Generation() {
+			t.Errorf("%s: restored database has generation %q, want a new one (source %q)", name, gen, db.Generation())
+		}
+		rdb.Close()
+		if err := RestoreBackup(restored, backup); err == nil {
+			t.Errorf("%s: restore into a non-empty directory succeeded", name)
+		}
+	}
+}
+
+func TestDb_BackupCancelled(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dest := t.TempDir()
+	if _, err := db.Backup(ctx, dest); err == nil {
+		t.Fatal("Backup with a cancelled context succeeded")
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Errorf("cancelled backup left %d files", len(entries))
+	}
+}
+
+func TestDb_GenerationSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generation := db.Generation()
+	if len(generation) != 36 {
+		t.Errorf("Generation() = %q, want a UUID", generation)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Generation() != generation {
+		t.Errorf("generation changed on reopen: %q, want %q", db.Generation(), generation)
+	}
+	if stats, _ := db.Stats(); stats.Generation != generation {
+		t.Errorf("Stats().Generation = %q, want %q", stats.Generation, generation)
+	}
+}
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+const (
+	bloomFileNamePrefix = "bloom-"
+	// bloomBitsPerKey та bloomHashCount дають приблизно 1% хибних спрацювань.
+	bloomBitsPerKey = 10
+	bloomHashCount  = 7
+)
+
+// bloomMagic позначає початок файлу фільтра Блума.
+var bloomMagic = [4]byte{'B', 'L', 'M', '1'}
+
+// bloomFilter відповідає на питання "чи може сегмент містити запис для ключа".
+// Хибно-негативних відповідей не буває, тому фільтр можна використовувати для пропуску сегментів.
+type bloomFilter struct {
+	k    uint32
+	bits []byte
+}
+
+// Формат файлу фільтра: [magic (4 байти)][кількість хешів (uint32)][біти]
+
+func newBloomFilter(keyCount int) *bloomFilter {
+	nbits := keyCount * bloomBitsPerKey
+	if nbits < 64 {
+		nbits = 64
+	}
+	return &bloomFilter{k: bloomHashCount, bits: make([]byte, (nbits+7)/8)}
+}
+
+// bloomFromHints будує фільтр за записами сегмента, включно з надгробками.
+func bloomFromHints(records []hintRecord) *bloomFilter {
+	bf := newBloomFilter(len(records))
+	for _, rec := range records {
+		bf.add(rec.key)
+	}
+	return bf
+}
+
+// bloomHashes повертає два базові хеші для подвійного хешування (Kirsch-Mitzenmacher).
+func bloomHashes(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+func (bf *bloomFilter) add(key string) {
+	h1, h2 := bloomHashes(key)
+	nbits := uint32(len(bf.bits) * 8)
+	for i := uint32(0); i < bf.k; i++ {
+		bit := (h1 + i*h2) % nbits
+		bf.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (bf *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHashes(key)
+	nbits := uint32(len(bf.bits) * 8)
+	for i := uint32(0); i < bf.k; i++ {
+		bit := (h1 + i*h2) % nbits
+		if bf.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomFilePath(dir string, segID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d", bloomFileNamePrefix, segID))
+}
+
+func writeBloomFile(dir string, segID int, bf *bloomFilter) error {
+	path := bloomFilePath(dir, segID)
+	tmpPath := path + ".tmp"
+	data := make([]byte, 8, 8+len(bf.bits))
+	copy(data[0:4], bloomMagic[:])
+	binary.LittleEndian.PutUint32(data[4:8], bf.k)
+	data = append(data, bf.bits...)
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create bloom file %s: %w", tmpPath, err)
+	}
+	_, writeErr := f.Write(data)
+	if writeErr == nil {
+		writeErr = f.Sync()
+	}
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write bloom file %s: %w", tmpPath, writeErr)
+	}
+	if err := fsutil.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename bloom file %s: %w", tmpPath, err)
+	}
+	return nil
+}
+
+func readBloomFile(dir string, segID int) (*bloomFilter, error) {
+	data, err := os.ReadFile(bloomFilePath(dir, segID))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 9 || [4]byte(data[0:4]) != bloomMagic {
+		return nil, errors.New("invalid bloom file header")
+	}
+	k := binary.LittleEndian.Uint32(data[4:8])
+	if k == 0 || k > 32 {
+		return nil, fmt.Errorf("invalid bloom hash count %d", k)
+	}
+	return &bloomFilter{k: k, bits: data[8:]}, nil
+}
+
+// setSegmentBloomLocked зберігає фільтр сегмента на диску та в пам'яті. Викликається під db.mu.
+func (db *Db) setSegmentBloomLocked(segID int, records []hintRecord) {
+	bf := bloomFromHints(records)
+	if err := writeBloomFile(db.dir, segID, bf); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+	db.blooms[segID] = bf
+}
+
+// loadSegmentBloomLocked читає фільтр запечатаного сегмента, а якщо файл відсутній
+// чи пошкоджений - будує його заново за записами сегмента.
+func (db *Db) loadSegmentBloomLocked(segID int, records []hintRecord) {
+	bf, err := readBloomFile(db.dir, segID)
+	if err == nil {
+		db.blooms[segID] = bf
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		db.opts.Logger.Warnf("rebuilding bloom filter for segment %d: %v", segID, err)
+	}
+	db.setSegmentBloomLocked(segID, records)
+}
+
+// segmentMayContainLocked повідомляє, чи варто читати сегмент у пошуках записів ключа.
+// Для активного сегмента та сегментів без фільтра завжди повертає true. Викликається під db.mu.
+func (db *Db) segmentMayContainLocked(segID int, key string) bool {
+	bf, ok := db.blooms[segID]
+	if !ok || db.isActiveLocked(segID) {
+		return true
+	}
+	return bf.mayContain(key)
+}
@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestBloomFilter_NoFalseNegatives(t *testing.T) {
+	dir := t.TempDir()
+	records := make([]hintRecord, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		records = append(records, hintRecord{key: fmt.Sprintf("key%04d", i)})
+	}
+	if err := writeBloomFile(dir, 2, bloomFromHints(records)); err != nil {
+		t.Fatalf("writeBloomFile failed: %v", err)
+	}
+	bf, err := readBloomFile(dir, 2)
+	if err != nil {
+		t.Fatalf("readBloomFile failed: %v", err)
+	}
+	for _, rec := range records {
+		if !bf.mayContain(rec.key) {
+			t.Fatalf("false negative for key %s", rec.key)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if bf.mayContain(fmt.Sprintf("missing%04d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("too many false positives: %d of 1000", falsePositives)
+	}
+}
+
+func TestDb_BloomFiltersForSealedSegments(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	dir := db.dir
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("bloomKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.mu.RLock()
+	activeID := db.shards[0].segmentID
+	mayContain := db.segmentMayContainLocked(0, "bloomKey000")
+	db.mu.RUnlock()
+	if activeID == 0 {
+		t.Fatalf("expected at least one rotation, active segment is still 0")
+	}
+	if _, err := os.Stat(bloomFilePath(dir, 0)); err != nil {
+		t.Fatalf("expected bloom file for sealed segment 0: %v", err)
+	}
+	if _, err := os.Stat(bloomFilePath(dir, activeID)); !os.IsNotExist(err) {
+		t.Errorf("active segment must not have a bloom file yet, stat err: %v", err)
+	}
+	if !mayContain {
+		t.Errorf("bloom filter of segment 0 must contain bloomKey000")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(bloomFilePath(dir, 0)); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	if _, err := os.Stat(bloomFilePath(dir, 0)); err != nil {
+		t.Errorf("expected bloom file to be rebuilt on recovery: %v", err)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for segID := range db.segmentFiles {
+		if segID == db.shards[0].segmentID {
+			continue
+		}
+		if _, ok := db.blooms[segID]; !ok {
+			t.Errorf("sealed segment %d has no bloom filter after merge", segID)
+		}
+	}
+	db.currentIndex.forEach(func(key string, idxVal indexValue) {
+		if !db.segmentMayContainLocked(idxVal.segmentID, key) {
+			t.Errorf("bloom filter of segment %d misses live key %s", idxVal.segmentID, key)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull повертається записом, якщо черга запису перевищила бюджет байтів
+// і Options.RejectWhenQueueFull увімкнено.
+var ErrQueueFull = errors.New("put queue byte budget exceeded")
+
+// putRequestOverhead - приблизні накладні витрати на один запит у черзі.
+const putRequestOverhead = 64
+
+// byteBudget обмежує сумарний розмір запитів, що очікують у черзі запису.
+type byteBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int64
+	used   int64
+	closed bool
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire резервує n байт. Якщо бюджет вичерпано, чекає на звільнення місця (або на
+// скасування ctx) чи, коли block == false, одразу повертає ErrQueueFull. Запит, більший за весь бюджет,
+// допускається, коли черга порожня.
+func (b *byteBudget) acquire(ctx context.Context, n int64, block bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for !b.closed && b.used > 0 && b.used+n > b.limit {
+		if !block {
+			return ErrQueueFull
+		}
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if b.closed {
+		return ErrClosed
+	}
+	b.used += n
+	return nil
+}
+
+// wait чекає на звільнення місця, доки ctx не скасовано. Викликається під b.mu.
+func (b *byteBudget) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.cond.Broadcast()
+	})
+	defer stop()
+	b.cond.Wait()
+	return ctx.Err()
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// close будить усіх, хто чекає, щоб вони отримали ErrClosed.
+func (b *byteBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *byteBudget) usage() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// size оцінює, скільки пам'яті займає запит у черзі.
+func (req *putRequest) size() int64 {
+	n := int64(putRequestOverhead + len(req.key) + len(req.copyFrom) + len(req.value) + len(req.ifMatch) + len(req.points)*seriesPointSize)
+	for _, key := range req.deleteKeys {
+		n += int64(len(key))
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestByteBudget(t *testing.T) {
+	b := newByteBudget(100)
+	if err := b.acquire(context.Background(), 80, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.acquire(context.Background(), 30, false); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.acquire(context.Background(), 30, true) }()
+	select {
+	case err := <-acquired:
+		t.Fatalf("blocking acquire returned early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.release(80)
+	if err := <-acquired; err != nil {
+		t.Fatalf("blocking acquire failed: %v", err)
+	}
+	if b.usage() != 30 {
+		t.Errorf("usage = %d, want 30", b.usage())
+	}
+
+	b.release(30)
+	if err := b.acquire(context.Background(), 500, false); err != nil {
+		t.Errorf("oversized request must be admitted into an empty queue, got %v", err)
+	}
+
+	go func() { acquired <- b.acquire(context.Background(), 1, true) }()
+	time.Sleep(10 * time.Millisecond)
+	b.close()
+	if err := <-acquired; !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+}
+
+func TestDb_StatsReportsQueueBudget(t *testing.T) {
+	opts := testOptions(true)
+	opts.PutQueueBytes = 4096
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PutQueueBudgetBytes != 4096 || stats.PutQueueBytes != 0 {
+		t.Errorf("unexpected queue stats after put completed: %+v", stats)
+	}
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Режим кешу (Options.CacheBudgetBytes). База пам'ятає порядок використання ключів:
+// запис і читання ключа переносять його на початок списку. Коли живі дані перевищують
+// бюджет, горутина запису видаляє ключі з кінця списку, а злиття прибирає їх з диску.
+// Після відкриття порядок відновлюється за розташуванням записів у сегментах.
+
+// lruTracker - порядок використання ключів, від найсвіжішого до найстарішого.
+type lruTracker struct {
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRUTracker() *lruTracker {
+	return &lruTracker{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// add переносить ключ на початок списку, додаючи його, якщо його ще немає.
+func (l *lruTracker) add(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(key)
+}
+
+// touch переносить на початок списку прочитані ключі; відсутні ключі ігноруються.
+func (l *lruTracker) touch(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.order.MoveToFront(el)
+		}
+	}
+}
+
+func (l *lruTracker) remove(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
+
+// oldest повертає ключі від найстарішого, доки visit повертає true.
+func (l *lruTracker) oldest(visit func(key string) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for el := l.order.Back(); el != nil; el = el.Prev() {
+		if !visit(el.Value.(string)) {
+			return
+		}
+	}
+}
+
+// rebuildLRULocked заповнює порядок використання після завантаження індексу: ключі,
+// записані пізніше, вважаються свіжішими. Викликається під db.mu.
+func (db *Db) rebuildLRULocked() {
+	type position struct {
+		key    string
+		idxVal indexValue
+	}
+	positions := make([]position, 0, db.currentIndex.len()+len(db.seriesIndex))
+	// Кеш не поєднується з DiskIndex, тож індекс повністю в пам'яті і помилки немає.
+	_ = db.currentIndex.forEach(func(key string, idxVal indexValue) {
+		positions = append(positions, position{key, idxVal})
+	})
+	for key, chunks := range db.seriesIndex {
+		if len(chunks) > 0 {
+			positions = append(positions, position{key, chunks[len(chunks)-1]})
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		a, b := positions[i].idxVal, positions[j].idxVal
+		if a.segmentID != b.segmentID {
+			return a.segmentID < b.segmentID
+		}
+		return a.offset < b.offset
+	})
+	db.lru = newLRUTracker()
+	for _, p := range positions {
+		db.lru.add(p.key)
+	}
+}
+
+// keyLiveSizeLocked повертає живі байти ключа: значення, термін дії та блоки часового ряду.
+// Викликається під db.mu.
+func (db *Db) keyLiveSizeLocked(key string) int64 {
+	var size int64
+	if idxVal, ok := db.currentIndex.get(key); ok {
+		size += idxVal.size
+		if expiresAt, ok := db.expiries[key]; ok {
+			size += expirySize(key, expiresAt)
+		}
+	}
+	for _, idxVal := range db.seriesIndex[key] {
+		size += idxVal.size
+	}
+	return size
+}
+
+// liveTotalLocked повертає живі байти всіх сегментів. Викликається під db.mu.
+func (db *Db) liveTotalLocked() int64 {
+	var total int64
+	for segID := range db.segmentFiles {
+		total += db.liveBytes[segID] + db.blobs.segmentLive(segID)
+	}
+	return total
+}
+
+// evictLocked видаляє найдавніше використані ключі, доки живі дані не вмістяться в
+// Options.CacheBudgetBytes, і запускає злиття, що прибере їх з диску. Викликається
+// горутиною запису під db.mu після кожного пакета.
+func (db *Db) evictLocked() {
+	if db.opts.CacheBudgetBytes <= 0 {
+		return
+	}
+	excess := db.liveTotalLocked() - db.opts.CacheBudgetBytes
+	if excess <= 0 {
+		return
+	}
+	var victims []string
+	db.lru.oldest(func(key string) bool {
+		victims = append(victims, key)
+		excess -= db.keyLiveSizeLocked(key)
+		return excess > 0
+	})
+	evicted, err := db.applyDelete(putRequest{deleteKeys: victims})
+	if err != nil {
+		db.opts.Logger.Warnf("cache: failed to evict %d keys: %v", len(victims), err)
+		return
+	}
+	db.evictions += int64(evicted)
+	if db.evictMerging.CompareAndSwap(false, true) {
+		db.workers.Go("evict-merge", func(context.Context) error {
+			defer db.evictMerging.Store(false)
+			if _, err := db.runMerge(context.Background(), AuditMerge, nil, true); err != nil && !errors.Is(err, ErrClosed) {
+				db.opts.Logger.Warnf("cache: merge after eviction failed: %v", err)
+			}
+			return nil
+		})
+	}
+}
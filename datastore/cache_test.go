@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDb_CacheEviction(t *testing.T) {
+	value := strings.Repeat("v", 300)
+	opts := testOptions(true)
+	opts.CacheBudgetBytes = 3000
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Прочитаний key0 стає свіжішим за key1..key5.
+	if _, err := db.Get("key0"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 6; i < 12; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CacheEvictions == 0 || stats.CacheBudgetBytes != opts.CacheBudgetBytes {
+		t.Fatalf("stats after exceeding the budget: %d evictions, budget %d", stats.CacheEvictions, stats.CacheBudgetBytes)
+	}
+	db.mu.RLock()
+	live := db.liveTotalLocked()
+	db.mu.RUnlock()
+	if live > opts.CacheBudgetBytes {
+		t.Errorf("live bytes %d exceed the budget %d", live, opts.CacheBudgetBytes)
+	}
+	if _, err := db.Get("key1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("least recently used key1 was not evicted: %v", err)
+	}
+	for _, key := range []string{"key0", "key11"} {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("recently used %s was evicted: %v", key, err)
+		}
+	}
+	// Витіснення запускає злиття, що прибирає значення з диску.
+	deadline := time.Now().Add(5 * time.Second)
+	for stats.MergeCount == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		stats, _ = db.Stats()
+	}
+	if stats.MergeCount == 0 {
+		t.Error("eviction did not trigger a merge")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Після відкриття порядок відновлюється за сегментами: старіші записи витісняються першими.
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	before, _ := db.Stats()
+	if err := db.Put("fresh", strings.Repeat("f", 900)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("fresh"); err != nil || len(v) != 900 {
+		t.Errorf("Get(fresh) = %d bytes, %v", len(v), err)
+	}
+	if _, err := db.Get("key11"); err != nil {
+		t.Errorf("newest key before reopen was evicted: %v", err)
+	}
+	if after, _ := db.Stats(); after.KeyCount >= before.KeyCount+1 {
+		t.Errorf("no key was evicted after reopen: %d keys before, %d after", before.KeyCount, after.KeyCount)
+	}
+}
@@ -0,0 +1,43 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Скасування записів. Варіанти методів з ctx перестають чекати на місце в черзі запису,
+// щойно ctx скасовано, а горутина запису пропускає скасовані запити, до яких ще не дійшла
+// черга. Запит, який горутина запису вже почала виконувати, завершується, і метод повертає
+// його справжній результат, тож помилка ctx завжди означає, що запис не відбувся.
+
+// PutContext - аналог Put, що скасовується разом з ctx.
+func (db *Db) PutContext(ctx context.Context, key string, value string) error {
+	return db.submit(putRequest{key: key, value: value, dataType: DataTypeString, ctx: ctx})
+}
+
+// PutInt64Context - аналог PutInt64, що скасовується разом з ctx.
+func (db *Db) PutInt64Context(ctx context.Context, key string, value int64) error {
+	return db.submit(putRequest{key: key, valueInt: value, dataType: DataTypeInt64, ctx: ctx})
+}
+
+// PutJSONContext - аналог PutJSON, що скасовується разом з ctx.
+func (db *Db) PutJSONContext(ctx context.Context, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON document for key '%s': %w", key, err)
+	}
+	return db.submit(putRequest{key: key, value: string(data), dataType: DataTypeJSON, ctx: ctx})
+}
+
+// DeleteContext - аналог Delete, що скасовується разом з ctx.
+func (db *Db) DeleteContext(ctx context.Context, key string) error {
+	deleted, err := db.deleteKeys(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
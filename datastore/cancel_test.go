@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDb_CancelledWriteIsSkipped(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	// Поки горутина запису чекає на db.mu, запит лишається невиконаним.
+	db.mu.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- db.PutContext(ctx, "cancelled", "value") }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	db.mu.Unlock()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("PutContext returned %v, want context.Canceled", err)
+	}
+	if ErrorCode(context.Canceled) != CodeCancelled || !IsRetryable(context.Canceled) {
+		t.Errorf("context.Canceled has code %s", ErrorCode(context.Canceled))
+	}
+	if _, err := db.Get("cancelled"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a cancelled write returned %v, want ErrNotFound", err)
+	}
+	stats, _ := db.Stats()
+	if stats.CancelledWrites != 1 || stats.PutQueueLength != 0 || stats.PutQueueBytes != 0 {
+		t.Errorf("after cancellation: %d cancelled writes, queue %d requests / %d bytes", stats.CancelledWrites, stats.PutQueueLength, stats.PutQueueBytes)
+	}
+	if err := db.PutContext(context.Background(), "cancelled", "value"); err != nil {
+		t.Errorf("PutContext with a live context: %v", err)
+	}
+}
+
+func TestDb_CancelWhileWaitingForQueue(t *testing.T) {
+	opts := testOptions(true)
+	opts.PutQueueBytes = 256
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.mu.Lock()
+	first := make(chan error, 1)
+	go func() { first <- db.Put("big", strings.Repeat("v", 300)) }()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := db.PutContext(ctx, "waiting", "value"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PutContext on a full queue returned %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("PutContext returned after %v", elapsed)
+	}
+	db.mu.Unlock()
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("waiting"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an abandoned write returned %v, want ErrNotFound", err)
+	}
+	if usage := db.putBudget.usage(); usage != 0 {
+		t.Errorf("queue budget holds %d bytes after the abandoned write", usage)
+	}
+}
@@ -0,0 +1,278 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Кожен запис ключа (значення, видалення ключа або префікса, блок часового ряду) отримує
+// номер, що зростає з кожним записом. Номер зберігається в заголовку запису (формат v4),
+// тож переживає перезапуск і злиття. Спільні значення та терміни дії власних номерів не мають:
+// вони належать запису, поруч з яким записані. ChangesSince віддає записи, зроблені після
+// заданого номера, - це основа інкрементних резервних копій і реплікації між екземплярами бази.
+
+// ErrChangesCompacted повертається ChangesSince, якщо злиття вже відкинуло видалення,
+// зроблене після заданого номера. Тоді замість змін потрібна повна копія бази.
+var ErrChangesCompacted = errors.New("changes were discarded by merge")
+
+// ErrUnknownSeq повертається ChangesSince для номера, більшого за номер останнього запису,
+// наприклад отриманого від іншої бази.
+var ErrUnknownSeq = errors.New("sequence number is ahead of the database")
+
+// segmentSeqs - номери записів сегмента. Для запечатаного сегмента Last - останній
+// виданий номер на момент запечатування: записів з більшими номерами в сегменті немає.
+type segmentSeqs struct {
+	Last uint64 `json:"last"`
+	// LastDelete - найбільший номер видалення ключа або префікса в сегменті.
+	LastDelete uint64 `json:"lastDelete,omitempty"`
+}
+
+// add враховує номер прочитаного запису сегмента.
+func (s *segmentSeqs) add(e entry) {
+	s.Last = max(s.Last, e.seq)
+	if e.dataType == dataTypeTombstone || e.dataType == dataTypeRangeTombstone {
+		s.LastDelete = max(s.LastDelete, e.seq)
+	}
+}
+
+// Change - один запис бази, див. ChangesSince.
+type Change struct {
+	Seq uint64 `json:"seq"`
+	// WrittenAt - час запису; нульовий для записів старих форматів.
+	WrittenAt time.Time `json:"writtenAt"`
+	// Deleted - запис видаляє ключ Value.Key.
+	Deleted bool `json:"deleted,omitempty"`
+	// DeletedPrefix - запис видаляє всі ключі з префіксом Value.Key, записані раніше.
+	DeletedPrefix bool `json:"deletedPrefix,omitempty"`
+	// ExpiresAt - час закінчення терміну дії значення (Unix, нс); 0 - без терміну.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// Value - нове значення ключа. Для часового ряду - точки, дописані цим записом.
+	Value KeyValue `json:"value"`
+}
+
+// changeRecord - місце запису, що потрапить у ChangesSince.
+type changeRecord struct {
+	seq       uint64
+	key       string
+	loc       indexValue
+	timestamp int64
+	expiresAt int64
+}
+
+// LastSeq повертає номер останнього запису бази.
+func (db *Db) LastSeq() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.seq
+}
+
+// ChangesSince передає fn записи, зроблені після запису з номером since, у порядку номерів
+// і повертає номер, до якого включно передано зміни: його передають наступному виклику.
+// Записи, зроблені під час виклику, не передаються.
+//
+// Запис не передається, якщо його замінив пізніший запис: значення або видалення того ж
+// ключа чи видалення префікса ключа. Тож застосування змін по черзі до копії бази станом
+// на since відтворює поточний стан. Блоки часового ряду не замінюють один одного; блоки,
+// об'єднані злиттям, передаються одним блоком з номером найновішого з них. Видалення
+// політикою зберігання (Options.Retention) не пишуться в сегменти й змінами не вважаються.
+//
+// Злиття відкидає видалення разом з ключами, тож якщо воно вже відкинуло видалення з номером
+// після since, повертається ErrChangesCompacted. Помилка fn зупиняє обхід і повертається.
+func (db *Db) ChangesSince(since uint64, fn func(Change) error) (uint64, error) {
+	v, segments, compacted := db.changesView()
+	defer v.Close()
+	if since > v.Seq {
+		return 0, fmt.Errorf("%w: %d, the last one is %d", ErrUnknownSeq, since, v.Seq)
+	}
+	if since < compacted {
+		return 0, fmt.Errorf("%w: changes after %d were requested, but merge or cold storage archival discarded changes up to %d", ErrChangesCompacted, since, compacted)
+	}
+	records, err := v.changeRecords(since, segments)
+	if err != nil {
+		return 0, err
+	}
+	for _, rec := range records {
+		change, err := v.change(rec)
+		if err != nil {
+			return 0, err
+		}
+		if err := fn(change); err != nil {
+			return 0, err
+		}
+	}
+	return v.Seq, nil
+}
+
+// changeSegment - сегмент, зафіксований changesView.
+type changeSegment struct {
+	id   int
+	size int64
+	// seqs відомі для запечатаних сегментів; активний сегмент читається завжди.
+	seqs  segmentSeqs
+	known bool
+}
+
+// changesView фіксує файли сегментів, їх розміри та номери записів. Повертає View без
+// індексу (лише для читання записів) і CompactedSeq.
+func (db *Db) changesView() (*View, []changeSegment, uint64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	db.flushShardsLocked()
+	v := &View{db: db, Seq: db.seq, files: make(map[int]*os.File, len(db.segmentFiles)), cold: db.coldSegmentsLocked()}
+	db.blobs.mu.RLock()
+	v.blobs = make(map[blobHash]indexValue, len(db.blobs.locs))
+	for h, loc := range db.blobs.locs {
+		v.blobs[h] = loc
+	}
+	db.blobs.mu.RUnlock()
+	db.pinSegmentFilesLocked(v.files)
+	segments := make([]changeSegment, 0, len(v.files))
+	for segID, file := range v.files {
+		seg := changeSegment{id: segID}
+		if stat, err := file.Stat(); err == nil {
+			seg.size = stat.Size()
+		}
+		if !db.isActiveLocked(segID) {
+			seg.seqs, seg.known = db.manifest.segmentSeqs(segID)
+		}
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].id < segments[j].id })
+	_, compacted := db.manifest.seqBounds()
+	return v, segments, compacted
+}
+
+// changeRecords знаходить у сегментах записи з номерами після since, не замінені пізнішими,
+// і повертає їх у порядку номерів.
+func (v *View) changeRecords(since uint64, segments []changeSegment) ([]changeRecord, error) {
+	var records []changeRecord
+	for _, seg := range segments {
+		if seg.known && seg.seqs.Last <= since {
+			continue
+		}
+		// Термін дії пишеться одразу після запису значення, до якого належить.
+		last := -1
+		err := scanRecords(io.NewSectionReader(v.files[seg.id], 0, seg.size), func(e entry, offset, size int64) {
+			if e.dataType == dataTypeExpiry {
+				if last >= 0 && records[last].key == e.key {
+					records[last].expiresAt = e.valueInt
+				}
+				return
+			}
+			last = -1
+			if e.dataType == dataTypeBlob || e.seq <= since || e.seq > v.Seq {
+				return
+			}
+			records = append(records, changeRecord{
+				seq:       e.seq,
+				key:       e.key,
+				loc:       indexValue{segmentID: seg.id, offset: offset, size: size, dataType: e.dataType},
+				timestamp: e.timestamp,
+			})
+			last = len(records) - 1
+		})
+		if err != nil {
+			return nil, fmt.Errorf("changes: segment %d: %w", seg.id, err)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].seq < records[j].seq })
+
+	// Від найновіших до найстаріших відкидаємо записи, замінені пізнішими.
+	replaced := make(map[string]bool)
+	var prefixes []string
+	kept := records[:0:0]
+	for i := len(records) - 1; i >= 0; i-- {
+		rec := records[i]
+		// Видалення префікса замінює лише видалення ширшого префікса, а не запис ключа, що збігається з ним.
+		if rec.loc.dataType != dataTypeRangeTombstone && replaced[rec.key] || hasAnyPrefix(rec.key, prefixes) {
+			continue
+		}
+		kept = append(kept, rec)
+		switch rec.loc.dataType {
+		case DataTypeSeries:
+		case dataTypeRangeTombstone:
+			prefixes = append(prefixes, rec.key)
+		default:
+			replaced[rec.key] = true
+		}
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return kept, nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// change читає значення запису rec.
+func (v *View) change(rec changeRecord) (Change, error) {
+	change := Change{Seq: rec.seq, ExpiresAt: rec.expiresAt, Value: KeyValue{Key: rec.key}}
+	if rec.timestamp != 0 {
+		change.WrittenAt = time.Unix(0, rec.timestamp)
+	}
+	switch rec.loc.dataType {
+	case dataTypeTombstone:
+		change.Deleted = true
+		return change, nil
+	case dataTypeRangeTombstone:
+		change.DeletedPrefix = true
+		return change, nil
+	}
+	record, err := v.readRecord(rec.key, rec.loc)
+	if err != nil {
+		return Change{}, fmt.Errorf("changes: %w", err)
+	}
+	if record.dataType == DataTypeSeries {
+		change.Value = KeyValue{Key: rec.key, Value: record.points, DataType: DataTypeSeries}
+	} else {
+		change.Value = record.keyValue()
+	}
+	return change, nil
+}
+
+// restoreSeqLocked відновлює номер останнього запису після завантаження сегментів.
+// Номери сегментів, яких немає в маніфесті (записаних до появи номерів або не запечатаних
+// через збій чи закриття бази), читаються з самих сегментів і зберігаються в маніфесті.
+// Викликається під db.mu.
+func (db *Db) restoreSeqLocked(segmentIDs []int) error {
+	db.seq, _ = db.manifest.seqBounds()
+	for _, segID := range segmentIDs {
+		seqs, ok := db.manifest.segmentSeqs(segID)
+		if !ok {
+			var err error
+			if seqs, err = scanSegmentSeqs(db.segmentFiles[segID]); err != nil {
+				return fmt.Errorf("failed to read sequence numbers of segment %d: %w", segID, err)
+			}
+			if err := db.manifest.setSeqs(segID, seqs); err != nil {
+				db.opts.Logger.Warnf("%v", err)
+			}
+		}
+		db.seq = max(db.seq, seqs.Last)
+	}
+	return nil
+}
+
+// scanSegmentSeqs читає номери записів сегмента file.
+func scanSegmentSeqs(file *os.File) (segmentSeqs, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return segmentSeqs{}, err
+	}
+	var seqs segmentSeqs
+	err = scanRecords(io.NewSectionReader(file, 0, stat.Size()), func(e entry, _, _ int64) {
+		seqs.add(e)
+	})
+	return seqs, err
+}
@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// collectChanges повертає зміни після since та номер, переданий для наступного виклику.
+func collectChanges(t *testing.T, db *Db, since uint64) ([]Change, uint64) {
+	t.Helper()
+	var changes []Change
+	upTo, err := db.ChangesSince(since, func(c Change) error {
+		changes = append(changes, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ChangesSince(%d): %v", since, err)
+	}
+	return changes, upTo
+}
+
+func TestDb_ChangesSince(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("old%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	since := db.LastSeq()
+	if since != 40 {
+		t.Fatalf("LastSeq() = %d after 40 writes", since)
+	}
+
+	shared := "a value long enough to be shared"
+	steps := []func() error{
+		func() error { return db.Put("a", "first") },
+		func() error { return db.Put("a", "second") },
+		func() error { return db.Put("b", shared) },
+		func() error { return db.PutInt64("counter", 7) },
+		func() error { return db.Copy("old39", "session", CopyOptions{TTL: time.Hour}) },
+		func() error { return db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 1}) },
+		func() error { return db.AppendSeries("series", SeriesPoint{Timestamp: 2, Value: 2}) },
+		func() error { return db.Delete("old00") },
+		func() error { _, err := db.DeletePrefix("old1"); return err },
+		func() error { return db.Put("old15", "back") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, upTo := collectChanges(t, db, since)
+	if upTo != db.LastSeq() {
+		t.Errorf("ChangesSince returned %d, last sequence number is %d", upTo, db.LastSeq())
+	}
+	var got []string
+	for i, c := range changes {
+		if i > 0 && c.Seq <= changes[i-1].Seq {
+			t.Errorf("changes are not ordered by sequence number: %d after %d", c.Seq, changes[i-1].Seq)
+		}
+		switch {
+		case c.Deleted:
+			got = append(got, "delete "+c.Value.Key)
+		case c.DeletedPrefix:
+			got = append(got, "delete prefix "+c.Value.Key)
+		default:
+			got = append(got, fmt.Sprintf("%s=%v", c.Value.Key, c.Value.Value))
+		}
+		if c.Value.Key == "session" && c.ExpiresAt == 0 {
+			t.Error("change of a key with TTL has no expiry")
+		}
+	}
+	// Перше значення "a" замінене другим і не передається.
+	want := []string{
+		"a=second", "b=" + shared, "counter=7", "session=value",
+		"series=[{1 1}]", "series=[{2 2}]", "delete old00", "delete prefix old1", "old15=back",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes = %q\nwant %q", got, want)
+	}
+	if changes, _ := collectChanges(t, db, upTo); len(changes) != 0 {
+		t.Errorf("%d changes after the last sequence number", len(changes))
+	}
+	if _, err := db.ChangesSince(upTo+1, func(Change) error { return nil }); !errors.Is(err, ErrUnknownSeq) {
+		t.Errorf("ChangesSince ahead of the database = %v, want ErrUnknownSeq", err)
+	}
+
+	// Номери переживають перезапуск.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.LastSeq() != upTo {
+		t.Fatalf("LastSeq() after reopen = %d, want %d", db.LastSeq(), upTo)
+	}
+	if err := db.Put("c", "after reopen"); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _ := collectChanges(t, db, upTo); len(changes) != 1 || changes[0].Seq != upTo+1 {
+		t.Errorf("changes after reopen = %+v", changes)
+	}
+	if reopened, _ := collectChanges(t, db, since); len(reopened) != len(want)+1 {
+		t.Errorf("%d changes after reopen, want %d", len(reopened), len(want)+1)
+	}
+
+	// Злиття відкидає видалення, тож зміни до них уже не відтворити.
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ChangesSince(since, func(Change) error { return nil }); !errors.Is(err, ErrChangesCompacted) {
+		t.Errorf("ChangesSince before merged deletions = %v, want ErrChangesCompacted", err)
+	}
+	if changes, _ := collectChanges(t, db, upTo); len(changes) != 1 || changes[0].Value.Key != "c" {
+		t.Errorf("changes after the merged deletions = %+v", changes)
+	}
+}
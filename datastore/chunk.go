@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// Значення, запис якого не вміщується в сегмент, зберігається частинами: кожна частина -
+// запис dataTypeBlob (як спільне значення при дедуплікації, див. dedup.go), а запис
+// dataTypeChunked з ключем користувача містить тип значення та хеші частин по порядку.
+// Частини пишуться окремими записами, тож сегменти чергуються між ними як звичайно.
+// Запис ключа йде останнім: якщо процес впаде раніше, частини без посилань відкине злиття.
+
+// needsChunking повідомляє, чи треба зберегти значення частинами: закодований запис
+// більший за сегмент, а тип значення - рядок, байти або JSON.
+func (db *Db) needsChunking(dataType byte, encodedSize int) bool {
+	return db.opts.MaxFileSize > 0 && int64(encodedSize) > db.opts.MaxFileSize && compressible(dataType)
+}
+
+// chunkSize - розмір частини значення; запис частини разом із заголовком вміщується в сегмент.
+func (db *Db) chunkSize() int {
+	return max(int(db.opts.MaxFileSize/2), 1)
+}
+
+// writeChunksLocked записує частини значення e і повертає запис dataTypeChunked, що
+// на них посилається. Частини, які вже записані й мають посилання, не пишуться повторно.
+// Викликається під db.mu.
+func (db *Db) writeChunksLocked(e entry) (entry, error) {
+	size := db.chunkSize()
+	chunked := entry{key: e.key, dataType: dataTypeChunked, chunkType: e.dataType, timestamp: e.timestamp, seq: e.seq}
+	written := make(map[blobHash]bool)
+	sh := db.shardFor(e.key)
+	for start := 0; start < len(e.value); start += size {
+		part := e.value[start:min(start+size, len(e.value))]
+		h := blobHash(sha256.Sum256([]byte(part)))
+		chunked.chunks = append(chunked.chunks, h)
+		if written[h] || db.blobs.reusable(h) {
+			continue
+		}
+		blob := entry{key: h.String(), value: part, dataType: dataTypeBlob, timestamp: e.timestamp}
+		data, err := db.seal(blob.Encode())
+		if err != nil {
+			return entry{}, err
+		}
+		segID, offset, err := db.appendToActiveSegment(sh, data)
+		if err != nil {
+			return entry{}, fmt.Errorf("failed to write chunk %d of key '%s': %w", len(chunked.chunks)-1, e.key, err)
+		}
+		loc := indexValue{segmentID: segID, offset: offset, size: int64(len(data)), dataType: dataTypeBlob}
+		db.blobs.setLocation(h, loc)
+		sh.hints = append(sh.hints, hintRecord{key: h.String(), offset: offset, size: loc.size, dataType: dataTypeBlob})
+		written[h] = true
+	}
+	return chunked, nil
+}
+
+// assembleChunksLocked збирає значення запису dataTypeChunked з його частин.
+// Викликається під db.mu або db.segMu.
+func (db *Db) assembleChunksLocked(record entry) (entry, error) {
+	var value strings.Builder
+	for i, h := range record.chunks {
+		loc, ok := db.blobs.location(h)
+		if !ok {
+			return record, fmt.Errorf("chunk %d (%s) of key '%s' not found", i, h, record.key)
+		}
+		chunk, err := db.readRecordLocked(h.String(), loc)
+		if err != nil {
+			return record, err
+		}
+		if chunk.dataType != dataTypeBlob {
+			return record, fmt.Errorf("record for chunk %s has type %d", h, chunk.dataType)
+		}
+		value.WriteString(chunk.value)
+	}
+	record.dataType = record.chunkType
+	record.value = value.String()
+	record.chunks = nil
+	return record, nil
+}
+
+// encodeChunkList кодує значення запису dataTypeChunked: [тип значення][хеші частин].
+func encodeChunkList(chunkType byte, chunks []blobHash) []byte {
+	res := make([]byte, 0, 1+len(chunks)*len(blobHash{}))
+	res = append(res, chunkType)
+	for _, h := range chunks {
+		res = append(res, h[:]...)
+	}
+	return res
+}
+
+func decodeChunkList(valueBytes []byte) (byte, []blobHash, error) {
+	hashSize := len(blobHash{})
+	if len(valueBytes) < 1 || (len(valueBytes)-1)%hashSize != 0 {
+		return 0, nil, fmt.Errorf("invalid length for chunk list: %d", len(valueBytes))
+	}
+	chunks := make([]blobHash, (len(valueBytes)-1)/hashSize)
+	for i := range chunks {
+		copy(chunks[i][:], valueBytes[1+i*hashSize:])
+	}
+	return valueBytes[0], chunks, nil
+}
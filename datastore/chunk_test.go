@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDb_ChunkedValues(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for i := 0; b.Len() < 5*int(testMaxFileSize); i++ {
+		fmt.Fprintf(&b, "line %d;", i)
+	}
+	large := b.String()
+	largeBytes := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, int(testMaxFileSize))
+	if err := db.Put("large", large); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBytes("bytes", largeBytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("small", "value"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(stage string) {
+		t.Helper()
+		if v, err := db.Get("large"); err != nil || v != large {
+			t.Errorf("%s: Get(large) = %d bytes, %v", stage, len(v), err)
+		}
+		if v, err := db.GetBytes("bytes"); err != nil || !bytes.Equal(v, largeBytes) {
+			t.Errorf("%s: GetBytes(bytes) = %d bytes, %v", stage, len(v), err)
+		}
+		if _, err := db.GetInt64("large"); err != ErrWrongType {
+			t.Errorf("%s: GetInt64(large) = %v, want ErrWrongType", stage, err)
+		}
+		if stats, _ := db.Stats(); stats.ChunkedValues != 2 {
+			t.Errorf("%s: ChunkedValues = %d, want 2", stage, stats.ChunkedValues)
+		}
+	}
+	check("after put")
+
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		if segment.Size > testMaxFileSize {
+			t.Errorf("segment %d is %d bytes, larger than MaxFileSize", segment.ID, segment.Size)
+		}
+	}
+
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check("after merge")
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+	db.Close()
+
+	hints, _ := filepath.Glob(filepath.Join(dir, hintFileNamePrefix+"*"))
+	for _, hint := range hints {
+		if err := os.Remove(hint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen without hints")
+
+	// Після перезапису частини значення більше не потрібні й відкидаються злиттям.
+	if err := db.Put("large", "short"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("bytes"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := db.Stats(); stats.SharedValues != 0 || stats.ChunkedValues != 0 {
+		t.Errorf("after overwrite: %d chunks of %d chunked values survived merge", stats.SharedValues, stats.ChunkedValues)
+	}
+	if v, err := db.Get("large"); err != nil || v != "short" {
+		t.Errorf("Get(large) after overwrite = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,140 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CleanupReport - що база прибрала в директорії під час відкриття.
+type CleanupReport struct {
+	At time.Time `json:"at"`
+	// StaleLockPID - PID процесу, який відкривав базу й завершився, не закривши її; 0 - базу закрили коректно.
+	StaleLockPID int `json:"staleLockPid,omitempty"`
+	// TempFiles - видалені недописані файли: результати перерваного злиття, тимчасові файли
+	// підказок і фільтрів та сегменти, відкладені для View.
+	TempFiles []string `json:"tempFiles,omitempty"`
+	// OrphanFiles - видалені файли підказок і фільтрів, сегментів яких немає.
+	OrphanFiles []string `json:"orphanFiles,omitempty"`
+	// EmptySegments - номери видалених сегментів нульової довжини.
+	EmptySegments []int `json:"emptySegments,omitempty"`
+	// Errors - файли, які не вдалося видалити.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// UncleanShutdown повідомляє, чи залишив попередній процес слід аварійного завершення:
+// PID у файлі блокування або недописані файли.
+func (r CleanupReport) UncleanShutdown() bool {
+	return r.StaleLockPID != 0 || len(r.TempFiles) > 0
+}
+
+// empty повідомляє, чи не було чого прибирати.
+func (r CleanupReport) empty() bool {
+	return !r.UncleanShutdown() && len(r.OrphanFiles) == 0 && len(r.EmptySegments) == 0 && len(r.Errors) == 0
+}
+
+// log записує звіт одним рядком, якщо було що прибирати.
+func (r CleanupReport) log(logger Logger) {
+	if r.empty() {
+		return
+	}
+	logger.Infof("Cleanup: unclean_shutdown=%t stale_lock_pid=%d temp_files=%d orphan_files=%d empty_segments=%v errors=%d",
+		r.UncleanShutdown(), r.StaleLockPID, len(r.TempFiles), len(r.OrphanFiles), r.EmptySegments, len(r.Errors))
+	for _, e := range r.Errors {
+		logger.Warnf("cleanup: %s", e)
+	}
+}
+
+// remove видаляє файл path і повертає false, якщо це не вдалося.
+func (r *CleanupReport) remove(path string) bool {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		r.Errors = append(r.Errors, err.Error())
+		return false
+	}
+	return true
+}
+
+// cleanupDirLocked прибирає директорію бази перед завантаженням сегментів і записує
+// зроблене в db.cleanup. Повертає шляхи до сегментів і до заглушок архівованих сегментів
+// (див. coldtier.go) за номерами та найбільший номер серед усіх знайдених сегментів,
+// включно з видаленими порожніми (-1, якщо їх немає): номери сегментів не використовуються
+// повторно.
+func (db *Db) cleanupDirLocked() (map[int]string, map[int]string, int, error) {
+	report := &db.cleanup
+	report.At = time.Now()
+	files, err := filepath.Glob(filepath.Join(db.dir, outFileNamePrefix+"*"))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to glob segment files: %w", err)
+	}
+	segmentFilePaths := make(map[int]string)
+	coldPaths := make(map[int]string)
+	maxSegID := -1
+	for _, filePath := range files {
+		baseName := filepath.Base(filePath)
+		if strings.HasSuffix(baseName, mergeFileNameSuffix) || strings.HasSuffix(baseName, ".tmp") || strings.Contains(baseName, pinnedFileSuffix) {
+			if report.remove(filePath) {
+				report.TempFiles = append(report.TempFiles, baseName)
+			}
+			continue
+		}
+		if name, ok := strings.CutSuffix(baseName, coldStubSuffix); ok {
+			if segID, errConv := strconv.Atoi(strings.TrimPrefix(name, outFileNamePrefix)); errConv == nil {
+				maxSegID = max(maxSegID, segID)
+				coldPaths[segID] = filePath
+			}
+			continue
+		}
+		segID, errConv := strconv.Atoi(strings.TrimPrefix(baseName, outFileNamePrefix))
+		if errConv != nil {
+			continue
+		}
+		maxSegID = max(maxSegID, segID)
+		if info, statErr := os.Stat(filePath); statErr == nil && info.Size() == 0 && report.remove(filePath) {
+			report.EmptySegments = append(report.EmptySegments, segID)
+			continue
+		}
+		segmentFilePaths[segID] = filePath
+	}
+	for segID, path := range coldPaths {
+		// Архівацію перервано після запису заглушки: локальний файл ще цілий.
+		if _, ok := segmentFilePaths[segID]; ok {
+			if report.remove(path) {
+				report.TempFiles = append(report.TempFiles, filepath.Base(path))
+			}
+			delete(coldPaths, segID)
+		}
+	}
+	if len(report.EmptySegments) > 0 {
+		if err := db.manifest.forgetSegments(report.EmptySegments); err != nil {
+			db.opts.Logger.Warnf("%v", err)
+		}
+	}
+	for _, prefix := range []string{hintFileNamePrefix, bloomFileNamePrefix} {
+		paths, globErr := filepath.Glob(filepath.Join(db.dir, prefix+"*"))
+		if globErr != nil {
+			continue
+		}
+		for _, path := range paths {
+			baseName := filepath.Base(path)
+			if strings.HasSuffix(baseName, ".tmp") {
+				if report.remove(path) {
+					report.TempFiles = append(report.TempFiles, baseName)
+				}
+				continue
+			}
+			segID, errConv := strconv.Atoi(strings.TrimPrefix(baseName, prefix))
+			if errConv != nil {
+				continue
+			}
+			_, cold := coldPaths[segID]
+			if _, ok := segmentFilePaths[segID]; !ok && !cold && report.remove(path) {
+				report.OrphanFiles = append(report.OrphanFiles, baseName)
+			}
+		}
+	}
+	report.log(db.opts.Logger)
+	return segmentFilePaths, coldPaths, maxSegID, nil
+}
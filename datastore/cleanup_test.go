@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDb_StartupCleanup(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := os.ReadFile(filepath.Join(dir, lockFileName)); err != nil || len(raw) != 0 {
+		t.Fatalf("lock file after Close contains %q, %v; want it empty", raw, err)
+	}
+
+	// Слід аварійного завершення: PID у файлі блокування, недописане злиття,
+	// підказки без сегмента та порожній сегмент.
+	files := map[string]string{
+		lockFileName: "999999\n",
+		outFileNamePrefix + "1" + mergeFileNameSuffix: "partial",
+		hintFileNamePrefix + "0.tmp":                  "partial",
+		hintFileNamePrefix + "42":                     "orphan",
+		bloomFileNamePrefix + "42":                    "orphan",
+		outFileNamePrefix + "50":                      "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := stats.LastCleanup
+	if !report.UncleanShutdown() || report.StaleLockPID != 999999 {
+		t.Errorf("cleanup report %+v does not record the stale lock", report)
+	}
+	if len(report.TempFiles) != 2 || len(report.OrphanFiles) != 2 || fmt.Sprint(report.EmptySegments) != "[50]" || len(report.Errors) != 0 {
+		t.Errorf("cleanup report = %+v", report)
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); name != lockFileName && !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	if v, err := db.Get("key"); err != nil || v != "value" {
+		t.Errorf("Get after cleanup = %q, %v", v, err)
+	}
+	// Номер видаленого порожнього сегмента не використовується повторно.
+	if db.shards[0].segmentID <= 50 {
+		t.Errorf("active segment = %d, want a number above the removed segment 50", db.shards[0].segmentID)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stats, _ = db.Stats()
+	if stats.LastCleanup.UncleanShutdown() || stats.LastCleanup.StaleLockPID != 0 {
+		t.Errorf("cleanup after a clean shutdown = %+v", stats.LastCleanup)
+	}
+}
@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AsString повертає значення у вигляді рядка: рядки, байти та JSON-документи без змін, числа - у десятковому
+// записі, bool - як "true" або "false".
+func (kv KeyValue) AsString() (string, error) {
+	switch v := kv.Value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case json.RawMessage:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("%w: value of type %d cannot be rendered as a string", ErrWrongType, kv.DataType)
+}
+
+// AsInt64 повертає значення як int64: рядки з десятковим числом розбираються,
+// інші рядки дають ErrWrongType.
+func (kv KeyValue) AsInt64() (int64, error) {
+	switch v := kv.Value.(type) {
+	case int64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: value %q is not an int64", ErrWrongType, v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%w: value of type %d cannot be converted to int64", ErrWrongType, kv.DataType)
+}
+
+// GetAsString повертає значення ключа будь-якого скалярного типу у вигляді рядка.
+// На відміну від Get, не вимагає, щоб значення зберігалося як рядок.
+func (db *Db) GetAsString(key string) (string, error) {
+	kv, _, err := db.GetWithETag(key)
+	if err != nil {
+		return "", err
+	}
+	return kv.AsString()
+}
+
+// GetAsInt64 повертає значення ключа як int64, розбираючи числові рядки.
+// На відміну від GetInt64, приймає рядкові значення на кшталт "42".
+func (db *Db) GetAsInt64(key string) (int64, error) {
+	kv, _, err := db.GetWithETag(key)
+	if err != nil {
+		return 0, err
+	}
+	return kv.AsInt64()
+}
@@ -0,0 +1,47 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDb_GetAsCoercion(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if err := db.PutInt64("number", -42); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("numeric", " 17 "); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("text", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := db.GetAsString("number"); err != nil || s != "-42" {
+		t.Errorf("GetAsString(number) = %q, %v", s, err)
+	}
+	if s, err := db.GetAsString("text"); err != nil || s != "hello" {
+		t.Errorf("GetAsString(text) = %q, %v", s, err)
+	}
+	if n, err := db.GetAsInt64("numeric"); err != nil || n != 17 {
+		t.Errorf("GetAsInt64(numeric) = %d, %v", n, err)
+	}
+	if n, err := db.GetAsInt64("number"); err != nil || n != -42 {
+		t.Errorf("GetAsInt64(number) = %d, %v", n, err)
+	}
+	if _, err := db.GetAsInt64("text"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetAsInt64(text): got %v, want ErrWrongType", err)
+	}
+	if _, err := db.GetAsString("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAsString(missing): got %v, want ErrNotFound", err)
+	}
+
+	// Типізовані методи не послаблюються.
+	if _, err := db.Get("number"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Get(number): got %v, want ErrWrongType", err)
+	}
+	if _, err := db.GetInt64("numeric"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetInt64(numeric): got %v, want ErrWrongType", err)
+	}
+}
@@ -0,0 +1,543 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// Холодний рівень (Options.ColdStorage). Запечатані сегменти, в які давно не писали,
+// завантажуються в S3-сумісне сховище, а локальний файл замінюється заглушкою segment-N.cold
+// з іменем об'єкта та розміром. Підказки й фільтр Блума сегмента лишаються на диску, тож
+// індекс будується без звернень до сховища, а записи архівованого сегмента читаються зі
+// сховища або з його локальної копії, якщо ColdStorage.Cache увімкнено.
+//
+// Архівуються лише найстаріші сегменти: ідентифікатори холодних сегментів менші за
+// ідентифікатори всіх локальних, тож злиття, яке бере лише локальні сегменти, не змінює
+// порядку записів. Холодні сегменти не зливаються, і місце перезаписаних у них ключів не
+// звільняється. Щоб видалені ключі з холодних сегментів не повернулися після відкриття,
+// злиття, відкидаючи надгробки, пише нові надгробки для таких ключів. Об'єкти зі сховища
+// база не видаляє.
+
+const (
+	coldStubSuffix = ".cold"
+	// coldCacheDirName - піддиректорія з локальними копіями архівованих сегментів.
+	coldCacheDirName          = "cold-cache"
+	defaultColdAfter          = 24 * time.Hour
+	defaultColdCheckInterval  = time.Minute
+	defaultColdRequestTimeout = time.Minute
+	defaultColdRegion         = "us-east-1"
+)
+
+// ErrColdStorageDisabled повертається ArchiveColdSegments, якщо Options.ColdStorage не задано.
+var ErrColdStorageDisabled = errors.New("cold storage is not configured")
+
+// ColdStorage налаштовує холодний рівень у S3-сумісному сховищі. Порожні Endpoint або
+// Bucket вимикають його.
+type ColdStorage struct {
+	// Endpoint - адреса сховища, наприклад https://s3.eu-central-1.amazonaws.com
+	// або http://minio:9000. Бакет адресується в шляху.
+	Endpoint string
+	Bucket   string
+	// Region - регіон для підпису запитів; за замовчуванням us-east-1.
+	Region string
+	// AccessKeyID та SecretAccessKey - ключі доступу. Без AccessKeyID запити не підписуються.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Prefix додається до імен об'єктів, наприклад "db/".
+	Prefix string
+	// After - скільки часу в сегмент не мають писати, щоб його архівувати.
+	After time.Duration
+	// CheckInterval - період фонової архівації. Від'ємне значення її вимикає;
+	// архівувати можна й викликом ArchiveColdSegments.
+	CheckInterval time.Duration
+	// Cache зберігає завантажені з сховища сегменти в піддиректорії cold-cache,
+	// тож сховище читається один раз на сегмент, а не на кожен запис.
+	Cache bool
+	// Client виконує запити; за замовчуванням клієнт з тайм-аутом у хвилину.
+	Client *http.Client
+}
+
+func (c ColdStorage) enabled() bool {
+	return c.Endpoint != "" && c.Bucket != ""
+}
+
+func (c ColdStorage) withDefaults() ColdStorage {
+	if c.Region == "" {
+		c.Region = defaultColdRegion
+	}
+	if c.After <= 0 {
+		c.After = defaultColdAfter
+	}
+	if c.CheckInterval == 0 {
+		c.CheckInterval = defaultColdCheckInterval
+	}
+	return c
+}
+
+// coldStub - вміст заглушки архівованого сегмента.
+type coldStub struct {
+	Object     string    `json:"object"`
+	Size       int64     `json:"size"`
+	Checksum   uint32    `json:"crc32"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+func coldStubPath(dir string, segID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", outFileNamePrefix, segID, coldStubSuffix))
+}
+
+// coldSegment читає архівований сегмент зі сховища або з локальної копії.
+type coldSegment struct {
+	stub  coldStub
+	store *s3Client
+	// cachePath - шлях локальної копії; порожній, якщо кеш вимкнено.
+	cachePath string
+	// keys - ключі, значення яких записані в сегменті, див. coldTombstonesLocked.
+	keys []string
+
+	mu    sync.Mutex
+	cache *os.File
+}
+
+func (db *Db) newColdSegment(stub coldStub) *coldSegment {
+	seg := &coldSegment{stub: stub, store: db.coldStore}
+	if db.opts.ColdStorage.Cache {
+		seg.cachePath = filepath.Join(db.dir, coldCacheDirName, path.Base(stub.Object))
+	}
+	return seg
+}
+
+func (s *coldSegment) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.stub.Size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if rest := s.stub.Size - off; int64(want) > rest {
+		p = p[:rest]
+	}
+	var n int
+	var err error
+	if s.cachePath != "" {
+		var f *os.File
+		if f, err = s.cached(); err == nil {
+			n, err = f.ReadAt(p, off)
+		}
+	} else {
+		n, err = s.store.readRange(s.stub.Object, p, off)
+	}
+	if err == nil && n < want {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// cached повертає локальну копію сегмента, завантажуючи її при першому зверненні.
+func (s *coldSegment) cached() (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache != nil {
+		return s.cache, nil
+	}
+	if f, err := os.Open(s.cachePath); err == nil {
+		if stat, statErr := f.Stat(); statErr == nil && stat.Size() == s.stub.Size {
+			s.cache = f
+			return f, nil
+		}
+		_ = f.Close()
+	}
+	var buf bytes.Buffer
+	if err := s.download(&buf); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.cachePath), 0755); err != nil {
+		return nil, fmt.Errorf("cold storage: failed to create cache directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(s.cachePath, buf.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("cold storage: failed to cache %s: %w", s.stub.Object, err)
+	}
+	f, err := os.Open(s.cachePath)
+	if err != nil {
+		return nil, fmt.Errorf("cold storage: failed to open cached %s: %w", s.stub.Object, err)
+	}
+	s.cache = f
+	return f, nil
+}
+
+// download завантажує весь сегмент у buf і перевіряє його розмір та контрольну суму.
+func (s *coldSegment) download(buf *bytes.Buffer) error {
+	if err := s.store.download(s.stub.Object, buf); err != nil {
+		return err
+	}
+	if int64(buf.Len()) != s.stub.Size || crc32.ChecksumIEEE(buf.Bytes()) != s.stub.Checksum {
+		return fmt.Errorf("cold storage: object %s does not match the archived segment (%d bytes, expected %d)", s.stub.Object, buf.Len(), s.stub.Size)
+	}
+	return nil
+}
+
+func (s *coldSegment) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		return nil
+	}
+	err := s.cache.Close()
+	s.cache = nil
+	return err
+}
+
+// coldKeys повертає ключі записів значень серед записів сегмента.
+func coldKeys(records []hintRecord) []string {
+	var keys []string
+	for _, rec := range records {
+		switch rec.dataType {
+		case dataTypeTombstone, dataTypeRangeTombstone, dataTypeBlob, dataTypeExpiry:
+		default:
+			keys = append(keys, rec.key)
+		}
+	}
+	return keys
+}
+
+// openColdSegmentLocked реєструє архівований сегмент під час відкриття бази й застосовує
+// його записи до індексу. Викликається під db.mu.
+func (db *Db) openColdSegmentLocked(segID int, stubPath string) error {
+	if db.coldStore == nil {
+		return fmt.Errorf("segment %d is archived in cold storage, but Options.ColdStorage is not configured", segID)
+	}
+	data, err := os.ReadFile(stubPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cold segment stub %s: %w", stubPath, err)
+	}
+	var stub coldStub
+	if err := json.Unmarshal(data, &stub); err != nil || stub.Object == "" {
+		return fmt.Errorf("invalid cold segment stub %s: %v", stubPath, err)
+	}
+	seg := db.newColdSegment(stub)
+	// Записи посилань і термінів дії читаються з сегмента вже під час застосування підказок.
+	db.coldSegments[segID] = seg
+	records, err := readHintFile(db.dir, segID, stub.Size)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			db.opts.Logger.Warnf("ignoring hint file for cold segment %d: %v", segID, err)
+		}
+		if records, err = seg.scan(); err != nil {
+			return fmt.Errorf("failed to scan cold segment %d: %w", segID, err)
+		}
+		if err := writeHintFile(db.dir, segID, stub.Size, records); err != nil {
+			db.opts.Logger.Warnf("%v", err)
+		}
+	}
+	seg.keys = coldKeys(records)
+	db.loadSegmentBloomLocked(segID, records)
+	if db.currentIndex.disk != nil && db.loadSegmentTableLocked(segID, stub.Size) {
+		return nil
+	}
+	return db.indexSegmentRecordsLocked(segID, stub.Size, records)
+}
+
+// errStaleRead - запис ключа змінився, поки точкове читання завантажувало його з
+// архівованого сегмента без замка; читання треба повторити.
+var errStaleRead = errors.New("index entry changed during cold read")
+
+// readAndUnlock читає запис idxVal для точкового читання з reader, отриманого під
+// db.segMu.RLock, і знімає замок. Архівований сегмент не змінюється, тож його записи
+// читаються зі сховища або локальної копії вже без segMu, і звернення до сховища не
+// затримують злиття та архівацію. Розташування спільних значень і частин шукаються під
+// segMu, щоб злиття не перемістило їх, а з холодних сегментів вони теж читаються без замка.
+func (db *Db) readAndUnlock(key string, reader io.ReaderAt, idxVal indexValue) (entry, error) {
+	var record entry
+	var err error
+	if cold, ok := reader.(*coldSegment); ok {
+		db.segMu.RUnlock()
+		if record, err = readRecordFrom(cold, db.keys, key, idxVal); err != nil || refParts(record) == nil {
+			return record, err
+		}
+		db.segMu.RLock()
+		if current, ok := db.currentIndex.get(key); !ok || current != idxVal {
+			// Ключ перезаписали, і його спільне значення могло зникнути.
+			db.segMu.RUnlock()
+			return record, errStaleRead
+		}
+	} else if record, err = readRecordFrom(reader, db.keys, key, idxVal); err != nil || refParts(record) == nil {
+		db.segMu.RUnlock()
+		return record, err
+	}
+	values, coldParts, err := db.readPartsLocked(record.key, refParts(record))
+	db.segMu.RUnlock()
+	if err != nil {
+		return record, err
+	}
+	for i, part := range coldParts {
+		if values[i], err = readBlobValue(part.seg, db.keys, part.hash, part.loc); err != nil {
+			return record, err
+		}
+	}
+	if record.dataType == dataTypeRef {
+		record.dataType = DataTypeString
+		record.value = values[0]
+		return record, nil
+	}
+	record.dataType = record.chunkType
+	record.value = strings.Join(values, "")
+	record.chunks = nil
+	return record, nil
+}
+
+// refParts повертає хеші спільного значення запису-посилання або частин запису,
+// збереженого частинами; для інших записів - nil.
+func refParts(record entry) []blobHash {
+	switch record.dataType {
+	case dataTypeRef:
+		return []blobHash{record.ref}
+	case dataTypeChunked:
+		return record.chunks
+	}
+	return nil
+}
+
+// coldPart - спільне значення чи частина в архівованому сегменті, яку readAndUnlock
+// читає після зняття db.segMu.
+type coldPart struct {
+	seg  *coldSegment
+	hash blobHash
+	loc  indexValue
+}
+
+// readPartsLocked читає значення hashes з локальних сегментів, а ті, що лежать в
+// архівованих, лише знаходить і повертає за їх номерами. Викликається під db.segMu.
+func (db *Db) readPartsLocked(key string, hashes []blobHash) ([]string, map[int]coldPart, error) {
+	values := make([]string, len(hashes))
+	var cold map[int]coldPart
+	for i, h := range hashes {
+		loc, ok := db.blobs.location(h)
+		if !ok {
+			return nil, nil, fmt.Errorf("shared value %s for key '%s' not found", h, key)
+		}
+		reader, ok := db.segmentReaderLocked(loc.segmentID)
+		if !ok {
+			return nil, nil, fmt.Errorf("segment %d with shared value %s for key '%s' is not open", loc.segmentID, h, key)
+		}
+		if seg, isCold := reader.(*coldSegment); isCold {
+			if cold == nil {
+				cold = make(map[int]coldPart)
+			}
+			cold[i] = coldPart{seg: seg, hash: h, loc: loc}
+			continue
+		}
+		var err error
+		if values[i], err = readBlobValue(reader, db.keys, h, loc); err != nil {
+			return nil, nil, err
+		}
+	}
+	return values, cold, nil
+}
+
+func readBlobValue(reader io.ReaderAt, keys *keyring, h blobHash, loc indexValue) (string, error) {
+	blob, err := readRecordFrom(reader, keys, h.String(), loc)
+	if err != nil {
+		return "", err
+	}
+	if blob.dataType != dataTypeBlob {
+		return "", fmt.Errorf("record for shared value %s has type %d", h, blob.dataType)
+	}
+	return blob.value, nil
+}
+
+// scan завантажує сегмент і повертає його записи індексу.
+func (s *coldSegment) scan() ([]hintRecord, error) {
+	var buf bytes.Buffer
+	if err := s.download(&buf); err != nil {
+		return nil, err
+	}
+	var records []hintRecord
+	err := scanRecords(&buf, func(e entry, offset, size int64) {
+		records = append(records, hintRecord{key: e.key, offset: offset, size: size, dataType: e.dataType})
+	})
+	return records, err
+}
+
+// coldTombstonesLocked повертає відсортовані ключі з холодних сегментів, яких уже немає в
+// індексі або які видаляє злиття (purged): для них злиття пише надгробки. Викликається під db.mu.
+func (db *Db) coldTombstonesLocked(purged map[string]purgedKey) []string {
+	dead := make(map[string]bool)
+	for _, seg := range db.coldSegments {
+		for _, key := range seg.keys {
+			if dead[key] {
+				continue
+			}
+			_, live := db.currentIndex.get(key)
+			_, series := db.seriesIndex[key]
+			_, expired := purged[key]
+			if !live && !series || expired {
+				dead[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(dead))
+	for key := range dead {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// coldSegmentsLocked повертає копію холодних сегментів для View. Викликається під db.mu.
+func (db *Db) coldSegmentsLocked() map[int]*coldSegment {
+	if len(db.coldSegments) == 0 {
+		return nil
+	}
+	segs := make(map[int]*coldSegment, len(db.coldSegments))
+	for segID, seg := range db.coldSegments {
+		segs[segID] = seg
+	}
+	return segs
+}
+
+// ArchiveColdSegments архівує в холодне сховище найстаріші запечатані сегменти, в які не
+// писали довше за ColdStorage.After, і повертає їх кількість. Чекає на завершення злиття.
+func (db *Db) ArchiveColdSegments(ctx context.Context) (int, error) {
+	if db.coldStore == nil {
+		return 0, ErrColdStorageDisabled
+	}
+	return db.archiveCold(ctx, true)
+}
+
+// archiveColdPeriodically - фонова архівація з періодом ColdStorage.CheckInterval.
+func (db *Db) archiveColdPeriodically(ctx context.Context) error {
+	if db.coldStore == nil || db.opts.ColdStorage.CheckInterval < 0 {
+		return nil
+	}
+	ticker := time.NewTicker(db.opts.ColdStorage.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := db.archiveCold(ctx, false); err != nil && !errors.Is(err, ErrClosed) && !errors.Is(err, context.Canceled) {
+				db.opts.Logger.Errorf("cold storage archival failed: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// coldCandidate - запечатаний сегмент, який можна архівувати.
+type coldCandidate struct {
+	segID int
+	file  *os.File
+	size  int64
+	hints []hintRecord
+}
+
+// archiveCold архівує сегменти під семафором злиття, щоб злиття не замінило їх під час
+// завантаження. Якщо wait false і злиття триває, повертається одразу.
+func (db *Db) archiveCold(ctx context.Context, wait bool) (int, error) {
+	unlock, err := db.lockMerges(ctx, wait)
+	if unlock == nil {
+		return 0, err
+	}
+	defer unlock()
+	db.mu.RLock()
+	candidates := db.coldCandidatesLocked(time.Now())
+	db.mu.RUnlock()
+	for i, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := db.archiveSegment(c); err != nil {
+			return i, err
+		}
+	}
+	return len(candidates), nil
+}
+
+// coldCandidatesLocked повертає найстаріші сегменти, які можна зливати, доки в них не
+// писали довше за ColdStorage.After і їх файли підказок дійсні. Викликається під db.mu.
+func (db *Db) coldCandidatesLocked(now time.Time) []coldCandidate {
+	var candidates []coldCandidate
+	for _, segID := range db.mergeableSegmentIDsLocked() {
+		newest := db.segmentNewestWriteLocked(segID)
+		if newest == 0 || now.Sub(time.Unix(0, newest)) < db.opts.ColdStorage.After {
+			break
+		}
+		file := db.segmentFiles[segID]
+		stat, err := file.Stat()
+		if err != nil {
+			break
+		}
+		hints, err := readHintFile(db.dir, segID, stat.Size())
+		if err != nil {
+			break
+		}
+		candidates = append(candidates, coldCandidate{segID: segID, file: file, size: stat.Size(), hints: hints})
+	}
+	return candidates
+}
+
+// archiveSegment завантажує сегмент у сховище й замінює його файл заглушкою.
+func (db *Db) archiveSegment(c coldCandidate) error {
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(crc, io.NewSectionReader(c.file, 0, c.size)); err != nil {
+		return fmt.Errorf("cold storage: failed to read segment %d: %w", c.segID, err)
+	}
+	name := fmt.Sprintf("%s%s/%s%d-%d", db.opts.ColdStorage.Prefix, db.Generation(), outFileNamePrefix, c.segID, time.Now().UnixNano())
+	if err := db.coldStore.upload(name, c.file, c.size); err != nil {
+		return err
+	}
+	stub := coldStub{Object: name, Size: c.size, Checksum: crc.Sum32(), ArchivedAt: time.Now()}
+	data, err := json.Marshal(stub)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// Заглушка пишеться до видалення файлу: після збою між ними база відкриє локальний файл.
+	if err := fsutil.WriteFileAtomic(coldStubPath(db.dir, c.segID), data, 0644); err != nil {
+		return fmt.Errorf("cold storage: failed to write stub for segment %d: %w", c.segID, err)
+	}
+	seg := db.newColdSegment(stub)
+	seg.keys = coldKeys(c.hints)
+	db.segMu.Lock()
+	db.unmapSegmentLocked(c.segID)
+	delete(db.segmentFiles, c.segID)
+	db.coldSegments[c.segID] = seg
+	path := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, c.segID))
+	if err := db.retireSegmentFileLocked(c.file, path, nil); err != nil {
+		db.opts.Logger.Warnf("failed to remove archived segment %s: %v", path, err)
+	}
+	db.segMu.Unlock()
+	if err := db.manifest.markArchived(c.segID); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+	db.recountDiskLocked()
+	db.opts.Logger.Infof("Cold storage: archived segment %d (%d bytes) as %s", c.segID, c.size, name)
+	return nil
+}
+
+// closeColdSegmentsLocked закриває локальні копії холодних сегментів. Викликається під db.mu та db.segMu.
+func (db *Db) closeColdSegmentsLocked() error {
+	var firstErr error
+	for _, seg := range db.coldSegments {
+		if err := seg.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	db.coldSegments = make(map[int]*coldSegment)
+	return firstErr
+}
@@ -0,0 +1,232 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func coldOptions(endpoint string) Options {
+	opts := testOptions(true)
+	opts.ColdStorage = testColdStorage(endpoint)
+	return opts
+}
+
+// fillColdDb записує ключі key0..key9 так, що вони займають кілька запечатаних сегментів,
+// і архівує ці сегменти.
+func fillColdDb(t *testing.T, db *Db) {
+	t.Helper()
+	padding := strings.Repeat("v", 200)
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("%d %s", i, padding)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := db.ArchiveColdSegments(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no segments were archived")
+	}
+}
+
+func checkColdKeys(t *testing.T, db *Db, deleted string) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		got, err := db.Get(key)
+		if key == deleted {
+			if err != ErrNotFound {
+				t.Errorf("deleted key %s = %.10q, %v", key, got, err)
+			}
+			continue
+		}
+		if err != nil || !strings.HasPrefix(got, fmt.Sprintf("%d ", i)) {
+			t.Errorf("Get(%s) = %.10q, %v", key, got, err)
+		}
+	}
+}
+
+func TestDb_ArchiveColdSegments(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, coldOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillColdDb(t, db)
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ColdSegments == 0 || stats.ColdBytes == 0 {
+		t.Errorf("stats report %d cold segments, %d bytes", stats.ColdSegments, stats.ColdBytes)
+	}
+	segments, _ := db.Segments()
+	for _, seg := range segments {
+		if !seg.Cold {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%s%d", outFileNamePrefix, seg.ID))); !os.IsNotExist(err) {
+			t.Errorf("archived segment %d is still on disk: %v", seg.ID, err)
+		}
+		if _, err := os.Stat(coldStubPath(dir, seg.ID)); err != nil {
+			t.Errorf("archived segment %d has no stub: %v", seg.ID, err)
+		}
+	}
+	if len(fake.objects) != stats.ColdSegments {
+		t.Errorf("bucket has %d objects, want %d", len(fake.objects), stats.ColdSegments)
+	}
+	checkColdKeys(t, db, "")
+	if fake.getCount() == 0 {
+		t.Error("reads of archived keys did not reach cold storage")
+	}
+
+	// Злиття відкидає надгробок key0, ключ якого лежить у холодному сегменті.
+	if err := db.Delete("key0"); err != nil {
+		t.Fatal(err)
+	}
+	padding := strings.Repeat("f", 200)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 4; i++ {
+			if err := db.Put(fmt.Sprintf("filler%d", i), padding); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := db.Verify(context.Background()); err != nil || !report.OK() {
+		t.Errorf("Verify = %+v, %v", report, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, coldOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkColdKeys(t, db, "key0")
+	if got, err := db.Get("filler3"); err != nil || got != padding {
+		t.Errorf("Get(filler3) after reopen = %.10q, %v", got, err)
+	}
+}
+
+func TestDb_ColdStorageCache(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	dir := t.TempDir()
+	opts := coldOptions(srv.URL)
+	opts.ColdStorage.Cache = true
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fillColdDb(t, db)
+	checkColdKeys(t, db, "")
+	gets := fake.getCount()
+	stats, _ := db.Stats()
+	if gets != stats.ColdSegments {
+		t.Errorf("%d requests to cold storage for %d archived segments", gets, stats.ColdSegments)
+	}
+	checkColdKeys(t, db, "")
+	if fake.getCount() != gets {
+		t.Error("cached segments were downloaded again")
+	}
+	cached, _ := os.ReadDir(filepath.Join(dir, coldCacheDirName))
+	if len(cached) != stats.ColdSegments {
+		t.Errorf("cache directory has %d files, want %d", len(cached), stats.ColdSegments)
+	}
+}
+
+func TestDb_ColdReadDoesNotHoldSegMu(t *testing.T) {
+	fake, _ := newFakeS3(t)
+	var blocking atomic.Bool
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && blocking.Load() {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	db, err := NewDbWithOptions(t.TempDir(), coldOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fillColdDb(t, db)
+
+	blocking.Store(true)
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := db.Get("key1")
+		done <- result{value, err}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not reach cold storage")
+	}
+	locked := make(chan struct{})
+	go func() {
+		db.segMu.Lock()
+		db.segMu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("segMu is held while the read waits for cold storage")
+	}
+	close(release)
+	res := <-done
+	if res.err != nil || !strings.HasPrefix(res.value, "1 ") {
+		t.Errorf("Get(key1) = %.10q, %v", res.value, res.err)
+	}
+}
+
+func TestDb_ColdSegmentsRequireColdStorage(t *testing.T) {
+	_, srv := newFakeS3(t)
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, coldOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillColdDb(t, db)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err := NewDbWithOptions(dir, testOptions(true)); err == nil {
+		db.Close()
+		t.Fatal("opened a database with archived segments without cold storage")
+	}
+
+	plain, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if _, err := plain.ArchiveColdSegments(context.Background()); !errors.Is(err, ErrColdStorageDisabled) {
+		t.Errorf("ArchiveColdSegments without cold storage returned %v", err)
+	}
+}
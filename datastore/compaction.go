@@ -0,0 +1,184 @@
+package datastore
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultCompactionMinSegments = 4
+	defaultCompactionDeadRatio   = 0.5
+)
+
+// CompactionState описує запечатані сегменти, за якими політика вирішує, чи потрібне злиття.
+type CompactionState struct {
+	// SegmentCount - кількість запечатаних сегментів.
+	SegmentCount int
+	// TotalBytes - сумарний розмір запечатаних сегментів.
+	TotalBytes int64
+	// LiveBytes - байти живих записів у запечатаних сегментах.
+	LiveBytes int64
+	// MaxFileSize - налаштований розмір сегмента.
+	MaxFileSize int64
+	// ExpiredKeys - кількість ключів, старших за політику зберігання. Такі ключі
+	// видаляються злиттям незалежно від CompactionPolicy.
+	ExpiredKeys int
+	// LegacySegments - кількість сегментів із записами старішого формату, ніж поточний.
+	LegacySegments int
+	// UnencryptedSegments - кількість сегментів, значення яких можуть бути не зашифровані
+	// поточним ключем. Завжди 0, якщо шифрування вимкнене.
+	UnencryptedSegments int
+
+	fragmentedSeries bool
+}
+
+// DeadBytes повертає байти перезаписаних і видалених записів.
+func (s CompactionState) DeadBytes() int64 {
+	if s.TotalBytes < s.LiveBytes {
+		return 0
+	}
+	return s.TotalBytes - s.LiveBytes
+}
+
+// DeadRatio повертає частку мертвих байтів у запечатаних сегментах.
+func (s CompactionState) DeadRatio() float64 {
+	if s.TotalBytes == 0 {
+		return 0
+	}
+	return float64(s.DeadBytes()) / float64(s.TotalBytes)
+}
+
+// reclaimable повідомляє, чи змінить злиття хоч щось. Злиття зберігає порядок записів
+// і заповнює вихідні сегменти до MaxFileSize, тож без мертвих записів воно лише перепише
+// ті самі дані, якщо сегментів і так не більше, ніж потрібно для їх розміщення.
+func (s CompactionState) reclaimable() bool {
+	if s.MaxFileSize <= 0 || s.fragmentedSeries || s.ExpiredKeys > 0 || s.LegacySegments > 0 || s.UnencryptedSegments > 0 || s.DeadBytes() > 0 {
+		return true
+	}
+	needed := (s.TotalBytes + s.MaxFileSize - 1) / s.MaxFileSize
+	return int64(s.SegmentCount) > needed
+}
+
+// CompactionPolicy вирішує, чи запускати фонове злиття. Ручний виклик Compact політику ігнорує.
+type CompactionPolicy interface {
+	ShouldCompact(state CompactionState) bool
+}
+
+// SegmentCountPolicy запускає злиття, коли запечатаних сегментів не менше MinSegments.
+type SegmentCountPolicy struct {
+	MinSegments int
+}
+
+func (p SegmentCountPolicy) ShouldCompact(state CompactionState) bool {
+	return state.SegmentCount >= p.MinSegments
+}
+
+// DeadBytesRatioPolicy запускає злиття, коли частка мертвих байтів досягає MinRatio.
+type DeadBytesRatioPolicy struct {
+	MinRatio float64
+}
+
+func (p DeadBytesRatioPolicy) ShouldCompact(state CompactionState) bool {
+	return state.DeadBytes() > 0 && state.DeadRatio() >= p.MinRatio
+}
+
+// TotalSizePolicy запускає злиття, коли запечатані сегменти займають не менше MaxBytes.
+type TotalSizePolicy struct {
+	MaxBytes int64
+}
+
+func (p TotalSizePolicy) ShouldCompact(state CompactionState) bool {
+	return state.TotalBytes >= p.MaxBytes
+}
+
+// AnyPolicy запускає злиття, якщо його вимагає хоча б одна з політик.
+type AnyPolicy []CompactionPolicy
+
+func (p AnyPolicy) ShouldCompact(state CompactionState) bool {
+	for _, policy := range p {
+		if policy.ShouldCompact(state) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultCompactionPolicy зливає сегменти, коли їх накопичилося чимало
+// або коли половину місця займають мертві записи.
+func DefaultCompactionPolicy() CompactionPolicy {
+	return AnyPolicy{
+		SegmentCountPolicy{MinSegments: defaultCompactionMinSegments},
+		DeadBytesRatioPolicy{MinRatio: defaultCompactionDeadRatio},
+	}
+}
+
+// CompactionReport описує результат злиття, запущеного через Compact.
+type CompactionReport struct {
+	// SegmentsMerged - кількість запечатаних сегментів, що брали участь у злитті.
+	SegmentsMerged int `json:"segmentsMerged"`
+	// SegmentsWritten - кількість сегментів, отриманих після злиття.
+	SegmentsWritten int `json:"segmentsWritten"`
+	// BytesBefore та BytesAfter - розмір злитих сегментів до і після злиття.
+	BytesBefore int64 `json:"bytesBefore"`
+	BytesAfter  int64 `json:"bytesAfter"`
+	// BytesReclaimed - звільнене місце на диску.
+	BytesReclaimed int64 `json:"bytesReclaimed"`
+	// KeysPurged - ключі, видалені політикою зберігання.
+	KeysPurged int64 `json:"keysPurged"`
+	// Duration - тривалість злиття.
+	Duration time.Duration `json:"duration"`
+}
+
+func newCompactionReport(plan *mergePlan, result *mergeResult, purged int64, duration time.Duration) CompactionReport {
+	report := CompactionReport{
+		SegmentsMerged:  len(plan.segmentIDs),
+		SegmentsWritten: len(result.outputs),
+		BytesBefore:     plan.state.TotalBytes,
+		KeysPurged:      purged,
+		Duration:        duration,
+	}
+	for _, out := range result.outputs {
+		report.BytesAfter += out.size
+	}
+	if report.BytesBefore > report.BytesAfter {
+		report.BytesReclaimed = report.BytesBefore - report.BytesAfter
+	}
+	return report
+}
+
+// Compact синхронно зливає неактивні сегменти незалежно від CompactionPolicy, не чекаючи
+// фонового інтервалу. Якщо фонове злиття вже триває, Compact дочікується його завершення
+// і лише потім виконує власне. Якщо зливати нічого, повертає порожній звіт.
+// Скасування ctx перериває злиття до встановлення його результату; тимчасові файли видаляються.
+func (db *Db) Compact(ctx context.Context) (CompactionReport, error) {
+	return db.runMerge(ctx, AuditCompact, nil, true)
+}
+
+// legacyFormatPolicy вимагає злиття, лише поки є сегменти старого формату.
+type legacyFormatPolicy struct{}
+
+func (legacyFormatPolicy) ShouldCompact(state CompactionState) bool {
+	return state.LegacySegments > 0
+}
+
+// MigrateFormat переписує в поточному форматі записів усі запечатані сегменти, якщо серед
+// них є сегменти старішого формату. Міграція виконується звичайним злиттям, тож разом
+// зі старими записами звільняється й мертве місце. Якщо мігрувати нічого, повертає порожній звіт.
+func (db *Db) MigrateFormat(ctx context.Context) (CompactionReport, error) {
+	return db.runMerge(ctx, AuditMigrateFormat, legacyFormatPolicy{}, true)
+}
+
+// unencryptedPolicy вимагає злиття, лише поки є сегменти, не зашифровані поточним ключем.
+type unencryptedPolicy struct{}
+
+func (unencryptedPolicy) ShouldCompact(state CompactionState) bool {
+	return state.UnencryptedSegments > 0
+}
+
+// MigrateEncryption шифрує поточним ключем значення всіх запечатаних сегментів, якщо серед
+// них є сегменти з відкритими значеннями або значеннями, зашифрованими іншими ключами.
+// Як і MigrateFormat, виконується звичайним злиттям, тож база залишається доступною.
+// Якщо шифрування вимкнене або мігрувати нічого, повертає порожній звіт.
+func (db *Db) MigrateEncryption(ctx context.Context) (CompactionReport, error) {
+	return db.runMerge(ctx, AuditMigrateEncryption, unencryptedPolicy{}, true)
+}
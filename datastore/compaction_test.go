@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompactionPolicies(t *testing.T) {
+	state := CompactionState{SegmentCount: 3, TotalBytes: 1000, LiveBytes: 400, MaxFileSize: 500}
+	tests := []struct {
+		name   string
+		policy CompactionPolicy
+		want   bool
+	}{
+		{"segment count reached", SegmentCountPolicy{MinSegments: 3}, true},
+		{"segment count not reached", SegmentCountPolicy{MinSegments: 4}, false},
+		{"dead ratio reached", DeadBytesRatioPolicy{MinRatio: 0.6}, true},
+		{"dead ratio not reached", DeadBytesRatioPolicy{MinRatio: 0.7}, false},
+		{"total size reached", TotalSizePolicy{MaxBytes: 1000}, true},
+		{"total size not reached", TotalSizePolicy{MaxBytes: 1001}, false},
+		{"any of", AnyPolicy{SegmentCountPolicy{MinSegments: 10}, TotalSizePolicy{MaxBytes: 10}}, true},
+		{"none of", AnyPolicy{SegmentCountPolicy{MinSegments: 10}, TotalSizePolicy{MaxBytes: 5000}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.ShouldCompact(state); got != tt.want {
+			t.Errorf("%s: ShouldCompact = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if ratio := state.DeadRatio(); ratio != 0.6 {
+		t.Errorf("DeadRatio = %v, want 0.6", ratio)
+	}
+}
+
+func TestDb_PeriodicMergeFollowsPolicy(t *testing.T) {
+	opts := testOptions(false)
+	opts.MergeInterval = 20 * time.Millisecond
+	opts.CompactionPolicy = SegmentCountPolicy{MinSegments: 1000}
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 60; i++ {
+			if err := db.Put(fmt.Sprintf("policyKey%02d", i), fmt.Sprintf("value%d", round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	time.Sleep(150 * time.Millisecond)
+	if stats, _ := db.Stats(); stats.MergeCount != 0 {
+		t.Fatalf("background merge ran although the policy did not ask for it (%d merges)", stats.MergeCount)
+	}
+
+	report, err := db.Compact(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SegmentsMerged < 2 || report.SegmentsWritten == 0 || report.BytesReclaimed <= 0 ||
+		report.BytesAfter != report.BytesBefore-report.BytesReclaimed || report.Duration <= 0 {
+		t.Errorf("unexpected compaction report %+v", report)
+	}
+	stats, _ := db.Stats()
+	if stats.MergeCount != 1 {
+		t.Fatalf("Compact did not merge: %d merges", stats.MergeCount)
+	}
+	if v, err := db.Get("policyKey07"); err != nil || v != "value2" {
+		t.Errorf("Get after Compact = %q, %v", v, err)
+	}
+}
+
+func TestDb_CompactCancelled(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 60; i++ {
+			if err := db.Put(fmt.Sprintf("cancelKey%02d", i), fmt.Sprintf("value%d", round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Compact(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Compact with cancelled context: %v", err)
+	}
+
+	// Скасування після копіювання не повинно встановити результат злиття.
+	ctx, cancel = context.WithCancel(context.Background())
+	testHookMergeCopied = cancel
+	defer func() { testHookMergeCopied = nil }()
+	if _, err := db.Compact(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Compact cancelled after copy: %v", err)
+	}
+	testHookMergeCopied = nil
+
+	if stats, _ := db.Stats(); stats.MergeCount != 0 {
+		t.Errorf("cancelled Compact installed a merge")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary merge file %s left behind", filepath.Join(dir, entry.Name()))
+		}
+	}
+	if v, err := db.Get("cancelKey07"); err != nil || v != "value2" {
+		t.Errorf("Get after cancelled Compact = %q, %v", v, err)
+	}
+}
+
+func TestDb_MigrateFormat(t *testing.T) {
+	dir := t.TempDir()
+	// Сегменти, записані до появи версій формату: без маніфесту та з записами v1.
+	var legacy []byte
+	for i := 0; i < 10; i++ {
+		legacy = append(legacy, encodeV1(entry{key: fmt.Sprintf("key%d", i), value: fmt.Sprintf("old%d", i), dataType: DataTypeString})...)
+	}
+	legacy = append(legacy, encodeV1(entry{key: "counter", valueInt: 42, dataType: DataTypeInt64})...)
+	if err := os.WriteFile(filepath.Join(dir, outFileNamePrefix+"0"), legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOptions(true)
+	opts.NoMigrate = true
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("key3"); err != nil || v != "old3" {
+		t.Fatalf("Get of v1 entry = %q, %v", v, err)
+	}
+	if err := db.Put("key1", "new1"); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := db.Stats(); stats.LegacySegments != 1 {
+		t.Errorf("LegacySegments = %d before migration, want 1", stats.LegacySegments)
+	}
+
+	report, err := db.MigrateFormat(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SegmentsMerged != 1 {
+		t.Errorf("MigrateFormat merged %d segments, want 1", report.SegmentsMerged)
+	}
+	if stats, _ := db.Stats(); stats.LegacySegments != 0 {
+		t.Errorf("LegacySegments = %d after migration, want 0", stats.LegacySegments)
+	}
+	if report, err := db.MigrateFormat(context.Background()); err != nil || report.SegmentsMerged != 0 {
+		t.Errorf("repeated MigrateFormat = %+v, %v; want an empty report", report, err)
+	}
+	db.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, outFileNamePrefix+"0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		var e entry
+		if _, err := e.DecodeFromReader(reader); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if e.format != entryFormatCurrent {
+			t.Errorf("entry '%s' left in format %d after migration", e.key, e.format)
+		}
+	}
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("key3"); err != nil || v != "old3" {
+		t.Errorf("Get after migration = %q, %v", v, err)
+	}
+	if v, err := db.Get("key1"); err != nil || v != "new1" {
+		t.Errorf("Get of overwritten key after migration = %q, %v", v, err)
+	}
+	if v, err := db.GetInt64("counter"); err != nil || v != 42 {
+		t.Errorf("GetInt64 after migration = %d, %v", v, err)
+	}
+	if stats, _ := db.Stats(); stats.LegacySegments != 0 {
+		t.Errorf("LegacySegments = %d after reopen, want 0", stats.LegacySegments)
+	}
+}
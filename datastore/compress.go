@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression - алгоритм стиснення великих рядкових значень.
+type Compression byte
+
+const (
+	// CompressionNone вимикає стиснення.
+	CompressionNone Compression = 0
+	// CompressionSnappy - швидке стиснення з помірним коефіцієнтом.
+	CompressionSnappy Compression = 1
+	// CompressionZstd стискає краще ціною більших витрат процесора.
+	CompressionZstd Compression = 2
+)
+
+const defaultCompressionThreshold = 4096
+
+// Стиснене значення (тип запису dataTypeCompressed) має вигляд:
+// [версія формату (byte)]             - 1 байт
+// [алгоритм (byte)]                   - 1 байт
+// [тип вихідного значення (byte)]     - 1 байт
+// [довжина до стиснення (uint32)]     - 4 байти
+// [стиснені дані (bytes)]             - змінна довжина
+//
+// Файли, записані без стиснення, не містять таких записів і читаються як раніше.
+const (
+	compressedFormatV1     byte = 1
+	compressedHeaderLength      = 7
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("compression(%d)", byte(c))
+	}
+}
+
+// ParseCompression повертає алгоритм за назвою: none, snappy або zstd.
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CompressionNone, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression %q, expected none, snappy or zstd", name)
+	}
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstdCodecs повертає спільні кодер і декодер; EncodeAll і DecodeAll безпечні для одночасних викликів.
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// compressible повідомляє, чи стискаються значення типу dataType.
+func compressible(dataType byte) bool {
+	return dataType == DataTypeString || dataType == DataTypeBytes || dataType == DataTypeJSON
+}
+
+// compressValue стискає значення і додає заголовок. Повертає false, якщо стиснення
+// не зменшило розмір.
+func compressValue(c Compression, dataType byte, value []byte) ([]byte, bool) {
+	header := make([]byte, compressedHeaderLength, compressedHeaderLength+len(value))
+	header[0] = compressedFormatV1
+	header[1] = byte(c)
+	header[2] = dataType
+	binary.LittleEndian.PutUint32(header[3:], uint32(len(value)))
+	var out []byte
+	switch c {
+	case CompressionSnappy:
+		out = append(header, snappy.Encode(nil, value)...)
+	case CompressionZstd:
+		enc, _ := zstdCodecs()
+		out = enc.EncodeAll(value, header)
+	default:
+		return nil, false
+	}
+	if len(out) >= len(value) {
+		return nil, false
+	}
+	return out, true
+}
+
+// decompressValue розбирає стиснене значення, повертаючи тип і вміст вихідного значення.
+func decompressValue(data []byte) (byte, []byte, error) {
+	if len(data) < compressedHeaderLength {
+		return 0, nil, fmt.Errorf("compressed value too short: %d bytes", len(data))
+	}
+	if data[0] != compressedFormatV1 {
+		return 0, nil, fmt.Errorf("unsupported compressed value format version %d", data[0])
+	}
+	c, dataType := Compression(data[1]), data[2]
+	if !compressible(dataType) && dataType != DataTypeInt64 && dataType != DataTypeSeries {
+		return 0, nil, fmt.Errorf("invalid data type %d in compressed value", dataType)
+	}
+	size := int(binary.LittleEndian.Uint32(data[3:compressedHeaderLength]))
+	payload := data[compressedHeaderLength:]
+	var (
+		raw []byte
+		err error
+	)
+	switch c {
+	case CompressionSnappy:
+		if n, lenErr := snappy.DecodedLen(payload); lenErr != nil || n != size {
+			return 0, nil, fmt.Errorf("corrupted snappy value: expected %d bytes", size)
+		}
+		raw, err = snappy.Decode(make([]byte, size), payload)
+	case CompressionZstd:
+		_, dec := zstdCodecs()
+		raw, err = dec.DecodeAll(payload, make([]byte, 0, size))
+	default:
+		return 0, nil, fmt.Errorf("unknown compression %d", data[1])
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to decompress %s value: %w", c, err)
+	}
+	if len(raw) != size {
+		return 0, nil, fmt.Errorf("decompressed %s value has %d bytes, expected %d", c, len(raw), size)
+	}
+	return dataType, raw, nil
+}
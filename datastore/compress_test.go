@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEntry_EncodeCompressed(t *testing.T) {
+	large := strings.Repeat("compressible value ", 500)
+	for _, c := range []Compression{CompressionSnappy, CompressionZstd} {
+		e := entry{key: "key", value: large, dataType: DataTypeString}
+		encoded := e.EncodeCompressed(c, 1024)
+		if len(encoded) >= len(e.Encode()) {
+			t.Errorf("%s: compressed entry is %d bytes, plain is %d", c, len(encoded), len(e.Encode()))
+		}
+		var decoded entry
+		if err := decoded.Decode(encoded); err != nil {
+			t.Fatalf("%s: decode: %v", c, err)
+		}
+		if decoded.dataType != DataTypeString || decoded.value != large {
+			t.Errorf("%s: round trip changed the value (type %d, %d bytes)", c, decoded.dataType, len(decoded.value))
+		}
+
+		small := entry{key: "key", value: "short", dataType: DataTypeString}
+		if got := small.EncodeCompressed(c, 1024); string(got) != string(small.Encode()) {
+			t.Errorf("%s: value below threshold was compressed", c)
+		}
+	}
+
+	// Невідома версія формату має давати помилку, а не сміття.
+	e := entry{key: "key", value: large, dataType: DataTypeString}
+	encoded := e.EncodeCompressed(CompressionZstd, 0)
+	encoded[entryHeaderSize+4+len("key")+1+4] = 99
+	var decoded entry
+	if err := decoded.Decode(encoded); err == nil {
+		t.Errorf("expected an error for an unknown compressed format version")
+	}
+}
+
+func TestDb_CompressedValues(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(false)
+	opts.Compression = CompressionZstd
+	opts.CompressionThreshold = 100
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := strings.Repeat("0123456789", 1000)
+	if err := db.Put("large", large); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("small", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("large"); err != nil || v != large {
+		t.Fatalf("Get(large): %d bytes, %v", len(v), err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, outFileNamePrefix+"0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= int64(len(large)) {
+		t.Errorf("segment is %d bytes, value was not compressed", info.Size())
+	}
+
+	// Стиснені значення читаються незалежно від налаштувань, з якими відкрито базу.
+	db, err = NewDbWithOptions(dir, testOptions(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("large"); err != nil || v != large {
+		t.Errorf("Get(large) after reopen: %d bytes, %v", len(v), err)
+	}
+	if v, err := db.Get("small"); err != nil || v != "value" {
+		t.Errorf("Get(small) after reopen: %q, %v", v, err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]Compression{"": CompressionNone, "snappy": CompressionSnappy, "ZSTD": CompressionZstd} {
+		if got, err := ParseCompression(name); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %s, %v", name, got, err)
+		}
+	}
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Errorf("expected an error for an unknown compression")
+	}
+}
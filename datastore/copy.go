@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrKeyExists повертається Copy та Rename, якщо цільовий ключ існує, а перезапис не дозволено.
+var ErrKeyExists = errors.New("key already exists")
+
+// CopyOptions налаштовує Copy.
+type CopyOptions struct {
+	// Overwrite дозволяє замінити існуюче значення цільового ключа.
+	Overwrite bool
+	// TTL задає термін дії копії. Нульове значення створює копію без терміну дії.
+	TTL time.Duration
+	// KeepTTL переносить на копію термін дії джерела, якщо TTL не задано.
+	KeepTTL bool
+}
+
+// Copy атомарно копіює значення ключа src у dst. Читання src і запис dst виконуються
+// горутиною запису, тож між ними не може втрутитися інший запис.
+// Часові ряди не копіюються (ErrWrongType).
+func (db *Db) Copy(src, dst string, opts CopyOptions) error {
+	if src == "" || dst == "" {
+		return errors.New("copy: source and destination keys must not be empty")
+	}
+	if src == dst {
+		return errors.New("copy: source and destination keys must differ")
+	}
+	req := putRequest{key: dst, copyFrom: src, overwrite: opts.Overwrite}
+	if opts.TTL > 0 {
+		req.expiresAt = time.Now().Add(opts.TTL).UnixNano()
+	} else {
+		req.keepTTL = opts.KeepTTL
+	}
+	return db.submit(req)
+}
+
+// Rename атомарно перейменовує ключ oldKey на newKey разом з терміном дії: горутина запису
+// записує значення під newKey і надгробок oldKey в одному пакеті, тож інші записи
+// не втручаються між ними, а читання бачать значення хоча б під одним з ключів.
+// Повертає ErrKeyExists, якщо newKey існує. Часові ряди не перейменовуються (ErrWrongType).
+// Якщо процес впаде між скиданням на диск двох записів, після відкриття можуть лишитися
+// обидва ключі, але не жодного.
+func (db *Db) Rename(oldKey, newKey string) error {
+	if oldKey == "" || newKey == "" {
+		return errors.New("rename: source and destination keys must not be empty")
+	}
+	if oldKey == newKey {
+		return errors.New("rename: source and destination keys must differ")
+	}
+	return db.submit(putRequest{key: newKey, copyFrom: oldKey, keepTTL: true, move: true})
+}
+
+// applyCopy виконує копіювання або перейменування під db.mu у горутині запису.
+func (db *Db) applyCopy(req putRequest) error {
+	idxVal, ok, err := db.currentIndex.lookup(req.copyFrom)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, isSeries := db.seriesIndex[req.copyFrom]; isSeries {
+			return ErrWrongType
+		}
+		return ErrNotFound
+	}
+	if !req.overwrite {
+		_, exists, err := db.currentIndex.lookup(req.key)
+		if err != nil {
+			return err
+		}
+		_, isSeries := db.seriesIndex[req.key]
+		if exists || isSeries {
+			return ErrKeyExists
+		}
+	}
+	record, err := db.readRecordLocked(req.copyFrom, idxVal)
+	if err != nil {
+		return err
+	}
+	if req.keepTTL {
+		req.expiresAt = db.expiries[req.copyFrom]
+	}
+	if _, isSeries := db.seriesIndex[req.key]; isSeries {
+		// Інакше старі блоки часового ряду пережили б перезапис ключа.
+		if _, err := db.applyDelete(putRequest{deleteKeys: []string{req.key}}); err != nil {
+			return err
+		}
+	}
+	if err := db.applyPut(putRequest{
+		key:       req.key,
+		value:     record.value,
+		valueInt:  record.valueInt,
+		dataType:  record.dataType,
+		expiresAt: req.expiresAt,
+	}); err != nil || !req.move {
+		return err
+	}
+	_, err = db.applyDelete(putRequest{deleteKeys: []string{req.copyFrom}})
+	return err
+}
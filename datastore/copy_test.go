@@ -0,0 +1,263 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDb_Copy(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("config", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("config", "config_backup", CopyOptions{}); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if v, err := db.Get("config_backup"); err != nil || v != "v1" {
+		t.Errorf("Get(config_backup) = %q, %v", v, err)
+	}
+	if err := db.Copy("counter", "counter_copy", CopyOptions{}); err != nil {
+		t.Fatalf("Copy of int64 failed: %v", err)
+	}
+	if v, err := db.GetInt64("counter_copy"); err != nil || v != 7 {
+		t.Errorf("GetInt64(counter_copy) = %d, %v", v, err)
+	}
+
+	if err := db.Put("config", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("config", "config_backup", CopyOptions{}); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Copy onto existing key without overwrite: got %v, want ErrKeyExists", err)
+	}
+	if err := db.Copy("config", "config_backup", CopyOptions{Overwrite: true}); err != nil {
+		t.Fatalf("Copy with overwrite failed: %v", err)
+	}
+	if v, _ := db.Get("config_backup"); v != "v2" {
+		t.Errorf("expected overwritten copy v2, got %q", v)
+	}
+	if err := db.Copy("missing", "dst", CopyOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Copy of missing key: got %v, want ErrNotFound", err)
+	}
+	if err := db.AppendSeries("metric", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("metric", "metric_copy", CopyOptions{}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Copy of series: got %v, want ErrWrongType", err)
+	}
+}
+
+func TestDb_CopyWithTTL(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("config", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("config", "short", CopyOptions{TTL: 300 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("config", "long", CopyOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.ExpiresAt("short"); !ok {
+		t.Fatalf("expected expiry for copied key")
+	}
+	if _, ok := db.ExpiresAt("config"); ok {
+		t.Errorf("source key must not get an expiry")
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for db.Exists("short") && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if db.Exists("short") {
+		t.Fatalf("key with expired TTL was not deleted")
+	}
+	if v, err := db.Get("long"); err != nil || v != "v1" {
+		t.Errorf("key with long TTL: got %q, %v", v, err)
+	}
+
+	// Звичайний запис знімає термін дії.
+	if err := db.Copy("config", "cleared", CopyOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("cleared", "fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.ExpiresAt("cleared"); ok {
+		t.Errorf("Put must clear the expiry of a key")
+	}
+
+	// KeepTTL переносить термін дії джерела, а джерело без терміну дає копію без нього.
+	if err := db.Copy("long", "renamed", CopyOptions{KeepTTL: true}); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := db.ExpiresAt("long")
+	if got, ok := db.ExpiresAt("renamed"); !ok || !got.Equal(want) {
+		t.Errorf("KeepTTL copy expires at %v, %t; want %v", got, ok, want)
+	}
+	if err := db.Copy("config", "renamed-plain", CopyOptions{KeepTTL: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.ExpiresAt("renamed-plain"); ok {
+		t.Errorf("KeepTTL copy of a key without expiry got one")
+	}
+}
+
+func TestDb_TTLSurvivesMergeAndReopen(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	dir := db.dir
+
+	if err := db.Put("src", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("src", "dst", CopyOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := db.ExpiresAt("dst")
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("filler%03d", i), "some filler value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got, ok := db.ExpiresAt("dst"); !ok || !got.Equal(want) {
+		t.Errorf("after merge: expiry %v (ok=%v), want %v", got, ok, want)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	if got, ok := db.ExpiresAt("dst"); !ok || !got.Equal(want) {
+		t.Errorf("after reopen: expiry %v (ok=%v), want %v", got, ok, want)
+	}
+	if _, ok := db.ExpiresAt("src"); ok {
+		t.Errorf("source key must not have an expiry after reopen")
+	}
+}
+
+func TestDb_Rename(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("old", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rename("old", "new"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := db.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("renamed key still exists: %v", err)
+	}
+	if v, err := db.Get("new"); err != nil || v != "value" {
+		t.Errorf("Get(new) = %q, %v", v, err)
+	}
+
+	if err := db.Put("other", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rename("other", "new"); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Rename onto an existing key returned %v, want ErrKeyExists", err)
+	}
+	if err := db.Rename("missing", "somewhere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rename of a missing key returned %v, want ErrNotFound", err)
+	}
+	if err := db.AppendSeries("metric", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rename("metric", "metric2"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Rename of a series returned %v, want ErrWrongType", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("renamed key is back after reopen: %v", err)
+	}
+	if v, err := db.Get("new"); err != nil || v != "value" {
+		t.Errorf("Get(new) after reopen = %q, %v", v, err)
+	}
+}
+
+func TestDb_RenameKeepsTTLAndRespectsMaxKeys(t *testing.T) {
+	opts := testOptions(true)
+	opts.MaxKeys = 2
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("a", "b", CopyOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := db.ExpiresAt("b")
+	// Обидва місця зайняті, але перейменування не додає ключа.
+	if err := db.Rename("b", "c"); err != nil {
+		t.Fatalf("Rename at the key limit failed: %v", err)
+	}
+	if got, ok := db.ExpiresAt("c"); !ok || !got.Equal(want) {
+		t.Errorf("ExpiresAt(c) = %v, %v, want %v", got, ok, want)
+	}
+}
+
+func TestDb_RenameIsAtomicForReaders(t *testing.T) {
+	opts := testOptions(true)
+	opts.WriteShards = 4
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("token0", "payload"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := db.Rename(fmt.Sprintf("token%d", i), fmt.Sprintf("token%d", i+1)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if v, err := db.Get("token200"); err != nil || v != "payload" {
+				t.Errorf("Get(token200) = %q, %v", v, err)
+			}
+			return
+		default:
+		}
+		if keys := db.Keys(); len(keys) != 1 {
+			t.Fatalf("reader saw keys %v during rename", keys)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidCursor повертається IterateFrom, якщо курсор не було отримано від IterateFrom.
+var ErrInvalidCursor = errors.New("invalid iteration cursor")
+
+// DefaultPageLimit - розмір сторінки IterateFrom, якщо limit не додатний.
+const DefaultPageLimit = 100
+
+// cursorPrefix відрізняє курсори від довільних рядків і дозволить змінити формат пізніше.
+const cursorPrefix = "k1:"
+
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return "", ErrInvalidCursor
+	}
+	return strings.TrimPrefix(string(raw), cursorPrefix), nil
+}
+
+// IterateFrom повертає сторінку з не більше ніж limit пар ключ-значення в лексикографічному
+// (або, якщо reverse, зворотному) порядку ключів, починаючи після курсора, та курсор
+// наступної сторінки. Порожній cursor - початок обходу; порожній наступний курсор означає,
+// що сторінка остання. Курсор запам'ятовує останній ключ, тож обхід коректно продовжується,
+// навіть якщо між сторінками ключі додаються чи видаляються.
+func (db *Db) IterateFrom(cursor string, reverse bool, limit int) ([]KeyValue, string, error) {
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	var after string
+	if cursor != "" {
+		var err error
+		if after, err = decodeCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	// Береться на один ключ більше за сторінку, щоб знати, чи є наступна.
+	var keys []cursorKey
+	var err error
+	if reverse {
+		keys, err = db.keysBeforeLocked(after, cursor != "", limit+1)
+	} else {
+		err = db.ascendKeysLocked(after, func(key string, idxVal indexValue, isValue bool) bool {
+			if cursor != "" && key == after {
+				return true
+			}
+			keys = append(keys, cursorKey{key, idxVal, isValue})
+			return len(keys) <= limit
+		})
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	n := min(limit, len(keys))
+	page := make([]KeyValue, 0, n)
+	for _, k := range keys[:n] {
+		kv, err := db.keyValueLocked(k.key, k.idxVal, k.isValue)
+		if err != nil {
+			return nil, "", err
+		}
+		page = append(page, kv)
+	}
+	var next string
+	if len(keys) > limit {
+		next = encodeCursor(page[n-1].Key)
+	}
+	return page, next, nil
+}
+
+// cursorKey - ключ сторінки IterateFrom, як його передає ascendKeysLocked.
+type cursorKey struct {
+	key     string
+	idxVal  indexValue
+	isValue bool
+}
+
+// keysBeforeLocked повертає до n ключів, менших за before (якщо bounded), у зворотному
+// порядку. З DiskIndex ключі обходяться від початку, але в пам'яті лишаються лише
+// останні n. Викликається під db.mu.
+func (db *Db) keysBeforeLocked(before string, bounded bool, n int) ([]cursorKey, error) {
+	if db.currentIndex.disk == nil {
+		end := len(db.sortedKeys)
+		if bounded {
+			end = sort.SearchStrings(db.sortedKeys, before)
+		}
+		keys := make([]cursorKey, 0, min(n, end))
+		for i := end - 1; i >= 0 && len(keys) < n; i-- {
+			idxVal, ok := db.currentIndex.get(db.sortedKeys[i])
+			keys = append(keys, cursorKey{db.sortedKeys[i], idxVal, ok})
+		}
+		return keys, nil
+	}
+	var window []cursorKey
+	err := db.ascendKeysLocked("", func(key string, idxVal indexValue, isValue bool) bool {
+		if bounded && key >= before {
+			return false
+		}
+		if window = append(window, cursorKey{key, idxVal, isValue}); len(window) > n {
+			window = window[1:]
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(window)
+	return window, nil
+}
@@ -0,0 +1,69 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDb_IterateFrom(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	for i := 0; i < 7; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect := func(reverse bool, limit int, between func()) []string {
+		t.Helper()
+		var keys []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			page, next, err := db.IterateFrom(cursor, reverse, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages > 10 {
+				t.Fatal("iteration does not terminate")
+			}
+			for _, kv := range page {
+				if want := "value" + strings.TrimPrefix(kv.Key, "key"); kv.Value != want {
+					t.Errorf("entry %s = %v, want %s", kv.Key, kv.Value, want)
+				}
+				keys = append(keys, kv.Key)
+			}
+			if next == "" {
+				return keys
+			}
+			if between != nil {
+				between()
+				between = nil
+			}
+			cursor = next
+		}
+	}
+	if got := strings.Join(collect(false, 3, nil), ","); got != "key0,key1,key2,key3,key4,key5,key6" {
+		t.Errorf("forward pages = %s", got)
+	}
+	if got := strings.Join(collect(true, 3, nil), ","); got != "key6,key5,key4,key3,key2,key1,key0" {
+		t.Errorf("reverse pages = %s", got)
+	}
+	// Видалення ключа-курсора між сторінками не зриває обхід.
+	got := collect(false, 2, func() {
+		if err := db.Delete("key1"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if strings.Join(got, ",") != "key0,key1,key2,key3,key4,key5,key6" {
+		t.Errorf("pages with the cursor key deleted = %v", got)
+	}
+
+	if page, next, err := db.IterateFrom("", false, 0); err != nil || len(page) != 6 || next != "" {
+		t.Errorf("default page = %d entries, next %q, %v", len(page), next, err)
+	}
+	if _, _, err := db.IterateFrom("not a cursor", false, 1); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("IterateFrom with a forged cursor returned %v, want ErrInvalidCursor", err)
+	}
+}
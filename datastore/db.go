@@ -2,15 +2,18 @@ package datastore
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,11 +22,17 @@ const (
 	mergeFileNameSuffix = ".merged"
 )
 
+// MaxFileSize - розмір сегмента за замовчуванням для NewDb.
+//
+// Deprecated: використовуйте Options.MaxFileSize разом з NewDbWithOptions.
 var MaxFileSize int64 = 10 * 1024 * 1024
 
 var ErrNotFound = errors.New("record does not exist")
 var ErrWrongType = errors.New("incorrect value type")
 
+// ErrClosed повертається операціями запису після виклику Close.
+var ErrClosed = errors.New("database is closed")
+
 type indexValue struct {
 	segmentID int
 	offset    int64
@@ -32,76 +41,250 @@ type indexValue struct {
 }
 
 type Db struct {
-	dir             string
-	currentIndex    map[string]indexValue
-	activeSegment   *os.File
-	activeSegmentID int
-	segmentFiles    map[int]*os.File
-	mu              sync.RWMutex
-	putCh           chan putRequest
-	doneCh          chan struct{}
-	isMerging       bool
-	mergeMu         sync.Mutex
+	dir          string
+	opts         Options
+	currentIndex *shardedIndex
+	sortedKeys   []string
+	seriesIndex  map[string][]indexValue
+	expiries     map[string]int64
+	// newKeys - нові ключі поточного пакета запису, ще не злиті в sortedKeys, див.
+	// mergeNewKeysLocked.
+	newKeys []string
+	// liveBytes - живі байти значень і часових рядів у кожному сегменті, див. deadspace.go.
+	liveBytes map[int]int64
+	// diskBytes - сумарний розмір сегментів для Options.MaxDiskBytes, див. quota.go.
+	diskBytes int64
+	// lru - порядок використання ключів у режимі кешу; nil, якщо режим вимкнено, див. cache.go.
+	lru          *lruTracker
+	evictions    int64
+	evictMerging atomic.Bool
+	// cancelledWrites - запити, скасовані до виконання, див. cancel.go.
+	cancelledWrites int64
+	// versions - останні версії ключів; nil, якщо Options.KeyVersions вимкнено, див. versions.go.
+	versions *versionHistory
+	// int64Index - значення int64 за порядком; nil, якщо Options.IndexInt64Values вимкнено,
+	// див. int64index.go.
+	int64Index *int64Index
+	// shards - частини запису з власними чергами та активними сегментами, див. writeshard.go.
+	shards []*writeShard
+	// nextSegmentID - ідентифікатор наступного активного сегмента. Змінюється під db.mu.
+	nextSegmentID int
+	// seq - номер останнього запису, див. changes.go. Змінюється горутинами запису під db.mu.
+	seq          uint64
+	segmentFiles map[int]*os.File
+	mmaps        map[int]*mappedSegment
+	// coldSegments - сегменти, архівовані в холодне сховище; coldStore - клієнт сховища
+	// або nil, якщо Options.ColdStorage не задано, див. coldtier.go.
+	coldSegments map[int]*coldSegment
+	coldStore    *s3Client
+	// segMu захищає segmentFiles, coldSegments та mmaps, щоб точкові читання не чекали на db.mu.
+	// Змінюються вони лише під db.mu та segMu одночасно.
+	segMu sync.RWMutex
+	// pinned - файли сегментів, на які посилаються відкриті View, див. view.go.
+	pinMu     sync.Mutex
+	pinned    map[*os.File]*pinnedFile
+	blooms    map[int]*bloomFilter
+	blobs     *blobStore
+	mu        sync.RWMutex
+	putBudget *byteBudget
+	// auditMu впорядковує записи й читання журналу обслуговування, див. audit.go.
+	auditMu sync.Mutex
+	// workers - фонові горутини бази, див. workers.go.
+	workers *workerGroup
+	// abortCh закривається Shutdown після дедлайну: решта запитів у черзі відхиляється.
+	abortCh       chan struct{}
+	abortedPuts   atomic.Int64
+	closeMu       sync.RWMutex
+	closed        bool
+	mergeSem      chan struct{}
+	mergeCount    int64
+	lastMergeTime time.Duration
+	watch         *watchHub
+	manifest      *manifest
+	retention     RetentionReport
+	throttle      mergeThrottle
+	// dirLock - файл блокування директорії бази, див. lock.go.
+	dirLock *os.File
+	// cleanup - що база прибрала під час відкриття, див. cleanup.go.
+	cleanup CleanupReport
+	// keys - ключі шифрування значень; nil, якщо шифрування вимкнене, див. encrypt.go.
+	keys *keyring
+}
+
+// KeyValue описує пару ключ-значення разом з типом значення.
+type KeyValue struct {
+	Key      string
+	Value    interface{}
+	DataType byte
 }
 
 type putRequest struct {
-	key      string
-	value    string
-	valueInt int64
-	dataType byte
-	errCh    chan error
+	key          string
+	value        string
+	valueInt     int64
+	points       []SeriesPoint
+	dataType     byte
+	ifMatch      string
+	expiresAt    int64
+	copyFrom     string
+	overwrite    bool
+	keepTTL      bool
+	move         bool
+	byPrefix     bool
+	deleteKeys   []string
+	onlyExpired  bool
+	deletedCount *int
+	// maxDeleted - найбільша кількість ключів для видалення префікса, 0 - без обмеження.
+	maxDeleted int
+	// encoded - запис, закодований до взяття db.mu, і його час, див. encodePuts.
+	encoded   []byte
+	timestamp int64
+	// flush - бар'єр Flush для частини shard: нічого не пише, див. flush.go.
+	flush bool
+	shard *writeShard
+	// ctx - контекст того, хто чекає на запис; nil - запис не скасовується, див. cancel.go.
+	ctx   context.Context
+	errCh chan error
 }
 
+// NewDb відкриває базу в директорії dir з налаштуваннями за замовчуванням.
 func NewDb(dir string) (*Db, error) {
+	return NewDbWithOptions(dir, DefaultOptions())
+}
+
+// NewDbWithOptions відкриває базу в директорії dir із заданими налаштуваннями.
+func NewDbWithOptions(dir string, opts Options) (*Db, error) {
+	opts = opts.withDefaults()
+	if opts.DiskIndex && (opts.CacheBudgetBytes > 0 || opts.KeyVersions > 0 || opts.IndexInt64Values) {
+		return nil, errors.New("DiskIndex cannot be combined with CacheBudgetBytes, KeyVersions or IndexInt64Values: they keep every key in memory")
+	}
+	opts.Metrics = withLatencyQuantiles(opts.Metrics)
+	keys, err := newKeyring(opts)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create db directory %s: %w", dir, err)
 	}
+	dirLock, stalePID, err := lockDir(dir, opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadManifest(dir)
+	if err == nil {
+		err = m.ensureGeneration()
+	}
+	if err != nil {
+		_ = unlockDir(dirLock)
+		return nil, err
+	}
 	db := &Db{
 		dir:          dir,
-		currentIndex: make(map[string]indexValue),
+		opts:         opts,
+		dirLock:      dirLock,
+		cleanup:      CleanupReport{StaleLockPID: stalePID},
+		keys:         keys,
+		manifest:     m,
+		currentIndex: newShardedIndex(opts.IndexShards),
+		blobs:        newBlobStore(),
+		seriesIndex:  make(map[string][]indexValue),
+		expiries:     make(map[string]int64),
+		liveBytes:    make(map[int]int64),
 		segmentFiles: make(map[int]*os.File),
-		putCh:        make(chan putRequest, 100),
-		doneCh:       make(chan struct{}),
+		mmaps:        make(map[int]*mappedSegment),
+		coldSegments: make(map[int]*coldSegment),
+		blooms:       make(map[int]*bloomFilter),
+		pinned:       make(map[*os.File]*pinnedFile),
+		putBudget:    newByteBudget(opts.PutQueueBytes),
+		workers:      newWorkerGroup(opts.Logger),
+		abortCh:      make(chan struct{}),
+		watch:        newWatchHub(),
+		mergeSem:     make(chan struct{}, 1),
+		throttle: mergeThrottle{
+			pauseAbove:  opts.MergePauseLatency,
+			resumeBelow: opts.MergeResumeLatency,
+		},
+	}
+	for i := 0; i < opts.WriteShards; i++ {
+		db.shards = append(db.shards, newWriteShard(i, opts.PutQueueDepth))
+	}
+	if opts.ColdStorage.enabled() {
+		db.coldStore = newS3Client(opts.ColdStorage)
+	}
+	if opts.DiskIndex {
+		if db.currentIndex.disk, err = newDiskIndex(dir, opts.DiskIndexSparseInterval, opts.Logger); err != nil {
+			_ = unlockDir(dirLock)
+			return nil, err
+		}
 	}
 	if err := db.loadSegmentsAndBuildIndex(); err != nil {
 		for _, f := range db.segmentFiles {
 			_ = f.Close()
 		}
-		if db.activeSegment != nil {
-			_ = db.activeSegment.Close()
+		_ = db.closeColdSegmentsLocked()
+		_ = db.currentIndex.closeDisk()
+		for _, sh := range db.shards {
+			if sh.segment != nil {
+				_ = sh.segment.Close()
+			}
 		}
+		_ = unlockDir(dirLock)
 		return nil, fmt.Errorf("failed to load segments and build index: %w", err)
 	}
-	go db.processPuts()
-	go db.periodicMerge()
+	db.recountLiveLocked()
+	db.recountDiskLocked()
+	if opts.CacheBudgetBytes > 0 {
+		db.rebuildLRULocked()
+	}
+	db.versions = newVersionHistory(opts.KeyVersions)
+	if opts.IndexInt64Values {
+		db.rebuildInt64IndexLocked()
+	}
+	for _, sh := range db.shards {
+		db.workers.Go(fmt.Sprintf("writer-%d", sh.id), func(context.Context) error {
+			return db.processPuts(sh)
+		})
+	}
+	db.workers.Go("merge", db.periodicMerge)
+	db.workers.Go("expiry", db.expireKeys)
+	db.workers.Go("watchdog", db.watchWriter)
+	db.workers.Go("cold-tier", db.archiveColdPeriodically)
+	if !opts.NoMigrate {
+		if err := db.Migrate(); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
 	return db, nil
 }
 
 func (db *Db) loadSegmentsAndBuildIndex() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	files, err := filepath.Glob(filepath.Join(db.dir, outFileNamePrefix+"*"))
+	segmentFilePaths, coldPaths, maxSegID, err := db.cleanupDirLocked()
 	if err != nil {
-		return fmt.Errorf("failed to glob segment files: %w", err)
+		return err
 	}
-	segmentIDs := make([]int, 0, len(files))
-	segmentFilePaths := make(map[int]string)
-	for _, filePath := range files {
-		baseName := filepath.Base(filePath)
-		if strings.HasSuffix(baseName, mergeFileNameSuffix) || strings.HasSuffix(baseName, ".tmp") {
-			_ = os.Remove(filePath)
-			continue
-		}
-		segIDStr := strings.TrimPrefix(baseName, outFileNamePrefix)
-		segID, errConv := strconv.Atoi(segIDStr)
-		if errConv != nil {
-			continue
-		}
+	segmentIDs := make([]int, 0, len(segmentFilePaths))
+	for segID := range segmentFilePaths {
 		segmentIDs = append(segmentIDs, segID)
-		segmentFilePaths[segID] = filePath
 	}
 	sort.Ints(segmentIDs)
-	maxSegID := -1
+	coldIDs := make([]int, 0, len(coldPaths))
+	for segID := range coldPaths {
+		coldIDs = append(coldIDs, segID)
+	}
+	sort.Ints(coldIDs)
+	for _, segID := range coldIDs {
+		// Архівуються лише найстаріші сегменти, тож холодні завантажуються першими.
+		if len(segmentIDs) > 0 && segID > segmentIDs[0] {
+			return fmt.Errorf("cold segment %d is newer than local segment %d", segID, segmentIDs[0])
+		}
+		if err := db.openColdSegmentLocked(segID, coldPaths[segID]); err != nil {
+			return err
+		}
+	}
+	tails := db.tailSegmentsLocked(segmentIDs)
 	for _, segID := range segmentIDs {
 		filePath := segmentFilePaths[segID]
 		file, openErr := os.OpenFile(filePath, os.O_RDONLY, 0644)
@@ -109,406 +292,1358 @@ func (db *Db) loadSegmentsAndBuildIndex() error {
 			return fmt.Errorf("failed to open segment file %s for reading: %w", filePath, openErr)
 		}
 		db.segmentFiles[segID] = file
-		if loadErr := db.loadIndexFromSegmentFile(file, segID); loadErr != nil {
+		if loadErr := db.loadSegmentIndex(file, segID, tails[segID]); loadErr != nil {
 			return fmt.Errorf("failed to load index from segment %d (%s): %w", segID, filePath, loadErr)
 		}
-		if segID > maxSegID {
-			maxSegID = segID
+		db.mapSegmentLocked(segID)
+	}
+	if db.currentIndex.disk != nil {
+		if err := db.resolveDiskIndexLocked(); err != nil {
+			return err
+		}
+		db.currentIndex.disk.removeStale()
+	}
+	db.rebuildSortedKeys()
+	if err := db.restoreSeqLocked(segmentIDs); err != nil {
+		return err
+	}
+	db.watch.seed(db.seq)
+	db.nextSegmentID = maxSegID + 1
+	for _, sh := range db.shards {
+		if err := db.setActiveSegment(sh, db.allocSegmentIDLocked()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailSegmentsLocked повертає сегменти, які могли бути активними при падінні процесу:
+// до WriteShards найновіших локальних сегментів, не запечатаних у маніфесті. Лише в них
+// обірваний останній запис обрізається за будь-якого режиму відкриття. segmentIDs
+// відсортовані за зростанням. Викликається під db.mu.
+func (db *Db) tailSegmentsLocked(segmentIDs []int) map[int]bool {
+	tails := make(map[int]bool)
+	for i := len(segmentIDs) - 1; i >= 0 && i >= len(segmentIDs)-len(db.shards); i-- {
+		if _, sealed := db.manifest.newestWrite(segmentIDs[i]); !sealed {
+			tails[segmentIDs[i]] = true
+		}
+	}
+	return tails
+}
+
+// loadSegmentIndex будує індекс сегмента з файлу підказок, а якщо його немає
+// або він застарів - повним скануванням сегмента з подальшим збереженням підказок.
+// tail - сегмент міг бути активним при падінні, див. tailSegmentsLocked.
+func (db *Db) loadSegmentIndex(file *os.File, segID int, tail bool) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat segment %d (%s): %w", segID, file.Name(), err)
+	}
+	if db.currentIndex.disk != nil {
+		if bf, err := readBloomFile(db.dir, segID); err == nil && db.loadSegmentTableLocked(segID, stat.Size()) {
+			db.blooms[segID] = bf
+			return nil
 		}
 	}
-	db.activeSegmentID = maxSegID + 1
-	if maxSegID == -1 {
-		db.activeSegmentID = 0
+	if records, hintErr := readHintFile(db.dir, segID, stat.Size()); hintErr == nil {
+		db.loadSegmentBloomLocked(segID, records)
+		return db.indexSegmentRecordsLocked(segID, stat.Size(), records)
+	} else if !errors.Is(hintErr, os.ErrNotExist) {
+		db.opts.Logger.Warnf("ignoring hint file for segment %d: %v", segID, hintErr)
+	}
+	records, format, err := db.loadIndexFromSegmentFile(file, segID, tail)
+	if err != nil {
+		return err
+	}
+	if err := db.manifest.setFormat(segID, format); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+	var scannedSize int64
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		scannedSize = last.offset + last.size
+	}
+	if err := writeHintFile(db.dir, segID, scannedSize, records); err != nil {
+		db.opts.Logger.Warnf("%v", err)
 	}
-	return db.setActiveSegment(db.activeSegmentID)
+	db.setSegmentBloomLocked(segID, records)
+	return db.indexSegmentRecordsLocked(segID, scannedSize, records)
 }
 
-func (db *Db) loadIndexFromSegmentFile(file *os.File, segID int) error {
+// loadIndexFromSegmentFile сканує сегмент і повертає записи індексу в порядку їх запису
+// та найстаріший формат серед прочитаних записів. Якщо tail, обірваний запис у кінці
+// сегмента обрізається; будь-яке інше пошкодження обробляється за Options.OpenMode.
+func (db *Db) loadIndexFromSegmentFile(file *os.File, segID int, tail bool) ([]hintRecord, byte, error) {
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek to start of segment %d (%s): %w", segID, file.Name(), err)
+		return nil, 0, fmt.Errorf("failed to seek to start of segment %d (%s): %w", segID, file.Name(), err)
 	}
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat segment %d (%s): %w", segID, file.Name(), err)
+	}
+	size := stat.Size()
 	reader := bufio.NewReader(file)
+	var records []hintRecord
 	var currentOffset int64 = 0
+	format := entryFormatCurrent
+	var seqs segmentSeqs
+	corrupt := false
+scan:
 	for {
 		record := entry{}
-		bytesRead, err := record.DecodeFromReader(reader)
+		bytesRead, err := record.DecodeFromReaderWithin(reader, size-currentOffset)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return fmt.Errorf("error decoding entry from segment %d (%s) at offset %d: %w", segID, file.Name(), currentOffset, err)
+			// З відомим залишком файлу io.ErrUnexpectedEOF означає, що запис сягає кінця файлу.
+			if tail && errors.Is(err, io.ErrUnexpectedEOF) && !recordsFollow(file, currentOffset, size) {
+				return records, format, db.truncateTornTail(file, segID, currentOffset, err)
+			}
+			err = fmt.Errorf("error decoding entry from segment %d (%s) at offset %d: %w", segID, file.Name(), currentOffset, err)
+			switch db.opts.OpenMode {
+			case OpenPermissive:
+				corrupt = true
+				// Запис, розмір якого прочитано, можна перестрибнути.
+				if db.skipCorruptRecord(segID, currentOffset, bytesRead, size-currentOffset, err) {
+					currentOffset += int64(bytesRead)
+					continue
+				}
+				break scan
+			case OpenRepair:
+				return records, format, db.truncateTornTail(file, segID, currentOffset, err)
+			default:
+				return nil, 0, err
+			}
 		}
-		db.currentIndex[record.key] = indexValue{
-			segmentID: segID,
-			offset:    currentOffset,
-			size:      int64(bytesRead),
-			dataType:  record.dataType,
+		records = append(records, hintRecord{
+			key:      record.key,
+			offset:   currentOffset,
+			size:     int64(bytesRead),
+			dataType: record.dataType,
+		})
+		if record.format < format {
+			format = record.format
 		}
+		seqs.add(record)
 		currentOffset += int64(bytesRead)
 	}
+	if _, known := db.manifest.segmentSeqs(segID); corrupt && !known {
+		// Номери записів беруться з прочитаних записів, щоб restoreSeqLocked не
+		// перечитував пошкоджений сегмент.
+		if err := db.manifest.setSeqs(segID, seqs); err != nil {
+			db.opts.Logger.Warnf("%v", err)
+		}
+	}
+	return records, format, nil
+}
+
+// truncateTornTail обрізає сегмент до останнього цілого запису, якщо запис у кінці файлу
+// був обірваний (наприклад, процес впав посеред запису), а з OpenRepair - до першого
+// пошкодженого запису.
+func (db *Db) truncateTornTail(file *os.File, segID int, validSize int64, cause error) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat segment %d (%s) for torn tail recovery: %w", segID, file.Name(), err)
+	}
+	lostBytes := stat.Size() - validSize
+	details := fmt.Sprintf("truncated %d bytes after offset %d (%v)", lostBytes, validSize, cause)
+	if err := os.Truncate(file.Name(), validSize); err != nil {
+		err = fmt.Errorf("failed to truncate torn tail of segment %d (%s) at offset %d: %w", segID, file.Name(), validSize, err)
+		db.Audit(AuditEntry{Op: AuditTruncate, Segments: []int{segID}, Details: details}, err)
+		return err
+	}
+	db.Audit(AuditEntry{Op: AuditTruncate, Segments: []int{segID}, Details: details}, nil)
+	db.opts.Logger.Warnf("recovered torn write in segment %d (%s): truncated %d bytes after offset %d (%v)", segID, file.Name(), lostBytes, validSize, cause)
 	return nil
 }
 
-func (db *Db) setActiveSegment(segID int) error {
-	if db.activeSegment != nil {
-		if err := db.activeSegment.Close(); err != nil {
-			fmt.Printf("Warning: setActiveSegment: failed to close previous active segment %d: %v\n", db.activeSegmentID, err)
+// recordsFollow повідомляє, чи після offset у сегменті розміром size починаються цілі
+// записи, що тягнуться до кінця файлу. Тоді запис на offset не обірваний, а має пошкоджене
+// поле розміру. Якщо файл не читається, запис теж вважається пошкодженим.
+func recordsFollow(file *os.File, offset, size int64) bool {
+	data := make([]byte, size-offset)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return true
+	}
+	for start := 1; start < len(data); start++ {
+		if decodesToEnd(data[start:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodesToEnd повідомляє, чи data складається лише з цілих записів.
+func decodesToEnd(data []byte) bool {
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return false
+		}
+		n := int64(binary.LittleEndian.Uint32(data) &^ entryVersionedFlag)
+		if n <= 4 || n > int64(len(data)) {
+			return false
+		}
+		var e entry
+		if err := e.Decode(data[:n]); err != nil {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// skipCorruptRecord журналює пошкоджений запис сегмента для OpenPermissive і повідомляє,
+// чи можна продовжити читання після нього: так, якщо прочитано весь запис за його розміром.
+// Інакше решта сегмента (remaining байт) ігнорується.
+func (db *Db) skipCorruptRecord(segID int, offset int64, size int, remaining int64, cause error) bool {
+	// DecodeFromReader повертає розмір запису, більший за поле розміру (4 байти), лише
+	// якщо запис прочитано цілком і пошкоджено його вміст.
+	skipped := size > 4
+	details := fmt.Sprintf("skipped %d bytes at offset %d (%v)", size, offset, cause)
+	if !skipped {
+		details = fmt.Sprintf("ignored the remaining %d bytes of the segment after offset %d (%v)", remaining, offset, cause)
+	}
+	db.Audit(AuditEntry{Op: AuditSkipCorrupt, Segments: []int{segID}, Details: details}, nil)
+	db.opts.Logger.Warnf("corrupt record in segment %d: %s", segID, details)
+	return skipped
+}
+
+// setActiveSegment робить segID активним сегментом частини sh, закриваючи попередній.
+// Викликається під db.mu, а після відкриття бази - ще й під sh.syncMu.
+func (db *Db) setActiveSegment(sh *writeShard, segID int) error {
+	db.segMu.Lock()
+	defer db.segMu.Unlock()
+	if sh.segment != nil {
+		if err := sh.segment.Close(); err != nil {
+			db.opts.Logger.Warnf("setActiveSegment: failed to close previous active segment %d: %v", sh.segmentID, err)
 		}
-		db.activeSegment = nil
+		sh.segment = nil
 	}
 	filePath := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID))
 	writeFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return fmt.Errorf("setActiveSegment: failed to open/create segment %d (%s) for writing: %w", segID, filePath, err)
 	}
-	db.activeSegment = writeFile
-	db.activeSegmentID = segID
+	stat, err := writeFile.Stat()
+	if err != nil {
+		_ = writeFile.Close()
+		return fmt.Errorf("setActiveSegment: failed to stat segment %d (%s): %w", segID, filePath, err)
+	}
+	sh.segment = writeFile
+	sh.segmentID = segID
+	sh.deleteSeq = 0
+	sh.unsynced.Store(false)
+	sh.size = stat.Size()
+	sh.pendingMu.Lock()
+	sh.pending = sh.pending[:0]
+	sh.flushed = sh.size
+	sh.pendingMu.Unlock()
 
 	if oldReadFile, exists := db.segmentFiles[segID]; exists {
+		db.unmapSegmentLocked(segID)
 		_ = oldReadFile.Close()
 	}
 	readFile, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
 	if err != nil {
-		_ = db.activeSegment.Close()
-		db.activeSegment = nil
+		_ = sh.segment.Close()
+		sh.segment = nil
 		return fmt.Errorf("setActiveSegment: failed to open segment %d (%s) for reading: %w", segID, filePath, err)
 	}
 	db.segmentFiles[segID] = readFile
 	return nil
 }
 
-func (db *Db) processPuts() {
+// appendToActiveSegment додає дані до записів пакета для активного сегмента частини sh,
+// за потреби ротуючи його. У файл записи пакета потрапляють одним Write після зняття
+// db.mu, див. applyBatch. Повертає ідентифікатор сегмента та зміщення, з якого почався запис.
+// Викликається під db.mu.
+func (db *Db) appendToActiveSegment(sh *writeShard, data []byte) (int, int64, error) {
+	if sh.segment == nil {
+		return 0, 0, errors.New("processPuts: active segment is nil, cannot write")
+	}
+	if sh.size > 0 && sh.size+int64(len(data)) > db.opts.MaxFileSize && db.opts.MaxFileSize > 0 {
+		if err := db.rotateShardLocked(sh); err != nil {
+			return 0, 0, err
+		}
+	}
+	currentOffset := sh.size
+	sh.pendingMu.Lock()
+	sh.pending = append(sh.pending, data...)
+	sh.pendingMu.Unlock()
+	sh.size += int64(len(data))
+	sh.touched = true
+	db.diskBytes += int64(len(data))
+	db.opts.Metrics.Count(MetricBytesWritten, int64(len(data)))
+	return sh.segmentID, currentOffset, nil
+}
+
+func (db *Db) applyPut(req putRequest) error {
+	if req.ifMatch != "" {
+		if err := db.checkETagLocked(req.key, req.ifMatch); err != nil {
+			return err
+		}
+	}
+	// Ключ зберігає або значення, або часовий ряд.
+	_, hasValue, err := db.currentIndex.lookup(req.key)
+	if err != nil {
+		return err
+	}
+	_, isSeries := db.seriesIndex[req.key]
+	if req.dataType == DataTypeSeries && hasValue || req.dataType != DataTypeSeries && isSeries {
+		return ErrWrongType
+	}
+	now := time.Now().UnixNano()
+	if req.encoded != nil {
+		now = req.timestamp
+	}
+	seq := db.seq + 1
+	e, encodedEntry, blobData, err := db.encodePutLocked(req, newPutEntry(req, now, seq))
+	if err != nil {
+		return err
+	}
+	// Спільне значення, термін дії та сам запис пишуться одним блоком, щоб потрапити в один сегмент.
+	data := append(blobData[:len(blobData):len(blobData)], encodedEntry...)
+	if req.expiresAt != 0 {
+		data = append(data, encodeExpiry(req.key, req.expiresAt)...)
+	}
+	sh := db.shardFor(req.key)
+	segID, offset, err := db.appendToActiveSegment(sh, data)
+	if err != nil {
+		return err
+	}
+	db.seq = seq
+	if req.dataType != DataTypeSeries {
+		db.dropValueLiveLocked(req.key)
+	}
+	if blobData != nil {
+		blobIdx := indexValue{segmentID: segID, offset: offset, size: int64(len(blobData)), dataType: dataTypeBlob}
+		db.blobs.setLocation(e.ref, blobIdx)
+		sh.hints = append(sh.hints, hintRecord{key: e.ref.String(), offset: offset, size: blobIdx.size, dataType: dataTypeBlob})
+		offset += blobIdx.size
+	}
+	newIdx := indexValue{
+		segmentID: segID,
+		offset:    offset,
+		size:      int64(len(encodedEntry)),
+		dataType:  req.dataType,
+	}
+	if !hasValue && !isSeries {
+		db.insertSortedKey(req.key)
+	}
+	if req.dataType == DataTypeSeries {
+		db.seriesIndex[req.key] = append(db.seriesIndex[req.key], newIdx)
+	} else {
+		db.currentIndex.set(req.key, newIdx)
+		db.versions.add(req.key, seq, newIdx)
+		if req.dataType == DataTypeInt64 {
+			db.int64Index.set(req.key, req.valueInt)
+		} else {
+			db.int64Index.remove(req.key)
+		}
+		if hashes, _ := e.blobRefs(); hashes != nil {
+			db.blobs.setRefs(req.key, e.dataType, hashes)
+		} else {
+			db.blobs.dropRef(req.key)
+		}
+	}
+	hintType := req.dataType
+	if e.dataType == dataTypeRef || e.dataType == dataTypeChunked {
+		hintType = e.dataType
+	}
+	sh.hints = append(sh.hints, hintRecord{key: req.key, offset: offset, size: int64(len(encodedEntry)), dataType: hintType})
+	db.liveBytes[segID] += newIdx.size
+	if req.expiresAt != 0 {
+		db.liveBytes[segID] += expirySize(req.key, req.expiresAt)
+		expiryOffset := offset + int64(len(encodedEntry))
+		sh.hints = append(sh.hints, hintRecord{key: req.key, offset: expiryOffset, size: int64(len(data) - len(blobData) - len(encodedEntry)), dataType: dataTypeExpiry})
+		db.expiries[req.key] = req.expiresAt
+	} else if req.dataType != DataTypeSeries {
+		delete(db.expiries, req.key)
+	}
+	db.lru.add(req.key)
+	db.watch.notify(req.key, seq)
+	return nil
+}
+
+// newPutEntry повертає запис значення запиту req.
+func newPutEntry(req putRequest, timestamp int64, seq uint64) entry {
+	e := entry{key: req.key, dataType: req.dataType, timestamp: timestamp, seq: seq}
+	switch req.dataType {
+	case DataTypeString, DataTypeBytes, DataTypeJSON:
+		e.value = req.value
+	case DataTypeSeries:
+		e.points = req.points
+	default:
+		e.valueInt = req.valueInt
+	}
+	return e
+}
+
+// encodePutLocked кодує й шифрує запис e, а якщо значення зберігається спільним або
+// частинами, - пише частини й кодує спільне значення. Повертає запис для індексу, його
+// закодований вигляд і закодоване спільне значення. Запис, закодований до взяття db.mu,
+// лише отримує номер. Викликається під db.mu.
+func (db *Db) encodePutLocked(req putRequest, e entry) (entry, []byte, []byte, error) {
+	if req.encoded != nil {
+		setRecordSeq(req.encoded, e.seq)
+		return e, req.encoded, nil, nil
+	}
+	var blobData []byte
+	encodedEntry := e.EncodeCompressed(db.opts.Compression, db.opts.CompressionThreshold)
+	switch {
+	case db.needsChunking(e.dataType, len(encodedEntry)):
+		chunked, err := db.writeChunksLocked(e)
+		if err != nil {
+			return entry{}, nil, nil, err
+		}
+		e, encodedEntry = chunked, chunked.Encode()
+	case db.dedupable(req):
+		seq := e.seq
+		e, blobData = db.dedupEntry(req.key, req.value, e.timestamp)
+		e.seq = seq
+		encodedEntry = e.Encode()
+	}
+	encodedEntry, err := db.seal(encodedEntry)
+	if err != nil {
+		return entry{}, nil, nil, err
+	}
+	if blobData, err = db.seal(blobData); err != nil {
+		return entry{}, nil, nil, err
+	}
+	return e, encodedEntry, blobData, nil
+}
+
+// dedupable повідомляє, чи зберігається значення запиту спільним, див. Options.Dedup.
+func (db *Db) dedupable(req putRequest) bool {
+	return req.dataType == DataTypeString && db.opts.Dedup && len(req.value) >= db.opts.DedupThreshold
+}
+
+// encodePuts кодує, стискає й шифрує записи значень пакета до взяття db.mu, щоб частини
+// запису робили це паралельно. Номер запису видається лише під db.mu, тож він дописується
+// в заголовок пізніше, див. encodePutLocked. Записи, кодування яких залежить від індексу
+// (спільні значення та значення частинами), а також запити, що не вдалося закодувати,
+// кодуються під db.mu, як і раніше.
+func (db *Db) encodePuts(batch []putRequest) {
+	for i := range batch {
+		r := &batch[i]
+		if r.flush || r.copyFrom != "" || r.dataType == dataTypeTombstone || r.dataType == dataTypeRangeTombstone || db.dedupable(*r) {
+			continue
+		}
+		now := time.Now().UnixNano()
+		e := newPutEntry(*r, now, 0)
+		encoded := e.EncodeCompressed(db.opts.Compression, db.opts.CompressionThreshold)
+		if db.needsChunking(e.dataType, len(encoded)) {
+			continue
+		}
+		sealed, err := db.seal(encoded)
+		if err != nil {
+			continue
+		}
+		r.encoded, r.timestamp = sealed, now
+	}
+}
+
+// dropKeyStateLocked прибирає ключ з індексу, крім db.sortedKeys. Викликається під db.mu.
+func (db *Db) dropKeyStateLocked(key string) {
+	db.dropValueLiveLocked(key)
+	for _, idxVal := range db.seriesIndex[key] {
+		db.liveBytes[idxVal.segmentID] -= idxVal.size
+	}
+	db.currentIndex.delete(key)
+	db.blobs.dropRef(key)
+	delete(db.seriesIndex, key)
+	delete(db.expiries, key)
+	db.lru.remove(key)
+	db.versions.remove(key)
+	db.int64Index.remove(key)
+}
+
+// applyDelete записує надгробки для всіх існуючих ключів запиту: ключі однієї частини
+// запису - одним блоком.
+func (db *Db) applyDelete(req putRequest) (int, error) {
+	if req.byPrefix {
+		keys, err := db.keysWithPrefixLocked(req.key)
+		if err != nil {
+			return 0, err
+		}
+		req.deleteKeys = keys
+	}
+	now := time.Now().UnixNano()
+	groups := make(map[*writeShard][]string)
+	var order []*writeShard
+	seen := make(map[string]bool, len(req.deleteKeys))
+	for _, key := range req.deleteKeys {
+		_, exists, err := db.currentIndex.lookup(key)
+		if err != nil {
+			return 0, err
+		}
+		_, isSeries := db.seriesIndex[key]
+		if !exists && !isSeries || seen[key] {
+			continue
+		}
+		if req.onlyExpired {
+			if expiresAt, ok := db.expiries[key]; !ok || expiresAt > now {
+				continue
+			}
+		}
+		seen[key] = true
+		sh := db.shardFor(key)
+		if groups[sh] == nil {
+			order = append(order, sh)
+		}
+		groups[sh] = append(groups[sh], key)
+	}
+	var deleted int
+	for _, sh := range order {
+		if err := db.writeTombstonesLocked(sh, groups[sh], now); err != nil {
+			return deleted, err
+		}
+		deleted += len(groups[sh])
+	}
+	return deleted, nil
+}
+
+// writeTombstonesLocked записує надгробки ключів частини sh одним блоком і прибирає ключі
+// з індексу. Викликається під db.mu.
+func (db *Db) writeTombstonesLocked(sh *writeShard, keys []string, now int64) error {
+	var batch []byte
+	sizes := make([]int64, len(keys))
+	for i, key := range keys {
+		tombstone := entry{key: key, dataType: dataTypeTombstone, timestamp: now, seq: db.seq + uint64(i) + 1}
+		encoded := tombstone.Encode()
+		batch = append(batch, encoded...)
+		sizes[i] = int64(len(encoded))
+	}
+	_, offset, err := db.appendToActiveSegment(sh, batch)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		db.seq++
+		db.removeKeyLocked(key)
+		sh.hints = append(sh.hints, hintRecord{key: key, offset: offset, size: sizes[i], dataType: dataTypeTombstone})
+		db.watch.notifyDelete(key, db.seq)
+		offset += sizes[i]
+	}
+	sh.deleteSeq = db.seq
+	return nil
+}
+
+func (db *Db) removeKeyLocked(key string) {
+	db.mergeNewKeysLocked()
+	db.dropKeyStateLocked(key)
+	i := sort.SearchStrings(db.sortedKeys, key)
+	if i < len(db.sortedKeys) && db.sortedKeys[i] == key {
+		db.sortedKeys = append(db.sortedKeys[:i], db.sortedKeys[i+1:]...)
+	}
+}
+
+// processPuts - горутина запису. Вона не зупиняється зі скасуванням контексту групи, а
+// обробляє чергу, доки Close не закриє її, щоб жоден прийнятий запит не лишився без відповіді.
+func (db *Db) processPuts(sh *writeShard) error {
+	defer close(sh.exit)
+	var syncTick <-chan time.Time
+	if db.opts.SyncPolicy == SyncEveryInterval {
+		ticker := time.NewTicker(db.opts.SyncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
 	for {
 		select {
-		case req := <-db.putCh:
-			db.mu.Lock()
-			e := entry{key: req.key, dataType: req.dataType}
-			if req.dataType == DataTypeString {
-				e.value = req.value
-			} else {
-				e.valueInt = req.valueInt
+		case req, ok := <-sh.putCh:
+			if !ok {
+				return nil
+			}
+			batch := db.collectBatch(sh, req)
+			if db.aborted() {
+				db.abortBatch(batch)
+				continue
 			}
-			encodedEntry := e.Encode()
-			recordSize := int64(len(encodedEntry))
-			var writeErr error
-			var currentOffset int64
-
-			if db.activeSegment == nil {
-				writeErr = errors.New("processPuts: active segment is nil, cannot write")
-			} else {
-				stat, statErr := db.activeSegment.Stat()
-				if statErr != nil {
-					writeErr = fmt.Errorf("processPuts: failed to get active segment stat: %w", statErr)
-				} else {
-					currentOffset = stat.Size()
-					if currentOffset+recordSize > MaxFileSize && MaxFileSize > 0 {
-						if setActiveErr := db.setActiveSegment(db.activeSegmentID + 1); setActiveErr != nil {
-							writeErr = fmt.Errorf("processPuts: failed to rotate to new segment: %w", setActiveErr)
-						} else {
-							newStat, newStatErr := db.activeSegment.Stat()
-							if newStatErr != nil {
-								writeErr = fmt.Errorf("processPuts: failed to get new active segment stat: %w", newStatErr)
-							} else {
-								currentOffset = newStat.Size()
-							}
-						}
-					}
+			sh.watchdog.begin()
+			errs := db.applyBatch(batch)
+			for i, r := range batch {
+				db.putBudget.release(r.size())
+				if r.flush && errs[i] == nil {
+					errs[i] = db.syncShards()
 				}
-				if writeErr == nil {
-					if _, errWrite := db.activeSegment.Write(encodedEntry); errWrite != nil {
-						writeErr = fmt.Errorf("processPuts: failed to write entry to active segment %d: %w", db.activeSegmentID, errWrite)
-					} else {
-						db.currentIndex[req.key] = indexValue{
-							segmentID: db.activeSegmentID,
-							offset:    currentOffset,
-							size:      recordSize,
-							dataType:  req.dataType,
-						}
-					}
+				if r.errCh != nil {
+					r.errCh <- errs[i]
 				}
 			}
-			db.mu.Unlock()
-			if req.errCh != nil {
-				req.errCh <- writeErr
+			db.writerDone(sh)
+		case <-syncTick:
+			sh.watchdog.begin()
+			if syncErr := sh.sync(); syncErr != nil {
+				db.opts.Logger.Warnf("%v", syncErr)
 			}
-		case <-db.doneCh:
-			return
+			db.writerDone(sh)
 		}
 	}
 }
 
-func (db *Db) Put(key string, value string) error {
-	errCh := make(chan error, 1)
-	req := putRequest{
-		key:      key,
-		value:    value,
-		dataType: DataTypeString,
-		errCh:    errCh,
+// applyBatch виконує пакет запитів і повертає результат кожного з них. Записи кодуються
+// до взяття db.mu, а дописуються у файли сегментів і з SyncAlways скидаються на диск уже
+// після його зняття, тож інші частини запису тим часом виконують свої пакети.
+func (db *Db) applyBatch(batch []putRequest) []error {
+	db.encodePuts(batch)
+	errs, touched := db.applyBatchLocked(batch)
+	for _, sh := range touched {
+		if err := sh.flush(); err != nil {
+			// Індекс уже посилається на записи пакета, тож база вважається несправною;
+			// до закриття ці записи читаються з пам'яті.
+			db.workers.fail(fmt.Sprintf("writer-%d", sh.id), err)
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+		}
+	}
+	if db.opts.SyncPolicy != SyncAlways {
+		return errs
+	}
+	for _, sh := range touched {
+		if syncErr := sh.sync(); syncErr != nil {
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = syncErr
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// applyBatchLocked виконує пакет запитів під db.mu і повертає їх результати та частини,
+// в сегменти яких писали. Записи пакета лишаються в pending цих частин.
+func (db *Db) applyBatchLocked(batch []putRequest) ([]error, []*writeShard) {
+	errs := make([]error, len(batch))
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for i, r := range batch {
+		if r.ctx != nil && r.ctx.Err() != nil {
+			errs[i] = r.ctx.Err()
+			db.cancelledWrites++
+			continue
+		}
+		errs[i] = db.applyRequest(r)
+		if errs[i] == nil && !r.flush && r.dataType != dataTypeTombstone && r.dataType != dataTypeRangeTombstone {
+			db.opts.Metrics.Count(MetricPuts, 1)
+		}
+	}
+	db.mergeNewKeysLocked()
+	db.evictLocked()
+	return errs, db.takeTouchedLocked()
+}
+
+// collectBatch забирає з черги запити, що вже очікують, щоб обробити їх разом з first.
+func (db *Db) collectBatch(sh *writeShard, first putRequest) []putRequest {
+	batch := []putRequest{first}
+	for len(batch) < cap(sh.putCh)+1 {
+		select {
+		case req, ok := <-sh.putCh:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, req)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// applyRequest виконує один запит на запис. Викликається під db.mu.
+func (db *Db) applyRequest(req putRequest) error {
+	if req.flush {
+		return nil
+	}
+	if req.dataType != dataTypeTombstone && req.dataType != dataTypeRangeTombstone {
+		if err := db.checkQuotaLocked(req); err != nil {
+			return err
+		}
+	}
+	if req.copyFrom != "" {
+		return db.applyCopy(req)
+	}
+	var deleted int
+	var err error
+	switch req.dataType {
+	case dataTypeTombstone:
+		deleted, err = db.applyDelete(req)
+	case dataTypeRangeTombstone:
+		deleted, err = db.applyDeletePrefix(req)
+	default:
+		return db.applyPut(req)
+	}
+	if req.deletedCount != nil {
+		*req.deletedCount = deleted
 	}
+	return err
+}
+
+func (db *Db) writerDone(sh *writeShard) {
+	if sh.watchdog.end() {
+		db.opts.Logger.Infof("Writer goroutine recovered, accepting writes again")
+	}
+}
+
+// submit передає запит горутині запису та чекає на результат.
+// Після Close нові запити відхиляються з ErrClosed, а поки горутина запису
+// вважається зависшою - з ErrWriteTimeout.
+func (db *Db) submit(req putRequest) error {
+	start := time.Now()
+	pending, err := db.enqueue(req, !db.opts.RejectWhenQueueFull)
+	if err != nil {
+		return err
+	}
+	err = pending.wait()
+	elapsed := time.Since(start)
+	db.opts.Metrics.Observe(OpWrite, elapsed)
+	op := SlowOp{Op: OpWrite, Key: req.key, Elapsed: elapsed}
+	if op.Key == "" && len(req.deleteKeys) == 1 {
+		op.Key = req.deleteKeys[0]
+	}
+	db.reportSlow(op)
+	return err
+}
+
+// pendingPut - запит, переданий горутині запису, результату якого ще не дочекалися.
+type pendingPut struct {
+	errCh   chan error
+	stuckCh <-chan struct{}
+	workers *workerGroup
+}
+
+// wait чекає на результат запиту.
+func (p pendingPut) wait() error {
 	select {
-	case db.putCh <- req:
-		return <-errCh
-	case <-db.doneCh:
-		return errors.New("database is closed")
+	case err := <-p.errCh:
+		return err
+	case <-p.stuckCh:
+		return ErrWriteTimeout
+	case <-p.workers.failed:
+		// Горутина запису могла завершитися, не відповівши на запит.
+		select {
+		case err := <-p.errCh:
+			return err
+		default:
+			return p.workers.Err()
+		}
 	}
 }
 
-func (db *Db) PutInt64(key string, value int64) error {
+// enqueue передає запит горутині запису його частини, не чекаючи на результат. Запити
+// до одного ключа, передані однією горутиною, виконуються в порядку передачі. block -
+// чекати на місце в черзі замість ErrQueueFull.
+func (db *Db) enqueue(req putRequest, block bool) (pendingPut, error) {
+	sh := db.requestShard(req)
+	stuckCh, stuck := sh.watchdog.state()
+	if stuck {
+		return pendingPut{}, ErrWriteTimeout
+	}
+	if err := db.workers.Err(); err != nil {
+		return pendingPut{}, err
+	}
 	errCh := make(chan error, 1)
-	req := putRequest{
-		key:      key,
-		valueInt: value,
-		dataType: DataTypeInt64,
-		errCh:    errCh,
+	req.errCh = errCh
+	ctx := req.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return pendingPut{}, err
+	}
+	size := req.size()
+	if err := db.putBudget.acquire(ctx, size, block); err != nil {
+		return pendingPut{}, err
+	}
+	db.closeMu.RLock()
+	if db.closed {
+		db.closeMu.RUnlock()
+		db.putBudget.release(size)
+		return pendingPut{}, ErrClosed
 	}
 	select {
-	case db.putCh <- req:
-		return <-errCh
-	case <-db.doneCh:
-		return errors.New("database is closed")
+	case sh.putCh <- req:
+	case <-stuckCh:
+		db.closeMu.RUnlock()
+		db.putBudget.release(size)
+		return pendingPut{}, ErrWriteTimeout
+	case <-db.workers.failed:
+		db.closeMu.RUnlock()
+		db.putBudget.release(size)
+		return pendingPut{}, db.workers.Err()
+	case <-ctx.Done():
+		db.closeMu.RUnlock()
+		db.putBudget.release(size)
+		return pendingPut{}, ctx.Err()
 	}
+	db.closeMu.RUnlock()
+	return pendingPut{errCh: errCh, stuckCh: stuckCh, workers: db.workers}, nil
 }
 
+func (db *Db) Put(key string, value string) error {
+	return db.PutContext(context.Background(), key, value)
+}
+
+func (db *Db) PutInt64(key string, value int64) error {
+	return db.PutInt64Context(context.Background(), key, value)
+}
+
+// Delete видаляє ключ, записуючи для нього надгробок. Повертає ErrNotFound, якщо ключа немає.
+func (db *Db) Delete(key string) error {
+	return db.DeleteContext(context.Background(), key)
+}
+
+// DeleteKeys видаляє набір ключів одним пакетним записом надгробків
+// та повертає кількість фактично видалених ключів.
+func (db *Db) DeleteKeys(keys []string) (int, error) {
+	return db.deleteKeys(context.Background(), keys)
+}
+
+func (db *Db) deleteKeys(ctx context.Context, keys []string) (int, error) {
+	var deleted int
+	if err := db.submit(putRequest{dataType: dataTypeTombstone, deleteKeys: keys, deletedCount: &deleted, ctx: ctx}); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Get повертає рядкове значення ключа. Точкові читання не чекають на горутину запису:
+// вони утримують лише db.segMu та замок частини індексу.
 func (db *Db) Get(key string) (string, error) {
-	db.mu.RLock()
-	idxVal, ok := db.currentIndex[key]
+	defer db.observeRead(time.Now(), key)
+	return db.getString(key)
+}
+
+func (db *Db) getString(key string) (string, error) {
+	db.segMu.RLock()
+	idxVal, ok, err := db.lookupForRead(key)
+	if err != nil {
+		db.segMu.RUnlock()
+		return "", err
+	}
 	if !ok {
-		db.mu.RUnlock()
+		db.segMu.RUnlock()
 		return "", ErrNotFound
 	}
-	segmentFile, fileOk := db.segmentFiles[idxVal.segmentID]
+	segmentFile, fileOk := db.segmentReaderLocked(idxVal.segmentID)
 	if !fileOk {
-		db.mu.RUnlock()
-		return "", fmt.Errorf("internal error: segment file %d for key '%s' not found in map (possibly stale or merged)", idxVal.segmentID, key)
+		db.segMu.RUnlock()
+		// Індекс посилається на відсутній сегмент, див. readrepair.go.
+		if err := db.repairIndexEntry(key, idxVal); err != nil {
+			return "", err
+		}
+		return db.getString(key)
 	}
 	if idxVal.dataType != DataTypeString {
-		db.mu.RUnlock()
+		db.segMu.RUnlock()
 		return "", ErrWrongType
 	}
-	recordBytes := make([]byte, idxVal.size)
-	_, err := segmentFile.ReadAt(recordBytes, idxVal.offset)
-	db.mu.RUnlock()
-	if err != nil {
-		return "", fmt.Errorf("failed to read entry for key '%s' from segment %d: %w", key, idxVal.segmentID, err)
+	record, err := db.readAndUnlock(key, segmentFile, idxVal)
+	if errors.Is(err, errStaleRead) {
+		return db.getString(key)
 	}
-	record := entry{}
-	if errDecode := record.Decode(recordBytes); errDecode != nil {
-		return "", fmt.Errorf("failed to decode entry for key '%s': %w", key, errDecode)
+	if err != nil {
+		return "", err
 	}
 	return record.value, nil
 }
 
 func (db *Db) GetInt64(key string) (int64, error) {
-	db.mu.RLock()
-	idxVal, ok := db.currentIndex[key]
+	defer db.observeRead(time.Now(), key)
+	return db.getInt64(key)
+}
+
+func (db *Db) getInt64(key string) (int64, error) {
+	db.segMu.RLock()
+	idxVal, ok, err := db.lookupForRead(key)
+	if err != nil {
+		db.segMu.RUnlock()
+		return 0, err
+	}
 	if !ok {
-		db.mu.RUnlock()
+		db.segMu.RUnlock()
 		return 0, ErrNotFound
 	}
-	segmentFile, fileOk := db.segmentFiles[idxVal.segmentID]
+	segmentFile, fileOk := db.segmentReaderLocked(idxVal.segmentID)
 	if !fileOk {
-		db.mu.RUnlock()
-		return 0, fmt.Errorf("internal error: segment file %d for key '%s' not found in map (possibly stale or merged)", idxVal.segmentID, key)
+		db.segMu.RUnlock()
+		if err := db.repairIndexEntry(key, idxVal); err != nil {
+			return 0, err
+		}
+		return db.getInt64(key)
 	}
 	if idxVal.dataType != DataTypeInt64 {
-		db.mu.RUnlock()
+		db.segMu.RUnlock()
 		return 0, ErrWrongType
 	}
-	recordBytes := make([]byte, idxVal.size)
-	_, err := segmentFile.ReadAt(recordBytes, idxVal.offset)
-	db.mu.RUnlock()
+	record, err := db.readAndUnlock(key, segmentFile, idxVal)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read entry for key '%s' from segment %d: %w", key, idxVal.segmentID, err)
-	}
-	record := entry{}
-	if errDecode := record.Decode(recordBytes); errDecode != nil {
-		return 0, fmt.Errorf("failed to decode entry for key '%s': %w", key, errDecode)
+		return 0, err
 	}
 	return record.valueInt, nil
 }
 
-func (db *Db) Close() error {
-	select {
-	case <-db.doneCh:
-	default:
-		close(db.doneCh)
+// rebuildSortedKeys будує список ключів значень і часових рядів. Сегменти, записані до
+// заборони ключів обох видів, можуть містити обидва для одного ключа; такий ключ
+// потрапляє в список один раз. З DiskIndex списку немає: ключі перелічує ascendKeysLocked.
+func (db *Db) rebuildSortedKeys() {
+	if db.currentIndex.disk != nil {
+		db.sortedKeys = nil
+		return
 	}
-	time.Sleep(50 * time.Millisecond)
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	var firstErr error
-	if db.activeSegment != nil {
-		if err := db.activeSegment.Close(); err != nil {
-			if firstErr == nil {
-				firstErr = err
-			}
+	db.sortedKeys = make([]string, 0, db.currentIndex.len()+len(db.seriesIndex))
+	_ = db.currentIndex.forEach(func(key string, _ indexValue) {
+		db.sortedKeys = append(db.sortedKeys, key)
+	})
+	for key := range db.seriesIndex {
+		if _, ok := db.currentIndex.get(key); !ok {
+			db.sortedKeys = append(db.sortedKeys, key)
 		}
-		db.activeSegment = nil
 	}
-	for _, file := range db.segmentFiles {
-		if err := file.Close(); err != nil {
-			if firstErr == nil {
-				firstErr = err
-			}
-		}
+	sort.Strings(db.sortedKeys)
+}
+
+// insertSortedKey відкладає новий ключ до кінця пакета запису: вставка кожного ключа в
+// db.sortedKeys коштувала б O(n), тож нові ключі пакета зливаються разом.
+// Викликається під db.mu.
+func (db *Db) insertSortedKey(key string) {
+	if db.currentIndex.disk != nil {
+		return
 	}
-	db.segmentFiles = make(map[int]*os.File)
-	return firstErr
+	db.newKeys = append(db.newKeys, key)
 }
 
-func (db *Db) periodicMerge() {
-	mergeInterval := 10 * time.Second
-	if os.Getenv("TEST_MERGE_INTERVAL_MS") != "" {
-		if ms, err := strconv.Atoi(os.Getenv("TEST_MERGE_INTERVAL_MS")); err == nil && ms > 0 {
-			mergeInterval = time.Duration(ms) * time.Millisecond
-		}
+// mergeNewKeysLocked зливає відкладені нові ключі в db.sortedKeys за O(n + k log k).
+// Викликається під db.mu до кожного читання db.sortedKeys у шляху запису й наприкінці
+// пакета, тож читання під RLock бачать повний список.
+func (db *Db) mergeNewKeysLocked() {
+	if len(db.newKeys) == 0 {
+		return
 	}
-	ticker := time.NewTicker(mergeInterval)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			if err := db.tryMergeSegments(); err != nil {
-				fmt.Printf("Error during periodic merge: %v\n", err)
-			}
-		case <-db.doneCh:
-			return
+	sort.Strings(db.newKeys)
+	merged := make([]string, 0, len(db.sortedKeys)+len(db.newKeys))
+	i, j := 0, 0
+	for i < len(db.sortedKeys) || j < len(db.newKeys) {
+		var key string
+		if j == len(db.newKeys) || (i < len(db.sortedKeys) && db.sortedKeys[i] <= db.newKeys[j]) {
+			key = db.sortedKeys[i]
+			i++
+		} else {
+			key = db.newKeys[j]
+			j++
+		}
+		if n := len(merged); n > 0 && merged[n-1] == key {
+			continue
 		}
+		merged = append(merged, key)
 	}
+	db.sortedKeys = merged
+	db.newKeys = db.newKeys[:0]
 }
 
-func (db *Db) tryMergeSegments() error {
-	db.mergeMu.Lock()
-	if db.isMerging {
-		db.mergeMu.Unlock()
+// ascendKeysLocked викликає fn для ключів значень і часових рядів, не менших за from,
+// у порядку зростання, доки fn повертає true. isValue повідомляє, що ключ має значення
+// з розташуванням idxVal, інакше це часовий ряд. Без DiskIndex ключі беруться з
+// db.sortedKeys, з ним - зі злиття індексу з відсортованими ключами рядів.
+// Викликається під db.mu.
+func (db *Db) ascendKeysLocked(from string, fn func(key string, idxVal indexValue, isValue bool) bool) error {
+	if db.currentIndex.disk == nil {
+		for _, key := range db.sortedKeys[sort.SearchStrings(db.sortedKeys, from):] {
+			idxVal, ok := db.currentIndex.get(key)
+			if !fn(key, idxVal, ok) {
+				break
+			}
+		}
 		return nil
 	}
-	db.isMerging = true
-	db.mergeMu.Unlock()
-	defer func() {
-		db.mergeMu.Lock()
-		db.isMerging = false
-		db.mergeMu.Unlock()
-	}()
-	return db.performMerge()
+	var series []string
+	for key := range db.seriesIndex {
+		if key >= from {
+			series = append(series, key)
+		}
+	}
+	sort.Strings(series)
+	stopped := false
+	err := db.currentIndex.ascend(from, func(key string, idxVal indexValue) bool {
+		for ; len(series) > 0 && series[0] <= key; series = series[1:] {
+			// Ключ, що має і значення, і ряд, потрапляє в обхід один раз, як значення.
+			if series[0] != key && !fn(series[0], indexValue{}, false) {
+				stopped = true
+				return false
+			}
+		}
+		if !fn(key, idxVal, true) {
+			stopped = true
+		}
+		return !stopped
+	})
+	if err != nil || stopped {
+		return err
+	}
+	for _, key := range series {
+		if !fn(key, indexValue{}, false) {
+			break
+		}
+	}
+	return nil
 }
 
-func (db *Db) performMerge() error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// prefixRange повертає межі діапазону ключів з заданим префіксом у db.sortedKeys.
+// Ключі з префіксом ідуть підряд, тож обидві межі знаходяться двійковим пошуком.
+func (db *Db) prefixRange(prefix string) (int, int) {
+	start := sort.SearchStrings(db.sortedKeys, prefix)
+	rest := db.sortedKeys[start:]
+	end := start + sort.Search(len(rest), func(i int) bool {
+		return !strings.HasPrefix(rest[i], prefix)
+	})
+	return start, end
+}
 
-	segmentsToMergeIDs := make([]int, 0)
-	for segID := range db.segmentFiles {
-		if segID != db.activeSegmentID {
-			segmentsToMergeIDs = append(segmentsToMergeIDs, segID)
-		}
+// readRecordLocked читає запис з диску. Викликається під db.mu або db.segMu.
+func (db *Db) readRecordLocked(key string, idxVal indexValue) (entry, error) {
+	segmentFile, ok := db.segmentReaderLocked(idxVal.segmentID)
+	if !ok {
+		return entry{}, fmt.Errorf("internal error: segment file %d for key '%s' not found in map (possibly stale or merged)", idxVal.segmentID, key)
+	}
+	record, err := readRecordFrom(segmentFile, db.keys, key, idxVal)
+	if err != nil {
+		return record, err
 	}
-	sort.Ints(segmentsToMergeIDs)
+	return db.resolveRefLocked(record)
+}
 
-	if len(segmentsToMergeIDs) < 2 {
-		return nil
+// readRecordFrom читає та декодує запис, розташований за idxVal у segmentFile,
+// розшифровуючи значення ключами keys.
+func readRecordFrom(segmentFile io.ReaderAt, keys *keyring, key string, idxVal indexValue) (entry, error) {
+	record := entry{}
+	recordBytes := make([]byte, idxVal.size)
+	if _, err := segmentFile.ReadAt(recordBytes, idxVal.offset); err != nil {
+		return record, fmt.Errorf("failed to read entry for key '%s' from segment %d: %w", key, idxVal.segmentID, err)
+	}
+	if err := record.Decode(recordBytes); err != nil {
+		return record, fmt.Errorf("failed to decode entry for key '%s': %w", key, err)
+	}
+	if err := keys.unseal(&record); err != nil {
+		return record, err
 	}
+	return record, nil
+}
+
+// Exists повідомляє, чи є ключ у базі, не читаючи значення з диску.
+func (db *Db) Exists(key string) bool {
+	_, err := db.TypeOf(key)
+	return err == nil
+}
 
-	targetMergeSegmentID := segmentsToMergeIDs[0]
-	mergedFilePathTemp := filepath.Join(db.dir, fmt.Sprintf("%s%d%s.tmp", outFileNamePrefix, targetMergeSegmentID, mergeFileNameSuffix))
-	mergedFile, err := os.OpenFile(mergedFilePathTemp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// TypeOf повертає тип збереженого значення ключа без читання самого значення.
+// Повертає ErrNotFound, якщо ключа немає.
+func (db *Db) TypeOf(key string) (byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idxVal, ok, err := db.currentIndex.lookup(key)
 	if err != nil {
-		return fmt.Errorf("merge: failed to create temp merged file '%s': %w", mergedFilePathTemp, err)
+		return 0, err
+	}
+	if ok {
+		return idxVal.dataType, nil
 	}
+	if _, ok := db.seriesIndex[key]; ok {
+		return DataTypeSeries, nil
+	}
+	return 0, ErrNotFound
+}
 
-	newIndexForMergedSegment := make(map[string]indexValue)
-	var currentMergedOffset int64 = 0
+// Keys повертає відсортований список усіх ключів, що зберігаються в базі, включно з
+// часовими рядами.
+func (db *Db) Keys() []string {
+	return db.Range("", "", 0)
+}
 
-	for key, idxVal := range db.currentIndex {
-		isMerging := false
-		for _, mergingID := range segmentsToMergeIDs {
-			if idxVal.segmentID == mergingID {
-				isMerging = true
-				break
-			}
-		}
-		if !isMerging {
-			continue
+// Iterate викликає fn для кожного ключа в лексикографічному порядку разом з типом його значення.
+// Ітерація зупиняється, якщо fn повертає false. Обхід виконується по знімку індексу,
+// тому fn може безпечно викликати інші методи Db.
+func (db *Db) Iterate(fn func(key string, dataType byte) bool) {
+	db.mu.RLock()
+	var keys []string
+	var types []byte
+	err := db.ascendKeysLocked("", func(key string, idxVal indexValue, isValue bool) bool {
+		keys = append(keys, key)
+		types = append(types, typeOf(idxVal, isValue))
+		return true
+	})
+	db.mu.RUnlock()
+	if err != nil {
+		db.opts.Logger.Errorf("iterate: %v", err)
+	}
+	for i, key := range keys {
+		if !fn(key, types[i]) {
+			return
 		}
-		sourceSegmentFile, ok := db.segmentFiles[idxVal.segmentID]
-		if !ok {
-			_ = mergedFile.Close()
-			_ = os.Remove(mergedFilePathTemp)
-			return fmt.Errorf("merge: source segment %d for key '%s' not found in map", idxVal.segmentID, key)
+	}
+}
+
+// KeysWithPrefix повертає відсортований список ключів, що починаються з prefix.
+func (db *Db) KeysWithPrefix(prefix string) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keys, err := db.keysWithPrefixLocked(prefix)
+	if err != nil {
+		db.opts.Logger.Errorf("keys with prefix: %v", err)
+	}
+	return keys
+}
+
+// Range повертає до limit ключів з проміжку [startKey, endKey) у лексикографічному порядку.
+// Порожній endKey означає проміжок до останнього ключа, limit <= 0 - без обмеження.
+// Для обходу сторінками наступну сторінку запитують з останнього отриманого ключа + "\x00".
+func (db *Db) Range(startKey, endKey string, limit int) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keys := []string{}
+	err := db.ascendKeysLocked(startKey, func(key string, _ indexValue, _ bool) bool {
+		if endKey != "" && key >= endKey || limit > 0 && len(keys) == limit {
+			return false
 		}
-		entryData := make([]byte, idxVal.size)
-		if _, readErr := sourceSegmentFile.ReadAt(entryData, idxVal.offset); readErr != nil {
-			_ = mergedFile.Close()
-			_ = os.Remove(mergedFilePathTemp)
-			return fmt.Errorf("merge: failed to read entry for key '%s' from segment %d: %w", key, idxVal.segmentID, readErr)
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		db.opts.Logger.Errorf("range: %v", err)
+	}
+	return keys
+}
+
+// GetByPrefix повертає всі пари ключ-значення, ключі яких починаються з prefix,
+// у лексикографічному порядку ключів. Усі значення читаються з одного знімку індексу.
+func (db *Db) GetByPrefix(prefix string) ([]KeyValue, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	result := []KeyValue{}
+	var readErr error
+	err := db.ascendKeysLocked(prefix, func(key string, idxVal indexValue, isValue bool) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
 		}
-		if _, writeErr := mergedFile.Write(entryData); writeErr != nil {
-			_ = mergedFile.Close()
-			_ = os.Remove(mergedFilePathTemp)
-			return fmt.Errorf("merge: failed to write entry for key '%s' to merged file: %w", key, writeErr)
+		kv, err := db.keyValueLocked(key, idxVal, isValue)
+		if err != nil {
+			readErr = err
+			return false
 		}
-		newIndexForMergedSegment[key] = indexValue{
-			segmentID: targetMergeSegmentID,
-			offset:    currentMergedOffset,
-			size:      idxVal.size,
-			dataType:  idxVal.dataType,
+		result = append(result, kv)
+		return true
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// typeOf повертає тип ключа, переданого ascendKeysLocked.
+func typeOf(idxVal indexValue, isValue bool) byte {
+	if isValue {
+		return idxVal.dataType
+	}
+	return DataTypeSeries
+}
+
+// keyValueLocked читає значення ключа, переданого ascendKeysLocked; для часового ряду -
+// усі його точки. Викликається під db.mu.
+func (db *Db) keyValueLocked(key string, idxVal indexValue, isValue bool) (KeyValue, error) {
+	if isValue {
+		record, err := db.readRecordLocked(key, idxVal)
+		if err != nil {
+			return KeyValue{}, err
 		}
-		currentMergedOffset += idxVal.size
+		return record.keyValue(), nil
+	}
+	points, err := db.seriesPointsLocked(key, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return KeyValue{}, err
+	}
+	return KeyValue{Key: key, Value: points, DataType: DataTypeSeries}, nil
+}
+
+// Close відхиляє нові записи, дочікується обробки вже прийнятих, скидає активний сегмент
+// на диск і закриває файли. Повторний виклик нічого не робить.
+func (db *Db) Close() error {
+	if !db.stopAccepting() {
+		return nil
 	}
+	return db.closeFiles()
+}
 
-	if syncErr := mergedFile.Sync(); syncErr != nil {
-		_ = mergedFile.Close()
-		_ = os.Remove(mergedFilePathTemp)
-		return fmt.Errorf("merge: failed to sync temp merged file: %w", syncErr)
+// stopAccepting відхиляє нові записи та зупиняє фонові горутини; запити, що вже
+// в черзі, горутина запису ще обробить. Повертає false, якщо базу вже закрито.
+func (db *Db) stopAccepting() bool {
+	db.closeMu.Lock()
+	defer db.closeMu.Unlock()
+	if db.closed {
+		return false
 	}
-	if closeErr := mergedFile.Close(); closeErr != nil {
-		_ = os.Remove(mergedFilePathTemp)
-		return fmt.Errorf("merge: failed to close temp merged file: %w", closeErr)
+	db.closed = true
+	db.putBudget.close()
+	for _, sh := range db.shards {
+		close(sh.putCh)
 	}
+	db.workers.stop()
+	return true
+}
 
-	finalMergedFilePath := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, targetMergeSegmentID))
+// closeFiles чекає на завершення фонових горутин і закриває файли сегментів.
+func (db *Db) closeFiles() error {
+	// Фатальну помилку фонової горутини повертає Db.Err; закриття файлів вона не скасовує.
+	_ = db.workers.Wait()
 
-	if oldTargetFile, ok := db.segmentFiles[targetMergeSegmentID]; ok {
-		if errClose := oldTargetFile.Close(); errClose != nil {
-			fmt.Printf("Warning: merge: error closing old target file handle %s: %v\n", oldTargetFile.Name(), errClose)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var firstErr error
+	for _, sh := range db.shards {
+		if sh.segment == nil {
+			continue
+		}
+		if err := sh.segment.Sync(); err != nil && firstErr == nil {
+			firstErr = err
 		}
+		if err := sh.segment.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		sh.segment = nil
 	}
-	// Видаляємо старий цільовий файл перед перейменуванням, щоб уникнути проблем на Windows
-	if errRemoveOld := os.Remove(finalMergedFilePath); errRemoveOld != nil && !os.IsNotExist(errRemoveOld) {
-		_ = os.Remove(mergedFilePathTemp)
-		return fmt.Errorf("merge: failed to remove old target file '%s' before rename: %w", finalMergedFilePath, errRemoveOld)
+	db.segMu.Lock()
+	defer db.segMu.Unlock()
+	for segID, file := range db.segmentFiles {
+		db.unmapSegmentLocked(segID)
+		if err := file.Close(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	db.segmentFiles = make(map[int]*os.File)
+	if err := db.closeColdSegmentsLocked(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := db.currentIndex.closeDisk(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	db.releasePinnedLocked()
+	if err := clearLockOwner(db.dirLock); err != nil && firstErr == nil {
+		firstErr = err
 	}
+	if err := unlockDir(db.dirLock); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	db.dirLock = nil
+	return firstErr
+}
 
-	if renameErr := os.Rename(mergedFilePathTemp, finalMergedFilePath); renameErr != nil {
-		_ = os.Remove(mergedFilePathTemp)
-		return fmt.Errorf("merge: failed to rename temp merged file '%s' to '%s': %w", mergedFilePathTemp, finalMergedFilePath, renameErr)
+func (db *Db) periodicMerge(ctx context.Context) error {
+	if db.opts.MergeInterval < 0 {
+		return nil
+	}
+	ticker := time.NewTicker(db.opts.MergeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !db.mergeAllowed() {
+				continue
+			}
+			if _, err := db.runMerge(context.Background(), AuditMerge, db.opts.CompactionPolicy, false); err != nil && !errors.Is(err, ErrClosed) {
+				db.opts.Logger.Errorf("periodic merge failed: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
 	}
+}
 
-	mergedSegmentReadOnly, openErr := os.OpenFile(finalMergedFilePath, os.O_RDONLY, 0644)
-	if openErr != nil {
-		return fmt.Errorf("merge: CRITICAL: failed to open final merged segment '%s' for reading after rename: %w", finalMergedFilePath, openErr)
+// observeRead записує затримку читання і в режимі кешу позначає прочитані ключі використаними.
+func (db *Db) observeRead(start time.Time, keys ...string) {
+	elapsed := time.Since(start)
+	db.lru.touch(keys...)
+	db.opts.Metrics.Count(MetricGets, int64(len(keys)))
+	db.opts.Metrics.Observe(OpRead, elapsed)
+	op := SlowOp{Op: OpRead, Elapsed: elapsed}
+	if len(keys) == 1 {
+		op.Key = keys[0]
 	}
+	db.reportSlow(op)
+}
+
+// Merge - синонім Compact, збережений для сумісності.
+func (db *Db) Merge() error {
+	_, err := db.Compact(context.Background())
+	return err
+}
+
+func (db *Db) tryMergeSegments() error {
+	_, err := db.runMerge(context.Background(), AuditMerge, nil, false)
+	return err
+}
 
-	for key, val := range newIndexForMergedSegment {
-		db.currentIndex[key] = val
+// runMerge виконує злиття, не допускаючи двох злиттів одночасно, і записує його в журнал
+// обслуговування як op. Якщо wait false і злиття вже триває, повертається одразу;
+// інакше чекає на його завершення. Див. performMerge.
+func (db *Db) runMerge(ctx context.Context, op string, policy CompactionPolicy, wait bool) (CompactionReport, error) {
+	unlock, err := db.lockMerges(ctx, wait)
+	if unlock == nil {
+		return CompactionReport{}, err
 	}
-	delete(db.segmentFiles, targetMergeSegmentID) // Видаляємо старий дескриптор, якщо був
-	db.segmentFiles[targetMergeSegmentID] = mergedSegmentReadOnly
+	defer unlock()
+	report, err := db.performMerge(ctx, policy, op == AuditMerge)
+	// Фонове злиття, якому нічого було зливати, не журналюється.
+	if err != nil || report.SegmentsMerged > 0 || op != AuditMerge {
+		details := "nothing to merge"
+		if report.SegmentsMerged > 0 {
+			details = fmt.Sprintf("merged %d segments into %d, %d -> %d bytes, %d keys purged",
+				report.SegmentsMerged, report.SegmentsWritten, report.BytesBefore, report.BytesAfter, report.KeysPurged)
+		}
+		db.Audit(AuditEntry{Op: op, Details: details}, err)
+	}
+	return report, err
+}
 
-	for _, segIDToRemove := range segmentsToMergeIDs {
-		if segIDToRemove == targetMergeSegmentID {
-			continue
+// lockMerges захоплює семафор злиття для злиття чи архівації (див. coldtier.go) і повертає
+// функцію, що його звільняє. Якщо wait false і семафор зайнятий, повертає nil без помилки.
+func (db *Db) lockMerges(ctx context.Context, wait bool) (func(), error) {
+	// Злиття читає сегменти без db.mu, тому Close має дочекатися його завершення.
+	db.closeMu.RLock()
+	if db.closed {
+		db.closeMu.RUnlock()
+		return nil, ErrClosed
+	}
+	release := db.workers.track()
+	db.closeMu.RUnlock()
+	if wait {
+		select {
+		case db.mergeSem <- struct{}{}:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-db.workers.done():
+			release()
+			return nil, ErrClosed
 		}
-		if oldFile, ok := db.segmentFiles[segIDToRemove]; ok {
-			_ = oldFile.Close()
-			delete(db.segmentFiles, segIDToRemove)
-			filePathToRemove := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segIDToRemove))
-			if removeErr := os.Remove(filePathToRemove); removeErr != nil {
-				fmt.Printf("Warning: merge: failed to remove old segment file %s: %v\n", filePathToRemove, removeErr)
-			}
+	} else {
+		select {
+		case db.mergeSem <- struct{}{}:
+		default:
+			release()
+			return nil, nil
 		}
 	}
-	return nil
+	return func() {
+		<-db.mergeSem
+		release()
+	}, nil
 }
 
 func (db *Db) Size() (int64, error) {
@@ -531,3 +1666,50 @@ func (db *Db) Size() (int64, error) {
 	}
 	return totalSize, nil
 }
+
+// GetMany читає кілька ключів під одним блокуванням. Результат містить кожен запитаний ключ:
+// string або int64 для знайдених ключів і nil для відсутніх. Читання впорядковуються
+// за сегментом та зміщенням, щоб звернення до кожного файлу йшли послідовно.
+func (db *Db) GetMany(keys []string) (map[string]interface{}, error) {
+	defer db.observeRead(time.Now(), keys...)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getManyLocked(keys)
+}
+
+// getManyLocked - реалізація GetMany. Викликається під db.mu.
+func (db *Db) getManyLocked(keys []string) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(keys))
+	type located struct {
+		key    string
+		idxVal indexValue
+	}
+	found := make([]located, 0, len(keys))
+	for _, key := range keys {
+		if _, seen := result[key]; seen {
+			continue
+		}
+		result[key] = nil
+		idxVal, ok, err := db.lookupForRead(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, located{key: key, idxVal: idxVal})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].idxVal.segmentID != found[j].idxVal.segmentID {
+			return found[i].idxVal.segmentID < found[j].idxVal.segmentID
+		}
+		return found[i].idxVal.offset < found[j].idxVal.offset
+	})
+	for _, loc := range found {
+		record, err := db.readRecordLocked(loc.key, loc.idxVal)
+		if err != nil {
+			return nil, err
+		}
+		result[loc.key] = record.keyValue().Value
+	}
+	return result, nil
+}
@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -11,41 +13,42 @@ import (
 	"time"
 )
 
-// setTestMergeInterval встановлює змінну середовища для інтервалу злиття та повертає її попереднє значення.
-func setTestMergeInterval(t *testing.T, intervalMs string) (originalInterval string) {
-	t.Helper()
-	originalInterval = os.Getenv("TEST_MERGE_INTERVAL_MS")
-	os.Setenv("TEST_MERGE_INTERVAL_MS", intervalMs)
-	return
+// testMaxFileSize - розмір сегмента для тестів (1KB).
+const testMaxFileSize int64 = 1024
+
+// testOptions повертає налаштування БД для тестів.
+// disablePeriodicMerge: якщо true, фонове злиття вимикається.
+func testOptions(disablePeriodicMerge bool) Options {
+	opts := DefaultOptions()
+	opts.MaxFileSize = testMaxFileSize
+	if disablePeriodicMerge {
+		opts.MergeInterval = -1
+	} else {
+		opts.MergeInterval = 100 * time.Millisecond
+	}
+	return opts
 }
 
 // setupTestDb створює тестову БД.
-// disablePeriodicMerge: якщо true, встановлює дуже великий інтервал для фонового злиття.
+// disablePeriodicMerge: якщо true, фонове злиття вимикається.
 func setupTestDb(t *testing.T, disablePeriodicMerge bool) (*Db, func()) {
 	t.Helper()
 	dir := t.TempDir()
-	originalMaxFileSize := MaxFileSize
-	MaxFileSize = 1024 // 1KB для тестів
-
-	var originalMergeEnv string
-	if disablePeriodicMerge {
-		originalMergeEnv = setTestMergeInterval(t, "3600000") // 1 година, фактично вимикає periodicMerge
-	} else {
-		originalMergeEnv = setTestMergeInterval(t, "100") // 100ms
-	}
 
-	db, err := NewDb(dir)
+	db, err := NewDbWithOptions(dir, testOptions(disablePeriodicMerge))
 	if err != nil {
 		t.Fatalf("Failed to open DB: %v", err)
 	}
 
 	cleanup := func() {
-		time.Sleep(300 * time.Millisecond)
+		// Flush чекає, доки горутини запису застосують усі прийняті записи, а Close
+		// закриває файли, тож пауза перед закриттям не потрібна.
+		if errFlush := db.Flush(); errFlush != nil {
+			t.Logf("Error flushing DB during cleanup: %v", errFlush)
+		}
 		if errDbClose := db.Close(); errDbClose != nil {
 			t.Logf("Error closing DB during cleanup: %v", errDbClose)
 		}
-		MaxFileSize = originalMaxFileSize
-		os.Setenv("TEST_MERGE_INTERVAL_MS", originalMergeEnv)
 	}
 	return db, cleanup
 }
@@ -60,7 +63,9 @@ func TestDb_Put_Get_String(t *testing.T) {
 	if err := db.Put(key, value); err != nil {
 		t.Fatalf("Put failed: %v", err)
 	}
-	time.Sleep(150 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	retrievedValue, err := db.Get(key)
 	if err != nil {
@@ -86,7 +91,9 @@ func TestDb_Put_Get_Int64(t *testing.T) {
 	if err := db.PutInt64(key, value); err != nil {
 		t.Fatalf("PutInt64 failed: %v", err)
 	}
-	time.Sleep(150 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	retrievedValue, err := db.GetInt64(key)
 	if err != nil {
@@ -104,7 +111,9 @@ func TestDb_Put_Get_Int64(t *testing.T) {
 	if err := db.Put("stringKeyForIntTest", "not_an_int"); err != nil {
 		t.Fatalf("Put string failed: %v", err)
 	}
-	time.Sleep(150 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	_, err = db.GetInt64("stringKeyForIntTest")
 	if !errors.Is(err, ErrWrongType) {
@@ -119,15 +128,7 @@ func TestDb_Put_Get_Int64(t *testing.T) {
 
 func TestDb_Persistence(t *testing.T) {
 	dir := t.TempDir()
-	originalMaxFileSize := MaxFileSize
-	MaxFileSize = 1024
-	originalMergeEnv := setTestMergeInterval(t, "3600000")
-	defer func() {
-		MaxFileSize = originalMaxFileSize
-		os.Setenv("TEST_MERGE_INTERVAL_MS", originalMergeEnv)
-	}()
-
-	db, err := NewDb(dir)
+	db, err := NewDbWithOptions(dir, testOptions(true))
 	if err != nil {
 		t.Fatalf("Failed to open DB for the first time: %v", err)
 	}
@@ -151,21 +152,24 @@ func TestDb_Persistence(t *testing.T) {
 			t.Fatalf("PutInt64(%s, %d) failed: %v", k, v, err)
 		}
 	}
-	time.Sleep(250 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	if err := db.Put("key1", "value1_updated"); err != nil {
 		t.Fatalf("Put update failed: %v", err)
 	}
 	pairs["key1"] = "value1_updated"
-	time.Sleep(150 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	if errDbClose := db.Close(); errDbClose != nil {
 		t.Fatalf("Failed to close DB: %v", errDbClose)
 	}
 	time.Sleep(100 * time.Millisecond) // Додаткова пауза перед відкриттям
 
-	setTestMergeInterval(t, "3600000") // Переконуємося, що periodicMerge вимкнено і для db2
-	db2, err2 := NewDb(dir)
+	db2, err2 := NewDbWithOptions(dir, testOptions(true))
 	if err2 != nil {
 		t.Fatalf("Failed to reopen DB: %v", err2)
 	}
@@ -197,7 +201,7 @@ func TestDb_Segmentation(t *testing.T) {
 	db, cleanup := setupTestDb(t, true) // ВИМИКАЄМО periodicMerge для цього тесту
 	defer cleanup()
 
-	numRecordsToCauseOneRotation := (int(MaxFileSize) / 30) + 5 // ~39 записів для однієї ротації
+	numRecordsToCauseOneRotation := (int(testMaxFileSize) / 51) + 5 // ~25 записів для однієї ротації
 
 	numberOfRotations := 3
 	for i := 0; i < numRecordsToCauseOneRotation*numberOfRotations; i++ {
@@ -207,10 +211,12 @@ func TestDb_Segmentation(t *testing.T) {
 			t.Fatalf("Put failed for key %s: %v", key, err)
 		}
 	}
-	time.Sleep(600 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	db.mu.RLock()
-	finalActiveSegID := db.activeSegmentID
+	finalActiveSegID := db.shards[0].segmentID
 	var actualFileCountOnDisk int
 	filesInDir, _ := filepath.Glob(filepath.Join(db.dir, outFileNamePrefix+"*"))
 	for _, fPath := range filesInDir {
@@ -264,7 +270,7 @@ func TestDb_MergeSegments(t *testing.T) {
 	db, cleanup := setupTestDb(t, false)
 	defer cleanup()
 
-	recordsPerSegmentFill := (int(MaxFileSize) / 30) + 10
+	recordsPerSegmentFill := (int(testMaxFileSize) / 48) + 10
 
 	t.Logf("TestDb_MergeSegments: Populating segment 0...")
 	if err := db.Put("keyA", "valA_s0"); err != nil {
@@ -278,9 +284,11 @@ func TestDb_MergeSegments(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
-	time.Sleep(400 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 	db.mu.RLock()
-	t.Logf("TestDb_MergeSegments: After populating segment 0, activeSegmentID: %d", db.activeSegmentID)
+	t.Logf("TestDb_MergeSegments: After populating segment 0, activeSegmentID: %d", db.shards[0].segmentID)
 	db.mu.RUnlock()
 
 	t.Logf("TestDb_MergeSegments: Populating segment 1...")
@@ -295,9 +303,11 @@ func TestDb_MergeSegments(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
-	time.Sleep(400 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 	db.mu.RLock()
-	t.Logf("TestDb_MergeSegments: After populating segment 1, activeSegmentID: %d", db.activeSegmentID)
+	t.Logf("TestDb_MergeSegments: After populating segment 1, activeSegmentID: %d", db.shards[0].segmentID)
 	db.mu.RUnlock()
 
 	t.Logf("TestDb_MergeSegments: Populating segment 2 (active)...")
@@ -307,12 +317,14 @@ func TestDb_MergeSegments(t *testing.T) {
 	if err := db.Put("keyD", "valD_s2"); err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(300 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	db.mu.RLock()
-	activeIDBeforeMerge := db.activeSegmentID
+	activeIDBeforeMerge := db.shards[0].segmentID
 	db.mu.RUnlock()
-	t.Logf("TestDb_MergeSegments: BEFORE merge call, current db.activeSegmentID is: %d", activeIDBeforeMerge)
+	t.Logf("TestDb_MergeSegments: BEFORE merge call, current db.shards[0].segmentID is: %d", activeIDBeforeMerge)
 
 	if activeIDBeforeMerge != 2 {
 		t.Fatalf("TestDb_MergeSegments: Pre-condition failed. Expected activeSegmentID to be 2 before merge, but got %d. Test setup (Puts/Sleeps) needs adjustment.", activeIDBeforeMerge)
@@ -351,25 +363,26 @@ func TestDb_MergeSegments(t *testing.T) {
 			remainingFiles = append(remainingFiles, filepath.Base(fPath))
 		}
 	}
-	finalActiveIDAfterMerge := db.activeSegmentID
+	finalActiveIDAfterMerge := db.shards[0].segmentID
 	db.mu.RUnlock()
 
 	t.Logf("TestDb_MergeSegments: Files after merge: %v, final active segment ID: %d (was %d before merge call)",
 		remainingFiles, finalActiveIDAfterMerge, activeIDBeforeMerge)
 
-	if actualFileCountOnDisk != 2 {
-		t.Errorf("Expected 2 segment files after merge (merged 0 and active 2), got %d. Files: %v", actualFileCountOnDisk, remainingFiles)
+	// Живих даних більше, ніж MaxFileSize, тому злиття розкладає їх у segment-0 та segment-1.
+	if actualFileCountOnDisk != 3 {
+		t.Errorf("Expected 3 segment files after merge (merged 0 and 1, active 2), got %d. Files: %v", actualFileCountOnDisk, remainingFiles)
 	}
 	if finalActiveIDAfterMerge != 2 {
 		t.Errorf("Expected active segment ID to be 2 after merge, got %d", finalActiveIDAfterMerge)
 	}
-	_, statErr1 := os.Stat(filepath.Join(db.dir, outFileNamePrefix+"1"))
-	if !os.IsNotExist(statErr1) {
-		t.Errorf("Expected segment-1 to be deleted, but stat returned: %v (file might still exist)", statErr1)
-	}
-	_, statErr0 := os.Stat(filepath.Join(db.dir, outFileNamePrefix+"0"))
-	if statErr0 != nil {
-		t.Errorf("Expected segment-0 (merged) to exist, but stat returned: %v", statErr0)
+	for _, segID := range []string{"0", "1"} {
+		stat, statErr := os.Stat(filepath.Join(db.dir, outFileNamePrefix+segID))
+		if statErr != nil {
+			t.Errorf("Expected segment-%s (merged) to exist, but stat returned: %v", segID, statErr)
+		} else if stat.Size() > testMaxFileSize {
+			t.Errorf("Merged segment-%s has size %d, exceeding MaxFileSize %d", segID, stat.Size(), testMaxFileSize)
+		}
 	}
 	_, statErr2 := os.Stat(filepath.Join(db.dir, outFileNamePrefix+"2"))
 	if statErr2 != nil {
@@ -400,7 +413,9 @@ func TestDb_Concurrency(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
-	time.Sleep(500 * time.Millisecond)
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
 
 	for i := 0; i < numGoroutines; i++ {
 		for j := 0; j < numPutsPerGoroutine; j++ {
@@ -417,3 +432,535 @@ func TestDb_Concurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestDb_Keys_Iterate(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("c", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := db.Keys()
+	expected := []string{"a", "b", "c"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Keys returned %v, want %v", keys, expected)
+	}
+
+	types := make(map[string]byte)
+	db.Iterate(func(key string, dataType byte) bool {
+		types[key] = dataType
+		return true
+	})
+	if len(types) != 3 || types["a"] != DataTypeInt64 || types["b"] != DataTypeString {
+		t.Errorf("Iterate returned unexpected types: %v", types)
+	}
+
+	var visited []string
+	db.Iterate(func(key string, _ byte) bool {
+		visited = append(visited, key)
+		return len(visited) < 2
+	})
+	if len(visited) != 2 {
+		t.Errorf("Iterate did not stop early: visited %v", visited)
+	}
+}
+
+func TestDb_SortedKeysMergedPerBatch(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if err := db.Put("m", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Один пакет: нові ключі, видалення відкладеного ключа й повторне додавання.
+	batch := []putRequest{
+		{key: "z", value: "v", dataType: DataTypeString},
+		{key: "a", value: "v", dataType: DataTypeString},
+		{key: "k", value: "v", dataType: DataTypeString},
+		{dataType: dataTypeTombstone, deleteKeys: []string{"k"}},
+		{key: "b", value: "v", dataType: DataTypeString},
+		{key: "k", value: "v2", dataType: DataTypeString},
+		{key: "a", value: "v2", dataType: DataTypeString},
+	}
+	errs, _ := db.applyBatchLocked(batch)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if got := strings.Join(db.Keys(), ","); got != "a,b,k,m,z" {
+		t.Errorf("Keys after batch = %s", got)
+	}
+	if len(db.newKeys) != 0 {
+		t.Errorf("%d keys left unmerged after the batch", len(db.newKeys))
+	}
+}
+
+func TestDb_Range(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	for _, key := range []string{"k05", "k01", "k03", "k02", "k04", "a", "z"} {
+		if err := db.Put(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("k04"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := db.Range("k02", "k05", 0); strings.Join(got, ",") != "k02,k03" {
+		t.Errorf("Range(k02, k05) = %v", got)
+	}
+	if got := db.Range("k", "", 2); strings.Join(got, ",") != "k01,k02" {
+		t.Errorf("Range(k, \"\", 2) = %v", got)
+	}
+	if got := db.Range("k05", "k01", 0); len(got) != 0 {
+		t.Errorf("Range with end before start = %v", got)
+	}
+
+	var pages [][]string
+	for start := ""; ; {
+		page := db.Range(start, "", 3)
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, page)
+		start = page[len(page)-1] + "\x00"
+	}
+	if len(pages) != 2 || strings.Join(append(pages[0], pages[1]...), ",") != "a,k01,k02,k03,k05,z" {
+		t.Errorf("paged Range = %v", pages)
+	}
+}
+
+func TestDb_GetByPrefix(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("user:2", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("user:1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("user:count", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("users", "not-in-namespace"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("order:1", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs, err := db.GetByPrefix("user:")
+	if err != nil {
+		t.Fatalf("GetByPrefix failed: %v", err)
+	}
+	if len(kvs) != 3 {
+		t.Fatalf("GetByPrefix returned %d pairs, want 3: %v", len(kvs), kvs)
+	}
+	if kvs[0].Key != "user:1" || kvs[0].Value != "alice" {
+		t.Errorf("unexpected first pair: %+v", kvs[0])
+	}
+	if kvs[2].Key != "user:count" || kvs[2].Value != int64(2) || kvs[2].DataType != DataTypeInt64 {
+		t.Errorf("unexpected int pair: %+v", kvs[2])
+	}
+
+	kvs, err = db.GetByPrefix("missing:")
+	if err != nil || len(kvs) != 0 {
+		t.Errorf("expected empty result for missing prefix, got %v, err %v", kvs, err)
+	}
+}
+
+func TestDb_Delete(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"tmp_1", "tmp_2", "keep"} {
+		if err := db.Put(key, "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Delete("keep"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Delete("keep"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound when deleting a missing key, got %v", err)
+	}
+	deleted, err := db.DeleteKeys([]string{"tmp_1", "tmp_2", "tmp_1", "missing"})
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteKeys returned %d, %v; want 2, nil", deleted, err)
+	}
+	if err := db.Put("tmp_1", "revived"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db2, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	if _, err := db2.Get("keep"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted key to stay deleted after reopen, got %v", err)
+	}
+	if _, err := db2.Get("tmp_2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted key to stay deleted after reopen, got %v", err)
+	}
+	if v, err := db2.Get("tmp_1"); err != nil || v != "revived" {
+		t.Errorf("expected re-put key to be readable after reopen, got %q, %v", v, err)
+	}
+	if keys := db2.Keys(); len(keys) != 1 {
+		t.Errorf("expected one key after reopen, got %v", keys)
+	}
+}
+
+func TestDb_RecoverTornTail(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key2", "value2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segmentPath := filepath.Join(dir, outFileNamePrefix+"0")
+	validInfo, err := os.Stat(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := (&entry{key: "key3", value: "value3", dataType: DataTypeString}).Encode()
+	f, err := os.OpenFile(segmentPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(torn[:len(torn)-3]); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	db2, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("Failed to reopen DB with torn tail: %v", err)
+	}
+	defer db2.Close()
+
+	if v, err := db2.Get("key2"); err != nil || v != "value2" {
+		t.Errorf("expected key2 to survive recovery, got %q, %v", v, err)
+	}
+	if _, err := db2.Get("key3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected torn key3 to be dropped, got %v", err)
+	}
+	info, err := os.Stat(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != validInfo.Size() {
+		t.Errorf("expected segment to be truncated to %d bytes, got %d", validInfo.Size(), info.Size())
+	}
+}
+
+func TestDb_CorruptSizeIsNotTornTail(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Розмір першого запису більший за файл, а за ним лишаються цілі записи.
+	segmentPath := filepath.Join(dir, outFileNamePrefix+"0")
+	before, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), before...)
+	binary.LittleEndian.PutUint32(corrupted, 0x00ffffff)
+	if err := os.WriteFile(segmentPath, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if db, err := NewDbWithOptions(dir, testOptions(true)); err == nil {
+		db.Close()
+		t.Fatal("segment with a corrupt record size was opened as a torn tail")
+	}
+	after, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, corrupted) {
+		t.Errorf("segment was changed from %d to %d bytes", len(corrupted), len(after))
+	}
+}
+
+func TestDb_OpenModes(t *testing.T) {
+	first := (&entry{key: "key1", value: "value1", dataType: DataTypeString}).Encode()
+	last := (&entry{key: "key3", value: "value3", dataType: DataTypeString}).Encode()
+	// Запис цілого розміру з непридатною довжиною ключа та запис з непридатним розміром.
+	badContent := []byte{9, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff}
+	badSize := []byte{2, 0, 0, 0}
+	// Розмір, що виходить за кінець файлу, хоча за ним є цілий запис.
+	pastEOF := []byte{0xff, 0xff, 0, 0}
+
+	open := func(t *testing.T, mode OpenMode, bad []byte) (*Db, string, error) {
+		t.Helper()
+		dir := t.TempDir()
+		data := append(append(append([]byte(nil), first...), bad...), last...)
+		if err := os.WriteFile(filepath.Join(dir, outFileNamePrefix+"0"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		opts := testOptions(true)
+		opts.OpenMode = mode
+		db, err := NewDbWithOptions(dir, opts)
+		if err == nil {
+			t.Cleanup(func() { db.Close() })
+		}
+		return db, filepath.Join(dir, outFileNamePrefix+"0"), err
+	}
+	check := func(t *testing.T, db *Db, wantKey3 bool) {
+		t.Helper()
+		if v, err := db.Get("key1"); err != nil || v != "value1" {
+			t.Errorf("Get(key1) = %q, %v", v, err)
+		}
+		v, err := db.Get("key3")
+		if wantKey3 && (err != nil || v != "value3") {
+			t.Errorf("Get(key3) = %q, %v", v, err)
+		}
+		if !wantKey3 && !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(key3) = %q, %v; want ErrNotFound", v, err)
+		}
+	}
+	size := func(t *testing.T, path string) int {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(info.Size())
+	}
+
+	lastAudit := func(t *testing.T, db *Db, op string) string {
+		t.Helper()
+		entries, _ := db.AuditLog(0)
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i].Op == op {
+				return entries[i].Details
+			}
+		}
+		t.Fatalf("no %s record in the audit log: %+v", op, entries)
+		return ""
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		for _, bad := range [][]byte{badContent, badSize, pastEOF} {
+			if _, path, err := open(t, OpenStrict, bad); err == nil {
+				t.Errorf("corrupt segment %v was opened in strict mode", bad)
+			} else if got := size(t, path); got != len(first)+len(bad)+len(last) {
+				t.Errorf("strict open changed the segment to %d bytes", got)
+			}
+		}
+	})
+	t.Run("permissive", func(t *testing.T) {
+		db, path, err := open(t, OpenPermissive, badContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, db, true)
+		if got := size(t, path); got != len(first)+len(badContent)+len(last) {
+			t.Errorf("segment was changed to %d bytes", got)
+		}
+		entries, _ := db.AuditLog(0)
+		if len(entries) == 0 || entries[0].Op != AuditSkipCorrupt {
+			t.Errorf("skipped record was not recorded in the audit log: %+v", entries)
+		}
+	})
+	t.Run("permissive without record size", func(t *testing.T) {
+		db, _, err := open(t, OpenPermissive, badSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, db, false)
+	})
+	t.Run("permissive with size past the end", func(t *testing.T) {
+		db, path, err := open(t, OpenPermissive, pastEOF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, db, false)
+		if got := size(t, path); got != len(first)+len(pastEOF)+len(last) {
+			t.Errorf("segment was changed to %d bytes", got)
+		}
+		want := fmt.Sprintf("ignored the remaining %d bytes", len(pastEOF)+len(last))
+		if details := lastAudit(t, db, AuditSkipCorrupt); !strings.Contains(details, want) {
+			t.Errorf("skipped bytes recorded as %q", details)
+		}
+	})
+	t.Run("repair with size past the end", func(t *testing.T) {
+		db, path, err := open(t, OpenRepair, pastEOF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, db, false)
+		if got := size(t, path); got != len(first) {
+			t.Errorf("segment was truncated to %d bytes, want %d", got, len(first))
+		}
+		want := fmt.Sprintf("truncated %d bytes", len(pastEOF)+len(last))
+		if details := lastAudit(t, db, AuditTruncate); !strings.HasPrefix(details, want) {
+			t.Errorf("truncated bytes recorded as %q", details)
+		}
+	})
+	t.Run("repair", func(t *testing.T) {
+		db, path, err := open(t, OpenRepair, badContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, db, false)
+		if got := size(t, path); got != len(first) {
+			t.Errorf("segment was truncated to %d bytes, want %d", got, len(first))
+		}
+	})
+}
+
+func TestDb_CloseDrainsWrites(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acknowledged := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("drain-%d", i)
+			err := db.Put(key, "value")
+			if err == nil {
+				mu.Lock()
+				acknowledged[key] = true
+				mu.Unlock()
+			} else if !errors.Is(err, ErrClosed) {
+				t.Errorf("Put %s failed with unexpected error: %v", key, err)
+			}
+		}(i)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	wg.Wait()
+	if err := db.Put("late", "value"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put after Close: expected ErrClosed, got %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close returned %v", err)
+	}
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for key := range acknowledged {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("acknowledged key %s lost after Close: %v", key, err)
+		}
+	}
+}
+
+func TestDb_GetMany(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("b", 2); err != nil {
+		t.Fatal(err)
+	}
+	// Достатньо записів, щоб ключі опинилися в різних сегментах.
+	for i := 0; i < 50; i++ {
+		if err := db.Put(fmt.Sprintf("fill-%d", i), strings.Repeat("v", 30)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("c", "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := db.GetMany([]string{"c", "a", "missing", "b", "a"})
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	if len(values) != 4 {
+		t.Errorf("expected 4 entries, got %d: %v", len(values), values)
+	}
+	if values["a"] != "1" || values["b"] != int64(2) || values["c"] != "3" {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if v, ok := values["missing"]; !ok || v != nil {
+		t.Errorf("missing key must be reported with nil value, got %v (present: %t)", v, ok)
+	}
+}
+
+func TestDb_ExistsAndTypeOf(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if err := db.Put("str", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("num", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]byte{"str": DataTypeString, "num": DataTypeInt64, "series": DataTypeSeries} {
+		if !db.Exists(key) {
+			t.Errorf("Exists(%s) = false", key)
+		}
+		if got, err := db.TypeOf(key); err != nil || got != want {
+			t.Errorf("TypeOf(%s) = %d, %v; want %d", key, got, err, want)
+		}
+	}
+	if db.Exists("missing") {
+		t.Error("Exists(missing) = true")
+	}
+	if _, err := db.TypeOf("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TypeOf(missing) error = %v, want ErrNotFound", err)
+	}
+	if err := db.Delete("str"); err != nil {
+		t.Fatal(err)
+	}
+	if db.Exists("str") {
+		t.Error("Exists after Delete = true")
+	}
+}
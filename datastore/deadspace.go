@@ -0,0 +1,74 @@
+package datastore
+
+// Облік мертвого місця. Для кожного сегмента база підтримує кількість живих байтів:
+// записів, на які посилаються індекс, часові ряди та спільні значення. Решта байтів
+// сегмента - перезаписані й видалені значення, надгробки та застарілі терміни дії,
+// які звільнить злиття. Живі байти змінюються з кожним записом і видаленням, а після
+// завантаження індексу та злиття перераховуються з нього.
+
+// expirySize повертає розмір запису терміну дії ключа. Термін дії завжди записується
+// одразу після значення, тож лежить у тому самому сегменті.
+func expirySize(key string, expiresAt int64) int64 {
+	return int64(len(encodeExpiry(key, expiresAt)))
+}
+
+// dropValueLiveLocked віднімає від живих байтів поточне значення ключа та його термін
+// дії, перш ніж їх замінить чи видалить запис. Викликається під db.mu.
+func (db *Db) dropValueLiveLocked(key string) {
+	idxVal, ok := db.currentIndex.get(key)
+	if !ok {
+		return
+	}
+	db.liveBytes[idxVal.segmentID] -= idxVal.size
+	if expiresAt, ok := db.expiries[key]; ok {
+		db.liveBytes[idxVal.segmentID] -= expirySize(key, expiresAt)
+	}
+}
+
+// recountLiveLocked перераховує живі байти сегментів з індексу. Викликається під db.mu.
+func (db *Db) recountLiveLocked() {
+	live := make(map[int]int64, len(db.segmentFiles))
+	err := db.currentIndex.forEach(func(key string, idxVal indexValue) {
+		live[idxVal.segmentID] += idxVal.size
+		if expiresAt, ok := db.expiries[key]; ok {
+			live[idxVal.segmentID] += expirySize(key, expiresAt)
+		}
+	})
+	if err != nil {
+		// Неповний підрахунок лише зміщує вибір сегментів для злиття.
+		db.opts.Logger.Warnf("failed to count live bytes: %v", err)
+	}
+	for _, chunks := range db.seriesIndex {
+		for _, idxVal := range chunks {
+			live[idxVal.segmentID] += idxVal.size
+		}
+	}
+	db.liveBytes = live
+	db.blobs.recountLive()
+}
+
+// segmentDeadLocked повертає мертві байти сегмента розміру size. Викликається під db.mu.
+func (db *Db) segmentDeadLocked(segID int, size int64) int64 {
+	return max(size-db.liveBytes[segID]-db.blobs.segmentLive(segID), 0)
+}
+
+// FragmentationRatio повертає частку байтів усіх сегментів, зайнятих перезаписаними
+// та видаленими записами: 0 - мертвого місця немає, ближче до 1 - злиття звільнить
+// майже все місце. Обчислюється за обліком, без перегляду індексу.
+func (db *Db) FragmentationRatio() float64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var total, dead int64
+	for segID, file := range db.segmentFiles {
+		stat, err := file.Stat()
+		if err != nil {
+			continue
+		}
+		total += stat.Size()
+		dead += db.segmentDeadLocked(segID, stat.Size())
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(dead) / float64(total)
+}
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+// liveSnapshot повертає облік живих байтів без сегментів з нулем.
+func liveSnapshot(db *Db) (values, blobs map[int]int64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	nonZero := func(m map[int]int64) map[int]int64 {
+		out := make(map[int]int64)
+		for segID, n := range m {
+			if n != 0 {
+				out[segID] = n
+			}
+		}
+		return out
+	}
+	db.blobs.mu.RLock()
+	defer db.blobs.mu.RUnlock()
+	return nonZero(db.liveBytes), nonZero(db.blobs.segLive)
+}
+
+func TestDb_DeadSpaceAccounting(t *testing.T) {
+	opts := testOptions(true)
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if ratio := db.FragmentationRatio(); ratio != 0 {
+		t.Errorf("FragmentationRatio of an empty database = %v", ratio)
+	}
+	shared := strings.Repeat("shared ", 5)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i%5)
+		ops := []error{
+			db.Put(key, fmt.Sprintf("value-%d", i)),
+			db.Put(fmt.Sprintf("dup%d", i%3), shared+fmt.Sprint(i%2)),
+			db.AppendSeries("series", SeriesPoint{Timestamp: int64(i), Value: int64(i)}),
+			db.Copy(key, "ttl"+key, CopyOptions{Overwrite: true, TTL: time.Hour}),
+		}
+		for _, err := range ops {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Put("big", strings.Repeat("x", 2*int(testMaxFileSize))); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("big", "small again"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DeletePrefix("ttlkey2"); err != nil {
+		t.Fatal(err)
+	}
+
+	values, blobs := liveSnapshot(db)
+	db.mu.Lock()
+	db.recountLiveLocked()
+	db.mu.Unlock()
+	wantValues, wantBlobs := liveSnapshot(db)
+	if !maps.Equal(values, wantValues) || !maps.Equal(blobs, wantBlobs) {
+		t.Errorf("incremental live bytes %v (shared %v), recounted %v (shared %v)", values, blobs, wantValues, wantBlobs)
+	}
+	before := db.FragmentationRatio()
+	if before <= 0.5 {
+		t.Errorf("FragmentationRatio after overwrites = %v, want > 0.5", before)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FragmentationRatio != before || stats.DeadBytes == 0 {
+		t.Errorf("Stats report %d dead bytes, ratio %v; FragmentationRatio = %v", stats.DeadBytes, stats.FragmentationRatio, before)
+	}
+
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if after := db.FragmentationRatio(); after >= before {
+		t.Errorf("FragmentationRatio after compaction = %v, before %v", after, before)
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seg := range segments {
+		if !seg.Active && seg.DeadBytes != 0 {
+			t.Errorf("merged segment %d has %d dead bytes", seg.ID, seg.DeadBytes)
+		}
+	}
+}
+
+// countingPolicy передає тесту стани, з якими фонове злиття зверталося до політики.
+type countingPolicy struct {
+	calls chan CompactionState
+	inner CompactionPolicy
+}
+
+func (p countingPolicy) ShouldCompact(state CompactionState) bool {
+	select {
+	case p.calls <- state:
+	default:
+	}
+	return p.inner.ShouldCompact(state)
+}
+
+func TestDb_CompactionTriggerUsesDeadSpace(t *testing.T) {
+	opts := testOptions(false)
+	policy := countingPolicy{calls: make(chan CompactionState, 100), inner: DeadBytesRatioPolicy{MinRatio: 0.5}}
+	opts.CompactionPolicy = policy
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Без перезаписів мертвого місця немає, тож злиття не запускається.
+	state := <-policy.calls
+	if state.DeadBytes() != 0 {
+		t.Errorf("state without overwrites has %d dead bytes", state.DeadBytes())
+	}
+	if stats, _ := db.Stats(); stats.MergeCount != 0 {
+		t.Errorf("merge ran without dead space")
+	}
+	for i := 0; i < 200; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%4), strings.Repeat("w", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if stats, _ := db.Stats(); stats.MergeCount > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("merge was not triggered, fragmentation %v", db.FragmentationRatio())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
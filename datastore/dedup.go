@@ -0,0 +1,278 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+const defaultDedupThreshold = 128
+
+// blobHash - SHA-256 вмісту спільного значення.
+type blobHash [sha256.Size]byte
+
+// Дедупліковане значення зберігається двома видами записів:
+// запис dataTypeBlob з ключем hex(SHA-256) містить саме значення і пишеться один раз,
+// а запис dataTypeRef з ключем користувача містить лише хеш значення.
+// Злиття переносить спільне значення, лише поки на нього посилається хоч один живий ключ.
+// Так само зберігаються частини великих значень, див. chunk.go.
+
+func (h blobHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func parseBlobHash(s string) (blobHash, error) {
+	var h blobHash
+	if hex.DecodedLen(len(s)) != len(h) {
+		return h, fmt.Errorf("invalid blob hash %q", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid blob hash %q: %w", s, err)
+	}
+	return h, nil
+}
+
+// blobStore відстежує розташування спільних значень і ключі, що на них посилаються.
+// Змінюється під db.mu (а переміщення злиттям - ще й під db.segMu); власний замок
+// дозволяє читанням, що утримують лише db.segMu, знаходити значення.
+type blobStore struct {
+	mu      sync.RWMutex
+	locs    map[blobHash]indexValue
+	refs    map[blobHash]int
+	keyRefs map[string]keyRefs
+	// segLive - байти значень, на які є посилання, у кожному сегменті (див. deadspace.go).
+	segLive map[int]int64
+}
+
+// keyRefs - спільні значення, на які посилається ключ, і вид запису ключа
+// (dataTypeRef або dataTypeChunked).
+type keyRefs struct {
+	kind   byte
+	hashes []blobHash
+}
+
+func newBlobStore() *blobStore {
+	return &blobStore{
+		locs:    make(map[blobHash]indexValue),
+		refs:    make(map[blobHash]int),
+		keyRefs: make(map[string]keyRefs),
+		segLive: make(map[int]int64),
+	}
+}
+
+func (s *blobStore) location(h blobHash) (indexValue, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loc, ok := s.locs[h]
+	return loc, ok
+}
+
+// reusable повідомляє, чи можна послатися на вже записане значення. Значення без посилань
+// може бути видалене злиттям, що вже виконується, тому його записують заново.
+func (s *blobStore) reusable(h blobHash) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.locs[h]
+	return ok && s.refs[h] > 0
+}
+
+func (s *blobStore) setLocation(h blobHash, loc indexValue) {
+	s.mu.Lock()
+	s.moveLocked(h, loc)
+	s.mu.Unlock()
+}
+
+// moveLocked встановлює нове місце значення, переносячи його живі байти.
+func (s *blobStore) moveLocked(h blobHash, loc indexValue) {
+	if s.refs[h] > 0 {
+		if old, ok := s.locs[h]; ok {
+			s.segLive[old.segmentID] -= old.size
+		}
+		s.segLive[loc.segmentID] += loc.size
+	}
+	s.locs[h] = loc
+}
+
+// relocate переносить значення на нове місце, якщо воно досі лежить за old.
+func (s *blobStore) relocate(h blobHash, old, loc indexValue) {
+	s.mu.Lock()
+	if current, ok := s.locs[h]; ok && current == old {
+		s.moveLocked(h, loc)
+	}
+	s.mu.Unlock()
+}
+
+// forget видаляє значення без посилань, якщо воно досі лежить за old.
+func (s *blobStore) forget(h blobHash, old indexValue) {
+	s.mu.Lock()
+	if current, ok := s.locs[h]; ok && current == old && s.refs[h] == 0 {
+		delete(s.locs, h)
+	}
+	s.mu.Unlock()
+}
+
+// setRefs фіксує, що key записом виду kind посилається на значення hashes.
+func (s *blobStore) setRefs(key string, kind byte, hashes []blobHash) {
+	s.mu.Lock()
+	s.dropRefLocked(key)
+	s.keyRefs[key] = keyRefs{kind: kind, hashes: hashes}
+	for _, h := range hashes {
+		if s.refs[h]++; s.refs[h] == 1 {
+			if loc, ok := s.locs[h]; ok {
+				s.segLive[loc.segmentID] += loc.size
+			}
+		}
+	}
+	s.mu.Unlock()
+}
+
+// dropRef фіксує, що key більше не посилається на спільне значення.
+func (s *blobStore) dropRef(key string) {
+	s.mu.Lock()
+	s.dropRefLocked(key)
+	s.mu.Unlock()
+}
+
+func (s *blobStore) dropRefLocked(key string) {
+	kr, ok := s.keyRefs[key]
+	if !ok {
+		return
+	}
+	delete(s.keyRefs, key)
+	for _, h := range kr.hashes {
+		if s.refs[h]--; s.refs[h] <= 0 {
+			delete(s.refs, h)
+			if loc, ok := s.locs[h]; ok {
+				s.segLive[loc.segmentID] -= loc.size
+			}
+		}
+	}
+}
+
+// refKind повертає вид запису ключа, що посилається на спільні значення.
+func (s *blobStore) refKind(key string) (byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kr, ok := s.keyRefs[key]
+	return kr.kind, ok
+}
+
+// inSegments повертає значення, що лежать у сегментах merging, розділені на ті,
+// на які є посилання, і ті, що більше не потрібні.
+func (s *blobStore) inSegments(merging map[int]bool) (live, dead map[blobHash]indexValue) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	live = make(map[blobHash]indexValue)
+	dead = make(map[blobHash]indexValue)
+	for h, loc := range s.locs {
+		if !merging[loc.segmentID] {
+			continue
+		}
+		if s.refs[h] > 0 {
+			live[h] = loc
+		} else {
+			dead[h] = loc
+		}
+	}
+	return live, dead
+}
+
+// segmentLive повертає розмір записів спільних значень сегмента, на які є посилання.
+func (s *blobStore) segmentLive(segID int) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.segLive[segID]
+}
+
+// recountLive перераховує живі байти сегментів за розташуванням і посиланнями значень.
+func (s *blobStore) recountLive() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segLive = make(map[int]int64)
+	for h, loc := range s.locs {
+		if s.refs[h] > 0 {
+			s.segLive[loc.segmentID] += loc.size
+		}
+	}
+}
+
+// len повертає кількість записаних спільних значень (разом з частинами великих значень),
+// ключів-посилань на них і ключів, збережених частинами.
+func (s *blobStore) len() (blobs, refs, chunked int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, kr := range s.keyRefs {
+		if kr.kind == dataTypeChunked {
+			chunked++
+		} else {
+			refs++
+		}
+	}
+	return len(s.locs), refs, chunked
+}
+
+// dedupEntry повертає запис-посилання для значення та, якщо значення ще не записане,
+// запис самого значення. Обидва записи отримують час запису timestamp. Викликається під db.mu.
+func (db *Db) dedupEntry(key, value string, timestamp int64) (ref entry, blob []byte) {
+	h := blobHash(sha256.Sum256([]byte(value)))
+	ref = entry{key: key, dataType: dataTypeRef, ref: h, timestamp: timestamp}
+	if !db.blobs.reusable(h) {
+		b := entry{key: h.String(), value: value, dataType: dataTypeBlob, timestamp: timestamp}
+		blob = b.Encode()
+	}
+	return ref, blob
+}
+
+// resolveRefLocked підставляє в запис-посилання спільне значення, а в запис, збережений
+// частинами, - зібране значення. Викликається під db.mu або db.segMu.
+func (db *Db) resolveRefLocked(record entry) (entry, error) {
+	if record.dataType == dataTypeChunked {
+		return db.assembleChunksLocked(record)
+	}
+	if record.dataType != dataTypeRef {
+		return record, nil
+	}
+	loc, ok := db.blobs.location(record.ref)
+	if !ok {
+		return record, fmt.Errorf("shared value %s for key '%s' not found", record.ref, record.key)
+	}
+	blob, err := db.readRecordLocked(record.ref.String(), loc)
+	if err != nil {
+		return record, err
+	}
+	if blob.dataType != dataTypeBlob {
+		return record, fmt.Errorf("record for shared value %s has type %d", record.ref, blob.dataType)
+	}
+	record.dataType = DataTypeString
+	record.value = blob.value
+	return record, nil
+}
+
+// readRefLocked читає запис-посилання або запис, збережений частинами, вид якого
+// вказано в rec. Викликається під db.mu.
+func (db *Db) readRefLocked(segID int, rec hintRecord) (entry, error) {
+	file, ok := db.segmentReaderLocked(segID)
+	if !ok {
+		return entry{}, fmt.Errorf("segment %d for reference of key '%s' is not open", segID, rec.key)
+	}
+	record, err := readRecordFrom(file, db.keys, rec.key, indexValue{segmentID: segID, offset: rec.offset, size: rec.size})
+	if err != nil {
+		return entry{}, err
+	}
+	if record.dataType != rec.dataType {
+		return entry{}, fmt.Errorf("record of key '%s' in segment %d is not a reference", rec.key, segID)
+	}
+	return record, nil
+}
+
+// blobRefs повертає спільні значення, на які посилається запис, та тип значення ключа.
+func (e *entry) blobRefs() ([]blobHash, byte) {
+	switch e.dataType {
+	case dataTypeRef:
+		return []blobHash{e.ref}, DataTypeString
+	case dataTypeChunked:
+		return e.chunks, e.chunkType
+	}
+	return nil, e.dataType
+}
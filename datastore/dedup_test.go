@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDb_DedupSharesIdenticalValues(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.MaxFileSize = 4096
+	opts.Dedup = true
+	opts.DedupThreshold = 64
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := strings.Repeat("shared value ", 40)
+	const keys = 50
+	for i := 0; i < keys; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), shared); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("short", "not deduplicated"); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SharedValues != 1 || stats.SharedValueRefs != keys {
+		t.Fatalf("expected 1 shared value with %d references, got %d with %d", keys, stats.SharedValues, stats.SharedValueRefs)
+	}
+	if stats.DiskSize >= int64(keys*len(shared)) {
+		t.Errorf("disk size %d shows no deduplication", stats.DiskSize)
+	}
+	if v, err := db.Get("key07"); err != nil || v != shared {
+		t.Errorf("Get(key07) = %d bytes, %v", len(v), err)
+	}
+
+	// Перезаписуємо всі ключі, крім одного: після злиття значення має залишитися доступним.
+	for i := 1; i < keys; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), fmt.Sprintf("own value %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check := func(stage string) {
+		t.Helper()
+		if v, err := db.Get("key00"); err != nil || v != shared {
+			t.Errorf("%s: Get(key00) = %d bytes, %v", stage, len(v), err)
+		}
+		if v, err := db.Get("key01"); err != nil || v != "own value 1" {
+			t.Errorf("%s: Get(key01) = %q, %v", stage, v, err)
+		}
+		if v, err := db.Get("short"); err != nil || v != "not deduplicated" {
+			t.Errorf("%s: Get(short) = %q, %v", stage, v, err)
+		}
+	}
+	check("after merge")
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hints, _ := filepath.Glob(filepath.Join(dir, hintFileNamePrefix+"*"))
+	for _, path := range hints {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen without hints")
+
+	// Без посилань спільне значення відкидається злиттям.
+	if err := db.Delete("key00"); err != nil {
+		t.Fatal(err)
+	}
+	// Запечатуємо сегмент зі спільним значенням, щоб він потрапив у злиття.
+	if err := db.Put("filler", strings.Repeat("x", 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.blobs.location(sha256.Sum256([]byte(shared))); ok {
+		t.Errorf("unreferenced shared value survived merge")
+	}
+}
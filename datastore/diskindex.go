@@ -0,0 +1,832 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// Індекс на диску (Options.DiskIndex). Для кожного запечатаного сегмента N файл
+// key-index/segment-N зберігає відсортовані за ключем останні записи ключів сегмента
+// (значення або надгробок) з розташуванням і терміном дії, а також записи спільних значень,
+// часових рядів, надгробки та видалення префіксів у порядку запису. Файл пишеться при
+// запечатуванні сегмента, для вихідних сегментів злиття та при відкритті, якщо його немає
+// або він застарів (розмір сегмента в заголовку не збігається), і видаляється разом із
+// сегментом. При закритті бази файли лишаються, тож наступне відкриття не читає підказок.
+//
+// У пам'яті для кожного файлу тримаються розріджений індекс (кожен DiskIndexSparseInterval-й
+// ключ зі зміщенням), фільтр Блума ключів і видалення префіксів. Ключ шукається у файлах
+// від найновішого сегмента: перевірка фільтра, двійковий пошук у розрідженому індексі й
+// читання одного блоку. Перший знайдений запис вирішує результат, якщо його не перекриває
+// новіше видалення префікса. Записи активних сегментів і зміни, яких ще немає у файлах,
+// shardedIndex тримає в пам'яті, доки файли не повернуть для ключа те саме.
+//
+// Список ключів у цьому режимі не тримається: обхід ключів зливає файли з записами в пам'яті
+// (див. Db.ascendKeysLocked). Для кожного ключа в пам'яті лишаються біти фільтрів Блума;
+// терміни дії, часові ряди й посилання на спільні значення, як і без DiskIndex, тримаються
+// для своїх ключів. Злиття та View тимчасово копіюють розташування ключів, які обробляють.
+
+const (
+	diskIndexDirName               = "key-index"
+	segmentIndexFileNamePrefix     = "segment-"
+	defaultDiskIndexSparseInterval = 64
+)
+
+// segmentIndexMagic позначає початок і кінець файлу індексу сегмента.
+var segmentIndexMagic = [4]byte{'K', 'I', 'X', '2'}
+
+var errStaleSegmentIndex = errors.New("segment index file is stale")
+
+// Формат файлу індексу сегмента:
+// [magic (4 байти)][розмір сегмента (int64)]
+// записи ключів у порядку зростання:
+// [довжина ключа (uint32)][ключ][тип запису (byte)][тип значення (byte)][зміщення (int64)][розмір (uint32)][термін дії (int64)]
+// записи спільних значень, часових рядів, надгробки та видалення префіксів у порядку запису,
+// у форматі файлу підказок
+// розріджений індекс: [кількість (uint32)], далі [довжина ключа (uint32)][ключ][зміщення у файлі (int64)]
+// видалення префіксів: [кількість (uint32)], далі [довжина префікса (uint32)][префікс][зміщення в сегменті (int64)]
+// фільтр Блума: [кількість хешів (uint32)][довжина (uint32)][біти]
+// [кінець записів ключів (int64)][початок розрідженого індексу (int64)][magic]
+
+const (
+	segmentIndexHeaderSize  = 12
+	segmentIndexTrailerSize = 20
+	segmentIndexEntryTail   = 22
+)
+
+// sparseEntry - перший ключ блоку файлу індексу та зміщення блоку.
+type sparseEntry struct {
+	key    string
+	offset int64
+}
+
+// prefixDelete - видалення префікса та його зміщення в сегменті.
+type prefixDelete struct {
+	prefix string
+	offset int64
+}
+
+// tableEntry - останній запис ключа в сегменті. kind - тип запису в сегменті (тип значення,
+// dataTypeRef, dataTypeChunked або dataTypeTombstone), val.dataType - тип значення.
+type tableEntry struct {
+	key       string
+	kind      byte
+	val       indexValue
+	expiresAt int64
+}
+
+// segmentTable - файл індексу одного сегмента.
+type segmentTable struct {
+	segID int
+	path  string
+	// tmpPath - записаний, але ще не перейменований файл, див. diskIndex.install.
+	tmpPath string
+	file    *os.File
+	// end - кінець записів ключів, events - кінець записів у порядку запису.
+	end    int64
+	events int64
+	sparse []sparseEntry
+	filter *bloomFilter
+	ranges []prefixDelete
+}
+
+func segmentTablePath(dir string, segID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d", segmentIndexFileNamePrefix, segID))
+}
+
+// writeSegmentTable записує файл індексу сегмента з entries, відсортованими за ключем,
+// та events у порядку запису у тимчасовий файл поруч із path.
+func writeSegmentTable(path string, segID int, size int64, entries []tableEntry, events []hintRecord, interval int) (*segmentTable, error) {
+	t := &segmentTable{segID: segID, path: path, tmpPath: path + ".tmp", filter: newBloomFilter(len(entries))}
+	f, err := os.OpenFile(t.tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create disk index %s: %w", t.tmpPath, err)
+	}
+	w := bufio.NewWriter(f)
+	var offset int64
+	var writeErr error
+	put := func(b []byte) {
+		if writeErr == nil {
+			_, writeErr = w.Write(b)
+		}
+		offset += int64(len(b))
+	}
+	buf := append([]byte(nil), segmentIndexMagic[:]...)
+	put(binary.LittleEndian.AppendUint64(buf, uint64(size)))
+	for i, e := range entries {
+		if i%interval == 0 {
+			t.sparse = append(t.sparse, sparseEntry{key: e.key, offset: offset})
+		}
+		t.filter.add(e.key)
+		buf = binary.LittleEndian.AppendUint32(buf[:0], uint32(len(e.key)))
+		buf = append(buf, e.key...)
+		buf = append(buf, e.kind, e.val.dataType)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.val.offset))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(e.val.size))
+		put(binary.LittleEndian.AppendUint64(buf, uint64(e.expiresAt)))
+	}
+	t.end = offset
+	for _, rec := range events {
+		if rec.dataType == dataTypeRangeTombstone {
+			t.ranges = append(t.ranges, prefixDelete{prefix: rec.key, offset: rec.offset})
+		}
+		put(appendHintRecord(buf[:0], rec))
+	}
+	t.events = offset
+	buf = binary.LittleEndian.AppendUint32(buf[:0], uint32(len(t.sparse)))
+	for _, s := range t.sparse {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s.key)))
+		buf = append(buf, s.key...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(s.offset))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.ranges)))
+	for _, r := range t.ranges {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(r.prefix)))
+		buf = append(buf, r.prefix...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(r.offset))
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, t.filter.k)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.filter.bits)))
+	buf = append(buf, t.filter.bits...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(t.end))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(t.events))
+	put(append(buf, segmentIndexMagic[:]...))
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+	if writeErr == nil {
+		writeErr = f.Sync()
+	}
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		_ = os.Remove(t.tmpPath)
+		return nil, fmt.Errorf("failed to write disk index %s: %w", t.tmpPath, writeErr)
+	}
+	return t, nil
+}
+
+// openSegmentTable відкриває файл індексу сегмента розміру size. Повертає
+// errStaleSegmentIndex, якщо файл записано для іншого вмісту сегмента.
+func openSegmentTable(path string, segID int, size int64) (*segmentTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := readSegmentTable(f, segID, size)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	t.path, t.file = path, f
+	return t, nil
+}
+
+func readSegmentTable(f *os.File, segID int, size int64) (*segmentTable, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := stat.Size()
+	if fileSize < segmentIndexHeaderSize+segmentIndexTrailerSize {
+		return nil, errors.New("disk index file is truncated")
+	}
+	var header [segmentIndexHeaderSize]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read disk index header: %w", err)
+	}
+	if [4]byte(header[0:4]) != segmentIndexMagic {
+		return nil, errors.New("invalid disk index magic")
+	}
+	if int64(binary.LittleEndian.Uint64(header[4:12])) != size {
+		return nil, errStaleSegmentIndex
+	}
+	var trailer [segmentIndexTrailerSize]byte
+	if _, err := f.ReadAt(trailer[:], fileSize-segmentIndexTrailerSize); err != nil {
+		return nil, fmt.Errorf("failed to read disk index trailer: %w", err)
+	}
+	if [4]byte(trailer[16:20]) != segmentIndexMagic {
+		return nil, errors.New("disk index file is incomplete")
+	}
+	t := &segmentTable{
+		segID:  segID,
+		end:    int64(binary.LittleEndian.Uint64(trailer[0:8])),
+		events: int64(binary.LittleEndian.Uint64(trailer[8:16])),
+	}
+	metaEnd := fileSize - segmentIndexTrailerSize
+	if t.end < segmentIndexHeaderSize || t.events < t.end || t.events > metaEnd {
+		return nil, errors.New("invalid disk index trailer")
+	}
+	meta := make([]byte, metaEnd-t.events)
+	if _, err := f.ReadAt(meta, t.events); err != nil {
+		return nil, fmt.Errorf("failed to read disk index metadata: %w", err)
+	}
+	r := &byteReader{data: meta}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		key := r.string()
+		t.sparse = append(t.sparse, sparseEntry{key: key, offset: int64(r.uint64())})
+	}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		prefix := r.string()
+		t.ranges = append(t.ranges, prefixDelete{prefix: prefix, offset: int64(r.uint64())})
+	}
+	k := r.uint32()
+	bits := r.take(int(r.uint32()))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if k == 0 || k > 32 || len(bits) == 0 {
+		return nil, fmt.Errorf("invalid disk index bloom filter")
+	}
+	t.filter = &bloomFilter{k: k, bits: bytes.Clone(bits)}
+	return t, nil
+}
+
+// byteReader читає поля метаданих файлу індексу, запам'ятовуючи першу помилку.
+type byteReader struct {
+	data []byte
+	err  error
+}
+
+func (r *byteReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errors.New("disk index metadata is truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *byteReader) uint32() uint32 {
+	if b := r.take(4); r.err == nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *byteReader) uint64() uint64 {
+	if b := r.take(8); r.err == nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *byteReader) string() string {
+	return string(r.take(int(r.uint32())))
+}
+
+// lookup читає блок файлу, в якому може бути ключ.
+func (t *segmentTable) lookup(key string) (tableEntry, bool, error) {
+	if !t.filter.mayContain(key) {
+		return tableEntry{}, false, nil
+	}
+	i := sort.Search(len(t.sparse), func(i int) bool { return t.sparse[i].key > key }) - 1
+	if i < 0 {
+		return tableEntry{}, false, nil
+	}
+	end := t.end
+	if i+1 < len(t.sparse) {
+		end = t.sparse[i+1].offset
+	}
+	block := make([]byte, end-t.sparse[i].offset)
+	if _, err := t.file.ReadAt(block, t.sparse[i].offset); err != nil {
+		return tableEntry{}, false, fmt.Errorf("failed to read disk index of segment %d at offset %d: %w", t.segID, t.sparse[i].offset, err)
+	}
+	r := tableReader{r: bufio.NewReader(bytes.NewReader(block))}
+	for {
+		e, err := r.next()
+		if errors.Is(err, io.EOF) || err == nil && e.key > key {
+			return tableEntry{}, false, nil
+		}
+		if err != nil {
+			return tableEntry{}, false, fmt.Errorf("disk index of segment %d: %w", t.segID, err)
+		}
+		if e.key == key {
+			e.val.segmentID = t.segID
+			return e, true, nil
+		}
+	}
+}
+
+// readEvents читає записи спільних значень, часових рядів і видалень у порядку запису.
+func (t *segmentTable) readEvents() ([]hintRecord, error) {
+	r := bufio.NewReader(io.NewSectionReader(t.file, t.end, t.events-t.end))
+	var events []hintRecord
+	for {
+		rec, err := readHintRecord(r)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("disk index of segment %d: %w", t.segID, err)
+		}
+		events = append(events, rec)
+	}
+}
+
+// tableIter читає записи ключів файлу по порядку.
+type tableIter struct {
+	t    *segmentTable
+	r    tableReader
+	cur  tableEntry
+	done bool
+}
+
+// iter повертає ітератор, що стоїть на першому ключі, не меншому за from.
+func (t *segmentTable) iter(from string) (*tableIter, error) {
+	start := int64(segmentIndexHeaderSize)
+	if i := sort.Search(len(t.sparse), func(i int) bool { return t.sparse[i].key > from }) - 1; i >= 0 {
+		start = t.sparse[i].offset
+	}
+	it := &tableIter{t: t, r: tableReader{r: bufio.NewReader(io.NewSectionReader(t.file, start, t.end-start))}}
+	for {
+		if err := it.advance(); err != nil {
+			return nil, err
+		}
+		if it.done || it.cur.key >= from {
+			return it, nil
+		}
+	}
+}
+
+func (it *tableIter) advance() error {
+	e, err := it.r.next()
+	if errors.Is(err, io.EOF) {
+		it.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("disk index of segment %d: %w", it.t.segID, err)
+	}
+	e.val.segmentID = it.t.segID
+	it.cur = e
+	return nil
+}
+
+type tableReader struct {
+	r *bufio.Reader
+}
+
+func (r tableReader) next() (tableEntry, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.r, lenBuf[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return tableEntry{}, io.EOF
+		}
+		return tableEntry{}, fmt.Errorf("failed to read disk index key length: %w", err)
+	}
+	buf := make([]byte, int(binary.LittleEndian.Uint32(lenBuf[:]))+segmentIndexEntryTail)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return tableEntry{}, fmt.Errorf("failed to read disk index record: %w", err)
+	}
+	n := len(buf) - segmentIndexEntryTail
+	tail := buf[n:]
+	return tableEntry{
+		key:  string(buf[:n]),
+		kind: tail[0],
+		val: indexValue{
+			dataType: tail[1],
+			offset:   int64(binary.LittleEndian.Uint64(tail[2:10])),
+			size:     int64(binary.LittleEndian.Uint32(tail[10:14])),
+		},
+		expiresAt: int64(binary.LittleEndian.Uint64(tail[14:22])),
+	}, nil
+}
+
+// diskIndex - файли індексу запечатаних сегментів. Набір файлів змінюється лише під
+// db.mu, пошук і обхід виконуються конкурентно під власним замком.
+type diskIndex struct {
+	dir      string
+	interval int
+	logger   Logger
+
+	mu     sync.RWMutex
+	tables map[int]*segmentTable
+	// order - файли від найновішого сегмента до найстарішого.
+	order []*segmentTable
+}
+
+func newDiskIndex(dir string, interval int, logger Logger) (*diskIndex, error) {
+	dir = filepath.Join(dir, diskIndexDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create disk index directory: %w", err)
+	}
+	return &diskIndex{dir: dir, interval: interval, logger: logger, tables: make(map[int]*segmentTable)}, nil
+}
+
+// write записує файл індексу сегмента; підключає його install.
+func (d *diskIndex) write(segID int, size int64, entries []tableEntry, events []hintRecord) (*segmentTable, error) {
+	return writeSegmentTable(segmentTablePath(d.dir, segID), segID, size, entries, events, d.interval)
+}
+
+// open відкриває збережений файл індексу сегмента розміру size; підключає його install.
+func (d *diskIndex) open(segID int, size int64) (*segmentTable, error) {
+	return openSegmentTable(segmentTablePath(d.dir, segID), segID, size)
+}
+
+// install прибирає файли індексу сегментів removed і підключає added. Новий файл сегмента
+// займає місце старого лише після закриття старого. Якщо файл не вдалося підключити, він
+// видаляється, а решта підключаються.
+func (d *diskIndex) install(removed []int, added []*segmentTable) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, segID := range removed {
+		d.dropLocked(segID)
+		_ = os.Remove(segmentTablePath(d.dir, segID))
+	}
+	var firstErr error
+	for _, t := range added {
+		d.dropLocked(t.segID)
+		if err := t.activate(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		d.tables[t.segID] = t
+	}
+	d.order = d.order[:0]
+	for _, t := range d.tables {
+		d.order = append(d.order, t)
+	}
+	sort.Slice(d.order, func(i, j int) bool { return d.order[i].segID > d.order[j].segID })
+	return firstErr
+}
+
+func (d *diskIndex) dropLocked(segID int) {
+	if t, ok := d.tables[segID]; ok {
+		_ = t.file.Close()
+		delete(d.tables, segID)
+	}
+}
+
+// activate перейменовує записаний файл на його місце й відкриває його.
+func (t *segmentTable) activate() error {
+	if t.file != nil {
+		return nil
+	}
+	err := fsutil.Rename(t.tmpPath, t.path)
+	if err == nil {
+		t.file, err = os.Open(t.path)
+	}
+	if err != nil {
+		_ = os.Remove(t.tmpPath)
+		_ = os.Remove(t.path)
+		return fmt.Errorf("failed to install disk index %s: %w", t.path, err)
+	}
+	t.tmpPath = ""
+	return nil
+}
+
+// get шукає останній запис ключа у файлах, від найновішого сегмента.
+func (d *diskIndex) get(key string) (tableEntry, bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.order {
+		e, ok, err := t.lookup(key)
+		if err != nil {
+			return tableEntry{}, false, err
+		}
+		if ok {
+			if e.kind == dataTypeTombstone || d.prefixDeletedLocked(key, e.val) {
+				return tableEntry{}, false, nil
+			}
+			return e, true, nil
+		}
+	}
+	return tableEntry{}, false, nil
+}
+
+// mayContain повідомляє, чи може ключ бути в якомусь файлі.
+func (d *diskIndex) mayContain(key string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.order {
+		if t.filter.mayContain(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixDeletedLocked повідомляє, чи видаляє запис ключа val новіше видалення префікса.
+// Викликається під d.mu.
+func (d *diskIndex) prefixDeletedLocked(key string, val indexValue) bool {
+	for _, t := range d.order {
+		if t.segID < val.segmentID {
+			return false
+		}
+		for _, r := range t.ranges {
+			if (t.segID > val.segmentID || r.offset > val.offset) && strings.HasPrefix(key, r.prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ascend обходить живі ключі файлів, не менші за from, у порядку зростання, доки fn
+// повертає true; для кожного ключа береться запис найновішого сегмента. Набір файлів
+// змінюється лише під db.mu, тож під db.mu fn може звертатися до індексу.
+func (d *diskIndex) ascend(from string, fn func(tableEntry) bool) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	iters := make([]*tableIter, 0, len(d.order))
+	for _, t := range d.order {
+		it, err := t.iter(from)
+		if err != nil {
+			return err
+		}
+		if !it.done {
+			iters = append(iters, it)
+		}
+	}
+	for len(iters) > 0 {
+		// Ітератори впорядковані від найновішого сегмента, тож серед рівних ключів
+		// обирається найновіший запис.
+		best := 0
+		for i := 1; i < len(iters); i++ {
+			if iters[i].cur.key < iters[best].cur.key {
+				best = i
+			}
+		}
+		e := iters[best].cur
+		live := e.kind != dataTypeTombstone && !d.prefixDeletedLocked(e.key, e.val)
+		next := iters[:0]
+		for _, it := range iters {
+			if it.cur.key == e.key {
+				if err := it.advance(); err != nil {
+					return err
+				}
+			}
+			if !it.done {
+				next = append(next, it)
+			}
+		}
+		iters = next
+		if live && !fn(e) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// removeStale видаляє файли індексу сегментів, що не підключені, зокрема незавершені.
+func (d *diskIndex) removeStale() {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		d.logger.Warnf("disk index: %v", err)
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	used := make(map[string]bool, len(d.tables))
+	for _, t := range d.tables {
+		used[filepath.Base(t.path)] = true
+	}
+	for _, e := range entries {
+		if !used[e.Name()] {
+			if err := os.RemoveAll(filepath.Join(d.dir, e.Name())); err != nil {
+				d.logger.Warnf("disk index: failed to remove stale file %s: %v", e.Name(), err)
+			}
+		}
+	}
+}
+
+// close закриває файли індексу. Самі файли лишаються для наступного відкриття.
+func (d *diskIndex) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var err error
+	for _, t := range d.tables {
+		if closeErr := t.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	d.tables = make(map[int]*segmentTable)
+	d.order = nil
+	return err
+}
+
+// writeSegmentTableLocked записує файл індексу сегмента за його записами в порядку запису.
+// Записи посилань і термінів дії читаються з сегмента. Викликається під db.mu.
+func (db *Db) writeSegmentTableLocked(segID int, size int64, records []hintRecord) (*segmentTable, error) {
+	last := make(map[string]int)
+	var entries []tableEntry
+	var events []hintRecord
+	for _, rec := range records {
+		val := indexValue{segmentID: segID, offset: rec.offset, size: rec.size, dataType: rec.dataType}
+		switch rec.dataType {
+		case dataTypeExpiry:
+			i, ok := last[rec.key]
+			if !ok || entries[i].kind == dataTypeTombstone {
+				continue
+			}
+			expiresAt, err := db.readExpiryLocked(segID, rec)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring expiry record: %v", err)
+				continue
+			}
+			entries[i].expiresAt = expiresAt
+			continue
+		case dataTypeBlob, DataTypeSeries, dataTypeRangeTombstone:
+			events = append(events, rec)
+			continue
+		case dataTypeTombstone:
+			events = append(events, rec)
+		case dataTypeRef, dataTypeChunked:
+			record, err := db.readRefLocked(segID, rec)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring value reference: %v", err)
+				continue
+			}
+			_, val.dataType = record.blobRefs()
+		}
+		e := tableEntry{key: rec.key, kind: rec.dataType, val: val}
+		if i, ok := last[rec.key]; ok {
+			entries[i] = e
+			continue
+		}
+		last[rec.key] = len(entries)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return db.currentIndex.disk.write(segID, size, entries, events)
+}
+
+// indexSegmentRecordsLocked застосовує записи сегмента до індексу, а з DiskIndex записує
+// за ними файл індексу сегмента. Викликається під db.mu під час відкриття.
+func (db *Db) indexSegmentRecordsLocked(segID int, size int64, records []hintRecord) error {
+	if db.currentIndex.disk == nil {
+		db.applyHintRecords(segID, records)
+		return nil
+	}
+	t, err := db.writeSegmentTableLocked(segID, size, records)
+	if err == nil {
+		err = db.currentIndex.disk.install(nil, []*segmentTable{t})
+	}
+	if err != nil {
+		return err
+	}
+	db.applySegmentEventsLocked(segID, records)
+	return nil
+}
+
+// loadSegmentTableLocked підключає збережений файл індексу сегмента розміру size і
+// відтворює з нього часові ряди та спільні значення. Повертає false, якщо файлу немає
+// або він не підходить: тоді файл будується заново. Викликається під db.mu.
+func (db *Db) loadSegmentTableLocked(segID int, size int64) bool {
+	t, err := db.currentIndex.disk.open(segID, size)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, errStaleSegmentIndex) {
+			db.opts.Logger.Warnf("rebuilding disk index of segment %d: %v", segID, err)
+		}
+		return false
+	}
+	events, err := t.readEvents()
+	if err == nil {
+		err = db.currentIndex.disk.install(nil, []*segmentTable{t})
+	}
+	if err != nil {
+		_ = t.file.Close()
+		db.opts.Logger.Warnf("rebuilding disk index of segment %d: %v", segID, err)
+		return false
+	}
+	db.applySegmentEventsLocked(segID, events)
+	return true
+}
+
+// applySegmentEventsLocked відтворює з записів сегмента спільні значення та часові ряди;
+// розташування ключів значень з DiskIndex беруться з файлів індексу. Викликається під db.mu.
+func (db *Db) applySegmentEventsLocked(segID int, records []hintRecord) {
+	for _, rec := range records {
+		switch rec.dataType {
+		case dataTypeTombstone:
+			delete(db.seriesIndex, rec.key)
+		case dataTypeRangeTombstone:
+			for _, key := range db.seriesKeysWithPrefixLocked(rec.key) {
+				delete(db.seriesIndex, key)
+			}
+		case dataTypeBlob:
+			h, err := parseBlobHash(rec.key)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring shared value record: %v", err)
+				continue
+			}
+			db.blobs.setLocation(h, indexValue{segmentID: segID, offset: rec.offset, size: rec.size, dataType: rec.dataType})
+		case DataTypeSeries:
+			db.seriesIndex[rec.key] = append(db.seriesIndex[rec.key], indexValue{segmentID: segID, offset: rec.offset, size: rec.size, dataType: rec.dataType})
+		}
+	}
+}
+
+// resolveDiskIndexLocked після завантаження файлів індексу рахує живі ключі та відновлює
+// їх терміни дії й посилання на спільні значення. Викликається під db.mu.
+func (db *Db) resolveDiskIndexLocked() error {
+	var n int64
+	err := db.currentIndex.disk.ascend("", func(e tableEntry) bool {
+		n++
+		if e.expiresAt != 0 {
+			db.expiries[e.key] = e.expiresAt
+		}
+		if e.kind == dataTypeRef || e.kind == dataTypeChunked {
+			rec := hintRecord{key: e.key, offset: e.val.offset, size: e.val.size, dataType: e.kind}
+			record, err := db.readRefLocked(e.val.segmentID, rec)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring value reference: %v", err)
+				return true
+			}
+			hashes, _ := record.blobRefs()
+			db.blobs.setRefs(e.key, e.kind, hashes)
+		}
+		return true
+	})
+	db.currentIndex.n.Store(n)
+	return err
+}
+
+// sealSegmentTableLocked записує файл індексу щойно запечатаного сегмента. Помилка лише
+// журналюється: розташування ключів сегмента тоді лишаються в пам'яті. Викликається під db.mu.
+func (db *Db) sealSegmentTableLocked(segID int, size int64, records []hintRecord) {
+	if db.currentIndex.disk == nil {
+		return
+	}
+	t, err := db.writeSegmentTableLocked(segID, size, records)
+	if err == nil {
+		err = db.currentIndex.disk.install(nil, []*segmentTable{t})
+	}
+	if err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+}
+
+// dropMergedTablesLocked переносить у пам'ять розташування ключів, які злиття переносить
+// або видаляє, і прибирає файли індексу сегментів плану ще до заміни файлів сегментів,
+// щоб після збою не лишився файл індексу старого вмісту сегмента. Викликається під db.mu.
+func (db *Db) dropMergedTablesLocked(plan *mergePlan) error {
+	if db.currentIndex.disk == nil {
+		return nil
+	}
+	for key := range plan.keys {
+		if err := db.currentIndex.pin(key); err != nil {
+			return err
+		}
+	}
+	for key := range plan.purged {
+		if err := db.currentIndex.pin(key); err != nil {
+			return err
+		}
+	}
+	return db.currentIndex.disk.install(plan.segmentIDs, nil)
+}
+
+// writeMergedTablesLocked записує файли індексу вихідних сегментів злиття. Помилка лише
+// журналюється: розташування ключів сегмента тоді лишаються в пам'яті. Викликається під db.mu.
+func (db *Db) writeMergedTablesLocked(outputs []*mergeOutput) {
+	if db.currentIndex.disk == nil {
+		return
+	}
+	var tables []*segmentTable
+	for _, out := range outputs {
+		t, err := db.writeSegmentTableLocked(out.segID, out.size, out.hints)
+		if err != nil {
+			db.opts.Logger.Warnf("merge: %v", err)
+			continue
+		}
+		tables = append(tables, t)
+	}
+	if err := db.currentIndex.disk.install(nil, tables); err != nil {
+		db.opts.Logger.Warnf("merge: %v", err)
+	}
+}
+
+// spillIndexLocked прибирає з пам'яті записи індексу, які файли індексу сегментів уже
+// повертають так само. Помилка лише журналюється: записи тоді лишаються в пам'яті.
+// Викликається під db.mu.
+func (db *Db) spillIndexLocked() {
+	if db.currentIndex.disk == nil {
+		return
+	}
+	active := func(val indexValue) bool {
+		sh := db.activeShardLocked(val.segmentID)
+		return sh != nil && sh.segment != nil
+	}
+	if err := db.currentIndex.spill(active); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func diskIndexOptions() Options {
+	opts := testOptions(true)
+	opts.DiskIndex = true
+	opts.DiskIndexSparseInterval = 4
+	return opts
+}
+
+// inMemoryEntries повертає кількість записів індексу, що лишилися в пам'яті.
+func inMemoryEntries(db *Db) int {
+	n := 0
+	for i := range db.currentIndex.shards {
+		s := &db.currentIndex.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// segmentTableFiles повертає стан файлів індексу сегментів за шляхом.
+func segmentTableFiles(t *testing.T, dir string) map[string]os.FileInfo {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, diskIndexDirName, segmentIndexFileNamePrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]os.FileInfo, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[path] = stat
+	}
+	return files
+}
+
+func TestDb_DiskIndex(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, diskIndexOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := strings.Repeat("d", 50)
+	for i := 0; i < 200; i++ {
+		if err := db.Put(fmt.Sprintf("key%03d", i), fmt.Sprintf("%d %s", i, padding)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i += 10 {
+		if err := db.Delete(fmt.Sprintf("key%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("key005", "overwritten"); err != nil {
+		t.Fatal(err)
+	}
+	if n := inMemoryEntries(db); n >= 100 {
+		t.Errorf("%d of 180 index entries are kept in memory", n)
+	}
+	if len(db.sortedKeys) != 0 {
+		t.Errorf("key list with %d keys is kept in memory", len(db.sortedKeys))
+	}
+	if len(segmentTableFiles(t, dir)) == 0 {
+		t.Fatal("segment index files were not written")
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if stats, err := db.Stats(); err != nil || stats.KeyCount != 180 {
+			t.Errorf("%s: KeyCount = %d, %v", stage, stats.KeyCount, err)
+		}
+		if keys := db.Keys(); len(keys) != 180 || keys[0] != "key001" || keys[179] != "key199" {
+			t.Errorf("%s: Keys returned %d keys", stage, len(keys))
+		}
+		if keys := db.KeysWithPrefix("key19"); len(keys) != 9 || keys[0] != "key191" {
+			t.Errorf("%s: KeysWithPrefix(key19) = %v", stage, keys)
+		}
+		if keys := db.Range("key050", "key060", 0); len(keys) != 9 || keys[0] != "key051" {
+			t.Errorf("%s: Range(key050, key060) = %v", stage, keys)
+		}
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("key%03d", i)
+			got, err := db.Get(key)
+			switch {
+			case i%10 == 0:
+				if err != ErrNotFound {
+					t.Errorf("%s: deleted key %s = %.10q, %v", stage, key, got, err)
+				}
+			case i == 5:
+				if got != "overwritten" {
+					t.Errorf("%s: Get(%s) = %q, %v", stage, key, got, err)
+				}
+			case err != nil || !strings.HasPrefix(got, fmt.Sprintf("%d ", i)):
+				t.Errorf("%s: Get(%s) = %.10q, %v", stage, key, got, err)
+			}
+		}
+	}
+	check("before merge")
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check("after merge")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before := segmentTableFiles(t, dir)
+	if len(before) == 0 {
+		t.Fatal("segment index files were removed on close")
+	}
+
+	db, err = NewDbWithOptions(dir, diskIndexOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+	after := segmentTableFiles(t, dir)
+	for path, stat := range before {
+		if reopened, ok := after[path]; !ok || !os.SameFile(stat, reopened) {
+			t.Errorf("segment index file %s was rewritten on reopen", filepath.Base(path))
+		}
+	}
+	if n := inMemoryEntries(db); n >= 50 {
+		t.Errorf("%d index entries are in memory after reopen", n)
+	}
+}
+
+func TestDb_DiskIndexReadError(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), diskIndexOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%03d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := db.currentIndex.disk
+	d.mu.RLock()
+	for _, table := range d.order {
+		table.file.Close()
+	}
+	d.mu.RUnlock()
+	if _, err := db.Get("key001"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with unreadable index file = %v, want read error", err)
+	}
+	if _, err := db.GetByPrefix("key"); err == nil {
+		t.Error("GetByPrefix with unreadable index file succeeded")
+	}
+}
+
+func TestDb_DiskIndexNewKeysSkipFiles(t *testing.T) {
+	logger := &recordingLogger{}
+	opts := diskIndexOptions()
+	opts.Logger = logger
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%03d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Поки файли індексу підмінено закритими, кожне читання блоку завершується помилкою
+	// в журналі.
+	d := db.currentIndex.disk
+	d.mu.Lock()
+	files := make(map[*segmentTable]*os.File, len(d.order))
+	for _, table := range d.order {
+		closed, err := os.Open(table.path)
+		if err != nil {
+			d.mu.Unlock()
+			t.Fatal(err)
+		}
+		closed.Close()
+		files[table] = table.file
+		table.file = closed
+	}
+	d.mu.Unlock()
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("new%03d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.mu.Lock()
+	for table, file := range files {
+		table.file = file
+	}
+	d.mu.Unlock()
+	if logger.contains("ERROR disk index") {
+		t.Error("puts of new keys read the disk index files")
+	}
+	if stats, err := db.Stats(); err != nil || stats.KeyCount != 110 {
+		t.Errorf("Stats().KeyCount = %d, %v", stats.KeyCount, err)
+	}
+}
+
+func TestDb_DiskIndexPrefixDeleteAndTTL(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, diskIndexOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 60; i++ {
+		for _, prefix := range []string{"a/", "b/"} {
+			if err := db.Put(fmt.Sprintf("%s%02d", prefix, i), "value"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Copy("b/00", "ttl", CopyOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.DeletePrefix("a/"); err != nil || n != 60 {
+		t.Fatalf("DeletePrefix(a/) = %d, %v", n, err)
+	}
+	// Ключі, записані після видалення префікса, лишаються.
+	if err := db.Put("a/new", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if keys := db.KeysWithPrefix("a/"); len(keys) != 1 || keys[0] != "a/new" {
+			t.Errorf("%s: KeysWithPrefix(a/) = %v", stage, keys)
+		}
+		if _, err := db.Get("a/01"); err != ErrNotFound {
+			t.Errorf("%s: Get(a/01) = %v, want ErrNotFound", stage, err)
+		}
+		if keys := db.KeysWithPrefix("b/"); len(keys) != 60 {
+			t.Errorf("%s: KeysWithPrefix(b/) returned %d keys", stage, len(keys))
+		}
+		if _, ok := db.ExpiresAt("ttl"); !ok {
+			t.Errorf("%s: ttl key lost its expiry", stage)
+		}
+		if stats, err := db.Stats(); err != nil || stats.KeyCount != 62 {
+			t.Errorf("%s: KeyCount = %d, %v", stage, stats.KeyCount, err)
+		}
+	}
+	check("before reopen")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, diskIndexOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check("after merge")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDb_DiskIndexRejectsKeyStateOptions(t *testing.T) {
+	opts := diskIndexOptions()
+	opts.KeyVersions = 2
+	if db, err := NewDbWithOptions(t.TempDir(), opts); err == nil {
+		db.Close()
+		t.Error("DiskIndex combined with KeyVersions was accepted")
+	}
+}
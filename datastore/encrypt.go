@@ -0,0 +1,315 @@
+package datastore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Значення записів можна шифрувати AES-GCM (Options.EncryptionKey або Options.KeyProvider).
+// Шифрується значення разом з його типом у сховищі (зокрема стиснене значення), а ключ
+// запису, час, номер і тип значення для індексу залишаються відкритими: індекс, злиття
+// та перевірка сегментів працюють без ключів. Записи без значень (видалення, терміни дії),
+// посилання на спільні значення та списки частин не шифруються - вони містять лише хеші.
+//
+// Зашифровані й відкриті записи можуть бути в одній базі: після ввімкнення шифрування нові
+// записи шифруються, а злиття шифрує старі. Так само злиття перешифровує поточним ключем
+// записи, зашифровані іншими ключами провайдера, тож після злиття старий ключ можна прибрати.
+//
+// Зашифроване значення (тип запису dataTypeEncrypted) має вигляд:
+// [версія формату (byte)]                  - 1 байт
+// [тип значення (byte)]                    - 1 байт, тип для індексу
+// [довжина ідентифікатора ключа (byte)]    - 1 байт
+// [ідентифікатор ключа]                    - змінна довжина
+// [nonce]                                  - 12 байтів
+// [шифротекст]                             - AES-GCM від [тип запису (byte)][значення]
+//
+// Ключ запису передається AES-GCM як додаткові дані, тож значення не можна перенести до іншого ключа.
+const encryptedFormatV1 byte = 1
+
+// ErrNoEncryptionKey повертається при читанні значення, зашифрованого ключем, якого немає в базі.
+var ErrNoEncryptionKey = errors.New("value is encrypted with an unavailable key")
+
+// KeyProvider повертає ключі шифрування за їх ідентифікаторами та ідентифікатор поточного
+// ключа, яким шифруються нові записи. Ключі читаються один раз при відкритті бази.
+type KeyProvider interface {
+	EncryptionKeys() (current string, keys map[string][]byte, err error)
+}
+
+// StaticKeys - KeyProvider з ключами, заданими в конфігурації.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) EncryptionKeys() (string, map[string][]byte, error) {
+	return k.Current, k.Keys, nil
+}
+
+// KeyFunc - KeyProvider, що отримує ключі викликом функції, напр. із KMS.
+type KeyFunc func() (current string, keys map[string][]byte, err error)
+
+func (f KeyFunc) EncryptionKeys() (string, map[string][]byte, error) {
+	return f()
+}
+
+// ParseKeys розбирає ключі у форматі "id1:base64,id2:base64" (коми можна замінити
+// переносами рядків). Поточним стає останній ключ у списку.
+func ParseKeys(spec string) (StaticKeys, error) {
+	keys := StaticKeys{Keys: make(map[string][]byte)}
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || id == "" {
+			return StaticKeys{}, fmt.Errorf("encryption key %q must be in the form id:base64", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return StaticKeys{}, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		keys.Keys[id] = key
+		keys.Current = id
+	}
+	if len(keys.Keys) == 0 {
+		return StaticKeys{}, errors.New("no encryption keys given")
+	}
+	return keys, nil
+}
+
+// KeysFromEnv повертає KeyProvider з ключами зі змінної середовища name, див. ParseKeys.
+func KeysFromEnv(name string) KeyProvider {
+	return KeyFunc(func() (string, map[string][]byte, error) {
+		keys, err := ParseKeys(os.Getenv(name))
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return keys.EncryptionKeys()
+	})
+}
+
+// KeysFromFile повертає KeyProvider з ключами з файлу path (по ключу id:base64 на рядок,
+// рядки з # пропускаються), див. ParseKeys.
+func KeysFromFile(path string) KeyProvider {
+	return KeyFunc(func() (string, map[string][]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read encryption keys: %w", err)
+		}
+		keys, err := ParseKeys(string(data))
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return keys.EncryptionKeys()
+	})
+}
+
+// keyring - ключі бази, готові до шифрування. nil означає, що шифрування вимкнене.
+type keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// newKeyring читає ключі з налаштувань. Повертає nil, якщо шифрування не налаштоване.
+func newKeyring(opts Options) (*keyring, error) {
+	provider := opts.KeyProvider
+	if provider == nil {
+		if opts.EncryptionKey == nil {
+			return nil, nil
+		}
+		provider = StaticKeys{Current: "default", Keys: map[string][]byte{"default": opts.EncryptionKey}}
+	}
+	current, keys, err := provider.EncryptionKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	k := &keyring{current: current, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		if k.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+	}
+	if _, ok := k.aeads[current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not among the keys", current)
+	}
+	return k, nil
+}
+
+// seal шифрує значення закодованого запису, якщо шифрування ввімкнене.
+func (db *Db) seal(data []byte) ([]byte, error) {
+	if db.keys == nil || data == nil {
+		return data, nil
+	}
+	return db.keys.seal(data)
+}
+
+// reseal готує запис до злиття, якщо шифрування ввімкнене, див. keyring.reseal.
+// Без ключів записи, зокрема зашифровані, переносяться як є.
+func (db *Db) reseal(data []byte) ([]byte, error) {
+	if db.keys == nil {
+		return data, nil
+	}
+	return db.keys.reseal(data)
+}
+
+// currentID повертає ідентифікатор поточного ключа або "", якщо шифрування вимкнене.
+func (k *keyring) currentID() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// needsEncryptionLocked повідомляє, чи можуть у запечатаному сегменті бути значення,
+// не зашифровані поточним ключем. Без шифрування завжди false. Викликається під db.mu.
+func (db *Db) needsEncryptionLocked(segID int) bool {
+	return db.keys != nil && db.manifest.encryptionKey(segID) != db.keys.current
+}
+
+// sealable повідомляє, чи шифрується значення запису типу dataType.
+func sealable(dataType byte) bool {
+	switch dataType {
+	case DataTypeString, DataTypeInt64, DataTypeSeries, DataTypeFloat64, DataTypeBool, DataTypeBytes, DataTypeJSON,
+		dataTypeBlob, dataTypeCompressed:
+		return true
+	}
+	return false
+}
+
+// seal шифрує значення закодованого запису поточного формату поточним ключем.
+// Запис, значення якого не шифрується або вже зашифроване, повертається як є.
+func (k *keyring) seal(data []byte) ([]byte, error) {
+	rec, err := splitRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sealable(rec.dataType) {
+		return data, nil
+	}
+	indexType := rec.dataType
+	if rec.dataType == dataTypeCompressed {
+		if len(rec.value) < compressedHeaderLength {
+			return nil, fmt.Errorf("compressed value too short: %d bytes", len(rec.value))
+		}
+		indexType = rec.value[2]
+	}
+	aead := k.aeads[k.current]
+	header := make([]byte, 0, 3+len(k.current)+aead.NonceSize())
+	header = append(header, encryptedFormatV1, indexType, byte(len(k.current)))
+	header = append(header, k.current...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	plain := make([]byte, 0, 1+len(rec.value))
+	plain = append(append(plain, rec.dataType), rec.value...)
+	sealed := aead.Seal(append(header, nonce...), nonce, plain, []byte(rec.key))
+	return encodeRecord(rec.key, dataTypeEncrypted, rec.header.timestamp, rec.header.seq, sealed), nil
+}
+
+// reseal готує запис поточного формату до злиття: шифрує відкрите значення і перешифровує
+// значення, зашифроване не поточним ключем.
+func (k *keyring) reseal(data []byte) ([]byte, error) {
+	rec, err := splitRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	if rec.dataType != dataTypeEncrypted {
+		return k.seal(data)
+	}
+	sealed, err := parseSealed(rec.value)
+	if err != nil {
+		return nil, err
+	}
+	if sealed.keyID == k.current {
+		return data, nil
+	}
+	dataType, value, err := k.open(rec.key, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return k.seal(encodeRecord(rec.key, dataType, rec.header.timestamp, rec.header.seq, value))
+}
+
+// sealedValue - розібране зашифроване значення.
+type sealedValue struct {
+	indexType  byte
+	keyID      string
+	nonce      []byte
+	ciphertext []byte
+}
+
+func parseSealed(data []byte) (sealedValue, error) {
+	if len(data) < 3 {
+		return sealedValue{}, fmt.Errorf("encrypted value too short: %d bytes", len(data))
+	}
+	if data[0] != encryptedFormatV1 {
+		return sealedValue{}, fmt.Errorf("unsupported encrypted value format version %d", data[0])
+	}
+	idEnd := 3 + int(data[2])
+	if len(data) < idEnd {
+		return sealedValue{}, fmt.Errorf("encrypted value too short for key id: %d bytes", len(data))
+	}
+	return sealedValue{indexType: data[1], keyID: string(data[3:idEnd]), ciphertext: data[idEnd:]}, nil
+}
+
+// open розшифровує значення запису key і повертає його тип у сховищі та вміст.
+func (k *keyring) open(key string, sealed sealedValue) (byte, []byte, error) {
+	if k == nil {
+		return 0, nil, fmt.Errorf("%w: key id %q, encryption is not configured", ErrNoEncryptionKey, sealed.keyID)
+	}
+	aead, ok := k.aeads[sealed.keyID]
+	if !ok {
+		return 0, nil, fmt.Errorf("%w: key id %q", ErrNoEncryptionKey, sealed.keyID)
+	}
+	if len(sealed.ciphertext) < aead.NonceSize() {
+		return 0, nil, fmt.Errorf("encrypted value of key '%s' is too short", key)
+	}
+	nonce, ciphertext := sealed.ciphertext[:aead.NonceSize()], sealed.ciphertext[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil || len(plain) == 0 {
+		return 0, nil, fmt.Errorf("failed to decrypt value of key '%s' with key %q: corrupted or wrong key", key, sealed.keyID)
+	}
+	return plain[0], plain[1:], nil
+}
+
+// unseal розшифровує значення запису, прочитаного з сегмента. Відкриті записи не змінюються.
+func (k *keyring) unseal(e *entry) error {
+	if e.sealed == nil {
+		return nil
+	}
+	sealed, err := parseSealed(e.sealed)
+	if err != nil {
+		return err
+	}
+	dataType, value, err := k.open(e.key, sealed)
+	if err != nil {
+		return err
+	}
+	if dataType == dataTypeEncrypted {
+		return fmt.Errorf("decrypted value of key '%s' is encrypted again", e.key)
+	}
+	e.sealed = nil
+	e.dataType = dataType
+	if err := e.decodeValue(value); err != nil {
+		return err
+	}
+	if e.dataType != sealed.indexType {
+		return fmt.Errorf("decrypted value of key '%s' has type %d, expected %d", e.key, e.dataType, sealed.indexType)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKeys(ids ...string) StaticKeys {
+	keys := StaticKeys{Keys: make(map[string][]byte)}
+	for _, id := range ids {
+		keys.Keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+		keys.Current = id
+	}
+	return keys
+}
+
+// segmentsContain повідомляє, чи є рядок s у файлах сегментів бази.
+func segmentsContain(t *testing.T, dir, s string) bool {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, outFileNamePrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDb_EncryptedValues(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.KeyProvider = testKeys("k1")
+	opts.Compression = CompressionSnappy
+	opts.CompressionThreshold = 16
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("secret compressible value ", 10)
+	if err := db.Put("plain", "top secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("long", long); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutFloat64("ratio", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBytes("raw", []byte("secret bytes")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 10}, SeriesPoint{Timestamp: 2, Value: 20}); err != nil {
+		t.Fatal(err)
+	}
+	check := func(db *Db) {
+		t.Helper()
+		if v, err := db.Get("plain"); err != nil || v != "top secret" {
+			t.Errorf("Get(plain) = %q, %v", v, err)
+		}
+		if v, err := db.Get("long"); err != nil || v != long {
+			t.Errorf("Get(long) = %q, %v", v, err)
+		}
+		if v, err := db.GetInt64("counter"); err != nil || v != 42 {
+			t.Errorf("GetInt64(counter) = %d, %v", v, err)
+		}
+		if v, err := db.GetFloat64("ratio"); err != nil || v != 0.5 {
+			t.Errorf("GetFloat64(ratio) = %v, %v", v, err)
+		}
+		if v, err := db.GetBytes("raw"); err != nil || string(v) != "secret bytes" {
+			t.Errorf("GetBytes(raw) = %q, %v", v, err)
+		}
+		if points, err := db.GetSeries("series", 0, 10); err != nil || len(points) != 2 || points[1].Value != 20 {
+			t.Errorf("GetSeries(series) = %v, %v", points, err)
+		}
+	}
+	check(db)
+	if segmentsContain(t, dir, "top secret") || segmentsContain(t, dir, "secret bytes") {
+		t.Error("plaintext value found in segment files")
+	}
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+
+	// Без ключа ключі й типи доступні, а значення - ні.
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("plain"); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Get without keys: %v, want ErrNoEncryptionKey", err)
+	}
+	if _, err := db.GetInt64("counter"); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("GetInt64 without keys: %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+func TestDb_MigrateEncryption(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("old", "old plaintext"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Ввімкнення шифрування: старі записи читаються, нові шифруються.
+	opts := testOptions(true)
+	opts.KeyProvider = testKeys("k1")
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("new", "new value"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("old"); err != nil || v != "old plaintext" {
+		t.Errorf("Get of plain entry = %q, %v", v, err)
+	}
+	if stats, _ := db.Stats(); stats.UnencryptedSegments != 1 {
+		t.Errorf("UnencryptedSegments = %d before migration, want 1", stats.UnencryptedSegments)
+	}
+	report, err := db.MigrateEncryption(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SegmentsMerged == 0 {
+		t.Error("MigrateEncryption did not merge any segments")
+	}
+	if stats, _ := db.Stats(); stats.UnencryptedSegments != 0 {
+		t.Errorf("UnencryptedSegments = %d after migration, want 0", stats.UnencryptedSegments)
+	}
+	db.Close()
+	if segmentsContain(t, dir, "old plaintext") {
+		t.Error("plaintext value left in segment files after migration")
+	}
+
+	// Ротація: після злиття з новим поточним ключем старий ключ більше не потрібен.
+	opts.KeyProvider = testKeys("k1", "k2")
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := db.Stats(); stats.UnencryptedSegments == 0 {
+		t.Error("segments encrypted with a previous key are not reported")
+	}
+	if _, err := db.MigrateEncryption(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	opts.KeyProvider = testKeys("k2")
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for key, want := range map[string]string{"old": "old plaintext", "new": "new value"} {
+		if v, err := db.Get(key); err != nil || v != want {
+			t.Errorf("Get(%s) after key rotation = %q, %v", key, v, err)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("# old key\nk1:" + strings.Repeat("A", 43) + "=\nk2:" + strings.Repeat("B", 43) + "=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Current != "k2" || len(keys.Keys) != 2 || len(keys.Keys["k1"]) != 32 {
+		t.Errorf("ParseKeys = %+v", keys)
+	}
+	for _, spec := range []string{"", "k1", ":AAAA", "k1:not base64!"} {
+		if _, err := ParseKeys(spec); err == nil {
+			t.Errorf("ParseKeys(%q) succeeded, want error", spec)
+		}
+	}
+	if _, err := NewDbWithOptions(t.TempDir(), Options{EncryptionKey: []byte("short")}); err == nil {
+		t.Error("NewDbWithOptions accepted an invalid AES key")
+	}
+}
@@ -14,95 +14,302 @@ const (
 	DataTypeString byte = 0
 	// DataTypeInt64 позначає, що значення є int64.
 	DataTypeInt64 byte = 1
+	// DataTypeSeries позначає блок точок часового ряду. Один ключ може мати багато таких блоків.
+	DataTypeSeries byte = 2
+	// DataTypeFloat64 позначає, що значення є float64.
+	DataTypeFloat64 byte = 3
+	// DataTypeBool позначає, що значення є bool.
+	DataTypeBool byte = 4
+	// DataTypeBytes позначає довільну послідовність байтів.
+	DataTypeBytes byte = 5
+	// DataTypeJSON позначає JSON-документ, див. json.go.
+	DataTypeJSON byte = 6
+
+	// dataTypeEncrypted позначає запис із зашифрованим значенням, див. encrypt.go.
+	dataTypeEncrypted byte = 0xF8
+	// dataTypeRangeTombstone позначає видалення всіх ключів з префіксом, що є ключем запису,
+	// записаних раніше за нього, див. rangetombstone.go. Такий запис не має значення.
+	dataTypeRangeTombstone byte = 0xF9
+	// dataTypeChunked - значення, більше за сегмент, збережене частинами dataTypeBlob, див. chunk.go.
+	dataTypeChunked byte = 0xFA
+	// dataTypeBlob - спільне значення, на яке посилаються записи dataTypeRef, див. dedup.go.
+	dataTypeBlob byte = 0xFB
+	// dataTypeRef - рядкове значення ключа, збережене як посилання на dataTypeBlob.
+	dataTypeRef byte = 0xFC
+	// dataTypeCompressed позначає запис зі стисненим значенням, див. compress.go.
+	dataTypeCompressed byte = 0xFD
+	// dataTypeExpiry задає час закінчення терміну дії ключа (Unix, нс) для значення,
+	// записаного безпосередньо перед ним.
+	dataTypeExpiry byte = 0xFE
+	// dataTypeTombstone позначає видалений ключ. Такий запис не має значення.
+	dataTypeTombstone byte = 0xFF
+)
+
+const (
+	// entryFormatV1 - початковий формат запису, без байта версії.
+	entryFormatV1 byte = 1
+	// entryFormatV2 додає байт версії одразу після розміру запису.
+	entryFormatV2 byte = 2
+	// entryFormatV3 додає час запису після байта версії.
+	entryFormatV3 byte = 3
+	// entryFormatV4 додає номер запису в послідовності після часу запису, див. changes.go.
+	entryFormatV4 byte = 4
+	// entryFormatCurrent - формат, у якому пишуться нові записи.
+	entryFormatCurrent = entryFormatV4
+
+	// entryVersionedFlag - старший біт поля розміру, що позначає запис з байтом версії.
+	// Записи v1 такого розміру не бувають, тож у них цей біт завжди нульовий.
+	entryVersionedFlag uint32 = 1 << 31
 )
 
 // entry представляє один запис в базі даних.
 type entry struct {
-	key      string
-	value    string // Використовується, якщо dataType == DataTypeString
-	valueInt int64  // Використовується, якщо dataType == DataTypeInt64
-	dataType byte   // Тип збереженого значення
+	key       string
+	value     string        // DataTypeString, DataTypeBytes та DataTypeJSON
+	valueInt  int64         // DataTypeInt64 та dataTypeExpiry; біти float64 для DataTypeFloat64; 0 або 1 для DataTypeBool
+	points    []SeriesPoint // Використовується, якщо dataType == DataTypeSeries
+	ref       blobHash      // Використовується, якщо dataType == dataTypeRef
+	chunks    []blobHash    // Частини значення, якщо dataType == dataTypeChunked
+	chunkType byte          // Тип значення, збереженого частинами
+	dataType  byte          // Тип збереженого значення
+	timestamp int64         // Час запису (Unix, нс); 0, якщо невідомий (старі формати, записи терміну дії)
+	seq       uint64        // Номер запису в послідовності; 0 для старих форматів, спільних значень і термінів дії
+	format    byte          // Формат, у якому запис прочитано з файлу
+	sealed    []byte        // Зашифроване значення, ще не розшифроване (див. keyring.unseal); dataType - тип для індексу
 }
 
-// Формат запису в файлі:
-// [загальний розмір запису (uint32)] - 4 байти
+// Формат запису в файлі (v4):
+// [загальний розмір запису (uint32)] - 4 байти, старший біт - entryVersionedFlag
+// [версія формату (byte)]            - 1 байт
+// [час запису (int64, Unix нс)]      - 8 байтів
+// [номер запису (uint64)]            - 8 байтів
 // [довжина ключа (uint32)]           - 4 байти
 // [ключ (string)]                     - змінна довжина
 // [тип даних (byte)]                  - 1 байт
 // [довжина значення (uint32)]         - 4 байти
 // [значення (bytes)]                  - змінна довжина
+//
+// Запис v1 не має байта версії та прапорця в розмірі, запис v2 - часу запису, запис v3 - номера
+// запису. Такі записи читаються як і раніше, а злиття переписує їх у поточному форматі
+// з нульовими часом (для v1 і v2) та номером (див. Db.MigrateFormat).
 
 // Encode серіалізує запис у байтовий зріз.
 func (e *entry) Encode() []byte {
-	kl := len(e.key)
-	var vl int
-	var valueBytes []byte
+	return encodeRecord(e.key, e.dataType, e.timestamp, e.seq, e.valueBytes())
+}
 
+// EncodeCompressed серіалізує запис, стискаючи рядкове, байтове або JSON-значення алгоритмом c, якщо значення
+// не коротше за threshold байтів і стиснення зменшує його розмір.
+func (e *entry) EncodeCompressed(c Compression, threshold int) []byte {
+	valueBytes := e.valueBytes()
+	if c == CompressionNone || !compressible(e.dataType) || len(valueBytes) < threshold {
+		return encodeRecord(e.key, e.dataType, e.timestamp, e.seq, valueBytes)
+	}
+	compressed, ok := compressValue(c, e.dataType, valueBytes)
+	if !ok {
+		return encodeRecord(e.key, e.dataType, e.timestamp, e.seq, valueBytes)
+	}
+	return encodeRecord(e.key, dataTypeCompressed, e.timestamp, e.seq, compressed)
+}
+
+func (e *entry) valueBytes() []byte {
 	switch e.dataType {
-	case DataTypeString:
-		valueBytes = []byte(e.value)
-		vl = len(valueBytes)
-	case DataTypeInt64:
+	case DataTypeString, DataTypeBytes, DataTypeJSON, dataTypeBlob:
+		return []byte(e.value)
+	case dataTypeRef:
+		return e.ref[:]
+	case dataTypeChunked:
+		return encodeChunkList(e.chunkType, e.chunks)
+	case DataTypeInt64, DataTypeFloat64, dataTypeExpiry:
 		buf := new(bytes.Buffer)
-		// Записуємо int64 у little-endian форматі
+		// Записуємо int64 (або біти float64) у little-endian форматі
 		_ = binary.Write(buf, binary.LittleEndian, e.valueInt)
-		valueBytes = buf.Bytes()
-		vl = len(valueBytes) // Зазвичай 8 для int64
+		return buf.Bytes()
+	case DataTypeBool:
+		return []byte{byte(e.valueInt)}
+	case DataTypeSeries:
+		return encodeSeriesPoints(e.points)
+	case dataTypeTombstone, dataTypeRangeTombstone:
+		return nil
 	default:
 		// Обробка невідомого типу (можна панікувати або повертати помилку)
 		panic(fmt.Sprintf("unknown data type: %d", e.dataType))
 	}
+}
+
+func encodeRecord(key string, dataType byte, timestamp int64, seq uint64, valueBytes []byte) []byte {
+	kl := len(key)
+	vl := len(valueBytes)
 
-	// Загальний розмір = 4 (розмір) + 4 (kl) + kl + 1 (dataType) + 4 (vl) + vl
-	size := 4 + 4 + kl + 1 + 4 + vl
+	// Загальний розмір = 4 (розмір) + 1 (версія) + 8 (час) + 8 (номер) + 4 (kl) + kl + 1 (dataType) + 4 (vl) + vl
+	size := entryHeaderSize + 4 + kl + 1 + 4 + vl
 	res := make([]byte, size)
 
-	binary.LittleEndian.PutUint32(res[0:4], uint32(size))           // Загальний розмір
-	binary.LittleEndian.PutUint32(res[4:8], uint32(kl))             // Довжина ключа
-	copy(res[8:8+kl], e.key)                                        // Ключ
-	res[8+kl] = e.dataType                                          // Тип даних
-	binary.LittleEndian.PutUint32(res[8+kl+1:8+kl+1+4], uint32(vl)) // Довжина значення
-	copy(res[8+kl+1+4:], valueBytes)                                // Значення
+	binary.LittleEndian.PutUint32(res[0:4], uint32(size)|entryVersionedFlag) // Загальний розмір
+	res[4] = entryFormatCurrent                                              // Версія формату
+	binary.LittleEndian.PutUint64(res[5:13], uint64(timestamp))              // Час запису
+	binary.LittleEndian.PutUint64(res[13:21], seq)                           // Номер запису
+	binary.LittleEndian.PutUint32(res[21:25], uint32(kl))                    // Довжина ключа
+	copy(res[25:25+kl], key)                                                 // Ключ
+	res[25+kl] = dataType                                                    // Тип даних
+	binary.LittleEndian.PutUint32(res[25+kl+1:25+kl+1+4], uint32(vl))        // Довжина значення
+	copy(res[25+kl+1+4:], valueBytes)                                        // Значення
 
 	return res
 }
 
+// setRecordSeq записує номер seq у заголовок закодованого запису поточного формату.
+func setRecordSeq(data []byte, seq uint64) {
+	binary.LittleEndian.PutUint64(data[13:21], seq)
+}
+
+// entryHeaderSize - розмір заголовка запису поточного формату (розмір, версія, час, номер).
+const entryHeaderSize = 4 + 1 + 8 + 8
+
+// recordHeader - поля заголовка запису, див. entryHeader.
+type recordHeader struct {
+	version   byte
+	timestamp int64
+	seq       uint64
+	// klOffset - зміщення поля довжини ключа.
+	klOffset int
+}
+
+// entryHeader розбирає початок запису.
+func entryHeader(input []byte) (recordHeader, error) {
+	if len(input) < 4 {
+		return recordHeader{}, fmt.Errorf("input too short to read size")
+	}
+	if binary.LittleEndian.Uint32(input[0:4])&entryVersionedFlag == 0 {
+		return recordHeader{version: entryFormatV1, klOffset: 4}, nil
+	}
+	if len(input) < 5 {
+		return recordHeader{}, fmt.Errorf("input too short to read format version")
+	}
+	switch input[4] {
+	case entryFormatV2:
+		return recordHeader{version: entryFormatV2, klOffset: 5}, nil
+	case entryFormatV3:
+		if len(input) < 13 {
+			return recordHeader{}, fmt.Errorf("input too short to read timestamp")
+		}
+		return recordHeader{version: entryFormatV3, timestamp: int64(binary.LittleEndian.Uint64(input[5:13])), klOffset: 13}, nil
+	case entryFormatV4:
+		if len(input) < entryHeaderSize {
+			return recordHeader{}, fmt.Errorf("input too short to read sequence number")
+		}
+		return recordHeader{
+			version:   entryFormatV4,
+			timestamp: int64(binary.LittleEndian.Uint64(input[5:13])),
+			seq:       binary.LittleEndian.Uint64(input[13:21]),
+			klOffset:  entryHeaderSize,
+		}, nil
+	default:
+		return recordHeader{}, fmt.Errorf("unsupported entry format version %d", input[4])
+	}
+}
+
+// upgradeRecord повертає закодований запис у поточному форматі. Запис старішого формату
+// отримує новий заголовок з нульовим номером і часом, прочитаним із запису (нульовим для
+// v1 і v2), решта полів не змінюється; запис поточного формату повертається як є.
+func upgradeRecord(data []byte) ([]byte, error) {
+	header, err := entryHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.version == entryFormatCurrent {
+		return data, nil
+	}
+	body := data[header.klOffset:]
+	res := make([]byte, entryHeaderSize+len(body))
+	binary.LittleEndian.PutUint32(res[0:4], uint32(len(res))|entryVersionedFlag)
+	res[4] = entryFormatCurrent
+	binary.LittleEndian.PutUint64(res[5:13], uint64(header.timestamp))
+	copy(res[entryHeaderSize:], body)
+	return res, nil
+}
+
 // Decode десеріалізує запис з байтового зрізу.
 // Вхідний 'input' повинен містити ВЕСЬ запис, включаючи його розмір на початку.
+// Зашифроване значення не розшифровується: його розшифровує keyring.unseal.
 func (e *entry) Decode(input []byte) error {
-	if len(input) < 4 {
-		return fmt.Errorf("input too short to read size")
+	rec, err := splitRecord(input)
+	if err != nil {
+		return err
 	}
-	// fullSize := binary.LittleEndian.Uint32(input[0:4]) // Розмір вже відомий, оскільки передається весь запис
+	e.format = rec.header.version
+	e.timestamp = rec.header.timestamp
+	e.seq = rec.header.seq
+	e.key = rec.key
+	e.dataType = rec.dataType
+	return e.decodeValue(rec.value)
+}
 
-	if len(input) < 8 { // 4 (size) + 4 (kl)
-		return fmt.Errorf("input too short to read key length")
+// rawRecord - поля закодованого запису без розбору значення.
+type rawRecord struct {
+	header   recordHeader
+	key      string
+	dataType byte
+	value    []byte
+}
+
+// splitRecord розбирає закодований запис на заголовок, ключ, тип і байти значення.
+func splitRecord(input []byte) (rawRecord, error) {
+	header, err := entryHeader(input)
+	if err != nil {
+		return rawRecord{}, err
 	}
-	kl := binary.LittleEndian.Uint32(input[4:8])
+	klOffset := header.klOffset
 
-	keyEndOffset := 8 + int(kl)
+	if len(input) < klOffset+4 {
+		return rawRecord{}, fmt.Errorf("input too short to read key length")
+	}
+	kl := binary.LittleEndian.Uint32(input[klOffset : klOffset+4])
+
+	keyOffset := klOffset + 4
+	keyEndOffset := keyOffset + int(kl)
 	if len(input) < keyEndOffset+1 { // +1 для dataType
-		return fmt.Errorf("input too short to read key or data type")
+		return rawRecord{}, fmt.Errorf("input too short to read key or data type")
 	}
-	e.key = string(input[8:keyEndOffset])
-	e.dataType = input[keyEndOffset]
+	rec := rawRecord{header: header, key: string(input[keyOffset:keyEndOffset]), dataType: input[keyEndOffset]}
 
 	vlOffset := keyEndOffset + 1
 	if len(input) < vlOffset+4 { // +4 для value length
-		return fmt.Errorf("input too short to read value length")
+		return rawRecord{}, fmt.Errorf("input too short to read value length")
 	}
 	vl := binary.LittleEndian.Uint32(input[vlOffset : vlOffset+4])
 
 	valueOffset := vlOffset + 4
 	if len(input) < valueOffset+int(vl) {
-		return fmt.Errorf("input too short to read value (expected %d, got %d from offset %d)", vl, len(input)-(valueOffset), valueOffset)
+		return rawRecord{}, fmt.Errorf("input too short to read value (expected %d, got %d from offset %d)", vl, len(input)-(valueOffset), valueOffset)
 	}
-	valueBytes := input[valueOffset : valueOffset+int(vl)]
+	rec.value = input[valueOffset : valueOffset+int(vl)]
+	return rec, nil
+}
 
+// decodeValue розбирає значення запису відповідно до e.dataType. Стиснене значення
+// розпаковується, а e.dataType замінюється типом вихідного значення.
+func (e *entry) decodeValue(valueBytes []byte) error {
 	switch e.dataType {
-	case DataTypeString:
+	case DataTypeString, DataTypeBytes, DataTypeJSON, dataTypeBlob:
 		e.value = string(valueBytes)
-	case DataTypeInt64:
+	case dataTypeRef:
+		if len(valueBytes) != len(e.ref) {
+			return fmt.Errorf("invalid length for value reference: expected %d, got %d", len(e.ref), len(valueBytes))
+		}
+		copy(e.ref[:], valueBytes)
+	case dataTypeChunked:
+		chunkType, chunks, err := decodeChunkList(valueBytes)
+		if err != nil {
+			return err
+		}
+		e.chunkType, e.chunks = chunkType, chunks
+	case DataTypeBool:
+		if len(valueBytes) != 1 || valueBytes[0] > 1 {
+			return fmt.Errorf("invalid bool value: %v", valueBytes)
+		}
+		e.valueInt = int64(valueBytes[0])
+	case DataTypeInt64, DataTypeFloat64, dataTypeExpiry:
 		if len(valueBytes) != 8 {
 			return fmt.Errorf("invalid length for int64 value: expected 8, got %d", len(valueBytes))
 		}
@@ -110,6 +317,30 @@ func (e *entry) Decode(input []byte) error {
 		if err := binary.Read(reader, binary.LittleEndian, &e.valueInt); err != nil {
 			return fmt.Errorf("failed to decode int64 value: %w", err)
 		}
+	case DataTypeSeries:
+		points, err := decodeSeriesPoints(valueBytes)
+		if err != nil {
+			return err
+		}
+		e.points = points
+	case dataTypeEncrypted:
+		sealed, err := parseSealed(valueBytes)
+		if err != nil {
+			return err
+		}
+		e.dataType = sealed.indexType
+		e.sealed = append([]byte(nil), valueBytes...)
+	case dataTypeCompressed:
+		dataType, raw, err := decompressValue(valueBytes)
+		if err != nil {
+			return err
+		}
+		e.dataType = dataType
+		return e.decodeValue(raw)
+	case dataTypeTombstone, dataTypeRangeTombstone:
+		if len(valueBytes) != 0 {
+			return fmt.Errorf("tombstone entry must not have a value, got %d bytes", len(valueBytes))
+		}
 	default:
 		return fmt.Errorf("unknown data type during decode: %d", e.dataType)
 	}
@@ -117,26 +348,44 @@ func (e *entry) Decode(input []byte) error {
 }
 
 // DecodeFromReader читає та десеріалізує один запис з bufio.Reader.
-// Повертає кількість прочитаних байт та помилку.
+// Повертає кількість прочитаних байт та помилку. Чистий кінець файлу дає io.EOF,
+// а обірваний запис (наприклад, після збою під час запису) - помилку, що обгортає io.ErrUnexpectedEOF.
 func (e *entry) DecodeFromReader(in *bufio.Reader) (int, error) {
+	return e.DecodeFromReaderWithin(in, -1)
+}
+
+// DecodeFromReaderWithin - DecodeFromReader для потоку, в якому лишилося remaining байт
+// (від'ємне - невідомо). Запис, розмір якого більший за залишок, вважається обірваним
+// без виділення пам'яті під нього.
+func (e *entry) DecodeFromReaderWithin(in *bufio.Reader, remaining int64) (int, error) {
 	// 1. Читаємо загальний розмір запису
 	sizeBuf := make([]byte, 4)
-	if _, err := io.ReadFull(in, sizeBuf); err != nil {
-		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) { // Обробляємо обидва випадки EOF
+	if n, err := io.ReadFull(in, sizeBuf); err != nil {
+		if errors.Is(err, io.EOF) && n == 0 {
 			return 0, io.EOF // Повертаємо чистий EOF, якщо це кінець файлу
 		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, fmt.Errorf("truncated entry size (%d of 4 bytes): %w", n, io.ErrUnexpectedEOF)
+		}
 		return 0, fmt.Errorf("failed to read entry size: %w", err)
 	}
-	entrySize := binary.LittleEndian.Uint32(sizeBuf)
+	entrySize := binary.LittleEndian.Uint32(sizeBuf) &^ entryVersionedFlag
 
 	if entrySize <= 4 { // Розмір має бути більшим за розмір самого поля "розмір"
 		return 4, fmt.Errorf("invalid entry size: %d", entrySize)
 	}
 
+	if remaining >= 0 && int64(entrySize) > remaining {
+		return 4, fmt.Errorf("truncated entry data (expected %d bytes, %d left): %w", entrySize-4, remaining-4, io.ErrUnexpectedEOF)
+	}
+
 	// 2. Читаємо решту запису
 	// Ми вже прочитали 4 байти (розмір), тому читаємо entrySize - 4
 	recordData := make([]byte, entrySize-4)
 	if _, err := io.ReadFull(in, recordData); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 4, fmt.Errorf("truncated entry data (expected %d bytes): %w", entrySize-4, io.ErrUnexpectedEOF)
+		}
 		return 4, fmt.Errorf("failed to read entry data (expected %d bytes): %w", entrySize-4, err)
 	}
 
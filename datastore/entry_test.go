@@ -4,10 +4,12 @@ package datastore
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"testing"
+	"time"
 )
 
 func TestEntry_EncodeDecode_String(t *testing.T) {
@@ -56,6 +58,7 @@ func TestEntry_DecodeFromReader(t *testing.T) {
 		{key: "anotherKey", valueInt: -9876543210, dataType: DataTypeInt64},
 		{key: "short", value: "s", dataType: DataTypeString},
 		{key: "emptyVal", value: "", dataType: DataTypeString},
+		{key: "deletedKey", dataType: dataTypeTombstone},
 	}
 
 	for i, tc := range testCases {
@@ -104,3 +107,77 @@ func TestEntry_Decode_ErrorHandling(t *testing.T) {
 	}
 	// ... більше тестів на пошкоджені дані ...
 }
+
+// encodeV1 кодує запис у форматі v1, без байта версії.
+func encodeV1(e entry) []byte {
+	current := e.Encode()
+	v1 := make([]byte, 4+len(current)-entryHeaderSize)
+	binary.LittleEndian.PutUint32(v1[0:4], uint32(len(v1)))
+	copy(v1[4:], current[entryHeaderSize:])
+	return v1
+}
+
+func TestEntry_DecodeV1(t *testing.T) {
+	e := entry{key: "legacyKey", value: "legacyValue", dataType: DataTypeString}
+	legacy := encodeV1(e)
+	e.timestamp = time.Now().UnixNano()
+
+	var decoded entry
+	n, err := decoded.DecodeFromReader(bufio.NewReader(bytes.NewReader(legacy)))
+	if err != nil {
+		t.Fatalf("DecodeFromReader of v1 entry failed: %v", err)
+	}
+	if n != len(legacy) || decoded.format != entryFormatV1 || decoded.timestamp != 0 || decoded.key != e.key || decoded.value != e.value {
+		t.Errorf("decoded v1 entry %+v (%d bytes), want %+v (%d bytes)", decoded, n, e, len(legacy))
+	}
+
+	upgraded, err := upgradeRecord(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Час запису v1 невідомий, тож оновлений запис отримує нульовий час.
+	if !bytes.Equal(upgraded, (&entry{key: e.key, value: e.value, dataType: e.dataType}).Encode()) {
+		t.Errorf("upgraded v1 entry differs from the current encoding")
+	}
+	if same, err := upgradeRecord(e.Encode()); err != nil || !bytes.Equal(same, e.Encode()) {
+		t.Errorf("entry in the current format changed on upgrade: %v", err)
+	}
+
+	if err := decoded.Decode(e.Encode()); err != nil || decoded.timestamp != e.timestamp || decoded.format != entryFormatCurrent {
+		t.Errorf("timestamp round trip: got %d (format %d), want %d: %v", decoded.timestamp, decoded.format, e.timestamp, err)
+	}
+
+	unknown := e.Encode()
+	unknown[4] = 99
+	if err := decoded.Decode(unknown); err == nil {
+		t.Errorf("expected an error for an unknown entry format version")
+	}
+}
+
+func TestEntry_DecodeV3(t *testing.T) {
+	e := entry{key: "key", value: "value", dataType: DataTypeString, timestamp: time.Now().UnixNano(), seq: 42}
+	current := e.Encode()
+	// Запис v3 - поточний заголовок без номера запису.
+	v3 := append(append([]byte(nil), current[:13]...), current[entryHeaderSize:]...)
+	binary.LittleEndian.PutUint32(v3[0:4], uint32(len(v3))|entryVersionedFlag)
+	v3[4] = entryFormatV3
+
+	var decoded entry
+	if err := decoded.Decode(v3); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.format != entryFormatV3 || decoded.timestamp != e.timestamp || decoded.seq != 0 || decoded.value != e.value {
+		t.Errorf("decoded v3 entry = %+v", decoded)
+	}
+	upgraded, err := upgradeRecord(v3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.seq = 0
+	if !bytes.Equal(upgraded, e.Encode()) {
+		t.Errorf("upgraded v3 entry lost its timestamp")
+	}
+	if err := decoded.Decode(current); err != nil || decoded.seq != 42 {
+		t.Errorf("sequence number round trip: got %d: %v", decoded.seq, err)
+	}
+}
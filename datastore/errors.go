@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+)
+
+// Коди помилок бази для клієнтів.
+const (
+	CodeNotFound           = "not_found"
+	CodeWrongType          = "wrong_type"
+	CodePreconditionFailed = "precondition_failed"
+	CodeKeyExists          = "already_exists"
+	CodeClosed             = "closed"
+	CodeQueueFull          = "queue_full"
+	CodeWriteTimeout       = "write_timeout"
+	CodeShuttingDown       = "shutting_down"
+	CodeChangesCompacted   = "changes_compacted"
+	CodeUnknownSeq         = "unknown_seq"
+	CodeStorageQuota       = "storage_quota_exceeded"
+	CodeCancelled          = "cancelled"
+	CodeInternal           = "internal"
+)
+
+// ErrorCode повертає машинно-читаний код помилки бази.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrWrongType):
+		return CodeWrongType
+	case errors.Is(err, ErrPreconditionFailed):
+		return CodePreconditionFailed
+	case errors.Is(err, ErrKeyExists):
+		return CodeKeyExists
+	case errors.Is(err, ErrClosed):
+		return CodeClosed
+	case errors.Is(err, ErrQueueFull):
+		return CodeQueueFull
+	case errors.Is(err, ErrWriteTimeout):
+		return CodeWriteTimeout
+	case errors.Is(err, ErrShutdownDeadline):
+		return CodeShuttingDown
+	case errors.Is(err, ErrChangesCompacted):
+		return CodeChangesCompacted
+	case errors.Is(err, ErrUnknownSeq):
+		return CodeUnknownSeq
+	case errors.Is(err, ErrQuotaExceeded):
+		return CodeStorageQuota
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CodeCancelled
+	}
+	return CodeInternal
+}
+
+// IsRetryable повідомляє, чи може повтор тієї ж операції завершитися успішно.
+// Помилки, що залежать лише від даних запиту або стану ключа, повторювати немає сенсу.
+func IsRetryable(err error) bool {
+	switch ErrorCode(err) {
+	case CodeNotFound, CodeWrongType, CodePreconditionFailed, CodeKeyExists, CodeChangesCompacted, CodeUnknownSeq, CodeStorageQuota:
+		return false
+	}
+	return true
+}
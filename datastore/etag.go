@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// ErrPreconditionFailed повертається умовним записом, якщо поточний ETag ключа не збігається з очікуваним.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// AnyETag в умовному записі вимагає лише існування ключа.
+const AnyETag = "*"
+
+// entryETag обчислює ETag запису за типом та значенням, тому злиття сегментів його не змінює.
+func entryETag(e entry) string {
+	h := fnv.New64a()
+	h.Write([]byte{e.dataType})
+	switch e.dataType {
+	case DataTypeInt64, DataTypeFloat64, DataTypeBool:
+		h.Write(binary.LittleEndian.AppendUint64(nil, uint64(e.valueInt)))
+	default:
+		h.Write([]byte(e.value))
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func (e entry) keyValue() KeyValue {
+	kv := KeyValue{Key: e.key, DataType: e.dataType}
+	switch e.dataType {
+	case DataTypeInt64:
+		kv.Value = e.valueInt
+	case DataTypeFloat64:
+		kv.Value = math.Float64frombits(uint64(e.valueInt))
+	case DataTypeBool:
+		kv.Value = e.valueInt != 0
+	case DataTypeBytes:
+		kv.Value = []byte(e.value)
+	case DataTypeJSON:
+		kv.Value = json.RawMessage(e.value)
+	default:
+		kv.Value = e.value
+	}
+	return kv
+}
+
+// GetWithETag повертає значення ключа разом з його ETag, прочитані атомарно.
+func (db *Db) GetWithETag(key string) (KeyValue, string, error) {
+	defer db.observeRead(time.Now(), key)
+	db.segMu.RLock()
+	defer db.segMu.RUnlock()
+	idxVal, ok, err := db.lookupForRead(key)
+	if err != nil {
+		return KeyValue{}, "", err
+	}
+	if !ok {
+		return KeyValue{}, "", ErrNotFound
+	}
+	record, err := db.readRecordLocked(key, idxVal)
+	if err != nil {
+		return KeyValue{}, "", err
+	}
+	return record.keyValue(), entryETag(record), nil
+}
+
+// checkETagLocked перевіряє умову запису. Викликається під db.mu у горутині запису.
+func (db *Db) checkETagLocked(key, ifMatch string) error {
+	idxVal, exists, err := db.currentIndex.lookup(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrPreconditionFailed
+	}
+	if ifMatch == AnyETag {
+		return nil
+	}
+	record, err := db.readRecordLocked(key, idxVal)
+	if err != nil {
+		return err
+	}
+	if entryETag(record) != ifMatch {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// PutIfMatch записує рядкове значення, лише якщо поточний ETag ключа дорівнює ifMatch
+// (або ключ існує, якщо ifMatch == AnyETag). Повертає ETag нового значення.
+func (db *Db) PutIfMatch(key, value, ifMatch string) (string, error) {
+	return db.putConditional(putRequest{key: key, value: value, dataType: DataTypeString, ifMatch: ifMatch})
+}
+
+// PutInt64IfMatch - аналог PutIfMatch для значень int64.
+func (db *Db) PutInt64IfMatch(key string, value int64, ifMatch string) (string, error) {
+	return db.putConditional(putRequest{key: key, valueInt: value, dataType: DataTypeInt64, ifMatch: ifMatch})
+}
+
+func (db *Db) putConditional(req putRequest) (string, error) {
+	if req.ifMatch == "" {
+		return "", errors.New("empty ETag in conditional put")
+	}
+	if err := db.submit(req); err != nil {
+		return "", err
+	}
+	return entryETag(entry{value: req.value, valueInt: req.valueInt, dataType: req.dataType}), nil
+}
+
+// ETag повертає ETag значення, як його обчислює база, щоб клієнти могли порівнювати версії.
+func ETag(value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return entryETag(entry{valueInt: v, dataType: DataTypeInt64})
+	case string:
+		return entryETag(entry{value: v, dataType: DataTypeString})
+	case float64:
+		return entryETag(entry{valueInt: int64(math.Float64bits(v)), dataType: DataTypeFloat64})
+	case bool:
+		return entryETag(entry{valueInt: boolValue(v), dataType: DataTypeBool})
+	case []byte:
+		return entryETag(entry{value: string(v), dataType: DataTypeBytes})
+	case json.RawMessage:
+		return entryETag(entry{value: string(v), dataType: DataTypeJSON})
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDb_PutIfMatch(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if _, err := db.PutIfMatch("k", "v0", AnyETag); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("conditional put on missing key: expected ErrPreconditionFailed, got %v", err)
+	}
+	if err := db.Put("k", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	kv, etag, err := db.GetWithETag("k")
+	if err != nil || kv.Value != "v1" {
+		t.Fatalf("GetWithETag returned %+v, %v", kv, err)
+	}
+	if etag != ETag("v1") {
+		t.Errorf("ETag mismatch: %s vs %s", etag, ETag("v1"))
+	}
+
+	newETag, err := db.PutIfMatch("k", "v2", etag)
+	if err != nil {
+		t.Fatalf("PutIfMatch with current ETag failed: %v", err)
+	}
+	if _, err := db.PutIfMatch("k", "v3", etag); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("PutIfMatch with stale ETag: expected ErrPreconditionFailed, got %v", err)
+	}
+	if v, _ := db.Get("k"); v != "v2" {
+		t.Errorf("stale write was applied, value is %q", v)
+	}
+	if _, err := db.PutInt64IfMatch("k", 7, newETag); err != nil {
+		t.Fatalf("PutInt64IfMatch failed: %v", err)
+	}
+	if _, etag, _ := db.GetWithETag("k"); etag != ETag(int64(7)) {
+		t.Errorf("unexpected ETag after int64 put: %s", etag)
+	}
+}
@@ -0,0 +1,263 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// ExportRecord - один рядок формату JSON Lines, який пише Export і читає Import.
+type ExportRecord struct {
+	Key string `json:"key"`
+	// Type - тип значення: string, int64, float64, bool, bytes, json або series.
+	Type string `json:"type"`
+	// Value - значення в JSON. Для bytes - рядок base64, для series - масив точок
+	// {"ts", "value"}, для float64 - число або один з рядків "NaN", "+Inf", "-Inf".
+	Value json.RawMessage `json:"value"`
+	// ExpiresAt - час закінчення терміну дії значення (Unix, нс); 0 - без терміну.
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+// importWindow - скільки записів Import передає горутині запису, не чекаючи на результат.
+const importWindow = 256
+
+var dataTypeNames = map[byte]string{
+	DataTypeString:  "string",
+	DataTypeInt64:   "int64",
+	DataTypeFloat64: "float64",
+	DataTypeBool:    "bool",
+	DataTypeBytes:   "bytes",
+	DataTypeJSON:    "json",
+	DataTypeSeries:  "series",
+}
+
+// DataTypeName повертає назву типу значення, як у полі type експорту.
+func DataTypeName(dataType byte) string {
+	return dataTypeNames[dataType]
+}
+
+// Export записує у w усі ключі бази в лексикографічному порядку, по одному об'єкту JSON
+// (ExportRecord) на рядок. Записується стан на момент виклику, як у View; ключі з
+// простроченим терміном дії пропускаються. Рядки й ключі мають бути коректним UTF-8,
+// інакше JSON їх спотворив би: для довільних байтів є тип bytes.
+func (db *Db) Export(w io.Writer) error {
+	db.mu.RLock()
+	v := db.viewLocked()
+	expiries := make(map[string]int64, len(db.expiries))
+	for key, expiresAt := range db.expiries {
+		expiries[key] = expiresAt
+	}
+	db.mu.RUnlock()
+	defer v.Close()
+	if v.err != nil {
+		return v.err
+	}
+
+	keys := make([]string, 0, len(v.index)+len(v.series))
+	for key := range v.index {
+		keys = append(keys, key)
+	}
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	now := time.Now().UnixNano()
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for i, key := range keys {
+		if i > 0 && keys[i-1] == key {
+			// Ключ зі значенням і часовим рядом водночас уже записано обома рядками.
+			continue
+		}
+		if !utf8.ValidString(key) {
+			return fmt.Errorf("export: key %q is not valid UTF-8", key)
+		}
+		if idxVal, ok := v.index[key]; ok {
+			if expiresAt, ok := expiries[key]; ok && expiresAt <= now {
+				continue
+			}
+			rec, err := v.exportValue(key, idxVal)
+			if err != nil {
+				return err
+			}
+			rec.ExpiresAt = expiries[key]
+			if err := enc.Encode(rec); err != nil {
+				return fmt.Errorf("export: failed to write key '%s': %w", key, err)
+			}
+		}
+		if _, ok := v.series[key]; ok {
+			points, err := v.GetSeries(key, math.MinInt64, math.MaxInt64)
+			if err != nil {
+				return fmt.Errorf("export: failed to read series '%s': %w", key, err)
+			}
+			value, _ := json.Marshal(points)
+			if err := enc.Encode(ExportRecord{Key: key, Type: dataTypeNames[DataTypeSeries], Value: value}); err != nil {
+				return fmt.Errorf("export: failed to write key '%s': %w", key, err)
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// exportValue читає значення ключа з View і кодує його для Export.
+func (v *View) exportValue(key string, idxVal indexValue) (ExportRecord, error) {
+	record, err := v.readRecord(key, idxVal)
+	if err != nil {
+		return ExportRecord{}, fmt.Errorf("export: failed to read key '%s': %w", key, err)
+	}
+	name, ok := dataTypeNames[record.dataType]
+	if !ok {
+		return ExportRecord{}, fmt.Errorf("export: key '%s' has unknown type %d", key, record.dataType)
+	}
+	rec := ExportRecord{Key: key, Type: name}
+	switch kv := record.keyValue(); record.dataType {
+	case DataTypeFloat64:
+		f := kv.Value.(float64)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			rec.Value, err = json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+		} else {
+			rec.Value, err = json.Marshal(f)
+		}
+	case DataTypeJSON:
+		rec.Value = kv.Value.(json.RawMessage)
+	case DataTypeString:
+		if !utf8.ValidString(record.value) {
+			return ExportRecord{}, fmt.Errorf("export: value of key '%s' is not valid UTF-8", key)
+		}
+		rec.Value, err = json.Marshal(record.value)
+	default:
+		rec.Value, err = json.Marshal(kv.Value)
+	}
+	if err != nil {
+		return ExportRecord{}, fmt.Errorf("export: failed to encode key '%s': %w", key, err)
+	}
+	return rec, nil
+}
+
+// Import записує в базу записи у форматі Export і повертає кількість записаних.
+// Значення замінюють існуючі, а точки часових рядів дописуються до існуючих рядів.
+// Записи з терміном дії, що вже минув, пропускаються. Import не атомарний: якщо
+// рядок не вдалося розібрати або записати, записи до нього залишаються в базі.
+func (db *Db) Import(r io.Reader) (int, error) {
+	var pending []pendingPut
+	imported := 0
+	// flush чекає на результати переданих записів.
+	flush := func() error {
+		defer func() { pending = pending[:0] }()
+		var firstErr error
+		for _, p := range pending {
+			if err := p.wait(); err != nil && firstErr == nil {
+				firstErr = err
+			} else if err == nil {
+				imported++
+			}
+		}
+		return firstErr
+	}
+	reader := bufio.NewReader(r)
+	now := time.Now().UnixNano()
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			flush()
+			return imported, fmt.Errorf("import: failed to read line %d: %w", line, readErr)
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			req, err := importRequest(data)
+			if err != nil {
+				flush()
+				return imported, fmt.Errorf("import: line %d: %w", line, err)
+			}
+			if req.expiresAt == 0 || req.expiresAt > now {
+				p, err := db.enqueue(req, true)
+				if err != nil {
+					flush()
+					return imported, fmt.Errorf("import: line %d: %w", line, err)
+				}
+				pending = append(pending, p)
+			}
+		}
+		if len(pending) == importWindow || readErr != nil {
+			if err := flush(); err != nil {
+				return imported, fmt.Errorf("import: %w", err)
+			}
+		}
+		if readErr != nil {
+			return imported, nil
+		}
+	}
+}
+
+// importRequest розбирає рядок формату Export у запит на запис.
+func importRequest(data []byte) (putRequest, error) {
+	var rec ExportRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return putRequest{}, err
+	}
+	if rec.Key == "" {
+		return putRequest{}, errors.New("key must not be empty")
+	}
+	if len(rec.Value) == 0 || string(rec.Value) == "null" {
+		return putRequest{}, fmt.Errorf("key '%s' has no value", rec.Key)
+	}
+	req := putRequest{key: rec.Key, expiresAt: rec.ExpiresAt}
+	var err error
+	switch rec.Type {
+	case "string":
+		req.dataType = DataTypeString
+		err = json.Unmarshal(rec.Value, &req.value)
+	case "int64":
+		req.dataType = DataTypeInt64
+		err = json.Unmarshal(rec.Value, &req.valueInt)
+	case "float64":
+		req.dataType = DataTypeFloat64
+		var f float64
+		if err = json.Unmarshal(rec.Value, &f); err != nil {
+			var s string
+			if json.Unmarshal(rec.Value, &s) == nil {
+				f, err = strconv.ParseFloat(s, 64)
+			}
+		}
+		req.valueInt = int64(math.Float64bits(f))
+	case "bool":
+		req.dataType = DataTypeBool
+		var b bool
+		err = json.Unmarshal(rec.Value, &b)
+		req.valueInt = boolValue(b)
+	case "bytes":
+		req.dataType = DataTypeBytes
+		var b []byte
+		err = json.Unmarshal(rec.Value, &b)
+		req.value = string(b)
+	case "json":
+		req.dataType = DataTypeJSON
+		var buf bytes.Buffer
+		err = json.Compact(&buf, rec.Value)
+		req.value = buf.String()
+	case "series":
+		req.dataType = DataTypeSeries
+		err = json.Unmarshal(rec.Value, &req.points)
+		if err == nil && len(req.points) == 0 {
+			err = errors.New("series has no points")
+		}
+		req.expiresAt = 0
+	default:
+		return putRequest{}, fmt.Errorf("key '%s' has unknown type %q", rec.Key, rec.Type)
+	}
+	if err != nil {
+		return putRequest{}, fmt.Errorf("invalid %s value of key '%s': %w", rec.Type, rec.Key, err)
+	}
+	return req, nil
+}
@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDb_ExportImport(t *testing.T) {
+	opts := testOptions(true)
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	src, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	shared := strings.Repeat("shared value ", 4)
+	for _, put := range []func() error{
+		func() error { return src.Put("string", "привіт") },
+		func() error { return src.Put("shared", shared) },
+		func() error { return src.PutInt64("int", math.MaxInt64) },
+		func() error { return src.PutFloat64("float", 0.1) },
+		func() error { return src.PutFloat64("nan", math.NaN()) },
+		func() error { return src.PutBool("bool", true) },
+		func() error { return src.PutBytes("bytes", []byte{0, 0xFF, '\n'}) },
+		func() error { return src.PutJSON("json", map[string]any{"a": []int{1, 2}}) },
+		func() error {
+			return src.AppendSeries("series", SeriesPoint{Timestamp: 2, Value: 20}, SeriesPoint{Timestamp: 1, Value: 10})
+		},
+		func() error { return src.Copy("string", "ttl", CopyOptions{TTL: time.Hour}) },
+	} {
+		if err := put(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Export wrote %d lines, want 10:\n%s", len(lines), buf.String())
+	}
+	var first ExportRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Key != "bool" || first.Type != "bool" || string(first.Value) != "true" {
+		t.Errorf("first exported line %q: %+v, %v", lines[0], first, err)
+	}
+
+	dst, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if n, err := dst.Import(bytes.NewReader(buf.Bytes())); err != nil || n != 10 {
+		t.Fatalf("Import = %d, %v", n, err)
+	}
+	var again bytes.Buffer
+	if err := dst.Export(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != buf.String() {
+		t.Errorf("export after import differs:\n%s\nwant:\n%s", again.String(), buf.String())
+	}
+	if v, err := dst.GetFloat64("nan"); err != nil || !math.IsNaN(v) {
+		t.Errorf("GetFloat64(nan) = %v, %v", v, err)
+	}
+	if _, ok := dst.ExpiresAt("ttl"); !ok {
+		t.Error("imported key lost its expiry")
+	}
+}
+
+func TestDb_ImportErrors(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	input := `{"key":"a","type":"string","value":"1"}
+
+{"key":"gone","type":"string","value":"x","expiresAt":1}
+{"key":"b","type":"int64","value":"not a number"}
+{"key":"c","type":"string","value":"3"}
+`
+	n, err := db.Import(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 4") || n != 1 {
+		t.Fatalf("Import = %d, %v; want 1 record and an error on line 4", n, err)
+	}
+	if _, err := db.Get("gone"); err != ErrNotFound {
+		t.Errorf("expired record was imported: %v", err)
+	}
+	if _, err := db.Get("c"); err != ErrNotFound {
+		t.Errorf("record after the invalid line was imported: %v", err)
+	}
+	for _, line := range []string{`{"key":"","type":"string","value":""}`, `{"key":"k","type":"list","value":[]}`, `{"key":"k","type":"json","value":null}`} {
+		if _, err := db.Import(strings.NewReader(line)); err == nil {
+			t.Errorf("Import(%s) succeeded", line)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package datastore
+
+import "sort"
+
+// Flush чекає, доки всі запити на запис, передані до виклику, будуть записані в активні
+// сегменти, і скидає їх на диск (fsync) незалежно від SyncPolicy. Кожна частина запису
+// отримує в свою чергу бар'єр, тож запити, що стоять у черзі перед ним, виконуються
+// першими. Записи, передані одночасно з Flush, можуть і не потрапити під гарантію.
+func (db *Db) Flush() error {
+	pending := make([]pendingPut, 0, len(db.shards))
+	for _, sh := range db.shards {
+		p, err := db.enqueue(putRequest{flush: true, shard: sh}, true)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, p)
+	}
+	var firstErr error
+	for _, p := range pending {
+		if err := p.wait(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// syncShards скидає на диск активні сегменти всіх частин. Видалення набору ключів пише
+// й у сегменти інших частин, тож бар'єр частини синхронізує всі. Викликається горутиною
+// запису, поки сегменти не закриті.
+func (db *Db) syncShards() error {
+	var firstErr error
+	for _, sh := range db.shards {
+		if err := sh.sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Rotate дописує записи, передані до виклику (див. Flush), запечатує непорожні активні
+// сегменти всіх частин незалежно від розміру й починає нові. Повертає відсортовані
+// ідентифікатори запечатаних сегментів: їх файли більше не змінюються, доки їх не
+// замінить злиття, тож їх можна копіювати без гонок із записами.
+func (db *Db) Rotate() ([]int, error) {
+	if err := db.Flush(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var sealed []int
+	for _, sh := range db.shards {
+		if sh.segment == nil {
+			return nil, ErrClosed
+		}
+		if sh.size == 0 {
+			continue
+		}
+		segID := sh.segmentID
+		if err := db.rotateShardLocked(sh); err != nil {
+			return sealed, err
+		}
+		sealed = append(sealed, segID)
+	}
+	sort.Ints(sealed)
+	return sealed, nil
+}
@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDb_Flush(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.WriteShards = 4
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Видалення набору ключів пише в сегменти кількох частин.
+	if _, err := db.DeleteKeys([]string{"key1", "key2", "key3", "key4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	for _, sh := range db.shards {
+		if sh.unsynced.Load() {
+			t.Errorf("active segment of shard %d is not synced after Flush", sh.id)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Errorf("repeated Flush failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != ErrClosed {
+		t.Errorf("Flush after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestDb_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.WriteShards = 2
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sealed, err := db.Rotate()
+	if err != nil || len(sealed) != 2 {
+		t.Fatalf("Rotate = %v, %v; want both shards sealed", sealed, err)
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[int]int64)
+	for _, seg := range segments {
+		sizes[seg.ID] = seg.Size
+		for _, id := range sealed {
+			if seg.ID == id && (seg.Active || seg.Size == 0) {
+				t.Errorf("rotated segment %+v is active or empty", seg)
+			}
+		}
+	}
+	// Нові записи не змінюють запечатаних файлів, а порожні активні сегменти не ротуються.
+	if again, err := db.Rotate(); err != nil || len(again) != 0 {
+		t.Errorf("Rotate without writes = %v, %v", again, err)
+	}
+	if err := db.Put("key0", "updated"); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ = db.Segments()
+	for _, seg := range segments {
+		if size, ok := sizes[seg.ID]; ok && !seg.Active && seg.Size != size {
+			t.Errorf("sealed segment %d changed from %d to %d bytes", seg.ID, size, seg.Size)
+		}
+	}
+	if v, err := db.Get("key0"); err != nil || v != "updated" {
+		t.Errorf("Get(key0) = %q, %v", v, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Rotate(); err != ErrClosed {
+		t.Errorf("Rotate after Close = %v, want ErrClosed", err)
+	}
+
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		want := "value"
+		if i == 0 {
+			want = "updated"
+		}
+		if v, err := db.Get(fmt.Sprintf("key%d", i)); err != nil || v != want {
+			t.Errorf("after reopen: Get(key%d) = %q, %v", i, v, err)
+		}
+	}
+}
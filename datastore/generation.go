@@ -0,0 +1,45 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Покоління бази - випадковий UUID, який зберігається в маніфесті й не змінюється, доки
+// дані змінюються звичайними записами. Резервні копії та знімки містять лише сегменти, тож
+// база, відновлена з них (RestoreBackup, UnpackSnapshot) або зібрана з чужих сегментів,
+// відкривається з новим поколінням. Клієнти, що кешують значення або ETag, порівнюють
+// покоління і відкидають кеш, коли дані замінено цілком.
+
+// newGeneration повертає випадковий UUID версії 4.
+func newGeneration() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate database generation: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// ensureGeneration присвоює базі нове покоління, якщо маніфест його ще не містить.
+func (m *manifest) ensureGeneration() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Generation != "" {
+		return nil
+	}
+	generation, err := newGeneration()
+	if err != nil {
+		return err
+	}
+	m.Generation = generation
+	return m.saveLocked()
+}
+
+// Generation повертає покоління бази, див. опис на початку файлу.
+func (db *Db) Generation() string {
+	db.manifest.mu.Lock()
+	defer db.manifest.mu.Unlock()
+	return db.manifest.Generation
+}
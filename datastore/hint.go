@@ -0,0 +1,223 @@
+package datastore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+const hintFileNamePrefix = "hint-"
+
+// hintMagic позначає початок файлу підказок.
+var hintMagic = [4]byte{'H', 'N', 'T', '1'}
+
+var errStaleHint = errors.New("hint file is stale")
+
+// hintRecord - компактний запис індексу одного запису сегмента.
+// Записи зберігаються в порядку запису в сегмент, включно з надгробками.
+type hintRecord struct {
+	key      string
+	offset   int64
+	size     int64
+	dataType byte
+}
+
+// Формат файлу підказок:
+// [magic (4 байти)][розмір сегмента (int64)]
+// далі для кожного запису:
+// [довжина ключа (uint32)][ключ][тип даних (byte)][зміщення (int64)][розмір (uint32)]
+
+func hintFilePath(dir string, segID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d", hintFileNamePrefix, segID))
+}
+
+func writeHintFile(dir string, segID int, segmentSize int64, records []hintRecord) error {
+	path := hintFilePath(dir, segID)
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create hint file %s: %w", tmpPath, err)
+	}
+	w := bufio.NewWriter(f)
+	header := make([]byte, 12)
+	copy(header[0:4], hintMagic[:])
+	binary.LittleEndian.PutUint64(header[4:12], uint64(segmentSize))
+	_, writeErr := w.Write(header)
+	buf := make([]byte, 0, 64)
+	for _, rec := range records {
+		if writeErr != nil {
+			break
+		}
+		buf = appendHintRecord(buf[:0], rec)
+		_, writeErr = w.Write(buf)
+	}
+	if writeErr == nil {
+		writeErr = w.Flush()
+	}
+	if writeErr == nil {
+		writeErr = f.Sync()
+	}
+	if closeErr := f.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write hint file %s: %w", tmpPath, writeErr)
+	}
+	if err := fsutil.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename hint file %s: %w", tmpPath, err)
+	}
+	return nil
+}
+
+// readHintFile читає підказки сегмента. Повертає errStaleHint, якщо розмір сегмента
+// не збігається зі збереженим у підказці.
+func readHintFile(dir string, segID int, segmentSize int64) ([]hintRecord, error) {
+	f, err := os.Open(hintFilePath(dir, segID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read hint header: %w", err)
+	}
+	if [4]byte(header[0:4]) != hintMagic {
+		return nil, fmt.Errorf("invalid hint file magic")
+	}
+	if int64(binary.LittleEndian.Uint64(header[4:12])) != segmentSize {
+		return nil, errStaleHint
+	}
+	var records []hintRecord
+	for {
+		rec, err := readHintRecord(r)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.offset+rec.size > segmentSize {
+			return nil, fmt.Errorf("hint record for key '%s' points outside of segment", rec.key)
+		}
+		records = append(records, rec)
+	}
+}
+
+// appendHintRecord дописує запис у форматі файлу підказок до buf.
+func appendHintRecord(buf []byte, rec hintRecord) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(rec.key)))
+	buf = append(buf, rec.key...)
+	buf = append(buf, rec.dataType)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(rec.offset))
+	return binary.LittleEndian.AppendUint32(buf, uint32(rec.size))
+}
+
+// readHintRecord читає наступний запис у форматі файлу підказок. Повертає io.EOF,
+// якщо записів більше немає.
+func readHintRecord(r *bufio.Reader) (hintRecord, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return hintRecord{}, io.EOF
+		}
+		return hintRecord{}, fmt.Errorf("failed to read hint key length: %w", err)
+	}
+	key := make([]byte, binary.LittleEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return hintRecord{}, fmt.Errorf("failed to read hint key: %w", err)
+	}
+	var tail [13]byte
+	if _, err := io.ReadFull(r, tail[:]); err != nil {
+		return hintRecord{}, fmt.Errorf("failed to read hint record: %w", err)
+	}
+	return hintRecord{
+		key:      string(key),
+		dataType: tail[0],
+		offset:   int64(binary.LittleEndian.Uint64(tail[1:9])),
+		size:     int64(binary.LittleEndian.Uint32(tail[9:13])),
+	}, nil
+}
+
+// applyHintRecords застосовує записи сегмента до індексу в порядку їх запису.
+func (db *Db) applyHintRecords(segID int, records []hintRecord) {
+	for _, rec := range records {
+		idxVal := indexValue{
+			segmentID: segID,
+			offset:    rec.offset,
+			size:      rec.size,
+			dataType:  rec.dataType,
+		}
+		switch rec.dataType {
+		case dataTypeTombstone:
+			db.currentIndex.delete(rec.key)
+			db.blobs.dropRef(rec.key)
+			delete(db.seriesIndex, rec.key)
+			delete(db.expiries, rec.key)
+		case dataTypeRangeTombstone:
+			db.removePrefixUnsortedLocked(rec.key)
+		case dataTypeBlob:
+			h, err := parseBlobHash(rec.key)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring shared value record: %v", err)
+				continue
+			}
+			db.blobs.setLocation(h, idxVal)
+		case dataTypeRef, dataTypeChunked:
+			record, err := db.readRefLocked(segID, rec)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring value reference: %v", err)
+				continue
+			}
+			hashes, valueType := record.blobRefs()
+			idxVal.dataType = valueType
+			db.currentIndex.set(rec.key, idxVal)
+			db.blobs.setRefs(rec.key, rec.dataType, hashes)
+			delete(db.expiries, rec.key)
+		case DataTypeSeries:
+			db.seriesIndex[rec.key] = append(db.seriesIndex[rec.key], idxVal)
+		case dataTypeExpiry:
+			expiresAt, err := db.readExpiryLocked(segID, rec)
+			if err != nil {
+				db.opts.Logger.Warnf("ignoring expiry record: %v", err)
+				continue
+			}
+			db.expiries[rec.key] = expiresAt
+		default:
+			db.currentIndex.set(rec.key, idxVal)
+			db.blobs.dropRef(rec.key)
+			delete(db.expiries, rec.key)
+		}
+	}
+}
+
+// sealShardLocked зберігає підказки, фільтр Блума та, з DiskIndex, файл індексу для
+// активного сегмента частини перед тим, як він стане незмінним. Викликається під db.mu.
+func (db *Db) sealShardLocked(sh *writeShard) {
+	if sh.segment == nil {
+		return
+	}
+	if err := writeHintFile(db.dir, sh.segmentID, sh.size, sh.hints); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+	db.setSegmentBloomLocked(sh.segmentID, sh.hints)
+	db.sealSegmentTableLocked(sh.segmentID, sh.size, sh.hints)
+	seqs := segmentSeqs{Last: db.seq, LastDelete: sh.deleteSeq}
+	if err := db.manifest.markSealed(sh.segmentID, time.Now().UnixNano(), seqs, db.keys.currentID()); err != nil {
+		db.opts.Logger.Warnf("%v", err)
+	}
+	db.validateSegmentAsync(sh.segmentID, sh.hints)
+	sh.hints = nil
+	db.segMu.Lock()
+	db.mapSegmentLocked(sh.segmentID)
+	db.segMu.Unlock()
+}
@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHintFile_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	records := []hintRecord{
+		{key: "a", offset: 0, size: 20, dataType: DataTypeString},
+		{key: "b", offset: 20, size: 25, dataType: DataTypeInt64},
+		{key: "a", offset: 45, size: 14, dataType: dataTypeTombstone},
+	}
+	if err := writeHintFile(dir, 3, 59, records); err != nil {
+		t.Fatalf("writeHintFile failed: %v", err)
+	}
+	got, err := readHintFile(dir, 3, 59)
+	if err != nil {
+		t.Fatalf("readHintFile failed: %v", err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), len(got))
+	}
+	for i := range records {
+		if got[i] != records[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, got[i], records[i])
+		}
+	}
+	if _, err := readHintFile(dir, 3, 60); !errors.Is(err, errStaleHint) {
+		t.Errorf("expected errStaleHint for size mismatch, got %v", err)
+	}
+	if _, err := readHintFile(dir, 4, 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist for missing hint, got %v", err)
+	}
+}
+
+func TestDb_HintFilesOnRotationAndReopen(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	dir := db.dir
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("hintKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("hintKey000"); err != nil {
+		t.Fatal(err)
+	}
+	db.mu.RLock()
+	activeID := db.shards[0].segmentID
+	db.mu.RUnlock()
+	if activeID == 0 {
+		t.Fatalf("expected at least one rotation, active segment is still 0")
+	}
+	if _, err := os.Stat(filepath.Join(dir, hintFileNamePrefix+"0")); err != nil {
+		t.Fatalf("expected hint file for sealed segment 0: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Пошкоджена підказка для активного на момент закриття сегмента має бути проігнорована.
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s%d", hintFileNamePrefix, activeID)), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db2, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db2.Close()
+	if _, err := db2.Get("hintKey000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted key to stay deleted, got %v", err)
+	}
+	for _, i := range []int{1, 40, 79} {
+		key := fmt.Sprintf("hintKey%03d", i)
+		if v, err := db2.Get(key); err != nil || v != fmt.Sprintf("value%03d", i) {
+			t.Errorf("Get(%s) after reopen = %q, %v", key, v, err)
+		}
+	}
+	if _, err := readHintFile(dir, activeID, mustSize(t, filepath.Join(dir, fmt.Sprintf("%s%d", outFileNamePrefix, activeID)))); err != nil {
+		t.Errorf("expected hint for segment %d to be rebuilt after full scan: %v", activeID, err)
+	}
+}
+
+func mustSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
@@ -0,0 +1,281 @@
+package datastore
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultIndexShards = 16
+
+// indexShard - частина індексу зі своїм замком.
+type indexShard struct {
+	mu sync.RWMutex
+	m  map[string]indexValue
+}
+
+// shardedIndex розбиває індекс ключів на частини за хешем ключа, щоб читання різних
+// ключів не конкурували за один замок. Зміни індексу виконуються лише горутиною запису
+// та злиттям під db.mu, кожна частина додатково захищена власним замком.
+//
+// Якщо задано disk, частини в пам'яті тримають лише записи активних сегментів і зміни,
+// яких ще немає у файлах індексу сегментів (див. diskindex.go), включно з позначками
+// видалення, і мають перевагу над файлами; n тоді рахує всі ключі.
+type shardedIndex struct {
+	shards []indexShard
+	disk   *diskIndex
+	n      atomic.Int64
+}
+
+// removedValue позначає в пам'яті ключ, видалений після запису файлів індексу, які ще
+// його містять.
+var removedValue = indexValue{segmentID: -1, dataType: dataTypeTombstone}
+
+func newShardedIndex(n int) *shardedIndex {
+	if n <= 0 {
+		n = defaultIndexShards
+	}
+	ix := &shardedIndex{shards: make([]indexShard, n)}
+	for i := range ix.shards {
+		ix.shards[i].m = make(map[string]indexValue)
+	}
+	return ix
+}
+
+func (ix *shardedIndex) shard(key string) *indexShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &ix.shards[h.Sum32()%uint32(len(ix.shards))]
+}
+
+// get шукає ключ як lookup, але помилку читання файлу індексу лише журналює.
+func (ix *shardedIndex) get(key string) (indexValue, bool) {
+	val, ok, err := ix.lookup(key)
+	if err != nil {
+		ix.disk.logger.Errorf("disk index: %v", err)
+	}
+	return val, ok
+}
+
+// lookup шукає ключ у пам'яті, а потім у файлах індексу сегментів.
+func (ix *shardedIndex) lookup(key string) (indexValue, bool, error) {
+	s := ix.shard(key)
+	s.mu.RLock()
+	val, ok := s.m[key]
+	s.mu.RUnlock()
+	if val == removedValue {
+		return indexValue{}, false, nil
+	}
+	if ok || ix.disk == nil {
+		return val, ok, nil
+	}
+	e, ok, err := ix.disk.get(key)
+	return e.val, ok, err
+}
+
+func (ix *shardedIndex) set(key string, val indexValue) {
+	// Ключі, яких немає у файлах, відсіюють фільтри Блума файлів без читання блоків.
+	if ix.disk != nil {
+		if _, exists := ix.get(key); !exists {
+			ix.n.Add(1)
+		}
+	}
+	s := ix.shard(key)
+	s.mu.Lock()
+	s.m[key] = val
+	s.mu.Unlock()
+}
+
+// replace оновлює запис ключа, лише якщо він досі дорівнює old.
+func (ix *shardedIndex) replace(key string, old, val indexValue) bool {
+	if ix.disk != nil {
+		// Зміни індексу виконуються під db.mu, тож між перевіркою й записом ключ не зміниться.
+		if current, ok := ix.get(key); !ok || current != old {
+			return false
+		}
+		ix.set(key, val)
+		return true
+	}
+	s := ix.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.m[key]; !ok || current != old {
+		return false
+	}
+	s.m[key] = val
+	return true
+}
+
+func (ix *shardedIndex) delete(key string) {
+	s := ix.shard(key)
+	if ix.disk == nil {
+		s.mu.Lock()
+		delete(s.m, key)
+		s.mu.Unlock()
+		return
+	}
+	if _, exists := ix.get(key); exists {
+		ix.n.Add(-1)
+	}
+	// Поки файли можуть містити ключ, у пам'яті лишається позначка видалення.
+	onDisk := ix.disk.mayContain(key)
+	s.mu.Lock()
+	if onDisk {
+		s.m[key] = removedValue
+	} else {
+		delete(s.m, key)
+	}
+	s.mu.Unlock()
+}
+
+// pin переносить у пам'ять запис ключа з файлів індексу, щоб файли можна було прибрати.
+// Викликається під db.mu.
+func (ix *shardedIndex) pin(key string) error {
+	s := ix.shard(key)
+	s.mu.RLock()
+	_, inMemory := s.m[key]
+	s.mu.RUnlock()
+	if inMemory {
+		return nil
+	}
+	e, ok, err := ix.disk.get(key)
+	if err != nil || !ok {
+		return err
+	}
+	s.mu.Lock()
+	s.m[key] = e.val
+	s.mu.Unlock()
+	return nil
+}
+
+func (ix *shardedIndex) len() int {
+	if ix.disk != nil {
+		return int(ix.n.Load())
+	}
+	n := 0
+	for i := range ix.shards {
+		s := &ix.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// forEach по черзі обходить частини індексу, утримуючи замок поточної частини, а потім
+// ключі файлів індексу, яких немає в пам'яті. fn не повинна звертатися до індексу.
+// Помилку може повернути лише читання файлів індексу.
+func (ix *shardedIndex) forEach(fn func(key string, val indexValue)) error {
+	for i := range ix.shards {
+		s := &ix.shards[i]
+		s.mu.RLock()
+		for key, val := range s.m {
+			if val != removedValue {
+				fn(key, val)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	if ix.disk == nil {
+		return nil
+	}
+	return ix.disk.ascend("", func(e tableEntry) bool {
+		s := ix.shard(e.key)
+		s.mu.RLock()
+		_, inMemory := s.m[e.key]
+		s.mu.RUnlock()
+		if !inMemory {
+			fn(e.key, e.val)
+		}
+		return true
+	})
+}
+
+// ascend обходить ключі, не менші за from, у порядку зростання, доки fn повертає true.
+// Потребує disk; записи з пам'яті зливаються з файлами індексу.
+func (ix *shardedIndex) ascend(from string, fn func(key string, val indexValue) bool) error {
+	var mem []indexEntry
+	for i := range ix.shards {
+		s := &ix.shards[i]
+		s.mu.RLock()
+		for key, val := range s.m {
+			if key >= from {
+				mem = append(mem, indexEntry{key: key, val: val})
+			}
+		}
+		s.mu.RUnlock()
+	}
+	sort.Slice(mem, func(i, j int) bool { return mem[i].key < mem[j].key })
+	stopped := false
+	emit := func(key string, val indexValue) bool {
+		if val != removedValue && !fn(key, val) {
+			stopped = true
+		}
+		return !stopped
+	}
+	err := ix.disk.ascend(from, func(e tableEntry) bool {
+		for ; len(mem) > 0 && mem[0].key < e.key; mem = mem[1:] {
+			if !emit(mem[0].key, mem[0].val) {
+				return false
+			}
+		}
+		if len(mem) > 0 && mem[0].key == e.key {
+			m := mem[0]
+			mem = mem[1:]
+			return emit(m.key, m.val)
+		}
+		return emit(e.key, e.val)
+	})
+	if err != nil || stopped {
+		return err
+	}
+	for _, m := range mem {
+		if !emit(m.key, m.val) {
+			break
+		}
+	}
+	return nil
+}
+
+// indexEntry - ключ із розташуванням.
+type indexEntry struct {
+	key string
+	val indexValue
+}
+
+// closeDisk закриває файли індексу, якщо вони є.
+func (ix *shardedIndex) closeDisk() error {
+	if ix.disk == nil {
+		return nil
+	}
+	return ix.disk.close()
+}
+
+// spill прибирає з пам'яті записи, які файли індексу повертають так само: розташування
+// поза активними сегментами (active) і позначки видалення. Викликається під db.mu.
+func (ix *shardedIndex) spill(active func(indexValue) bool) error {
+	for i := range ix.shards {
+		s := &ix.shards[i]
+		var candidates []indexEntry
+		s.mu.RLock()
+		for key, val := range s.m {
+			if !active(val) {
+				candidates = append(candidates, indexEntry{key: key, val: val})
+			}
+		}
+		s.mu.RUnlock()
+		for _, c := range candidates {
+			e, ok, err := ix.disk.get(c.key)
+			if err != nil {
+				return err
+			}
+			if ok && e.val == c.val || !ok && c.val == removedValue {
+				s.mu.Lock()
+				delete(s.m, c.key)
+				s.mu.Unlock()
+			}
+		}
+	}
+	return nil
+}
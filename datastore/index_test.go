@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedIndex(t *testing.T) {
+	ix := newShardedIndex(4)
+	for i := 0; i < 100; i++ {
+		ix.set(fmt.Sprintf("key%d", i), indexValue{offset: int64(i)})
+	}
+	if ix.len() != 100 {
+		t.Fatalf("len: got %d, want 100", ix.len())
+	}
+	if val, ok := ix.get("key42"); !ok || val.offset != 42 {
+		t.Errorf("get key42: got %+v, %v", val, ok)
+	}
+	if ix.replace("key42", indexValue{offset: 1}, indexValue{offset: 2}) {
+		t.Errorf("replace with stale old value succeeded")
+	}
+	if !ix.replace("key42", indexValue{offset: 42}, indexValue{offset: 43}) {
+		t.Errorf("replace with current old value failed")
+	}
+	ix.delete("key42")
+	if _, ok := ix.get("key42"); ok {
+		t.Errorf("key42 still present after delete")
+	}
+	seen := 0
+	ix.forEach(func(string, indexValue) { seen++ })
+	if seen != 99 {
+		t.Errorf("forEach visited %d keys, want 99", seen)
+	}
+}
+
+func TestDb_GetDoesNotWaitForWriter(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Утримуючи db.mu, імітуємо довгий пакет записів.
+	db.mu.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.Get("key")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Get while writer holds db.mu: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Get blocked while writer holds db.mu")
+	}
+	db.mu.Unlock()
+}
+
+func TestDb_ConcurrentGetsDuringWritesAndMerge(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const keys = 50
+	for i := 0; i < keys; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key%d", i%keys)
+				if value, err := db.Get(key); err != nil || value != fmt.Sprintf("value%d", i%keys) {
+					t.Errorf("Get(%s): got %q, %v", key, value, err)
+					return
+				}
+			}
+		}()
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < keys; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.tryMergeSegments(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"errors"
+	"sort"
+)
+
+// Вторинний індекс значень int64 (Options.IndexInt64Values). Поруч з основним індексом база
+// тримає пари (значення, ключ), відсортовані за значенням, щоб QueryInt64Range знаходив
+// ключі з діапазону значень без читання сегментів. Індекс будується під час відкриття
+// й оновлюється горутиною запису під db.mu.
+
+// ErrInt64IndexDisabled повертається QueryInt64Range, якщо Options.IndexInt64Values вимкнено.
+var ErrInt64IndexDisabled = errors.New("int64 value index is not enabled")
+
+type int64IndexEntry struct {
+	value int64
+	key   string
+}
+
+type int64Index struct {
+	values map[string]int64
+	sorted []int64IndexEntry
+}
+
+func newInt64Index() *int64Index {
+	return &int64Index{values: make(map[string]int64)}
+}
+
+// search повертає позицію першої пари, не меншої за (value, key).
+func (x *int64Index) search(value int64, key string) int {
+	return sort.Search(len(x.sorted), func(i int) bool {
+		e := x.sorted[i]
+		return e.value > value || (e.value == value && e.key >= key)
+	})
+}
+
+// set запам'ятовує значення ключа, замінюючи попереднє.
+func (x *int64Index) set(key string, value int64) {
+	if x == nil {
+		return
+	}
+	if old, ok := x.values[key]; ok {
+		if old == value {
+			return
+		}
+		x.remove(key)
+	}
+	x.values[key] = value
+	i := x.search(value, key)
+	x.sorted = append(x.sorted, int64IndexEntry{})
+	copy(x.sorted[i+1:], x.sorted[i:])
+	x.sorted[i] = int64IndexEntry{value: value, key: key}
+}
+
+func (x *int64Index) remove(key string) {
+	if x == nil {
+		return
+	}
+	value, ok := x.values[key]
+	if !ok {
+		return
+	}
+	delete(x.values, key)
+	i := x.search(value, key)
+	x.sorted = append(x.sorted[:i], x.sorted[i+1:]...)
+}
+
+// rebuildInt64IndexLocked читає всі значення int64 після завантаження індексу.
+// Ключі, значення яких не вдалося прочитати, в індекс не потрапляють.
+func (db *Db) rebuildInt64IndexLocked() {
+	db.int64Index = newInt64Index()
+	var keys []string
+	var locations []indexValue
+	// Індекс int64 не поєднується з DiskIndex, тож індекс повністю в пам'яті і помилки немає.
+	_ = db.currentIndex.forEach(func(key string, idxVal indexValue) {
+		if idxVal.dataType == DataTypeInt64 {
+			keys = append(keys, key)
+			locations = append(locations, idxVal)
+		}
+	})
+	for i, key := range keys {
+		record, err := db.readRecordLocked(key, locations[i])
+		if err != nil {
+			db.opts.Logger.Warnf("int64 index: %v", err)
+			continue
+		}
+		db.int64Index.set(key, record.valueInt)
+	}
+}
+
+// QueryInt64Range повертає ключі зі значеннями int64 від min до max включно, впорядковані
+// за значенням, а при рівних значеннях - за ключем. Потребує Options.IndexInt64Values.
+func (db *Db) QueryInt64Range(min, max int64) ([]KeyValue, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.int64Index == nil {
+		return nil, ErrInt64IndexDisabled
+	}
+	var result []KeyValue
+	for _, e := range db.int64Index.sorted[db.int64Index.search(min, ""):] {
+		if e.value > max {
+			break
+		}
+		result = append(result, KeyValue{Key: e.key, Value: e.value, DataType: DataTypeInt64})
+	}
+	return result, nil
+}
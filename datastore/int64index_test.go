@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDb_QueryInt64Range(t *testing.T) {
+	opts := testOptions(true)
+	opts.IndexInt64Values = true
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]int64{"a": 5, "b": 10, "c": 15, "d": 10, "e": -3, "f": 20} {
+		if err := db.PutInt64(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("text", "12"); err != nil {
+		t.Fatal(err)
+	}
+	// Перезапис іншим типом, нове значення та видалення оновлюють індекс.
+	if err := db.Put("f", "twenty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("a", 12); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Copy("b", "g", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(min, max int64) []string {
+		t.Helper()
+		kvs, err := db.QueryInt64Range(min, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		return keys
+	}
+	want := []string{"b", "d", "g", "a"}
+	if got := query(0, 15); !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryInt64Range(0, 15) = %v, want %v", got, want)
+	}
+	if got := query(11, 11); got != nil {
+		t.Errorf("QueryInt64Range(11, 11) = %v, want none", got)
+	}
+	if kvs, _ := db.QueryInt64Range(-10, -1); len(kvs) != 1 || kvs[0].Key != "e" || kvs[0].Value != int64(-3) {
+		t.Errorf("QueryInt64Range(-10, -1) = %v", kvs)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := query(0, 15); !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryInt64Range(0, 15) after reopen = %v, want %v", got, want)
+	}
+}
+
+func TestDb_QueryInt64RangeDisabled(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if _, err := db.QueryInt64Range(0, 10); !errors.Is(err, ErrInt64IndexDisabled) {
+		t.Errorf("QueryInt64Range without the index returned %v, want ErrInt64IndexDisabled", err)
+	}
+}
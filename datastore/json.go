@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PutJSON записує v як JSON-документ. Документ зберігається у компактному вигляді.
+func (db *Db) PutJSON(key string, v any) error {
+	return db.PutJSONContext(context.Background(), key, v)
+}
+
+// PutJSONIfMatch - аналог PutIfMatch для JSON-документів.
+func (db *Db) PutJSONIfMatch(key string, v any, ifMatch string) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON document for key '%s': %w", key, err)
+	}
+	return db.putConditional(putRequest{key: key, value: string(data), dataType: DataTypeJSON, ifMatch: ifMatch})
+}
+
+// GetJSON розбирає JSON-документ ключа в out. Для значень іншого типу повертає ErrWrongType.
+func (db *Db) GetJSON(key string, out any) error {
+	record, err := db.getTyped(key, DataTypeJSON)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(record.value), out); err != nil {
+		return fmt.Errorf("failed to decode JSON document for key '%s': %w", key, err)
+	}
+	return nil
+}
+
+// GetJSONField повертає JSON одного поля документа. Шлях складається з імен полів та індексів
+// масивів, розділених крапками (напр. "address.city" або "items.0.name"); порожній шлях
+// означає весь документ. Розбираються лише об'єкти та масиви на шляху до поля.
+// Якщо поля немає, повертає помилку, що обгортає ErrNotFound.
+func (db *Db) GetJSONField(key, path string) (json.RawMessage, error) {
+	record, err := db.getTyped(key, DataTypeJSON)
+	if err != nil {
+		return nil, err
+	}
+	field, err := jsonField([]byte(record.value), path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: field '%s' of key '%s': %v", ErrNotFound, path, key, err)
+	}
+	return field, nil
+}
+
+// jsonField знаходить у документі doc поле за шляхом path.
+func jsonField(doc []byte, path string) (json.RawMessage, error) {
+	current := json.RawMessage(doc)
+	if path == "" {
+		return current, nil
+	}
+	for _, name := range strings.Split(path, ".") {
+		switch firstByte(current) {
+		case '{':
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal(current, &object); err != nil {
+				return nil, err
+			}
+			next, ok := object[name]
+			if !ok {
+				return nil, fmt.Errorf("no field %q", name)
+			}
+			current = next
+		case '[':
+			index, err := strconv.Atoi(name)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an array index", name)
+			}
+			var array []json.RawMessage
+			if err := json.Unmarshal(current, &array); err != nil {
+				return nil, err
+			}
+			if index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("index %d out of range", index)
+			}
+			current = array[index]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar value", name)
+		}
+	}
+	return current, nil
+}
+
+// firstByte повертає перший значущий символ JSON-значення.
+func firstByte(value []byte) byte {
+	value = bytes.TrimLeft(value, " \t\r\n")
+	if len(value) == 0 {
+		return 0
+	}
+	return value[0]
+}
@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testDocument struct {
+	Name    string            `json:"name"`
+	Tags    []string          `json:"tags"`
+	Address map[string]string `json:"address"`
+}
+
+func TestDb_JSON(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDb(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := testDocument{Name: "duo", Tags: []string{"lab", "go"}, Address: map[string]string{"city": "Kyiv"}}
+	if err := db.PutJSON("doc", doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutJSON("bad", func() {}); err == nil {
+		t.Errorf("PutJSON accepted a value that cannot be encoded")
+	}
+	if err := db.Put("text", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ path, want string }{
+		{"", `{"name":"duo","tags":["lab","go"],"address":{"city":"Kyiv"}}`},
+		{"name", `"duo"`},
+		{"tags.1", `"go"`},
+		{"address.city", `"Kyiv"`},
+	} {
+		field, err := db.GetJSONField("doc", tc.path)
+		if err != nil || string(field) != tc.want {
+			t.Errorf("GetJSONField(%q) = %s, %v, want %s", tc.path, field, err, tc.want)
+		}
+	}
+	for _, path := range []string{"missing", "tags.5", "tags.x", "name.first"} {
+		if _, err := db.GetJSONField("doc", path); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetJSONField(%q) error = %v, want ErrNotFound", path, err)
+		}
+	}
+	if _, err := db.GetJSONField("text", "name"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetJSONField of a string: %v, want ErrWrongType", err)
+	}
+	var out testDocument
+	if err := db.GetJSON("text", &out); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetJSON of a string: %v, want ErrWrongType", err)
+	}
+	if s, err := db.GetAsString("doc"); err != nil || s[0] != '{' {
+		t.Errorf("GetAsString(doc) = %q, %v", s, err)
+	}
+
+	etag, err := db.PutJSONIfMatch("doc", map[string]string{"name": "trio"}, "\"stale\"")
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("PutJSONIfMatch with a stale ETag = %q, %v", etag, err)
+	}
+
+	db.Close()
+	db, err = NewDb(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.GetJSON("doc", &out); err != nil || !reflect.DeepEqual(out, doc) {
+		t.Errorf("GetJSON after reopen = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// lockFileName - файл у директорії бази, на який процес, що відкрив базу, тримає
+// ексклюзивне блокування. У файлі записано PID власника, поки база відкрита: блокування
+// знімає операційна система, щойно процес завершиться, тож застарілий файл після збою не
+// заважає відкрити базу знову, а PID у ньому показує, що базу не закрили коректно.
+const lockFileName = "LOCK"
+
+// ErrDirLocked повертається NewDb, якщо директорію бази вже відкрив інший процес
+// (або інший екземпляр Db в цьому процесі). Два власники однієї директорії пошкодили б
+// сегменти під час злиття.
+var ErrDirLocked = errors.New("db directory is already in use")
+
+// lockDir блокує директорію бази dir і записує в файл блокування PID процесу.
+// Повертає PID попереднього власника, якщо той не закрив базу (0 - закрив).
+func lockDir(dir string, logger Logger) (*os.File, int, error) {
+	path := filepath.Join(dir, lockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+	if err := fsutil.LockFile(file); err != nil {
+		owner := "another process"
+		if raw, readErr := os.ReadFile(path); readErr == nil && strings.TrimSpace(string(raw)) != "" {
+			owner = "process " + strings.TrimSpace(string(raw))
+		}
+		_ = file.Close()
+		if errors.Is(err, fsutil.ErrLocked) {
+			return nil, 0, fmt.Errorf("%w: %s is locked by %s; stop it or point this instance at another directory", ErrDirLocked, dir, owner)
+		}
+		return nil, 0, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	var stalePID int
+	if raw, readErr := os.ReadFile(path); readErr == nil {
+		stalePID, _ = strconv.Atoi(strings.TrimSpace(string(raw)))
+	}
+	// Без блокування файлів воно нічого не доводить: PID живого процесу означає, що база відкрита.
+	if stalePID > 0 && !fsutil.LockSupported && stalePID != os.Getpid() && processAlive(stalePID) {
+		_ = file.Close()
+		return nil, 0, fmt.Errorf("%w: %s is used by process %d; stop it or point this instance at another directory", ErrDirLocked, dir, stalePID)
+	}
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+		if err != nil {
+			logger.Warnf("failed to write PID to lock file %s: %v", path, err)
+		}
+	}
+	return file, max(stalePID, 0), nil
+}
+
+// clearLockOwner стирає PID з файлу блокування під час коректного закриття бази.
+func clearLockOwner(file *os.File) error {
+	if file == nil {
+		return nil
+	}
+	return file.Truncate(0)
+}
+
+// unlockDir знімає блокування директорії, взяте lockDir. Файл блокування не видаляється:
+// інакше процес, що чекає на нього, міг би заблокувати вже видалений файл.
+func unlockDir(file *os.File) error {
+	if file == nil {
+		return nil
+	}
+	_ = fsutil.UnlockFile(file)
+	return file.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package datastore
+
+import "os"
+
+// processAlive повідомляє, чи існує процес з PID pid. Там, де os.FindProcess не перевіряє
+// існування процесу, будь-який PID вважається живим.
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,43 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDb_DirLock(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, lockFileName))
+	if err != nil || strings.TrimSpace(string(raw)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("lock file contains %q, %v; want the PID", raw, err)
+	}
+
+	_, err = NewDbWithOptions(dir, testOptions(true))
+	if !errors.Is(err, ErrDirLocked) || !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+		t.Fatalf("second open of the same directory returned %v, want ErrDirLocked naming the owner", err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatalf("failed open broke the owner: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Після закриття директорію знову можна відкрити, хоча файл блокування залишився.
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("key"); err != nil || v != "value" {
+		t.Errorf("Get after reopen = %q, %v", v, err)
+	}
+}
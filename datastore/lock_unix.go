@@ -0,0 +1,14 @@
+//go:build unix
+
+package datastore
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive повідомляє, чи існує процес з PID pid.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,52 @@
+package datastore
+
+import (
+	"fmt"
+	"log"
+)
+
+// Logger приймає діагностичні повідомлення бази за рівнями Debug, Info, Warn та Error.
+// Повідомлення форматуються як у fmt.Printf, без завершального переведення рядка.
+// Методи викликаються з різних горутин, зокрема під замками бази, тому мають бути
+// потокобезпечними й не звертатися до бази.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// StdLogger передає повідомлення стандартному журналу з префіксом рівня. Використовується
+// за замовчуванням.
+type StdLogger struct {
+	// Logger - журнал, куди пишуться повідомлення; nil - log.Default().
+	Logger *log.Logger
+	// Debug вмикає повідомлення рівня Debug, які інакше відкидаються.
+	Debug bool
+}
+
+func (l StdLogger) output(prefix, format string, args []any) {
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	_ = logger.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+func (l StdLogger) Debugf(format string, args ...any) {
+	if l.Debug {
+		l.output("Debug: ", format, args)
+	}
+}
+
+func (l StdLogger) Infof(format string, args ...any)  { l.output("", format, args) }
+func (l StdLogger) Warnf(format string, args ...any)  { l.output("Warning: ", format, args) }
+func (l StdLogger) Errorf(format string, args ...any) { l.output("Error: ", format, args) }
+
+// NopLogger відкидає всі повідомлення, наприклад у тестах.
+type NopLogger struct{}
+
+func (NopLogger) Debugf(string, ...any) {}
+func (NopLogger) Infof(string, ...any)  {}
+func (NopLogger) Warnf(string, ...any)  {}
+func (NopLogger) Errorf(string, ...any) {}
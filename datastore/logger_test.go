@@ -0,0 +1,94 @@
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) add(level, format string, args []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) { l.add("DEBUG", format, args) }
+func (l *recordingLogger) Infof(format string, args ...any)  { l.add("INFO", format, args) }
+func (l *recordingLogger) Warnf(format string, args ...any)  { l.add("WARN", format, args) }
+func (l *recordingLogger) Errorf(format string, args ...any) { l.add("ERROR", format, args) }
+
+func (l *recordingLogger) contains(prefix string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDb_LoggerReceivesWarnings(t *testing.T) {
+	dir := t.TempDir()
+	logger := &recordingLogger{}
+	opts := testOptions(true)
+	opts.Logger = logger
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, outFileNamePrefix+"0"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !logger.contains("WARN recovered torn write in segment 0") {
+		t.Errorf("torn write recovery was not logged as a warning: %q", logger.lines)
+	}
+	if !logger.contains("INFO Migration") {
+		t.Errorf("migration progress was not logged as info: %q", logger.lines)
+	}
+}
+
+func TestStdLogger_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := StdLogger{Logger: log.New(&buf, "", 0)}
+	logger.Debugf("hidden %d", 1)
+	logger.Infof("info %d", 2)
+	logger.Warnf("warn %d", 3)
+	logger.Errorf("error %d", 4)
+	if want := "info 2\nWarning: warn 3\nError: error 4\n"; buf.String() != want {
+		t.Errorf("StdLogger wrote %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	logger.Debug = true
+	logger.Debugf("shown %d", 5)
+	if want := "Debug: shown 5\n"; buf.String() != want {
+		t.Errorf("StdLogger with Debug wrote %q, want %q", buf.String(), want)
+	}
+}
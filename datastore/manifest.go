@@ -0,0 +1,264 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+const manifestFileName = "MANIFEST"
+
+// SegmentValidation - результат повної перевірки запечатаного сегмента.
+type SegmentValidation struct {
+	// Size - розмір перевіреного файлу в байтах.
+	Size int64 `json:"size"`
+	// Entries - кількість записів, успішно декодованих з файлу.
+	Entries int `json:"entries"`
+	// Checksum - CRC-32 (IEEE) усього файлу.
+	Checksum string `json:"checksum"`
+	// ValidatedAt - час завершення перевірки.
+	ValidatedAt time.Time `json:"validatedAt"`
+	// Error - опис знайденої проблеми. Порожній для цілого сегмента.
+	Error string `json:"error,omitempty"`
+}
+
+// manifest - метадані бази, що зберігаються у файлі MANIFEST поруч із сегментами.
+type manifest struct {
+	mu       sync.Mutex
+	path     string
+	Segments map[int]SegmentValidation `json:"segments"`
+	// NewestWrites - час останнього запису в кожен запечатаний сегмент (Unix нс).
+	// Для злитих сегментів це найпізніший час серед перенесених записів.
+	NewestWrites map[int]int64 `json:"newestWrites,omitempty"`
+	// Formats - найстаріший формат записів у кожному запечатаному сегменті. Сегменти,
+	// яких тут немає, записані до появи версій і можуть містити записи v1.
+	Formats map[int]byte `json:"formats,omitempty"`
+	// Migrations - час виконання кожного кроку міграції, див. migrate.go.
+	Migrations map[string]time.Time `json:"migrations,omitempty"`
+	// Seqs - найбільші номери записів у кожному запечатаному сегменті, див. changes.go.
+	Seqs map[int]segmentSeqs `json:"seqs,omitempty"`
+	// LastSeq - найбільший номер, виданий до останнього запечатування або злиття.
+	LastSeq uint64 `json:"lastSeq,omitempty"`
+	// CompactedSeq - найбільший номер видалення, відкинутого злиттям, або запису в
+	// архівованому сегменті. Зміни з меншими номерами ChangesSince відтворити вже не може.
+	CompactedSeq uint64 `json:"compactedSeq,omitempty"`
+	// EncryptionKeys - ключ, яким зашифровані всі значення запечатаного сегмента, див. encrypt.go.
+	// Сегменти, яких тут немає, можуть містити відкриті значення.
+	EncryptionKeys map[int]string `json:"encryptionKeys,omitempty"`
+	// Generation - покоління бази, див. generation.go.
+	Generation string `json:"generation,omitempty"`
+}
+
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{path: filepath.Join(dir, manifestFileName), Segments: make(map[int]SegmentValidation), NewestWrites: make(map[int]int64), Formats: make(map[int]byte), Migrations: make(map[string]time.Time), Seqs: make(map[int]segmentSeqs), EncryptionKeys: make(map[int]string)}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", m.path, err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", m.path, err)
+	}
+	if m.Segments == nil {
+		m.Segments = make(map[int]SegmentValidation)
+	}
+	if m.NewestWrites == nil {
+		m.NewestWrites = make(map[int]int64)
+	}
+	if m.Formats == nil {
+		m.Formats = make(map[int]byte)
+	}
+	if m.Migrations == nil {
+		m.Migrations = make(map[string]time.Time)
+	}
+	if m.Seqs == nil {
+		m.Seqs = make(map[int]segmentSeqs)
+	}
+	if m.EncryptionKeys == nil {
+		m.EncryptionKeys = make(map[int]string)
+	}
+	return m, nil
+}
+
+// saveLocked атомарно перезаписує файл маніфесту. Викликається під m.mu.
+func (m *manifest) saveLocked() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(m.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+func (m *manifest) setValidation(segID int, v SegmentValidation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Segments[segID] = v
+	return m.saveLocked()
+}
+
+// replaceSegments видаляє метадані злитих сегментів і записує час останнього запису
+// для вихідних сегментів злиття. Злиття пише записи лише в поточному форматі й
+// відкидає всі видалення, тож номери видалень злитих сегментів переходять у CompactedSeq.
+// lastSeq - останній виданий номер на момент встановлення злиття, keyID - ключ, яким
+// зашифровані значення вихідних сегментів ("" - шифрування вимкнене).
+func (m *manifest) replaceSegments(removed []int, newest map[int]int64, lastSeq uint64, keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var merged segmentSeqs
+	for _, segID := range removed {
+		merged.Last = max(merged.Last, m.Seqs[segID].Last)
+		merged.LastDelete = max(merged.LastDelete, m.Seqs[segID].LastDelete)
+		delete(m.Segments, segID)
+		delete(m.NewestWrites, segID)
+		delete(m.Formats, segID)
+		delete(m.Seqs, segID)
+		delete(m.EncryptionKeys, segID)
+	}
+	for segID, t := range newest {
+		m.NewestWrites[segID] = t
+		m.Formats[segID] = entryFormatCurrent
+		m.Seqs[segID] = segmentSeqs{Last: merged.Last}
+		m.setEncryptionKeyLocked(segID, keyID)
+	}
+	m.CompactedSeq = max(m.CompactedSeq, merged.LastDelete)
+	m.LastSeq = max(m.LastSeq, lastSeq)
+	return m.saveLocked()
+}
+
+// forgetSegments видаляє метадані сегментів, файли яких видалено без злиття.
+func (m *manifest) forgetSegments(segIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, segID := range segIDs {
+		delete(m.Segments, segID)
+		delete(m.NewestWrites, segID)
+		delete(m.Formats, segID)
+		delete(m.Seqs, segID)
+		delete(m.EncryptionKeys, segID)
+	}
+	return m.saveLocked()
+}
+
+// markArchived відзначає, що сегмент перенесено в холодне сховище: ChangesSince його не
+// читає, тож його номери переходять у CompactedSeq.
+func (m *manifest) markArchived(segID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.CompactedSeq = max(m.CompactedSeq, m.Seqs[segID].Last)
+	return m.saveLocked()
+}
+
+func (m *manifest) setNewestWrite(segID int, t int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.NewestWrites[segID] = t
+	return m.saveLocked()
+}
+
+// markSealed записує час останнього запису, номери записів і ключ шифрування щойно
+// запечатаного сегмента. Активний сегмент завжди пишеться в поточному форматі.
+func (m *manifest) markSealed(segID int, t int64, seqs segmentSeqs, keyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.NewestWrites[segID] = t
+	m.Formats[segID] = entryFormatCurrent
+	m.Seqs[segID] = seqs
+	m.setEncryptionKeyLocked(segID, keyID)
+	m.LastSeq = max(m.LastSeq, seqs.Last)
+	return m.saveLocked()
+}
+
+func (m *manifest) setSeqs(segID int, seqs segmentSeqs) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Seqs[segID] = seqs
+	return m.saveLocked()
+}
+
+func (m *manifest) segmentSeqs(segID int) (segmentSeqs, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.Seqs[segID]
+	return s, ok
+}
+
+// seqBounds повертає LastSeq та CompactedSeq.
+func (m *manifest) seqBounds() (last, compacted uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.LastSeq, m.CompactedSeq
+}
+
+func (m *manifest) setFormat(segID int, format byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Formats[segID] == format {
+		return nil
+	}
+	m.Formats[segID] = format
+	return m.saveLocked()
+}
+
+// format повертає формат записів сегмента. Сегменти без відомостей вважаються форматом v1.
+func (m *manifest) format(segID int) byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.Formats[segID]; ok {
+		return f
+	}
+	return entryFormatV1
+}
+
+func (m *manifest) setEncryptionKeyLocked(segID int, keyID string) {
+	if keyID == "" {
+		delete(m.EncryptionKeys, segID)
+	} else {
+		m.EncryptionKeys[segID] = keyID
+	}
+}
+
+// encryptionKey повертає ключ, яким зашифровані всі значення сегмента, або "".
+func (m *manifest) encryptionKey(segID int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.EncryptionKeys[segID]
+}
+
+func (m *manifest) newestWrite(segID int) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.NewestWrites[segID]
+	return t, ok
+}
+
+func (m *manifest) validation(segID int) (SegmentValidation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.Segments[segID]
+	return v, ok
+}
+
+func (m *manifest) setMigrationApplied(name string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Migrations[name] = t
+	return m.saveLocked()
+}
+
+func (m *manifest) migrationApplied(name string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.Migrations[name]
+	return t, ok
+}
@@ -0,0 +1,643 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// mergePlan - знімок стану бази, за яким злиття копіює дані без блокування db.mu.
+// Сегменти, що зливаються, незмінні, а їх файли закриває лише саме злиття,
+// тож читати їх можна паралельно з записами та читаннями.
+type mergePlan struct {
+	segmentIDs []int
+	merging    map[int]bool
+	readers    map[int]io.ReaderAt
+	// keys - живі записи, що лежать у сегментах, які зливаються.
+	keys     map[string]indexValue
+	expiries map[string]int64
+	// series - блоки часових рядів у сегментах, що зливаються.
+	series map[string][]indexValue
+	// newest - час останнього запису в кожен сегмент плану (Unix нс).
+	newest map[int]int64
+	// purged - ключі, старші за політику зберігання, з їх правилом (префіксом).
+	purged map[string]purgedKey
+	// refKeys - ключі з keys, збережені як посилання на спільні значення, та вид їх запису.
+	refKeys map[string]byte
+	// blobs - спільні значення в сегментах плану, на які ще є посилання;
+	// deadBlobs - значення без посилань, які злиття відкидає.
+	blobs     map[blobHash]indexValue
+	deadBlobs map[blobHash]indexValue
+	// coldTombstones - видалені ключі з холодних сегментів, для яких злиття пише надгробки,
+	// див. coldtier.go.
+	coldTombstones []string
+	state          CompactionState
+	// background - фонове злиття, яке призупиняється під навантаженням читанням, див.
+	// throttle.go.
+	background bool
+}
+
+// purgedKey - ключ, що видаляється злиттям за політикою зберігання.
+type purgedKey struct {
+	idxVal indexValue
+	bucket string
+}
+
+// testHookMergeCopied, якщо задано, викликається після копіювання даних злиття,
+// до встановлення злитого сегмента.
+var testHookMergeCopied func()
+
+// mergeOutput - один вихідний сегмент злиття.
+type mergeOutput struct {
+	segID   int
+	tmpPath string
+	hints   []hintRecord
+	size    int64
+	// newest - найпізніший час запису серед перенесених записів (Unix нс).
+	newest int64
+}
+
+// noteSource враховує час останнього запису в сегмент, з якого перенесено запис.
+func (out *mergeOutput) noteSource(newest int64) {
+	if newest > out.newest {
+		out.newest = newest
+	}
+}
+
+// mergeResult - результат копіювання: нові місця записів та вихідні сегменти.
+type mergeResult struct {
+	keys    map[string]indexValue
+	series  map[string]indexValue
+	blobs   map[blobHash]indexValue
+	outputs []*mergeOutput
+}
+
+// planMergeLocked фіксує, що саме зливатиметься. Повертає nil, якщо зливати нічого.
+// Викликається під db.mu.
+func (db *Db) planMergeLocked() (*mergePlan, error) {
+	plan := &mergePlan{
+		merging:  make(map[int]bool),
+		readers:  make(map[int]io.ReaderAt),
+		keys:     make(map[string]indexValue),
+		expiries: make(map[string]int64),
+		series:   make(map[string][]indexValue),
+		newest:   make(map[int]int64),
+		purged:   make(map[string]purgedKey),
+		refKeys:  make(map[string]byte),
+	}
+	plan.segmentIDs = db.mergeableSegmentIDsLocked()
+	// Єдиний запечатаний сегмент зливається лише заради політики зберігання, міграції формату
+	// або шифрування.
+	if len(plan.segmentIDs) == 0 || len(plan.segmentIDs) < 2 && !db.opts.Retention.enabled() &&
+		db.manifest.format(plan.segmentIDs[0]) == entryFormatCurrent && !db.needsEncryptionLocked(plan.segmentIDs[0]) {
+		return nil, nil
+	}
+	for _, segID := range plan.segmentIDs {
+		plan.merging[segID] = true
+		plan.readers[segID], _ = db.segmentReaderLocked(segID)
+		plan.newest[segID] = db.segmentNewestWriteLocked(segID)
+	}
+	now := time.Now()
+	err := db.currentIndex.forEach(func(key string, idxVal indexValue) {
+		if !plan.merging[idxVal.segmentID] {
+			return
+		}
+		if bucket, expired := db.opts.Retention.expired(key, plan.newest[idxVal.segmentID], now); expired {
+			plan.purged[key] = purgedKey{idxVal: idxVal, bucket: bucket}
+			return
+		}
+		plan.keys[key] = idxVal
+		if expiresAt, ok := db.expiries[key]; ok {
+			plan.expiries[key] = expiresAt
+		}
+		if kind, ok := db.blobs.refKind(key); ok {
+			plan.refKeys[key] = kind
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.blobs, plan.deadBlobs = db.blobs.inSegments(plan.merging)
+	for key, chunks := range db.seriesIndex {
+		for _, idxVal := range chunks {
+			if plan.merging[idxVal.segmentID] {
+				plan.series[key] = append(plan.series[key], idxVal)
+			}
+		}
+	}
+	plan.coldTombstones = db.coldTombstonesLocked(plan.purged)
+	plan.state = db.compactionStateLocked(plan)
+	if len(plan.segmentIDs) < 2 && plan.state.ExpiredKeys == 0 && plan.state.LegacySegments == 0 && plan.state.UnencryptedSegments == 0 || !plan.state.reclaimable() {
+		return nil, nil
+	}
+	return plan, nil
+}
+
+// sealedSegmentIDsLocked повертає відсортовані ідентифікатори запечатаних сегментів.
+// Викликається під db.mu.
+func (db *Db) sealedSegmentIDsLocked() []int {
+	var segIDs []int
+	for segID := range db.segmentFiles {
+		if !db.isActiveLocked(segID) {
+			segIDs = append(segIDs, segID)
+		}
+	}
+	sort.Ints(segIDs)
+	return segIDs
+}
+
+// sealedStateLocked оцінює сегменти segIDs за обліком мертвого місця, не переглядаючи
+// індекс. Ключі, застарілі за політикою зберігання, тут вважаються живими.
+// Викликається під db.mu.
+func (db *Db) sealedStateLocked(segIDs []int) CompactionState {
+	state := CompactionState{SegmentCount: len(segIDs), MaxFileSize: db.opts.MaxFileSize}
+	for _, segID := range segIDs {
+		if stat, err := db.segmentFiles[segID].Stat(); err == nil {
+			state.TotalBytes += stat.Size()
+			state.LiveBytes += stat.Size() - db.segmentDeadLocked(segID, stat.Size())
+		}
+		if db.manifest.format(segID) < entryFormatCurrent {
+			state.LegacySegments++
+		}
+		if db.needsEncryptionLocked(segID) {
+			state.UnencryptedSegments++
+		}
+	}
+	return state
+}
+
+// compactionStateLocked оцінює запечатані сегменти плану. Викликається під db.mu.
+func (db *Db) compactionStateLocked(plan *mergePlan) CompactionState {
+	state := db.sealedStateLocked(plan.segmentIDs)
+	state.ExpiredKeys = len(plan.purged)
+	for key, p := range plan.purged {
+		state.LiveBytes -= p.idxVal.size
+		if expiresAt, ok := db.expiries[key]; ok {
+			state.LiveBytes -= expirySize(key, expiresAt)
+		}
+	}
+	for _, chunks := range plan.series {
+		if len(chunks) > 1 {
+			state.fragmentedSeries = true
+		}
+	}
+	return state
+}
+
+// performMerge зливає запечатані сегменти. Якщо policy не nil, злиття виконується
+// лише тоді, коли політика вважає його потрібним. Фонове злиття (background) між пакетами
+// записів чекає, поки затримка читань вище порогу. Скасування ctx перериває копіювання;
+// після встановлення злитих сегментів злиття вже не скасовується.
+func (db *Db) performMerge(ctx context.Context, policy CompactionPolicy, background bool) (CompactionReport, error) {
+	if err := db.advanceShards(); err != nil {
+		return CompactionReport{}, err
+	}
+	if policy != nil && !db.opts.Retention.enabled() {
+		// Без політики зберігання рішення залежить лише від обліку мертвого місця, тож
+		// план, що переглядає весь індекс, будується, лише коли злиття потрібне.
+		db.mu.RLock()
+		state := db.sealedStateLocked(db.mergeableSegmentIDsLocked())
+		db.mu.RUnlock()
+		if !policy.ShouldCompact(state) {
+			return CompactionReport{}, nil
+		}
+	}
+	db.mu.RLock()
+	plan, err := db.planMergeLocked()
+	db.mu.RUnlock()
+	if err != nil {
+		return CompactionReport{}, err
+	}
+	if plan == nil {
+		return CompactionReport{}, nil
+	}
+	plan.background = background
+	if policy != nil && plan.state.ExpiredKeys == 0 && !policy.ShouldCompact(plan.state) {
+		return CompactionReport{}, nil
+	}
+
+	mergeStart := time.Now()
+	result, err := db.copyMergedData(ctx, plan)
+	if err != nil {
+		return CompactionReport{}, err
+	}
+	if testHookMergeCopied != nil {
+		testHookMergeCopied()
+	}
+	if err := ctx.Err(); err != nil {
+		removeMergeOutputs(result.outputs)
+		return CompactionReport{}, err
+	}
+
+	// Звіт про повільне злиття надсилається після зняття db.mu.
+	defer func() {
+		db.reportSlow(SlowOp{Op: OpMerge, Elapsed: time.Since(mergeStart), Segments: plan.segmentIDs})
+	}()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.segMu.Lock()
+	purged, err := db.installMergedSegmentsLocked(plan, result)
+	db.segMu.Unlock()
+	if err != nil {
+		return CompactionReport{}, err
+	}
+	db.spillIndexLocked()
+	db.watch.prune()
+	db.mergeCount++
+	db.lastMergeTime = time.Since(mergeStart)
+	db.opts.Metrics.Count(MetricMerges, 1)
+	db.opts.Metrics.Observe(OpMerge, db.lastMergeTime)
+	return newCompactionReport(plan, result, purged, db.lastMergeTime), nil
+}
+
+// mergeWriter записує злиті дані у вихідні сегменти, переходячи до наступного,
+// коли поточний досягає MaxFileSize. Вихідні сегменти отримують ідентифікатори
+// сегментів, що зливаються, у порядку зростання; якщо ідентифікатори закінчилися,
+// решта даних дописується в останній сегмент.
+type mergeWriter struct {
+	dir     string
+	maxSize int64
+	ids     []int
+	file    *os.File
+	outputs []*mergeOutput
+}
+
+func (w *mergeWriter) current() *mergeOutput {
+	if len(w.outputs) == 0 {
+		return nil
+	}
+	return w.outputs[len(w.outputs)-1]
+}
+
+// write дописує data цілком в один вихідний сегмент і повертає його та зміщення запису.
+func (w *mergeWriter) write(data []byte) (*mergeOutput, int64, error) {
+	out := w.current()
+	if out == nil || w.maxSize > 0 && out.size > 0 && out.size+int64(len(data)) > w.maxSize && len(w.outputs) < len(w.ids) {
+		if err := w.next(); err != nil {
+			return nil, 0, err
+		}
+		out = w.current()
+	}
+	offset := out.size
+	if _, err := w.file.Write(data); err != nil {
+		return nil, 0, err
+	}
+	out.size += int64(len(data))
+	return out, offset, nil
+}
+
+func (w *mergeWriter) next() error {
+	if err := w.closeCurrent(); err != nil {
+		return err
+	}
+	segID := w.ids[len(w.outputs)]
+	tmpPath := filepath.Join(w.dir, fmt.Sprintf("%s%d%s.tmp", outFileNamePrefix, segID, mergeFileNameSuffix))
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("merge: failed to create temp merged file '%s': %w", tmpPath, err)
+	}
+	w.file = file
+	w.outputs = append(w.outputs, &mergeOutput{segID: segID, tmpPath: tmpPath})
+	return nil
+}
+
+func (w *mergeWriter) closeCurrent() error {
+	if w.file == nil {
+		return nil
+	}
+	file := w.file
+	w.file = nil
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("merge: failed to sync temp merged file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("merge: failed to close temp merged file: %w", err)
+	}
+	return nil
+}
+
+// finish закриває останній вихідний сегмент. Якщо живих даних немає, створює порожній.
+func (w *mergeWriter) finish() error {
+	if len(w.outputs) == 0 {
+		if err := w.next(); err != nil {
+			return err
+		}
+	}
+	return w.closeCurrent()
+}
+
+func (w *mergeWriter) abort() {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	removeMergeOutputs(w.outputs)
+}
+
+func removeMergeOutputs(outputs []*mergeOutput) {
+	for _, out := range outputs {
+		_ = os.Remove(out.tmpPath)
+	}
+}
+
+// copyMergedData записує живі дані сегментів плану у тимчасові файли. Виконується без db.mu.
+func (db *Db) copyMergedData(ctx context.Context, plan *mergePlan) (*mergeResult, error) {
+	w := &mergeWriter{dir: db.dir, maxSize: db.opts.MaxFileSize, ids: plan.segmentIDs}
+	result := &mergeResult{
+		keys:   make(map[string]indexValue, len(plan.keys)),
+		series: make(map[string]indexValue),
+		blobs:  make(map[blobHash]indexValue, len(plan.blobs)),
+	}
+	if err := db.writeMergedData(ctx, plan, result, w); err != nil {
+		w.abort()
+		return nil, err
+	}
+	if err := w.finish(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	result.outputs = w.outputs
+	return result, nil
+}
+
+func (db *Db) writeMergedData(ctx context.Context, plan *mergePlan, result *mergeResult, w *mergeWriter) error {
+	if err := db.writeMergedBlobs(ctx, plan, result, w); err != nil {
+		return err
+	}
+	// Копіюємо записи в порядку їх розташування, щоб читання кожного сегмента були послідовними.
+	keys := make([]string, 0, len(plan.keys))
+	for key := range plan.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := plan.keys[keys[i]], plan.keys[keys[j]]
+		if a.segmentID != b.segmentID {
+			return a.segmentID < b.segmentID
+		}
+		return a.offset < b.offset
+	})
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if plan.background && i > 0 && i%mergeThrottleBatch == 0 {
+			if err := db.waitMergeThrottle(ctx); err != nil {
+				return err
+			}
+		}
+		idxVal := plan.keys[key]
+		entryData := make([]byte, idxVal.size)
+		if _, readErr := plan.readers[idxVal.segmentID].ReadAt(entryData, idxVal.offset); readErr != nil {
+			return fmt.Errorf("merge: failed to read entry for key '%s' from segment %d: %w", key, idxVal.segmentID, readErr)
+		}
+		entryData, err := upgradeRecord(entryData)
+		if err == nil {
+			entryData, err = db.reseal(entryData)
+		}
+		if err != nil {
+			return fmt.Errorf("merge: invalid entry for key '%s' in segment %d: %w", key, idxVal.segmentID, err)
+		}
+		size := int64(len(entryData))
+		// Термін дії пишемо одразу після значення в той самий сегмент: при завантаженні
+		// запис значення скидає термін, тож запис терміну має йти після нього.
+		var expiryData []byte
+		if expiresAt, ok := plan.expiries[key]; ok {
+			expiryData = encodeExpiry(key, expiresAt)
+		}
+		out, offset, writeErr := w.write(append(entryData, expiryData...))
+		if writeErr != nil {
+			return fmt.Errorf("merge: failed to write entry for key '%s' to merged file: %w", key, writeErr)
+		}
+		out.noteSource(plan.newest[idxVal.segmentID])
+		result.keys[key] = indexValue{segmentID: out.segID, offset: offset, size: size, dataType: idxVal.dataType}
+		hintType := idxVal.dataType
+		if kind, ok := plan.refKeys[key]; ok {
+			hintType = kind
+		}
+		out.hints = append(out.hints, hintRecord{key: key, offset: offset, size: size, dataType: hintType})
+		if expiryData != nil {
+			out.hints = append(out.hints, hintRecord{key: key, offset: offset + size, size: int64(len(expiryData)), dataType: dataTypeExpiry})
+		}
+	}
+	if err := writeColdTombstones(plan, w); err != nil {
+		return err
+	}
+	return db.mergeSeries(ctx, plan, result, w)
+}
+
+// writeColdTombstones пише надгробки видалених ключів з холодних сегментів замість
+// надгробків, які злиття відкидає.
+func writeColdTombstones(plan *mergePlan, w *mergeWriter) error {
+	now := time.Now().UnixNano()
+	for _, key := range plan.coldTombstones {
+		tombstone := entry{key: key, dataType: dataTypeTombstone, timestamp: now}
+		data := tombstone.Encode()
+		out, offset, err := w.write(data)
+		if err != nil {
+			return fmt.Errorf("merge: failed to write tombstone for cold key '%s': %w", key, err)
+		}
+		out.hints = append(out.hints, hintRecord{key: key, offset: offset, size: int64(len(data)), dataType: dataTypeTombstone})
+	}
+	return nil
+}
+
+// writeMergedBlobs переносить спільні значення, на які ще є посилання.
+func (db *Db) writeMergedBlobs(ctx context.Context, plan *mergePlan, result *mergeResult, w *mergeWriter) error {
+	hashes := make([]blobHash, 0, len(plan.blobs))
+	for h := range plan.blobs {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		a, b := plan.blobs[hashes[i]], plan.blobs[hashes[j]]
+		if a.segmentID != b.segmentID {
+			return a.segmentID < b.segmentID
+		}
+		return a.offset < b.offset
+	})
+	for _, h := range hashes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		loc := plan.blobs[h]
+		data := make([]byte, loc.size)
+		if _, err := plan.readers[loc.segmentID].ReadAt(data, loc.offset); err != nil {
+			return fmt.Errorf("merge: failed to read shared value %s from segment %d: %w", h, loc.segmentID, err)
+		}
+		data, err := upgradeRecord(data)
+		if err == nil {
+			data, err = db.reseal(data)
+		}
+		if err != nil {
+			return fmt.Errorf("merge: invalid shared value %s in segment %d: %w", h, loc.segmentID, err)
+		}
+		out, offset, err := w.write(data)
+		if err != nil {
+			return fmt.Errorf("merge: failed to write shared value %s to merged file: %w", h, err)
+		}
+		out.noteSource(plan.newest[loc.segmentID])
+		result.blobs[h] = indexValue{segmentID: out.segID, offset: offset, size: int64(len(data)), dataType: dataTypeBlob}
+		out.hints = append(out.hints, hintRecord{key: h.String(), offset: offset, size: int64(len(data)), dataType: dataTypeBlob})
+	}
+	return nil
+}
+
+// installMergedSegmentsLocked замінює сегменти плану злитими файлами і переводить на них індекс.
+// Ключі, змінені або видалені під час копіювання, залишаються на своїх нових місцях.
+// Повертає кількість ключів, видалених політикою зберігання.
+// Викликається під db.mu та db.segMu.
+func (db *Db) installMergedSegmentsLocked(plan *mergePlan, result *mergeResult) (int64, error) {
+	if err := db.dropMergedTablesLocked(plan); err != nil {
+		removeMergeOutputs(result.outputs)
+		return 0, err
+	}
+	now := time.Now()
+	archive := db.newSegmentArchiveLocked(now)
+	outputIDs := make(map[int]bool, len(result.outputs))
+	for i, out := range result.outputs {
+		if err := db.replaceSegmentFileLocked(out, archive); err != nil {
+			removeMergeOutputs(result.outputs[i:])
+			return 0, err
+		}
+		outputIDs[out.segID] = true
+	}
+	if err := fsutil.SyncDir(db.dir); err != nil {
+		db.opts.Logger.Warnf("merge: %v", err)
+	}
+
+	for key, val := range result.keys {
+		db.currentIndex.replace(key, plan.keys[key], val)
+	}
+	db.versions.forgetMerged(plan.merging, db.currentIndex.get)
+	for h, loc := range result.blobs {
+		db.blobs.relocate(h, plan.blobs[h], loc)
+	}
+	for h, loc := range plan.deadBlobs {
+		db.blobs.forget(h, loc)
+	}
+	purged := make(map[string]int64)
+	var purgedTotal int64
+	for key, p := range plan.purged {
+		if current, ok := db.currentIndex.get(key); ok && current == p.idxVal {
+			db.removeKeyLocked(key)
+			// Видалення політикою зберігання не пишеться в сегмент, але отримує номер,
+			// щоб розбудити тих, хто чекає на зміну ключа.
+			db.seq++
+			db.watch.notifyDelete(key, db.seq)
+			purged[p.bucket]++
+			purgedTotal++
+		}
+	}
+	db.recordRetentionLocked(purged)
+	for key, mergedChunk := range result.series {
+		var current, remaining []indexValue
+		for _, idxVal := range db.seriesIndex[key] {
+			if plan.merging[idxVal.segmentID] {
+				current = append(current, idxVal)
+			} else {
+				remaining = append(remaining, idxVal)
+			}
+		}
+		if !sameChunks(current, plan.series[key]) {
+			continue
+		}
+		db.seriesIndex[key] = append([]indexValue{mergedChunk}, remaining...)
+	}
+	for _, out := range result.outputs {
+		if err := writeHintFile(db.dir, out.segID, out.size, out.hints); err != nil {
+			db.opts.Logger.Warnf("merge: %v", err)
+		}
+		db.setSegmentBloomLocked(out.segID, out.hints)
+		db.mapSegmentLocked(out.segID)
+	}
+	db.writeMergedTablesLocked(result.outputs)
+
+	for _, segIDToRemove := range plan.segmentIDs {
+		if outputIDs[segIDToRemove] {
+			continue
+		}
+		if oldFile, ok := db.segmentFiles[segIDToRemove]; ok {
+			db.unmapSegmentLocked(segIDToRemove)
+			delete(db.segmentFiles, segIDToRemove)
+			filePathToRemove := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segIDToRemove))
+			if removeErr := db.retireSegmentFileLocked(oldFile, filePathToRemove, archive); removeErr != nil {
+				db.opts.Logger.Warnf("merge: failed to remove or archive old segment file %s: %v", filePathToRemove, removeErr)
+			}
+			_ = os.Remove(hintFilePath(db.dir, segIDToRemove))
+			_ = os.Remove(bloomFilePath(db.dir, segIDToRemove))
+			delete(db.blooms, segIDToRemove)
+		}
+	}
+	newest := make(map[int]int64, len(result.outputs))
+	for _, out := range result.outputs {
+		newest[out.segID] = out.newest
+	}
+	if err := db.manifest.replaceSegments(plan.segmentIDs, newest, db.seq, db.keys.currentID()); err != nil {
+		db.opts.Logger.Warnf("merge: %v", err)
+	}
+	db.recountLiveLocked()
+	db.recountDiskLocked()
+	for _, out := range result.outputs {
+		db.validateSegmentAsync(out.segID, out.hints)
+	}
+	if archive != nil {
+		db.pruneArchive(now)
+	}
+	return purgedTotal, nil
+}
+
+// replaceSegmentFileLocked підміняє файл сегмента out.segID злитим тимчасовим файлом.
+// Старий файл переноситься в archive або видаляється, якщо archive nil.
+// Викликається під db.mu та db.segMu.
+func (db *Db) replaceSegmentFileLocked(out *mergeOutput, archive *segmentArchive) error {
+	finalPath := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, out.segID))
+
+	db.unmapSegmentLocked(out.segID)
+	_ = os.Remove(hintFilePath(db.dir, out.segID))
+	_ = os.Remove(bloomFilePath(db.dir, out.segID))
+	oldTargetFile, hasOld := db.segmentFiles[out.segID]
+	delete(db.segmentFiles, out.segID)
+	var errRemoveOld error
+	switch {
+	case hasOld && archive == nil && !db.isPinned(oldTargetFile):
+		// Злитий файл атомарно заміняє старий: після збою на диску залишається один з них.
+		// Windows не замінює відкритий файл, тож старий дескриптор закривається заздалегідь.
+		if err := oldTargetFile.Close(); err != nil {
+			db.opts.Logger.Warnf("merge: error closing old segment file %s: %v", finalPath, err)
+		}
+	case hasOld:
+		errRemoveOld = db.retireSegmentFileLocked(oldTargetFile, finalPath, archive)
+	case archive != nil:
+		errRemoveOld = archive.retire(finalPath)
+	}
+	if errRemoveOld != nil {
+		return fmt.Errorf("merge: failed to remove old target file '%s' before rename: %w", finalPath, errRemoveOld)
+	}
+	if renameErr := fsutil.Rename(out.tmpPath, finalPath); renameErr != nil {
+		return fmt.Errorf("merge: failed to rename temp merged file '%s' to '%s': %w", out.tmpPath, finalPath, renameErr)
+	}
+	mergedSegmentReadOnly, openErr := os.OpenFile(finalPath, os.O_RDONLY, 0644)
+	if openErr != nil {
+		return fmt.Errorf("merge: CRITICAL: failed to open final merged segment '%s' for reading after rename: %w", finalPath, openErr)
+	}
+	db.segmentFiles[out.segID] = mergedSegmentReadOnly
+	return nil
+}
+
+func sameChunks(a, b []indexValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
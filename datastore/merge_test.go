@@ -0,0 +1,160 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDb_MergeDoesNotBlockAndKeepsConcurrentWrites(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	dir := db.dir
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("mergeKey%03d", i), fmt.Sprintf("old%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AppendSeries("mergeSeries", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 80; i < 120; i++ {
+		if err := db.Put(fmt.Sprintf("mergeKey%03d", i), fmt.Sprintf("old%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Перезаписані значення дають злиттю мертві записи, які варто прибрати.
+	for i := 60; i < 70; i++ {
+		if err := db.Put(fmt.Sprintf("mergeKey%03d", i), fmt.Sprintf("old%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Поки злиття копіює дані, база має обслуговувати читання й записи.
+	testHookMergeCopied = func() {
+		if v, err := db.Get("mergeKey001"); err != nil || v != "old001" {
+			t.Errorf("Get during merge = %q, %v", v, err)
+		}
+		if err := db.Put("mergeKey000", "new000"); err != nil {
+			t.Errorf("Put during merge failed: %v", err)
+		}
+		if err := db.Delete("mergeKey002"); err != nil {
+			t.Errorf("Delete during merge failed: %v", err)
+		}
+		if err := db.AppendSeries("mergeSeries", SeriesPoint{Timestamp: 2, Value: 2}); err != nil {
+			t.Errorf("AppendSeries during merge failed: %v", err)
+		}
+	}
+	defer func() { testHookMergeCopied = nil }()
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	testHookMergeCopied = nil
+	if stats, _ := db.Stats(); stats.MergeCount != 1 {
+		t.Fatalf("expected one merge, got %d", stats.MergeCount)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if v, err := db.Get("mergeKey000"); err != nil || v != "new000" {
+			t.Errorf("%s: write made during merge was lost: %q, %v", stage, v, err)
+		}
+		if _, err := db.Get("mergeKey002"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: delete made during merge was lost: %v", stage, err)
+		}
+		if v, err := db.Get("mergeKey050"); err != nil || v != "old050" {
+			t.Errorf("%s: Get(mergeKey050) = %q, %v", stage, v, err)
+		}
+		points, err := db.GetSeries("mergeSeries", 0, 10)
+		if err != nil || len(points) != 2 {
+			t.Errorf("%s: series points %+v, %v", stage, points, err)
+		}
+	}
+	check("after merge")
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
+
+func TestDb_MergeRespectsMaxFileSize(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	dir := db.dir
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 150; i++ {
+			if err := db.Put(fmt.Sprintf("sizeKey%03d", i), fmt.Sprintf("value%d_%03d", round, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if round == 0 {
+			if err := db.Copy("sizeKey000", "sizeTTL", CopyOptions{TTL: time.Hour}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := 0
+	for _, seg := range segments {
+		if seg.Active {
+			continue
+		}
+		sealed++
+		if seg.Size > testMaxFileSize {
+			t.Errorf("merged segment %d has size %d, exceeding MaxFileSize %d", seg.ID, seg.Size, testMaxFileSize)
+		}
+	}
+	if sealed < 2 {
+		t.Errorf("expected live data to span several merged segments, got %+v", segments)
+	}
+
+	stats, _ := db.Stats()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := db.Stats(); again.MergeCount != stats.MergeCount {
+		t.Errorf("merge without dead records rewrote segments again")
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		for i := 0; i < 150; i++ {
+			want := fmt.Sprintf("value1_%03d", i)
+			if v, err := db.Get(fmt.Sprintf("sizeKey%03d", i)); err != nil || v != want {
+				t.Errorf("%s: Get(sizeKey%03d) = %q, %v, want %q", stage, i, v, err, want)
+			}
+		}
+		if v, err := db.Get("sizeTTL"); err != nil || v != "value0_000" {
+			t.Errorf("%s: Get(sizeTTL) = %q, %v", stage, v, err)
+		}
+		if _, ok := db.ExpiresAt("sizeTTL"); !ok {
+			t.Errorf("%s: expiry of sizeTTL was lost", stage)
+		}
+	}
+	check("after merge")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
@@ -0,0 +1,43 @@
+package datastore
+
+import "time"
+
+// EntryMeta - метадані поточного значення ключа.
+type EntryMeta struct {
+	// Timestamp - час запису значення. Нульовий для значень, записаних у форматі без часу
+	// (до міграції такі значення зберігають нульовий час і після злиття).
+	Timestamp time.Time `json:"timestamp"`
+	// SegmentID - сегмент, у якому лежить запис.
+	SegmentID int `json:"segment"`
+	// Size - розмір запису на диску в байтах.
+	Size int64 `json:"size"`
+	// DataType - тип значення.
+	DataType byte `json:"type"`
+	// Seq - номер запису значення; нульовий для записів у форматі без номера.
+	// За ним VersionAt знаходить цю версію після перезапису ключа.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// GetWithMeta повертає значення ключа разом з його метаданими, прочитані атомарно.
+// Часові ряди не мають єдиного запису, тож для них повертається ErrNotFound, як і в GetWithETag.
+func (db *Db) GetWithMeta(key string) (KeyValue, EntryMeta, error) {
+	defer db.observeRead(time.Now(), key)
+	db.segMu.RLock()
+	defer db.segMu.RUnlock()
+	idxVal, ok, err := db.lookupForRead(key)
+	if err != nil {
+		return KeyValue{}, EntryMeta{}, err
+	}
+	if !ok {
+		return KeyValue{}, EntryMeta{}, ErrNotFound
+	}
+	record, err := db.readRecordLocked(key, idxVal)
+	if err != nil {
+		return KeyValue{}, EntryMeta{}, err
+	}
+	meta := EntryMeta{SegmentID: idxVal.segmentID, Size: idxVal.size, DataType: idxVal.dataType, Seq: record.seq}
+	if record.timestamp != 0 {
+		meta.Timestamp = time.Unix(0, record.timestamp)
+	}
+	return record.keyValue(), meta, nil
+}
@@ -0,0 +1,53 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDb_GetWithMeta(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	before := time.Now()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 7); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	kv, meta, err := db.GetWithMeta("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kv.Value != "value" || meta.DataType != DataTypeString || meta.SegmentID != 0 || meta.Size <= 0 {
+		t.Errorf("GetWithMeta = %+v, %+v", kv, meta)
+	}
+	if meta.Timestamp.Before(before) || meta.Timestamp.After(after) {
+		t.Errorf("timestamp %v is outside of the write window [%v, %v]", meta.Timestamp, before, after)
+	}
+	if kv, meta, err := db.GetWithMeta("counter"); err != nil || kv.Value != int64(7) || meta.DataType != DataTypeInt64 {
+		t.Errorf("GetWithMeta(counter) = %+v, %+v, %v", kv, meta, err)
+	}
+	if _, _, err := db.GetWithMeta("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetWithMeta(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Злиття переносить запис разом з часом запису.
+	written := meta.Timestamp
+	for i := 0; i < 100; i++ {
+		if err := db.Put("filler", "some filler value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, meta, err := db.GetWithMeta("key"); err != nil || !meta.Timestamp.Equal(written) {
+		t.Errorf("timestamp after merge = %v, %v; want %v", meta.Timestamp, err, written)
+	}
+}
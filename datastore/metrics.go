@@ -0,0 +1,56 @@
+package datastore
+
+import "time"
+
+// Імена лічильників, які база передає MetricsCollector.Count.
+const (
+	// MetricPuts - успішно застосовані записи значень (без видалень).
+	MetricPuts = "puts"
+	// MetricGets - ключі, запитані операціями читання.
+	MetricGets = "gets"
+	// MetricMisses - точкові читання ключів, яких немає в базі.
+	MetricMisses = "misses"
+	// MetricMerges - завершені злиття сегментів.
+	MetricMerges = "merges"
+	// MetricBytesWritten - байти, дописані в активний сегмент.
+	MetricBytesWritten = "bytes_written"
+)
+
+// Імена операцій, тривалість яких база передає MetricsCollector.Observe.
+const (
+	// OpWrite - запит на запис від передачі в чергу до отримання результату.
+	OpWrite = "write"
+	// OpRead - операція читання.
+	OpRead = "read"
+	// OpMerge - злиття сегментів.
+	OpMerge = "merge"
+)
+
+// MetricsCollector отримує лічильники та тривалості операцій бази, щоб застосунок міг
+// передати їх у свою систему моніторингу. Методи викликаються з різних горутин, зокрема
+// під замками бази, тому мають бути потокобезпечними й не блокуватися.
+type MetricsCollector interface {
+	// Count збільшує лічильник metric на delta.
+	Count(metric string, delta int64)
+	// Observe записує тривалість однієї операції op.
+	Observe(op string, d time.Duration)
+}
+
+// NopMetrics - MetricsCollector, що відкидає всі виміри. Використовується за замовчуванням.
+type NopMetrics struct{}
+
+func (NopMetrics) Count(string, int64)           {}
+func (NopMetrics) Observe(string, time.Duration) {}
+
+// lookupForRead шукає ключ в індексі для точкового читання, враховуючи промах. Помилку
+// повертає лише читання файлу індексу з DiskIndex.
+func (db *Db) lookupForRead(key string) (indexValue, bool, error) {
+	idxVal, ok, err := db.currentIndex.lookup(key)
+	if err != nil {
+		return indexValue{}, false, err
+	}
+	if !ok {
+		db.opts.Metrics.Count(MetricMisses, 1)
+	}
+	return idxVal, ok, nil
+}
@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	observed map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counters: make(map[string]int64), observed: make(map[string]int)}
+}
+
+func (m *recordingMetrics) Count(metric string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[metric] += delta
+}
+
+func (m *recordingMetrics) Observe(op string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observed[op]++
+}
+
+func (m *recordingMetrics) counter(metric string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metric]
+}
+
+func (m *recordingMetrics) observations(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.observed[op]
+}
+
+func TestDb_MetricsCollector(t *testing.T) {
+	metrics := newRecordingMetrics()
+	opts := testOptions(true)
+	opts.Metrics = metrics
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	padding := strings.Repeat("p", 300)
+	for _, key := range []string{"a", "b", "c", "a", "b", "a", "b", "c"} {
+		if err := db.Put(key, padding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("c"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a deleted key returned %v", err)
+	}
+	if _, err := db.GetMany([]string{"a", "b", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	for metric, want := range map[string]int64{MetricPuts: 8, MetricGets: 5, MetricMisses: 2, MetricMerges: 1} {
+		if got := metrics.counter(metric); got != want {
+			t.Errorf("counter %s = %d, want %d", metric, got, want)
+		}
+	}
+	if got := metrics.counter(MetricBytesWritten); got <= 8*300 {
+		t.Errorf("bytes_written = %d, want more than the %d bytes of values", got, 8*300)
+	}
+	for op, want := range map[string]int{OpWrite: 9, OpRead: 3, OpMerge: 1} {
+		if got := metrics.observations(op); got != want {
+			t.Errorf("%d observations of %s, want %d", got, op, want)
+		}
+	}
+}
+
+func TestOptions_DefaultMetricsAreNop(t *testing.T) {
+	if _, ok := (Options{}).withDefaults().Metrics.(NopMetrics); !ok {
+		t.Error("withDefaults does not set NopMetrics")
+	}
+}
@@ -0,0 +1,189 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// migration - крок оновлення даних, що виконується один раз для кожної бази.
+// Виконані кроки записуються в маніфест, тож при наступних відкриттях вони пропускаються.
+// Нові кроки додаються лише в кінець списку migrations і не перейменовуються.
+type migration struct {
+	name        string
+	description string
+	run         func(db *Db, progress func(format string, args ...any)) error
+}
+
+var migrations = []migration{
+	{
+		name:        "segment-checksums",
+		description: "record checksums of sealed segments validated before the manifest existed",
+		run:         (*Db).migrateSegmentChecksums,
+	},
+	{
+		name:        "entry-format-v3",
+		description: "re-encode entries of older formats into the current one",
+		run:         (*Db).migrateEntryFormat,
+	},
+	{
+		name:        "segment-hints",
+		description: "build missing hint files for sealed segments",
+		run:         (*Db).migrateSegmentHints,
+	},
+}
+
+// MigrationStatus - стан кроку міграції бази.
+type MigrationStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// AppliedAt - час виконання кроку; nil, якщо крок ще не виконано.
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Migrations повертає кроки міграції в порядку виконання разом з їх станом.
+func (db *Db) Migrations() []MigrationStatus {
+	result := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Name: m.name, Description: m.description}
+		if t, ok := db.manifest.migrationApplied(m.name); ok {
+			status.AppliedAt = &t
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// Migrate виконує невиконані кроки міграції по черзі. Зупиняється на першій помилці;
+// виконані до неї кроки залишаються записаними в маніфесті.
+func (db *Db) Migrate() error {
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := db.manifest.migrationApplied(m.name); !ok {
+			pending++
+		}
+	}
+	done := 0
+	for _, m := range migrations {
+		if _, ok := db.manifest.migrationApplied(m.name); ok {
+			continue
+		}
+		done++
+		prefix := fmt.Sprintf("Migration %d/%d %s", done, pending, m.name)
+		db.opts.Logger.Infof("%s: %s", prefix, m.description)
+		start := time.Now()
+		progress := func(format string, args ...any) {
+			db.opts.Logger.Infof("%s: %s", prefix, fmt.Sprintf(format, args...))
+		}
+		err := m.run(db, progress)
+		if err == nil {
+			err = db.manifest.setMigrationApplied(m.name, time.Now())
+		}
+		db.Audit(AuditEntry{Op: AuditMigration, Details: m.name}, err)
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+		db.opts.Logger.Infof("%s: done in %s", prefix, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// sealedSegmentIDs повертає відсортовані ідентифікатори запечатаних сегментів. Викликається під db.mu.
+func (db *Db) sealedSegmentIDs() []int {
+	ids := make([]int, 0, len(db.segmentFiles))
+	for segID := range db.segmentFiles {
+		if !db.isActiveLocked(segID) {
+			ids = append(ids, segID)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// sealedSegmentHints повертає записи індексу запечатаного сегмента з файлу підказок,
+// а якщо він недійсний - скануванням сегмента. Викликається під db.mu.
+func (db *Db) sealedSegmentHints(segID int) ([]hintRecord, int64, error) {
+	path := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID))
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if records, err := readHintFile(db.dir, segID, stat.Size()); err == nil {
+		return records, stat.Size(), nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	records, _, err := db.loadIndexFromSegmentFile(file, segID, false)
+	return records, stat.Size(), err
+}
+
+// migrateSegmentChecksums перевіряє сегменти, для яких у маніфесті немає контрольної суми.
+func (db *Db) migrateSegmentChecksums(progress func(string, ...any)) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var missing []int
+	for _, segID := range db.sealedSegmentIDs() {
+		if _, ok := db.manifest.validation(segID); !ok {
+			missing = append(missing, segID)
+		}
+	}
+	for i, segID := range missing {
+		records, _, err := db.sealedSegmentHints(segID)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", segID, err)
+		}
+		result, err := validateSegment(filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID)), records)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", segID, err)
+		}
+		if result.Error != "" {
+			db.opts.Logger.Warnf("validation of segment %d failed: %s", segID, result.Error)
+		}
+		if err := db.manifest.setValidation(segID, result); err != nil {
+			return err
+		}
+		progress("segment %d checksum %s (%d/%d)", segID, result.Checksum, i+1, len(missing))
+	}
+	return nil
+}
+
+// migrateEntryFormat зливає сегменти із записами старих форматів, див. MigrateFormat.
+func (db *Db) migrateEntryFormat(progress func(string, ...any)) error {
+	report, err := db.MigrateFormat(context.Background())
+	if err != nil {
+		return err
+	}
+	progress("re-encoded %d segments into %d", report.SegmentsMerged, report.SegmentsWritten)
+	return nil
+}
+
+// migrateSegmentHints записує файли підказок для сегментів, у яких їх немає або вони застаріли.
+func (db *Db) migrateSegmentHints(progress func(string, ...any)) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, segID := range db.sealedSegmentIDs() {
+		path := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID))
+		stat, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", segID, err)
+		}
+		if _, err := readHintFile(db.dir, segID, stat.Size()); err == nil {
+			continue
+		}
+		records, size, err := db.sealedSegmentHints(segID)
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", segID, err)
+		}
+		if err := writeHintFile(db.dir, segID, size, records); err != nil {
+			return err
+		}
+		progress("wrote hints for segment %d (%d entries)", segID, len(records))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDb_MigrateOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	// Два сегменти без маніфесту та файлів підказок із записами v1.
+	for segID := 0; segID < 2; segID++ {
+		var legacy []byte
+		for i := 0; i < 5; i++ {
+			key := fmt.Sprintf("key%d-%d", segID, i)
+			legacy = append(legacy, encodeV1(entry{key: key, value: "old-" + key, dataType: DataTypeString})...)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID)), legacy, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := testOptions(true)
+	opts.NoMigrate = true
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range db.Migrations() {
+		if m.AppliedAt != nil {
+			t.Errorf("migration %s applied with NoMigrate", m.Name)
+		}
+	}
+	if stats, _ := db.Stats(); stats.LegacySegments == 0 {
+		t.Error("LegacySegments = 0 with NoMigrate, want legacy segments left in place")
+	}
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := make(map[string]time.Time)
+	for _, m := range db.Migrations() {
+		if m.AppliedAt == nil {
+			t.Errorf("migration %s is pending after open", m.Name)
+			continue
+		}
+		applied[m.Name] = *m.AppliedAt
+	}
+	for segID := 0; segID < 2; segID++ {
+		for i := 0; i < 5; i++ {
+			key := fmt.Sprintf("key%d-%d", segID, i)
+			if v, err := db.Get(key); err != nil || v != "old-"+key {
+				t.Errorf("Get(%s) after migration = %q, %v", key, v, err)
+			}
+		}
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		if segment.Active {
+			continue
+		}
+		if _, err := os.Stat(hintFilePath(dir, segment.ID)); err != nil {
+			t.Errorf("segment %d has no hint file after migration: %v", segment.ID, err)
+		}
+	}
+	db.Close()
+
+	// Повторне відкриття не виконує кроки знову.
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, m := range db.Migrations() {
+		if m.AppliedAt == nil || !m.AppliedAt.Equal(applied[m.Name]) {
+			t.Errorf("migration %s applied at %v after reopen, want %s", m.Name, m.AppliedAt, applied[m.Name])
+		}
+	}
+}
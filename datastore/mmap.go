@@ -0,0 +1,89 @@
+package datastore
+
+import (
+	"errors"
+	"io"
+)
+
+// errMmapUnsupported повертається на платформах без підтримки відображення файлів у пам'ять.
+var errMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// mappedSegment - відображений у пам'ять незмінний сегмент.
+type mappedSegment struct {
+	data []byte
+}
+
+// ReadAt реалізує io.ReaderAt поверх відображеної пам'яті.
+func (m *mappedSegment) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// mapSegmentLocked відображає запечатаний сегмент у пам'ять, якщо це увімкнено в Options.
+// При помилці читання продовжуються через ReadAt. Викликається під db.mu та db.segMu.
+func (db *Db) mapSegmentLocked(segID int) {
+	if !db.opts.MmapSealedSegments {
+		return
+	}
+	if _, mapped := db.mmaps[segID]; mapped {
+		return
+	}
+	file, ok := db.segmentFiles[segID]
+	if !ok {
+		return
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.Size() == 0 {
+		return
+	}
+	data, err := mmapFile(file, stat.Size())
+	if errors.Is(err, errMmapUnsupported) {
+		return
+	}
+	if err != nil {
+		db.opts.Logger.Warnf("failed to mmap segment %d, falling back to ReadAt: %v", segID, err)
+		return
+	}
+	db.mmaps[segID] = &mappedSegment{data: data}
+}
+
+// unmapSegmentLocked знімає відображення сегмента. Його треба викликати до закриття,
+// перейменування чи видалення файлу: на Windows відображений файл не можна видалити.
+// Викликається під db.mu та db.segMu.
+func (db *Db) unmapSegmentLocked(segID int) {
+	m, ok := db.mmaps[segID]
+	if !ok {
+		return
+	}
+	delete(db.mmaps, segID)
+	if err := munmapFile(m.data); err != nil {
+		db.opts.Logger.Warnf("failed to unmap segment %d: %v", segID, err)
+	}
+}
+
+// segmentReaderLocked повертає джерело читання сегмента: відображення, якщо воно є,
+// інакше файл; для активного сегмента - разом із ще не дописаними записами пакета,
+// для архівованого - холодне сховище.
+// Викликається під db.mu або db.segMu.
+func (db *Db) segmentReaderLocked(segID int) (io.ReaderAt, bool) {
+	if m, ok := db.mmaps[segID]; ok {
+		return m, true
+	}
+	file, ok := db.segmentFiles[segID]
+	if !ok {
+		if seg, cold := db.coldSegments[segID]; cold {
+			return seg, true
+		}
+		return nil, false
+	}
+	if sh := db.activeShardLocked(segID); sh != nil {
+		return activeSegmentReader{file: file, sh: sh}, true
+	}
+	return file, true
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package datastore
+
+import "os"
+
+func mmapFile(_ *os.File, _ int64) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmapFile(_ []byte) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package datastore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDb_MmapSealedSegments(t *testing.T) {
+	opts := testOptions(true)
+	opts.MmapSealedSegments = true
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("mmapKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.PutInt64("mmapInt", 42); err != nil {
+		t.Fatal(err)
+	}
+	checkValues := func(stage string) {
+		t.Helper()
+		for i := 0; i < 80; i++ {
+			if v, err := db.Get(fmt.Sprintf("mmapKey%03d", i)); err != nil || v != fmt.Sprintf("value%03d", i) {
+				t.Fatalf("%s: Get(mmapKey%03d) = %q, %v", stage, i, v, err)
+			}
+		}
+		if v, err := db.GetInt64("mmapInt"); err != nil || v != 42 {
+			t.Fatalf("%s: GetInt64(mmapInt) = %d, %v", stage, v, err)
+		}
+	}
+
+	db.mu.RLock()
+	mapped := len(db.mmaps)
+	_, activeMapped := db.mmaps[db.shards[0].segmentID]
+	db.mu.RUnlock()
+	if mapped == 0 {
+		t.Skip("mmap is not available on this platform")
+	}
+	if activeMapped {
+		t.Errorf("active segment must not be mapped")
+	}
+	checkValues("after rotation")
+
+	if err := db.Merge(); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	checkValues("after merge")
+	db.mu.RLock()
+	for segID := range db.mmaps {
+		if _, ok := db.segmentFiles[segID]; !ok {
+			t.Errorf("segment %d is still mapped after being merged away", segID)
+		}
+	}
+	db.mu.RUnlock()
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	checkValues("after reopen")
+}
@@ -0,0 +1,272 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMergeInterval = 10 * time.Second
+	defaultPutQueueDepth = 100
+	defaultPutQueueBytes = 64 * 1024 * 1024
+	defaultSyncInterval  = time.Second
+)
+
+// SyncPolicy визначає, коли записи в активний сегмент скидаються на диск (fsync).
+type SyncPolicy int
+
+const (
+	// SyncNever покладається на операційну систему для скидання даних на диск.
+	SyncNever SyncPolicy = iota
+	// SyncAlways підтверджує запис лише після fsync. Записи, що надійшли одночасно,
+	// скидаються на диск одним fsync (group commit).
+	SyncAlways
+	// SyncEveryInterval викликає fsync не рідше ніж раз на SyncInterval.
+	// Підтверджені записи за останній інтервал можуть бути втрачені.
+	SyncEveryInterval
+)
+
+// ParseSyncPolicy розбирає назву політики fsync: never, always або interval.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "never":
+		return SyncNever, nil
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncEveryInterval, nil
+	default:
+		return SyncNever, fmt.Errorf("unknown sync policy %q, expected never, always or interval", name)
+	}
+}
+
+// OpenMode визначає, як відкриття бази обробляє пошкоджені записи сегментів. Обірваний
+// останній запис сегмента, який міг бути активним при падінні процесу, обрізається за
+// будь-якого режиму; обірваний запис в інших сегментах - таке саме пошкодження, як решта.
+type OpenMode int
+
+const (
+	// OpenStrict перериває відкриття на першому пошкодженому записі.
+	OpenStrict OpenMode = iota
+	// OpenPermissive пропускає пошкоджені записи, журналюючи їх. Якщо розмір запису
+	// прочитати неможливо, межа наступного запису невідома, і решта сегмента ігнорується.
+	// Файли сегментів не змінюються.
+	OpenPermissive
+	// OpenRepair обрізає сегмент від першого пошкодженого запису: наступні записи сегмента
+	// втрачаються.
+	OpenRepair
+)
+
+// ParseOpenMode розбирає назву режиму відкриття: strict, permissive або repair.
+func ParseOpenMode(name string) (OpenMode, error) {
+	switch strings.ToLower(name) {
+	case "", "strict":
+		return OpenStrict, nil
+	case "permissive":
+		return OpenPermissive, nil
+	case "repair":
+		return OpenRepair, nil
+	default:
+		return OpenStrict, fmt.Errorf("unknown open mode %q, expected strict, permissive or repair", name)
+	}
+}
+
+// Options налаштовує екземпляр Db. Нульові значення полів замінюються значеннями за замовчуванням.
+type Options struct {
+	// MaxFileSize - розмір сегмента, після досягнення якого починається новий сегмент.
+	// Від'ємне значення вимикає ротацію.
+	MaxFileSize int64
+	// MergeInterval - період, з яким CompactionPolicy перевіряє потребу у фоновому злитті.
+	// Від'ємне значення вимикає фонове злиття.
+	MergeInterval time.Duration
+	// PutQueueDepth - місткість черги запитів на запис.
+	PutQueueDepth int
+	// PutQueueBytes - максимальний сумарний розмір запитів, що очікують на запис.
+	PutQueueBytes int64
+	// RejectWhenQueueFull: якщо true, запис при вичерпаному PutQueueBytes одразу завершується
+	// з ErrQueueFull, інакше чекає на звільнення місця.
+	RejectWhenQueueFull bool
+	// SyncPolicy - політика fsync для активного сегмента.
+	SyncPolicy SyncPolicy
+	// SyncInterval - період fsync для SyncEveryInterval.
+	SyncInterval time.Duration
+	// MergePauseLatency - затримка читань (90-й перцентиль за останні 5-10 с), вище якої
+	// фонове злиття призупиняється, зокрема посеред копіювання.
+	// Від'ємне значення вимикає призупинення.
+	MergePauseLatency time.Duration
+	// MergeResumeLatency - затримка читань, нижче якої призупинене злиття відновлюється.
+	MergeResumeLatency time.Duration
+	// SeriesRawRetention - вік точок часового ряду, після якого злиття їх проріджує.
+	SeriesRawRetention time.Duration
+	// SeriesDownsampleStep - інтервал, у межах якого старі точки усереднюються при злитті.
+	SeriesDownsampleStep time.Duration
+	// WriteTimeout - час обробки пакета записів, після якого горутина запису вважається
+	// зависшою. Від'ємне значення вимикає нагляд.
+	WriteTimeout time.Duration
+	// MmapSealedSegments відображає незмінні сегменти в пам'ять замість читання через ReadAt.
+	// На платформах без підтримки mmap читання залишаються звичайними.
+	MmapSealedSegments bool
+	// IndexShards - кількість частин індексу ключів з окремими замками.
+	IndexShards int
+	// DiskIndex тримає розташування ключів кожного запечатаного сегмента у власному
+	// відсортованому файлі індексу в key-index, а в пам'яті - лише розріджений індекс
+	// і фільтр Блума до нього, див. diskindex.go. Файли переживають перезапуск, список
+	// ключів у пам'яті не будується. У пам'яті лишаються ключі активних сегментів, часових
+	// рядів, з терміном дії та посилальні значення. Не поєднується з CacheBudgetBytes,
+	// KeyVersions та IndexInt64Values: вони тримають у пам'яті кожен ключ.
+	DiskIndex bool
+	// DiskIndexSparseInterval - через скільки ключів файлу індексу ключ потрапляє
+	// в розріджений індекс у пам'яті.
+	DiskIndexSparseInterval int
+	// WriteShards - кількість частин запису, кожна з власною чергою, горутиною запису та
+	// активним сегментом, див. writeshard.go. Кодування записів, Write і fsync частини
+	// виконують паралельно; під спільним замком лишаються перевірки та зміни індексу.
+	// PutQueueDepth діє для кожної частини окремо.
+	WriteShards int
+	// CompactionPolicy вирішує, чи потрібне фонове злиття на черговому інтервалі.
+	CompactionPolicy CompactionPolicy
+	// Metrics отримує лічильники та тривалості операцій. За замовчуванням виміри відкидаються.
+	// Затримки OpRead з нього (див. LatencyQuantiles) вирішують, чи призупиняти фонове злиття.
+	Metrics MetricsCollector
+	// Logger отримує діагностичні повідомлення бази; за замовчуванням StdLogger.
+	Logger Logger
+	// OnSlowOp викликається для читань, записів і злиттів, що тривали довше за
+	// SlowOpThreshold. Нульовий поріг або nil вимикають звіт.
+	OnSlowOp        func(SlowOp)
+	SlowOpThreshold time.Duration
+	// Retention - політика зберігання даних за віком. Нульове значення її вимикає.
+	Retention RetentionPolicy
+	// Compression - алгоритм стиснення рядкових значень. За замовчуванням значення
+	// не стискаються; файли зі стисненими значеннями не читаються старими версіями.
+	Compression Compression
+	// CompressionThreshold - мінімальний розмір значення в байтах, з якого воно стискається.
+	CompressionThreshold int
+	// Dedup вмикає дедуплікацію рядкових значень: однакові значення записуються один раз,
+	// а ключі зберігають посилання на них. Спільні значення не стискаються.
+	Dedup bool
+	// DedupThreshold - мінімальний розмір значення в байтах, з якого воно дедуплікується.
+	DedupThreshold int
+	// OpenMode - обробка пошкоджених записів при відкритті; за замовчуванням OpenStrict.
+	OpenMode OpenMode
+	// NoMigrate вимикає виконання кроків міграції при відкритті. Невиконані кроки
+	// залишаються такими до наступного відкриття без цього прапорця або виклику Migrate.
+	NoMigrate bool
+	// Archive переносить сегменти, замінені злиттям, у піддиректорію archive замість
+	// видалення, див. ArchivedVersions.
+	Archive bool
+	// ArchiveMaxAge - вік, після якого сегменти видаляються з архіву. Нуль - без обмеження.
+	ArchiveMaxAge time.Duration
+	// ArchiveMaxBytes - розмір архіву, понад який з нього видаляються найстаріші злиття.
+	// Нуль - без обмеження.
+	ArchiveMaxBytes int64
+	// EncryptionKey вмикає шифрування значень AES-GCM цим ключем (16, 24 або 32 байти)
+	// з ідентифікатором "default", див. encrypt.go.
+	EncryptionKey []byte
+	// KeyProvider вмикає шифрування значень ключами провайдера; має пріоритет над EncryptionKey.
+	// Файли із зашифрованими значеннями не читаються старими версіями.
+	KeyProvider KeyProvider
+	// MaxKeys - ліміт кількості ключів: запис нового ключа понад нього завершується
+	// з ErrQuotaExceeded. Нуль - без обмеження.
+	MaxKeys int
+	// MaxDiskBytes - ліміт сумарного розміру сегментів: запис, що перевищив би його,
+	// завершується з ErrQuotaExceeded. Нуль - без обмеження.
+	MaxDiskBytes int64
+	// CacheBudgetBytes вмикає режим кешу: коли живі дані перевищують бюджет, найдавніше
+	// прочитані або записані ключі видаляються, а злиття прибирає їх з диску, див. cache.go.
+	// Нуль - режим вимкнено.
+	CacheBudgetBytes int64
+	// KeyVersions - скільки попередніх версій кожного ключа пам'ятає база для VersionAt,
+	// див. versions.go. Історія ведеться лише для записів після відкриття. Нуль - вимкнено.
+	KeyVersions int
+	// IndexInt64Values вмикає вторинний індекс значень int64 для QueryInt64Range,
+	// див. int64index.go. Індекс будується під час відкриття й тримається в пам'яті.
+	IndexInt64Values bool
+	// ColdStorage вмикає архівацію старих сегментів у S3-сумісне сховище, див. coldtier.go.
+	ColdStorage ColdStorage
+}
+
+// DefaultOptions повертає налаштування, які використовує NewDb.
+func DefaultOptions() Options {
+	return Options{
+		MaxFileSize:             MaxFileSize,
+		MergeInterval:           defaultMergeInterval,
+		PutQueueDepth:           defaultPutQueueDepth,
+		PutQueueBytes:           defaultPutQueueBytes,
+		SyncPolicy:              SyncNever,
+		SyncInterval:            defaultSyncInterval,
+		MergePauseLatency:       defaultMergePauseLatency,
+		MergeResumeLatency:      defaultMergeResumeLatency,
+		SeriesRawRetention:      defaultSeriesRawRetention,
+		SeriesDownsampleStep:    defaultSeriesDownsampleStep,
+		WriteTimeout:            defaultWriteTimeout,
+		IndexShards:             defaultIndexShards,
+		DiskIndexSparseInterval: defaultDiskIndexSparseInterval,
+		WriteShards:             1,
+		CompressionThreshold:    defaultCompressionThreshold,
+		DedupThreshold:          defaultDedupThreshold,
+		CompactionPolicy:        DefaultCompactionPolicy(),
+		Metrics:                 NopMetrics{},
+		Logger:                  StdLogger{},
+	}
+}
+
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.MaxFileSize == 0 {
+		o.MaxFileSize = defaults.MaxFileSize
+	}
+	if o.MergeInterval == 0 {
+		o.MergeInterval = defaults.MergeInterval
+	}
+	if o.PutQueueDepth <= 0 {
+		o.PutQueueDepth = defaults.PutQueueDepth
+	}
+	if o.PutQueueBytes <= 0 {
+		o.PutQueueBytes = defaults.PutQueueBytes
+	}
+	if o.SyncInterval <= 0 {
+		o.SyncInterval = defaults.SyncInterval
+	}
+	if o.MergePauseLatency == 0 {
+		o.MergePauseLatency = defaults.MergePauseLatency
+	}
+	if o.MergeResumeLatency == 0 {
+		o.MergeResumeLatency = defaults.MergeResumeLatency
+	}
+	if o.SeriesRawRetention <= 0 {
+		o.SeriesRawRetention = defaults.SeriesRawRetention
+	}
+	if o.SeriesDownsampleStep <= 0 {
+		o.SeriesDownsampleStep = defaults.SeriesDownsampleStep
+	}
+	if o.CompactionPolicy == nil {
+		o.CompactionPolicy = defaults.CompactionPolicy
+	}
+	if o.Metrics == nil {
+		o.Metrics = defaults.Metrics
+	}
+	if o.Logger == nil {
+		o.Logger = defaults.Logger
+	}
+	if o.IndexShards <= 0 {
+		o.IndexShards = defaults.IndexShards
+	}
+	if o.WriteShards <= 0 {
+		o.WriteShards = defaults.WriteShards
+	}
+	if o.DiskIndexSparseInterval <= 0 {
+		o.DiskIndexSparseInterval = defaults.DiskIndexSparseInterval
+	}
+	if o.WriteTimeout == 0 {
+		o.WriteTimeout = defaults.WriteTimeout
+	}
+	if o.CompressionThreshold <= 0 {
+		o.CompressionThreshold = defaults.CompressionThreshold
+	}
+	if o.DedupThreshold <= 0 {
+		o.DedupThreshold = defaults.DedupThreshold
+	}
+	o.ColdStorage = o.ColdStorage.withDefaults()
+	return o
+}
@@ -0,0 +1,94 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOptions_WithDefaults(t *testing.T) {
+	opts := Options{MergeInterval: -1, SyncPolicy: SyncAlways}.withDefaults()
+	defaults := DefaultOptions()
+	if opts.MaxFileSize != defaults.MaxFileSize || opts.PutQueueDepth != defaults.PutQueueDepth {
+		t.Errorf("zero fields were not replaced by defaults: %+v", opts)
+	}
+	if opts.MergeInterval != -1 || opts.SyncPolicy != SyncAlways {
+		t.Errorf("explicit fields were overridden: %+v", opts)
+	}
+}
+
+func TestNewDbWithOptions(t *testing.T) {
+	opts := Options{
+		MaxFileSize:   256,
+		MergeInterval: -1,
+		PutQueueDepth: 4,
+		SyncPolicy:    SyncAlways,
+	}
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("NewDbWithOptions failed: %v", err)
+	}
+	defer db.Close()
+
+	if cap(db.shards[0].putCh) != 4 {
+		t.Errorf("expected put queue depth 4, got %d", cap(db.shards[0].putCh))
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put("key", "some value that takes space"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.mu.RLock()
+	activeID := db.shards[0].segmentID
+	db.mu.RUnlock()
+	if activeID == 0 {
+		t.Error("expected segment rotation with MaxFileSize 256")
+	}
+	if v, err := db.Get("key"); err != nil || v != "some value that takes space" {
+		t.Errorf("Get returned %q, %v", v, err)
+	}
+}
+
+func TestSyncPolicies(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncAlways, SyncEveryInterval} {
+		dir := t.TempDir()
+		opts := Options{MergeInterval: -1, SyncPolicy: policy, SyncInterval: 20 * time.Millisecond}
+		db, err := NewDbWithOptions(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := db.Put(fmt.Sprintf("key-%d", i), "value"); err != nil {
+					t.Errorf("policy %d: Put failed: %v", policy, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if policy == SyncEveryInterval {
+			time.Sleep(100 * time.Millisecond)
+		}
+		db.mu.RLock()
+		unsynced := db.shards[0].unsynced.Load()
+		db.mu.RUnlock()
+		if unsynced {
+			t.Errorf("policy %d: active segment still has unsynced writes", policy)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db, err = NewDbWithOptions(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(db.Keys()); n != 50 {
+			t.Errorf("policy %d: expected 50 keys after reopen, got %d", policy, n)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,47 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded повертається записом, який перевищив би Options.MaxKeys або
+// Options.MaxDiskBytes. Видалення та злиття звільняють місце, після чого запис можна повторити.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// checkQuotaLocked перевіряє, чи вміститься запит у ліміти кількості ключів і місця на
+// диску. Видалення дозволені завжди: інакше заповнену базу не було б чим звільнити.
+// Розмір запису на диску оцінюється за розміром запиту. Викликається під db.mu.
+func (db *Db) checkQuotaLocked(req putRequest) error {
+	if db.opts.MaxKeys > 0 {
+		_, exists := db.currentIndex.get(req.key)
+		_, isSeries := db.seriesIndex[req.key]
+		// Перейменування не збільшує кількість ключів.
+		if keys := db.currentIndex.len() + len(db.seriesIndex); !exists && !isSeries && !req.move && keys >= db.opts.MaxKeys {
+			return fmt.Errorf("%w: key '%s' would exceed the limit of %d keys", ErrQuotaExceeded, req.key, db.opts.MaxKeys)
+		}
+	}
+	if db.opts.MaxDiskBytes > 0 {
+		size := req.size()
+		if src, ok := db.currentIndex.get(req.copyFrom); ok && req.copyFrom != "" {
+			size += src.size
+		}
+		if db.diskBytes+size > db.opts.MaxDiskBytes {
+			return fmt.Errorf("%w: writing key '%s' would exceed the limit of %d bytes on disk (%d used)", ErrQuotaExceeded, req.key, db.opts.MaxDiskBytes, db.diskBytes)
+		}
+	}
+	return nil
+}
+
+// recountDiskLocked перераховує сумарний розмір сегментів за їх файлами. Викликається під db.mu.
+func (db *Db) recountDiskLocked() {
+	db.diskBytes = 0
+	for segID, file := range db.segmentFiles {
+		info, err := file.Stat()
+		if err != nil {
+			db.opts.Logger.Warnf("quota: failed to stat segment %d: %v", segID, err)
+			continue
+		}
+		db.diskBytes += info.Size()
+	}
+}
@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDb_KeyQuota(t *testing.T) {
+	opts := testOptions(true)
+	opts.MaxKeys = 3
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 2; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("extra", "value"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Put of a key over the limit returned %v, want ErrQuotaExceeded", err)
+	}
+	err = db.Copy("key0", "copy", CopyOptions{})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Copy to a new key over the limit returned %v, want ErrQuotaExceeded", err)
+	}
+	if ErrorCode(err) != CodeStorageQuota || IsRetryable(err) {
+		t.Errorf("quota error has code %s, retryable %t", ErrorCode(err), IsRetryable(err))
+	}
+	// Перезапис існуючих ключів не збільшує їх кількість.
+	if err := db.Put("key0", "new value"); err != nil {
+		t.Errorf("overwrite at the limit: %v", err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 2, Value: 2}); err != nil {
+		t.Errorf("series append at the limit: %v", err)
+	}
+	if err := db.Delete("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("extra", "value"); err != nil {
+		t.Errorf("Put after Delete freed a key: %v", err)
+	}
+}
+
+func TestDb_DiskQuota(t *testing.T) {
+	opts := testOptions(true)
+	opts.MaxDiskBytes = 4 * testMaxFileSize
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value := strings.Repeat("v", 100)
+	writes := 0
+	for ; writes < 100; writes++ {
+		if err = db.Put("key", value); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("after %d overwrites Put returned %v, want ErrQuotaExceeded", writes, err)
+	}
+	stats, _ := db.Stats()
+	if stats.DiskSize > opts.MaxDiskBytes || stats.MaxDiskBytes != opts.MaxDiskBytes {
+		t.Errorf("disk size %d with a limit of %d, stats limit %d", stats.DiskSize, opts.MaxDiskBytes, stats.MaxDiskBytes)
+	}
+	if v, err := db.Get("key"); err != nil || v != value {
+		t.Errorf("Get after rejected write = %q, %v", v, err)
+	}
+
+	// Злиття прибирає перезаписані значення, і запис знову вміщується.
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", value); err != nil {
+		t.Errorf("Put after merge freed space: %v", err)
+	}
+	if err := db.Delete("key"); err != nil {
+		t.Errorf("Delete must not be limited by the disk quota: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package datastore
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Видалення префікса записує один запис dataTypeRangeTombstone з префіксом як ключем,
+// незалежно від кількості ключів. Записи читаються в порядку їх запису, тож при відновленні
+// індексу такий запис видаляє ключі з префіксом, записані до нього, а пізніші записи
+// ключів з тим самим префіксом залишаються. Злиття переносить лише живі ключі індексу,
+// тож видалені ключі та сам запис після злиття всіх сегментів зникають.
+
+// ErrTooManyKeys повертає DeletePrefixLimit, коли префікс охоплює більше ключів, ніж дозволено.
+var ErrTooManyKeys = errors.New("prefix matches too many keys")
+
+// DeletePrefix видаляє всі ключі (включно з часовими рядами), що починаються з prefix,
+// одним записом і повертає кількість видалених ключів. Порожній префікс не допускається.
+func (db *Db) DeletePrefix(prefix string) (int, error) {
+	return db.DeletePrefixLimit(prefix, 0)
+}
+
+// DeletePrefixLimit працює як DeletePrefix, але якщо ключів з префіксом більше за limit,
+// нічого не видаляє й повертає їх кількість разом з ErrTooManyKeys. Ключі рахуються
+// горутиною запису під тим самим блокуванням, що й видалення, тож ключ, записаний
+// між перевіркою та видаленням, не обходить обмеження. limit <= 0 - без обмеження.
+func (db *Db) DeletePrefixLimit(prefix string, limit int) (int, error) {
+	if prefix == "" {
+		return 0, errors.New("prefix must not be empty")
+	}
+	var deleted int
+	err := db.submit(putRequest{key: prefix, dataType: dataTypeRangeTombstone, maxDeleted: limit, deletedCount: &deleted})
+	if errors.Is(err, ErrTooManyKeys) {
+		return deleted, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// DeleteByPrefix видаляє всі ключі (включно з часовими рядами), що починаються з prefix,
+// і повертає кількість видалених ключів. На відміну від DeletePrefix пише надгробок для
+// кожного ключа, як DeleteKeys, але ключі вибираються горутиною запису за один прохід
+// індексу, тож ключ, записаний одночасно з видаленням, не пропускається. Підходить для
+// невеликих префіксів, коли кожне видалення має бути окремим записом, напр. для
+// споживачів Changes. Порожній префікс не допускається.
+func (db *Db) DeleteByPrefix(prefix string) (int, error) {
+	if prefix == "" {
+		return 0, errors.New("prefix must not be empty")
+	}
+	var deleted int
+	if err := db.submit(putRequest{key: prefix, dataType: dataTypeTombstone, byPrefix: true, deletedCount: &deleted}); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// keysWithPrefixLocked повертає ключі (включно з часовими рядами) з префіксом.
+// Викликається під db.mu.
+func (db *Db) keysWithPrefixLocked(prefix string) ([]string, error) {
+	db.mergeNewKeysLocked()
+	keys := []string{}
+	err := db.ascendKeysLocked(prefix, func(key string, _ indexValue, _ bool) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// applyDeletePrefix записує запис видалення префікса й прибирає ключі з індексу.
+// Якщо ключів з префіксом немає або їх більше за req.maxDeleted, нічого не пише.
+// Викликається під db.mu.
+func (db *Db) applyDeletePrefix(req putRequest) (int, error) {
+	deleted, err := db.keysWithPrefixLocked(req.key)
+	if err != nil {
+		return 0, err
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+	if req.maxDeleted > 0 && len(deleted) > req.maxDeleted {
+		return len(deleted), ErrTooManyKeys
+	}
+	seq := db.seq + 1
+	tombstone := entry{key: req.key, dataType: dataTypeRangeTombstone, timestamp: time.Now().UnixNano(), seq: seq}
+	encoded := tombstone.Encode()
+	sh := db.shards[0]
+	if len(db.shards) > 1 {
+		// Ключі з префіксом можуть бути в будь-якій частині запису, тож запис іде в новий
+		// сегмент, старший за всі попередні, а решта частин потім переходять на ще новіші.
+		if err := db.renewShardLocked(sh); err != nil {
+			return 0, err
+		}
+	}
+	_, offset, err := db.appendToActiveSegment(sh, encoded)
+	if err != nil {
+		return 0, err
+	}
+	db.seq = seq
+	sh.deleteSeq = seq
+	sh.hints = append(sh.hints, hintRecord{key: req.key, offset: offset, size: int64(len(encoded)), dataType: dataTypeRangeTombstone})
+	for _, other := range db.shards[1:] {
+		if err := db.renewShardLocked(other); err != nil {
+			return 0, err
+		}
+	}
+
+	if db.currentIndex.disk == nil {
+		start, end := db.prefixRange(req.key)
+		db.sortedKeys = append(db.sortedKeys[:start], db.sortedKeys[end:]...)
+	}
+	for _, key := range deleted {
+		db.dropKeyStateLocked(key)
+		db.watch.notifyDelete(key, seq)
+	}
+	return len(deleted), nil
+}
+
+// removePrefixUnsortedLocked прибирає з індексу ключі з префіксом, не чіпаючи db.sortedKeys:
+// використовується при відновленні індексу без DiskIndex, після якого список ключів
+// будується заново.
+func (db *Db) removePrefixUnsortedLocked(prefix string) {
+	var keys []string
+	_ = db.currentIndex.forEach(func(key string, _ indexValue) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	})
+	keys = append(keys, db.seriesKeysWithPrefixLocked(prefix)...)
+	for _, key := range keys {
+		db.dropKeyStateLocked(key)
+	}
+}
+
+func (db *Db) seriesKeysWithPrefixLocked(prefix string) []string {
+	var keys []string
+	for key := range db.seriesIndex {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
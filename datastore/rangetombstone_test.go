@@ -0,0 +1,180 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDb_DeletePrefixLimit(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		if err := db.Put(fmt.Sprintf("limit/%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := db.DeletePrefixLimit("limit/", 4)
+	if !errors.Is(err, ErrTooManyKeys) || n != 5 {
+		t.Fatalf("DeletePrefixLimit over the limit = %d, %v; want 5, ErrTooManyKeys", n, err)
+	}
+	if keys := db.KeysWithPrefix("limit/"); len(keys) != 5 {
+		t.Fatalf("rejected DeletePrefixLimit removed keys, %d remain", len(keys))
+	}
+	if n, err := db.DeletePrefixLimit("limit/", 5); err != nil || n != 5 {
+		t.Fatalf("DeletePrefixLimit within the limit = %d, %v", n, err)
+	}
+	if keys := db.KeysWithPrefix("limit/"); len(keys) != 0 {
+		t.Errorf("%d keys remain after DeletePrefixLimit", len(keys))
+	}
+}
+
+func TestDb_DeletePrefix(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := db.Put(fmt.Sprintf("bucket/%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("bucketless", "keep"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("bucket/series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := db.Stats()
+
+	deleted, err := db.DeletePrefix("bucket/")
+	if err != nil || deleted != 51 {
+		t.Fatalf("DeletePrefix = %d, %v; want 51 keys", deleted, err)
+	}
+	after, _ := db.Stats()
+	// Видалення пише один запис, а не надгробок на кожен ключ.
+	if grown := after.DiskSize - before.DiskSize; grown > 64 {
+		t.Errorf("DeletePrefix wrote %d bytes", grown)
+	}
+	if n, err := db.DeletePrefix("bucket/"); err != nil || n != 0 {
+		t.Errorf("repeated DeletePrefix = %d, %v", n, err)
+	}
+	if _, err := db.DeletePrefix(""); err == nil {
+		t.Error("DeletePrefix accepted an empty prefix")
+	}
+	// Ключ, записаний після видалення, не зачіпається ним.
+	if err := db.Put("bucket/07", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if keys := db.KeysWithPrefix("bucket/"); len(keys) != 1 || keys[0] != "bucket/07" {
+			t.Errorf("%s: keys with prefix = %v, want [bucket/07]", stage, keys)
+		}
+		if v, err := db.Get("bucket/07"); err != nil || v != "new" {
+			t.Errorf("%s: Get(bucket/07) = %q, %v", stage, v, err)
+		}
+		if _, err := db.Get("bucket/08"); err != ErrNotFound {
+			t.Errorf("%s: Get(bucket/08) = %v, want ErrNotFound", stage, err)
+		}
+		if _, err := db.GetSeries("bucket/series", 0, 10); err != ErrNotFound {
+			t.Errorf("%s: GetSeries(bucket/series) = %v, want ErrNotFound", stage, err)
+		}
+		if v, err := db.Get("bucketless"); err != nil || v != "keep" {
+			t.Errorf("%s: Get(bucketless) = %q, %v", stage, v, err)
+		}
+	}
+	check("after delete")
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+	db.Close()
+
+	hints, _ := filepath.Glob(filepath.Join(dir, hintFileNamePrefix+"*"))
+	for _, hint := range hints {
+		if err := os.Remove(hint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen without hints")
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	check("after merge")
+}
+
+func TestDb_DeleteByPrefix(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("bucket/%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("bucketless", "keep"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("bucket/series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := db.Stats()
+
+	deleted, err := db.DeleteByPrefix("bucket/")
+	if err != nil || deleted != 21 {
+		t.Fatalf("DeleteByPrefix = %d, %v; want 21 keys", deleted, err)
+	}
+	after, _ := db.Stats()
+	// На відміну від DeletePrefix, кожен ключ отримує власний надгробок.
+	if grown := after.DiskSize - before.DiskSize; grown < 21*10 {
+		t.Errorf("DeleteByPrefix wrote only %d bytes", grown)
+	}
+	if n, err := db.DeleteByPrefix("bucket/"); err != nil || n != 0 {
+		t.Errorf("repeated DeleteByPrefix = %d, %v", n, err)
+	}
+	if _, err := db.DeleteByPrefix(""); err == nil {
+		t.Error("DeleteByPrefix accepted an empty prefix")
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if keys := db.KeysWithPrefix("bucket/"); len(keys) != 0 {
+			t.Errorf("%s: keys with prefix = %v", stage, keys)
+		}
+		if _, err := db.GetSeries("bucket/series", 0, 10); err != ErrNotFound {
+			t.Errorf("%s: GetSeries(bucket/series) = %v, want ErrNotFound", stage, err)
+		}
+		if v, err := db.Get("bucketless"); err != nil || v != "keep" {
+			t.Errorf("%s: Get(bucketless) = %q, %v", stage, v, err)
+		}
+	}
+	check("after delete")
+	db.Close()
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
@@ -0,0 +1,218 @@
+package datastore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Виправлення індексу при читанні. Якщо запис індексу посилається на сегмент, якого вже
+// немає (напр. його прибрало злиття, а індекс лишився старим), точкове читання не
+// повертає внутрішню помилку, а знаходить ключ заново: переглядає записи наявних
+// сегментів від давніших до новіших так само, як відкриття бази, оновлює запис
+// індексу й повторює читання.
+
+// repairSource - знімок сегмента, який read repair переглядає поза замками: копія
+// підказок активного сегмента, холодний сегмент або файл локального сегмента. reader
+// читає записи сегмента; nil для активного сегмента.
+type repairSource struct {
+	segID  int
+	hints  []hintRecord
+	cold   *coldSegment
+	file   *os.File
+	reader io.ReaderAt
+}
+
+// records повертає записи індексу сегмента в порядку їх запису: для активного сегмента -
+// знімок з пам'яті, для решти - з файлу підказок або скануванням.
+func (src repairSource) records(dir string) ([]hintRecord, error) {
+	if src.cold != nil {
+		if records, err := readHintFile(dir, src.segID, src.cold.stub.Size); err == nil {
+			return records, nil
+		}
+		return src.cold.scan()
+	}
+	if src.file == nil {
+		return src.hints, nil
+	}
+	stat, err := src.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat segment %d: %w", src.segID, err)
+	}
+	if records, err := readHintFile(dir, src.segID, stat.Size()); err == nil {
+		return records, nil
+	}
+	var records []hintRecord
+	err = scanRecords(io.NewSectionReader(src.file, 0, stat.Size()), func(e entry, offset, size int64) {
+		records = append(records, hintRecord{key: e.key, offset: offset, size: size, dataType: e.dataType})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan segment %d: %w", src.segID, err)
+	}
+	return records, nil
+}
+
+// located - запис ключа в сегменті segID.
+type located struct {
+	segID int
+	rec   hintRecord
+}
+
+// repairScan - результат перегляду сегментів: останній запис значення або видалення ключа,
+// записи терміну дії після нього та значення int64 для db.int64Index, якщо hasInt.
+// failed - сегмент, який не вдалося переглянути з помилкою err.
+type repairScan struct {
+	last     *located
+	expiries []located
+	valueInt int64
+	hasInt   bool
+	failed   int
+	err      error
+}
+
+// repairSourcesLocked знімає перелік сегментів для перегляду, якщо запис індексу stale
+// досі посилається на відсутній сегмент. Викликається під db.mu.
+func (db *Db) repairSourcesLocked(key string, stale indexValue) ([]repairSource, bool) {
+	if current, ok := db.currentIndex.get(key); !ok || current != stale {
+		// Запис змінився, поки читання чекало на замок.
+		return nil, false
+	}
+	if _, ok := db.segmentReaderLocked(stale.segmentID); ok {
+		return nil, false
+	}
+	sources := make([]repairSource, 0, len(db.segmentFiles)+len(db.coldSegments))
+	for segID, file := range db.segmentFiles {
+		src := repairSource{segID: segID, file: file, reader: file}
+		if sh := db.activeShardLocked(segID); sh != nil {
+			// Активний сегмент може змінитися після знімка, його записи читаються під db.mu.
+			src.hints = append([]hintRecord(nil), sh.hints...)
+			src.file = nil
+			src.reader = nil
+		}
+		sources = append(sources, src)
+	}
+	for segID, seg := range db.coldSegments {
+		sources = append(sources, repairSource{segID: segID, cold: seg, reader: seg})
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].segID < sources[j].segID })
+	return sources, true
+}
+
+// scanRepairSources переглядає сегменти від давніших до новіших так само, як відкриття
+// бази. Холодні сегменти при цьому можуть завантажуватися, тож замки не утримуються.
+func (db *Db) scanRepairSources(key string, sources []repairSource) repairScan {
+	var scan repairScan
+	var lastSrc repairSource
+	for _, src := range sources {
+		records, err := src.records(db.dir)
+		if err != nil {
+			return repairScan{failed: src.segID, err: err}
+		}
+		for _, rec := range records {
+			switch {
+			case rec.dataType == dataTypeRangeTombstone && strings.HasPrefix(key, rec.key):
+				scan.last = &located{src.segID, hintRecord{key: key, dataType: dataTypeTombstone}}
+				scan.expiries = nil
+			case rec.key != key || rec.dataType == DataTypeSeries || rec.dataType == dataTypeBlob:
+				// Записи інших ключів і часових рядів значення ключа не змінюють.
+			case rec.dataType == dataTypeExpiry:
+				scan.expiries = append(scan.expiries, located{src.segID, rec})
+			default:
+				scan.last = &located{src.segID, rec}
+				scan.expiries = nil
+				lastSrc = src
+			}
+		}
+	}
+	if scan.last != nil && scan.last.rec.dataType == DataTypeInt64 && db.int64Index != nil && lastSrc.reader != nil {
+		rec := scan.last.rec
+		record, err := readRecordFrom(lastSrc.reader, db.keys, key, indexValue{segmentID: scan.last.segID, offset: rec.offset, size: rec.size, dataType: rec.dataType})
+		if err != nil {
+			return repairScan{failed: scan.last.segID, err: err}
+		}
+		scan.valueInt, scan.hasInt = record.valueInt, true
+	}
+	return scan
+}
+
+// repairIndexEntry знаходить ключ заново, якщо його запис індексу stale посилається на
+// відсутній сегмент. Повертає nil, якщо запис індексу вже оновлено й читання можна
+// повторити; тоді ключ або читається з наявного сегмента, або видалений. Сегменти
+// переглядаються без замків, db.mu береться лише для знімка сегментів і застосування
+// результату.
+func (db *Db) repairIndexEntry(key string, stale indexValue) error {
+	for {
+		db.mu.RLock()
+		sources, ok := db.repairSourcesLocked(key, stale)
+		db.mu.RUnlock()
+		if !ok {
+			return nil
+		}
+		scan := db.scanRepairSources(key, sources)
+		db.mu.Lock()
+		done, err := db.applyRepairLocked(key, stale, scan)
+		db.mu.Unlock()
+		if done {
+			return err
+		}
+	}
+}
+
+// applyRepairLocked оновлює індекс за результатом перегляду сегментів. Повертає false,
+// якщо під час перегляду злиття прибрало потрібний сегмент і перегляд слід повторити.
+// Викликається під db.mu.
+func (db *Db) applyRepairLocked(key string, stale indexValue, scan repairScan) (bool, error) {
+	if current, ok := db.currentIndex.get(key); !ok || current != stale {
+		return true, nil
+	}
+	if _, ok := db.segmentReaderLocked(stale.segmentID); ok {
+		return true, nil
+	}
+	if scan.err != nil {
+		if _, ok := db.segmentReaderLocked(scan.failed); !ok {
+			return false, nil
+		}
+		return true, fmt.Errorf("read repair of key '%s': %w", key, scan.err)
+	}
+	if scan.last != nil {
+		for _, l := range append([]located{*scan.last}, scan.expiries...) {
+			if _, ok := db.segmentReaderLocked(l.segID); !ok {
+				return false, nil
+			}
+		}
+	}
+
+	db.lru.remove(key)
+	db.versions.remove(key)
+	db.int64Index.remove(key)
+	if scan.last == nil || scan.last.rec.dataType == dataTypeTombstone {
+		db.currentIndex.delete(key)
+		db.blobs.dropRef(key)
+		delete(db.expiries, key)
+		i := sort.SearchStrings(db.sortedKeys, key)
+		if i < len(db.sortedKeys) && db.sortedKeys[i] == key {
+			db.sortedKeys = append(db.sortedKeys[:i], db.sortedKeys[i+1:]...)
+		}
+		db.opts.Logger.Warnf("read repair: key '%s' pointed at missing segment %d and is deleted in the remaining segments", key, stale.segmentID)
+		return true, nil
+	}
+	db.applyHintRecords(scan.last.segID, []hintRecord{scan.last.rec})
+	for _, e := range scan.expiries {
+		db.applyHintRecords(e.segID, []hintRecord{e.rec})
+	}
+	repaired, ok := db.currentIndex.get(key)
+	if !ok || repaired == stale {
+		return true, fmt.Errorf("read repair of key '%s': failed to re-resolve record from segment %d", key, scan.last.segID)
+	}
+	if repaired.dataType == DataTypeInt64 {
+		if scan.hasInt {
+			db.int64Index.set(key, scan.valueInt)
+		} else if record, err := db.readRecordLocked(key, repaired); err == nil {
+			db.int64Index.set(key, record.valueInt)
+		}
+	}
+	db.opts.Logger.Warnf("read repair: key '%s' pointed at missing segment %d, re-resolved to segment %d", key, stale.segmentID, repaired.segmentID)
+	return true, nil
+}
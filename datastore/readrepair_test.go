@@ -0,0 +1,149 @@
+package datastore
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pointAtMissingSegment підміняє запис індексу ключа посиланням на відсутній сегмент.
+func pointAtMissingSegment(db *Db, key string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idxVal, ok := db.currentIndex.get(key)
+	if !ok {
+		db.insertSortedKey(key)
+		idxVal.dataType = DataTypeString
+	}
+	idxVal.segmentID = 9999
+	db.currentIndex.set(key, idxVal)
+}
+
+func TestDb_ReadRepair(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("sealed", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("sealed", "current"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	// Без підказок запечатаний сегмент переглядається скануванням.
+	hints, _ := filepath.Glob(filepath.Join(dir, hintFileNamePrefix+"*"))
+	for _, hint := range hints {
+		if err := os.Remove(hint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("active", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("removed", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("removed"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"sealed", "counter", "active", "removed"} {
+		pointAtMissingSegment(db, key)
+	}
+	if v, err := db.Get("sealed"); err != nil || v != "current" {
+		t.Errorf("Get(sealed) = %q, %v", v, err)
+	}
+	if v, err := db.GetInt64("counter"); err != nil || v != 42 {
+		t.Errorf("GetInt64(counter) = %d, %v", v, err)
+	}
+	if v, err := db.Get("active"); err != nil || v != "value" {
+		t.Errorf("Get(active) = %q, %v", v, err)
+	}
+	if _, err := db.Get("removed"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(removed) = %v, want ErrNotFound", err)
+	}
+	if db.Exists("removed") {
+		t.Error("deleted key is still in the index after read repair")
+	}
+	if keys := db.Keys(); len(keys) != 3 {
+		t.Errorf("Keys after read repair = %v", keys)
+	}
+}
+
+func TestDb_ReadRepairScansColdSegmentsOutsideLock(t *testing.T) {
+	fake, _ := newFakeS3(t)
+	var blocking atomic.Bool
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && blocking.Load() {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, coldOptions(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fillColdDb(t, db)
+	// Без підказок холодний сегмент переглядається завантаженням.
+	hints, _ := filepath.Glob(filepath.Join(dir, hintFileNamePrefix+"*"))
+	for _, hint := range hints {
+		if err := os.Remove(hint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pointAtMissingSegment(db, "key1")
+
+	blocking.Store(true)
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := db.Get("key1")
+		done <- result{value, err}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read repair did not reach cold storage")
+	}
+	written := make(chan error, 1)
+	go func() { written <- db.Put("other", "value") }()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("writes wait for read repair to download a cold segment")
+	}
+	close(release)
+	res := <-done
+	if res.err != nil || !strings.HasPrefix(res.value, "1 ") {
+		t.Errorf("Get(key1) = %.10q, %v", res.value, res.err)
+	}
+}
@@ -0,0 +1,25 @@
+package datastore
+
+import "time"
+
+// ReadSnapshot - значення кількох ключів, прочитані з одного стану індексу.
+type ReadSnapshot struct {
+	// Seq - номер останньої зміни, врахованої у знімку (див. KeySeq та ChangesSince).
+	Seq uint64
+	// Values містить кожен запитаний ключ: string або int64 для знайдених і nil для відсутніх.
+	Values map[string]interface{}
+}
+
+// ReadSnapshot читає ключі узгоджено: жоден ключ не відображає запис, новіший за Seq,
+// і всі записи з номером не більше Seq враховано. Горутина запису змінює індекс лише
+// під db.mu, тому утримання db.mu на час читання фіксує один стан бази.
+func (db *Db) ReadSnapshot(keys []string) (ReadSnapshot, error) {
+	defer db.observeRead(time.Now(), keys...)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	values, err := db.getManyLocked(keys)
+	if err != nil {
+		return ReadSnapshot{}, err
+	}
+	return ReadSnapshot{Seq: db.seq, Values: values}, nil
+}
@@ -0,0 +1,66 @@
+package datastore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDb_ReadSnapshot(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Писач спершу оновлює "a", потім "b", тому в узгодженому знімку b ніколи не випереджає a.
+	const rounds = 300
+	done := make(chan error, 1)
+	go func() {
+		for i := int64(1); i <= rounds; i++ {
+			if err := db.PutInt64("a", i); err != nil {
+				done <- err
+				return
+			}
+			if err := db.PutInt64("b", i); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	var lastSeq uint64
+	for finished := false; !finished; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			finished = true
+		default:
+		}
+		snap, err := db.ReadSnapshot([]string{"a", "b", "missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.Seq < lastSeq {
+			t.Fatalf("snapshot seq went backwards: %d after %d", snap.Seq, lastSeq)
+		}
+		lastSeq = snap.Seq
+		if snap.Values["missing"] != nil {
+			t.Errorf("missing key has value %v", snap.Values["missing"])
+		}
+		a, _ := snap.Values["a"].(int64)
+		b, _ := snap.Values["b"].(int64)
+		if b > a || a-b > 1 {
+			t.Fatalf("inconsistent snapshot at seq %d: a=%d b=%d", snap.Seq, a, b)
+		}
+		if snap.Seq != uint64(a+b) {
+			t.Fatalf("snapshot seq %d does not match values a=%d b=%d", snap.Seq, a, b)
+		}
+	}
+	snap, _ := db.ReadSnapshot([]string{"a", "b"})
+	if fmt.Sprint(snap.Values["a"], snap.Values["b"]) != fmt.Sprint(rounds, rounds) {
+		t.Errorf("final snapshot %v", snap.Values)
+	}
+}
@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"strings"
+	"time"
+)
+
+// RetentionPolicy обмежує вік даних: злиття видаляє записи, старші за MaxAge.
+// Записи поки не мають власного часу запису, тому вік оцінюється за часом останнього
+// запису в сегмент, що містить запис. Така оцінка консервативна: запис видаляється
+// не раніше, ніж стане старшим за дозволений вік. Часові ряди політикою не обробляються.
+type RetentionPolicy struct {
+	// MaxAge - вік, після якого записи видаляються. Нуль зберігає дані безстроково.
+	MaxAge time.Duration
+	// Buckets перевизначає MaxAge для ключів із заданим префіксом; діє найдовший префікс.
+	// Нульове значення зберігає такі ключі безстроково.
+	Buckets map[string]time.Duration
+}
+
+func (p RetentionPolicy) enabled() bool {
+	if p.MaxAge > 0 {
+		return true
+	}
+	for _, age := range p.Buckets {
+		if age > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxAge повертає правило для ключа: префікс бакета ("" для загального правила) та вік.
+func (p RetentionPolicy) maxAge(key string) (string, time.Duration) {
+	bucket, age, found := "", p.MaxAge, false
+	for prefix, bucketAge := range p.Buckets {
+		if strings.HasPrefix(key, prefix) && (!found || len(prefix) > len(bucket)) {
+			bucket, age, found = prefix, bucketAge, true
+		}
+	}
+	return bucket, age
+}
+
+// expired повідомляє, чи вийшов строк зберігання ключа, записаного не пізніше newest (Unix нс).
+func (p RetentionPolicy) expired(key string, newest int64, now time.Time) (string, bool) {
+	bucket, age := p.maxAge(key)
+	if age <= 0 || newest == 0 {
+		return bucket, false
+	}
+	return bucket, now.Sub(time.Unix(0, newest)) > age
+}
+
+// RetentionReport - підсумок видалень за політикою зберігання з моменту відкриття бази.
+type RetentionReport struct {
+	// LastPurge - час останнього злиття, що видалило хоча б один ключ.
+	LastPurge time.Time `json:"lastPurge,omitempty"`
+	// LastPurged - кількість ключів, видалених останнім таким злиттям.
+	LastPurged int64 `json:"lastPurged"`
+	// Purged - кількість видалених ключів за бакетами ("" - загальне правило MaxAge).
+	Purged map[string]int64 `json:"purged"`
+}
+
+// RetentionReport повертає кількість ключів, видалених за політикою зберігання.
+func (db *Db) RetentionReport() RetentionReport {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.retentionReportLocked()
+}
+
+func (db *Db) retentionReportLocked() RetentionReport {
+	report := db.retention
+	report.Purged = make(map[string]int64, len(db.retention.Purged))
+	for bucket, count := range db.retention.Purged {
+		report.Purged[bucket] = count
+	}
+	return report
+}
+
+// recordRetentionLocked додає результати злиття до звіту. Викликається під db.mu.
+func (db *Db) recordRetentionLocked(purged map[string]int64) {
+	var total int64
+	for bucket, count := range purged {
+		if db.retention.Purged == nil {
+			db.retention.Purged = make(map[string]int64)
+		}
+		db.retention.Purged[bucket] += count
+		total += count
+	}
+	if total == 0 {
+		return
+	}
+	db.retention.LastPurge = time.Now()
+	db.retention.LastPurged = total
+	db.opts.Logger.Infof("Retention: merge purged %d keys older than the configured age", total)
+}
+
+// segmentNewestWriteLocked повертає час останнього запису в запечатаний сегмент (Unix нс).
+// Для сегментів без запису в маніфесті використовується час зміни файлу. Викликається під db.mu.
+func (db *Db) segmentNewestWriteLocked(segID int) int64 {
+	if t, ok := db.manifest.newestWrite(segID); ok {
+		return t
+	}
+	file, ok := db.segmentFiles[segID]
+	if !ok {
+		return 0
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return 0
+	}
+	return stat.ModTime().UnixNano()
+}
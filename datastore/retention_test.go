@@ -0,0 +1,115 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicy_MaxAge(t *testing.T) {
+	policy := RetentionPolicy{
+		MaxAge:  time.Hour,
+		Buckets: map[string]time.Duration{"logs_": time.Minute, "logs_keep_": 0},
+	}
+	tests := []struct {
+		key        string
+		wantBucket string
+		wantAge    time.Duration
+	}{
+		{"user1", "", time.Hour},
+		{"logs_1", "logs_", time.Minute},
+		{"logs_keep_1", "logs_keep_", 0},
+	}
+	for _, tt := range tests {
+		if bucket, age := policy.maxAge(tt.key); bucket != tt.wantBucket || age != tt.wantAge {
+			t.Errorf("maxAge(%s) = %q, %s; want %q, %s", tt.key, bucket, age, tt.wantBucket, tt.wantAge)
+		}
+	}
+	now := time.Now()
+	if _, expired := policy.expired("logs_1", now.Add(-2*time.Minute).UnixNano(), now); !expired {
+		t.Errorf("logs_1 written two minutes ago should be expired")
+	}
+	if _, expired := policy.expired("user1", now.Add(-2*time.Minute).UnixNano(), now); expired {
+		t.Errorf("user1 written two minutes ago should be kept")
+	}
+	if _, expired := policy.expired("logs_keep_1", now.Add(-24*time.Hour).UnixNano(), now); expired {
+		t.Errorf("logs_keep_1 has unlimited retention")
+	}
+}
+
+func TestDb_RetentionPurgesOldKeysOnMerge(t *testing.T) {
+	opts := testOptions(true)
+	opts.Retention = RetentionPolicy{MaxAge: time.Hour, Buckets: map[string]time.Duration{"keep_": 0}}
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("old%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(fmt.Sprintf("keep_%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Старіють лише вже запечатані сегменти.
+	db.mu.RLock()
+	var sealed []int
+	for segID := range db.segmentFiles {
+		if segID != db.shards[0].segmentID {
+			sealed = append(sealed, segID)
+		}
+	}
+	db.mu.RUnlock()
+	if len(sealed) == 0 {
+		t.Fatal("expected sealed segments")
+	}
+	for _, segID := range sealed {
+		if err := db.manifest.setNewestWrite(segID, time.Now().Add(-2*time.Hour).UnixNano()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("old00", "rewritten"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Compact(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report := db.RetentionReport()
+	if report.Purged[""] == 0 || report.LastPurged != report.Purged[""] {
+		t.Fatalf("unexpected retention report %+v", report)
+	}
+	if _, ok := report.Purged["keep_"]; ok {
+		t.Errorf("keys with unlimited retention were purged: %+v", report)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if v, err := db.Get("old00"); err != nil || v != "rewritten" {
+			t.Errorf("%s: recently rewritten key = %q, %v", stage, v, err)
+		}
+		if _, err := db.Get("old01"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expired key old01 is still readable: %v", stage, err)
+		}
+		for i := 0; i < 40; i++ {
+			if _, err := db.Get(fmt.Sprintf("keep_%02d", i)); err != nil {
+				t.Errorf("%s: keep_%02d: %v", stage, i, err)
+			}
+		}
+	}
+	check("after merge")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen")
+}
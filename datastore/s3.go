@@ -0,0 +1,255 @@
+package datastore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Мінімальний клієнт S3-сумісного сховища для холодного рівня (див. coldtier.go): завантаження
+// об'єкта та читання його частин. Запити адресуються в стилі шляху (endpoint/bucket/key),
+// який підтримують і AWS S3, і MinIO чи Ceph, та підписуються AWS Signature Version 4.
+
+const (
+	s3Service = "s3"
+	// emptyPayloadHash - SHA-256 порожнього тіла запиту.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// errObjectNotFound повертається, якщо об'єкта в сховищі немає.
+var errObjectNotFound = errors.New("object not found in cold storage")
+
+type s3Client struct {
+	cfg    ColdStorage
+	client *http.Client
+}
+
+func newS3Client(cfg ColdStorage) *s3Client {
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultColdRequestTimeout}
+	}
+	return &s3Client{cfg: cfg, client: client}
+}
+
+// objectURL повертає адресу об'єкта name у бакеті.
+func (c *s3Client) objectURL(name string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(c.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cold storage endpoint %q: %w", c.cfg.Endpoint, err)
+	}
+	u.Path += "/" + c.cfg.Bucket + "/" + name
+	u.RawPath = s3Escape(u.Path, false)
+	return u, nil
+}
+
+// upload завантажує перші size байтів file як об'єкт name.
+func (c *s3Client) upload(name string, file *os.File, size int64) error {
+	// Підпис охоплює хеш тіла, тож файл читається двічі: для хешу та для передачі.
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, size)); err != nil {
+		return fmt.Errorf("cold storage: failed to read %s: %w", file.Name(), err)
+	}
+	u, err := c.objectURL(name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), io.NewSectionReader(file, 0, size))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return fmt.Errorf("cold storage: failed to upload %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// readRange читає len(p) байтів об'єкта name, починаючи з off.
+func (c *s3Client) readRange(name string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	u, err := c.objectURL(name)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := c.do(req, emptyPayloadHash)
+	if err != nil {
+		return 0, fmt.Errorf("cold storage: failed to read %s at offset %d: %w", name, off, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent && off > 0 {
+		// Сховище проігнорувало Range і повертає весь об'єкт.
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, fmt.Errorf("cold storage: failed to read %s at offset %d: %w", name, off, err)
+		}
+	}
+	n, err := io.ReadFull(resp.Body, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// download записує весь об'єкт name у w.
+func (c *s3Client) download(name string, w io.Writer) error {
+	u, err := c.objectURL(name)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("cold storage: failed to download %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("cold storage: failed to download %s: %w", name, err)
+	}
+	return nil
+}
+
+// do підписує й виконує запит. Відповідь з кодом не 2xx перетворюється на помилку.
+func (c *s3Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.AccessKeyID != "" {
+		signV4(req, payloadHash, c.cfg.AccessKeyID, c.cfg.SecretAccessKey, c.cfg.Region, s3Service, time.Now())
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errObjectNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// signV4 додає до запиту заголовки X-Amz-Date та Authorization за AWS Signature Version 4.
+// Підписуються заголовок Host та всі заголовки X-Amz-*.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.EscapedPath()),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery кодує параметри запиту в порядку імен, як вимагає підпис.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath кодує шлях для підпису: усе, крім незарезервованих символів і '/'.
+// Шлях, уже закодований net/url, спершу декодується, щоб не кодувати його двічі.
+func s3EscapePath(path string) string {
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return s3Escape(path, false)
+}
+
+// s3Escape кодує s за правилами URI-кодування SigV4; '/' кодується лише якщо slash true.
+func s3Escape(s string, slash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
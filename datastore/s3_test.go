@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 - сховище об'єктів у пам'яті з підмножиною API S3, потрібною холодному рівню.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		f.gets++
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) getCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gets
+}
+
+func testColdStorage(endpoint string) ColdStorage {
+	return ColdStorage{
+		Endpoint:        endpoint,
+		Bucket:          "segments",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		Prefix:          "db/",
+		After:           time.Nanosecond,
+		CheckInterval:   -1,
+	}.withDefaults()
+}
+
+func TestSignV4(t *testing.T) {
+	// Приклад get-vanilla з набору тестів AWS Signature Version 4.
+	req, err := http.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, _ := time.Parse(amzDateFormat, "20150830T123600Z")
+	signV4(req, emptyPayloadHash, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q\nwant %q", got, want)
+	}
+}
+
+func TestS3Client(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	client := newS3Client(testColdStorage(srv.URL))
+	path := filepath.Join(t.TempDir(), "segment")
+	content := []byte("0123456789abcdefghij")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := client.upload("db/gen/segment 1", file, 15); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fake.objects["/segments/db/gen/segment 1"]); got != "0123456789abcde" {
+		t.Fatalf("stored object %q", got)
+	}
+
+	buf := make([]byte, 4)
+	if n, err := client.readRange("db/gen/segment 1", buf, 10); err != nil || string(buf[:n]) != "abcd" {
+		t.Errorf("readRange(10) = %q, %v", buf[:n], err)
+	}
+	if n, err := client.readRange("db/gen/segment 1", buf, 13); err != io.EOF || string(buf[:n]) != "de" {
+		t.Errorf("readRange past the end = %q, %v, want \"de\" and io.EOF", buf[:n], err)
+	}
+	var all bytes.Buffer
+	if err := client.download("db/gen/segment 1", &all); err != nil || all.String() != "0123456789abcde" {
+		t.Errorf("download = %q, %v", all.String(), err)
+	}
+	if _, err := client.readRange("db/gen/missing", buf, 0); !errors.Is(err, errObjectNotFound) {
+		t.Errorf("reading a missing object returned %v, want errObjectNotFound", err)
+	}
+
+	anonymous := testColdStorage(srv.URL)
+	anonymous.AccessKeyID = ""
+	if err := newS3Client(anonymous).download("db/gen/segment 1", io.Discard); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("unsigned request returned %v, want 403", err)
+	}
+}
@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDb_SegmentsAndOpenSegment(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("segKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected several segments, got %+v", segments)
+	}
+	totalEntries := 0
+	for i, seg := range segments {
+		if i > 0 && seg.ID <= segments[i-1].ID {
+			t.Errorf("segments are not sorted by id: %+v", segments)
+		}
+		if seg.Active != (i == len(segments)-1) {
+			t.Errorf("only the last segment must be active: %+v", seg)
+		}
+		if seg.Size == 0 || seg.CreatedAt.IsZero() {
+			t.Errorf("incomplete segment info: %+v", seg)
+		}
+		totalEntries += seg.Entries
+	}
+	if totalEntries != 80 {
+		t.Errorf("segments report %d entries, want 80", totalEntries)
+	}
+
+	r, size, err := db.OpenSegment(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	onDisk, err := os.ReadFile(filepath.Join(db.dir, outFileNamePrefix+"0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != size || string(data) != string(onDisk) {
+		t.Errorf("OpenSegment returned %d bytes (size %d), file has %d", len(data), size, len(onDisk))
+	}
+	if _, _, err := db.OpenSegment(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("OpenSegment of missing segment: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSeriesRawRetention   = time.Hour
+	defaultSeriesDownsampleStep = time.Minute
+
+	seriesPointSize = 16
+)
+
+// SeriesPoint - одна точка часового ряду. Timestamp задається в мілісекундах Unix.
+type SeriesPoint struct {
+	Timestamp int64 `json:"ts"`
+	Value     int64 `json:"value"`
+}
+
+// Формат значення блоку часового ряду: послідовність точок
+// [мітка часу (int64)][значення (int64)] - по 16 байт на точку.
+
+func encodeSeriesPoints(points []SeriesPoint) []byte {
+	buf := make([]byte, 0, len(points)*seriesPointSize)
+	for _, p := range points {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(p.Timestamp))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(p.Value))
+	}
+	return buf
+}
+
+func decodeSeriesPoints(data []byte) ([]SeriesPoint, error) {
+	if len(data)%seriesPointSize != 0 {
+		return nil, fmt.Errorf("invalid length for series value: %d is not a multiple of %d", len(data), seriesPointSize)
+	}
+	points := make([]SeriesPoint, len(data)/seriesPointSize)
+	for i := range points {
+		chunk := data[i*seriesPointSize:]
+		points[i] = SeriesPoint{
+			Timestamp: int64(binary.LittleEndian.Uint64(chunk[0:8])),
+			Value:     int64(binary.LittleEndian.Uint64(chunk[8:16])),
+		}
+	}
+	return points, nil
+}
+
+// downsampleSeries сортує точки та усереднює ті, що старші за cutoff, у інтервали довжиною step.
+// Усереднена точка отримує мітку часу початку інтервалу.
+func downsampleSeries(points []SeriesPoint, cutoff int64, step int64) []SeriesPoint {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	if step <= 0 {
+		return points
+	}
+	result := make([]SeriesPoint, 0, len(points))
+	for i := 0; i < len(points); {
+		p := points[i]
+		if p.Timestamp >= cutoff {
+			result = append(result, points[i:]...)
+			break
+		}
+		bucket := p.Timestamp - p.Timestamp%step
+		if p.Timestamp < 0 && p.Timestamp%step != 0 {
+			bucket -= step
+		}
+		var sum, count int64
+		for ; i < len(points) && points[i].Timestamp < bucket+step && points[i].Timestamp < cutoff; i++ {
+			sum += points[i].Value
+			count++
+		}
+		result = append(result, SeriesPoint{Timestamp: bucket, Value: sum / count})
+	}
+	return result
+}
+
+// AppendSeries дописує точки до часового ряду key. Повертає ErrWrongType, якщо key
+// зберігає значення.
+func (db *Db) AppendSeries(key string, points ...SeriesPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return db.submit(putRequest{key: key, points: points, dataType: DataTypeSeries})
+}
+
+// GetSeries повертає відсортовані за часом точки ряду key з мітками в межах [from, to].
+// Повертає ErrNotFound, якщо ряду не існує.
+func (db *Db) GetSeries(key string, from, to int64) ([]SeriesPoint, error) {
+	defer db.observeRead(time.Now(), key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.seriesPointsLocked(key, from, to)
+}
+
+// seriesPointsLocked повертає відсортовані точки ряду key з мітками в межах [from, to].
+// Викликається під db.mu.
+func (db *Db) seriesPointsLocked(key string, from, to int64) ([]SeriesPoint, error) {
+	chunks, ok := db.seriesIndex[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := []SeriesPoint{}
+	for _, idxVal := range chunks {
+		record, err := db.readRecordLocked(key, idxVal)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range record.points {
+			if p.Timestamp >= from && p.Timestamp <= to {
+				result = append(result, p)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result, nil
+}
+
+// mergeSeries переносить блоки часових рядів плану у злиті сегменти, об'єднуючи блоки
+// кожного ключа в один і проріджуючи старі точки. Виконується без db.mu.
+func (db *Db) mergeSeries(ctx context.Context, plan *mergePlan, result *mergeResult, w *mergeWriter) error {
+	cutoff := time.Now().Add(-db.opts.SeriesRawRetention).UnixMilli()
+	step := db.opts.SeriesDownsampleStep.Milliseconds()
+	for key, chunks := range plan.series {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var points []SeriesPoint
+		var newest int64
+		var seq uint64
+		for _, idxVal := range chunks {
+			record, err := readRecordFrom(plan.readers[idxVal.segmentID], db.keys, key, idxVal)
+			if err != nil {
+				return fmt.Errorf("merge: %w", err)
+			}
+			points = append(points, record.points...)
+			newest = max(newest, record.timestamp)
+			seq = max(seq, record.seq)
+		}
+		// Об'єднаний блок зберігає час запису та номер найновішого з блоків.
+		compacted := entry{key: key, dataType: DataTypeSeries, points: downsampleSeries(points, cutoff, step), timestamp: newest, seq: seq}
+		data, err := db.seal(compacted.Encode())
+		if err != nil {
+			return fmt.Errorf("merge: series '%s': %w", key, err)
+		}
+		out, offset, err := w.write(data)
+		if err != nil {
+			return fmt.Errorf("merge: failed to write series '%s' to merged file: %w", key, err)
+		}
+		for _, idxVal := range chunks {
+			out.noteSource(plan.newest[idxVal.segmentID])
+		}
+		result.series[key] = indexValue{segmentID: out.segID, offset: offset, size: int64(len(data)), dataType: DataTypeSeries}
+		out.hints = append(out.hints, hintRecord{key: key, offset: offset, size: int64(len(data)), dataType: DataTypeSeries})
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownsampleSeries(t *testing.T) {
+	points := []SeriesPoint{{125, 1}, {100, 3}, {110, 2}, {205, 10}, {300, 7}, {301, 8}}
+	got := downsampleSeries(points, 300, 100)
+	want := []SeriesPoint{{100, 2}, {200, 10}, {300, 7}, {301, 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("downsampleSeries = %v, want %v", got, want)
+	}
+}
+
+func TestDb_Series(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.SeriesDownsampleStep = time.Minute
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour).Truncate(time.Minute).UnixMilli()
+	recent := time.Now().UnixMilli()
+	for i := int64(0); i < 120; i++ {
+		if err := db.AppendSeries("cpu", SeriesPoint{Timestamp: old + i*1000, Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := db.GetSeries("cpu", old+10*1000, old+19*1000)
+	if err != nil || len(points) != 10 || points[0].Value != 10 {
+		t.Fatalf("range query returned %v, %v", points, err)
+	}
+	if _, err := db.Get("cpu"); err != ErrNotFound {
+		t.Errorf("series key must not be visible as a plain value, got %v", err)
+	}
+
+	// Великі значення змушують ротацію, щоб усі старі точки опинилися в неактивних сегментах.
+	filler := strings.Repeat("x", int(testMaxFileSize)-100)
+	for _, key := range []string{"filler-1", "filler-2"} {
+		if err := db.Put(key, filler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if err := db.AppendSeries("cpu", SeriesPoint{Timestamp: recent, Value: 100}, SeriesPoint{Timestamp: recent + 1, Value: 101}); err != nil {
+		t.Fatal(err)
+	}
+	points, err = db.GetSeries("cpu", math.MinInt64, math.MaxInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SeriesPoint{{old, 29}, {old + 60*1000, 89}, {recent, 100}, {recent + 1, 101}}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("after merge got %v, want %v", points, want)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if points, err := db.GetSeries("cpu", math.MinInt64, math.MaxInt64); err != nil || !reflect.DeepEqual(points, want) {
+		t.Errorf("after reopen got %v, %v; want %v", points, err, want)
+	}
+	if err := db.Delete("cpu"); err != nil {
+		t.Fatalf("Delete of series failed: %v", err)
+	}
+	if _, err := db.GetSeries("cpu", math.MinInt64, math.MaxInt64); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestDb_SeriesAndValueKeysDoNotMix(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("m:value", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("m:series", SeriesPoint{Timestamp: 1, Value: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("m:value", SeriesPoint{Timestamp: 1, Value: 5}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("AppendSeries to a value key returned %v, want ErrWrongType", err)
+	}
+	if err := db.Put("m:series", "v"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Put to a series key returned %v, want ErrWrongType", err)
+	}
+	if dataType, err := db.TypeOf("m:value"); err != nil || dataType != DataTypeString {
+		t.Errorf("TypeOf(m:value) = %d, %v", dataType, err)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if got := strings.Join(db.Keys(), ","); got != "m:series,m:value" {
+			t.Errorf("%s: Keys = %s", stage, got)
+		}
+		if got := strings.Join(db.Range("m:", "", 0), ","); got != "m:series,m:value" {
+			t.Errorf("%s: Range = %s", stage, got)
+		}
+		types := make(map[string]byte)
+		db.Iterate(func(key string, dataType byte) bool {
+			types[key] = dataType
+			return true
+		})
+		if types["m:series"] != DataTypeSeries || types["m:value"] != DataTypeString {
+			t.Errorf("%s: Iterate types = %v", stage, types)
+		}
+		kvs, err := db.GetByPrefix("m:")
+		if err != nil {
+			t.Fatalf("%s: GetByPrefix: %v", stage, err)
+		}
+		if len(kvs) != 2 || kvs[0].DataType != DataTypeSeries || !reflect.DeepEqual(kvs[0].Value, []SeriesPoint{{1, 5}}) {
+			t.Errorf("%s: GetByPrefix = %+v", stage, kvs)
+		}
+	}
+	check("open")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = NewDbWithOptions(dir, testOptions(true)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("reopen")
+
+	if err := db.Delete("m:series"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(db.Keys(), ","); got != "m:value" {
+		t.Errorf("Keys after deleting the series = %s", got)
+	}
+	if err := db.Put("m:series", "now a value"); err != nil {
+		t.Errorf("Put after deleting the series: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrShutdownDeadline повертається записам, які не встигли виконатися до дедлайну Shutdown.
+var ErrShutdownDeadline = errors.New("database shut down before the write was applied")
+
+// DrainReport - підсумок завершення роботи бази через Shutdown.
+type DrainReport struct {
+	// QueuedPuts - кількість записів у черзі на момент початку завершення.
+	QueuedPuts int `json:"queuedPuts"`
+	// FailedPuts - кількість записів, відхилених з ErrShutdownDeadline.
+	FailedPuts int           `json:"failedPuts"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// QueuedPuts повертає кількість записів, що чекають у черзі на горутину запису.
+func (db *Db) QueuedPuts() int {
+	var n int
+	for _, sh := range db.shards {
+		n += len(sh.putCh)
+	}
+	return n
+}
+
+// Shutdown закриває базу, дочекавшись виконання записів, що вже в черзі. Якщо ctx
+// завершується раніше, решта записів у черзі відхиляється з ErrShutdownDeadline,
+// а база все одно закривається. Повертає ErrClosed, якщо базу вже закрито.
+func (db *Db) Shutdown(ctx context.Context) (DrainReport, error) {
+	start := time.Now()
+	report := DrainReport{QueuedPuts: db.QueuedPuts()}
+	if !db.stopAccepting() {
+		return report, ErrClosed
+	}
+	for _, sh := range db.shards {
+		select {
+		case <-sh.exit:
+		case <-ctx.Done():
+			if !db.aborted() {
+				close(db.abortCh)
+			}
+			<-sh.exit
+		}
+	}
+	report.FailedPuts = int(db.abortedPuts.Load())
+	err := db.closeFiles()
+	report.Duration = time.Since(start)
+	return report, err
+}
+
+func (db *Db) aborted() bool {
+	select {
+	case <-db.abortCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// abortBatch відхиляє запити з ErrShutdownDeadline, не виконуючи їх.
+func (db *Db) abortBatch(batch []putRequest) {
+	for _, r := range batch {
+		db.putBudget.release(r.size())
+		db.abortedPuts.Add(1)
+		if r.errCh != nil {
+			r.errCh <- ErrShutdownDeadline
+		}
+	}
+}
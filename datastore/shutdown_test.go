@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDb_Shutdown(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := db.Shutdown(context.Background())
+	if err != nil || report.FailedPuts != 0 {
+		t.Errorf("Shutdown = %+v, %v; want no failed puts", report, err)
+	}
+	if _, err := db.Shutdown(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("repeated Shutdown returned %v, want ErrClosed", err)
+	}
+}
+
+func TestDb_ShutdownDeadline(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("condition not reached in time")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Горутина запису забирає перший запис і чекає на db.mu, решта залишаються в черзі.
+	db.mu.Lock()
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	put := func(i int) {
+		defer wg.Done()
+		errs[i] = db.Put(fmt.Sprintf("key%d", i), "value")
+	}
+	wg.Add(1)
+	go put(0)
+	waitFor(func() bool { return db.shards[0].watchdog.busySince.Load() != 0 })
+	for i := 1; i < len(errs); i++ {
+		wg.Add(1)
+		go put(i)
+	}
+	waitFor(func() bool { return db.QueuedPuts() == len(errs)-1 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reportCh := make(chan DrainReport, 1)
+	go func() {
+		report, _ := db.Shutdown(ctx)
+		reportCh <- report
+	}()
+	waitFor(db.aborted)
+	db.mu.Unlock()
+	wg.Wait()
+
+	report := <-reportCh
+	if report.QueuedPuts != len(errs)-1 || report.FailedPuts != len(errs)-1 {
+		t.Errorf("Shutdown report = %+v, want %d queued and failed puts", report, len(errs)-1)
+	}
+	if errs[0] != nil {
+		t.Errorf("put taken by the writer before the deadline failed: %v", errs[0])
+	}
+	for i, err := range errs[1:] {
+		if !errors.Is(err, ErrShutdownDeadline) {
+			t.Errorf("queued put %d returned %v, want ErrShutdownDeadline", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package datastore
+
+import "time"
+
+// SlowOp описує операцію, що тривала довше за Options.SlowOpThreshold.
+type SlowOp struct {
+	// Op - OpRead, OpWrite або OpMerge.
+	Op string
+	// Key - ключ операції; порожній для злиття та операцій над кількома ключами.
+	Key     string
+	Elapsed time.Duration
+	// Segments - сегменти, яких стосувалася операція: сегмент, де лежить ключ після
+	// читання чи запису, або вхідні сегменти злиття. Порожній, якщо ключа вже немає.
+	Segments []int
+}
+
+// reportSlow передає op у Options.OnSlowOp, якщо операція перевищила поріг.
+// Не викликається під замками бази, тож обробник може звертатися до неї.
+func (db *Db) reportSlow(op SlowOp) {
+	if db.opts.OnSlowOp == nil || db.opts.SlowOpThreshold <= 0 || op.Elapsed < db.opts.SlowOpThreshold {
+		return
+	}
+	if op.Segments == nil && op.Key != "" {
+		if idxVal, ok := db.currentIndex.get(op.Key); ok {
+			op.Segments = []int{idxVal.segmentID}
+		}
+	}
+	db.opts.OnSlowOp(op)
+}
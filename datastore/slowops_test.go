@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDb_OnSlowOp(t *testing.T) {
+	var mu sync.Mutex
+	var ops []SlowOp
+	opts := testOptions(true)
+	opts.SlowOpThreshold = time.Nanosecond
+	opts.OnSlowOp = func(op SlowOp) {
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, op)
+	}
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	padding := strings.Repeat("p", 300)
+	for i := 0; i < 12; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%3), padding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Get("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	seen := make(map[string]SlowOp)
+	for _, op := range ops {
+		if op.Elapsed <= 0 {
+			t.Errorf("%s of %q reported with elapsed %s", op.Op, op.Key, op.Elapsed)
+		}
+		seen[op.Op] = op
+	}
+	if op := seen[OpWrite]; op.Key != "key2" || len(op.Segments) != 1 {
+		t.Errorf("last slow write = %+v, want key2 with its segment", op)
+	}
+	if op := seen[OpRead]; op.Key != "key1" || len(op.Segments) != 1 {
+		t.Errorf("slow read = %+v, want key1 with its segment", op)
+	}
+	if op := seen[OpMerge]; op.Key != "" || len(op.Segments) < 2 {
+		t.Errorf("slow merge = %+v, want the merged segments", op)
+	}
+}
+
+func TestDb_OnSlowOpBelowThreshold(t *testing.T) {
+	opts := testOptions(true)
+	opts.SlowOpThreshold = time.Hour
+	opts.OnSlowOp = func(op SlowOp) { t.Errorf("unexpected slow operation %+v", op) }
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDb_SnapshotRestoresIntoNewDirectory(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("snapKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("snapKey000"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := db.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	// Записи після знімка до нього не потрапляють.
+	if err := db.Put("afterSnapshot", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreDir := t.TempDir()
+	tr := tar.NewReader(&buf)
+	files := 0
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(restoreDir, header.Name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files++
+	}
+	if files < 2 {
+		t.Fatalf("expected several segments in snapshot, got %d", files)
+	}
+
+	restored, err := NewDbWithOptions(restoreDir, testOptions(true))
+	if err != nil {
+		t.Fatalf("failed to open restored db: %v", err)
+	}
+	defer restored.Close()
+	for i := 1; i < 80; i++ {
+		if v, err := restored.Get(fmt.Sprintf("snapKey%03d", i)); err != nil || v != fmt.Sprintf("value%03d", i) {
+			t.Fatalf("restored Get(snapKey%03d) = %q, %v", i, v, err)
+		}
+	}
+	if _, err := restored.Get("snapKey000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key is present in restored db: %v", err)
+	}
+	if _, err := restored.Get("afterSnapshot"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("key written after the snapshot is present in restored db: %v", err)
+	}
+}
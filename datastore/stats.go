@@ -0,0 +1,117 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stats - знімок стану бази для моніторингу.
+type Stats struct {
+	// Generation - покоління бази, див. Db.Generation.
+	Generation string `json:"generation"`
+	// KeyCount - кількість живих ключів, включно з часовими рядами.
+	KeyCount int `json:"keyCount"`
+	// SegmentCount - кількість файлів сегментів, включно з активним.
+	SegmentCount int `json:"segmentCount"`
+	// ActiveSegmentSize - сумарний розмір активних сегментів частин запису в байтах.
+	ActiveSegmentSize int64 `json:"activeSegmentSize"`
+	// DiskSize - сумарний розмір усіх сегментів у байтах.
+	DiskSize int64 `json:"diskSize"`
+	// DeadBytes - байти, зайняті перезаписаними та видаленими записами, див. FragmentationRatio.
+	DeadBytes int64 `json:"deadBytes"`
+	// FragmentationRatio - частка DeadBytes у DiskSize.
+	FragmentationRatio float64 `json:"fragmentationRatio"`
+	// InvalidSegments - кількість сегментів, що не пройшли перевірку після запечатування.
+	InvalidSegments int `json:"invalidSegments"`
+	// LegacySegments - кількість сегментів із записами старого формату, див. MigrateFormat.
+	LegacySegments int `json:"legacySegments"`
+	// UnencryptedSegments - кількість сегментів, не зашифрованих поточним ключем, див. MigrateEncryption.
+	UnencryptedSegments int `json:"unencryptedSegments,omitempty"`
+	// MergeCount - кількість злиттів з моменту відкриття бази.
+	MergeCount int64 `json:"mergeCount"`
+	// LastMergeDuration - тривалість останнього злиття.
+	LastMergeDuration time.Duration `json:"lastMergeDuration"`
+	// PutQueueLength - кількість запитів, що очікують у черзі запису.
+	PutQueueLength int `json:"putQueueLength"`
+	// PutQueueBytes - оцінка пам'яті, зайнятої запитами в черзі.
+	PutQueueBytes int64 `json:"putQueueBytes"`
+	// PutQueueBudgetBytes - налаштований бюджет черги запису.
+	PutQueueBudgetBytes int64 `json:"putQueueBudgetBytes"`
+	// Retention - ключі, видалені за політикою зберігання.
+	Retention RetentionReport `json:"retention"`
+	// SharedValues - кількість дедуплікованих значень і частин великих значень, записаних один раз.
+	SharedValues int `json:"sharedValues"`
+	// SharedValueRefs - кількість ключів, що посилаються на спільні значення.
+	SharedValueRefs int `json:"sharedValueRefs"`
+	// ChunkedValues - кількість ключів, значення яких більші за сегмент і збережені частинами.
+	ChunkedValues int `json:"chunkedValues"`
+	// LastCleanup - що база прибрала під час відкриття; UncleanShutdown показує, чи закрили її
+	// перед тим коректно.
+	LastCleanup CleanupReport `json:"lastCleanup"`
+	// MaxKeys і MaxDiskBytes - налаштовані ліміти, див. Options; нуль - без обмеження.
+	MaxKeys      int   `json:"maxKeys,omitempty"`
+	MaxDiskBytes int64 `json:"maxDiskBytes,omitempty"`
+	// CacheBudgetBytes - бюджет режиму кешу, див. Options; CacheEvictions - кількість ключів,
+	// видалених з моменту відкриття бази, щоб вміститися в нього.
+	CacheBudgetBytes int64 `json:"cacheBudgetBytes,omitempty"`
+	CacheEvictions   int64 `json:"cacheEvictions,omitempty"`
+	// CancelledWrites - записи, скасовані викликачем до того, як горутина запису до них дійшла.
+	CancelledWrites int64 `json:"cancelledWrites,omitempty"`
+	// ColdSegments і ColdBytes - сегменти, архівовані в холодне сховище, та їх розмір,
+	// див. Options.ColdStorage. До SegmentCount і DiskSize вони не входять.
+	ColdSegments int   `json:"coldSegments,omitempty"`
+	ColdBytes    int64 `json:"coldBytes,omitempty"`
+}
+
+// Stats повертає поточну статистику бази.
+func (db *Db) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	stats := Stats{
+		Generation:          db.Generation(),
+		KeyCount:            db.currentIndex.len() + len(db.seriesIndex),
+		SegmentCount:        len(db.segmentFiles),
+		MergeCount:          db.mergeCount,
+		LastMergeDuration:   db.lastMergeTime,
+		PutQueueLength:      db.QueuedPuts(),
+		PutQueueBytes:       db.putBudget.usage(),
+		PutQueueBudgetBytes: db.opts.PutQueueBytes,
+		Retention:           db.retentionReportLocked(),
+		LastCleanup:         db.cleanup,
+		MaxKeys:             db.opts.MaxKeys,
+		MaxDiskBytes:        db.opts.MaxDiskBytes,
+		CacheBudgetBytes:    db.opts.CacheBudgetBytes,
+		CacheEvictions:      db.evictions,
+		CancelledWrites:     db.cancelledWrites,
+	}
+	for segID, file := range db.segmentFiles {
+		info, err := file.Stat()
+		if err != nil {
+			return Stats{}, fmt.Errorf("stats: failed to stat segment %d: %w", segID, err)
+		}
+		stats.DiskSize += info.Size()
+		stats.DeadBytes += db.segmentDeadLocked(segID, info.Size())
+		if db.isActiveLocked(segID) {
+			stats.ActiveSegmentSize += info.Size()
+		} else {
+			if db.manifest.format(segID) < entryFormatCurrent {
+				stats.LegacySegments++
+			}
+			if db.needsEncryptionLocked(segID) {
+				stats.UnencryptedSegments++
+			}
+		}
+		if v, ok := db.manifest.validation(segID); ok && v.Error != "" {
+			stats.InvalidSegments++
+		}
+	}
+	for _, seg := range db.coldSegments {
+		stats.ColdSegments++
+		stats.ColdBytes += seg.stub.Size
+	}
+	stats.SharedValues, stats.SharedValueRefs, stats.ChunkedValues = db.blobs.len()
+	if stats.DiskSize > 0 {
+		stats.FragmentationRatio = float64(stats.DeadBytes) / float64(stats.DiskSize)
+	}
+	return stats, nil
+}
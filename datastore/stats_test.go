@@ -0,0 +1,52 @@
+package datastore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDb_Stats(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	value := strings.Repeat("v", 100)
+	for i := 0; i < 30; i++ {
+		if err := db.Put("overwritten", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.PutInt64("counter", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.KeyCount != 2 {
+		t.Errorf("KeyCount = %d, want 2", stats.KeyCount)
+	}
+	if stats.SegmentCount < 3 {
+		t.Errorf("SegmentCount = %d, expected rotation to create at least 3 segments", stats.SegmentCount)
+	}
+	if stats.ActiveSegmentSize <= 0 || stats.ActiveSegmentSize > stats.DiskSize {
+		t.Errorf("unexpected sizes: active %d, disk %d", stats.ActiveSegmentSize, stats.DiskSize)
+	}
+	if stats.DeadBytes <= 0 || stats.DeadBytes >= stats.DiskSize {
+		t.Errorf("DeadBytes = %d of %d, expected overwritten records to be counted", stats.DeadBytes, stats.DiskSize)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.MergeCount != 1 || merged.LastMergeDuration <= 0 {
+		t.Errorf("merge was not recorded: %+v", merged)
+	}
+	if merged.DeadBytes >= stats.DeadBytes {
+		t.Errorf("DeadBytes did not shrink after merge: %d -> %d", stats.DeadBytes, merged.DeadBytes)
+	}
+}
@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"sort"
+	"sync"
+)
+
+// Storage - спільний інтерфейс сховищ рядкових значень: файлового Db та MemoryStorage.
+type Storage interface {
+	Put(key, value string) error
+	// Get повертає ErrNotFound, якщо ключа немає.
+	Get(key string) (string, error)
+	// Delete повертає ErrNotFound, якщо ключа немає.
+	Delete(key string) error
+	// Iterate обходить ключі в лексикографічному порядку, поки fn повертає true.
+	Iterate(fn func(key string, dataType byte) bool)
+	Close() error
+}
+
+var (
+	_ Storage = (*Db)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
+
+// MemoryStorage зберігає значення лише в пам'яті, без файлів на диску. Призначене для
+// інтеграційних тестів і тимчасових розгортань, де дані не мають переживати перезапуск.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	values map[string]string
+	closed bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{values: make(map[string]string)}
+}
+
+func (s *MemoryStorage) Put(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *MemoryStorage) Get(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.values[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.values, key)
+	return nil
+}
+
+// Iterate обходить знімок ключів, тому fn може безпечно змінювати сховище.
+func (s *MemoryStorage) Iterate(fn func(key string, dataType byte) bool) {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key, DataTypeString) {
+			return
+		}
+	}
+}
+
+// Close відхиляє подальші записи; читання лишаються доступними, як і в Db.
+func (s *MemoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
@@ -0,0 +1,67 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+)
+
+// testStorage перевіряє поведінку, спільну для всіх реалізацій Storage.
+func testStorage(t *testing.T, s Storage) {
+	t.Helper()
+	for _, kv := range [][2]string{{"b", "2"}, {"a", "1"}, {"c", "3"}, {"a", "1.1"}} {
+		if err := s.Put(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := s.Get("a"); err != nil || got != "1.1" {
+		t.Errorf("Get(a) = %q, %v", got, err)
+	}
+	if err := s.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted key returned %v", err)
+	}
+	if err := s.Delete("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing key returned %v", err)
+	}
+
+	var keys []string
+	s.Iterate(func(key string, dataType byte) bool {
+		if dataType != DataTypeString {
+			t.Errorf("key %s has type %d", key, dataType)
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Errorf("Iterate visited %v, want [a c]", keys)
+	}
+	visited := 0
+	s.Iterate(func(string, byte) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Iterate did not stop: %d keys visited", visited)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("d", "4"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put after Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestStorage_Db(t *testing.T) {
+	db, err := NewDbWithOptions(t.TempDir(), testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, db)
+}
+
+func TestStorage_Memory(t *testing.T) {
+	testStorage(t, NewMemoryStorage())
+}
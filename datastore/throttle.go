@@ -0,0 +1,218 @@
+package datastore
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMergePauseLatency  = 50 * time.Millisecond
+	defaultMergeResumeLatency = 10 * time.Millisecond
+
+	// readLatencyQuantile - квантиль затримки читань, який порівнюється з порогами.
+	readLatencyQuantile = 0.9
+	// readLatencyWindow - тривалість вікна гістограми затримок читань. Квантиль рахується
+	// за поточне й попереднє вікно, тож після паузи без читань навантаження стає нульовим.
+	readLatencyWindow = 5 * time.Second
+	// latencyBuckets - кількість кошиків гістограми; межа кошика i - 1мкс << i, останній
+	// кошик збирає довші затримки.
+	latencyBuckets = 24
+
+	// mergeThrottleBatch - кількість записів, після яких фонове злиття перевіряє затримку читань.
+	mergeThrottleBatch = 256
+	// mergeThrottlePoll - період перевірки, поки фонове злиття призупинене.
+	mergeThrottlePoll = 100 * time.Millisecond
+)
+
+// LatencyQuantiles - необов'язкове розширення MetricsCollector для колекторів, що ведуть
+// гістограми тривалостей. Quantile повертає квантиль q тривалості операції op за останній
+// час або 0, якщо вимірів немає. Якщо Options.Metrics його реалізує, призупинення злиття
+// спирається на дані колектора; інакше база веде власну гістограму виміряних OpRead.
+type LatencyQuantiles interface {
+	Quantile(op string, q float64) time.Duration
+}
+
+// latencyHistogram - гістограма тривалостей з двома вікнами, що чергуються. Запис вимірів
+// не бере замків.
+type latencyHistogram struct {
+	windows [2][latencyBuckets]atomic.Int64
+	current atomic.Int32
+	// mu серіалізує зміну вікон у quantile.
+	mu      sync.Mutex
+	rotated time.Time
+}
+
+func latencyBucket(d time.Duration) int {
+	for i := 0; i < latencyBuckets-1; i++ {
+		if d <= time.Microsecond<<i {
+			return i
+		}
+	}
+	return latencyBuckets - 1
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.windows[h.current.Load()][latencyBucket(d)].Add(1)
+}
+
+// quantile повертає верхню межу кошика, в який потрапляє квантиль q вимірів поточного й
+// попереднього вікон.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if h.rotated.IsZero() {
+		h.rotated = now
+	}
+	if elapsed := now.Sub(h.rotated); elapsed >= readLatencyWindow {
+		next := 1 - h.current.Load()
+		if elapsed >= 2*readLatencyWindow {
+			// Попереднє вікно теж застаріло.
+			h.clear(h.current.Load())
+		}
+		h.clear(next)
+		h.current.Store(next)
+		h.rotated = now
+	}
+	var counts [latencyBuckets]int64
+	var total int64
+	for w := range h.windows {
+		for i := range counts {
+			n := h.windows[w][i].Load()
+			counts[i] += n
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(total)))
+	var seen int64
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			return time.Microsecond << i
+		}
+	}
+	return time.Microsecond << (latencyBuckets - 1)
+}
+
+func (h *latencyHistogram) clear(w int32) {
+	for i := range h.windows[w] {
+		h.windows[w][i].Store(0)
+	}
+}
+
+// readLatencyMetrics передає виміри колектору застосунку й записує тривалості OpRead у
+// гістограму, з якої mergeThrottle бере затримку читань.
+type readLatencyMetrics struct {
+	MetricsCollector
+	reads *latencyHistogram
+}
+
+func (m readLatencyMetrics) Observe(op string, d time.Duration) {
+	if op == OpRead {
+		m.reads.observe(d)
+	}
+	m.MetricsCollector.Observe(op, d)
+}
+
+func (m readLatencyMetrics) Quantile(op string, q float64) time.Duration {
+	if op != OpRead {
+		return 0
+	}
+	return m.reads.quantile(q)
+}
+
+// withLatencyQuantiles повертає колектор, з якого можна взяти квантилі затримок: сам
+// metrics, якщо він їх веде, інакше обгортку з власною гістограмою читань.
+func withLatencyQuantiles(metrics MetricsCollector) MetricsCollector {
+	if _, ok := metrics.(LatencyQuantiles); ok {
+		return metrics
+	}
+	return readLatencyMetrics{MetricsCollector: metrics, reads: &latencyHistogram{}}
+}
+
+// mergeThrottle призупиняє фонове злиття, коли затримка читань перевищує pauseAbove,
+// і відновлює його лише після падіння нижче resumeBelow (гістерезис). Перевіряється перед
+// запуском фонового злиття й між пакетами записів, які воно копіює.
+type mergeThrottle struct {
+	mu          sync.Mutex
+	pauseAbove  time.Duration
+	resumeBelow time.Duration
+	paused      bool
+}
+
+// allow повертає true, якщо фонове злиття можна продовжувати при поточній затримці читань.
+func (m *mergeThrottle) allow(latency time.Duration) (allowed bool, changed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pauseAbove <= 0 {
+		return true, false
+	}
+	if m.paused && latency < m.resumeBelow {
+		m.paused = false
+		return true, true
+	}
+	if !m.paused && latency > m.pauseAbove {
+		m.paused = true
+		return false, true
+	}
+	return !m.paused, false
+}
+
+func (m *mergeThrottle) isPaused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
+// mergeAllowed перевіряє затримку читань за даними Options.Metrics і повідомляє, чи може
+// фонове злиття продовжуватися.
+func (db *Db) mergeAllowed() bool {
+	latency := db.opts.Metrics.(LatencyQuantiles).Quantile(OpRead, readLatencyQuantile)
+	allowed, changed := db.throttle.allow(latency)
+	if changed {
+		if allowed {
+			db.opts.Logger.Infof("Merge resumed: read latency %s is back below threshold", latency)
+		} else {
+			db.opts.Logger.Infof("Merge paused: read latency %s exceeds threshold", latency)
+		}
+	}
+	return allowed
+}
+
+// waitMergeThrottle чекає, доки призупинене фонове злиття можна продовжити. Викликається
+// між пакетами записів злиття без замків бази.
+func (db *Db) waitMergeThrottle(ctx context.Context) error {
+	for !db.mergeAllowed() {
+		select {
+		case <-time.After(mergeThrottlePoll):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-db.workers.done():
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+// SetMergeThrottle задає пороги затримки читань: вище pauseAbove фонове злиття
+// призупиняється, нижче resumeBelow - відновлюється. pauseAbove <= 0 вимикає призупинення.
+func (db *Db) SetMergeThrottle(pauseAbove, resumeBelow time.Duration) {
+	db.throttle.mu.Lock()
+	defer db.throttle.mu.Unlock()
+	db.throttle.pauseAbove = pauseAbove
+	db.throttle.resumeBelow = resumeBelow
+	if pauseAbove <= 0 {
+		db.throttle.paused = false
+	}
+}
+
+// MergePaused повідомляє, чи фонове злиття зараз призупинене через навантаження читанням.
+func (db *Db) MergePaused() bool {
+	return db.throttle.isPaused()
+}
@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMergeThrottle_Hysteresis(t *testing.T) {
+	m := mergeThrottle{pauseAbove: 50 * time.Millisecond, resumeBelow: 10 * time.Millisecond}
+
+	steps := []struct {
+		latency time.Duration
+		allowed bool
+	}{
+		{5 * time.Millisecond, true},
+		{60 * time.Millisecond, false},
+		{30 * time.Millisecond, false}, // між порогами - залишаємось на паузі
+		{9 * time.Millisecond, true},
+		{30 * time.Millisecond, true}, // між порогами - продовжуємо зливати
+		{51 * time.Millisecond, false},
+	}
+	for i, step := range steps {
+		if allowed, _ := m.allow(step.latency); allowed != step.allowed {
+			t.Errorf("step %d: allow(%s) = %t, want %t", i, step.latency, allowed, step.allowed)
+		}
+	}
+
+	disabled := mergeThrottle{}
+	if allowed, _ := disabled.allow(time.Second); !allowed {
+		t.Error("disabled throttle must always allow merges")
+	}
+}
+
+func TestLatencyHistogram_Quantile(t *testing.T) {
+	var h latencyHistogram
+	if got := h.quantile(0.9); got != 0 {
+		t.Errorf("expected zero latency without observations, got %s", got)
+	}
+	for i := 0; i < 9; i++ {
+		h.observe(3 * time.Microsecond)
+	}
+	h.observe(100 * time.Millisecond)
+	if got := h.quantile(0.9); got != 4*time.Microsecond {
+		t.Errorf("p90 = %s, want the 4µs bucket", got)
+	}
+	if got := h.quantile(1); got < 100*time.Millisecond {
+		t.Errorf("p100 = %s, want at least 100ms", got)
+	}
+
+	// Після зміни вікна виміри попереднього ще враховуються, після двох - ні.
+	h.rotated = time.Now().Add(-readLatencyWindow)
+	if got := h.quantile(1); got < 100*time.Millisecond {
+		t.Errorf("p100 after one window = %s, want at least 100ms", got)
+	}
+	h.rotated = time.Now().Add(-2 * readLatencyWindow)
+	if got := h.quantile(1); got != 0 {
+		t.Errorf("expected latency to reset after idle period, got %s", got)
+	}
+}
+
+// quantileMetrics - колектор, що сам повідомляє затримку читань.
+type quantileMetrics struct {
+	NopMetrics
+	latency atomic.Int64
+}
+
+func (m *quantileMetrics) Quantile(op string, _ float64) time.Duration {
+	if op != OpRead {
+		return 0
+	}
+	return time.Duration(m.latency.Load())
+}
+
+func TestDb_BackgroundMergePausesBetweenBatches(t *testing.T) {
+	metrics := &quantileMetrics{}
+	opts := testOptions(true)
+	opts.Metrics = metrics
+	opts.MaxFileSize = 64 * 1024
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value := strings.Repeat("v", 200)
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3*mergeThrottleBatch; i++ {
+			if err := db.Put(fmt.Sprintf("key%04d", i), value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Поки копіюються перші записи, затримка читань стає високою.
+	db.SetMergeThrottle(50*time.Millisecond, 10*time.Millisecond)
+	done := make(chan error, 1)
+	go func() { done <- db.tryMergeSegments() }()
+	deadline := time.After(5 * time.Second)
+	for !db.MergePaused() {
+		metrics.latency.Store(int64(time.Second))
+		select {
+		case err := <-done:
+			t.Fatalf("merge finished without pausing: %v", err)
+		case <-deadline:
+			t.Fatal("merge did not pause")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("paused merge finished: %v", err)
+	case <-time.After(3 * mergeThrottlePoll):
+	}
+
+	metrics.latency.Store(0)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("merge did not resume")
+	}
+	if db.MergePaused() {
+		t.Error("throttle still paused after latency dropped")
+	}
+	if got, err := db.Get("key0000"); err != nil || got != value {
+		t.Errorf("Get after merge = %q, %v", got, err)
+	}
+}
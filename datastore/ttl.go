@@ -0,0 +1,82 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// expiryCheckInterval - період, з яким фонова горутина видаляє прострочені ключі.
+// Прострочений ключ залишається видимим не довше цього інтервалу.
+const expiryCheckInterval = 250 * time.Millisecond
+
+// ExpiresAt повертає час, після якого ключ буде видалено. ok == false, якщо ключ
+// не існує або не має терміну дії.
+func (db *Db) ExpiresAt(key string) (t time.Time, ok bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	expiresAt, ok := db.expiries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, expiresAt), true
+}
+
+// readExpiryLocked читає час закінчення терміну дії з запису сегмента. Викликається під db.mu.
+func (db *Db) readExpiryLocked(segID int, rec hintRecord) (int64, error) {
+	file, ok := db.segmentReaderLocked(segID)
+	if !ok {
+		return 0, fmt.Errorf("segment %d for expiry of key '%s' is not open", segID, rec.key)
+	}
+	data := make([]byte, rec.size)
+	if _, err := file.ReadAt(data, rec.offset); err != nil {
+		return 0, fmt.Errorf("failed to read expiry of key '%s' from segment %d: %w", rec.key, segID, err)
+	}
+	var e entry
+	if err := e.Decode(data); err != nil {
+		return 0, fmt.Errorf("failed to decode expiry of key '%s': %w", rec.key, err)
+	}
+	return e.valueInt, nil
+}
+
+// encodeExpiry кодує запис терміну дії ключа.
+func encodeExpiry(key string, expiresAt int64) []byte {
+	e := entry{key: key, valueInt: expiresAt, dataType: dataTypeExpiry}
+	return e.Encode()
+}
+
+// expiredKeysLocked повертає ключі, термін дії яких минув. Викликається під db.mu.
+func (db *Db) expiredKeysLocked(now int64) []string {
+	var keys []string
+	for key, expiresAt := range db.expiries {
+		if expiresAt <= now {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// expireKeys періодично записує надгробки для прострочених ключів. Перевірка терміну
+// повторюється в горутині запису, тож ключ, перезаписаний тим часом, не буде видалено.
+func (db *Db) expireKeys(ctx context.Context) error {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.mu.RLock()
+			keys := db.expiredKeysLocked(time.Now().UnixNano())
+			db.mu.RUnlock()
+			if len(keys) == 0 {
+				continue
+			}
+			req := putRequest{dataType: dataTypeTombstone, deleteKeys: keys, onlyExpired: true}
+			if err := db.submit(req); err != nil && !errors.Is(err, ErrClosed) {
+				db.opts.Logger.Warnf("failed to delete %d expired keys: %v", len(keys), err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package datastore
+
+import (
+	"math"
+	"time"
+)
+
+// boolValue кодує bool так, як він зберігається в entry.valueInt.
+func boolValue(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// PutFloat64 записує значення float64.
+func (db *Db) PutFloat64(key string, value float64) error {
+	return db.submit(putRequest{key: key, valueInt: int64(math.Float64bits(value)), dataType: DataTypeFloat64})
+}
+
+// PutBool записує значення bool.
+func (db *Db) PutBool(key string, value bool) error {
+	return db.submit(putRequest{key: key, valueInt: boolValue(value), dataType: DataTypeBool})
+}
+
+// PutBytes записує довільні байти. Зріз копіюється, тож після виклику його можна змінювати.
+func (db *Db) PutBytes(key string, value []byte) error {
+	return db.submit(putRequest{key: key, value: string(value), dataType: DataTypeBytes})
+}
+
+// GetFloat64 повертає значення float64. Для значень іншого типу повертає ErrWrongType.
+func (db *Db) GetFloat64(key string) (float64, error) {
+	record, err := db.getTyped(key, DataTypeFloat64)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(uint64(record.valueInt)), nil
+}
+
+// GetBool повертає значення bool. Для значень іншого типу повертає ErrWrongType.
+func (db *Db) GetBool(key string) (bool, error) {
+	record, err := db.getTyped(key, DataTypeBool)
+	if err != nil {
+		return false, err
+	}
+	return record.valueInt != 0, nil
+}
+
+// GetBytes повертає байтове значення. Для значень іншого типу, зокрема рядків, повертає ErrWrongType.
+func (db *Db) GetBytes(key string) ([]byte, error) {
+	record, err := db.getTyped(key, DataTypeBytes)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(record.value), nil
+}
+
+// getTyped читає запис ключа, перевіряючи його тип за індексом до читання з диску.
+func (db *Db) getTyped(key string, dataType byte) (entry, error) {
+	defer db.observeRead(time.Now(), key)
+	db.segMu.RLock()
+	defer db.segMu.RUnlock()
+	idxVal, ok, err := db.lookupForRead(key)
+	if err != nil {
+		return entry{}, err
+	}
+	if !ok {
+		return entry{}, ErrNotFound
+	}
+	if idxVal.dataType != dataType {
+		return entry{}, ErrWrongType
+	}
+	return db.readRecordLocked(key, idxVal)
+}
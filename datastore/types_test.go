@@ -0,0 +1,88 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestDb_Float64BoolBytes(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.Compression = CompressionSnappy
+	opts.CompressionThreshold = 64
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bytes.Repeat([]byte{0, 1, 2, 0xff}, 100)
+	if err := db.PutFloat64("pi", math.Pi); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutFloat64("negzero", math.Copysign(0, -1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBool("yes", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBool("no", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBytes("raw", raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutBytes("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if v, err := db.GetFloat64("pi"); err != nil || v != math.Pi {
+			t.Errorf("%s: GetFloat64(pi) = %v, %v", stage, v, err)
+		}
+		if v, err := db.GetFloat64("negzero"); err != nil || !math.Signbit(v) {
+			t.Errorf("%s: GetFloat64(negzero) = %v, %v", stage, v, err)
+		}
+		if v, err := db.GetBool("yes"); err != nil || !v {
+			t.Errorf("%s: GetBool(yes) = %v, %v", stage, v, err)
+		}
+		if v, err := db.GetBool("no"); err != nil || v {
+			t.Errorf("%s: GetBool(no) = %v, %v", stage, v, err)
+		}
+		if v, err := db.GetBytes("raw"); err != nil || !bytes.Equal(v, raw) {
+			t.Errorf("%s: GetBytes(raw) = %v, %v", stage, v, err)
+		}
+		if v, err := db.GetBytes("empty"); err != nil || len(v) != 0 {
+			t.Errorf("%s: GetBytes(empty) = %v, %v", stage, v, err)
+		}
+	}
+	check("before reopen")
+
+	if _, err := db.GetFloat64("yes"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetFloat64 of a bool: %v, want ErrWrongType", err)
+	}
+	if _, err := db.GetBytes("pi"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("GetBytes of a float64: %v, want ErrWrongType", err)
+	}
+	if _, err := db.Get("raw"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("Get of bytes: %v, want ErrWrongType", err)
+	}
+	if _, err := db.GetBool("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBool of a missing key: %v, want ErrNotFound", err)
+	}
+	if s, err := db.GetAsString("pi"); err != nil || s != "3.141592653589793" {
+		t.Errorf("GetAsString(pi) = %q, %v", s, err)
+	}
+	if kv, etag, err := db.GetWithETag("yes"); err != nil || kv.Value != true || etag != ETag(true) {
+		t.Errorf("GetWithETag(yes) = %+v, %q, %v", kv, etag, err)
+	}
+
+	db.Close()
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// validateSegment повністю читає сегмент: декодує всі записи, будує з них підказки
+// та порівнює з очікуваними, а також рахує контрольну суму файлу.
+// Помилка повертається, лише якщо файл не вдалося відкрити.
+func validateSegment(path string, expected []hintRecord) (SegmentValidation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SegmentValidation{}, err
+	}
+	defer f.Close()
+	expected = append([]hintRecord(nil), expected...)
+	sort.Slice(expected, func(i, j int) bool { return expected[i].offset < expected[j].offset })
+	result := SegmentValidation{}
+	crc := crc32.NewIEEE()
+	reader := bufio.NewReader(io.TeeReader(f, crc))
+	var offset int64
+	for {
+		var e entry
+		n, err := e.DecodeFromReader(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			result.Error = fmt.Sprintf("entry at offset %d: %v", offset, err)
+			break
+		}
+		if result.Entries < len(expected) {
+			want := expected[result.Entries]
+			got := hintRecord{key: e.key, offset: offset, size: int64(n), dataType: e.dataType}
+			if got != want {
+				result.Error = fmt.Sprintf("entry %d at offset %d does not match the index: got key '%s' (type %d, %d bytes), want key '%s' (type %d, %d bytes)",
+					result.Entries, offset, got.key, got.dataType, got.size, want.key, want.dataType, want.size)
+				break
+			}
+		}
+		result.Entries++
+		offset += int64(n)
+	}
+	// Дочитуємо залишок, щоб контрольна сума покривала весь файл.
+	_, _ = io.Copy(io.Discard, reader)
+	result.Size = offset
+	if stat, err := f.Stat(); err == nil {
+		result.Size = stat.Size()
+	}
+	result.Checksum = fmt.Sprintf("%08x", crc.Sum32())
+	if result.Error == "" && result.Entries != len(expected) {
+		result.Error = fmt.Sprintf("segment has %d entries, index expects %d", result.Entries, len(expected))
+	}
+	result.ValidatedAt = time.Now()
+	return result, nil
+}
+
+// validateSegmentAsync перевіряє запечатаний сегмент у фоні та записує результат у маніфест.
+func (db *Db) validateSegmentAsync(segID int, expected []hintRecord) {
+	path := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, segID))
+	db.workers.Go("validate-segment", func(context.Context) error {
+		result, err := validateSegment(path, expected)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				db.opts.Logger.Warnf("failed to validate segment %d: %v", segID, err)
+			}
+			return nil
+		}
+		// Поки йшла перевірка, злиття могло видалити сегмент або замінити його файл.
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		file, ok := db.segmentFiles[segID]
+		if !ok {
+			return nil
+		}
+		if stat, statErr := file.Stat(); statErr != nil || stat.Size() != result.Size {
+			return nil
+		}
+		if result.Error != "" {
+			db.opts.Logger.Warnf("validation of segment %d failed: %s", segID, result.Error)
+		}
+		if err := db.manifest.setValidation(segID, result); err != nil {
+			db.opts.Logger.Warnf("%v", err)
+		}
+		return nil
+	})
+}
+
+// SegmentValidation повертає результат останньої перевірки сегмента.
+func (db *Db) SegmentValidation(segID int) (SegmentValidation, bool) {
+	return db.manifest.validation(segID)
+}
@@ -0,0 +1,89 @@
+package datastore
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForValidation(t *testing.T, db *Db, segID int) SegmentValidation {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if v, ok := db.SegmentValidation(segID); ok {
+			return v
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("segment %d was not validated", segID)
+	return SegmentValidation{}
+}
+
+func TestDb_ValidateSegmentOnRotation(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	for i := 0; i < 80; i++ {
+		if err := db.Put(fmt.Sprintf("validateKey%03d", i), fmt.Sprintf("value%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := waitForValidation(t, db, 0)
+	if v.Error != "" || v.Entries == 0 {
+		t.Fatalf("unexpected validation result: %+v", v)
+	}
+	data, err := os.ReadFile(filepath.Join(db.dir, outFileNamePrefix+"0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)); v.Checksum != want || v.Size != int64(len(data)) {
+		t.Errorf("validation %+v does not match file (checksum %s, size %d)", v, want, len(data))
+	}
+
+	reloaded, err := loadManifest(db.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reloaded.validation(0); !ok || got.Checksum != v.Checksum {
+		t.Errorf("manifest on disk has %+v, want %+v", got, v)
+	}
+}
+
+func TestValidateSegment_DetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, outFileNamePrefix+"0")
+	var data []byte
+	var hints []hintRecord
+	for _, key := range []string{"a", "b", "c"} {
+		e := entry{key: key, value: "value-" + key, dataType: DataTypeString}
+		encoded := e.Encode()
+		hints = append(hints, hintRecord{key: key, offset: int64(len(data)), size: int64(len(encoded)), dataType: DataTypeString})
+		data = append(data, encoded...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := validateSegment(path, hints); err != nil || v.Error != "" || v.Entries != 3 {
+		t.Fatalf("valid segment: got %+v, %v", v, err)
+	}
+
+	// Пошкоджуємо ключ другого запису.
+	data[hints[1].offset+entryHeaderSize+4] = 'x'
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := validateSegment(path, hints); v.Error == "" {
+		t.Errorf("expected corrupted key to be reported, got %+v", v)
+	}
+
+	// Обрізаний файл.
+	if err := os.WriteFile(path, data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := validateSegment(path, hints); v.Error == "" {
+		t.Errorf("expected truncated segment to be reported, got %+v", v)
+	}
+}
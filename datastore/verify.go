@@ -0,0 +1,210 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Види проблем, які знаходить Verify.
+const (
+	// ProblemFraming - запис сегмента не вдалося декодувати; решта сегмента не перевіряється.
+	ProblemFraming = "framing"
+	// ProblemChecksum - контрольна сума запечатаного сегмента не збігається із записаною в маніфесті.
+	ProblemChecksum = "checksum"
+	// ProblemIndex - індекс вказує на місце сегмента, де немає відповідного запису.
+	ProblemIndex = "index"
+)
+
+// VerifyProblem - невідповідність, знайдена Verify.
+type VerifyProblem struct {
+	Kind    string `json:"kind"`
+	Segment int    `json:"segment"`
+	Offset  int64  `json:"offset"`
+	// Key - ключ індексу, якого стосується проблема, якщо вона виявлена через індекс.
+	Key    string `json:"key,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// VerifyReport - результат Verify.
+type VerifyReport struct {
+	Segments int   `json:"segments"`
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	// IndexEntries - кількість перевірених записів індексу: ключів, блоків часових рядів і спільних значень.
+	IndexEntries int             `json:"indexEntries"`
+	Problems     []VerifyProblem `json:"problems"`
+	Duration     time.Duration   `json:"duration"`
+}
+
+// OK повідомляє, чи не знайдено жодної проблеми.
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// verifyCheckEvery - через скільки записів сегмента Verify перевіряє скасування контексту.
+const verifyCheckEvery = 4096
+
+// scannedRecord - запис, знайдений Verify у сегменті.
+type scannedRecord struct {
+	key      string
+	size     int64
+	dataType byte
+}
+
+// Verify перевіряє стан бази на диску: читає всі сегменти, декодуючи кожен запис,
+// порівнює контрольні суми запечатаних сегментів із записаними в маніфесті та звіряє
+// індекс (ключі, блоки часових рядів і спільні значення) з розташуванням записів у файлах.
+// Знайдені невідповідності повертаються у звіті; помилка означає, що перевірку не вдалося
+// виконати (наприклад, скасовано ctx). Перевіряється стан на момент виклику, як у View:
+// записи та злиття під час перевірки на неї не впливають.
+func (db *Db) Verify(ctx context.Context) (VerifyReport, error) {
+	start := time.Now()
+	db.mu.RLock()
+	v := db.viewLocked()
+	if v.err != nil {
+		db.mu.RUnlock()
+		v.Close()
+		return VerifyReport{}, fmt.Errorf("verify: %w", v.err)
+	}
+	sizes := make(map[int]int64, len(v.files))
+	validations := make(map[int]SegmentValidation, len(v.files))
+	for segID, file := range v.files {
+		stat, err := file.Stat()
+		if err != nil {
+			db.mu.RUnlock()
+			v.Close()
+			return VerifyReport{}, fmt.Errorf("verify: failed to stat segment %d: %w", segID, err)
+		}
+		sizes[segID] = stat.Size()
+		if db.isActiveLocked(segID) {
+			continue
+		}
+		if validation, ok := db.manifest.validation(segID); ok && validation.Checksum != "" {
+			validations[segID] = validation
+		}
+	}
+	db.mu.RUnlock()
+	defer v.Close()
+
+	report := VerifyReport{Problems: []VerifyProblem{}}
+	segIDs := make([]int, 0, len(v.files))
+	for segID := range v.files {
+		segIDs = append(segIDs, segID)
+	}
+	sort.Ints(segIDs)
+	records := make(map[int]map[int64]scannedRecord, len(segIDs))
+	// scanned - до якого зміщення сегмент вдалося прочитати.
+	scanned := make(map[int]int64, len(segIDs))
+	for _, segID := range segIDs {
+		if err := ctx.Err(); err != nil {
+			return VerifyReport{}, err
+		}
+		segRecords, end, err := verifySegment(ctx, v.files[segID], sizes[segID], validations[segID], segID, &report)
+		if err != nil {
+			return VerifyReport{}, err
+		}
+		records[segID] = segRecords
+		scanned[segID] = end
+		report.Segments++
+		report.Bytes += sizes[segID]
+	}
+
+	check := func(key string, val indexValue, wantKey string) {
+		report.IndexEntries++
+		if v.cold[val.segmentID] != nil {
+			// Архівовані сегменти не завантажуються зі сховища заради перевірки.
+			return
+		}
+		problem := VerifyProblem{Kind: ProblemIndex, Segment: val.segmentID, Offset: val.offset, Key: key}
+		rec, found := records[val.segmentID][val.offset]
+		switch {
+		case found && rec.key == wantKey && rec.size == val.size && rec.dataType == val.dataType:
+			return
+		case found:
+			problem.Detail = fmt.Sprintf("record at this offset is key '%s' (type %d, %d bytes), index expects key '%s' (type %d, %d bytes)",
+				rec.key, rec.dataType, rec.size, wantKey, val.dataType, val.size)
+		case records[val.segmentID] == nil:
+			problem.Detail = "segment does not exist"
+		case val.offset < scanned[val.segmentID]:
+			problem.Detail = "no record starts at this offset"
+		default:
+			problem.Detail = fmt.Sprintf("offset is in the unreadable part of the segment (readable up to %d)", scanned[val.segmentID])
+		}
+		report.Problems = append(report.Problems, problem)
+	}
+	for key, val := range v.index {
+		check(key, val, key)
+	}
+	for key, chunks := range v.series {
+		for _, val := range chunks {
+			check(key, val, key)
+		}
+	}
+	for h, val := range v.blobs {
+		check("", val, h.String())
+	}
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		a, b := report.Problems[i], report.Problems[j]
+		if a.Segment != b.Segment {
+			return a.Segment < b.Segment
+		}
+		return a.Offset < b.Offset
+	})
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// verifySegment читає перші size байтів сегмента, додаючи до звіту проблеми формату та
+// контрольної суми. Повертає знайдені записи за зміщеннями та зміщення, до якого сегмент
+// вдалося прочитати. validation - остання перевірка запечатаного сегмента, якщо вона є.
+func verifySegment(ctx context.Context, file *os.File, size int64, validation SegmentValidation, segID int, report *VerifyReport) (map[int64]scannedRecord, int64, error) {
+	records := make(map[int64]scannedRecord)
+	crc := crc32.NewIEEE()
+	reader := bufio.NewReader(io.TeeReader(io.NewSectionReader(file, 0, size), crc))
+	var offset int64
+	for {
+		if len(records)%verifyCheckEvery == verifyCheckEvery-1 {
+			if err := ctx.Err(); err != nil {
+				return nil, 0, err
+			}
+		}
+		var e entry
+		n, err := e.DecodeFromReader(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, VerifyProblem{Kind: ProblemFraming, Segment: segID, Offset: offset,
+				Detail: fmt.Sprintf("%v; %d bytes after this offset were not checked", err, size-offset)})
+			break
+		}
+		rec := scannedRecord{key: e.key, size: int64(n), dataType: e.dataType}
+		if e.dataType == dataTypeRef || e.dataType == dataTypeChunked {
+			// Індекс зберігає для посилань тип значення, як applyHintRecords.
+			_, rec.dataType = e.blobRefs()
+		}
+		records[offset] = rec
+		report.Entries++
+		offset += int64(n)
+	}
+	if validation.Checksum == "" {
+		return records, offset, nil
+	}
+	// Дочитуємо залишок, щоб контрольна сума покривала весь файл, як у validateSegment.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return nil, 0, fmt.Errorf("verify: failed to read segment %d: %w", segID, err)
+	}
+	if checksum := fmt.Sprintf("%08x", crc.Sum32()); validation.Size != size || validation.Checksum != checksum {
+		report.Problems = append(report.Problems, VerifyProblem{Kind: ProblemChecksum, Segment: segID,
+			Detail: fmt.Sprintf("segment is %d bytes with checksum %s, manifest recorded %d bytes with checksum %s at %s",
+				size, checksum, validation.Size, validation.Checksum, validation.ValidatedAt.Format(time.RFC3339))})
+	}
+	return records, offset, nil
+}
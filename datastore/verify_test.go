@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func problemKinds(report VerifyReport) map[string]int {
+	kinds := make(map[string]int)
+	for _, p := range report.Problems {
+		kinds[p.Kind]++
+	}
+	return kinds
+}
+
+func TestDb_Verify(t *testing.T) {
+	opts := testOptions(true)
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	opts.Compression = CompressionSnappy
+	opts.CompressionThreshold = 64
+	opts.KeyProvider = testKeys("k1")
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("shared", strings.Repeat("shared ", 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("long", strings.Repeat("compressible ", 20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("key3"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Segments < 2 || report.Entries == 0 || report.IndexEntries < 30 {
+		t.Fatalf("Verify of a healthy database = %+v", report)
+	}
+
+	// Пошкоджене значення не ламає формат, але змінює контрольну суму сегмента.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if v, ok := db.SegmentValidation(0); ok && v.Checksum != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("segment 0 was not validated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	path := filepath.Join(dir, outFileNamePrefix+"0")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Останній байт сегмента - байт значення останнього запису.
+	data[len(data)-1] ^= 0xFF
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = db.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kinds := problemKinds(report); kinds[ProblemChecksum] != 1 || kinds[ProblemFraming] != 0 {
+		t.Errorf("Verify after flipping a value byte found %v: %+v", kinds, report.Problems)
+	}
+
+	// Обрізаний сегмент: помилка формату в кінці та ключі, що вказують за неї.
+	if err := os.Truncate(path, int64(len(data)-3)); err != nil {
+		t.Fatal(err)
+	}
+	db.currentIndex.set("ghost", indexValue{segmentID: 0, offset: 1, size: 10, dataType: DataTypeString})
+	report, err = db.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := problemKinds(report)
+	if kinds[ProblemFraming] != 1 || kinds[ProblemChecksum] != 1 || kinds[ProblemIndex] < 2 {
+		t.Errorf("Verify of a truncated segment found %v: %+v", kinds, report.Problems)
+	}
+	found := false
+	for _, p := range report.Problems {
+		found = found || p.Kind == ProblemIndex && p.Key == "ghost" && p.Segment == 0
+	}
+	if !found {
+		t.Errorf("index entry pointing into the middle of a record was not reported: %+v", report.Problems)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Verify(ctx); err == nil {
+		t.Error("Verify with a cancelled context succeeded")
+	}
+}
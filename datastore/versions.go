@@ -0,0 +1,122 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Історія версій (Options.KeyVersions). Для кожного ключа база пам'ятає, де лежать
+// кілька останніх записів його значення, щоб VersionAt міг прочитати значення на момент
+// запису з певним номером. Історія живе лише в пам'яті: після відкриття вона порожня,
+// а злиття забуває версії, записи яких воно прибрало з диску.
+
+// ErrVersionUnavailable повертається VersionAt, якщо версії ключа з таким номером
+// база вже не зберігає.
+var ErrVersionUnavailable = errors.New("key version is not available")
+
+type keyVersion struct {
+	seq    uint64
+	idxVal indexValue
+}
+
+// versionHistory - останні версії ключів, від найстарішої до поточної.
+type versionHistory struct {
+	mu    sync.Mutex
+	limit int
+	keys  map[string][]keyVersion
+}
+
+// newVersionHistory повертає історію, що зберігає поточну та limit попередніх версій;
+// nil, якщо limit не додатний.
+func newVersionHistory(limit int) *versionHistory {
+	if limit <= 0 {
+		return nil
+	}
+	return &versionHistory{limit: limit, keys: make(map[string][]keyVersion)}
+}
+
+// add запам'ятовує нову поточну версію ключа, забуваючи найстаріші понад ліміт.
+func (h *versionHistory) add(key string, seq uint64, idxVal indexValue) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	versions := append(h.keys[key], keyVersion{seq: seq, idxVal: idxVal})
+	if len(versions) > h.limit+1 {
+		versions = append(versions[:0:0], versions[len(versions)-h.limit-1:]...)
+	}
+	h.keys[key] = versions
+}
+
+func (h *versionHistory) remove(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.keys, key)
+}
+
+// find повертає розташування версії ключа з номером seq.
+func (h *versionHistory) find(key string, seq uint64) (indexValue, bool) {
+	if h == nil {
+		return indexValue{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, v := range h.keys[key] {
+		if v.seq == seq {
+			return v.idxVal, true
+		}
+	}
+	return indexValue{}, false
+}
+
+// forgetMerged забуває версії, записи яких лежали в злитих сегментах. Поточна версія,
+// перенесена злиттям, залишається з новим розташуванням з current.
+func (h *versionHistory) forgetMerged(merging map[int]bool, current func(key string) (indexValue, bool)) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, versions := range h.keys {
+		last := versions[len(versions)-1]
+		kept := versions[:0]
+		for _, v := range versions {
+			if !merging[v.idxVal.segmentID] {
+				kept = append(kept, v)
+			}
+		}
+		if merging[last.idxVal.segmentID] {
+			if idxVal, ok := current(key); ok {
+				kept = append(kept, keyVersion{seq: last.seq, idxVal: idxVal})
+			}
+		}
+		if len(kept) == 0 {
+			delete(h.keys, key)
+		} else {
+			h.keys[key] = kept
+		}
+	}
+}
+
+// VersionAt повертає значення ключа, записане з номером seq (EntryMeta.Seq). Якщо
+// Options.KeyVersions вимкнено, версія старша за збережені або її запис уже прибрано,
+// повертається ErrVersionUnavailable.
+func (db *Db) VersionAt(key string, seq uint64) (KeyValue, error) {
+	db.segMu.RLock()
+	defer db.segMu.RUnlock()
+	idxVal, ok := db.versions.find(key, seq)
+	if !ok {
+		return KeyValue{}, ErrVersionUnavailable
+	}
+	record, err := db.readRecordLocked(key, idxVal)
+	if err != nil {
+		// Спільне значення або частини старої версії могли бути вже прибрані.
+		return KeyValue{}, fmt.Errorf("%w: %v", ErrVersionUnavailable, err)
+	}
+	return record.keyValue(), nil
+}
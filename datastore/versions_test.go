@@ -0,0 +1,70 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDb_VersionAt(t *testing.T) {
+	opts := testOptions(true)
+	opts.KeyVersions = 2
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	padding := strings.Repeat("p", 300)
+	var seqs []uint64
+	for i := 1; i <= 4; i++ {
+		if err := db.PutJSON("doc", map[string]any{"version": i, "padding": padding}); err != nil {
+			t.Fatal(err)
+		}
+		_, meta, err := db.GetWithMeta("doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Seq == 0 || (len(seqs) > 0 && meta.Seq <= seqs[len(seqs)-1]) {
+			t.Fatalf("version %d has seq %d after %v", i, meta.Seq, seqs)
+		}
+		seqs = append(seqs, meta.Seq)
+	}
+	for i, seq := range seqs[1:] {
+		kv, err := db.VersionAt("doc", seq)
+		if err != nil {
+			t.Fatalf("VersionAt(%d): %v", seq, err)
+		}
+		if want := fmt.Sprintf(`"version":%d`, i+2); !strings.Contains(string(kv.Value.(json.RawMessage)), want) {
+			t.Errorf("VersionAt(%d) = %s, want %s", seq, kv.Value, want)
+		}
+	}
+	if _, err := db.VersionAt("doc", seqs[0]); !errors.Is(err, ErrVersionUnavailable) {
+		t.Errorf("VersionAt beyond the history limit returned %v, want ErrVersionUnavailable", err)
+	}
+
+	// Злиття прибирає старі записи, але поточна версія лишається доступною.
+	for i := 0; i < 4; i++ {
+		if err := db.Put(fmt.Sprintf("filler%d", i), padding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VersionAt("doc", seqs[1]); !errors.Is(err, ErrVersionUnavailable) {
+		t.Errorf("VersionAt of a merged-away version returned %v, want ErrVersionUnavailable", err)
+	}
+	if kv, err := db.VersionAt("doc", seqs[3]); err != nil || !strings.Contains(string(kv.Value.(json.RawMessage)), `"version":4`) {
+		t.Errorf("VersionAt of the current version after merge = %v, %v", kv.Value, err)
+	}
+
+	if err := db.Delete("doc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VersionAt("doc", seqs[3]); !errors.Is(err, ErrVersionUnavailable) {
+		t.Errorf("VersionAt of a deleted key returned %v, want ErrVersionUnavailable", err)
+	}
+}
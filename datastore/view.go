@@ -0,0 +1,279 @@
+package datastore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/fsutil"
+)
+
+// pinnedFileSuffix - суфікс, з яким злиття відкладає файл сегмента, на який посилаються
+// відкриті View. Такі файли, що залишилися після збою, видаляються при відкритті бази.
+const pinnedFileSuffix = ".pinned-"
+
+// pinnedFile - файл сегмента, на який посилаються відкриті View.
+type pinnedFile struct {
+	refs int
+	// release прибирає файл, який злиття замінило, поки на нього посилались View.
+	release func()
+}
+
+// View - незмінний стан бази на момент виклику Db.View. Записи та злиття, виконані
+// після цього, не впливають на читання з View. Поки View відкритий, злиття не видаляє
+// файли сегментів, на які він посилається, тож View треба закривати після використання.
+type View struct {
+	db *Db
+	// Seq - номер останньої зміни, врахованої у View (див. KeySeq та ChangesSince).
+	Seq    uint64
+	index  map[string]indexValue
+	series map[string][]indexValue
+	blobs  map[blobHash]indexValue
+	files  map[int]*os.File
+	// cold - архівовані сегменти; вони не змінюються, тож їх не треба закріплювати.
+	cold map[int]*coldSegment
+	// err - помилка читання індексу при створенні; читання з такого View її повертають.
+	err error
+
+	closeOnce sync.Once
+}
+
+// View фіксує поточний стан індексу. Створення копіює індекс, тож його вартість
+// пропорційна кількості ключів. Читання з View після Close бази завершуються помилкою.
+func (db *Db) View() *View {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.viewLocked()
+}
+
+// viewLocked створює View. Викликається під db.mu.
+func (db *Db) viewLocked() *View {
+	// View читає активні сегменти з файлів, тож записи з пам'яті дописуються заздалегідь.
+	db.flushShardsLocked()
+	v := &View{
+		db:     db,
+		Seq:    db.seq,
+		index:  make(map[string]indexValue, db.currentIndex.len()),
+		series: make(map[string][]indexValue, len(db.seriesIndex)),
+		files:  make(map[int]*os.File, len(db.segmentFiles)),
+		cold:   db.coldSegmentsLocked(),
+	}
+	v.err = db.currentIndex.forEach(func(key string, val indexValue) {
+		v.index[key] = val
+	})
+	for key, chunks := range db.seriesIndex {
+		v.series[key] = append([]indexValue(nil), chunks...)
+	}
+	db.blobs.mu.RLock()
+	v.blobs = make(map[blobHash]indexValue, len(db.blobs.locs))
+	for h, loc := range db.blobs.locs {
+		v.blobs[h] = loc
+	}
+	db.blobs.mu.RUnlock()
+	db.pinSegmentFilesLocked(v.files)
+	return v
+}
+
+// pinSegmentFilesLocked додає до files усі файли сегментів і забороняє злиттю їх видаляти,
+// доки їх не звільнить unpinSegmentFiles. Викликається під db.mu.
+func (db *Db) pinSegmentFilesLocked(files map[int]*os.File) {
+	db.pinMu.Lock()
+	defer db.pinMu.Unlock()
+	for segID, file := range db.segmentFiles {
+		files[segID] = file
+		pin, ok := db.pinned[file]
+		if !ok {
+			pin = &pinnedFile{}
+			db.pinned[file] = pin
+		}
+		pin.refs++
+	}
+}
+
+// isPinned повідомляє, чи посилаються на файл сегмента відкриті View.
+func (db *Db) isPinned(file *os.File) bool {
+	db.pinMu.Lock()
+	defer db.pinMu.Unlock()
+	_, ok := db.pinned[file]
+	return ok
+}
+
+// unpinSegmentFiles звільняє файли, закріплені pinSegmentFilesLocked.
+func (db *Db) unpinSegmentFiles(files map[int]*os.File) {
+	db.pinMu.Lock()
+	defer db.pinMu.Unlock()
+	for _, file := range files {
+		pin, ok := db.pinned[file]
+		if !ok {
+			continue
+		}
+		if pin.refs--; pin.refs > 0 {
+			continue
+		}
+		delete(db.pinned, file)
+		if pin.release != nil {
+			pin.release()
+		}
+	}
+}
+
+// Close звільняє файли сегментів View. Повторні виклики нічого не роблять.
+func (v *View) Close() {
+	v.closeOnce.Do(func() {
+		v.db.unpinSegmentFiles(v.files)
+	})
+}
+
+// Get повертає рядкове значення ключа на момент створення View.
+func (v *View) Get(key string) (string, error) {
+	kv, err := v.GetValue(key)
+	if err != nil {
+		return "", err
+	}
+	if kv.DataType != DataTypeString {
+		return "", ErrWrongType
+	}
+	return kv.Value.(string), nil
+}
+
+// GetInt64 повертає числове значення ключа на момент створення View.
+func (v *View) GetInt64(key string) (int64, error) {
+	kv, err := v.GetValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if kv.DataType != DataTypeInt64 {
+		return 0, ErrWrongType
+	}
+	return kv.Value.(int64), nil
+}
+
+// GetValue повертає значення ключа будь-якого типу, крім часових рядів.
+func (v *View) GetValue(key string) (KeyValue, error) {
+	if v.err != nil {
+		return KeyValue{}, v.err
+	}
+	idxVal, ok := v.index[key]
+	if !ok {
+		return KeyValue{}, ErrNotFound
+	}
+	record, err := v.readRecord(key, idxVal)
+	if err != nil {
+		return KeyValue{}, err
+	}
+	return record.keyValue(), nil
+}
+
+// GetSeries повертає точки ряду key з мітками в межах [from, to], див. Db.GetSeries.
+func (v *View) GetSeries(key string, from, to int64) ([]SeriesPoint, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	chunks, ok := v.series[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := []SeriesPoint{}
+	for _, idxVal := range chunks {
+		record, err := v.readRecord(key, idxVal)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range record.points {
+			if p.Timestamp >= from && p.Timestamp <= to {
+				result = append(result, p)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result, nil
+}
+
+// Keys повертає відсортований список ключів View, крім часових рядів.
+func (v *View) Keys() []string {
+	keys := make([]string, 0, len(v.index))
+	for key := range v.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readRecord читає запис з файлів View, підставляючи спільні значення та частини.
+func (v *View) readRecord(key string, idxVal indexValue) (entry, error) {
+	var file io.ReaderAt
+	if f, ok := v.files[idxVal.segmentID]; ok {
+		file = f
+	} else if seg, ok := v.cold[idxVal.segmentID]; ok {
+		file = seg
+	} else {
+		return entry{}, fmt.Errorf("internal error: segment file %d for key '%s' is not in the view", idxVal.segmentID, key)
+	}
+	record, err := readRecordFrom(file, v.db.keys, key, idxVal)
+	if err != nil {
+		return record, err
+	}
+	hashes, valueType := record.blobRefs()
+	if hashes == nil {
+		return record, nil
+	}
+	var value []byte
+	for _, h := range hashes {
+		loc, ok := v.blobs[h]
+		if !ok {
+			return record, fmt.Errorf("shared value %s for key '%s' not found", h, key)
+		}
+		blob, err := v.readRecord(h.String(), loc)
+		if err != nil {
+			return record, err
+		}
+		if blob.dataType != dataTypeBlob {
+			return record, fmt.Errorf("record for shared value %s has type %d", h, blob.dataType)
+		}
+		value = append(value, blob.value...)
+	}
+	return entry{key: record.key, value: string(value), dataType: valueType, timestamp: record.timestamp}, nil
+}
+
+// retireSegmentFileLocked закриває замінений злиттям файл сегмента та переносить його
+// в архів або видаляє. Якщо на файл посилаються View, він перейменовується і
+// прибирається після закриття останнього з них. Викликається під db.mu та db.segMu.
+func (db *Db) retireSegmentFileLocked(file *os.File, path string, archive *segmentArchive) error {
+	db.pinMu.Lock()
+	defer db.pinMu.Unlock()
+	pin, ok := db.pinned[file]
+	if !ok {
+		if err := file.Close(); err != nil {
+			db.opts.Logger.Warnf("merge: error closing old segment file %s: %v", path, err)
+		}
+		return archive.retire(path)
+	}
+	held := path + pinnedFileSuffix + fmt.Sprint(time.Now().UnixNano())
+	if err := fsutil.Rename(path, held); err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	pin.release = func() {
+		_ = file.Close()
+		if err := archive.retireAs(held, name); err != nil {
+			db.opts.Logger.Warnf("failed to remove segment file %s released by view: %v", held, err)
+		}
+	}
+	return nil
+}
+
+// releasePinnedLocked прибирає відкладені файли сегментів при закритті бази.
+func (db *Db) releasePinnedLocked() {
+	db.pinMu.Lock()
+	defer db.pinMu.Unlock()
+	for file, pin := range db.pinned {
+		if pin.release != nil {
+			pin.release()
+		}
+		delete(db.pinned, file)
+	}
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDb_View(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOptions(true)
+	opts.Dedup = true
+	opts.DedupThreshold = 16
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	shared := strings.Repeat("shared value ", 4)
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("old%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("shared", shared); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	view := db.View()
+	defer view.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("new%d-%s", i, strings.Repeat("x", 40))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("shared"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutInt64("counter", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AppendSeries("series", SeriesPoint{Timestamp: 2, Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("added", "later"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 30; i++ {
+		if v, err := view.Get(fmt.Sprintf("key%d", i)); err != nil || v != fmt.Sprintf("old%d", i) {
+			t.Fatalf("view.Get(key%d) = %q, %v", i, v, err)
+		}
+	}
+	if v, err := view.Get("shared"); err != nil || v != shared {
+		t.Errorf("view.Get(shared) = %q, %v", v, err)
+	}
+	if v, err := view.GetInt64("counter"); err != nil || v != 1 {
+		t.Errorf("view.GetInt64(counter) = %d, %v", v, err)
+	}
+	if _, err := view.Get("counter"); err != ErrWrongType {
+		t.Errorf("view.Get(counter) = %v, want ErrWrongType", err)
+	}
+	if points, err := view.GetSeries("series", 0, 10); err != nil || len(points) != 1 {
+		t.Errorf("view.GetSeries(series) = %v, %v", points, err)
+	}
+	if _, err := view.Get("added"); err != ErrNotFound {
+		t.Errorf("view.Get(added) = %v, want ErrNotFound", err)
+	}
+	if keys := view.Keys(); len(keys) != 32 {
+		t.Errorf("view has %d keys, want 32", len(keys))
+	}
+	if _, err := db.Get("shared"); err != ErrNotFound {
+		t.Errorf("db.Get(shared) = %v, want ErrNotFound", err)
+	}
+
+	// Файли, замінені злиттям, залишаються до закриття View.
+	held, _ := filepath.Glob(filepath.Join(dir, "*"+pinnedFileSuffix+"*"))
+	if len(held) == 0 {
+		t.Fatal("merge did not keep segment files referenced by the view")
+	}
+	view.Close()
+	view.Close()
+	if held, _ := filepath.Glob(filepath.Join(dir, "*"+pinnedFileSuffix+"*")); len(held) != 0 {
+		t.Errorf("segment files %v were not removed after the view was closed", held)
+	}
+	if v, err := db.Get("key3"); err != nil || !strings.HasPrefix(v, "new3-") {
+		t.Errorf("db.Get(key3) = %q, %v", v, err)
+	}
+}
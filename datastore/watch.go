@@ -0,0 +1,134 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+)
+
+// watchHub пам'ятає номери останніх змін ключів і будить тих, хто чекає на зміну.
+// Номери - ті самі, що й у записах (див. changes.go). Номери видалених ключів забуваються
+// одразу, решта - після злиття. Для ключа без запам'ятованого номера повертається base -
+// номер, не менший за будь-яку його зміну (після відкриття - номер останнього запису
+// бази), тож такий ключ може виглядати зміненим, хоча не змінювався.
+type watchHub struct {
+	mu      sync.Mutex
+	base    uint64
+	keySeq  map[string]uint64
+	waiters map[string]*keyWaiters
+}
+
+// keyWaiters - канал, що закриється при наступній зміні ключа, і кількість тих, хто на
+// нього чекає.
+type keyWaiters struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{keySeq: make(map[string]uint64), waiters: make(map[string]*keyWaiters)}
+}
+
+// seed задає номер для ключів, що не змінювались після відкриття бази.
+func (h *watchHub) seed(seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.base = max(h.base, seq)
+}
+
+// notify фіксує зміну ключа записом з номером seq. Викликається горутиною запису.
+func (h *watchHub) notify(key string, seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.keySeq[key] = seq
+	h.wakeLocked(key)
+}
+
+// notifyDelete фіксує видалення ключа з номером seq і забуває номер ключа.
+func (h *watchHub) notifyDelete(key string, seq uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.keySeq, key)
+	h.base = max(h.base, seq)
+	h.wakeLocked(key)
+}
+
+func (h *watchHub) wakeLocked(key string) {
+	if w, ok := h.waiters[key]; ok {
+		close(w.ch)
+		delete(h.waiters, key)
+	}
+}
+
+// prune забуває номери ключів, на зміну яких ніхто не чекає. Викликається після злиття.
+func (h *watchHub) prune() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, seq := range h.keySeq {
+		if _, waiting := h.waiters[key]; !waiting {
+			h.base = max(h.base, seq)
+			delete(h.keySeq, key)
+		}
+	}
+}
+
+func (h *watchHub) current(key string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.currentLocked(key)
+}
+
+func (h *watchHub) currentLocked(key string) uint64 {
+	if seq, ok := h.keySeq[key]; ok {
+		return seq
+	}
+	return h.base
+}
+
+// wait повертає поточний номер ключа, канал, що закриється при наступній його зміні, і
+// функцію, яку треба викликати, коли канал більше не потрібен.
+func (h *watchHub) wait(key string) (uint64, <-chan struct{}, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.waiters[key]
+	if !ok {
+		w = &keyWaiters{ch: make(chan struct{})}
+		h.waiters[key] = w
+	}
+	w.refs++
+	release := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		w.refs--
+		// Після зміни ключа канал уже прибрано, і під ключем може бути новий.
+		if w.refs == 0 && h.waiters[key] == w {
+			delete(h.waiters, key)
+		}
+	}
+	return h.currentLocked(key), w.ch, release
+}
+
+// KeySeq повертає порядковий номер останньої зміни ключа. Якщо номер ключа не
+// запам'ятовано (ключ не змінювався після відкриття, видалений або пережив злиття),
+// повертає номер, не менший за будь-яку зміну ключа.
+func (db *Db) KeySeq(key string) uint64 {
+	return db.watch.current(key)
+}
+
+// WaitForChange блокується, доки номер останньої зміни ключа не стане більшим за lastSeq,
+// і повертає новий номер. Якщо ctx завершується раніше, повертає поточний номер та ctx.Err().
+func (db *Db) WaitForChange(ctx context.Context, key string, lastSeq uint64) (uint64, error) {
+	for {
+		seq, changed, release := db.watch.wait(key)
+		if seq > lastSeq {
+			release()
+			return seq, nil
+		}
+		select {
+		case <-changed:
+			release()
+		case <-ctx.Done():
+			release()
+			return seq, ctx.Err()
+		}
+	}
+}
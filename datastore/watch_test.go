@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDb_WaitForChange(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	if seq := db.KeySeq("watched"); seq != 0 {
+		t.Fatalf("expected seq 0 for untouched key, got %d", seq)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.WaitForChange(ctx, "watched", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+
+	done := make(chan uint64, 1)
+	go func() {
+		seq, err := db.WaitForChange(context.Background(), "watched", 0)
+		if err != nil {
+			t.Errorf("WaitForChange failed: %v", err)
+		}
+		done <- seq
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := db.Put("other", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("watched", "v"); err != nil {
+		t.Fatal(err)
+	}
+	var seq uint64
+	select {
+	case seq = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WaitForChange was not woken by Put")
+	}
+	if seq != db.KeySeq("watched") || seq == 0 {
+		t.Errorf("unexpected seq %d, KeySeq is %d", seq, db.KeySeq("watched"))
+	}
+
+	if err := db.Delete("watched"); err != nil {
+		t.Fatal(err)
+	}
+	if newSeq, err := db.WaitForChange(context.Background(), "watched", seq); err != nil || newSeq <= seq {
+		t.Errorf("delete was not reported as a change: seq %d, err %v", newSeq, err)
+	}
+}
+
+func TestDb_WaitForChangeReleasesWaiters(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if _, err := db.WaitForChange(ctx, "idle", 0); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected timeout, got %v", err)
+		}
+		cancel()
+	}
+	db.watch.mu.Lock()
+	waiters := len(db.watch.waiters)
+	db.watch.mu.Unlock()
+	if waiters != 0 {
+		t.Errorf("%d waiters left after timeouts", waiters)
+	}
+}
+
+func TestDb_KeySeqPrunedAndSeededOnReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("kept", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("deleted", "v"); err != nil {
+		t.Fatal(err)
+	}
+	putSeq := db.KeySeq("deleted")
+	// Два запечатані сегменти, щоб злиттю було що зливати.
+	if _, err := db.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	db.watch.mu.Lock()
+	_, tracked := db.watch.keySeq["deleted"]
+	db.watch.mu.Unlock()
+	if tracked {
+		t.Error("deleted key is still tracked")
+	}
+	if seq := db.KeySeq("deleted"); seq <= putSeq {
+		t.Errorf("KeySeq of the deleted key = %d, want above %d", seq, putSeq)
+	}
+
+	if _, err := db.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.watch.mu.Lock()
+	tracked = len(db.watch.keySeq) != 0
+	db.watch.mu.Unlock()
+	if tracked {
+		t.Error("keys are still tracked after merge")
+	}
+	lastSeq := db.KeySeq("kept")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if seq := db.KeySeq("kept"); seq < lastSeq {
+		t.Errorf("KeySeq after reopen = %d, went back from %d", seq, lastSeq)
+	}
+	if err := db.Put("kept", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if seq := db.KeySeq("kept"); seq <= lastSeq {
+		t.Errorf("KeySeq after a write on reopen = %d, want above %d", seq, lastSeq)
+	}
+}
@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultWriteTimeout = 30 * time.Second
+
+// ErrWriteTimeout повертається записом, якщо горутина запису не завершила обробку
+// в межах Options.WriteTimeout. Результат такого запису невідомий: він може бути
+// застосований пізніше, коли запис відновиться.
+var ErrWriteTimeout = errors.New("writer did not complete the request in time")
+
+// writerWatchdog стежить за горутиною запису та позначає базу несправною, якщо вона зависла.
+type writerWatchdog struct {
+	// busySince - час (Unix, нс) початку обробки поточного пакета, 0 - горутина простоює.
+	busySince atomic.Int64
+	mu        sync.Mutex
+	stuck     bool
+	// stuckCh закривається, коли горутину запису визнано зависшою.
+	stuckCh chan struct{}
+}
+
+func newWriterWatchdog() *writerWatchdog {
+	return &writerWatchdog{stuckCh: make(chan struct{})}
+}
+
+func (w *writerWatchdog) begin() {
+	w.busySince.Store(time.Now().UnixNano())
+}
+
+// end позначає завершення пакета. Повертає true, якщо горутина відновилася після зависання.
+func (w *writerWatchdog) end() bool {
+	w.busySince.Store(0)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stuck {
+		return false
+	}
+	w.stuck = false
+	w.stuckCh = make(chan struct{})
+	return true
+}
+
+// state повертає канал, що закриється при зависанні, та чи горутина вже вважається зависшою.
+func (w *writerWatchdog) state() (<-chan struct{}, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stuckCh, w.stuck
+}
+
+// check позначає горутину зависшою, якщо поточний пакет обробляється довше за timeout.
+// Повертає тривалість зависання, якщо стан щойно змінився.
+func (w *writerWatchdog) check(timeout time.Duration) (time.Duration, bool) {
+	since := w.busySince.Load()
+	if since == 0 {
+		return 0, false
+	}
+	busy := time.Since(time.Unix(0, since))
+	if busy < timeout {
+		return 0, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stuck || w.busySince.Load() != since {
+		return 0, false
+	}
+	w.stuck = true
+	close(w.stuckCh)
+	return busy, true
+}
+
+// Healthy повідомляє, чи горутини запису обробляють запити вчасно і чи не завершилася
+// якась фонова горутина з фатальною помилкою, див. Err.
+func (db *Db) Healthy() bool {
+	for _, sh := range db.shards {
+		if _, stuck := sh.watchdog.state(); stuck {
+			return false
+		}
+	}
+	return db.Err() == nil
+}
+
+// watchWriter періодично перевіряє, чи не зависла горутина запису.
+func (db *Db) watchWriter(ctx context.Context) error {
+	if db.opts.WriteTimeout < 0 {
+		return nil
+	}
+	ticker := time.NewTicker(db.opts.WriteTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, sh := range db.shards {
+				if busy, changed := sh.watchdog.check(db.opts.WriteTimeout); changed {
+					buf := make([]byte, 1<<20)
+					n := runtime.Stack(buf, true)
+					db.opts.Logger.Warnf("writer goroutine %d has been busy for %s (timeout %s), failing pending writes with %v. Goroutine dump:\n%s", sh.id, busy, db.opts.WriteTimeout, ErrWriteTimeout, buf[:n])
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
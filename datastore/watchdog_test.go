@@ -0,0 +1,52 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDb_WriterWatchdog(t *testing.T) {
+	opts := testOptions(true)
+	opts.WriteTimeout = 100 * time.Millisecond
+	db, err := NewDbWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Утримуючи db.mu, імітуємо зависання горутини запису.
+	db.mu.Lock()
+	errCh := make(chan error, 1)
+	go func() { errCh <- db.Put("stuck", "value") }()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrWriteTimeout) {
+			t.Errorf("Put with stuck writer: got %v, want ErrWriteTimeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		db.mu.Unlock()
+		t.Fatal("Put did not fail while the writer was stuck")
+	}
+	if db.Healthy() {
+		t.Errorf("expected db to be unhealthy while the writer is stuck")
+	}
+	if err := db.Put("other", "value"); !errors.Is(err, ErrWriteTimeout) {
+		t.Errorf("Put while unhealthy: got %v, want ErrWriteTimeout", err)
+	}
+	db.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !db.Healthy() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !db.Healthy() {
+		t.Fatalf("db did not recover after the writer was released")
+	}
+	if err := db.Put("after", "value"); err != nil {
+		t.Errorf("Put after recovery failed: %v", err)
+	}
+	if v, err := db.Get("stuck"); err != nil || v != "value" {
+		t.Errorf("timed out write is applied once the writer resumes, got %q, %v", v, err)
+	}
+}
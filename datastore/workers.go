@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Фонові горутини бази (горутина запису, злиття, видалення прострочених ключів тощо)
+// запускаються через workerGroup - групу в стилі errgroup з іменованими горутинами.
+// Група має спільний контекст, який скасовується під час закриття бази, перехоплює паніки
+// і запам'ятовує першу фатальну помилку, яку повертає Db.Err. Нова фонова підсистема
+// має лише реалізувати func(ctx context.Context) error і зареєструватися через Go.
+
+// ErrWorkerFailed обгортає помилку або паніку фонової горутини, після якої база
+// відхиляє записи, див. Db.Err.
+var ErrWorkerFailed = errors.New("database background worker failed")
+
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	logger Logger
+
+	mu  sync.Mutex
+	err error
+	// failed закривається разом із записом першої фатальної помилки.
+	failed chan struct{}
+}
+
+func newWorkerGroup(logger Logger) *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{ctx: ctx, cancel: cancel, logger: logger, failed: make(chan struct{})}
+}
+
+// Go запускає фонову горутину name. Помилка fn (крім скасування контексту групи) або
+// паніка стає фатальною: її повертає Err, а контекст групи скасовується, зупиняючи решту.
+func (g *workerGroup) Go(name string, fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				g.fail(name, fmt.Errorf("panic: %v\n%s", r, debug.Stack()))
+			}
+		}()
+		if err := fn(g.ctx); err != nil && !errors.Is(err, context.Canceled) {
+			g.fail(name, err)
+		}
+	}()
+}
+
+// track реєструє операцію, що виконується в горутині викликача (наприклад, злиття),
+// щоб Wait дочекався її завершення. Повертає функцію завершення операції.
+func (g *workerGroup) track() func() {
+	g.wg.Add(1)
+	return g.wg.Done
+}
+
+func (g *workerGroup) fail(name string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.logger.Errorf("background worker %s failed: %v", name, err)
+	if g.err != nil {
+		return
+	}
+	g.err = fmt.Errorf("%w: %s: %v", ErrWorkerFailed, name, err)
+	close(g.failed)
+	g.cancel()
+}
+
+// Err повертає першу фатальну помилку фонової горутини або nil.
+func (g *workerGroup) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// done закривається, коли група зупиняється: під час закриття бази або після фатальної помилки.
+func (g *workerGroup) done() <-chan struct{} {
+	return g.ctx.Done()
+}
+
+// stop скасовує контекст групи; горутини завершуються, коли помітять це.
+func (g *workerGroup) stop() {
+	g.cancel()
+}
+
+// Wait чекає на завершення всіх горутин і операцій групи.
+func (g *workerGroup) Wait() error {
+	g.wg.Wait()
+	return g.Err()
+}
+
+// Err повертає фатальну помилку фонової горутини бази (обгорнуту в ErrWorkerFailed) або nil,
+// якщо фонові горутини працюють штатно. Після такої помилки база відхиляє записи з нею ж,
+// а Healthy повертає false; читання лишаються доступними до закриття бази.
+func (db *Db) Err() error {
+	return db.workers.Err()
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerGroup_CapturesPanic(t *testing.T) {
+	g := newWorkerGroup(NopLogger{})
+	stopped := make(chan struct{})
+	g.Go("sibling", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+	g.Go("scrubber", func(context.Context) error {
+		panic("corrupted state")
+	})
+	err := g.Wait()
+	if !errors.Is(err, ErrWorkerFailed) || !strings.Contains(err.Error(), "scrubber") || !strings.Contains(err.Error(), "corrupted state") {
+		t.Fatalf("Wait() = %v, want ErrWorkerFailed naming the panicking worker", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("the failure did not cancel the other workers")
+	}
+}
+
+func TestWorkerGroup_StopIsNotAFailure(t *testing.T) {
+	g := newWorkerGroup(NopLogger{})
+	g.Go("ticker", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.stop()
+	if err := g.Wait(); err != nil {
+		t.Errorf("Wait() after stop = %v, want nil", err)
+	}
+}
+
+func TestDb_ErrAfterWorkerFailure(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Err(); err != nil || !db.Healthy() {
+		t.Fatalf("Err() = %v, Healthy() = %t before any failure", err, db.Healthy())
+	}
+
+	db.workers.Go("replicator", func(context.Context) error {
+		return errors.New("replica unreachable")
+	})
+	deadline := time.Now().Add(time.Second)
+	for db.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := db.Err(); !errors.Is(err, ErrWorkerFailed) || !strings.Contains(err.Error(), "replicator") {
+		t.Fatalf("Err() = %v, want ErrWorkerFailed from the replicator", err)
+	}
+	if db.Healthy() {
+		t.Error("Healthy() is true after a fatal worker failure")
+	}
+	if err := db.Put("key", "other"); !errors.Is(err, ErrWorkerFailed) {
+		t.Errorf("Put after a fatal failure returned %v, want ErrWorkerFailed", err)
+	}
+	if value, err := db.Get("key"); err != nil || value != "value" {
+		t.Errorf("Get after a fatal failure = %q, %v", value, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Close after a fatal failure returned %v", err)
+	}
+}
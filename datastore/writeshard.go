@@ -0,0 +1,318 @@
+package datastore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Частини запису (Options.WriteShards). Ключі розподіляються між частинами за хешем;
+// кожна частина має власну чергу, горутину запису та активний сегмент. Горутина частини
+// кодує, стискає й шифрує записи пакета до взяття db.mu (див. encodePuts), а після його
+// зняття дописує їх у файл одним Write і за потреби скидає на диск, тож ці кроки різних
+// частин виконуються паралельно. Під db.mu лишаються перевірки (квоти, If-Match, типи),
+// розподіл місця в сегменті та зміни індексу. Записи, що вже є в індексі, але ще не у
+// файлі, читаються з пам'яті (activeSegmentReader), а ті, хто читає активні сегменти
+// напряму з файлів, спершу дописують їх, див. flushShardsLocked. Записи, кодування яких
+// залежить від індексу (спільні значення та значення частинами), кодуються під db.mu.
+//
+// Ідентифікатори сегментів спільні для всіх частин і лише зростають. Ключ завжди пишеться
+// в ту саму частину, тож його записи лежать у сегментах за зростанням ідентифікатора, і
+// відновлення індексу читанням сегментів по порядку дає той самий результат, що й з однією
+// частиною. Видалення префікса стосується ключів усіх частин, тож воно пишеться в новий
+// сегмент, після чого решта частин переходять на ще новіші сегменти. Злиття бере лише
+// запечатані сегменти, молодші за активні сегменти всіх частин: інакше перевикористаний
+// ідентифікатор вихідного сегмента опинився б після новіших записів частини, що відстала.
+
+type writeShard struct {
+	id    int
+	putCh chan putRequest
+	// exit закривається, коли горутина запису частини обробила всю чергу й завершилась.
+	exit     chan struct{}
+	watchdog *writerWatchdog
+	// Активний сегмент частини; змінюється під db.mu, segment і segmentID - ще й під
+	// db.segMu та syncMu.
+	segment   *os.File
+	segmentID int
+	hints     []hintRecord
+	// size - розмір активного сегмента разом із pending. Файл опитується (Stat) лише під
+	// час відкриття сегмента, далі розмір ведеться в пам'яті. Змінюється під db.mu.
+	size int64
+	// pending - записи, які ще не дописані у файл, див. flush; flushed - розмір уже
+	// дописаної частини сегмента. Точкові читання бачать pending через activeSegmentReader.
+	// pending доповнюється під db.mu та pendingMu, а дописується у файл під syncMu.
+	pendingMu sync.Mutex
+	pending   []byte
+	flushed   int64
+	// deleteSeq - номер останнього видалення в активному сегменті, див. changes.go.
+	deleteSeq uint64
+	// touched - у сегмент писали під час поточного пакета, див. applyBatch.
+	touched  bool
+	unsynced atomic.Bool
+	// syncMu серіалізує Write і fsync поза db.mu із заміною активного сегмента.
+	syncMu sync.Mutex
+}
+
+func newWriteShard(id, queueDepth int) *writeShard {
+	return &writeShard{
+		id:       id,
+		putCh:    make(chan putRequest, queueDepth),
+		exit:     make(chan struct{}),
+		watchdog: newWriterWatchdog(),
+		// До відкриття активного сегмента жоден сегмент не вважається активним.
+		segmentID: -1,
+	}
+}
+
+// flush дописує накопичені записи в активний сегмент одним Write. Не потребує db.mu.
+func (sh *writeShard) flush() error {
+	sh.syncMu.Lock()
+	defer sh.syncMu.Unlock()
+	return sh.flushLocked()
+}
+
+// flushLocked - flush під sh.syncMu.
+func (sh *writeShard) flushLocked() error {
+	// Поки файл пишеться без pendingMu, інші горутини можуть доповнювати pending під db.mu:
+	// append не змінює вже зафіксовані байти data, а читання тим часом беруть записи з пам'яті.
+	sh.pendingMu.Lock()
+	data := sh.pending
+	sh.pendingMu.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+	n, err := sh.segment.Write(data)
+	if n > 0 {
+		sh.unsynced.Store(true)
+	}
+	sh.pendingMu.Lock()
+	sh.flushed += int64(n)
+	if n == len(sh.pending) {
+		sh.pending = sh.pending[:0]
+	} else {
+		sh.pending = sh.pending[n:]
+	}
+	sh.pendingMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("processPuts: failed to write %d bytes to active segment %d: %w", len(data)-n, sh.segmentID, err)
+	}
+	return nil
+}
+
+// readPending читає з pending, якщо off припадає на ще не дописану частину сегмента.
+func (sh *writeShard) readPending(p []byte, off int64) (int, bool) {
+	sh.pendingMu.Lock()
+	defer sh.pendingMu.Unlock()
+	if off < sh.flushed {
+		return 0, false
+	}
+	start := off - sh.flushed
+	if start >= int64(len(sh.pending)) {
+		return 0, true
+	}
+	return copy(p, sh.pending[start:]), true
+}
+
+// activeSegmentReader читає активний сегмент частини разом із записами пакета, які
+// горутина запису ще не дописала у файл.
+type activeSegmentReader struct {
+	file *os.File
+	sh   *writeShard
+}
+
+func (r activeSegmentReader) ReadAt(p []byte, off int64) (int, error) {
+	n, ok := r.sh.readPending(p, off)
+	if !ok {
+		return r.file.ReadAt(p, off)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// sync скидає активний сегмент частини на диск, якщо після останнього fsync були записи.
+// Не потребує db.mu.
+func (sh *writeShard) sync() error {
+	sh.syncMu.Lock()
+	defer sh.syncMu.Unlock()
+	return sh.syncLocked()
+}
+
+// syncLocked - sync під sh.syncMu.
+func (sh *writeShard) syncLocked() error {
+	if sh.segment == nil || !sh.unsynced.Swap(false) {
+		return nil
+	}
+	if err := sh.segment.Sync(); err != nil {
+		sh.unsynced.Store(true)
+		return fmt.Errorf("processPuts: failed to sync active segment %d: %w", sh.segmentID, err)
+	}
+	return nil
+}
+
+// shardFor повертає частину, в яку пишуться записи ключа.
+func (db *Db) shardFor(key string) *writeShard {
+	if len(db.shards) == 1 {
+		return db.shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return db.shards[h.Sum32()%uint32(len(db.shards))]
+}
+
+// requestShard повертає частину, горутина запису якої виконує запит: частину його ключа,
+// а для пакетного видалення - першого з ключів. Так запити до одного ключа виконуються
+// в порядку передачі. Бар'єр Flush виконує задана частина.
+func (db *Db) requestShard(req putRequest) *writeShard {
+	if req.shard != nil {
+		return req.shard
+	}
+	if req.key == "" && len(req.deleteKeys) > 0 {
+		return db.shardFor(req.deleteKeys[0])
+	}
+	return db.shardFor(req.key)
+}
+
+// activeShardLocked повертає частину, активним сегментом якої є segID, або nil.
+// Викликається під db.mu або db.segMu.
+func (db *Db) activeShardLocked(segID int) *writeShard {
+	for _, sh := range db.shards {
+		if sh.segmentID == segID {
+			return sh
+		}
+	}
+	return nil
+}
+
+// isActiveLocked повідомляє, чи є segID активним сегментом якоїсь частини.
+func (db *Db) isActiveLocked(segID int) bool {
+	return db.activeShardLocked(segID) != nil
+}
+
+// allocSegmentIDLocked видає ідентифікатор нового активного сегмента. Викликається під db.mu.
+func (db *Db) allocSegmentIDLocked() int {
+	segID := db.nextSegmentID
+	db.nextSegmentID++
+	return segID
+}
+
+// flushShardsLocked дописує у файли записи, які горутини запису ще не дописали після зняття
+// db.mu. Потрібен перед читанням активних сегментів напряму з файлів. Викликається під
+// db.mu (достатньо на читання): нові записи тоді не додаються.
+func (db *Db) flushShardsLocked() {
+	for _, sh := range db.shards {
+		if err := sh.flush(); err != nil {
+			db.workers.fail(fmt.Sprintf("writer-%d", sh.id), err)
+		}
+	}
+}
+
+// takeTouchedLocked повертає частини, в сегменти яких писали після попереднього виклику.
+// Викликається під db.mu.
+func (db *Db) takeTouchedLocked() []*writeShard {
+	var touched []*writeShard
+	for _, sh := range db.shards {
+		if sh.touched {
+			sh.touched = false
+			touched = append(touched, sh)
+		}
+	}
+	return touched
+}
+
+// rotateShardLocked запечатує активний сегмент частини й починає новий.
+// Викликається під db.mu.
+func (db *Db) rotateShardLocked(sh *writeShard) error {
+	sh.syncMu.Lock()
+	defer sh.syncMu.Unlock()
+	if err := sh.flushLocked(); err != nil {
+		return err
+	}
+	// Запечатаний сегмент скидається на диск за будь-якої політики: Flush синхронізує
+	// лише активні сегменти.
+	if err := sh.syncLocked(); err != nil {
+		return err
+	}
+	db.sealShardLocked(sh)
+	if err := db.setActiveSegment(sh, db.allocSegmentIDLocked()); err != nil {
+		return fmt.Errorf("processPuts: failed to rotate to new segment: %w", err)
+	}
+	db.spillIndexLocked()
+	return nil
+}
+
+// mergeableSegmentIDsLocked повертає відсортовані запечатані сегменти, молодші за активні
+// сегменти всіх частин: лише їх можна зливати. Викликається під db.mu.
+func (db *Db) mergeableSegmentIDsLocked() []int {
+	sealed := db.sealedSegmentIDsLocked()
+	watermark := db.shards[0].segmentID
+	for _, sh := range db.shards[1:] {
+		watermark = min(watermark, sh.segmentID)
+	}
+	n := 0
+	for n < len(sealed) && sealed[n] < watermark {
+		n++
+	}
+	return sealed[:n]
+}
+
+// advanceShards переводить на новий сегмент частини, активний сегмент яких старший за
+// якийсь запечатаний, щоб частина без записів не затримувала злиття.
+func (db *Db) advanceShards() error {
+	if len(db.shards) == 1 {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	sealed := db.sealedSegmentIDsLocked()
+	if len(sealed) == 0 {
+		return nil
+	}
+	newest := sealed[len(sealed)-1]
+	for _, sh := range db.shards {
+		if sh.segmentID > newest {
+			continue
+		}
+		if err := db.renewShardLocked(sh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renewShardLocked переводить частину на новий активний сегмент, старший за всі наявні:
+// непорожній сегмент запечатується, порожній замінюється. Викликається під db.mu.
+func (db *Db) renewShardLocked(sh *writeShard) error {
+	if sh.size > 0 {
+		return db.rotateShardLocked(sh)
+	}
+	return db.replaceEmptyActiveLocked(sh)
+}
+
+// replaceEmptyActiveLocked замінює порожній активний сегмент частини новим і видаляє старий.
+// Викликається під db.mu.
+func (db *Db) replaceEmptyActiveLocked(sh *writeShard) error {
+	sh.syncMu.Lock()
+	defer sh.syncMu.Unlock()
+	oldID := sh.segmentID
+	if err := db.setActiveSegment(sh, db.allocSegmentIDLocked()); err != nil {
+		return err
+	}
+	db.segMu.Lock()
+	defer db.segMu.Unlock()
+	if file, ok := db.segmentFiles[oldID]; ok {
+		db.unmapSegmentLocked(oldID)
+		delete(db.segmentFiles, oldID)
+		path := filepath.Join(db.dir, fmt.Sprintf("%s%d", outFileNamePrefix, oldID))
+		if err := db.retireSegmentFileLocked(file, path, nil); err != nil {
+			db.opts.Logger.Warnf("failed to remove empty segment %s: %v", path, err)
+		}
+	}
+	delete(db.liveBytes, oldID)
+	return nil
+}
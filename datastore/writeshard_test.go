@@ -0,0 +1,308 @@
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func shardOptions() Options {
+	opts := testOptions(true)
+	opts.WriteShards = 4
+	opts.SyncPolicy = SyncAlways
+	return opts
+}
+
+func TestDb_WriteShardsConcurrentWritesSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, shardOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				if err := db.Put(fmt.Sprintf("w%d/key%d", w, i), fmt.Sprintf("value %d-%d %s", w, i, strings.Repeat("x", 40))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n, err := db.DeleteKeys([]string{"w0/key1", "w1/key2", "w2/key3", "w3/key4"}); err != nil || n != 4 {
+		t.Fatalf("DeleteKeys = %d, %v", n, err)
+	}
+	if n, err := db.DeletePrefix("w7/"); err != nil || n != 30 {
+		t.Fatalf("DeletePrefix = %d, %v", n, err)
+	}
+	if err := db.Put("w7/key0", "after prefix delete"); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := db.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := 0
+	for _, seg := range segments {
+		if seg.Active {
+			active++
+		}
+	}
+	if active != 4 {
+		t.Errorf("%d active segments, want one per write shard", active)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, shardOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for w := 0; w < 8; w++ {
+		for i := 0; i < 30; i++ {
+			key := fmt.Sprintf("w%d/key%d", w, i)
+			got, err := db.Get(key)
+			switch {
+			case key == "w7/key0":
+				if got != "after prefix delete" {
+					t.Errorf("Get(%s) = %q, %v", key, got, err)
+				}
+			case w == 7 || w < 4 && i == w+1:
+				if err != ErrNotFound {
+					t.Errorf("deleted key %s came back after reopen: %q, %v", key, got, err)
+				}
+			case err != nil || !strings.HasPrefix(got, fmt.Sprintf("value %d-%d ", w, i)):
+				t.Errorf("Get(%s) = %q, %v", key, got, err)
+			}
+		}
+	}
+}
+
+func TestDb_WriteShardsMergeWithQuietShard(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, shardOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Усі записи йдуть в одну частину, решта частин лишаються з порожніми сегментами,
+	// старшими за запечатані.
+	var keys []string
+	for i := 0; len(keys) < 5; i++ {
+		if key := fmt.Sprintf("key%d", i); db.shardFor(key) == db.shards[0] {
+			keys = append(keys, key)
+		}
+	}
+	padding := strings.Repeat("p", 200)
+	for round := 0; round < 4; round++ {
+		for _, key := range keys {
+			if err := db.Put(key, fmt.Sprintf("%d %s", round, padding)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	before, _ := db.Segments()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := db.Segments()
+	if len(after) >= len(before) {
+		t.Errorf("merge kept %d of %d segments", len(after), len(before))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, shardOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range keys {
+		if got, err := db.Get(key); err != nil || !strings.HasPrefix(got, "3 ") {
+			t.Errorf("Get(%s) after merge and reopen = %.10q, %v", key, got, err)
+		}
+	}
+}
+
+func TestDb_BatchRecordsReadableBeforeFlush(t *testing.T) {
+	db, cleanup := setupTestDb(t, true)
+	defer cleanup()
+	if err := db.Put("before", "flushed"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	sh := db.shards[0]
+	segID, offset, err := db.appendToActiveSegment(sh, []byte("pending record"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() string {
+		t.Helper()
+		reader, ok := db.segmentReaderLocked(segID)
+		if !ok {
+			t.Fatalf("segment %d is not open", segID)
+		}
+		buf := make([]byte, len("pending record"))
+		if _, err := reader.ReadAt(buf, offset); err != nil {
+			t.Fatalf("ReadAt: %v", err)
+		}
+		return string(buf)
+	}
+	if stat, _ := sh.segment.Stat(); stat.Size() != offset {
+		t.Fatalf("record reached the file before flush: size %d, offset %d", stat.Size(), offset)
+	}
+	if got := read(); got != "pending record" {
+		t.Errorf("before flush read %q", got)
+	}
+	if err := sh.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if stat, _ := sh.segment.Stat(); stat.Size() != sh.size {
+		t.Errorf("after flush the file has %d bytes, want %d", stat.Size(), sh.size)
+	}
+	if got := read(); got != "pending record" {
+		t.Errorf("after flush read %q", got)
+	}
+}
+
+func TestDb_ActiveSegmentSizeTrackedInMemory(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, testOptions(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(stage string) {
+		t.Helper()
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		sh := db.shards[0]
+		stat, err := sh.segment.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sh.size != stat.Size() {
+			t.Errorf("%s: tracked size %d, file size %d", stage, sh.size, stat.Size())
+		}
+	}
+	check("new database")
+	value := strings.Repeat("v", 100)
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%7), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("key3"); err != nil {
+		t.Fatal(err)
+	}
+	if db.shards[0].segmentID == 0 {
+		t.Fatal("expected segment rotation")
+	}
+	check("after rotations")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = NewDbWithOptions(dir, testOptions(true)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+	if err := db.Put("key0", "new"); err != nil {
+		t.Fatal(err)
+	}
+	check("after reopen and write")
+}
+
+func TestDb_WriteShardsEncodeOutsideLock(t *testing.T) {
+	opts := shardOptions()
+	opts.Compression = CompressionSnappy
+	opts.CompressionThreshold = 16
+	opts.EncryptionKey = []byte(strings.Repeat("k", 32))
+	opts.Dedup = true
+	opts.DedupThreshold = 1000
+	dir := t.TempDir()
+	db, err := NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// До db.mu кодуються лише записи, кодування яких не залежить від індексу.
+	batch := []putRequest{
+		{key: "plain", value: strings.Repeat("v", 100), dataType: DataTypeString},
+		{key: "shared", value: strings.Repeat("s", 2000), dataType: DataTypeString},
+		{flush: true},
+	}
+	db.encodePuts(batch)
+	if batch[0].encoded == nil || batch[1].encoded != nil || batch[2].encoded != nil {
+		t.Fatalf("encodePuts encoded %v, want only the plain put", []bool{batch[0].encoded != nil, batch[1].encoded != nil, batch[2].encoded != nil})
+	}
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	// Changes читає активні сегменти з файлів, поки частини дописують свої пакети.
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if _, err := db.ChangesSince(0, func(Change) error { return nil }); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := db.Put(fmt.Sprintf("w%d/key%d", w, i), fmt.Sprintf("value %d-%d %s", w, i, strings.Repeat("x", 40))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	<-done
+
+	var seqs []uint64
+	if _, err := db.ChangesSince(0, func(c Change) error {
+		seqs = append(seqs, c.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) != writers*perWriter {
+		t.Fatalf("ChangesSince returned %d changes, want %d", len(seqs), writers*perWriter)
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("change %d has seq %d, want %d", i, seq, i+1)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDbWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			key := fmt.Sprintf("w%d/key%d", w, i)
+			if got, err := db.Get(key); err != nil || !strings.HasPrefix(got, fmt.Sprintf("value %d-%d ", w, i)) {
+				t.Errorf("Get(%s) after reopen = %.20q, %v", key, got, err)
+			}
+		}
+	}
+}
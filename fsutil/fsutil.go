@@ -0,0 +1,45 @@
+// Package fsutil приховує відмінності файлових систем Linux, macOS і Windows, від яких
+// залежить стійкість до збоїв: атомарну заміну файлу, блокування файлу та fsync директорії.
+//
+// Rename замінює існуючий файл на всіх платформах; на Windows він повторює спробу, якщо
+// файл ненадовго тримає інший процес (антивірус, індексатор). SyncDir робить перейменування
+// й створення файлів у директорії стійкими до збою живлення там, де це потрібно (Unix);
+// на Windows метадані директорії журналюються файловою системою. LockFile бере
+// ексклюзивне блокування файлу, яке операційна система знімає разом із процесом.
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked повертається LockFile, якщо файл уже заблоковано іншим дескриптором.
+var ErrLocked = errors.New("file is locked")
+
+// WriteFileAtomic записує data у файл path так, що після збою на диску залишається
+// або старий, або новий вміст повністю: дані пишуться в тимчасовий файл, скидаються
+// на диск і замінюють path, після чого скидається директорія.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return SyncDir(filepath.Dir(path))
+}
@@ -0,0 +1,27 @@
+//go:build !unix && !windows
+
+package fsutil
+
+import "os"
+
+// LockSupported повідомляє, чи захищає LockFile файл від інших процесів.
+const LockSupported = false
+
+// Rename перейменовує oldpath у newpath, замінюючи існуючий файл.
+func Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// SyncDir на платформах без fsync директорій нічого не робить.
+func SyncDir(string) error {
+	return nil
+}
+
+// LockFile на платформах без блокування файлів нічого не робить: файл не захищений.
+func LockFile(*os.File) error {
+	return nil
+}
+
+func UnlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRename_ReplacesExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "new.tmp"), filepath.Join(dir, "target")
+	if err := os.WriteFile(dst, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rename(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "new" {
+		t.Errorf("target after Rename = %q, %v", data, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists after Rename: %v", err)
+	}
+	if err := SyncDir(dir); err != nil {
+		t.Errorf("SyncDir: %v", err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("file = %q, %v; want %q", data, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	if err := WriteFileAtomic(filepath.Join(t.TempDir(), "missing", "file"), nil, 0644); err == nil {
+		t.Error("WriteFileAtomic into a missing directory succeeded")
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "LOCK")
+	open := func() *os.File {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	first, second := open(), open()
+	if err := LockFile(first); err != nil {
+		t.Fatal(err)
+	}
+	// Вміст заблокованого файлу доступний іншим дескрипторам.
+	if _, err := first.WriteAt([]byte("42\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "42\n" {
+		t.Errorf("locked file reads %q, %v", data, err)
+	}
+	if !LockSupported {
+		t.Skip("file locking is not supported on this platform")
+	}
+	if err := LockFile(second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second LockFile returned %v, want ErrLocked", err)
+	}
+	if err := UnlockFile(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockFile(second); err != nil {
+		t.Errorf("LockFile after UnlockFile: %v", err)
+	}
+}
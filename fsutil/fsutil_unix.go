@@ -0,0 +1,48 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// LockSupported повідомляє, чи захищає LockFile файл від інших процесів.
+const LockSupported = true
+
+// Rename атомарно перейменовує oldpath у newpath, замінюючи існуючий файл.
+func Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// SyncDir скидає на диск записи директорії dir: створені, перейменовані та видалені файли.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// LockFile бере ексклюзивне блокування файлу, не чекаючи на його звільнення.
+func LockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
+
+// UnlockFile знімає блокування, взяте LockFile.
+func UnlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -2,4 +2,7 @@ module github.com/Wandestes/software-architecture_4
 
 go 1.24
 
-require github.com/roman-mazur/architecture-practice-4-template v0.0.0-20250501203049-b73d446da176
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/roman-mazur/architecture-practice-4-template v0.0.0-20250501203049-b73d446da176
+)
@@ -0,0 +1,64 @@
+package httptools
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware обгортає обробник додатковою логікою.
+type Middleware func(http.Handler) http.Handler
+
+// Chain застосовує middleware до обробника. Перший елемент списку стає зовнішнім.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// StatusRecorder запам'ятовує статус відповіді, записаний обробником.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RequestLogger логує метод, шлях, статус та тривалість кожного запиту.
+func RequestLogger(prefix string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			log.Printf("%s: %s %s -> %d (%s)", prefix, r.Method, r.URL.Path, rec.Status, time.Since(start))
+		})
+	}
+}
+
+// Recoverer перехоплює паніку в обробнику та повертає 500 замість падіння з'єднання.
+func Recoverer(prefix string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					if rcv == http.ErrAbortHandler {
+						panic(rcv)
+					}
+					log.Printf("%s: PANIC while handling %s %s: %v\n%s", prefix, r.Method, r.URL.Path, rcv, string(debug.Stack()))
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package httptools
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Wandestes/software-architecture_4/config"
+)
+
+// DebugEnabled повідомляє, чи увімкнений режим налагодження змінною оточення DEBUG.
+func DebugEnabled() bool {
+	enabled, _ := strconv.ParseBool(config.Getenv("DEBUG"))
+	return enabled
+}
+
+// prettyWriter буферизує відповідь, щоб відформатувати JSON перед відправкою.
+type prettyWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *prettyWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *prettyWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+func (w *prettyWriter) flush() {
+	body := w.buf.Bytes()
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = indented.Bytes()
+		}
+	}
+	w.Header().Del("Content-Length")
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.Write(body)
+}
+
+// PrettyJSON форматує JSON-відповіді з відступами для запитів з ?pretty=1.
+// Порядок полів зберігається таким, яким його записав обробник.
+// Якщо enabled == false, middleware нічого не змінює.
+func PrettyJSON(enabled bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); !pretty {
+				next.ServeHTTP(w, r)
+				return
+			}
+			pw := &prettyWriter{ResponseWriter: w}
+			next.ServeHTTP(pw, r)
+			pw.flush()
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package httptools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Wandestes/software-architecture_4/config"
+)
+
+// RequestIDHeader - заголовок з ідентифікатором запиту, який сервіси передають один одному,
+// щоб записи журналів повільних запитів різних сервісів можна було зіставити.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen обмежує довжину ідентифікатора, отриманого від клієнта.
+const maxRequestIDLen = 128
+
+const (
+	// DefaultSlowThreshold - поріг повільного запиту за замовчуванням.
+	DefaultSlowThreshold = time.Second
+	// DefaultSlowLogSize - кількість записів, які зберігає журнал за замовчуванням.
+	DefaultSlowLogSize = 100
+)
+
+// SlowEntry - запис журналу повільних запитів.
+type SlowEntry struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"requestId"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Status    int           `json:"status"`
+	Duration  time.Duration `json:"duration"`
+	// Backend - бекенд, якому балансувальник передав запит.
+	Backend string `json:"backend,omitempty"`
+	// Timings - тривалість звернень до залежностей (напр. "db"), сумована за всі спроби.
+	Timings map[string]time.Duration `json:"timings,omitempty"`
+}
+
+// SlowLog зберігає останні запити, тривалість яких перевищила поріг, у кільцевому буфері.
+type SlowLog struct {
+	threshold time.Duration
+
+	mu      sync.Mutex
+	entries []SlowEntry
+	next    int
+	full    bool
+}
+
+// NewSlowLog створює журнал на size записів. Поріг <= 0 вимикає запис.
+func NewSlowLog(threshold time.Duration, size int) *SlowLog {
+	if size <= 0 {
+		size = DefaultSlowLogSize
+	}
+	return &SlowLog{threshold: threshold, entries: make([]SlowEntry, size)}
+}
+
+// NewSlowLogFromEnv створює журнал з порогом SLOW_REQUEST_THRESHOLD (напр. "500ms")
+// та розміром SLOW_LOG_SIZE.
+func NewSlowLogFromEnv() (*SlowLog, error) {
+	threshold := DefaultSlowThreshold
+	if raw := config.Getenv("SLOW_REQUEST_THRESHOLD"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLOW_REQUEST_THRESHOLD %q: %w", raw, err)
+		}
+		threshold = parsed
+	}
+	size := DefaultSlowLogSize
+	if raw := config.Getenv("SLOW_LOG_SIZE"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid SLOW_LOG_SIZE %q", raw)
+		}
+		size = parsed
+	}
+	return NewSlowLog(threshold, size), nil
+}
+
+// Threshold повертає поріг повільного запиту.
+func (l *SlowLog) Threshold() time.Duration {
+	return l.threshold
+}
+
+func (l *SlowLog) add(entry SlowEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries повертає записи журналу, починаючи з найновішого.
+func (l *SlowLog) Entries() []SlowEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	result := make([]SlowEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return result
+}
+
+// ServeHTTP віддає записи журналу у форматі JSON (для /admin/slowlog).
+func (l *SlowLog) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Entries())
+}
+
+// Middleware призначає запиту ідентифікатор (або бере його з RequestIDHeader), повертає його
+// у відповіді та записує запит у журнал, якщо він виконувався довше за поріг.
+func (l *SlowLog) Middleware(prefix string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" || len(id) > maxRequestIDLen {
+				id = newRequestID()
+				r.Header.Set(RequestIDHeader, id)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			tr := &trace{id: id}
+			start := time.Now()
+			rec := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), traceKey{}, tr)))
+			elapsed := time.Since(start)
+			if l.threshold <= 0 || elapsed < l.threshold {
+				return
+			}
+			entry := tr.entry()
+			entry.Time = start
+			entry.Method = r.Method
+			entry.Path = r.URL.Path
+			entry.Status = rec.Status
+			entry.Duration = elapsed
+			l.add(entry)
+			log.Printf("%s: Slow request %s %s %s -> %d (%s)", prefix, id, r.Method, r.URL.Path, rec.Status, elapsed)
+		})
+	}
+}
+
+// trace накопичує відомості про запит, які обробник повідомляє через SetBackend та AddTiming.
+type trace struct {
+	id string
+
+	mu      sync.Mutex
+	backend string
+	timings map[string]time.Duration
+}
+
+type traceKey struct{}
+
+func (t *trace) entry() SlowEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return SlowEntry{RequestID: t.id, Backend: t.backend, Timings: t.timings}
+}
+
+// RequestID повертає ідентифікатор запиту, призначений Middleware, або порожній рядок.
+func RequestID(ctx context.Context) string {
+	if tr, ok := ctx.Value(traceKey{}).(*trace); ok {
+		return tr.id
+	}
+	return ""
+}
+
+// SetBackend запам'ятовує бекенд, який обслуговує запит.
+func SetBackend(ctx context.Context, backend string) {
+	if tr, ok := ctx.Value(traceKey{}).(*trace); ok {
+		tr.mu.Lock()
+		tr.backend = backend
+		tr.mu.Unlock()
+	}
+}
+
+// AddTiming додає d до тривалості звернень до залежності name.
+func AddTiming(ctx context.Context, name string, d time.Duration) {
+	if tr, ok := ctx.Value(traceKey{}).(*trace); ok {
+		tr.mu.Lock()
+		if tr.timings == nil {
+			tr.timings = make(map[string]time.Duration)
+		}
+		tr.timings[name] += d
+		tr.mu.Unlock()
+	}
+}
+
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
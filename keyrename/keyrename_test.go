@@ -0,0 +1,118 @@
+package keyrename
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse(strings.NewReader("# users\nuser-1  account-1\n\nuser-2 account-2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renames := m.Renames(); len(renames) != 2 || renames[1] != (Rename{Old: "user-2", New: "account-2"}) {
+		t.Errorf("Renames() = %v", renames)
+	}
+	if old, ok := m.OldKey("account-1"); !ok || old != "user-1" {
+		t.Errorf("OldKey(account-1) = %q, %t", old, ok)
+	}
+	if _, ok := m.OldKey("user-1"); ok {
+		t.Error("OldKey found a key that is not a new name")
+	}
+	var nilMapping *Mapping
+	if _, ok := nilMapping.OldKey("account-1"); ok {
+		t.Error("nil mapping renamed a key")
+	}
+
+	for name, input := range map[string]string{
+		"empty":         "# nothing\n",
+		"one field":     "user-1\n",
+		"to itself":     "a a\n",
+		"duplicate old": "a b\na c\n",
+		"duplicate new": "a c\nb c\n",
+		"chain":         "a b\nb c\n",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: Parse accepted %q", name, input)
+		}
+	}
+}
+
+// fakeDB імітує копіювання, читання та видалення ключів сервісу БД.
+type fakeDB struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (f *fakeDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, copyRequest := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/db/"), "/copy")
+	value, ok := f.values[key]
+	switch {
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+	case copyRequest:
+		var body struct {
+			To      string `json:"to"`
+			KeepTTL bool   `json:"keepTtl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.KeepTTL {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, exists := f.values[body.To]; exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.values[body.To] = value
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		delete(f.values, key)
+	case r.Method == http.MethodGet:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestMigrator_Migrate(t *testing.T) {
+	db := &fakeDB{values: map[string]string{"user-1": "alice", "user-2": "bob", "account-2": "bob-new"}}
+	srv := httptest.NewServer(db)
+	defer srv.Close()
+	m, err := Parse(strings.NewReader("user-1 account-1\nuser-2 account-2\nuser-3 account-3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := (&Migrator{BaseURL: srv.URL + "/db", DryRun: true}).Migrate(context.Background(), m)
+	if err != nil || report.Renamed != 2 || report.Missing != 1 || len(db.values) != 3 {
+		t.Fatalf("dry run = %+v, %v; values %v", report, err, db.values)
+	}
+
+	report, err = (&Migrator{BaseURL: srv.URL + "/db"}).Migrate(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Renamed != 1 || report.KeptNew != 1 || report.Missing != 1 || len(report.Failed) != 0 {
+		t.Errorf("Migrate report = %+v", report)
+	}
+	want := map[string]string{"account-1": "alice", "account-2": "bob-new"}
+	if len(db.values) != len(want) || db.values["account-1"] != want["account-1"] || db.values["account-2"] != want["account-2"] {
+		t.Errorf("values after migration = %v, want %v", db.values, want)
+	}
+
+	// Повторний запуск нічого не змінює.
+	if report, err = (&Migrator{BaseURL: srv.URL + "/db"}).Migrate(context.Background(), m); err != nil || report.Missing != 3 {
+		t.Errorf("second run = %+v, %v", report, err)
+	}
+
+	srv.Close()
+	if report, err = (&Migrator{BaseURL: srv.URL + "/db"}).Migrate(context.Background(), m); err != nil || len(report.Failed) != 3 {
+		t.Errorf("run against an unreachable DB = %+v, %v", report, err)
+	}
+}
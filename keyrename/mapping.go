@@ -0,0 +1,103 @@
+// Package keyrename перейменовує ключі бази за файлом відповідностей без зупинки сервісу.
+//
+// Перехід відбувається так: API-сервер запускають з файлом відповідностей (SERVER_KEY_RENAMES),
+// і він читає та пише ключі під новими назвами, а ключ, якого ще немає, шукає під старою.
+// Потім dbcli keys rename переносить значення в сервісі БД (Migrate). Коли перенесення
+// завершено, перехідний період (SERVER_KEY_RENAMES_UNTIL) закінчується і старі назви
+// більше не читаються.
+package keyrename
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Rename - перейменування ключа Old на New.
+type Rename struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Mapping - набір перейменувань з файлу відповідностей.
+type Mapping struct {
+	renames  []Rename
+	oldByNew map[string]string
+}
+
+// Load читає файл відповідностей path, див. Parse.
+func Load(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key mapping %s: %w", path, err)
+	}
+	defer f.Close()
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("key mapping %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse читає відповідності: по одній парі "стара_назва нова_назва" в рядку, порожні рядки
+// та рядки, що починаються з #, пропускаються. Кожна назва може зустрітися лише раз,
+// а нова назва не може бути старою назвою іншого ключа, щоб перейменування не залежали
+// від порядку.
+func Parse(r io.Reader) (*Mapping, error) {
+	m := &Mapping{oldByNew: make(map[string]string)}
+	oldKeys := make(map[string]int)
+	newLines := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"old-key new-key\", got %q", line, text)
+		}
+		oldKey, newKey := fields[0], fields[1]
+		if oldKey == newKey {
+			return nil, fmt.Errorf("line %d: key %q is renamed to itself", line, oldKey)
+		}
+		if prev, ok := oldKeys[oldKey]; ok {
+			return nil, fmt.Errorf("line %d: key %q is already renamed on line %d", line, oldKey, prev)
+		}
+		if prev, ok := newLines[newKey]; ok {
+			return nil, fmt.Errorf("line %d: new key %q is already used on line %d", line, newKey, prev)
+		}
+		oldKeys[oldKey] = line
+		newLines[newKey] = line
+		m.renames = append(m.renames, Rename{Old: oldKey, New: newKey})
+		m.oldByNew[newKey] = oldKey
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, rn := range m.renames {
+		if line, ok := oldKeys[rn.New]; ok {
+			return nil, fmt.Errorf("line %d: new key %q is renamed itself on line %d", newLines[rn.New], rn.New, line)
+		}
+	}
+	if len(m.renames) == 0 {
+		return nil, fmt.Errorf("no renames")
+	}
+	return m, nil
+}
+
+// Renames повертає перейменування в порядку файлу.
+func (m *Mapping) Renames() []Rename {
+	return append([]Rename(nil), m.renames...)
+}
+
+// OldKey повертає стару назву ключа newKey; ok == false, якщо ключ не перейменовується.
+func (m *Mapping) OldKey(newKey string) (oldKey string, ok bool) {
+	if m == nil {
+		return "", false
+	}
+	oldKey, ok = m.oldByNew[newKey]
+	return oldKey, ok
+}
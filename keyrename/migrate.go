@@ -0,0 +1,127 @@
+package keyrename
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Report - результат Migrate.
+type Report struct {
+	// Renamed - ключі, перенесені під нову назву (при DryRun - які було б перенесено).
+	Renamed int `json:"renamed"`
+	// Missing - старого ключа немає: його вже перенесено або він не існував.
+	Missing int `json:"missing"`
+	// KeptNew - новий ключ уже записано через API-сервер; старе значення видалено як застаріле.
+	KeptNew int       `json:"keptNew"`
+	Failed  []Failure `json:"failed,omitempty"`
+	DryRun  bool      `json:"dryRun,omitempty"`
+}
+
+// Failure - перейменування, яке не вдалося; повторний запуск Migrate його повторить.
+type Failure struct {
+	Rename
+	Error string `json:"error"`
+}
+
+// Migrator переносить значення ключів у сервісі БД за адресою BaseURL (напр. http://db:8081/db).
+type Migrator struct {
+	BaseURL string
+	Client  *http.Client
+	// DryRun лише перевіряє, які ключі існують, нічого не змінюючи.
+	DryRun bool
+}
+
+// Migrate переносить кожен ключ: копіює значення разом з терміном дії під нову назву,
+// не перезаписуючи її, і видаляє старий ключ. Якщо нова назва вже існує, її значення
+// записав API-сервер після початку переходу, тож воно новіше і старе лише видаляється.
+// Повторний запуск безпечний: перенесені ключі рахуються в Missing. Помилка окремого
+// ключа не зупиняє решту; помилка повертається лише при скасуванні ctx.
+func (mg *Migrator) Migrate(ctx context.Context, m *Mapping) (Report, error) {
+	report := Report{DryRun: mg.DryRun}
+	for _, rn := range m.renames {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := mg.rename(ctx, rn, &report); err != nil {
+			report.Failed = append(report.Failed, Failure{Rename: rn, Error: err.Error()})
+		}
+	}
+	return report, nil
+}
+
+func (mg *Migrator) rename(ctx context.Context, rn Rename, report *Report) error {
+	if mg.DryRun {
+		status, err := mg.do(ctx, http.MethodGet, rn.Old, "", nil)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case http.StatusNotFound:
+			report.Missing++
+		case http.StatusOK, http.StatusBadRequest:
+			// 400 - ключ існує, але не є рядком.
+			report.Renamed++
+		default:
+			return fmt.Errorf("reading %q returned status %d", rn.Old, status)
+		}
+		return nil
+	}
+
+	body, _ := json.Marshal(map[string]any{"to": rn.New, "keepTtl": true})
+	status, err := mg.do(ctx, http.MethodPost, rn.Old, "/copy", body)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated:
+		report.Renamed++
+	case http.StatusConflict:
+		report.KeptNew++
+	case http.StatusNotFound:
+		report.Missing++
+		return nil
+	default:
+		return fmt.Errorf("copying %q to %q returned status %d", rn.Old, rn.New, status)
+	}
+	status, err = mg.do(ctx, http.MethodDelete, rn.Old, "", nil)
+	if err != nil {
+		return fmt.Errorf("%q was copied, but not deleted: %w", rn.Old, err)
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("%q was copied, but deleting it returned status %d", rn.Old, status)
+	}
+	return nil
+}
+
+// do виконує запит до ключа key сервісу БД і повертає статус відповіді.
+func (mg *Migrator) do(ctx context.Context, method, key, suffix string, body []byte) (int, error) {
+	target := strings.TrimSuffix(mg.BaseURL, "/") + "/" + url.PathEscape(key) + suffix
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := mg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
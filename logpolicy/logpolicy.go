@@ -0,0 +1,211 @@
+package logpolicy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unicode/utf8"
+)
+
+// Політика журналювання визначає, як значення ключів потрапляють у журнали сервісів.
+// Правило обирається за найдовшим префіксом ключа; ключі без правила журналюються за
+// правилом Default. За замовчуванням значення замінюються хешем: його досить, щоб
+// зіставити записи журналів, але вміст значення в журнал не потрапляє.
+
+// Action - спосіб журналювання значення.
+type Action string
+
+const (
+	// Full журналює значення повністю.
+	Full Action = "full"
+	// Truncate журналює перші MaxLen символів значення та його довжину.
+	Truncate Action = "truncate"
+	// Hash журналює префікс SHA-256 значення.
+	Hash Action = "hash"
+	// Omit не журналює значення взагалі.
+	Omit Action = "omit"
+)
+
+// DefaultMaxLen - довжина, до якої Truncate обрізає значення, якщо MaxLen не задано.
+const DefaultMaxLen = 32
+
+// hashLen - кількість шістнадцяткових символів хешу в журналі.
+const hashLen = 12
+
+// Rule - правило журналювання значень ключів з префіксом Prefix.
+type Rule struct {
+	Prefix string `json:"prefix,omitempty"`
+	Action Action `json:"action"`
+	// MaxLen - довжина для Truncate; 0 - DefaultMaxLen.
+	MaxLen int `json:"maxLen,omitempty"`
+}
+
+// Policy - правила журналювання значень.
+type Policy struct {
+	// Default застосовується до ключів, яким не відповідає жодне правило; Prefix ігнорується.
+	Default Rule   `json:"default"`
+	Rules   []Rule `json:"rules,omitempty"`
+}
+
+// DefaultPolicy повертає політику, яка замінює всі значення хешем.
+func DefaultPolicy() Policy {
+	return Policy{Default: Rule{Action: Hash}}
+}
+
+// Validate перевіряє дії правил і унікальність префіксів.
+func (p Policy) Validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default rule: %w", err)
+	}
+	seen := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %d (prefix %q): %w", i+1, rule.Prefix, err)
+		}
+		if seen[rule.Prefix] {
+			return fmt.Errorf("rule %d: duplicate prefix %q", i+1, rule.Prefix)
+		}
+		seen[rule.Prefix] = true
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	switch r.Action {
+	case Full, Truncate, Hash, Omit:
+	default:
+		return fmt.Errorf("unknown action %q (want full, truncate, hash or omit)", r.Action)
+	}
+	if r.MaxLen < 0 {
+		return fmt.Errorf("maxLen must not be negative, got %d", r.MaxLen)
+	}
+	return nil
+}
+
+// Parse розбирає політику у форматі JSON і перевіряє її.
+func Parse(data []byte) (Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Policy{}, fmt.Errorf("invalid log policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, fmt.Errorf("invalid log policy: %w", err)
+	}
+	return p, nil
+}
+
+// Load читає політику з файлу path.
+func Load(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("failed to read log policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// rule повертає правило з найдовшим префіксом, що відповідає key.
+func (p Policy) rule(key string) Rule {
+	best, found := p.Default, false
+	for _, rule := range p.Rules {
+		if strings.HasPrefix(key, rule.Prefix) && (!found || len(rule.Prefix) > len(best.Prefix)) {
+			best, found = rule, true
+		}
+	}
+	return best
+}
+
+// Value повертає подання значення v ключа key для журналу.
+func (p Policy) Value(key string, v any) string {
+	rule := p.rule(key)
+	switch rule.Action {
+	case Full:
+		return fmt.Sprintf("%v", v)
+	case Truncate:
+		s := fmt.Sprintf("%v", v)
+		maxLen := rule.MaxLen
+		if maxLen == 0 {
+			maxLen = DefaultMaxLen
+		}
+		if utf8.RuneCountInString(s) <= maxLen {
+			return s
+		}
+		return fmt.Sprintf("%s...(%d bytes)", string([]rune(s)[:maxLen]), len(s))
+	case Omit:
+		return "<omitted>"
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			raw = []byte(fmt.Sprintf("%v", v))
+		}
+		sum := sha256.Sum256(raw)
+		return "sha256:" + hex.EncodeToString(sum[:])[:hashLen]
+	}
+}
+
+// Redactor - політика, яку можна замінити під час роботи сервісу.
+// Безпечний для одночасного використання.
+type Redactor struct {
+	policy atomic.Pointer[Policy]
+}
+
+// New створює Redactor з політикою p; p має бути перевіреною (див. Validate).
+func New(p Policy) *Redactor {
+	r := &Redactor{}
+	r.policy.Store(&p)
+	return r
+}
+
+// Policy повертає поточну політику.
+func (r *Redactor) Policy() Policy {
+	return *r.policy.Load()
+}
+
+// Set перевіряє і встановлює нову політику.
+func (r *Redactor) Set(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	r.policy.Store(&p)
+	return nil
+}
+
+// Value повертає подання значення v ключа key для журналу за поточною політикою.
+func (r *Redactor) Value(key string, v any) string {
+	return r.policy.Load().Value(key, v)
+}
+
+// ReloadOnSignal перечитує політику з файлу path щоразу, коли процес отримує SIGHUP.
+// Невдале перечитування залишає попередню політику. prefix - префікс повідомлень журналу.
+func (r *Redactor) ReloadOnSignal(path, prefix string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			p, err := Load(path)
+			if err != nil {
+				log.Printf("%s: Failed to reload log policy: %v", prefix, err)
+				continue
+			}
+			r.Set(p)
+			log.Printf("%s: Log policy reloaded from %s (%d rules)", prefix, path, len(p.Rules))
+		}
+	}()
+}
+
+// ServeHTTP віддає поточну політику у форматі JSON (для GET /admin/log-policy).
+func (r *Redactor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.Policy())
+}
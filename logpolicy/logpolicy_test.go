@@ -0,0 +1,76 @@
+package logpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Value(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"default": {"action": "hash"},
+		"rules": [
+			{"prefix": "public:", "action": "full"},
+			{"prefix": "public:token:", "action": "omit"},
+			{"prefix": "notes:", "action": "truncate", "maxLen": 5}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key   string
+		value any
+		want  string
+	}{
+		{"public:name", "Alice", "Alice"},
+		{"public:token:api", "s3cret", "<omitted>"},
+		{"notes:1", "hello world", "hello...(11 bytes)"},
+		{"notes:2", "short", "short"},
+		{"notes:3", "привіт світ", "приві...(21 bytes)"},
+	} {
+		if got := p.Value(tc.key, tc.value); got != tc.want {
+			t.Errorf("Value(%q) = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+
+	hashed := p.Value("secret", "s3cret")
+	if !strings.HasPrefix(hashed, "sha256:") || strings.Contains(hashed, "s3cret") {
+		t.Errorf("hashed value %q", hashed)
+	}
+	if again := p.Value("other", "s3cret"); again != hashed {
+		t.Errorf("hash of the same value differs: %q and %q", hashed, again)
+	}
+	if other := p.Value("secret", "s3cret2"); other == hashed {
+		t.Errorf("different values have the same hash %q", hashed)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		`{"default": {"action": "show"}}`,
+		`{"default": {"action": "hash"}, "rules": [{"prefix": "a", "action": "omit"}, {"prefix": "a", "action": "full"}]}`,
+		`{"default": {"action": "truncate", "maxLen": -1}}`,
+		`{}`,
+		`not json`,
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Parse(%s) succeeded", raw)
+		}
+	}
+}
+
+func TestRedactor_Set(t *testing.T) {
+	r := New(DefaultPolicy())
+	if got := r.Value("k", "v"); !strings.HasPrefix(got, "sha256:") {
+		t.Errorf("default policy logged %q", got)
+	}
+	if err := r.Set(Policy{Default: Rule{Action: "bogus"}}); err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+	if err := r.Set(Policy{Default: Rule{Action: Full}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Value("k", "v"); got != "v" {
+		t.Errorf("after Set logged %q, want %q", got, "v")
+	}
+}
@@ -0,0 +1,55 @@
+package selftest
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Report збирає результати перевірок самотестування сервісу.
+type Report struct {
+	service string
+	failed  int
+	lines   []string
+}
+
+// New створює звіт для сервісу service.
+func New(service string) *Report {
+	return &Report{service: service}
+}
+
+// Check виконує перевірку name та записує її результат у звіт.
+func (r *Report) Check(name string, fn func() error) bool {
+	start := time.Now()
+	err := fn()
+	status := "ok"
+	if err != nil {
+		r.failed++
+		status = "FAIL: " + err.Error()
+	}
+	r.lines = append(r.lines, fmt.Sprintf("  %-40s %s (%s)", name, status, time.Since(start).Round(time.Millisecond)))
+	return err == nil
+}
+
+// OK повідомляє, чи всі перевірки пройшли успішно.
+func (r *Report) OK() bool {
+	return r.failed == 0
+}
+
+// Print виводить звіт та повертає код завершення процесу: 0 при успіху, 1 при помилках.
+func (r *Report) Print(w io.Writer) int {
+	return r.print(w, "SELFTEST")
+}
+
+func (r *Report) print(w io.Writer, label string) int {
+	fmt.Fprintf(w, "%s %s:\n", label, r.service)
+	for _, line := range r.lines {
+		fmt.Fprintln(w, line)
+	}
+	if r.OK() {
+		fmt.Fprintf(w, "%s %s: PASS (%d checks)\n", label, r.service, len(r.lines))
+		return 0
+	}
+	fmt.Fprintf(w, "%s %s: FAIL (%d of %d checks failed)\n", label, r.service, r.failed, len(r.lines))
+	return 1
+}
@@ -0,0 +1,84 @@
+package selftest
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	r := New("svc")
+	r.Check("passes", func() error { return nil })
+	if !r.OK() {
+		t.Fatal("report should be OK after a passing check")
+	}
+	r.Check("fails", func() error { return errors.New("boom") })
+
+	var out bytes.Buffer
+	if code := r.Print(&out); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(out.String(), "FAIL: boom") || !strings.Contains(out.String(), "1 of 2 checks failed") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
+
+func TestStartup(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+
+	s := NewStartup("svc")
+	s.Config("PORT", busyPort)
+	s.Config("EMPTY", "")
+	s.Secret("TOKEN", "hunter2")
+	s.Check("port is available", func() error { return CheckPort(busyPort) })
+	s.Check("dir is writable", func() error { return CheckWritableDir(filepath.Join(t.TempDir(), "nested")) })
+
+	var out bytes.Buffer
+	if err := s.Run(&out); err == nil {
+		t.Error("Run succeeded with a busy port")
+	}
+	report := out.String()
+	for _, want := range []string{"STARTUP svc configuration:", "(not set)", "(set)", "is not available", "1 of 2 checks failed"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "hunter2") {
+		t.Errorf("report leaks a secret:\n%s", report)
+	}
+}
+
+func TestStartupChecks(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		ok   bool
+	}{
+		{"valid url", CheckURL("http://db:8081/db"), true},
+		{"relative url", CheckURL("db:8081/db"), false},
+		{"valid host:port", CheckHostPort("server1:8080"), true},
+		{"missing port", CheckHostPort("server1"), false},
+		{"invalid port", CheckPort("http"), false},
+	} {
+		if (tc.err == nil) != tc.ok {
+			t.Errorf("%s: err = %v", tc.name, tc.err)
+		}
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritableDir(filepath.Join(file, "dir")); err == nil {
+		t.Error("CheckWritableDir accepted a path below a regular file")
+	}
+}
@@ -0,0 +1,115 @@
+package selftest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Startup - банер з конфігурацією та перевірки оточення, які сервіс виконує при кожному
+// запуску, перш ніж приймати запити. Помилка конфігурації зупиняє запуск одразу,
+// а не проявляється пізніше помилками 500 посеред обробки запитів.
+type Startup struct {
+	report *Report
+	config [][2]string
+}
+
+// NewStartup створює перевірки запуску сервісу service.
+func NewStartup(service string) *Startup {
+	return &Startup{report: New(service)}
+}
+
+// Config додає параметр name з остаточним значенням value до банера.
+func (s *Startup) Config(name string, value any) {
+	shown := fmt.Sprint(value)
+	if shown == "" {
+		shown = "(not set)"
+	}
+	s.config = append(s.config, [2]string{name, shown})
+}
+
+// Secret додає до банера параметр name, не розкриваючи його значення.
+func (s *Startup) Secret(name, value string) {
+	shown := "(not set)"
+	if value != "" {
+		shown = "(set)"
+	}
+	s.config = append(s.config, [2]string{name, shown})
+}
+
+// Check виконує перевірку name, див. Report.Check.
+func (s *Startup) Check(name string, fn func() error) bool {
+	return s.report.Check(name, fn)
+}
+
+// Run виводить банер і результати перевірок у w. Повертає помилку, якщо хоч одна перевірка
+// не пройшла; сервіс має завершитися, не починаючи роботу.
+func (s *Startup) Run(w io.Writer) error {
+	fmt.Fprintf(w, "STARTUP %s configuration:\n", s.report.service)
+	for _, kv := range s.config {
+		fmt.Fprintf(w, "  %-40s %s\n", kv[0], kv[1])
+	}
+	if s.report.print(w, "STARTUP") != 0 {
+		return fmt.Errorf("%d of %d startup checks failed, see the report above", s.report.failed, len(s.report.lines))
+	}
+	return nil
+}
+
+// CheckPort перевіряє, що port - коректний номер порту і його можна зайняти.
+func CheckPort(port string) error {
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid port %q: must be a number between 1 and 65535", port)
+	}
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return fmt.Errorf("port %d is not available (%v): stop the process that uses it or choose another port", p, err)
+	}
+	return l.Close()
+}
+
+// CheckWritableDir створює директорію dir, якщо її немає, і перевіряє, що в ній можна створити файл.
+func CheckWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory %s (%v): check the path and permissions of its parent", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".startup-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable (%v): check its permissions or volume mount", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckWritableFile перевіряє, що файл path можна створити: його директорія доступна для запису.
+func CheckWritableFile(path string) error {
+	return CheckWritableDir(filepath.Dir(path))
+}
+
+// CheckURL перевіряє, що raw - абсолютна адреса http(s).
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL, expected e.g. http://db:8081/db", raw)
+	}
+	return nil
+}
+
+// CheckHostPort перевіряє, що addr має вигляд host:port.
+func CheckHostPort(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q (%v): expected host:port, e.g. server1:8080", addr, err)
+	}
+	if p, err := strconv.Atoi(port); host == "" || err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid address %q: expected host:port, e.g. server1:8080", addr)
+	}
+	return nil
+}